@@ -105,6 +105,9 @@ type compactMetrics struct {
 	blockCleanupFailures        prometheus.Counter
 	blocksMarked                *prometheus.CounterVec
 	garbageCollectedBlocks      prometheus.Counter
+	quarantinedGroups           prometheus.Counter
+	noCompactMarksRemoved       prometheus.Counter
+	chunkCompressionSavedBytes  prometheus.Counter
 }
 
 func newCompactMetrics(reg *prometheus.Registry, deleteDelay time.Duration) *compactMetrics {
@@ -152,12 +155,26 @@ func newCompactMetrics(reg *prometheus.Registry, deleteDelay time.Duration) *com
 	}, []string{"marker", "reason"})
 	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.OutOfOrderChunksNoCompactReason)
 	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.IndexSizeExceedingNoCompactReason)
+	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.CompactionFailedNoCompactReason)
+	m.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.SplitBlockNoCompactReason)
 	m.blocksMarked.WithLabelValues(metadata.DeletionMarkFilename, "")
 
 	m.garbageCollectedBlocks = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_compact_garbage_collected_blocks_total",
 		Help: "Total number of blocks marked for deletion by compactor.",
 	})
+	m.quarantinedGroups = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_quarantined_groups_total",
+		Help: "Total number of compaction groups quarantined after exhausting their compaction attempts.",
+	})
+	m.noCompactMarksRemoved = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_no_compact_marks_removed_total",
+		Help: "Total number of no-compact marks removed for being older than the no-compact mark max age.",
+	})
+	m.chunkCompressionSavedBytes = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_chunk_compression_saved_bytes_total",
+		Help: "Total number of bytes saved by compressing the chunk files of compacted blocks.",
+	})
 	return m
 }
 
@@ -170,6 +187,10 @@ func runCompact(
 	conf compactConfig,
 	flagsMap map[string]string,
 ) (rerr error) {
+	if conf.downsampleOnly && conf.disableDownsampling {
+		return errors.New("--downsample-only and --downsampling.disable are mutually exclusive")
+	}
+
 	deleteDelay := time.Duration(conf.deleteDelay)
 	compactMetrics := newCompactMetrics(reg, deleteDelay)
 	downsampleMetrics := newDownsampleMetrics(reg)
@@ -321,10 +342,14 @@ func runCompact(
 
 	// Instantiate the compactor with different time slices. Timestamps in TSDB
 	// are in milliseconds.
-	comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, levels, downsample.NewPool(), mergeFunc)
+	var comp compact.Compactor
+	comp, err = tsdb.NewLeveledCompactor(ctx, reg, logger, levels, downsample.NewPool(), mergeFunc)
 	if err != nil {
 		return errors.Wrap(err, "create compactor")
 	}
+	if conf.chunkCompression == block.ChunkCompressionZstd {
+		comp = compact.NewChunkCompressingCompactor(logger, comp, compactMetrics.chunkCompressionSavedBytes)
+	}
 
 	var (
 		compactDir      = path.Join(conf.dataDir, "compact")
@@ -350,8 +375,11 @@ func runCompact(
 		compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.OutOfOrderChunksNoCompactReason),
 		metadata.HashFunc(conf.hashFunc),
 		conf.blockFilesConcurrency,
+		conf.compactionDownloadConcurrency,
+		int64(conf.maxBlockSize),
+		compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.SplitBlockNoCompactReason),
 	)
-	tsdbPlanner := compact.NewPlanner(logger, levels, noCompactMarkerFilter)
+	tsdbPlanner := compact.NewPlanner(logger, levels, noCompactMarkerFilter, time.Duration(conf.backfillWindow))
 	planner := compact.WithLargeTotalIndexSizeFilter(
 		tsdbPlanner,
 		bkt,
@@ -369,6 +397,9 @@ func runCompact(
 		bkt,
 		conf.compactionConcurrency,
 		conf.skipBlockWithOutOfOrderChunks,
+		conf.maxGroupCompactionAttempts,
+		compactMetrics.quarantinedGroups,
+		compactMetrics.blocksMarked.WithLabelValues(metadata.NoCompactMarkFilename, metadata.CompactionFailedNoCompactReason),
 	)
 	if err != nil {
 		return errors.Wrap(err, "create bucket compactor")
@@ -419,7 +450,18 @@ func runCompact(
 	}
 
 	compactMainFn := func() error {
-		if err := compactor.Compact(ctx); err != nil {
+		if !conf.downsampleOnly && conf.noCompactMarkMaxAge > 0 {
+			if err := sy.SyncMetas(ctx); err != nil {
+				return errors.Wrap(err, "sync before removing expired no-compact marks")
+			}
+			if err := compact.RemoveExpiredNoCompactMarks(ctx, logger, bkt, noCompactMarkerFilter.NoCompactMarkedBlocks(), time.Duration(conf.noCompactMarkMaxAge), compactMetrics.noCompactMarksRemoved); err != nil {
+				return errors.Wrap(err, "remove expired no-compact marks")
+			}
+		}
+
+		if conf.downsampleOnly {
+			level.Info(logger).Log("msg", "compaction skipped in downsample only mode")
+		} else if err := compactor.Compact(ctx); err != nil {
 			return errors.Wrap(err, "compaction")
 		}
 
@@ -453,6 +495,11 @@ func runCompact(
 			level.Info(logger).Log("msg", "downsampling was explicitly disabled")
 		}
 
+		// Retention and cleanup are left to the compactors of the bucket.
+		if conf.downsampleOnly {
+			return nil
+		}
+
 		// TODO(bwplotka): Find a way to avoid syncing if no op was done.
 		if err := sy.SyncMetas(ctx); err != nil {
 			return errors.Wrap(err, "sync before retention")
@@ -533,7 +580,7 @@ func runCompact(
 
 		// Periodically remove partial blocks and blocks marked for deletion
 		// since one iteration potentially could take a long time.
-		if conf.cleanupBlocksInterval > 0 {
+		if conf.cleanupBlocksInterval > 0 && !conf.downsampleOnly {
 			g.Add(func() error {
 				return runutil.Repeat(conf.cleanupBlocksInterval, ctx.Done(), cleanPartialMarked)
 			}, func(error) {
@@ -563,17 +610,19 @@ func runCompact(
 						return errors.Wrapf(err, "could not group metadata for compaction")
 					}
 
-					if err = ps.ProgressCalculate(ctx, groups); err != nil {
-						return errors.Wrapf(err, "could not calculate compaction progress")
-					}
+					if !conf.downsampleOnly {
+						if err = ps.ProgressCalculate(ctx, groups); err != nil {
+							return errors.Wrapf(err, "could not calculate compaction progress")
+						}
 
-					retGroups, err := grouper.Groups(metas)
-					if err != nil {
-						return errors.Wrapf(err, "could not group metadata for retention")
-					}
+						retGroups, err := grouper.Groups(metas)
+						if err != nil {
+							return errors.Wrapf(err, "could not group metadata for retention")
+						}
 
-					if err = rs.ProgressCalculate(ctx, retGroups); err != nil {
-						return errors.Wrapf(err, "could not calculate retention progress")
+						if err = rs.ProgressCalculate(ctx, retGroups); err != nil {
+							return errors.Wrapf(err, "could not calculate retention progress")
+						}
 					}
 
 					if !conf.disableDownsampling {
@@ -630,19 +679,26 @@ type compactConfig struct {
 	wait                                           bool
 	waitInterval                                   time.Duration
 	disableDownsampling                            bool
+	downsampleOnly                                 bool
 	blockMetaFetchConcurrency                      int
 	blockFilesConcurrency                          int
+	compactionDownloadConcurrency                  int
 	blockViewerSyncBlockInterval                   time.Duration
 	blockViewerSyncBlockTimeout                    time.Duration
 	cleanupBlocksInterval                          time.Duration
 	compactionConcurrency                          int
+	maxGroupCompactionAttempts                     int
 	downsampleConcurrency                          int
 	deleteDelay                                    model.Duration
+	noCompactMarkMaxAge                            model.Duration
+	chunkCompression                               string
 	dedupReplicaLabels                             []string
 	selectorRelabelConf                            extflag.PathOrContent
 	webConf                                        webConfig
 	label                                          string
 	maxBlockIndexSize                              units.Base2Bytes
+	maxBlockSize                                   units.Base2Bytes
+	backfillWindow                                 model.Duration
 	hashFunc                                       string
 	enableVerticalCompaction                       bool
 	dedupFunc                                      string
@@ -687,6 +743,9 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("downsampling.disable", "Disables downsampling. This is not recommended "+
 		"as querying long time ranges without non-downsampled data is not efficient and useful e.g it is not possible to render all samples for a human eye anyway").
 		Default("false").BoolVar(&cc.disableDownsampling)
+	cmd.Flag("downsample-only", "Only downsample eligible blocks, skipping compaction, retention and the cleanup of blocks. "+
+		"Useful to run a dedicated downsampler next to the compactors of the bucket, as blocks still have to be compacted to become eligible for downsampling.").
+		Default("false").BoolVar(&cc.downsampleOnly)
 
 	cmd.Flag("block-meta-fetch-concurrency", "Number of goroutines to use when fetching block metadata from object storage.").
 		Default("32").IntVar(&cc.blockMetaFetchConcurrency)
@@ -703,6 +762,12 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
 		Default("1").IntVar(&cc.compactionConcurrency)
+	cmd.Flag("compact.blocks-download-concurrency", "Maximum number of source blocks downloaded at once for compaction, across all groups compacted concurrently. "+
+		"Files of each block are still fetched by --block-files-concurrency goroutines. 0 means no limit other than --compact.concurrency.").
+		Default("0").IntVar(&cc.compactionDownloadConcurrency)
+	cmd.Flag("compact.max-group-attempts", "Number of attempts to compact a failing group before it's quarantined: the blocks planned to be compacted are marked for no compaction (no-compact-mark.json is uploaded) "+
+		"and compaction of other groups continues instead of retrying the whole compaction. Groups are quarantined whatever the error, including halt and retry errors. 0 disables quarantine.").
+		Default("0").IntVar(&cc.maxGroupCompactionAttempts)
 	cmd.Flag("downsample.concurrency", "Number of goroutines to use when downsampling blocks.").
 		Default("1").IntVar(&cc.downsampleConcurrency)
 
@@ -713,6 +778,14 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"or compactor is ignoring the deletion because it's compacting the block at the same time.").
 		Default("48h").SetValue(&cc.deleteDelay)
 
+	cmd.Flag("compact.no-compact-mark-max-age", "Age after which no-compact marks (no-compact-mark.json) are removed, so that their blocks become compactable again, e.g. blocks marked manually during an investigation and never unmarked. "+
+		"Blocks the compactor itself marked, e.g. because of out of order chunks, are marked again if they still can't be compacted. 0 disables it.").
+		Default("0d").SetValue(&cc.noCompactMarkMaxAge)
+
+	cmd.Flag("compact.chunk-compression", "Compression of the chunk files of compacted blocks. With zstd, chunk files are compressed in frames which store gateways decompress when reading chunks, while compactors decompress downloaded blocks. "+
+		"Blocks with compressed chunk files can only be read by Thanos versions supporting them.").
+		Default(block.ChunkCompressionNone).EnumVar(&cc.chunkCompression, block.ChunkCompressionNone, block.ChunkCompressionZstd)
+
 	cmd.Flag("compact.enable-vertical-compaction", "Experimental. When set to true, compactor will allow overlaps and perform **irreversible** vertical compaction. See https://thanos.io/tip/components/compact.md/#vertical-compactions to read more. "+
 		"Please note that by default this uses a NAIVE algorithm for merging. If you need a different deduplication algorithm (e.g one that works well with Prometheus replicas), please set it via --deduplication.func."+
 		"NOTE: This flag is ignored and (enabled) when --deduplication.replica-label flag is set.").
@@ -736,6 +809,17 @@ func (cc *compactConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"Default is due to https://github.com/thanos-io/thanos/issues/1424, but it's overall recommended to keeps block size to some reasonable size.").
 		Hidden().Default("64GB").BytesVar(&cc.maxBlockIndexSize)
 
+	cmd.Flag("compact.block-max-size", "Maximum estimated size of blocks resulting from compaction. If the source blocks of a compaction exceed it in total, "+
+		"consecutive runs of them, each within this size if possible, are compacted into separate blocks which are marked for no compaction (no-compact-mark.json is uploaded), "+
+		"so that they aren't compacted back together. Source blocks exceeding it alone are only marked for no compaction. The size is estimated from the size of the source blocks, "+
+		"and it's ignored for overlapping blocks. 0 disables it.").
+		Default("0B").BytesVar(&cc.maxBlockSize)
+
+	cmd.Flag("compact.backfill-window", "Groups of blocks whose most recent block ended longer than this duration ago are treated as backfilled historical data, which isn't followed by newer blocks. "+
+		"Their most recent block isn't held back from compaction and their incomplete compaction ranges are compacted too, so that backfilled blocks reach the sizes required for downsampling. "+
+		"It should be longer than the largest compaction level, so that groups which are still written to aren't treated as backfilled. 0 disables it.").
+		Default("0d").SetValue(&cc.backfillWindow)
+
 	cmd.Flag("compact.skip-block-with-out-of-order-chunks", "When set to true, mark blocks containing index with out-of-order chunks for no compact instead of halting the compaction").
 		Hidden().Default("false").BoolVar(&cc.skipBlockWithOutOfOrderChunks)
 
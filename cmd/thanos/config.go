@@ -9,10 +9,12 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/alecthomas/units"
 	extflag "github.com/efficientgo/tools/extkingpin"
 
 	"github.com/prometheus/common/model"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
+	"github.com/thanos-io/thanos/pkg/objstore"
 )
 
 type grpcConfig struct {
@@ -126,6 +128,7 @@ type shipperConfig struct {
 	ignoreBlockSize       bool
 	allowOutOfOrderUpload bool
 	hashFunc              string
+	multipartUpload       multipartUploadConfig
 }
 
 func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig {
@@ -142,9 +145,37 @@ func (sc *shipperConfig) registerFlag(cmd extkingpin.FlagClause) *shipperConfig
 		Default("false").Hidden().BoolVar(&sc.allowOutOfOrderUpload)
 	cmd.Flag("hash-func", "Specify which hash function to use when calculating the hashes of produced files. If no function has been specified, it does not happen. This permits avoiding downloading some files twice albeit at some performance cost. Possible values are: \"\", \"SHA256\".").
 		Default("").EnumVar(&sc.hashFunc, "SHA256", "")
+	sc.multipartUpload.registerFlag(cmd)
 	return sc
 }
 
+type multipartUploadConfig struct {
+	threshold   units.Base2Bytes
+	partSize    units.Base2Bytes
+	concurrency uint
+}
+
+func (mc *multipartUploadConfig) registerFlag(cmd extkingpin.FlagClause) *multipartUploadConfig {
+	cmd.Flag("shipper.multipart-upload-threshold",
+		"Block files of at least this size are uploaded by the shipper with multipart upload, if supported by the object storage (currently S3). 0 disables it, leaving the upload method to the object storage client.").
+		Default("0").BytesVar(&mc.threshold)
+	cmd.Flag("shipper.multipart-upload-part-size",
+		"Size of the parts of the multipart uploads done by the shipper. S3 requires at least 5MiB.").
+		Default("64MiB").BytesVar(&mc.partSize)
+	cmd.Flag("shipper.multipart-upload-concurrency",
+		"Number of parts of a multipart upload done by the shipper uploaded concurrently.").
+		Default("4").UintVar(&mc.concurrency)
+	return mc
+}
+
+// uploadOptions returns the options enabling multipart upload of the shipped block files, if configured.
+func (mc *multipartUploadConfig) uploadOptions() []objstore.UploadOption {
+	if mc.threshold <= 0 {
+		return nil
+	}
+	return []objstore.UploadOption{objstore.WithMultipartUpload(int64(mc.threshold), uint64(mc.partSize), mc.concurrency)}
+}
+
 type webConfig struct {
 	routePrefix      string
 	externalPrefix   string
@@ -200,6 +231,7 @@ type alertMgrConfig struct {
 	alertExcludeLabels     []string
 	alertQueryURL          *string
 	alertRelabelConfigPath *extflag.PathOrContent
+	alertDedupWindow       time.Duration
 }
 
 func (ac *alertMgrConfig) registerFlag(cmd extflag.FlagClause) *alertMgrConfig {
@@ -214,5 +246,7 @@ func (ac *alertMgrConfig) registerFlag(cmd extflag.FlagClause) *alertMgrConfig {
 	cmd.Flag("alert.label-drop", "Labels by name to drop before sending to alertmanager. This allows alert to be deduplicated on replica label (repeated). Similar Prometheus alert relabelling").
 		StringsVar(&ac.alertExcludeLabels)
 	ac.alertRelabelConfigPath = extflag.RegisterPathOrContent(cmd, "alert.relabel-config", "YAML file that contains alert relabelling configuration.", extflag.WithEnvSubstitution())
+	cmd.Flag("alert.dedup-window", "Duration within which an alert notification identical to one already sent to Alertmanager is not sent again, e.g. on retry. 0 disables deduplication.").
+		Default("0s").DurationVar(&ac.alertDedupWindow)
 	return ac
 }
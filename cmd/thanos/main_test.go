@@ -15,15 +15,20 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/oklog/run"
 	"github.com/oklog/ulid"
+	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
+	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
@@ -205,3 +210,85 @@ func TestCleanupDownsampleCacheFolder(t *testing.T) {
 	_, err = os.Stat(dir)
 	testutil.Assert(t, os.IsNotExist(err), "index cache dir should not exist at the end of execution")
 }
+
+func TestCompactDownsampleOnly(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stderr)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	for _, tcase := range []struct {
+		name           string
+		downsampleOnly bool
+	}{
+		{name: "compaction and downsampling"},
+		{name: "downsampling only", downsampleOnly: true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			bktDir := path.Join(dir, "bucket")
+			bkt, err := filesystem.NewBucket(bktDir)
+			testutil.Ok(t, err)
+
+			// A block long enough to be downsampled to 5m resolution.
+			id, err := e2eutil.CreateBlock(ctx, path.Join(dir, "blocks"),
+				[]labels.Labels{{{Name: "a", Value: "1"}}},
+				100, 0, downsample.ResLevel1DownsampleRange+1,
+				labels.Labels{{Name: "e1", Value: "1"}},
+				downsample.ResLevel0, metadata.NoneFunc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, "blocks", id.String()), metadata.NoneFunc))
+			// Consecutive 2h blocks, too short to be downsampled but compacted to an 8h block.
+			for i := int64(0); i < 5; i++ {
+				id, err := e2eutil.CreateBlock(ctx, path.Join(dir, "blocks"),
+					[]labels.Labels{{{Name: "a", Value: "2"}}},
+					10, i*2*time.Hour.Milliseconds(), (i+1)*2*time.Hour.Milliseconds(),
+					labels.Labels{{Name: "e1", Value: "2"}},
+					downsample.ResLevel0, metadata.NoneFunc)
+				testutil.Ok(t, err)
+				testutil.Ok(t, block.Upload(ctx, logger, bkt, path.Join(dir, "blocks", id.String()), metadata.NoneFunc))
+			}
+
+			args := []string{
+				"--http-address=127.0.0.1:0",
+				"--data-dir=" + path.Join(dir, "data"),
+				"--objstore.config=" + fmt.Sprintf("type: FILESYSTEM\nconfig:\n  directory: %s\n", bktDir),
+				"--consistency-delay=0s",
+			}
+			if tcase.downsampleOnly {
+				args = append(args, "--downsample-only")
+			}
+			app := kingpin.New("test", "")
+			conf := compactConfig{}
+			conf.registerFlag(app)
+			_, err = app.Parse(args)
+			testutil.Ok(t, err)
+
+			var g run.Group
+			testutil.Ok(t, runCompact(&g, logger, opentracing.NoopTracer{}, prometheus.NewRegistry(), component.Compact, conf, nil))
+			testutil.Ok(t, g.Run())
+
+			metaFetcher, err := block.NewMetaFetcher(nil, block.FetcherConcurrency, objstore.WithNoopInstr(bkt), "", nil, nil)
+			testutil.Ok(t, err)
+			metas, _, err := metaFetcher.Fetch(ctx)
+			testutil.Ok(t, err)
+
+			var compacted, downsampled int
+			for _, m := range metas {
+				if m.Compaction.Level > 1 {
+					compacted++
+				}
+				if m.Thanos.Downsample.Resolution == downsample.ResLevel1 {
+					downsampled++
+					testutil.Equals(t, "1", m.Thanos.Labels["e1"])
+				}
+			}
+			testutil.Equals(t, 1, downsampled)
+			if tcase.downsampleOnly {
+				testutil.Equals(t, 0, compacted)
+				testutil.Equals(t, 7, len(metas))
+			} else {
+				testutil.Equals(t, 1, compacted)
+			}
+		})
+	}
+}
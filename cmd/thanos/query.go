@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	extflag "github.com/efficientgo/tools/extkingpin"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
@@ -26,10 +28,13 @@ import (
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 
 	apiv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	"github.com/thanos-io/thanos/pkg/exemplars"
@@ -44,6 +49,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/metadata"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/receive"
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
@@ -86,6 +92,15 @@ func registerQuery(app *extkingpin.App) {
 	queryTimeout := extkingpin.ModelDuration(cmd.Flag("query.timeout", "Maximum time to process query by query node.").
 		Default("2m"))
 
+	storeDeadlineHeadroom := extkingpin.ModelDuration(cmd.Flag("query.store-deadline-headroom", "Time reserved from the deadline of a query for merging and serializing the results of stores. Store API calls get a deadline earlier than the deadline of the query by this headroom, so a slow store can't consume the whole time of the query. 0s disables the headroom.").
+		Default("0s"))
+
+	maxLabelValueCardinality := cmd.Flag("query.max-label-value-cardinality", "Maximum number of values a label of a non-equality matcher, e.g. pod=~\".+\", can match in a select. Selects exceeding it are rejected before fetching series, based on the label values returned by stores for the matchers of the select. 0 means no limit.").
+		Default("0").Int()
+
+	maxMatchersPerSelector := cmd.Flag("query.max-matchers-per-selector", "Maximum number of label matchers of a selector, e.g. in a query or in the match[] parameter of the series and labels APIs. Requests with selectors exceeding it are rejected with 422 before reaching the stores. 0 means no limit.").
+		Default("0").Int()
+
 	maxConcurrentQueries := cmd.Flag("query.max-concurrent", "Maximum number of queries processed concurrently by query node.").
 		Default("20").Int()
 
@@ -95,13 +110,34 @@ func registerQuery(app *extkingpin.App) {
 	maxConcurrentSelects := cmd.Flag("query.max-concurrent-select", "Maximum number of select requests made concurrently per a query.").
 		Default("4").Int()
 
+	maxConcurrentStoreSelects := cmd.Flag("query.max-concurrent-store-selects", "Maximum number of Series calls made concurrently to stores per a select. The others wait for a free slot, buffering the series of the stores being fetched. 0 means no limit.").
+		Default("0").Int()
+
+	storeHedgingDelay := cmd.Flag("query.hedging.delay", "Delay after which Series calls to a store which didn't respond yet are hedged to a replica of the store, i.e. a store of the same component type with the same external labels and time range, using the response of whichever responds first. Only one of the replicas is called otherwise. A delay around the 95th percentile of the Series latency of the stores is a good start. 0s disables hedging.").
+		Default("0s").Duration()
+
 	queryReplicaLabels := cmd.Flag("query.replica-label", "Labels to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter. Data includes time series, recording rules, and alerting rules.").
 		Strings()
 
+	storeTypeReplicaLabelFlags := cmd.Flag("query.store-type-replica-label", "Replica label deduplicated only on time series coming from stores of the given type, in addition to --query.replica-label (repeatable). Possible store types are: sidecar, receive, rule, store, query.").
+		PlaceHolder("<store type>=<label>").Strings()
+
+	dedupAlgorithm := cmd.Flag("query.deduplication.func", "Algorithm deduplicating the replicas of series. 'penalty' follows a single replica and switches to another one on gaps, skipping the samples of the other replicas close to the switch. 'chain' also follows a single replica until it has a gap, but then switches to the replica with the earliest sample in the gap without skipping any.").
+		Default(dedup.AlgorithmPenalty).Enum(dedup.AlgorithmPenalty, dedup.AlgorithmChain)
+
 	instantDefaultMaxSourceResolution := extkingpin.ModelDuration(cmd.Flag("query.instant.default.max_source_resolution", "default value for max_source_resolution for instant queries. If not set, defaults to 0s only taking raw resolution into account. 1h can be a good value if you use instant queries over time ranges that incorporate times outside of your raw-retention.").Default("0s").Hidden())
 
 	defaultMetadataTimeRange := cmd.Flag("query.metadata.default-time-range", "The default metadata time range duration for retrieving labels through Labels and Series API when the range parameters are not specified. The zero value means range covers the time since the beginning.").Default("0s").Duration()
 
+	maxResponseBytes := cmd.Flag("query.max-response-bytes", "Maximum estimated size of the result of a single query or range query. Queries returning larger results are rejected with HTTP 413 before being serialized. The size is estimated from the result without escaping or the response envelope, so actual responses can be slightly larger. 0 means no limit.").
+		Default("0").Bytes()
+
+	maxMultiInstantTimes := cmd.Flag("query.max-multi-instant-times", "Maximum number of evaluation times of a single multi instant query. See https://thanos.io/tip/components/query.md/#multi-instant-queries").
+		Default("100").Int()
+
+	tenantHeader := cmd.Flag("query.tenant-header", "HTTP header to determine the tenant of query requests, which is forwarded to stores, e.g. to apply the request limits of the tenant in Store Gateways. An empty value disables it.").
+		Default(receive.DefaultTenantHeader).String()
+
 	selectorLabels := cmd.Flag("selector-label", "Query selector labels that will be exposed in info endpoint (repeated).").
 		PlaceHolder("<name>=\"<value>\"").Strings()
 
@@ -131,6 +167,30 @@ func registerQuery(app *extkingpin.App) {
 	strictEndpoints := cmd.Flag("endpoint-strict", "Addresses of only statically configured Thanos API servers that are always used, even if the health check fails. Useful if you have a caching layer on top.").
 		PlaceHolder("<staticendpoint>").Strings()
 
+	endpointCompressionFlags := cmd.Flag("endpoint.grpc-compression", "Compression used for gRPC requests to endpoints with address fully matching the given regex (repeatable). Possible compressions are: none, snappy, gzip, zstd. The first matching entry is used; endpoints not matching any entry use no compression. Endpoints not supporting the compression fall back to no compression. Addresses of endpoints discovered through DNS are resolved addresses.").
+		PlaceHolder("<address regex>=<compression>").Strings()
+
+	endpointTLSConfig := extflag.RegisterPathOrContent(cmd, "endpoint.tls-config", "YAML file that contains TLS configurations of gRPC connections to endpoints with matching addresses, taking precedence over the --grpc-client-tls-* flags. See format details: https://thanos.io/tip/components/query.md/#per-endpoint-tls", extflag.WithEnvSubstitution())
+
+	endpointReconnectBaseDelay := cmd.Flag("endpoint.reconnect-backoff-base-delay", "Delay of reconnecting to an endpoint after its first failure. Reconnections to endpoints failing consecutively are then backed off exponentially, and gRPC connections kept to endpoints reconnect with the same backoff. 0s disables the backoff, so failing endpoints are reconnected to on every update.").
+		Default("0s").Duration()
+	endpointReconnectMaxDelay := cmd.Flag("endpoint.reconnect-backoff-max-delay", "Upper bound of the delay of reconnecting to an endpoint.").
+		Default("2m").Duration()
+	endpointReconnectMultiplier := cmd.Flag("endpoint.reconnect-backoff-multiplier", "Factor the reconnection delay of an endpoint is multiplied by after each consecutive failure.").
+		Default("1.6").Float64()
+	endpointReconnectJitter := cmd.Flag("endpoint.reconnect-backoff-jitter", "Factor the reconnection delay is randomized by, e.g. 0.2 randomizes it by up to 20% in either direction, so that queriers don't reconnect to an endpoint at the same time.").
+		Default("0.2").Float64()
+
+	endpointMaxConcurrentSeries := cmd.Flag("endpoint.max-concurrent-series-calls", "Maximum number of concurrent Series calls to each endpoint. Calls above the limit wait for another call to the endpoint to finish, so that a slow endpoint doesn't get an unbounded number of them. 0 disables the limit.").
+		Default("0").Int()
+	endpointSeriesFailFast := cmd.Flag("endpoint.series-concurrency-fail-fast", "Fail Series calls above --endpoint.max-concurrent-series-calls right away instead of waiting, which results in partial responses or errors depending on the partial response strategy.").
+		Default("false").Bool()
+	storeTypeMaxConcurrentSeriesFlags := cmd.Flag("endpoint.store-type-max-concurrent-series-calls", "Maximum number of concurrent Series calls to all endpoints of the given store type (repeatable), e.g. store=8 to throttle calls to store gateways independently of calls to sidecars. Calls above the limit wait for another call to an endpoint of the type to finish. Possible store types are: sidecar, receive, rule, store, query. Store types without a limit are not limited.").
+		PlaceHolder("<store type>=<limit>").Strings()
+
+	enableDebugReconnect := cmd.Flag("endpoint.enable-debug-reconnect", "Enable the /debug/stores/reconnect HTTP endpoint, closing and re-establishing the gRPC connection to the endpoint given by the 'endpoint' parameter, or to all endpoints without it, e.g. to recover connections stuck in a bad state after network issues. See https://thanos.io/tip/components/query.md/#reconnecting-to-endpoints").
+		Default("false").Bool()
+
 	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers. The path can be a glob pattern (repeatable).").
 		PlaceHolder("<path>").Strings()
 
@@ -141,6 +201,9 @@ func registerQuery(app *extkingpin.App) {
 	dnsSDInterval := extkingpin.ModelDuration(cmd.Flag("store.sd-dns-interval", "Interval between DNS resolutions.").
 		Default("30s"))
 
+	dnsSDJitter := extkingpin.ModelDuration(cmd.Flag("store.sd-dns-jitter", "Window DNS resolutions of the configured addresses are spread over, so that their endpoints are not re-resolved and reconnected to at the same instant. Each address keeps its random delay within the window. Must be smaller than --store.sd-dns-interval. 0 resolves all addresses at once.").
+		Default("0s"))
+
 	dnsSDResolver := cmd.Flag("store.sd-dns-resolver", fmt.Sprintf("Resolver to use. Possible options: [%s, %s]", dns.GolangResolverType, dns.MiekgdnsResolverType)).
 		Default(string(dns.MiekgdnsResolverType)).Hidden().String()
 
@@ -168,7 +231,7 @@ func registerQuery(app *extkingpin.App) {
 
 	defaultEvaluationInterval := extkingpin.ModelDuration(cmd.Flag("query.default-evaluation-interval", "Set default evaluation interval for sub queries.").Default("1m"))
 
-	defaultRangeQueryStep := extkingpin.ModelDuration(cmd.Flag("query.default-step", "Set default step for range queries. Default step is only used when step is not set in UI. In such cases, Thanos UI will use default step to calculate resolution (resolution = max(rangeSeconds / 250, defaultStep)). This will not work from Grafana, but Grafana has __step variable which can be used.").
+	defaultRangeQueryStep := extkingpin.ModelDuration(cmd.Flag("query.default-step", "Set default step for range queries. Default step is used when step is not set in UI or in the step parameter of the query_range API. In such cases, the step is derived from the range of the query (resolution = max(rangeSeconds / 250, defaultStep)). Grafana always sets the step, but has __step variable which can be used.").
 		Default("1s"))
 
 	storeResponseTimeout := extkingpin.ModelDuration(cmd.Flag("store.response-timeout", "If a Store doesn't send any data in this specified duration then a Store will be ignored and partial data will be returned if it's enabled. 0 disables timeout.").Default("0ms"))
@@ -182,6 +245,30 @@ func registerQuery(app *extkingpin.App) {
 			return errors.Wrap(err, "parse federation labels")
 		}
 
+		endpointCompressions, err := query.ParseEndpointCompressions(logger, reg, *endpointCompressionFlags)
+		if err != nil {
+			return errors.Wrap(err, "parse endpoint gRPC compressions")
+		}
+
+		endpointTLSContentYaml, err := endpointTLSConfig.Content()
+		if err != nil {
+			return err
+		}
+		endpointTLS, err := query.ParseEndpointTLS(logger, endpointTLSContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "parse endpoint TLS config")
+		}
+
+		storeTypeReplicaLabels, err := query.ParseStoreTypeReplicaLabels(*storeTypeReplicaLabelFlags)
+		if err != nil {
+			return errors.Wrap(err, "parse store type replica labels")
+		}
+
+		storeTypeMaxConcurrentSeries, err := query.ParseStoreTypeConcurrency(*storeTypeMaxConcurrentSeriesFlags)
+		if err != nil {
+			return errors.Wrap(err, "parse store type max concurrent Series calls")
+		}
+
 		var enableQueryPushdown bool
 		for _, feature := range *featureList {
 			if feature == queryPushdown {
@@ -250,8 +337,14 @@ func registerQuery(app *extkingpin.App) {
 			*webPrefixHeaderName,
 			*maxConcurrentQueries,
 			*maxConcurrentSelects,
+			*maxConcurrentStoreSelects,
+			*storeHedgingDelay,
 			time.Duration(*defaultRangeQueryStep),
 			time.Duration(*queryTimeout),
+			time.Duration(*storeDeadlineHeadroom),
+			*maxLabelValueCardinality,
+			*maxMatchersPerSelector,
+			*dedupAlgorithm,
 			*lookbackDelta,
 			*dynamicLookbackDelta,
 			time.Duration(*defaultEvaluationInterval),
@@ -273,12 +366,29 @@ func registerQuery(app *extkingpin.App) {
 			*enableExemplarPartialResponse,
 			fileSD,
 			time.Duration(*dnsSDInterval),
+			time.Duration(*dnsSDJitter),
 			*dnsSDResolver,
 			time.Duration(*unhealthyStoreTimeout),
 			time.Duration(*instantDefaultMaxSourceResolution),
 			*defaultMetadataTimeRange,
+			int64(*maxResponseBytes),
+			*maxMultiInstantTimes,
+			*tenantHeader,
 			*strictStores,
 			*strictEndpoints,
+			endpointCompressions,
+			endpointTLS,
+			backoff.Config{
+				BaseDelay:  *endpointReconnectBaseDelay,
+				Multiplier: *endpointReconnectMultiplier,
+				Jitter:     *endpointReconnectJitter,
+				MaxDelay:   *endpointReconnectMaxDelay,
+			},
+			*endpointMaxConcurrentSeries,
+			*endpointSeriesFailFast,
+			storeTypeMaxConcurrentSeries,
+			*enableDebugReconnect,
+			storeTypeReplicaLabels,
 			*webDisableCORS,
 			enableQueryPushdown,
 			*alertQueryURL,
@@ -317,8 +427,14 @@ func runQuery(
 	webPrefixHeaderName string,
 	maxConcurrentQueries int,
 	maxConcurrentSelects int,
+	maxConcurrentStoreSelects int,
+	storeHedgingDelay time.Duration,
 	defaultRangeQueryStep time.Duration,
 	queryTimeout time.Duration,
+	storeDeadlineHeadroom time.Duration,
+	maxLabelValueCardinality int,
+	maxMatchersPerSelector int,
+	dedupAlgorithm string,
 	lookbackDelta time.Duration,
 	dynamicLookbackDelta bool,
 	defaultEvaluationInterval time.Duration,
@@ -340,12 +456,24 @@ func runQuery(
 	enableExemplarPartialResponse bool,
 	fileSD *file.Discovery,
 	dnsSDInterval time.Duration,
+	dnsSDJitter time.Duration,
 	dnsSDResolver string,
 	unhealthyStoreTimeout time.Duration,
 	instantDefaultMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
+	maxResponseBytes int64,
+	maxMultiInstantTimes int,
+	tenantHeader string,
 	strictStores []string,
 	strictEndpoints []string,
+	endpointCompressions *query.EndpointCompressions,
+	endpointTLS query.EndpointTLS,
+	endpointReconnectBackoff backoff.Config,
+	endpointMaxConcurrentSeries int,
+	endpointSeriesFailFast bool,
+	storeTypeMaxConcurrentSeries query.StoreTypeConcurrency,
+	enableDebugReconnect bool,
+	storeTypeReplicaLabels query.StoreTypeReplicaLabels,
 	disableCORS bool,
 	enableQueryPushdown bool,
 	alertQueryURL string,
@@ -364,16 +492,61 @@ func runQuery(
 		Help: "The number of times a duplicated store addresses is detected from the different configs in query",
 	})
 
-	dialOpts, err := extgrpc.StoreClientGRPCOpts(logger, reg, tracer, secure, skipVerify, cert, key, caCert, serverName)
+	// The transport security is set per endpoint, as gRPC rejects overriding insecure connections with TLS.
+	dialOpts := extgrpc.StoreClientBaseGRPCOpts(reg, tracer)
+	defaultTLSOpt, err := extgrpc.StoreClientTLSOpt(logger, secure, skipVerify, cert, key, caCert, serverName)
 	if err != nil {
 		return errors.Wrap(err, "building gRPC client")
 	}
+	endpointDialOpts := func(addr string) []grpc.DialOption {
+		tlsOpt, ok := endpointTLS.DialOption(addr)
+		if !ok {
+			tlsOpt = defaultTLSOpt
+		}
+		return append(endpointCompressions.DialOptions(addr), tlsOpt)
+	}
+
+	if maxMultiInstantTimes < 1 {
+		return errors.Errorf("maximum number of multi instant query evaluation times %d must be positive", maxMultiInstantTimes)
+	}
+
+	if storeDeadlineHeadroom < 0 || storeDeadlineHeadroom >= queryTimeout {
+		return errors.Errorf("store deadline headroom %v must be non-negative and smaller than the query timeout %v", storeDeadlineHeadroom, queryTimeout)
+	}
+
+	if dnsSDJitter < 0 || dnsSDJitter >= dnsSDInterval {
+		return errors.Errorf("DNS SD jitter %v must be non-negative and smaller than the DNS SD interval %v", dnsSDJitter, dnsSDInterval)
+	}
+
+	endpointSetOpts := []query.EndpointSetOption{query.WithEndpointCompressions(endpointCompressions)}
+	if endpointReconnectBackoff.BaseDelay > 0 {
+		if endpointReconnectBackoff.MaxDelay < endpointReconnectBackoff.BaseDelay {
+			return errors.Errorf("endpoint reconnection max delay %v must not be smaller than the base delay %v", endpointReconnectBackoff.MaxDelay, endpointReconnectBackoff.BaseDelay)
+		}
+		if endpointReconnectBackoff.Multiplier < 1 {
+			return errors.Errorf("endpoint reconnection backoff multiplier %v must be at least 1", endpointReconnectBackoff.Multiplier)
+		}
+		if endpointReconnectBackoff.Jitter < 0 || endpointReconnectBackoff.Jitter > 1 {
+			return errors.Errorf("endpoint reconnection backoff jitter %v must be between 0 and 1", endpointReconnectBackoff.Jitter)
+		}
+		endpointSetOpts = append(endpointSetOpts, query.WithReconnectBackoff(endpointReconnectBackoff))
+	}
+	if endpointMaxConcurrentSeries < 0 {
+		return errors.Errorf("endpoint max concurrent Series calls %d must not be negative", endpointMaxConcurrentSeries)
+	}
+	if endpointMaxConcurrentSeries > 0 {
+		endpointSetOpts = append(endpointSetOpts, query.WithEndpointSeriesConcurrency(endpointMaxConcurrentSeries, endpointSeriesFailFast))
+	}
+	if len(storeTypeMaxConcurrentSeries) > 0 {
+		endpointSetOpts = append(endpointSetOpts, query.WithStoreTypeSeriesConcurrency(storeTypeMaxConcurrentSeries))
+	}
 
 	fileSDCache := cache.New()
 	dnsStoreProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_store_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	for _, store := range strictStores {
@@ -392,30 +565,35 @@ func runQuery(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_endpoints_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	dnsRuleProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_rule_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	dnsTargetProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_target_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	dnsMetadataProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_metadata_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	dnsExemplarProvider := dns.NewProvider(
 		logger,
 		extprom.WrapRegistererWithPrefix("thanos_query_exemplar_apis_", reg),
 		dns.ResolverType(dnsSDResolver),
+		dns.WithResolveJitter(dnsSDJitter),
 	)
 
 	var (
@@ -425,11 +603,11 @@ func runQuery(
 			func() (specs []*query.GRPCEndpointSpec) {
 				// Add strict & static nodes.
 				for _, addr := range strictStores {
-					specs = append(specs, query.NewGRPCEndpointSpec(addr, true))
+					specs = append(specs, query.NewGRPCEndpointSpec(addr, true, endpointDialOpts(addr)...))
 				}
 
 				for _, addr := range strictEndpoints {
-					specs = append(specs, query.NewGRPCEndpointSpec(addr, true))
+					specs = append(specs, query.NewGRPCEndpointSpec(addr, true, endpointDialOpts(addr)...))
 				}
 
 				for _, dnsProvider := range []*dns.Provider{
@@ -443,7 +621,7 @@ func runQuery(
 					var tmpSpecs []*query.GRPCEndpointSpec
 
 					for _, addr := range dnsProvider.Addresses() {
-						tmpSpecs = append(tmpSpecs, query.NewGRPCEndpointSpec(addr, false))
+						tmpSpecs = append(tmpSpecs, query.NewGRPCEndpointSpec(addr, false, endpointDialOpts(addr)...))
 					}
 					tmpSpecs = removeDuplicateEndpointSpecs(logger, duplicatedStores, tmpSpecs)
 					specs = append(specs, tmpSpecs...)
@@ -453,8 +631,9 @@ func runQuery(
 			},
 			dialOpts,
 			unhealthyStoreTimeout,
+			endpointSetOpts...,
 		)
-		proxy            = store.NewProxyStore(logger, reg, endpoints.GetStoreClients, component.Query, selectorLset, storeResponseTimeout)
+		proxy            = store.NewProxyStore(logger, reg, endpoints.GetStoreClients, component.Query, selectorLset, storeResponseTimeout, store.WithMaxConcurrentSelects(maxConcurrentStoreSelects), store.WithHedgingDelay(storeHedgingDelay))
 		rulesProxy       = rules.NewProxy(logger, endpoints.GetRulesClients)
 		targetsProxy     = targets.NewProxy(logger, endpoints.GetTargetsClients)
 		metadataProxy    = metadata.NewProxy(logger, endpoints.GetMetricMetadataClients)
@@ -465,6 +644,13 @@ func runQuery(
 			proxy,
 			maxConcurrentSelects,
 			queryTimeout,
+			query.QueryableOptions{
+				StoreDeadlineHeadroom:    storeDeadlineHeadroom,
+				StoreTypeReplicaLabels:   storeTypeReplicaLabels,
+				MaxLabelValueCardinality: maxLabelValueCardinality,
+				MaxMatchersPerSelector:   maxMatchersPerSelector,
+				DedupAlgorithm:           dedupAlgorithm,
+			},
 		)
 		engineOpts = promql.EngineOpts{
 			Logger: logger,
@@ -541,25 +727,26 @@ func runQuery(
 			return runutil.Repeat(dnsSDInterval, ctx.Done(), func() error {
 				resolveCtx, resolveCancel := context.WithTimeout(ctx, dnsSDInterval)
 				defer resolveCancel()
-				if err := dnsStoreProvider.Resolve(resolveCtx, append(fileSDCache.Addresses(), storeAddrs...)); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses for storeAPIs", "err", err)
-				}
-				if err := dnsRuleProvider.Resolve(resolveCtx, ruleAddrs); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses for rulesAPIs", "err", err)
-				}
-				if err := dnsTargetProvider.Resolve(ctx, targetAddrs); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses for targetsAPIs", "err", err)
-				}
-				if err := dnsMetadataProvider.Resolve(resolveCtx, metadataAddrs); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses for metadataAPIs", "err", err)
-				}
-				if err := dnsExemplarProvider.Resolve(resolveCtx, exemplarAddrs); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses for exemplarsAPI", "err", err)
-				}
-				if err := dnsEndpointProvider.Resolve(resolveCtx, endpointAddrs); err != nil {
-					level.Error(logger).Log("msg", "failed to resolve addresses passed using endpoint flag", "err", err)
 
+				// Providers resolve concurrently, so that resolutions spread by the jitter don't delay each other.
+				var wg sync.WaitGroup
+				resolve := func(p *dns.Provider, addrs []string, msg string) {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if err := p.Resolve(resolveCtx, addrs); err != nil {
+							level.Error(logger).Log("msg", msg, "err", err)
+						}
+					}()
 				}
+				resolve(dnsStoreProvider, append(fileSDCache.Addresses(), storeAddrs...), "failed to resolve addresses for storeAPIs")
+				resolve(dnsRuleProvider, ruleAddrs, "failed to resolve addresses for rulesAPIs")
+				resolve(dnsTargetProvider, targetAddrs, "failed to resolve addresses for targetsAPIs")
+				resolve(dnsMetadataProvider, metadataAddrs, "failed to resolve addresses for metadataAPIs")
+				resolve(dnsExemplarProvider, exemplarAddrs, "failed to resolve addresses for exemplarsAPI")
+				resolve(dnsEndpointProvider, endpointAddrs, "failed to resolve addresses passed using endpoint flag")
+				wg.Wait()
+
 				return nil
 			})
 		}, func(error) {
@@ -601,6 +788,10 @@ func runQuery(
 		// TODO(bplotka in PR #513 review): pass all flags, not only the flags needed by prefix rewriting.
 		ui.NewQueryUI(logger, endpoints, webExternalPrefix, webPrefixHeaderName, alertQueryURL).Register(router, ins)
 
+		if enableDebugReconnect {
+			router.Post("/debug/stores/reconnect", ins.NewHandler("debug_stores_reconnect", query.NewReconnectHandler(logger, endpoints)))
+		}
+
 		api := apiv1.NewQueryAPI(
 			logger,
 			endpoints.GetEndpointStatus,
@@ -623,6 +814,9 @@ func runQuery(
 			defaultRangeQueryStep,
 			instantDefaultMaxSourceResolution,
 			defaultMetadataTimeRange,
+			maxResponseBytes,
+			maxMultiInstantTimes,
+			tenantHeader,
 			disableCORS,
 			gate.New(
 				extprom.WrapRegistererWithPrefix("thanos_query_concurrent_", reg),
@@ -653,7 +847,7 @@ func runQuery(
 	}
 	// Start query (proxy) gRPC StoreAPI.
 	{
-		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), grpcCert, grpcKey, grpcClientCA)
+		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), extprom.WrapRegistererWithPrefix("thanos_grpc_", reg), grpcCert, grpcKey, grpcClientCA)
 		if err != nil {
 			return errors.Wrap(err, "setup gRPC server")
 		}
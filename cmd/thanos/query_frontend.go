@@ -59,6 +59,9 @@ func registerQueryFrontend(app *extkingpin.App) {
 			LabelsConfig: queryfrontend.LabelsConfig{
 				Limits: &cortexvalidation.Limits{},
 			},
+			ExemplarsConfig: queryfrontend.ExemplarsConfig{
+				Limits: &cortexvalidation.Limits{},
+			},
 		},
 	}
 
@@ -94,6 +97,8 @@ func registerQueryFrontend(app *extkingpin.App) {
 
 	cfg.QueryRangeConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "query-range.response-cache-config", "YAML file that contains response cache configuration.", extflag.WithEnvSubstitution())
 
+	cfg.QueryRangeConfig.TenantLimitsPathOrContent = *extflag.RegisterPathOrContent(cmd, "query-range.tenant-limits-config", "YAML file that contains per-tenant overrides of query range limits, e.g. the split interval. Tenants are identified by the org ID of the request.", extflag.WithEnvSubstitution())
+
 	// Labels tripperware flags.
 	cmd.Flag("labels.split-interval", "Split labels requests by an interval and execute in parallel, it should be greater than 0 when labels.response-cache-config is configured.").
 		Default("24h").DurationVar(&cfg.LabelsConfig.SplitQueriesByInterval)
@@ -107,14 +112,35 @@ func registerQueryFrontend(app *extkingpin.App) {
 	cmd.Flag("labels.response-cache-max-freshness", "Most recent allowed cacheable result for labels requests, to prevent caching very recent results that might still be in flux.").
 		Default("1m").DurationVar((*time.Duration)(&cfg.LabelsConfig.Limits.MaxCacheFreshness))
 
+	cmd.Flag("labels.response-cache-alignment", "Labels and series responses are only served from the cache for requests whose range, aligned outwards to this duration, is the same, as the labels of a response can't be narrowed down to a part of its range. Should be the duration of the smallest blocks. 0 reuses cached responses for any range within the split interval.").
+		Default("2h").DurationVar(&cfg.LabelsConfig.CacheAlignment)
+
 	cmd.Flag("labels.partial-response", "Enable partial response for labels requests if no partial_response param is specified. --no-labels.partial-response for disabling.").
 		Default("true").BoolVar(&cfg.LabelsConfig.PartialResponseStrategy)
 
 	cmd.Flag("labels.default-time-range", "The default metadata time range duration for retrieving labels through Labels and Series API when the range parameters are not specified.").
-		Default("24h").DurationVar(&cfg.DefaultTimeRange)
+		Default("24h").DurationVar(&cfg.LabelsConfig.DefaultTimeRange)
 
 	cfg.LabelsConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "labels.response-cache-config", "YAML file that contains response cache configuration.", extflag.WithEnvSubstitution())
 
+	// Exemplars tripperware flags.
+	cmd.Flag("exemplars.split-interval", "Split exemplars requests by an interval and execute in parallel, it should be greater than 0 when exemplars.response-cache-config is configured.").
+		Default("24h").DurationVar(&cfg.ExemplarsConfig.SplitQueriesByInterval)
+
+	cmd.Flag("exemplars.max-retries-per-request", "Maximum number of retries for a single exemplars request; beyond this, the downstream error is returned.").
+		Default("5").IntVar(&cfg.ExemplarsConfig.MaxRetries)
+
+	cmd.Flag("exemplars.max-query-parallelism", "Maximum number of exemplars requests will be scheduled in parallel by the Frontend.").
+		Default("14").IntVar(&cfg.ExemplarsConfig.Limits.MaxQueryParallelism)
+
+	cmd.Flag("exemplars.response-cache-max-freshness", "Most recent allowed cacheable result for exemplars requests, to prevent caching very recent results that might still be in flux.").
+		Default("1m").DurationVar((*time.Duration)(&cfg.ExemplarsConfig.Limits.MaxCacheFreshness))
+
+	cmd.Flag("exemplars.default-time-range", "The default time range duration for retrieving exemplars when the range parameters are not specified.").
+		Default("24h").DurationVar(&cfg.ExemplarsConfig.DefaultTimeRange)
+
+	cfg.ExemplarsConfig.CachePathOrContent = *extflag.RegisterPathOrContent(cmd, "exemplars.response-cache-config", "YAML file that contains response cache configuration. Exemplars responses are only cached if this is set.", extflag.WithEnvSubstitution())
+
 	cmd.Flag("cache-compression-type", "Use compression in results cache. Supported values are: 'snappy' and '' (disable compression).").
 		Default("").StringVar(&cfg.CacheCompression)
 
@@ -220,6 +246,17 @@ func runQueryFrontend(
 		}
 	}
 
+	tenantLimitsConfContentYaml, err := cfg.QueryRangeConfig.TenantLimitsPathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(tenantLimitsConfContentYaml) > 0 {
+		cfg.QueryRangeConfig.TenantLimits, err = queryfrontend.ParseTenantLimitsConfig(tenantLimitsConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the query range tenant limits config")
+		}
+	}
+
 	labelsCacheConfContentYaml, err := cfg.LabelsConfig.CachePathOrContent.Content()
 	if err != nil {
 		return err
@@ -235,6 +272,21 @@ func runQueryFrontend(
 		}
 	}
 
+	exemplarsCacheConfContentYaml, err := cfg.ExemplarsConfig.CachePathOrContent.Content()
+	if err != nil {
+		return err
+	}
+	if len(exemplarsCacheConfContentYaml) > 0 {
+		cacheConfig, err := queryfrontend.NewCacheConfig(logger, exemplarsCacheConfContentYaml)
+		if err != nil {
+			return errors.Wrap(err, "initializing the exemplars cache config")
+		}
+		cfg.ExemplarsConfig.ResultsCacheConfig = &queryrange.ResultsCacheConfig{
+			Compression: cfg.CacheCompression,
+			CacheConfig: *cacheConfig,
+		}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return errors.Wrap(err, "error validating the config")
 	}
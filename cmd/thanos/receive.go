@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/alecthomas/units"
 	extflag "github.com/efficientgo/tools/extkingpin"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -66,15 +67,27 @@ func registerReceive(app *extkingpin.App) {
 		if len(lset) == 0 {
 			return errors.New("no external labels configured for receive, uniquely identifying external labels must be configured (ideally with `receive_` prefix); see https://thanos.io/tip/thanos/storage.md#external-labels for details.")
 		}
+		if conf.shipperConcurrency < 0 {
+			return errors.Errorf("shipper tenant concurrency cannot be negative (got %d)", conf.shipperConcurrency)
+		}
 
 		tagOpts, grpcLogOpts, err := logging.ParsegRPCOptions("", conf.reqLogConfig)
 		if err != nil {
 			return errors.Wrap(err, "error while parsing config for request logging")
 		}
 
+		localCompaction := *conf.localCompactionMaxBlockDuration > 0
+		if localCompaction && time.Duration(*conf.localCompactionMaxBlockDuration) < 3*time.Duration(*conf.tsdbMinBlockDuration) {
+			return errors.Errorf("local compaction max block duration must be at least three times the min block duration %v, got %v", *conf.tsdbMinBlockDuration, *conf.localCompactionMaxBlockDuration)
+		}
+		maxBlockDuration := *conf.tsdbMaxBlockDuration
+		if localCompaction {
+			maxBlockDuration = *conf.localCompactionMaxBlockDuration
+		}
+
 		tsdbOpts := &tsdb.Options{
 			MinBlockDuration:       int64(time.Duration(*conf.tsdbMinBlockDuration) / time.Millisecond),
-			MaxBlockDuration:       int64(time.Duration(*conf.tsdbMaxBlockDuration) / time.Millisecond),
+			MaxBlockDuration:       int64(time.Duration(maxBlockDuration) / time.Millisecond),
 			RetentionDuration:      int64(time.Duration(*conf.retention) / time.Millisecond),
 			NoLockfile:             conf.noLockFile,
 			WALCompression:         conf.walCompression,
@@ -120,7 +133,7 @@ func runReceive(
 
 	level.Info(logger).Log("mode", receiveMode, "msg", "running receive")
 
-	rwTLSConfig, err := tls.NewServerConfig(log.With(logger, "protocol", "HTTP"), conf.rwServerCert, conf.rwServerKey, conf.rwServerClientCA)
+	rwTLSConfig, err := tls.NewServerConfig(log.With(logger, "protocol", "HTTP"), extprom.WrapRegistererWithPrefix("thanos_http_", reg), conf.rwServerCert, conf.rwServerKey, conf.rwServerClientCA)
 	if err != nil {
 		return err
 	}
@@ -140,6 +153,16 @@ func runReceive(
 		return err
 	}
 
+	// Truncated series keep their metric name and get the hash of the dropped labels.
+	if conf.labelsLimitAction == string(receive.LabelsLimitDropExtra) && conf.maxLabelsPerSeries > 0 && conf.maxLabelsPerSeries < 2 {
+		return errors.Errorf("receive.max-labels-per-series must be at least 2 with the %s labels limit action, got %d", receive.LabelsLimitDropExtra, conf.maxLabelsPerSeries)
+	}
+
+	// Tenants of client certificates must not be overridden by the series, to keep hard tenancy.
+	if conf.splitTenantLabel != "" && conf.tenantField != "" {
+		return errors.New("receive.split-tenant-label-name can't be used together with receive.tenant-certificate-field")
+	}
+
 	var bkt objstore.Bucket
 	confContentYaml, err := conf.objStoreConfig.Content()
 	if err != nil {
@@ -152,7 +175,8 @@ func runReceive(
 	upload := len(confContentYaml) > 0
 	if enableIngestion {
 		if upload {
-			if tsdbOpts.MinBlockDuration != tsdbOpts.MaxBlockDuration {
+			// Blocks are shipped only once compacted with local compaction, so none can be missing from the bucket.
+			if tsdbOpts.MinBlockDuration != tsdbOpts.MaxBlockDuration && *conf.localCompactionMaxBlockDuration == 0 {
 				if !conf.ignoreBlockSize {
 					return errors.Errorf("found that TSDB Max time is %d and Min time is %d. "+
 						"Compaction needs to be disabled (tsdb.min-block-duration = tsdb.max-block-duration)", tsdbOpts.MaxBlockDuration, tsdbOpts.MinBlockDuration)
@@ -185,6 +209,36 @@ func runReceive(
 		return errors.Wrap(err, "parse relabel configuration")
 	}
 
+	tenantOverrides := receive.NewTenantOverrides(reg)
+	tenantsContentYaml, err := conf.tenantsConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of tenants configuration")
+	}
+	if err := tenantOverrides.Load(tenantsContentYaml); err != nil {
+		return errors.Wrap(err, "parse tenants configuration")
+	}
+
+	var shadowHashring receive.Hashring
+	shadowHashringsContent, err := conf.shadowHashrings.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of shadow hashrings configuration")
+	}
+	if len(shadowHashringsContent) > 0 {
+		shadowHashring, err = receive.HashringFromConfig(receive.HashringAlgorithm(conf.hashringsAlgorithm), string(shadowHashringsContent))
+		if err != nil {
+			return errors.Wrap(err, "parse shadow hashrings configuration")
+		}
+	}
+
+	tenantPathMapping, err := receive.ParseTenantPathMapping(conf.tsdbTenantPaths)
+	if err != nil {
+		return errors.Wrap(err, "parse tenant paths")
+	}
+	tenantPaths, err := receive.NewTenantPaths(append([]string{conf.dataDir}, conf.tsdbAdditionalPaths...), tenantPathMapping)
+	if err != nil {
+		return errors.Wrap(err, "configure tenant paths")
+	}
+
 	dbs := receive.NewMultiTSDB(
 		conf.dataDir,
 		logger,
@@ -195,8 +249,25 @@ func runReceive(
 		bkt,
 		conf.allowOutOfOrderUpload,
 		hashFunc,
+		receive.WithStaggeredHeadCompaction(conf.tsdbStaggerHeadCompaction),
+		receive.WithTenantOverrides(tenantOverrides),
+		receive.WithTenantPaths(tenantPaths),
+		receive.WithShipConcurrency(conf.shipperConcurrency),
+		receive.WithLocalCompaction(*conf.localCompactionMaxBlockDuration > 0),
+		receive.WithOutOfOrdernessMaxTenants(conf.outOfOrdernessMaxTenants),
+		receive.WithUploadOptions(conf.shipperMultipartUpload.uploadOptions()...),
 	)
-	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs)
+	writer := receive.NewWriter(log.With(logger, "component", "receive-writer"), dbs, tenantOverrides)
+
+	var diskPressure *receive.DiskPressureMonitor
+	if enableIngestion && conf.diskPressureHighWatermark > 0 {
+		probe := receive.NewDiskUsageProbe(append([]string{conf.dataDir}, conf.tsdbAdditionalPaths...)...)
+		diskPressure, err = receive.NewDiskPressureMonitor(logger, reg, probe, conf.diskPressureLowWatermark, conf.diskPressureHighWatermark)
+		if err != nil {
+			return errors.Wrap(err, "create disk pressure monitor")
+		}
+	}
+
 	webHandler := receive.NewHandler(log.With(logger, "component", "receive-handler"), &receive.Options{
 		Writer:            writer,
 		ListenAddress:     conf.rwAddress,
@@ -213,7 +284,26 @@ func runReceive(
 		TLSConfig:         rwTLSConfig,
 		DialOpts:          dialOpts,
 		ForwardTimeout:    time.Duration(*conf.forwardTimeout),
+		ReadTimeout:       time.Duration(*conf.rwServerReadTimeout),
+		WriteTimeout:      time.Duration(*conf.rwServerWriteTimeout),
+		IdleTimeout:       time.Duration(*conf.rwServerIdleTimeout),
+		MaxHeaderBytes:    int(conf.rwServerMaxHeader),
+		MaxBodyBytes:      int64(conf.rwServerMaxBody),
 		TSDBStats:         dbs,
+		TenantOverrides:   tenantOverrides,
+
+		MaxOutstandingSamples:         conf.maxOutstandingSamples,
+		OutstandingSamplesLimitAction: receive.OutstandingSamplesLimitAction(conf.outstandingSamplesLimitAction),
+		MaxLabelsPerSeries:            conf.maxLabelsPerSeries,
+		LabelsLimitAction:             receive.LabelsLimitAction(conf.labelsLimitAction),
+		PartialSuccessDetails:         conf.partialSuccessDetails,
+		ShadowHashring:                shadowHashring,
+		ShadowMaxInflightRequests:     conf.shadowMaxInflightRequests,
+		DiskPressure:                  diskPressure,
+		EnableAdminAPI:                conf.enableAdminAPI,
+		SplitTenantLabelName:          conf.splitTenantLabel,
+		OTLPPromoteResourceAttributes: conf.otlpPromoteResourceAttributes,
+		SplitRequestBytes:             int(conf.splitRequestBytes),
 	})
 
 	grpcProbe := prober.NewGRPC()
@@ -241,7 +331,7 @@ func runReceive(
 
 		level.Debug(logger).Log("msg", "setting up tsdb")
 		{
-			if err := startTSDBAndUpload(g, logger, reg, dbs, reloadGRPCServer, uploadC, hashringChangedChan, upload, uploadDone, statusProber, bkt); err != nil {
+			if err := startTSDBAndUpload(g, logger, reg, dbs, reloadGRPCServer, uploadC, hashringChangedChan, upload, uploadDone, statusProber, httpProbe, bkt, conf.removeOrphanedBlocks, conf.walReplayAcceptsWrites); err != nil {
 				return err
 			}
 		}
@@ -276,7 +366,7 @@ func runReceive(
 	level.Debug(logger).Log("msg", "setting up grpc server")
 	{
 		if err := setupAndRunGRPCServer(g, logger, reg, tracer, conf, reloadGRPCServer, comp, dbs, webHandler, grpcLogOpts,
-			tagOpts, grpcProbe, httpProbe.IsReady); err != nil {
+			tagOpts, grpcProbe, func() bool { return httpProbe.IsReady() && dbs.WALReplayed() }); err != nil {
 			return err
 		}
 	}
@@ -293,6 +383,73 @@ func runReceive(
 		)
 	}
 
+	level.Debug(logger).Log("msg", "setting up periodic tenants configuration reload")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Duration(*conf.tenantsConfigReloadInterval), ctx.Done(), func() error {
+				content, err := conf.tenantsConfig.Content()
+				if err == nil {
+					err = tenantOverrides.Load(content)
+				}
+				if err != nil {
+					level.Error(logger).Log("msg", "failed to reload tenants configuration", "err", err)
+				}
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if conf.tsdbStaggerHeadCompaction {
+		level.Debug(logger).Log("msg", "setting up staggered head compaction")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+				if err := dbs.CompactHeads(time.Now()); err != nil {
+					level.Error(logger).Log("msg", "failed to compact heads", "err", err)
+				}
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if *conf.peerDNSRefreshInterval > 0 {
+		level.Debug(logger).Log("msg", "setting up periodic DNS refresh of hashring endpoints")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return webHandler.RefreshPeerDNS(ctx, time.Duration(*conf.peerDNSRefreshInterval))
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	if diskPressure != nil {
+		level.Debug(logger).Log("msg", "setting up disk pressure monitoring")
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return diskPressure.Run(ctx, time.Duration(*conf.diskPressureCheckInterval))
+		}, func(err error) {
+			cancel()
+		})
+	}
+
+	level.Debug(logger).Log("msg", "setting up series churn detection")
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(time.Minute, ctx.Done(), func() error {
+				dbs.CheckSeriesChurn(time.Now())
+				return nil
+			})
+		}, func(err error) {
+			cancel()
+		})
+	}
+
 	level.Debug(logger).Log("msg", "setting up periodic tenant pruning")
 	{
 		ctx, cancel := context.WithCancel(context.Background())
@@ -336,7 +493,7 @@ func setupAndRunGRPCServer(g *run.Group,
 	g.Add(func() error {
 		defer close(startGRPCListening)
 
-		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), *conf.grpcCert, *conf.grpcKey, *conf.grpcClientCA)
+		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), extprom.WrapRegistererWithPrefix("thanos_grpc_", reg), *conf.grpcCert, *conf.grpcKey, *conf.grpcClientCA)
 		if err != nil {
 			return errors.Wrap(err, "setup gRPC server")
 		}
@@ -364,8 +521,9 @@ func setupAndRunGRPCServer(g *run.Group,
 					if isReady() {
 						minTime, maxTime := mts.TimeRange()
 						return &infopb.StoreInfo{
-							MinTime: minTime,
-							MaxTime: maxTime,
+							MinTime:                   minTime,
+							MaxTime:                   maxTime,
+							SupportsLabelValuesStream: true,
 						}
 					}
 					return nil
@@ -527,8 +685,10 @@ func startTSDBAndUpload(g *run.Group,
 	upload bool,
 	uploadDone chan struct{},
 	statusProber prober.Probe,
+	httpProbe *prober.HTTPProbe,
 	bkt objstore.Bucket,
-
+	removeOrphanedBlocks bool,
+	walReplayAcceptsWrites bool,
 ) error {
 
 	log.With(logger, "component", "storage")
@@ -546,6 +706,13 @@ func startTSDBAndUpload(g *run.Group,
 		return errors.Wrap(err, "remove storage lock files")
 	}
 
+	if removeOrphanedBlocks {
+		level.Debug(logger).Log("msg", "removing orphaned block directories if any")
+		if err := dbs.RemoveOrphanedDirsIfAny(); err != nil {
+			return errors.Wrap(err, "remove orphaned block directories")
+		}
+	}
+
 	// TSDBs reload logic, listening on hashring changes.
 	cancel := make(chan struct{})
 	g.Add(func() error {
@@ -580,13 +747,34 @@ func startTSDBAndUpload(g *run.Group,
 				if err := dbs.Flush(); err != nil {
 					return errors.Wrap(err, "flushing storage")
 				}
-				if err := dbs.Open(); err != nil {
+				if walReplayAcceptsWrites {
+					if err := dbs.OpenAsync(); err != nil {
+						return errors.Wrap(err, "opening storage")
+					}
+				} else if err := dbs.Open(); err != nil {
 					return errors.Wrap(err, "opening storage")
 				}
 				if upload {
 					uploadC <- struct{}{}
 					<-uploadDone
 				}
+				if !dbs.WALReplayed() {
+					// Only the HTTP probe is ready, so that writes are accepted while queries aren't.
+					httpProbe.Ready()
+					reloadGRPCServer <- struct{}{}
+					level.Info(logger).Log("msg", "storage is replaying its WAL, server is ready to receive web requests but not queries")
+					for !dbs.WALReplayed() {
+						select {
+						case <-cancel:
+							return nil
+						case <-time.After(time.Second):
+						}
+					}
+					statusProber.Ready()
+					level.Info(logger).Log("msg", "storage started, and server is ready to receive queries")
+					dbUpdatesCompleted.Inc()
+					continue
+				}
 				statusProber.Ready()
 				level.Info(logger).Log("msg", "storage started, and server is ready to receive web requests")
 				dbUpdatesCompleted.Inc()
@@ -719,14 +907,19 @@ type receiveConfig struct {
 	grpcClientCA    *string
 	grpcMaxConnAge  *time.Duration
 
-	rwAddress          string
-	rwServerCert       string
-	rwServerKey        string
-	rwServerClientCA   string
-	rwClientCert       string
-	rwClientKey        string
-	rwClientServerCA   string
-	rwClientServerName string
+	rwAddress            string
+	rwServerCert         string
+	rwServerKey          string
+	rwServerClientCA     string
+	rwServerReadTimeout  *model.Duration
+	rwServerWriteTimeout *model.Duration
+	rwServerIdleTimeout  *model.Duration
+	rwServerMaxHeader    units.Base2Bytes
+	rwServerMaxBody      units.Base2Bytes
+	rwClientCert         string
+	rwClientKey          string
+	rwClientServerCA     string
+	rwClientServerName   string
 
 	dataDir   string
 	labelStrs []string
@@ -743,26 +936,61 @@ type receiveConfig struct {
 	tenantHeader      string
 	tenantField       string
 	tenantLabelName   string
+	splitTenantLabel  string
 	defaultTenantID   string
 	replicaHeader     string
 	replicationFactor uint64
 	forwardTimeout    *model.Duration
 
+	peerDNSRefreshInterval *model.Duration
+
+	maxOutstandingSamples         int64
+	outstandingSamplesLimitAction string
+	maxLabelsPerSeries            int
+	labelsLimitAction             string
+	partialSuccessDetails         bool
+
+	shadowHashrings           *extflag.PathOrContent
+	shadowMaxInflightRequests int
+
+	splitRequestBytes units.Base2Bytes
+
+	diskPressureLowWatermark  float64
+	diskPressureHighWatermark float64
+	diskPressureCheckInterval *model.Duration
+
+	enableAdminAPI bool
+
 	tsdbMinBlockDuration       *model.Duration
 	tsdbMaxBlockDuration       *model.Duration
 	tsdbAllowOverlappingBlocks bool
+	tsdbStaggerHeadCompaction  bool
 	tsdbMaxExemplars           int64
+	tsdbAdditionalPaths        []string
+	tsdbTenantPaths            []string
 
-	walCompression bool
-	noLockFile     bool
+	walCompression         bool
+	noLockFile             bool
+	removeOrphanedBlocks   bool
+	walReplayAcceptsWrites bool
 
 	hashFunc string
 
-	ignoreBlockSize       bool
-	allowOutOfOrderUpload bool
+	ignoreBlockSize        bool
+	allowOutOfOrderUpload  bool
+	shipperConcurrency     int
+	shipperMultipartUpload multipartUploadConfig
+
+	localCompactionMaxBlockDuration *model.Duration
 
 	reqLogConfig      *extflag.PathOrContent
 	relabelConfigPath *extflag.PathOrContent
+
+	tenantsConfig               *extflag.PathOrContent
+	tenantsConfigReloadInterval *model.Duration
+	outOfOrdernessMaxTenants    int
+
+	otlpPromoteResourceAttributes []string
 }
 
 func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -778,6 +1006,16 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("remote-write.server-tls-client-ca", "TLS CA to verify clients against. If no client CA is specified, there is no client verification on server side. (tls.NoClientCert)").Default("").StringVar(&rc.rwServerClientCA)
 
+	rc.rwServerReadTimeout = extkingpin.ModelDuration(cmd.Flag("remote-write.server-read-timeout", "Maximum duration for reading an entire remote write request, including the body. 0s disables the timeout.").Default("0s"))
+
+	rc.rwServerWriteTimeout = extkingpin.ModelDuration(cmd.Flag("remote-write.server-write-timeout", "Maximum duration before timing out writes of the response to a remote write request. It covers handling of the request, including forwarding to other receivers. 0s disables the timeout.").Default("0s"))
+
+	rc.rwServerIdleTimeout = extkingpin.ModelDuration(cmd.Flag("remote-write.server-idle-timeout", "Maximum duration to wait for the next request on a keep-alive connection of the remote write server. 0s falls back to the read timeout.").Default("0s"))
+
+	cmd.Flag("remote-write.server-max-header-bytes", "Maximum size of the headers of a remote write request. Requests with larger headers are rejected with 431 Request Header Fields Too Large.").Default("1MiB").BytesVar(&rc.rwServerMaxHeader)
+
+	cmd.Flag("remote-write.server-max-body-bytes", "Maximum size of the compressed body of a remote write request. Requests with larger bodies are rejected with 413 Request Entity Too Large without reading the rest of the body. 0 means no limit.").Default("0").BytesVar(&rc.rwServerMaxBody)
+
 	cmd.Flag("remote-write.client-tls-cert", "TLS Certificates to use to identify this client to the server.").Default("").StringVar(&rc.rwClientCert)
 
 	cmd.Flag("remote-write.client-tls-key", "TLS Key for the client's certificate.").Default("").StringVar(&rc.rwClientKey)
@@ -789,6 +1027,12 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("tsdb.path", "Data directory of TSDB.").
 		Default("./data").StringVar(&rc.dataDir)
 
+	cmd.Flag("tsdb.additional-path", "Additional base path TSDB directories of tenants are placed on, e.g. on another disk to spread I/O (repeatable). New tenants are spread across --tsdb.path and the additional paths by the hash of their ID; existing TSDB directories are kept where they are.").
+		PlaceHolder("<path>").StringsVar(&rc.tsdbAdditionalPaths)
+
+	cmd.Flag("tsdb.tenant-path", "Base path the TSDB directory of the given tenant is placed on, instead of the one picked by the hash of its ID (repeatable). The path has to be --tsdb.path or one of --tsdb.additional-path.").
+		PlaceHolder("<tenant>=<path>").StringsVar(&rc.tsdbTenantPaths)
+
 	cmd.Flag("label", "External labels to announce. This flag will be removed in the future when handling multiple tsdb instances is added.").PlaceHolder("key=\"value\"").StringsVar(&rc.labelStrs)
 
 	rc.objStoreConfig = extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
@@ -799,20 +1043,28 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	cmd.Flag("receive.hashrings", "Alternative to 'receive.hashrings-file' flag (lower priority). Content of file that contains the hashring configuration.").PlaceHolder("<content>").StringVar(&rc.hashringsFileContent)
 
-	hashringAlgorithmsHelptext := strings.Join([]string{string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama)}, ", ")
+	hashringAlgorithmsHelptext := strings.Join([]string{string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama), string(receive.AlgorithmKetamaBounded)}, ", ")
 	cmd.Flag("receive.hashrings-algorithm", "The algorithm used when distributing series in the hashrings. Must be one of "+hashringAlgorithmsHelptext).
 		Default(string(receive.AlgorithmHashmod)).
-		EnumVar(&rc.hashringsAlgorithm, string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama))
+		EnumVar(&rc.hashringsAlgorithm, string(receive.AlgorithmHashmod), string(receive.AlgorithmKetama), string(receive.AlgorithmKetamaBounded))
 
 	rc.refreshInterval = extkingpin.ModelDuration(cmd.Flag("receive.hashrings-file-refresh-interval", "Refresh interval to re-read the hashring configuration file. (used as a fallback)").
 		Default("5m"))
 
+	rc.peerDNSRefreshInterval = extkingpin.ModelDuration(cmd.Flag("receive.hashrings-endpoints-dns-refresh-interval", "Interval at which the host names of the hashring endpoints are resolved again, reconnecting to the endpoints whose IPs changed. 0s disables the refresh, connections then keep the IPs they were established with.").
+		Default("0s"))
+
 	cmd.Flag("receive.local-endpoint", "Endpoint of local receive node. Used to identify the local node in the hashring configuration. If it's empty AND hashring configuration was provided, it means that receive will run in RoutingOnly mode.").StringVar(&rc.endpoint)
 
 	cmd.Flag("receive.tenant-header", "HTTP header to determine tenant for write requests.").Default(receive.DefaultTenantHeader).StringVar(&rc.tenantHeader)
 
 	cmd.Flag("receive.tenant-certificate-field", "Use TLS client's certificate field to determine tenant for write requests. Must be one of "+receive.CertificateFieldOrganization+", "+receive.CertificateFieldOrganizationalUnit+" or "+receive.CertificateFieldCommonName+". This setting will cause the receive.tenant-header flag value to be ignored.").Default("").EnumVar(&rc.tenantField, "", receive.CertificateFieldOrganization, receive.CertificateFieldOrganizationalUnit, receive.CertificateFieldCommonName)
 
+	cmd.Flag("receive.split-tenant-label-name", "Label whose value determines the tenant of every series of write requests, instead of the tenant header. The label is removed from the series, and series without it are written to the tenant of the request. Can't be used together with receive.tenant-certificate-field.").Default("").StringVar(&rc.splitTenantLabel)
+
+	cmd.Flag("receive.otlp-promote-resource-attribute", "Resource attribute of metrics written to the OTLP endpoint kept as a label of their series, with its name sanitized. Can be repeated. Other resource attributes than service.name, service.namespace and service.instance.id, which make the job and instance labels, are dropped.").
+		PlaceHolder("<attribute>").StringsVar(&rc.otlpPromoteResourceAttributes)
+
 	cmd.Flag("receive.default-tenant-id", "Default tenant ID to use when none is provided via a header.").Default(receive.DefaultTenant).StringVar(&rc.defaultTenantID)
 
 	cmd.Flag("receive.tenant-label-name", "Label name through which the tenant will be announced.").Default(receive.DefaultTenantLabel).StringVar(&rc.tenantLabelName)
@@ -823,18 +1075,55 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	rc.forwardTimeout = extkingpin.ModelDuration(cmd.Flag("receive-forward-timeout", "Timeout for each forward request.").Default("5s").Hidden())
 
+	cmd.Flag("receive.forward.split-request-bytes", "Maximum encoded size of the remote write requests forwarded and written at once. Larger requests are split into requests of at most this size, in the order of their series, which are forwarded one after the other. Series larger than it are split by samples. 0 disables splitting.").Default("0").BytesVar(&rc.splitRequestBytes)
+
+	cmd.Flag("receive.max-outstanding-samples", "Maximum number of samples of remote write requests handled at once. Requests which would exceed it are handled according to --receive.outstanding-samples-limit-action. 0 means no limit.").Default("0").Int64Var(&rc.maxOutstandingSamples)
+
+	cmd.Flag("receive.outstanding-samples-limit-action", "Action taken on remote write requests exceeding --receive.max-outstanding-samples. 'reject' responds with 429 Too Many Requests, 'block' waits until enough outstanding samples are written.").Default(string(receive.OutstandingSamplesReject)).EnumVar(&rc.outstandingSamplesLimitAction, string(receive.OutstandingSamplesReject), string(receive.OutstandingSamplesBlock))
+
+	cmd.Flag("receive.max-labels-per-series", "Maximum number of labels, including the metric name, of series in remote write requests. Series exceeding it are handled according to --receive.labels-limit-action. 0 means no limit.").Default("0").IntVar(&rc.maxLabelsPerSeries)
+
+	cmd.Flag("receive.labels-limit-action", "Action taken on series exceeding --receive.max-labels-per-series. 'reject' rejects the whole remote write request with 400 Bad Request, 'drop-extra' keeps the metric name and the first labels in the sorted order, replacing the rest with a '"+receive.DroppedLabelsHashLabel+"' label holding their hash, so such series don't collide.").Default(string(receive.LabelsLimitReject)).EnumVar(&rc.labelsLimitAction, string(receive.LabelsLimitReject), string(receive.LabelsLimitDropExtra))
+
+	cmd.Flag("receive.partial-success-details", "Respond to remote write requests with a JSON body detailing the number of accepted series and of series dropped or rejected by the limits, by reason. Status codes don't change. See https://thanos.io/tip/components/receive.md/#partial-success-details").Default("false").BoolVar(&rc.partialSuccessDetails)
+
+	rc.shadowHashrings = extflag.RegisterPathOrContent(cmd, "receive.shadow-hashrings", "Hashring configuration remote write requests are mirrored to asynchronously once written, e.g. to validate a new hashring before cutting over to it. Mirrored requests don't affect the written ones; their failures are only counted. Series are distributed with --receive.hashrings-algorithm and replicated by --receive.replication-factor.")
+
+	cmd.Flag("receive.shadow-max-inflight-requests", "Maximum number of remote write requests being mirrored to the shadow hashring at once. Requests above it are not mirrored. 0 means no limit.").Default("100").IntVar(&rc.shadowMaxInflightRequests)
+
+	cmd.Flag("receive.disk-pressure.high-watermark", "Used fraction of the disks of the TSDB paths, from 0 to 1, at which local writes of all tenants are rejected with 503 Service Unavailable until the usage drops below --receive.disk-pressure.low-watermark. 0 disables the disk pressure monitoring. See https://thanos.io/tip/components/receive.md/#disk-pressure").Default("0").Float64Var(&rc.diskPressureHighWatermark)
+
+	cmd.Flag("receive.disk-pressure.low-watermark", "Used fraction of the disks of the TSDB paths, from 0 to 1, below which local writes are accepted again after reaching --receive.disk-pressure.high-watermark. Local writes of tenants configured with disk_pressure_optional are rejected as soon as the usage reaches it.").Default("0.85").Float64Var(&rc.diskPressureLowWatermark)
+
+	rc.diskPressureCheckInterval = extkingpin.ModelDuration(cmd.Flag("receive.disk-pressure.check-interval", "Interval at which the disk usage is checked for disk pressure.").Default("15s"))
+
+	cmd.Flag("receive.enable-admin-api", "Enable the admin API on the remote write address, to pause and resume the ingestion of tenants. Tenants are paused on this receiver only, so they have to be paused on every receiver of the hashring. See https://thanos.io/tip/components/receive.md/#pausing-tenants").Default("false").BoolVar(&rc.enableAdminAPI)
+
 	rc.relabelConfigPath = extflag.RegisterPathOrContent(cmd, "receive.relabel-config", "YAML file that contains relabeling configuration.", extflag.WithEnvSubstitution())
 
+	rc.tenantsConfig = extflag.RegisterPathOrContent(cmd, "receive.tenants-config", "YAML file that contains per-tenant configuration. See format details: https://thanos.io/tip/components/receive.md/#tenants-configuration", extflag.WithEnvSubstitution())
+
+	rc.tenantsConfigReloadInterval = extkingpin.ModelDuration(cmd.Flag("receive.tenants-config-reload-interval", "Interval to re-read the tenants configuration file.").Default("1m"))
+
+	cmd.Flag("receive.out-of-orderness.max-tenants", "Maximum number of tenants with out-of-orderness histograms of their own, for the tenants with report_out_of_orderness enabled. Samples of further tenants are reported under the __other__ tenant. 0 means no limit.").
+		Default("100").IntVar(&rc.outOfOrdernessMaxTenants)
+
 	rc.tsdbMinBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.min-block-duration", "Min duration for local TSDB blocks").Default("2h").Hidden())
 
 	rc.tsdbMaxBlockDuration = extkingpin.ModelDuration(cmd.Flag("tsdb.max-block-duration", "Max duration for local TSDB blocks").Default("2h").Hidden())
 
 	cmd.Flag("tsdb.allow-overlapping-blocks", "Allow overlapping blocks, which in turn enables vertical compaction and vertical query merge.").Default("false").BoolVar(&rc.tsdbAllowOverlappingBlocks)
 
+	cmd.Flag("tsdb.stagger-head-compaction", "Compact the head of every tenant TSDB at a deterministic, per-tenant offset within the block duration instead of as soon as possible, to spread the CPU load of head compactions over time. Heads hold up to one more block duration of data when enabled.").Default("false").BoolVar(&rc.tsdbStaggerHeadCompaction)
+
 	cmd.Flag("tsdb.wal-compression", "Compress the tsdb WAL.").Default("true").BoolVar(&rc.walCompression)
 
 	cmd.Flag("tsdb.no-lockfile", "Do not create lockfile in TSDB data directory. In any case, the lockfiles will be deleted on next startup.").Default("false").BoolVar(&rc.noLockFile)
 
+	cmd.Flag("tsdb.remove-orphaned-blocks", "Remove incomplete block directories left in the TSDB data directories of tenants by crashes on startup, before opening the TSDBs: temporary block directories and block directories without a meta.json file. Removed directories are logged.").Default("false").BoolVar(&rc.removeOrphanedBlocks)
+
+	cmd.Flag("tsdb.wal-replay.accept-writes", "Accept writes while the TSDBs of tenants replay their WAL on startup. The receiver reports ready on /-/ready right away, but the Store API reports not ready until the WAL of all tenants is replayed. Writes of tenants whose WAL isn't replayed yet are rejected as not ready. By default, the receiver reports ready only once the WAL of all tenants is replayed.").Default("false").BoolVar(&rc.walReplayAcceptsWrites)
+
 	cmd.Flag("tsdb.max-exemplars",
 		"Enables support for ingesting exemplars and sets the maximum number of exemplars that will be stored per tenant."+
 			" In case the exemplar storage becomes full (number of stored exemplars becomes equal to max-exemplars),"+
@@ -852,6 +1141,14 @@ func (rc *receiveConfig) registerFlag(cmd extkingpin.FlagClause) {
 			"about order.").
 		Default("false").Hidden().BoolVar(&rc.allowOutOfOrderUpload)
 
+	cmd.Flag("shipper.tenant-concurrency", "Maximum number of tenants whose blocks are uploaded concurrently. 0 means no limit.").
+		Default("0").IntVar(&rc.shipperConcurrency)
+
+	rc.shipperMultipartUpload.registerFlag(cmd)
+
+	rc.localCompactionMaxBlockDuration = extkingpin.ModelDuration(cmd.Flag("receive.local-compaction.max-block-duration", "Max duration of blocks the local TSDB blocks of tenants are compacted into before they are uploaded, to reduce the number of small blocks in the bucket. Blocks are merged by a factor of three, e.g. 2h blocks into 6h and 18h blocks, and held back from upload until they can't be merged anymore. Keep it below the ranges of the compactor. 0s disables local compaction.").
+		Default("0s"))
+
 	rc.reqLogConfig = extkingpin.RegisterRequestLoggingFlags(cmd)
 }
 
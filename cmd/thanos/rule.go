@@ -83,7 +83,9 @@ type ruleConfig struct {
 	alertQueryURL          *url.URL
 	alertRelabelConfigYAML []byte
 
-	rwConfig *extflag.PathOrContent
+	rwConfig        *extflag.PathOrContent
+	rwTenantHeader  string
+	rwDefaultTenant string
 
 	resendDelay    time.Duration
 	evalInterval   time.Duration
@@ -128,6 +130,10 @@ func registerRule(app *extkingpin.App) {
 		Default("1m").DurationVar(&conf.evalInterval)
 
 	conf.rwConfig = extflag.RegisterPathOrContent(cmd, "remote-write.config", "YAML config for the remote-write configurations, that specify servers where samples should be sent to (see https://prometheus.io/docs/prometheus/latest/configuration/configuration/#remote_write). This automatically enables stateless mode for ruler and no series will be stored in the ruler's TSDB. If an empty config (or file) is provided, the flag is ignored and ruler is run with its own TSDB.", extflag.WithEnvSubstitution())
+	cmd.Flag("remote-write.tenant-header", "HTTP header used to pass the tenant of rule groups to the remote-write endpoints. Only used in stateless mode.").
+		Default("THANOS-TENANT").StringVar(&conf.rwTenantHeader)
+	cmd.Flag("remote-write.default-tenant", "Tenant the results of rule groups without a tenant field are written to. If empty, no tenant header is sent for them. Only used in stateless mode.").
+		Default("").StringVar(&conf.rwDefaultTenant)
 
 	reqLogDecision := cmd.Flag("log.request.decision", "Deprecation Warning - This flag would be soon deprecated, and replaced with `request.logging-config`. Request Logging for logging the start and end of requests. By default this flag is disabled. LogFinishCall: Logs the finish call of the requests. LogStartAndFinishCall: Logs the start and finish call of the requests. NoLogCall: Disable request logging.").Default("").Enum("NoLogCall", "LogFinishCall", "LogStartAndFinishCall", "")
 
@@ -342,7 +348,8 @@ func runRule(
 		appendable storage.Appendable
 		queryable  storage.Queryable
 		tsdbDB     *tsdb.DB
-		agentDB    *agent.DB
+		// Created once storages are set up, used by the stateless mode to route the results of rule groups to their tenant.
+		ruleMgr *thanosrules.Manager
 	)
 
 	rwCfgYAML, err := conf.rwConfig.Content()
@@ -358,26 +365,37 @@ func runRule(
 			return errors.Wrapf(err, "failed to parse remote write config %v", string(rwCfgYAML))
 		}
 
-		// flushDeadline is set to 1m, but it is for metadata watcher only so not used here.
-		remoteStore := remote.NewStorage(logger, reg, func() (int64, error) {
-			return 0, nil
-		}, conf.dataDir, 1*time.Minute, nil)
-		if err := remoteStore.ApplyConfig(&config.Config{
-			GlobalConfig: config.GlobalConfig{
-				ExternalLabels: labelsTSDBToProm(conf.lset),
-			},
-			RemoteWriteConfigs: rwCfg.RemoteWriteConfigs,
-		}); err != nil {
-			return errors.Wrap(err, "applying config to remote storage")
+		newTenantStorage := func(tenant string) (storage.Storage, error) {
+			dir := conf.dataDir
+			if tenant != conf.rwDefaultTenant {
+				dir = filepath.Join(conf.dataDir, "tenants", tenant)
+			}
+			return newRemoteWriteStorage(
+				logger,
+				extprom.WrapRegistererWith(prometheus.Labels{"tenant": tenant}, reg),
+				dir,
+				conf.lset,
+				rwCfg.RemoteWriteConfigs,
+				agentOpts,
+				conf.rwTenantHeader,
+				tenant,
+			)
 		}
-
-		agentDB, err = agent.Open(logger, reg, remoteStore, conf.dataDir, agentOpts)
+		defaultStore, err := newTenantStorage(conf.rwDefaultTenant)
 		if err != nil {
-			return errors.Wrap(err, "start remote write agent db")
+			return err
 		}
-		fanoutStore := storage.NewFanout(logger, agentDB, remoteStore)
-		appendable = fanoutStore
-		queryable = fanoutStore
+		appendable = thanosrules.NewTenantAppendable(
+			conf.rwDefaultTenant,
+			func(ctx context.Context) string { return ruleMgr.GroupTenant(ctx) },
+			func(tenant string) (storage.Appendable, error) {
+				if tenant == conf.rwDefaultTenant {
+					return defaultStore, nil
+				}
+				return newTenantStorage(tenant)
+			},
+		)
+		queryable = defaultStore
 	} else {
 		tsdbDB, err = tsdb.Open(conf.dataDir, log.With(logger, "component", "tsdb"), reg, tsdbOpts, nil)
 		if err != nil {
@@ -460,8 +478,7 @@ func runRule(
 	}
 
 	var (
-		ruleMgr *thanosrules.Manager
-		alertQ  = alert.NewQueue(logger, reg, 10000, 100, labelsTSDBToProm(conf.lset), conf.alertmgr.alertExcludeLabels, alertRelabelConfigs)
+		alertQ = alert.NewQueue(logger, reg, 10000, 100, labelsTSDBToProm(conf.lset), conf.alertmgr.alertExcludeLabels, alertRelabelConfigs)
 	)
 	{
 		// Run rule evaluation and alert notifications.
@@ -523,7 +540,7 @@ func runRule(
 	}
 	// Run the alert sender.
 	{
-		sdr := alert.NewSender(logger, reg, alertmgrs)
+		sdr := alert.NewSender(logger, reg, alertmgrs, conf.alertmgr.alertDedupWindow)
 		ctx, cancel := context.WithCancel(context.Background())
 		ctx = tracing.ContextWithTracer(ctx, tracer)
 
@@ -584,7 +601,7 @@ func runRule(
 	)
 
 	// Start gRPC server.
-	tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), conf.grpc.tlsSrvCert, conf.grpc.tlsSrvKey, conf.grpc.tlsSrvClientCA)
+	tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), extprom.WrapRegistererWithPrefix("thanos_grpc_", reg), conf.grpc.tlsSrvCert, conf.grpc.tlsSrvKey, conf.grpc.tlsSrvClientCA)
 	if err != nil {
 		return errors.Wrap(err, "setup gRPC server")
 	}
@@ -703,7 +720,7 @@ func runRule(
 			}
 		}()
 
-		s := shipper.New(logger, reg, conf.dataDir, bkt, func() labels.Labels { return conf.lset }, metadata.RulerSource, false, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc))
+		s := shipper.New(logger, reg, conf.dataDir, bkt, func() labels.Labels { return conf.lset }, metadata.RulerSource, false, conf.shipper.allowOutOfOrderUpload, metadata.HashFunc(conf.shipper.hashFunc), conf.shipper.multipartUpload.uploadOptions()...)
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -762,6 +779,52 @@ func parseFlagLabels(s []string) (labels.Labels, error) {
 	return lset, nil
 }
 
+// newRemoteWriteStorage opens an agent DB in the given directory, remote writing its samples to the given endpoints
+// with the tenant header set to the given tenant, unless it's empty.
+func newRemoteWriteStorage(
+	logger log.Logger,
+	reg prometheus.Registerer,
+	dir string,
+	lset labels.Labels,
+	rwCfgs []*config.RemoteWriteConfig,
+	agentOpts *agent.Options,
+	tenantHeader string,
+	tenant string,
+) (storage.Storage, error) {
+	if tenant != "" {
+		tenantCfgs := make([]*config.RemoteWriteConfig, 0, len(rwCfgs))
+		for _, cfg := range rwCfgs {
+			c := *cfg
+			c.Headers = make(map[string]string, len(cfg.Headers)+1)
+			for k, v := range cfg.Headers {
+				c.Headers[k] = v
+			}
+			c.Headers[tenantHeader] = tenant
+			tenantCfgs = append(tenantCfgs, &c)
+		}
+		rwCfgs = tenantCfgs
+	}
+
+	// flushDeadline is set to 1m, but it is for metadata watcher only so not used here.
+	remoteStore := remote.NewStorage(logger, reg, func() (int64, error) {
+		return 0, nil
+	}, dir, 1*time.Minute, nil)
+	if err := remoteStore.ApplyConfig(&config.Config{
+		GlobalConfig: config.GlobalConfig{
+			ExternalLabels: labelsTSDBToProm(lset),
+		},
+		RemoteWriteConfigs: rwCfgs,
+	}); err != nil {
+		return nil, errors.Wrap(err, "applying config to remote storage")
+	}
+
+	agentDB, err := agent.Open(logger, reg, remoteStore, dir, agentOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "start remote write agent db")
+	}
+	return storage.NewFanout(logger, agentDB, remoteStore), nil
+}
+
 func labelsTSDBToProm(lset labels.Labels) (res labels.Labels) {
 	for _, l := range lset {
 		res = append(res, labels.Label{
@@ -18,6 +18,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 
 	commonmodel "github.com/prometheus/common/model"
 
@@ -55,9 +57,16 @@ type storeConfig struct {
 	grpcConfig                  grpcConfig
 	httpConfig                  httpConfig
 	indexCacheSizeBytes         units.Base2Bytes
+	labelsCacheTTL              time.Duration
+	labelsCacheMaxItems         int
+	seriesLabelsCacheMaxSeries  int
 	chunkPoolSize               units.Base2Bytes
 	maxSampleCount              uint64
 	maxTouchedSeriesCount       uint64
+	seriesMemoryBudget          units.Base2Bytes
+	requestSeriesLimit          uint64
+	requestSamplesLimit         uint64
+	requestLimitsConfig         extflag.PathOrContent
 	maxConcurrency              int
 	component                   component.StoreAPI
 	debugLogging                bool
@@ -66,6 +75,8 @@ type storeConfig struct {
 	blockMetaFetchConcurrency   int
 	filterConf                  *store.FilterConfig
 	selectorRelabelConf         extflag.PathOrContent
+	blockShardID                int
+	blockShardTotal             int
 	advertiseCompatibilityLabel bool
 	consistencyDelay            commonmodel.Duration
 	ignoreDeletionMarksDelay    commonmodel.Duration
@@ -75,6 +86,14 @@ type storeConfig struct {
 	reqLogConfig                *extflag.PathOrContent
 	lazyIndexReaderEnabled      bool
 	lazyIndexReaderIdleTimeout  time.Duration
+
+	indexHeaderGenerationConcurrency int
+	blockStatsTopN                   int
+	indexCacheWarmupMatchers         []string
+	skipIdenticalBlocks              bool
+	enableNoCacheRequests            bool
+	postingsStrategy                 string
+	lazyPostingsMaxSeries            int
 }
 
 func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
@@ -87,6 +106,15 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("index-cache-size", "Maximum size of items held in the in-memory index cache. Ignored if --index-cache.config or --index-cache.config-file option is specified.").
 		Default("250MB").BytesVar(&sc.indexCacheSizeBytes)
 
+	cmd.Flag("store.labels-cache.ttl", "How long the label names and label values of blocks, including empty ones, are cached in memory to serve repeated LabelNames and LabelValues calls, e.g. for autocompletion. 0s disables the cache.").
+		Default("0s").DurationVar(&sc.labelsCacheTTL)
+
+	cmd.Flag("store.labels-cache.max-items", "Maximum number of label names and label values results of blocks held in the labels cache.").
+		Default("10000").IntVar(&sc.labelsCacheMaxItems)
+
+	cmd.Flag("store.series-labels-cache.max-series", "Maximum number of decoded series label sets cached in memory per block, so repeated queries selecting the same series don't decode them again. 0 disables the cache.").
+		Default("0").IntVar(&sc.seriesLabelsCacheMaxSeries)
+
 	sc.indexCacheConfigs = *extflag.RegisterPathOrContent(cmd, "index-cache.config",
 		"YAML file that contains index cache configuration. See format details: https://thanos.io/tip/components/store.md/#index-cache",
 		extflag.WithEnvSubstitution(),
@@ -108,6 +136,22 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 		"Maximum amount of touched series returned via a single Series call. The Series call fails if this limit is exceeded. 0 means no limit.").
 		Default("0").Uint64Var(&sc.maxTouchedSeriesCount)
 
+	cmd.Flag("store.grpc.series-memory-budget",
+		"Maximum size of chunk data held in memory by a single Series call. The Series call is aborted with ResourceExhausted once it exceeds the budget, counted by thanos_bucket_store_queries_dropped_total{reason=\"memory\"}. 0 means no limit.").
+		Default("0").BytesVar(&sc.seriesMemoryBudget)
+
+	cmd.Flag("store.limits.request-series",
+		"Maximum number of series touched by a single Series request, checked as the postings of each block are expanded, before chunks are fetched. The request is aborted with ResourceExhausted once it exceeds the limit, counted by thanos_bucket_store_queries_limited_total{reason=\"series\"}. 0 means no limit.").
+		Default("0").Uint64Var(&sc.requestSeriesLimit)
+
+	cmd.Flag("store.limits.request-samples",
+		"Maximum number of samples returned by a single Series request, counted exactly as chunks are read. The request is aborted with ResourceExhausted once it exceeds the limit, counted by thanos_bucket_store_queries_limited_total{reason=\"samples\"}. 0 means no limit.").
+		Default("0").Uint64Var(&sc.requestSamplesLimit)
+
+	sc.requestLimitsConfig = *extflag.RegisterPathOrContent(cmd, "store.limits.config",
+		"YAML file that contains the per-tenant overrides of the store.limits.request-* limits. See format details: https://thanos.io/tip/components/store.md/#request-limits",
+	)
+
 	cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of concurrent Series calls.").Default("20").IntVar(&sc.maxConcurrency)
 
 	sc.component = component.Store
@@ -136,6 +180,12 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 
 	sc.selectorRelabelConf = *extkingpin.RegisterSelectorRelabelFlags(cmd)
 
+	cmd.Flag("block-shard.shard-id", "Shard of blocks to serve, out of --block-shard.total-shards. Blocks are assigned to shards by the hash of their ID, so that replicas serving all shards serve every block once.").
+		Default("0").IntVar(&sc.blockShardID)
+
+	cmd.Flag("block-shard.total-shards", "Number of shards blocks are split into by the hash of their ID. 1 serves all blocks.").
+		Default("1").IntVar(&sc.blockShardTotal)
+
 	cmd.Flag("store.index-header-posting-offsets-in-mem-sampling", "Controls what is the ratio of postings offsets store will hold in memory. "+
 		"Larger value will keep less offsets, which will increase CPU cycles needed for query touching those postings. It's meant for setups that want low baseline memory pressure and where less traffic is expected. "+
 		"On the contrary, smaller value will increase baseline memory usage, but improve latency slightly. 1 will keep all in memory. Default value is the same as in Prometheus which gives a good balance.").
@@ -157,6 +207,29 @@ func (sc *storeConfig) registerFlag(cmd extkingpin.FlagClause) {
 	cmd.Flag("store.index-header-lazy-reader-idle-timeout", "If index-header lazy reader is enabled and this idle timeout setting is > 0, memory map-ed index-headers will be automatically released after 'idle timeout' inactivity.").
 		Hidden().Default("5m").DurationVar(&sc.lazyIndexReaderIdleTimeout)
 
+	cmd.Flag("store.index-header-generation-concurrency", "Maximum number of index-headers built concurrently from object storage when they are missing on local disk (e.g. on startup). "+
+		"Each build downloads the symbols and postings offsets tables of the block index, so lowering it bounds the memory and bandwidth used during the initial sync. "+
+		"0 means it is only limited by --block-sync-concurrency.").
+		Default("0").IntVar(&sc.indexHeaderGenerationConcurrency)
+
+	cmd.Flag("store.block-stats-top-n", "Number of largest loaded blocks to expose per-block statistics metrics (series, chunks, size, min and max time, last queried time) for, labeled by block ULID. 0 disables these metrics.").
+		Default("0").IntVar(&sc.blockStatsTopN)
+
+	cmd.Flag("store.index-cache-warmup-matcher", "Series selector (e.g. '{job=\"prometheus\"}') whose postings and series are loaded into the index cache of every block during the initial sync, before the store is ready. Can be repeated.").
+		PlaceHolder("<selector>").StringsVar(&sc.indexCacheWarmupMatchers)
+
+	cmd.Flag("store.skip-identical-blocks", "If true, blocks with the same content as another block uploaded under a different ULID (same time range, resolution, external labels, source and series, chunks and samples counts) are not loaded. The block with the lowest ULID is served.").
+		Default("false").BoolVar(&sc.skipIdenticalBlocks)
+
+	cmd.Flag("store.enable-no-cache-requests", "If true, Series requests with the no_cache field set, e.g. by queries with the no_cache=true parameter, bypass the index cache and the caching bucket and read directly from the object storage. Meant for debugging cache related issues.").
+		Default("false").BoolVar(&sc.enableNoCacheRequests)
+
+	cmd.Flag("store.postings-strategy", "[EXPERIMENTAL] How postings of regex matchers are expanded. 'eager' fetches them at once with the ones of the other matchers of a query. 'lazy' fetches them after the ones of the other matchers, in batches of label values, keeping only the series matched by the other matchers and stopping once all of them are matched, which lowers the memory used by regex matchers over high cardinality labels. 'auto' fetches them after the ones of the other matchers too, lazily if the other matchers matched at most --store.postings-strategy.lazy-max-series series of a block, and at once otherwise.").
+		Default(string(store.EagerPostings)).EnumVar(&sc.postingsStrategy, string(store.EagerPostings), string(store.LazyPostings), string(store.AutoPostings))
+
+	cmd.Flag("store.postings-strategy.lazy-max-series", "[EXPERIMENTAL] Maximum number of series of a block matched by the other matchers of a query for postings of regex matchers to be expanded lazily by the 'auto' postings strategy.").
+		Default("10000").IntVar(&sc.lazyPostingsMaxSeries)
+
 	cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the bucket web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos bucket web UI to be served behind a reverse proxy that strips a URL sub-path.").
 		Default("").StringVar(&sc.webConfig.externalPrefix)
 
@@ -260,8 +333,9 @@ func runStore(
 
 	r := route.New()
 
+	var partitionedCache *storecache.TenantPartitionedCache
 	if len(cachingBucketConfigYaml) > 0 {
-		bkt, err = storecache.NewCachingBucketFromYaml(cachingBucketConfigYaml, bkt, logger, reg, r)
+		bkt, partitionedCache, err = storecache.NewCachingBucketFromYaml(cachingBucketConfigYaml, bkt, logger, reg, r)
 		if err != nil {
 			return errors.Wrap(err, "create caching bucket")
 		}
@@ -282,6 +356,18 @@ func runStore(
 		return errors.Wrap(err, "get content of index cache configuration")
 	}
 
+	requestLimitsContentYaml, err := conf.requestLimitsConfig.Content()
+	if err != nil {
+		return errors.Wrap(err, "get content of request limits configuration")
+	}
+	requestLimits, err := store.ParseTenantRequestLimits(store.RequestLimits{
+		Series:  conf.requestSeriesLimit,
+		Samples: conf.requestSamplesLimit,
+	}, requestLimitsContentYaml)
+	if err != nil {
+		return err
+	}
+
 	// Create the index cache loading its config from config file, while keeping
 	// backward compatibility with the pre-config file era.
 	var indexCache storecache.IndexCache
@@ -297,15 +383,28 @@ func runStore(
 		return errors.Wrap(err, "create index cache")
 	}
 
+	blockShardFilter, err := block.NewBlockIDShardedMetaFilter(conf.blockShardID, conf.blockShardTotal)
+	if err != nil {
+		return errors.Wrap(err, "invalid block shard")
+	}
+
 	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, time.Duration(conf.ignoreDeletionMarksDelay), conf.blockMetaFetchConcurrency)
-	metaFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, bkt, conf.dataDir, extprom.WrapRegistererWithPrefix("thanos_", reg),
-		[]block.MetadataFilter{
-			block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
-			block.NewLabelShardedMetaFilter(relabelConfig),
-			block.NewConsistencyDelayMetaFilter(logger, time.Duration(conf.consistencyDelay), extprom.WrapRegistererWithPrefix("thanos_", reg)),
-			ignoreDeletionMarkFilter,
-			block.NewDeduplicateFilter(conf.blockMetaFetchConcurrency),
-		})
+	filters := []block.MetadataFilter{
+		block.NewTimePartitionMetaFilter(conf.filterConf.MinTime, conf.filterConf.MaxTime),
+		block.NewLabelShardedMetaFilter(relabelConfig),
+		blockShardFilter,
+		block.NewConsistencyDelayMetaFilter(logger, time.Duration(conf.consistencyDelay), extprom.WrapRegistererWithPrefix("thanos_", reg)),
+		ignoreDeletionMarkFilter,
+		block.NewDeduplicateFilter(conf.blockMetaFetchConcurrency),
+	}
+	if conf.skipIdenticalBlocks {
+		filters = append(filters, block.NewIdenticalBlocksFilter(logger))
+	}
+	if partitionedCache != nil {
+		// Partitions the caching bucket between the tenants of the blocks loaded by the store.
+		filters = append(filters, partitionedCache)
+	}
+	metaFetcher, err := block.NewMetaFetcher(logger, conf.blockMetaFetchConcurrency, bkt, conf.dataDir, extprom.WrapRegistererWithPrefix("thanos_", reg), filters)
 	if err != nil {
 		return errors.Wrap(err, "meta fetcher")
 	}
@@ -322,6 +421,15 @@ func runStore(
 		return errors.Wrap(err, "create chunk pool")
 	}
 
+	indexCacheWarmupMatchers := make([][]*labels.Matcher, 0, len(conf.indexCacheWarmupMatchers))
+	for _, sel := range conf.indexCacheWarmupMatchers {
+		ms, err := parser.ParseMetricSelector(sel)
+		if err != nil {
+			return errors.Wrapf(err, "parse index cache warm-up matcher %q", sel)
+		}
+		indexCacheWarmupMatchers = append(indexCacheWarmupMatchers, ms)
+	}
+
 	options := []store.BucketStoreOption{
 		store.WithLogger(logger),
 		store.WithRegistry(reg),
@@ -329,6 +437,15 @@ func runStore(
 		store.WithQueryGate(queriesGate),
 		store.WithChunkPool(chunkPool),
 		store.WithFilterConfig(conf.filterConf),
+		store.WithIndexHeaderGenerationConcurrency(conf.indexHeaderGenerationConcurrency),
+		store.WithBlockStatsTopN(conf.blockStatsTopN),
+		store.WithIndexCacheWarmupMatchers(indexCacheWarmupMatchers),
+		store.WithNoCacheRequests(conf.enableNoCacheRequests),
+		store.WithPostingsStrategy(store.PostingsStrategy(conf.postingsStrategy), conf.lazyPostingsMaxSeries),
+		store.WithSeriesMemoryBudget(uint64(conf.seriesMemoryBudget)),
+		store.WithRequestLimits(requestLimits),
+		store.WithLabelsCache(conf.labelsCacheTTL, conf.labelsCacheMaxItems),
+		store.WithSeriesLabelsCache(conf.seriesLabelsCacheMaxSeries),
 	}
 
 	if conf.debugLogging {
@@ -393,8 +510,10 @@ func runStore(
 			if httpProbe.IsReady() {
 				mint, maxt := bs.TimeRange()
 				return &infopb.StoreInfo{
-					MinTime: mint,
-					MaxTime: maxt,
+					MinTime:                   mint,
+					MaxTime:                   maxt,
+					SupportsLabelValuesStream: true,
+					SupportsQueryPushdown:     true,
 				}
 			}
 			return nil
@@ -403,7 +522,7 @@ func runStore(
 
 	// Start query (proxy) gRPC StoreAPI.
 	{
-		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), conf.grpcConfig.tlsSrvCert, conf.grpcConfig.tlsSrvKey, conf.grpcConfig.tlsSrvClientCA)
+		tlsCfg, err := tls.NewServerConfig(log.With(logger, "protocol", "gRPC"), extprom.WrapRegistererWithPrefix("thanos_grpc_", reg), conf.grpcConfig.tlsSrvCert, conf.grpcConfig.tlsSrvKey, conf.grpcConfig.tlsSrvClientCA)
 		if err != nil {
 			return errors.Wrap(err, "setup gRPC server")
 		}
@@ -74,8 +74,9 @@ var (
 			verifier.DuplicatedCompactionBlocks{},
 		},
 	}
-	inspectColumns = []string{"ULID", "FROM", "UNTIL", "RANGE", "UNTIL-DOWN", "#SERIES", "#SAMPLES", "#CHUNKS", "COMP-LEVEL", "COMP-FAILED", "LABELS", "RESOLUTION", "SOURCE"}
-	outputTypes    = []string{"table", "tsv", "csv"}
+	inspectColumns  = []string{"ULID", "FROM", "UNTIL", "RANGE", "UNTIL-DOWN", "#SERIES", "#SAMPLES", "#CHUNKS", "COMP-LEVEL", "COMP-FAILED", "LABELS", "RESOLUTION", "SOURCE"}
+	outputTypes     = []string{"table", "tsv", "csv"}
+	overlapsColumns = []string{"GROUP", "BLOCK-A", "BLOCK-B", "FROM", "UNTIL", "OVERLAP", "#SAMPLES-EST", "#COMMON-SERIES"}
 )
 
 type outputType string
@@ -147,6 +148,14 @@ type bucketRetentionConfig struct {
 	deleteDelay          time.Duration
 }
 
+type bucketOverlapsConfig struct {
+	selector []string
+	output   string
+	series   bool
+	tmpDir   string
+	timeout  time.Duration
+}
+
 type bucketMarkBlockConfig struct {
 	details  string
 	marker   string
@@ -185,6 +194,17 @@ func (tbc *bucketInspectConfig) registerBucketInspectFlag(cmd extkingpin.FlagCla
 	return tbc
 }
 
+func (tbc *bucketOverlapsConfig) registerBucketOverlapsFlag(cmd extkingpin.FlagClause) *bucketOverlapsConfig {
+	cmd.Flag("selector", "Selects blocks based on label, e.g. '-l key1=\\\"value1\\\" -l key2=\\\"value2\\\"'. All key value pairs must match.").Short('l').
+		PlaceHolder("<name>=\\\"<value>\\\"").StringsVar(&tbc.selector)
+	cmd.Flag("output", "Output format for result. Currently supports table, json.").Default("table").EnumVar(&tbc.output, "table", "json")
+	cmd.Flag("series", "Count the series found in both blocks of every overlapping pair. Downloads the index files of the overlapping blocks, one at a time. Chunk files are never downloaded.").
+		Default("true").BoolVar(&tbc.series)
+	cmd.Flag("tmp.dir", "Working directory for the downloaded index files.").Default(filepath.Join(os.TempDir(), "thanos-overlaps")).StringVar(&tbc.tmpDir)
+	cmd.Flag("timeout", "Timeout to download metadata and indexes from remote storage").Default("5m").DurationVar(&tbc.timeout)
+	return tbc
+}
+
 func (tbc *bucketWebConfig) registerBucketWebFlag(cmd extkingpin.FlagClause) *bucketWebConfig {
 	cmd.Flag("web.route-prefix", "Prefix for API and UI endpoints. This allows thanos UI to be served on a sub-path. Defaults to the value of --web.external-prefix. This option is analogous to --web.route-prefix of Prometheus.").Default("").StringVar(&tbc.webRoutePrefix)
 
@@ -271,6 +291,7 @@ func registerBucket(app extkingpin.AppClause) {
 	registerBucketVerify(cmd, objStoreConfig)
 	registerBucketLs(cmd, objStoreConfig)
 	registerBucketInspect(cmd, objStoreConfig)
+	registerBucketOverlaps(cmd, objStoreConfig)
 	registerBucketWeb(cmd, objStoreConfig)
 	registerBucketReplicate(cmd, objStoreConfig)
 	registerBucketDownsample(cmd, objStoreConfig)
@@ -529,6 +550,69 @@ func registerBucketInspect(app extkingpin.AppClause, objStoreConfig *extflag.Pat
 	})
 }
 
+// registerBucketOverlaps reports the blocks vertical compaction would merge, without modifying the bucket.
+func registerBucketOverlaps(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
+	cmd := app.Command("overlaps", "Dry run of vertical compaction. Reports the blocks with overlapping time ranges of every compaction group, with an estimate of the overlapping series and samples.")
+
+	tbc := &bucketOverlapsConfig{}
+	tbc.registerBucketOverlapsFlag(cmd)
+
+	cmd.Setup(func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ <-chan struct{}, _ bool) error {
+		selectorLabels, err := parseFlagLabels(tbc.selector)
+		if err != nil {
+			return errors.Wrap(err, "error parsing selector flag")
+		}
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Bucket.String())
+		if err != nil {
+			return err
+		}
+
+		ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 0, block.FetcherConcurrency)
+		fetcher, err := block.NewMetaFetcher(logger, block.FetcherConcurrency, bkt, "", extprom.WrapRegistererWithPrefix(extpromPrefix, reg), []block.MetadataFilter{ignoreDeletionMarkFilter})
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		ctx, cancel := context.WithTimeout(context.Background(), tbc.timeout)
+		defer cancel()
+
+		metas, _, err := fetcher.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+		for id, meta := range metas {
+			if !matchesSelector(meta, selectorLabels) {
+				delete(metas, id)
+			}
+		}
+
+		report := compact.FindOverlaps(metas)
+		if tbc.series {
+			if err := report.CountCommonSeries(ctx, logger, bkt, tbc.tmpDir); err != nil {
+				return errors.Wrap(err, "count common series")
+			}
+		}
+
+		if tbc.output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}
+		return printOverlaps(report, printTable)
+	})
+}
+
 // registerBucketWeb exposes a web interface for the state of remote store like `pprof web`.
 func registerBucketWeb(app extkingpin.AppClause, objStoreConfig *extflag.PathOrContent) {
 	cmd := app.Command("web", "Web interface for remote storage bucket.")
@@ -952,6 +1036,42 @@ func printBlockData(blockMetas []*metadata.Meta, selectorLabels labels.Labels, s
 	return nil
 }
 
+func printOverlaps(report *compact.OverlapReport, printer tablePrinter) error {
+	p := message.NewPrinter(language.English)
+
+	var lines [][]string
+	for _, g := range report.Groups {
+		var labels []string
+		for _, key := range getKeysAlphabetically(g.Labels) {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, g.Labels[key]))
+		}
+		group := fmt.Sprintf("%s@%s", strings.Join(labels, ","), time.Duration(g.Resolution*int64(time.Millisecond)).String())
+
+		for _, o := range g.Pairs {
+			commonSeries := "-"
+			if o.CommonSeries != nil {
+				commonSeries = p.Sprintf("%d", *o.CommonSeries)
+			}
+			lines = append(lines, []string{
+				group,
+				o.A.String(),
+				o.B.String(),
+				time.Unix(o.MinTime/1000, 0).Format(time.RFC3339),
+				time.Unix(o.MaxTime/1000, 0).Format(time.RFC3339),
+				time.Duration((o.MaxTime - o.MinTime) * int64(time.Millisecond)).String(),
+				p.Sprintf("%d", o.SamplesEstimate),
+				commonSeries,
+			})
+		}
+	}
+
+	t := Table{Header: overlapsColumns, Lines: lines}
+	if err := printer(os.Stdout, t); err != nil {
+		return errors.Errorf("unable to write output.")
+	}
+	return nil
+}
+
 func getKeysAlphabetically(labels map[string]string) []string {
 	var keys []string
 	for k := range labels {
@@ -7,15 +7,18 @@ package alert
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/go-openapi/strfmt"
@@ -229,18 +232,26 @@ type Sender struct {
 	alertmanagers []*Alertmanager
 	versions      []APIVersion
 
-	sent    *prometheus.CounterVec
-	errs    *prometheus.CounterVec
-	dropped prometheus.Counter
-	latency *prometheus.HistogramVec
+	// dedupWindow is the duration within which an identical alert batch, once sent, is not sent again.
+	dedupWindow time.Duration
+	dedupMtx    sync.Mutex
+	lastSent    map[uint64]time.Time
+
+	sent         *prometheus.CounterVec
+	errs         *prometheus.CounterVec
+	dropped      prometheus.Counter
+	deduplicated prometheus.Counter
+	latency      *prometheus.HistogramVec
 }
 
 // NewSender returns a new sender. On each call to Send the entire alert batch is sent
-// to each Alertmanager returned by the getter function.
+// to each Alertmanager returned by the getter function. If dedupWindow is greater than 0,
+// batches identical to one successfully sent within the window are skipped.
 func NewSender(
 	logger log.Logger,
 	reg prometheus.Registerer,
 	alertmanagers []*Alertmanager,
+	dedupWindow time.Duration,
 ) *Sender {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -259,6 +270,8 @@ func NewSender(
 		logger:        logger,
 		alertmanagers: alertmanagers,
 		versions:      versions,
+		dedupWindow:   dedupWindow,
+		lastSent:      map[uint64]time.Time{},
 
 		sent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "thanos_alert_sender_alerts_sent_total",
@@ -275,6 +288,11 @@ func NewSender(
 			Help: "Total number of alerts dropped in case of all sends to alertmanagers failed.",
 		}),
 
+		deduplicated: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_alert_sender_notifications_deduplicated_total",
+			Help: "Total number of alert notifications not sent because an identical one was sent within the deduplication window.",
+		}),
+
 		latency: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Name: "thanos_alert_sender_latency_seconds",
 			Help: "Latency for sending alert notifications (not including dropped notifications).",
@@ -299,6 +317,16 @@ func (s *Sender) Send(ctx context.Context, alerts []*notifier.Alert) {
 		return
 	}
 
+	var fp uint64
+	if s.dedupWindow > 0 {
+		fp = fingerprint(alerts)
+		if s.isDuplicate(fp, time.Now()) {
+			level.Debug(s.logger).Log("msg", "skipping duplicate alert notification", "numAlerts", len(alerts))
+			s.deduplicated.Inc()
+			return
+		}
+	}
+
 	payload := make(map[APIVersion][]byte)
 	for _, version := range s.versions {
 		var (
@@ -368,6 +396,9 @@ func (s *Sender) Send(ctx context.Context, alerts []*notifier.Alert) {
 	wg.Wait()
 
 	if numSuccess.Load() > 0 {
+		if s.dedupWindow > 0 {
+			s.markSent(fp, time.Now())
+		}
 		return
 	}
 
@@ -375,6 +406,50 @@ func (s *Sender) Send(ctx context.Context, alerts []*notifier.Alert) {
 	level.Warn(s.logger).Log("msg", "failed to send alerts to all alertmanagers", "numAlerts", len(alerts))
 }
 
+// fingerprint returns a hash identifying the given alert batch, independently of the order of alerts.
+func fingerprint(alerts []*notifier.Alert) uint64 {
+	hashes := make([]uint64, 0, len(alerts))
+	buf := make([]byte, 5*8)
+	for _, a := range alerts {
+		binary.LittleEndian.PutUint64(buf[0:], a.Labels.Hash())
+		binary.LittleEndian.PutUint64(buf[8:], a.Annotations.Hash())
+		binary.LittleEndian.PutUint64(buf[16:], uint64(a.StartsAt.UnixNano()))
+		binary.LittleEndian.PutUint64(buf[24:], uint64(a.EndsAt.UnixNano()))
+		binary.LittleEndian.PutUint64(buf[32:], xxhash.Sum64String(a.GeneratorURL))
+		hashes = append(hashes, xxhash.Sum64(buf))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	d := xxhash.New()
+	for _, h := range hashes {
+		binary.LittleEndian.PutUint64(buf, h)
+		_, _ = d.Write(buf[:8])
+	}
+	return d.Sum64()
+}
+
+// isDuplicate returns true if a batch with the given fingerprint was sent within the deduplication window.
+// It also forgets batches sent before the window.
+func (s *Sender) isDuplicate(fp uint64, now time.Time) bool {
+	s.dedupMtx.Lock()
+	defer s.dedupMtx.Unlock()
+
+	for k, t := range s.lastSent {
+		if now.Sub(t) >= s.dedupWindow {
+			delete(s.lastSent, k)
+		}
+	}
+	_, ok := s.lastSent[fp]
+	return ok
+}
+
+func (s *Sender) markSent(fp uint64, now time.Time) {
+	s.dedupMtx.Lock()
+	defer s.dedupMtx.Unlock()
+
+	s.lastSent[fp] = now
+}
+
 type Dispatcher interface {
 	// Endpoints returns the list of endpoint URLs the dispatcher knows about.
 	Endpoints() []*url.URL
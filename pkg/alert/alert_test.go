@@ -154,7 +154,7 @@ func TestSenderSendsOk(t *testing.T) {
 	poster := &fakeClient{
 		urls: []*url.URL{{Host: "am1:9090"}, {Host: "am2:9090"}},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, 0)
 
 	s.Send(context.Background(), []*notifier.Alert{{}, {}})
 
@@ -181,7 +181,7 @@ func TestSenderSendsOneFails(t *testing.T) {
 			return rec.Result(), nil
 		},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, 0)
 
 	s.Send(context.Background(), []*notifier.Alert{{}, {}})
 
@@ -202,7 +202,7 @@ func TestSenderSendsAllFail(t *testing.T) {
 			return nil, errors.New("no such host")
 		},
 	}
-	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)})
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, 0)
 
 	s.Send(context.Background(), []*notifier.Alert{{}, {}})
 
@@ -215,3 +215,51 @@ func TestSenderSendsAllFail(t *testing.T) {
 	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.errs.WithLabelValues(poster.urls[1].Host))))
 	testutil.Equals(t, 2, int(promtestutil.ToFloat64(s.dropped)))
 }
+
+func TestSenderDeduplicatesWithinWindow(t *testing.T) {
+	poster := &fakeClient{
+		urls: []*url.URL{{Host: "am1:9090"}, {Host: "am2:9090"}},
+	}
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, time.Hour)
+
+	alerts := []*notifier.Alert{
+		{Labels: labels.FromStrings("alertname", "a")},
+		{Labels: labels.FromStrings("alertname", "b")},
+	}
+	s.Send(context.Background(), alerts)
+	testutil.Equals(t, 2, len(poster.seen))
+
+	// The same batch, even in a different order, is not sent again within the window.
+	s.Send(context.Background(), []*notifier.Alert{alerts[1], alerts[0]})
+	testutil.Equals(t, 2, len(poster.seen))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.deduplicated)))
+
+	// A different batch is sent.
+	s.Send(context.Background(), alerts[:1])
+	testutil.Equals(t, 4, len(poster.seen))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.deduplicated)))
+
+	// Batches are sent again once the window has passed.
+	s.dedupWindow = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	s.Send(context.Background(), alerts)
+	testutil.Equals(t, 6, len(poster.seen))
+	testutil.Equals(t, 1, int(promtestutil.ToFloat64(s.deduplicated)))
+}
+
+func TestSenderDoesNotDeduplicateFailedSends(t *testing.T) {
+	poster := &fakeClient{
+		urls: []*url.URL{{Host: "am1:9090"}},
+		dof: func(u *url.URL) (*http.Response, error) {
+			return nil, errors.New("no such host")
+		},
+	}
+	s := NewSender(nil, nil, []*Alertmanager{NewAlertmanager(nil, poster, time.Minute, APIv1)}, time.Hour)
+
+	alerts := []*notifier.Alert{{Labels: labels.FromStrings("alertname", "a")}}
+	s.Send(context.Background(), alerts)
+	s.Send(context.Background(), alerts)
+
+	testutil.Equals(t, 2, len(poster.seen))
+	testutil.Equals(t, 0, int(promtestutil.ToFloat64(s.deduplicated)))
+}
@@ -56,6 +56,7 @@ const (
 	ErrorExec     ErrorType = "execution"
 	ErrorBadData  ErrorType = "bad_data"
 	ErrorInternal ErrorType = "internal"
+	ErrorTooLarge ErrorType = "too_large"
 )
 
 var corsHeaders = map[string]string{
@@ -211,6 +212,12 @@ func GetInstr(
 			if data, warnings, err := f(r); err != nil {
 				RespondError(w, err, data)
 			} else if data != nil {
+				if om, ok := data.(OpenMetricsResponse); ok && acceptsOpenMetrics(r) {
+					if mfs, ok := om.OpenMetricsFamilies(); ok {
+						RespondOpenMetrics(w, mfs, warnings)
+						return
+					}
+				}
 				Respond(w, data, warnings)
 			} else {
 				w.WriteHeader(http.StatusNoContent)
@@ -261,6 +268,8 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 		code = http.StatusServiceUnavailable
 	case ErrorInternal:
 		code = http.StatusInternalServerError
+	case ErrorTooLarge:
+		code = http.StatusRequestEntityTooLarge
 	default:
 		code = http.StatusInternalServerError
 	}
@@ -0,0 +1,55 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// OpenMetricsResponse is implemented by API response data which can be served in the OpenMetrics text format
+// to clients accepting it.
+type OpenMetricsResponse interface {
+	// OpenMetricsFamilies returns the data as metric families, or false if it can't be represented as such.
+	OpenMetricsFamilies() ([]*dto.MetricFamily, bool)
+}
+
+// acceptsOpenMetrics returns true if the request accepts the OpenMetrics text format.
+func acceptsOpenMetrics(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || mediaType != expfmt.OpenMetricsType {
+			continue
+		}
+		if v, ok := params["version"]; !ok || v == expfmt.OpenMetricsVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// RespondOpenMetrics writes the metric families in the OpenMetrics text format.
+// Warnings can't be represented in the format, so they are passed in Warning headers.
+func RespondOpenMetrics(w http.ResponseWriter, mfs []*dto.MetricFamily, warnings []error) {
+	w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+	if len(warnings) > 0 {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	for _, warn := range warnings {
+		w.Header().Add("Warning", "199 - "+strconv.Quote(warn.Error()))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToOpenMetrics(w, mf); err != nil {
+			return
+		}
+	}
+	_, _ = expfmt.FinalizeOpenMetrics(w)
+}
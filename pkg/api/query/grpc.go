@@ -79,7 +79,11 @@ func (g *GRPCAPI) Query(request *querypb.QueryRequest, server querypb.Query_Quer
 		request.EnableQueryPushdown,
 		false,
 	)
-	qry, err := qe.NewInstantQuery(queryable, request.Query, ts)
+	qs := request.Query
+	if request.EnableQueryPushdown {
+		qs = query.PushDownRangeFunctions(qs, 0)
+	}
+	qry, err := qe.NewInstantQuery(queryable, qs, ts)
 	if err != nil {
 		return err
 	}
@@ -152,7 +156,11 @@ func (g *GRPCAPI) QueryRange(request *querypb.QueryRangeRequest, srv querypb.Que
 	endTime := time.Unix(request.EndTimeSeconds, 0)
 	interval := time.Duration(request.IntervalSeconds) * time.Second
 
-	qry, err := qe.NewRangeQuery(queryable, request.Query, startTime, endTime, interval)
+	qs := request.Query
+	if request.EnableQueryPushdown {
+		qs = query.PushDownRangeFunctions(qs, interval)
+	}
+	qry, err := qe.NewRangeQuery(queryable, qs, startTime, endTime, interval)
 	if err != nil {
 		return err
 	}
@@ -29,10 +29,12 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/model/labels"
@@ -55,6 +57,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/rules"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/targets"
 	"github.com/thanos-io/thanos/pkg/targets/targetspb"
@@ -70,8 +73,20 @@ const (
 	StoreMatcherParam        = "storeMatch[]"
 	Step                     = "step"
 	Stats                    = "stats"
+	TimezoneParam            = "timezone"
+	LimitParam               = "limit"
+	NoCacheParam             = "no_cache"
+	ResultMatcherParam       = "result_match[]"
+	TimesParam               = "time[]"
+	OffsetParam              = "offset"
+	BaseOffsetParam          = "base_offset"
+	EndInclusiveParam        = "end_inclusive"
+	NaNPolicyParam           = "nan_policy"
 )
 
+// errSeriesLimitReached is the warning returned when the series response was truncated to the requested limit.
+var errSeriesLimitReached = errors.New("results truncated due to limit")
+
 // QueryAPI is an API used by Thanos Querier.
 type QueryAPI struct {
 	baseAPI         *api.BaseAPI
@@ -100,6 +115,12 @@ type QueryAPI struct {
 	defaultRangeQueryStep                  time.Duration
 	defaultInstantQueryMaxSourceResolution time.Duration
 	defaultMetadataTimeRange               time.Duration
+	// maxResponseBytes is the maximum estimated size of the query and query range results. 0 means no limit.
+	maxResponseBytes int64
+	// maxMultiInstantTimes is the maximum number of evaluation times of a multi instant query.
+	maxMultiInstantTimes int
+	// tenantHeader is the HTTP header of the tenant of requests, forwarded to stores.
+	tenantHeader string
 
 	queryRangeHist prometheus.Histogram
 }
@@ -126,6 +147,9 @@ func NewQueryAPI(
 	defaultRangeQueryStep time.Duration,
 	defaultInstantQueryMaxSourceResolution time.Duration,
 	defaultMetadataTimeRange time.Duration,
+	maxResponseBytes int64,
+	maxMultiInstantTimes int,
+	tenantHeader string,
 	disableCORS bool,
 	gate gate.Gate,
 	reg *prometheus.Registry,
@@ -153,6 +177,9 @@ func NewQueryAPI(
 		defaultRangeQueryStep:                  defaultRangeQueryStep,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
 		defaultMetadataTimeRange:               defaultMetadataTimeRange,
+		maxResponseBytes:                       maxResponseBytes,
+		maxMultiInstantTimes:                   maxMultiInstantTimes,
+		tenantHeader:                           tenantHeader,
 		disableCORS:                            disableCORS,
 
 		queryRangeHist: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
@@ -169,19 +196,25 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 
 	instr := api.GetInstr(tracer, logger, ins, logMiddleware, qapi.disableCORS)
 
-	r.Get("/query", instr("query", qapi.query))
-	r.Post("/query", instr("query", qapi.query))
+	r.Get("/query", instr("query", qapi.withTenant(qapi.query)))
+	r.Post("/query", instr("query", qapi.withTenant(qapi.query)))
+
+	r.Get("/query_range", instr("query_range", qapi.withTenant(qapi.queryRange)))
+	r.Post("/query_range", instr("query_range", qapi.withTenant(qapi.queryRange)))
 
-	r.Get("/query_range", instr("query_range", qapi.queryRange))
-	r.Post("/query_range", instr("query_range", qapi.queryRange))
+	r.Get("/query_multi_instant", instr("query_multi_instant", qapi.withTenant(qapi.queryMultiInstant)))
+	r.Post("/query_multi_instant", instr("query_multi_instant", qapi.withTenant(qapi.queryMultiInstant)))
 
-	r.Get("/label/:name/values", instr("label_values", qapi.labelValues))
+	r.Get("/query_offset_diff", instr("query_offset_diff", qapi.withTenant(qapi.queryOffsetDiff)))
+	r.Post("/query_offset_diff", instr("query_offset_diff", qapi.withTenant(qapi.queryOffsetDiff)))
 
-	r.Get("/series", instr("series", qapi.series))
-	r.Post("/series", instr("series", qapi.series))
+	r.Get("/label/:name/values", instr("label_values", qapi.withTenant(qapi.labelValues)))
 
-	r.Get("/labels", instr("label_names", qapi.labelNames))
-	r.Post("/labels", instr("label_names", qapi.labelNames))
+	r.Get("/series", instr("series", qapi.withTenant(qapi.series)))
+	r.Post("/series", instr("series", qapi.withTenant(qapi.series)))
+
+	r.Get("/labels", instr("label_names", qapi.withTenant(qapi.labelNames)))
+	r.Post("/labels", instr("label_names", qapi.withTenant(qapi.labelNames)))
 
 	r.Get("/stores", instr("stores", qapi.stores))
 
@@ -196,12 +229,68 @@ func (qapi *QueryAPI) Register(r *route.Router, tracer opentracing.Tracer, logge
 	r.Post("/query_exemplars", instr("exemplars", NewExemplarsHandler(qapi.exemplars, qapi.enableExemplarPartialResponse)))
 }
 
+// withTenant sets the tenant given by the tenant header, if any, as the tenant of the request forwarded to stores.
+func (qapi *QueryAPI) withTenant(f api.ApiFunc) api.ApiFunc {
+	return func(r *http.Request) (interface{}, []error, *api.ApiError) {
+		if tenant := r.Header.Get(qapi.tenantHeader); qapi.tenantHeader != "" && tenant != "" {
+			r = r.WithContext(context.WithValue(r.Context(), store.TenantKey, tenant))
+		}
+		return f(r)
+	}
+}
+
 type queryData struct {
 	ResultType parser.ValueType  `json:"resultType"`
 	Result     parser.Value      `json:"result"`
 	Stats      *stats.QueryStats `json:"stats,omitempty"`
-	// Additional Thanos Response field.
+	// Additional Thanos Response fields.
 	Warnings []error `json:"warnings,omitempty"`
+	// FailedStores lists stores which failed to return data, when the query was served with partial response.
+	FailedStores []store.FailedStore `json:"failedStores,omitempty"`
+}
+
+// openMetricsUnnamedSeries is the metric name of series without one, e.g. aggregation results, in the OpenMetrics format.
+const openMetricsUnnamedSeries = "query_result"
+
+// OpenMetricsFamilies implements api.OpenMetricsResponse. Only instant vectors can be represented; each metric name
+// becomes a family of unknown type, with the samples keeping their timestamp.
+func (d *queryData) OpenMetricsFamilies() ([]*dto.MetricFamily, bool) {
+	vector, ok := d.Result.(promql.Vector)
+	if !ok {
+		return nil, false
+	}
+
+	families := map[string]*dto.MetricFamily{}
+	for _, s := range vector {
+		name := s.Metric.Get(labels.MetricName)
+		if name == "" {
+			name = openMetricsUnnamedSeries
+		}
+		mf, ok := families[name]
+		if !ok {
+			mf = &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum()}
+			families[name] = mf
+		}
+
+		m := &dto.Metric{
+			Untyped:     &dto.Untyped{Value: proto.Float64(s.V)},
+			TimestampMs: proto.Int64(s.T),
+		}
+		for _, l := range s.Metric {
+			if l.Name == labels.MetricName {
+				continue
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	res := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		res = append(res, mf)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].GetName() < res[j].GetName() })
+	return res, true
 }
 
 func (qapi *QueryAPI) parseEnableDedupParam(r *http.Request) (enableDeduplication bool, _ *api.ApiError) {
@@ -217,6 +306,37 @@ func (qapi *QueryAPI) parseEnableDedupParam(r *http.Request) (enableDeduplicatio
 	return enableDeduplication, nil
 }
 
+func (qapi *QueryAPI) parseNoCacheParam(r *http.Request) (noCache bool, _ *api.ApiError) {
+	if val := r.FormValue(NoCacheParam); val != "" {
+		var err error
+		noCache, err = strconv.ParseBool(val)
+		if err != nil {
+			return false, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", NoCacheParam)}
+		}
+	}
+	return noCache, nil
+}
+
+func (qapi *QueryAPI) parseEndInclusiveParam(r *http.Request) (endInclusive bool, _ *api.ApiError) {
+	endInclusive = true
+	if val := r.FormValue(EndInclusiveParam); val != "" {
+		var err error
+		endInclusive, err = strconv.ParseBool(val)
+		if err != nil {
+			return false, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", EndInclusiveParam)}
+		}
+	}
+	return endInclusive, nil
+}
+
+func (qapi *QueryAPI) parseNaNPolicyParam(r *http.Request) (query.NaNPolicy, *api.ApiError) {
+	policy, err := query.ParseNaNPolicy(r.FormValue(NaNPolicyParam))
+	if err != nil {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", NaNPolicyParam)}
+	}
+	return policy, nil
+}
+
 func (qapi *QueryAPI) parseReplicaLabelsParam(r *http.Request) (replicaLabels []string, _ *api.ApiError) {
 	if err := r.ParseForm(); err != nil {
 		return nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
@@ -247,6 +367,22 @@ func (qapi *QueryAPI) parseStoreDebugMatchersParam(r *http.Request) (storeMatche
 	return storeMatchers, nil
 }
 
+func (qapi *QueryAPI) parseResultMatchersParam(r *http.Request) (resultMatchers [][]*labels.Matcher, _ *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &api.ApiError{Typ: api.ErrorInternal, Err: errors.Wrap(err, "parse form")}
+	}
+
+	for _, s := range r.Form[ResultMatcherParam] {
+		matchers, err := parser.ParseMetricSelector(s)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", ResultMatcherParam)}
+		}
+		resultMatchers = append(resultMatchers, matchers)
+	}
+
+	return resultMatchers, nil
+}
+
 func (qapi *QueryAPI) parseDownsamplingParamMillis(r *http.Request, defaultVal time.Duration) (maxResolutionMillis int64, _ *api.ApiError) {
 	maxSourceResolution := 0 * time.Second
 
@@ -281,6 +417,20 @@ func (qapi *QueryAPI) parsePartialResponseParam(r *http.Request, defaultEnablePa
 	return defaultEnablePartialResponse, nil
 }
 
+func (qapi *QueryAPI) parseLimitParam(r *http.Request) (limit int, _ *api.ApiError) {
+	if val := r.FormValue(LimitParam); val != "" {
+		var err error
+		limit, err = strconv.Atoi(val)
+		if err != nil {
+			return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", LimitParam)}
+		}
+		if limit < 0 {
+			return 0, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("negative '%s' is not accepted. Try a positive integer", LimitParam)}
+		}
+	}
+	return limit, nil
+}
+
 func (qapi *QueryAPI) parseStep(r *http.Request, defaultRangeQueryStep time.Duration, rangeSeconds int64) (time.Duration, *api.ApiError) {
 	// Overwrite the cli flag when provided as a query parameter.
 	if val := r.FormValue(Step); val != "" {
@@ -296,18 +446,79 @@ func (qapi *QueryAPI) parseStep(r *http.Request, defaultRangeQueryStep time.Dura
 	return d, nil
 }
 
+// parseQueryParam returns the query, with calendar functions shifted to the time zone given by the timezone parameter, if any,
+// for evaluation times between start and end.
+func (qapi *QueryAPI) parseQueryParam(r *http.Request, start, end time.Time) (string, *api.ApiError) {
+	q := r.FormValue("query")
+
+	tz := r.FormValue(TimezoneParam)
+	if tz == "" {
+		return q, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "'%s' parameter", TimezoneParam)}
+	}
+	q, err = query.ShiftCalendarFunctions(q, loc, start, end)
+	if err != nil {
+		return "", &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	return q, nil
+}
+
+// pushDownRangeFunctions rewrites the range functions of the query stores can evaluate, if query pushdown is enabled.
+func (qapi *QueryAPI) pushDownRangeFunctions(q string, step time.Duration) string {
+	if !qapi.enableQueryPushdown {
+		return q
+	}
+	return query.PushDownRangeFunctions(q, step)
+}
+
 func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiError) {
 	ts, err := parseTimeParam(r, "time", qapi.baseAPI.Now())
 	if err != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 	}
 
+	nanPolicy, apiErr := qapi.parseNaNPolicyParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	res, apiErr := qapi.execInstantQueries(r, "promql_instant_query", []time.Time{ts})
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if err := query.CheckResponseSize(res.values[0], qapi.maxResponseBytes); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorTooLarge, Err: err}
+	}
+	value := query.ApplyNaNPolicy(res.values[0], nanPolicy)
+	return &queryData{
+		ResultType:   value.Type(),
+		Result:       value,
+		Stats:        res.stats[0],
+		FailedStores: res.failedStores,
+	}, res.warnings, nil
+}
+
+// instantQueryResults are the results of the evaluations of an instant query by execInstantQueries.
+type instantQueryResults struct {
+	// values and stats are in the order of the evaluation times. Stats are only set if the stats parameter is given.
+	values       []parser.Value
+	stats        []*stats.QueryStats
+	warnings     []error
+	failedStores []store.FailedStore
+}
+
+// execInstantQueries parses the parameters of instant queries and evaluates the query at each of the given times,
+// under a single query gate slot. Results are filtered by the result matchers, if any.
+func (qapi *QueryAPI) execInstantQueries(r *http.Request, spanName string, times []time.Time) (*instantQueryResults, *api.ApiError) {
 	ctx := r.Context()
 	if to := r.FormValue("timeout"); to != "" {
 		var cancel context.CancelFunc
 		timeout, err := parseDuration(to)
 		if err != nil {
-			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
 		}
 
 		ctx, cancel = context.WithTimeout(ctx, timeout)
@@ -316,72 +527,231 @@ func (qapi *QueryAPI) query(r *http.Request) (interface{}, []error, *api.ApiErro
 
 	enableDedup, apiErr := qapi.parseEnableDedupParam(r)
 	if apiErr != nil {
-		return nil, nil, apiErr
+		return nil, apiErr
 	}
 
 	replicaLabels, apiErr := qapi.parseReplicaLabelsParam(r)
 	if apiErr != nil {
-		return nil, nil, apiErr
+		return nil, apiErr
 	}
 
 	storeDebugMatchers, apiErr := qapi.parseStoreDebugMatchersParam(r)
 	if apiErr != nil {
-		return nil, nil, apiErr
+		return nil, apiErr
+	}
+
+	noCache, apiErr := qapi.parseNoCacheParam(r)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if noCache {
+		ctx = context.WithValue(ctx, store.NoCacheKey, true)
 	}
 
 	enablePartialResponse, apiErr := qapi.parsePartialResponseParam(r, qapi.enableQueryPartialResponse)
 	if apiErr != nil {
-		return nil, nil, apiErr
+		return nil, apiErr
 	}
 
 	maxSourceResolution, apiErr := qapi.parseDownsamplingParamMillis(r, qapi.defaultInstantQueryMaxSourceResolution)
 	if apiErr != nil {
-		return nil, nil, apiErr
+		return nil, apiErr
+	}
+
+	resultMatchers, apiErr := qapi.parseResultMatchersParam(r)
+	if apiErr != nil {
+		return nil, apiErr
 	}
 
 	qe := qapi.queryEngine(maxSourceResolution)
 
 	// We are starting promQL tracing span here, because we have no control over promQL code.
-	span, ctx := tracing.StartSpan(ctx, "promql_instant_query")
+	span, ctx := tracing.StartSpan(ctx, spanName)
 	defer span.Finish()
 
-	qry, err := qe.NewInstantQuery(qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, qapi.enableQueryPushdown, false), r.FormValue("query"), ts)
-	if err != nil {
-		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	qrys := make([]promql.Query, 0, len(times))
+	for _, ts := range times {
+		// Calendar functions are shifted for each time, as the time zone offset can differ between them.
+		queryStr, apiErr := qapi.parseQueryParam(r, ts, ts)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+
+		qry, err := qe.NewInstantQuery(qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, qapi.enableQueryPushdown, false), qapi.pushDownRangeFunctions(queryStr, 0), ts)
+		if err != nil {
+			return nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+		}
+		defer qry.Close()
+		qrys = append(qrys, qry)
 	}
-	defer qry.Close()
 
+	var err error
 	tracing.DoInSpan(ctx, "query_gate_ismyturn", func(ctx context.Context) {
 		err = qapi.gate.Start(ctx)
 	})
 	if err != nil {
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
+		return nil, &api.ApiError{Typ: api.ErrorExec, Err: err}
 	}
 	defer qapi.gate.Done()
 
-	res := qry.Exec(ctx)
-	if res.Err != nil {
-		switch res.Err.(type) {
-		case promql.ErrQueryCanceled:
-			return nil, nil, &api.ApiError{Typ: api.ErrorCanceled, Err: res.Err}
-		case promql.ErrQueryTimeout:
-			return nil, nil, &api.ApiError{Typ: api.ErrorTimeout, Err: res.Err}
-		case promql.ErrStorage:
-			return nil, nil, &api.ApiError{Typ: api.ErrorInternal, Err: res.Err}
+	var tracker *store.PartialResponseTracker
+	if enablePartialResponse {
+		tracker = store.NewPartialResponseTracker()
+		ctx = context.WithValue(ctx, store.PartialResponseTrackerKey, tracker)
+	}
+
+	results := &instantQueryResults{
+		values: make([]parser.Value, 0, len(qrys)),
+		stats:  make([]*stats.QueryStats, 0, len(qrys)),
+	}
+	for _, qry := range qrys {
+		res := qry.Exec(ctx)
+		if res.Err != nil {
+			switch res.Err.(type) {
+			case promql.ErrQueryCanceled:
+				return nil, &api.ApiError{Typ: api.ErrorCanceled, Err: res.Err}
+			case promql.ErrQueryTimeout:
+				return nil, &api.ApiError{Typ: api.ErrorTimeout, Err: res.Err}
+			case promql.ErrStorage:
+				return nil, &api.ApiError{Typ: api.ErrorInternal, Err: res.Err}
+			}
+			return nil, &api.ApiError{Typ: api.ErrorExec, Err: res.Err}
 		}
-		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: res.Err}
+		results.warnings = append(results.warnings, res.Warnings...)
+		results.values = append(results.values, query.FilterResult(res.Value, resultMatchers))
+
+		// Optional stats field in response if parameter "stats" is not empty.
+		var qs *stats.QueryStats
+		if r.FormValue(Stats) != "" {
+			qs = stats.NewQueryStats(qry.Stats())
+		}
+		results.stats = append(results.stats, qs)
 	}
+	results.failedStores = failedStores(tracker)
+	return results, nil
+}
 
-	// Optional stats field in response if parameter "stats" is not empty.
-	var qs *stats.QueryStats
-	if r.FormValue(Stats) != "" {
-		qs = stats.NewQueryStats(qry.Stats())
+// failedStores returns stores recorded by the tracker, or nil if partial response was not enabled.
+func failedStores(tracker *store.PartialResponseTracker) []store.FailedStore {
+	if tracker == nil {
+		return nil
 	}
-	return &queryData{
-		ResultType: res.Value.Type(),
-		Result:     res.Value,
-		Stats:      qs,
-	}, res.Warnings, nil
+	return tracker.FailedStores()
+}
+
+type multiInstantQueryData struct {
+	ResultType parser.ValueType          `json:"resultType"`
+	Results    []multiInstantQueryResult `json:"results"`
+	// FailedStores lists stores which failed to return data, when the query was served with partial response.
+	FailedStores []store.FailedStore `json:"failedStores,omitempty"`
+}
+
+type multiInstantQueryResult struct {
+	Time   model.Time   `json:"time"`
+	Result parser.Value `json:"result"`
+}
+
+// queryMultiInstant evaluates the instant query at each of the given times, in one request, e.g. to compare sparse
+// points in time without a range query over the whole time range.
+func (qapi *QueryAPI) queryMultiInstant(r *http.Request) (interface{}, []error, *api.ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrap(err, "parse form")}
+	}
+	if len(r.Form[TimesParam]) == 0 {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("no '%s' parameter given", TimesParam)}
+	}
+	if len(r.Form[TimesParam]) > qapi.maxMultiInstantTimes {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("%d evaluation times given, exceeding the limit of %d", len(r.Form[TimesParam]), qapi.maxMultiInstantTimes)}
+	}
+	times := make([]time.Time, 0, len(r.Form[TimesParam]))
+	for _, t := range r.Form[TimesParam] {
+		ts, err := parseTime(t)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "Invalid time value for '%s'", TimesParam)}
+		}
+		times = append(times, ts)
+	}
+
+	nanPolicy, apiErr := qapi.parseNaNPolicyParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	res, apiErr := qapi.execInstantQueries(r, "promql_multi_instant_query", times)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if err := query.CheckResponsesSize(res.values, qapi.maxResponseBytes); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorTooLarge, Err: err}
+	}
+	data := &multiInstantQueryData{
+		Results:      make([]multiInstantQueryResult, 0, len(res.values)),
+		FailedStores: res.failedStores,
+	}
+	for i, v := range res.values {
+		data.ResultType = v.Type()
+		data.Results = append(data.Results, multiInstantQueryResult{
+			Time:   model.TimeFromUnixNano(times[i].UnixNano()),
+			Result: query.ApplyNaNPolicy(v, nanPolicy),
+		})
+	}
+	return data, res.warnings, nil
+}
+
+type offsetDiffQueryData struct {
+	ResultType parser.ValueType `json:"resultType"`
+	// Result has the difference of the series present at both offsets.
+	Result promql.Vector `json:"result"`
+	// OnlyCurrent and OnlyBase have the series present at only one of the offsets, with their value at that offset.
+	OnlyCurrent promql.Vector `json:"onlyCurrent"`
+	OnlyBase    promql.Vector `json:"onlyBase"`
+	// FailedStores lists stores which failed to return data, when the query was served with partial response.
+	FailedStores []store.FailedStore `json:"failedStores,omitempty"`
+}
+
+// queryOffsetDiff evaluates the instant query at the time shifted by two offsets and returns the difference between
+// the results per series, e.g. to compare the current value of series with their value a week ago in one request.
+func (qapi *QueryAPI) queryOffsetDiff(r *http.Request) (interface{}, []error, *api.ApiError) {
+	ts, err := parseTimeParam(r, "time", qapi.baseAPI.Now())
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+
+	var offset time.Duration
+	if val := r.FormValue(OffsetParam); val != "" {
+		offset, err = parseDuration(val)
+		if err != nil {
+			return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "Invalid duration value for '%s'", OffsetParam)}
+		}
+	}
+	if r.FormValue(BaseOffsetParam) == "" {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Errorf("no '%s' parameter given", BaseOffsetParam)}
+	}
+	baseOffset, err := parseDuration(r.FormValue(BaseOffsetParam))
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: errors.Wrapf(err, "Invalid duration value for '%s'", BaseOffsetParam)}
+	}
+
+	// The current evaluation comes first, the base evaluation second.
+	res, apiErr := qapi.execInstantQueries(r, "promql_offset_diff_query", []time.Time{ts.Add(-offset), ts.Add(-baseOffset)})
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	diff, err := query.DiffResults(res.values[0], res.values[1])
+	if err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+	}
+	if err := query.CheckResponsesSize([]parser.Value{diff.Diff, diff.OnlyCurrent, diff.OnlyBase}, qapi.maxResponseBytes); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorTooLarge, Err: err}
+	}
+	return &offsetDiffQueryData{
+		ResultType:   parser.ValueTypeVector,
+		Result:       diff.Diff,
+		OnlyCurrent:  diff.OnlyCurrent,
+		OnlyBase:     diff.OnlyBase,
+		FailedStores: res.failedStores,
+	}, res.warnings, nil
 }
 
 func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.ApiError) {
@@ -442,6 +812,14 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
+	noCache, apiErr := qapi.parseNoCacheParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if noCache {
+		ctx = context.WithValue(ctx, store.NoCacheKey, true)
+	}
+
 	// If no max_source_resolution is specified fit at least 5 samples between steps.
 	maxSourceResolution, apiErr := qapi.parseDownsamplingParamMillis(r, step/5)
 	if apiErr != nil {
@@ -453,6 +831,37 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 		return nil, nil, apiErr
 	}
 
+	queryStr, apiErr := qapi.parseQueryParam(r, start, end)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	resultMatchers, apiErr := qapi.parseResultMatchersParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	nanPolicy, apiErr := qapi.parseNaNPolicyParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	// Queries are evaluated at start, start+step, ... up to end. With an exclusive end, an evaluation point
+	// falling exactly on end is dropped, and a query whose only evaluation point is end has no result.
+	endInclusive, apiErr := qapi.parseEndInclusiveParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	if !endInclusive && end.Sub(start)%step == 0 {
+		if end.Equal(start) {
+			if _, err := parser.ParseExpr(queryStr); err != nil {
+				return nil, nil, &api.ApiError{Typ: api.ErrorBadData, Err: err}
+			}
+			return &queryData{ResultType: parser.ValueTypeMatrix, Result: promql.Matrix{}}, nil, nil
+		}
+		end = end.Add(-step)
+	}
+
 	qe := qapi.queryEngine(maxSourceResolution)
 
 	// Record the query range requested.
@@ -464,7 +873,7 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 
 	qry, err := qe.NewRangeQuery(
 		qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, maxSourceResolution, enablePartialResponse, qapi.enableQueryPushdown, false),
-		r.FormValue("query"),
+		qapi.pushDownRangeFunctions(queryStr, step),
 		start,
 		end,
 		step,
@@ -482,6 +891,12 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	}
 	defer qapi.gate.Done()
 
+	var tracker *store.PartialResponseTracker
+	if enablePartialResponse {
+		tracker = store.NewPartialResponseTracker()
+		ctx = context.WithValue(ctx, store.PartialResponseTrackerKey, tracker)
+	}
+
 	res := qry.Exec(ctx)
 	if res.Err != nil {
 		switch res.Err.(type) {
@@ -498,10 +913,16 @@ func (qapi *QueryAPI) queryRange(r *http.Request) (interface{}, []error, *api.Ap
 	if r.FormValue(Stats) != "" {
 		qs = stats.NewQueryStats(qry.Stats())
 	}
+	res.Value = query.FilterResult(res.Value, resultMatchers)
+	if err := query.CheckResponseSize(res.Value, qapi.maxResponseBytes); err != nil {
+		return nil, nil, &api.ApiError{Typ: api.ErrorTooLarge, Err: err}
+	}
+	res.Value = query.ApplyNaNPolicy(res.Value, nanPolicy)
 	return &queryData{
-		ResultType: res.Value.Type(),
-		Result:     res.Value,
-		Stats:      qs,
+		ResultType:   res.Value.Type(),
+		Result:       res.Value,
+		Stats:        qs,
+		FailedStores: failedStores(tracker),
 	}, res.Warnings, nil
 }
 
@@ -624,6 +1045,12 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		return nil, nil, apiErr
 	}
 
+	// 0 means no limit.
+	limit, apiErr := qapi.parseLimitParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	q, err := qapi.queryableCreate(enableDedup, replicaLabels, storeDebugMatchers, math.MaxInt64, enablePartialResponse, qapi.enableQueryPushdown, true).
 		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
@@ -639,14 +1066,25 @@ func (qapi *QueryAPI) series(r *http.Request) (interface{}, []error, *api.ApiErr
 		sets = append(sets, q.Select(false, nil, mset...))
 	}
 
+	// The limit is applied on the merged set, so after deduplication and on unique series across all matchers.
 	set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+	var truncated bool
 	for set.Next() {
+		if limit > 0 && len(metrics) == limit {
+			truncated = true
+			break
+		}
 		metrics = append(metrics, set.At().Labels())
 	}
 	if set.Err() != nil {
 		return nil, nil, &api.ApiError{Typ: api.ErrorExec, Err: set.Err()}
 	}
-	return metrics, set.Warnings(), nil
+
+	warnings := set.Warnings()
+	if truncated {
+		warnings = append(warnings, errSeriesLimitReached)
+	}
+	return metrics, warnings, nil
 }
 
 func (qapi *QueryAPI) labelNames(r *http.Request) (interface{}, []error, *api.ApiError) {
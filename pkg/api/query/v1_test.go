@@ -25,6 +25,7 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
@@ -32,6 +33,8 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
@@ -45,12 +48,15 @@ import (
 	"github.com/prometheus/prometheus/tsdb/tsdbutil"
 	promgate "github.com/prometheus/prometheus/util/gate"
 	"github.com/prometheus/prometheus/util/stats"
+	"google.golang.org/grpc"
 
 	"github.com/thanos-io/thanos/pkg/compact"
 
 	baseAPI "github.com/thanos-io/thanos/pkg/api"
 	"github.com/thanos-io/thanos/pkg/component"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/logging"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/rules/rulespb"
 	"github.com/thanos-io/thanos/pkg/store"
@@ -191,7 +197,7 @@ func TestQueryEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -247,6 +253,114 @@ func TestQueryEndpoints(t *testing.T) {
 				},
 			},
 		},
+		// Query endpoint with calendar functions evaluated in a time zone.
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":    []string{"hour()"},
+				"time":     []string{"1970-01-01T10:30:00Z"},
+				"timezone": []string{"Asia/Kolkata"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeVector,
+				Result: promql.Vector{
+					{
+						Metric: labels.Labels{},
+						Point: promql.Point{
+							T: timestamp.FromTime(start.Add(10*time.Hour + 30*time.Minute)),
+							V: 16,
+						},
+					},
+				},
+			},
+		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":    []string{"hour()"},
+				"time":     []string{"1970-01-01T10:30:00Z"},
+				"timezone": []string{"Mars/Olympus_Mons"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Query endpoint with the aggregation result filtered by a label kept by the aggregation.
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":          []string{`sum by (foo) ({__name__=~"test_metric1|test_metric2"})`},
+				"time":           []string{"1970-01-01T00:02:03Z"},
+				"result_match[]": []string{`{foo="boo"}`},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeVector,
+				Result: promql.Vector{
+					{
+						Metric: labels.FromStrings("foo", "boo"),
+						Point:  promql.Point{T: timestamp.FromTime(start.Add(123 * time.Second)), V: 4},
+					},
+				},
+			},
+		},
+		// Labels dropped by the aggregation only match empty values.
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":          []string{`sum by (foo) ({__name__=~"test_metric1|test_metric2"})`},
+				"time":           []string{"1970-01-01T00:02:03Z"},
+				"result_match[]": []string{`{__name__="test_metric2"}`},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeVector,
+				Result:     promql.Vector{},
+			},
+		},
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query":          []string{`sum by (foo) ({__name__=~"test_metric1|test_metric2"})`},
+				"start":          []string{"120"},
+				"end":            []string{"180"},
+				"step":           []string{"60"},
+				"result_match[]": []string{`{foo="nonexistent"}`, `{foo="bar"}`},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeMatrix,
+				Result: promql.Matrix{
+					{
+						Metric: labels.FromStrings("foo", "bar"),
+						Points: []promql.Point{{T: 120000, V: 2}, {T: 180000, V: 3}},
+					},
+				},
+			},
+		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":          []string{"test_metric1"},
+				"result_match[]": []string{`{foo=}`},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":      []string{"vector(0) / 0"},
+				"time":       []string{"123.4"},
+				"nan_policy": []string{"drop"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeVector,
+				Result:     promql.Vector{},
+			},
+		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":      []string{"test_metric1"},
+				"nan_policy": []string{"zero"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
 		// Query endpoint without deduplication.
 		{
 			endpoint: api.query,
@@ -453,190 +567,954 @@ func TestQueryEndpoints(t *testing.T) {
 			},
 		},
 		{
-			endpoint: api.query,
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"0.333"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeScalar,
+				Result: promql.Scalar{
+					V: 0.333,
+					T: timestamp.FromTime(now),
+				},
+			},
+		},
+		// Bad dedup parameter.
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"0.333"},
+				"dedup": []string{"sdfsf"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"0"},
+				"end":   []string{"500"},
+				"step":  []string{"1"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeMatrix,
+				Result: promql.Matrix{
+					promql.Series{
+						Points: func(end, step float64) []promql.Point {
+							var res []promql.Point
+							for v := float64(0); v <= end; v += step {
+								res = append(res, promql.Point{V: v, T: timestamp.FromTime(start.Add(time.Duration(v) * time.Second))})
+							}
+							return res
+						}(500, 1),
+						Metric: nil,
+					},
+				},
+			},
+		},
+		// Use default step when missing.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"0"},
+				"end":   []string{"2"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeMatrix,
+				Result: promql.Matrix{
+					promql.Series{
+						Points: []promql.Point{
+							{V: 0, T: timestamp.FromTime(start)},
+							{V: 1, T: timestamp.FromTime(start.Add(1 * time.Second))},
+							{V: 2, T: timestamp.FromTime(start.Add(2 * time.Second))},
+						},
+						Metric: nil,
+					},
+				},
+			},
+		},
+		// Derive the default step from the range when it is longer than 250 default steps.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"0"},
+				"end":   []string{"5000"},
+			},
+			response: &queryData{
+				ResultType: parser.ValueTypeMatrix,
+				Result: promql.Matrix{
+					promql.Series{
+						Points: func(end, step float64) []promql.Point {
+							var res []promql.Point
+							for v := float64(0); v <= end; v += step {
+								res = append(res, promql.Point{V: v, T: timestamp.FromTime(start.Add(time.Duration(v) * time.Second))})
+							}
+							return res
+						}(5000, 20),
+						Metric: nil,
+					},
+				},
+			},
+		},
+		// Missing query params in range queries.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"end":   []string{"2"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"0"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Bad query expression.
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"invalid][query"},
+				"time":  []string{"1970-01-01T01:02:03+01:00"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"invalid][query"},
+				"start": []string{"0"},
+				"end":   []string{"100"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Invalid step.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"1"},
+				"end":   []string{"2"},
+				"step":  []string{"0"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Start after end.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"2"},
+				"end":   []string{"1"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Start overflows int64 internally.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"148966367200.372"},
+				"end":   []string{"1489667272.372"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+		// Bad dedup parameter.
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"time()"},
+				"start": []string{"0"},
+				"end":   []string{"2"},
+				"step":  []string{"1"},
+				"dedup": []string{"sdfsf-range"},
+			},
+			errType: baseAPI.ErrorBadData,
+		},
+	}
+
+	for i, test := range tests {
+		if ok := testEndpoint(t, test, fmt.Sprintf("#%d %s", i, test.query.Encode()), reflect.DeepEqual); !ok {
+			return
+		}
+	}
+
+	tests = []endpointTestCase{
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"2"},
+				"time":  []string{"123.4"},
+			},
+			response: &queryData{},
+		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"2"},
+				"time":  []string{"123.4"},
+				"stats": []string{"true"},
+			},
+			response: &queryData{
+				Stats: &stats.QueryStats{},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		if ok := testEndpoint(t, test, fmt.Sprintf("#%d %s", i, test.query.Encode()), lookupStats); !ok {
+			return
+		}
+	}
+}
+
+// storeClient is a store.Client backed by the given StoreClient.
+type storeClient struct {
+	storepb.StoreClient
+
+	addr       string
+	labelSets  []labels.Labels
+	mint, maxt int64
+}
+
+func (c *storeClient) LabelSets() []labels.Labels          { return c.labelSets }
+func (c *storeClient) TimeRange() (mint int64, maxt int64) { return c.mint, c.maxt }
+func (c *storeClient) String() string                      { return c.addr }
+func (c *storeClient) Addr() string                        { return c.addr }
+
+// failingStoreClient fails every Series call.
+type failingStoreClient struct {
+	storepb.StoreClient
+}
+
+func (failingStoreClient) Series(context.Context, *storepb.SeriesRequest, ...grpc.CallOption) (storepb.Store_SeriesClient, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestQueryEndpoints_FailedStores(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "test_metric1", "foo", "bar"), i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	stores := []store.Client{
+		&storeClient{
+			StoreClient: storepb.ServerAsClient(store.NewTSDBStore(nil, db, component.Query, nil), 0),
+			addr:        "healthy:10901",
+			mint:        math.MinInt64,
+			maxt:        math.MaxInt64,
+		},
+		&storeClient{
+			StoreClient: failingStoreClient{},
+			addr:        "failing:10901",
+			labelSets:   []labels.Labels{labels.FromStrings("cluster", "eu")},
+			mint:        0,
+			maxt:        math.MaxInt64,
+		},
+	}
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	proxy := store.NewProxyStore(nil, nil, func() []store.Client { return stores }, component.Query, nil, 0)
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, proxy, 2, timeout, query.QueryableOptions{}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate:                  gate.New(nil, 4),
+		defaultRangeQueryStep: time.Second,
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	expected := []store.FailedStore{{
+		Name:      "failing:10901",
+		Addr:      "failing:10901",
+		LabelSets: []labels.Labels{labels.FromStrings("cluster", "eu")},
+		MinTime:   0,
+		MaxTime:   math.MaxInt64,
+		Error:     "fetch series for {cluster=\"eu\"} failing:10901: store unavailable",
+	}}
+
+	for _, tc := range []struct {
+		name     string
+		endpoint baseAPI.ApiFunc
+		query    url.Values
+	}{
+		{
+			name:     "instant query",
+			endpoint: api.query,
+			query: url.Values{
+				"query":            []string{"test_metric1"},
+				"time":             []string{"300"},
+				"partial_response": []string{"true"},
+			},
+		},
+		{
+			name:     "range query",
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query":            []string{"test_metric1"},
+				"start":            []string{"0"},
+				"end":              []string{"300"},
+				"step":             []string{"60"},
+				"partial_response": []string{"true"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
+
+			resp, warnings, apiErr := tc.endpoint(req)
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			testutil.Equals(t, 1, len(warnings))
+
+			data := resp.(*queryData)
+			testutil.Assert(t, data.Result.String() != "", "expected data from the healthy store")
+			testutil.Equals(t, expected, data.FailedStores)
+		})
+	}
+}
+
+func TestQueryEndpoints_MaxResponseBytes(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 1000; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "test_metric1", "foo", "bar"), i*1000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate:                  gate.New(nil, 4),
+		defaultRangeQueryStep: time.Second,
+		maxResponseBytes:      1024,
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		endpoint baseAPI.ApiFunc
+		query    url.Values
+		errType  baseAPI.ErrorType
+	}{
+		{
+			name:     "instant query within limit",
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{"test_metric1"},
+				"time":  []string{"500"},
+			},
+		},
+		{
+			name:     "range query within limit",
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"test_metric1"},
+				"start": []string{"0"},
+				"end":   []string{"10"},
+				"step":  []string{"1"},
+			},
+		},
+		{
+			name:     "range query above limit",
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query": []string{"test_metric1"},
+				"start": []string{"0"},
+				"end":   []string{"999"},
+				"step":  []string{"1"},
+			},
+			errType: baseAPI.ErrorTooLarge,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
+
+			resp, _, apiErr := tc.endpoint(req)
+			if tc.errType != baseAPI.ErrorNone {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				testutil.Assert(t, errors.Is(apiErr.Err, query.ErrResponseTooLarge), "unexpected error: %v", apiErr.Err)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			testutil.Assert(t, resp.(*queryData).Result.String() != "", "expected data")
+		})
+	}
+}
+
+func TestQueryEndpoints_MaxMatchersPerSelector(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "test_metric1", "foo", "bar"), 0, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{MaxMatchersPerSelector: 2}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate:                  gate.New(nil, 4),
+		defaultRangeQueryStep: time.Second,
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		endpoint baseAPI.ApiFunc
+		query    url.Values
+		errType  baseAPI.ErrorType
+	}{
+		{
+			name:     "query within limit",
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{`test_metric1{foo="bar"}`},
+				"time":  []string{"0"},
+			},
+		},
+		{
+			name:     "query above limit",
+			endpoint: api.query,
+			query: url.Values{
+				"query": []string{`test_metric1{foo="bar",a!="1"}`},
+				"time":  []string{"0"},
+			},
+			errType: baseAPI.ErrorExec,
+		},
+		{
+			name:     "series above limit",
+			endpoint: api.series,
+			query: url.Values{
+				"match[]": []string{`test_metric1{foo="bar",a!="1"}`},
+			},
+			errType: baseAPI.ErrorExec,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
+
+			_, _, apiErr := tc.endpoint(req)
+			if tc.errType != baseAPI.ErrorNone {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				testutil.Assert(t, errors.Is(apiErr.Err, query.ErrTooManyMatchers), "unexpected error: %v", apiErr.Err)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+		})
+	}
+}
+
+func TestQueryRangeEndInclusive(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	for i := int64(0); i <= 10; i++ {
+		_, err := app.Append(0, labels.FromStrings("__name__", "test_metric1", "foo", "bar"), i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate:                  gate.New(nil, 4),
+		defaultRangeQueryStep: time.Second,
+		queryRangeHist: promauto.With(prometheus.NewRegistry()).NewHistogram(prometheus.HistogramOpts{
+			Name: "query_range_hist",
+		}),
+	}
+
+	for _, tc := range []struct {
+		name         string
+		start, end   string
+		endInclusive string
+		expected     []promql.Point
+		errType      baseAPI.ErrorType
+	}{
+		{
+			name:     "inclusive by default",
+			start:    "0",
+			end:      "300",
+			expected: []promql.Point{{T: 0, V: 0}, {T: 60000, V: 1}, {T: 120000, V: 2}, {T: 180000, V: 3}, {T: 240000, V: 4}, {T: 300000, V: 5}},
+		},
+		{
+			name:         "inclusive",
+			start:        "0",
+			end:          "300",
+			endInclusive: "true",
+			expected:     []promql.Point{{T: 0, V: 0}, {T: 60000, V: 1}, {T: 120000, V: 2}, {T: 180000, V: 3}, {T: 240000, V: 4}, {T: 300000, V: 5}},
+		},
+		{
+			name:         "exclusive drops the evaluation point at end",
+			start:        "0",
+			end:          "300",
+			endInclusive: "false",
+			expected:     []promql.Point{{T: 0, V: 0}, {T: 60000, V: 1}, {T: 120000, V: 2}, {T: 180000, V: 3}, {T: 240000, V: 4}},
+		},
+		{
+			name:         "exclusive keeps the last evaluation point before end",
+			start:        "0",
+			end:          "330",
+			endInclusive: "false",
+			expected:     []promql.Point{{T: 0, V: 0}, {T: 60000, V: 1}, {T: 120000, V: 2}, {T: 180000, V: 3}, {T: 240000, V: 4}, {T: 300000, V: 5}},
+		},
+		{
+			name:         "exclusive with start equal to end",
+			start:        "300",
+			end:          "300",
+			endInclusive: "false",
+		},
+		{
+			name:         "invalid",
+			start:        "0",
+			end:          "300",
+			endInclusive: "maybe",
+			errType:      baseAPI.ErrorBadData,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := url.Values{
+				"query": []string{"test_metric1"},
+				"start": []string{tc.start},
+				"end":   []string{tc.end},
+				"step":  []string{"60"},
+			}
+			if tc.endInclusive != "" {
+				q.Set(EndInclusiveParam, tc.endInclusive)
+			}
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+q.Encode(), nil)
+			testutil.Ok(t, err)
+
+			resp, _, apiErr := api.queryRange(req)
+			if tc.errType != baseAPI.ErrorNone {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+
+			res := resp.(*queryData).Result.(promql.Matrix)
+			if tc.expected == nil {
+				testutil.Equals(t, 0, len(res))
+				return
+			}
+			testutil.Equals(t, 1, len(res))
+			testutil.Equals(t, tc.expected, res[0].Points)
+		})
+	}
+}
+
+func TestQueryEndpoints_MultiInstant(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	lset := labels.FromStrings("__name__", "test_metric1", "foo", "bar")
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, lset, i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate:                 gate.New(nil, 4),
+		maxMultiInstantTimes: 3,
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    url.Values
+		response *multiInstantQueryData
+		errType  baseAPI.ErrorType
+	}{
+		{
+			name: "one result per time",
 			query: url.Values{
-				"query": []string{"0.333"},
+				"query":  []string{"test_metric1"},
+				"time[]": []string{"0", "1970-01-01T00:02:00Z", "300"},
 			},
-			response: &queryData{
-				ResultType: parser.ValueTypeScalar,
-				Result: promql.Scalar{
-					V: 0.333,
-					T: timestamp.FromTime(now),
+			response: &multiInstantQueryData{
+				ResultType: parser.ValueTypeVector,
+				Results: []multiInstantQueryResult{
+					{Time: 0, Result: promql.Vector{{Metric: lset, Point: promql.Point{T: 0, V: 0}}}},
+					{Time: 120000, Result: promql.Vector{{Metric: lset, Point: promql.Point{T: 120000, V: 2}}}},
+					{Time: 300000, Result: promql.Vector{{Metric: lset, Point: promql.Point{T: 300000, V: 5}}}},
 				},
 			},
 		},
-		// Bad dedup parameter.
-		{
-			endpoint: api.query,
-			query: url.Values{
-				"query": []string{"0.333"},
-				"dedup": []string{"sdfsf"},
-			},
-			errType: baseAPI.ErrorBadData,
-		},
 		{
-			endpoint: api.queryRange,
+			name: "empty results are kept",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"0"},
-				"end":   []string{"500"},
-				"step":  []string{"1"},
+				"query":  []string{"test_metric1"},
+				"time[]": []string{"60", "3600"},
 			},
-			response: &queryData{
-				ResultType: parser.ValueTypeMatrix,
-				Result: promql.Matrix{
-					promql.Series{
-						Points: func(end, step float64) []promql.Point {
-							var res []promql.Point
-							for v := float64(0); v <= end; v += step {
-								res = append(res, promql.Point{V: v, T: timestamp.FromTime(start.Add(time.Duration(v) * time.Second))})
-							}
-							return res
-						}(500, 1),
-						Metric: nil,
-					},
+			response: &multiInstantQueryData{
+				ResultType: parser.ValueTypeVector,
+				Results: []multiInstantQueryResult{
+					{Time: 60000, Result: promql.Vector{{Metric: lset, Point: promql.Point{T: 60000, V: 1}}}},
+					{Time: 3600000, Result: promql.Vector{}},
 				},
 			},
 		},
-		// Use default step when missing.
 		{
-			endpoint: api.queryRange,
+			name: "too many times",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"0"},
-				"end":   []string{"2"},
-			},
-			response: &queryData{
-				ResultType: parser.ValueTypeMatrix,
-				Result: promql.Matrix{
-					promql.Series{
-						Points: []promql.Point{
-							{V: 0, T: timestamp.FromTime(start)},
-							{V: 1, T: timestamp.FromTime(start.Add(1 * time.Second))},
-							{V: 2, T: timestamp.FromTime(start.Add(2 * time.Second))},
-						},
-						Metric: nil,
-					},
-				},
+				"query":  []string{"test_metric1"},
+				"time[]": []string{"0", "60", "120", "180"},
 			},
+			errType: baseAPI.ErrorBadData,
 		},
-		// Missing query params in range queries.
 		{
-			endpoint: api.queryRange,
+			name: "no times",
 			query: url.Values{
-				"query": []string{"time()"},
-				"end":   []string{"2"},
-				"step":  []string{"1"},
+				"query": []string{"test_metric1"},
 			},
 			errType: baseAPI.ErrorBadData,
 		},
 		{
-			endpoint: api.queryRange,
+			name: "invalid time",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"0"},
-				"step":  []string{"1"},
+				"query":  []string{"test_metric1"},
+				"time[]": []string{"0", "yesterday"},
 			},
 			errType: baseAPI.ErrorBadData,
 		},
-		// Bad query expression.
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
+
+			resp, _, apiErr := api.queryMultiInstant(req)
+			if tc.errType != baseAPI.ErrorNone {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			testutil.Equals(t, tc.response, resp)
+		})
+	}
+}
+
+func TestQueryEndpoints_OffsetDiff(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	var (
+		kept    = labels.FromStrings("__name__", "test_metric1", "foo", "kept")
+		created = labels.FromStrings("__name__", "test_metric1", "foo", "created")
+		deleted = labels.FromStrings("__name__", "test_metric1", "foo", "deleted")
+	)
+	app := db.Appender(context.Background())
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Append(0, kept, i*60000, float64(i))
+		testutil.Ok(t, err)
+		if i >= 5 {
+			_, err := app.Append(0, created, i*60000, float64(10*i))
+			testutil.Ok(t, err)
+		}
+		if i < 2 {
+			_, err := app.Append(0, deleted, i*60000, float64(100*i))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	timeout := 100 * time.Second
+	qe := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 10000,
+		Timeout:    timeout,
+	})
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
+		queryEngine: func(int64) *promql.Engine {
+			return qe
+		},
+		gate: gate.New(nil, 4),
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    url.Values
+		response *offsetDiffQueryData
+		errType  baseAPI.ErrorType
+	}{
 		{
-			endpoint: api.query,
+			name: "series present at one offset only are returned separately",
 			query: url.Values{
-				"query": []string{"invalid][query"},
-				"time":  []string{"1970-01-01T01:02:03+01:00"},
+				"query":       []string{"test_metric1"},
+				"time":        []string{"540"},
+				"base_offset": []string{"5m"},
+			},
+			response: &offsetDiffQueryData{
+				ResultType:  parser.ValueTypeVector,
+				Result:      promql.Vector{{Metric: kept, Point: promql.Point{T: 540000, V: 5}}},
+				OnlyCurrent: promql.Vector{{Metric: created, Point: promql.Point{T: 540000, V: 90}}},
+				OnlyBase:    promql.Vector{{Metric: deleted, Point: promql.Point{T: 240000, V: 100}}},
 			},
-			errType: baseAPI.ErrorBadData,
 		},
 		{
-			endpoint: api.queryRange,
+			name: "both offsets",
 			query: url.Values{
-				"query": []string{"invalid][query"},
-				"start": []string{"0"},
-				"end":   []string{"100"},
-				"step":  []string{"1"},
+				"query":       []string{"test_metric1"},
+				"time":        []string{"600"},
+				"offset":      []string{"60"},
+				"base_offset": []string{"240"},
+			},
+			response: &offsetDiffQueryData{
+				ResultType: parser.ValueTypeVector,
+				Result: promql.Vector{
+					{Metric: kept, Point: promql.Point{T: 540000, V: 3}},
+					{Metric: created, Point: promql.Point{T: 540000, V: 30}},
+				},
+				OnlyCurrent: promql.Vector{},
+				OnlyBase:    promql.Vector{{Metric: deleted, Point: promql.Point{T: 360000, V: 100}}},
 			},
-			errType: baseAPI.ErrorBadData,
 		},
-		// Invalid step.
 		{
-			endpoint: api.queryRange,
+			name: "scalar",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"1"},
-				"end":   []string{"2"},
-				"step":  []string{"0"},
+				"query":       []string{"scalar(test_metric1{foo=\"kept\"})"},
+				"time":        []string{"540"},
+				"base_offset": []string{"5m"},
+			},
+			response: &offsetDiffQueryData{
+				ResultType:  parser.ValueTypeVector,
+				Result:      promql.Vector{{Point: promql.Point{T: 540000, V: 5}}},
+				OnlyCurrent: promql.Vector{},
+				OnlyBase:    promql.Vector{},
 			},
-			errType: baseAPI.ErrorBadData,
 		},
-		// Start after end.
 		{
-			endpoint: api.queryRange,
+			name: "no base offset",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"2"},
-				"end":   []string{"1"},
-				"step":  []string{"1"},
+				"query": []string{"test_metric1"},
 			},
 			errType: baseAPI.ErrorBadData,
 		},
-		// Start overflows int64 internally.
 		{
-			endpoint: api.queryRange,
+			name: "invalid offset",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"148966367200.372"},
-				"end":   []string{"1489667272.372"},
-				"step":  []string{"1"},
+				"query":       []string{"test_metric1"},
+				"offset":      []string{"a week"},
+				"base_offset": []string{"1w"},
 			},
 			errType: baseAPI.ErrorBadData,
 		},
-		// Bad dedup parameter.
 		{
-			endpoint: api.queryRange,
+			name: "string result",
 			query: url.Values{
-				"query": []string{"time()"},
-				"start": []string{"0"},
-				"end":   []string{"2"},
-				"step":  []string{"1"},
-				"dedup": []string{"sdfsf-range"},
+				"query":       []string{"\"foo\""},
+				"base_offset": []string{"1w"},
 			},
 			errType: baseAPI.ErrorBadData,
 		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
+
+			resp, _, apiErr := api.queryOffsetDiff(req)
+			if tc.errType != "" {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			testutil.Equals(t, tc.response, resp)
+		})
 	}
+}
 
-	for i, test := range tests {
-		if ok := testEndpoint(t, test, fmt.Sprintf("#%d %s", i, test.query.Encode()), reflect.DeepEqual); !ok {
-			return
-		}
+func TestSeriesEndpoint_Limit(t *testing.T) {
+	db, err := e2eutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender(context.Background())
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("__name__", "test_metric1", "foo", "bar", "replica", "a"),
+		labels.FromStrings("__name__", "test_metric1", "foo", "bar", "replica", "b"),
+		labels.FromStrings("__name__", "test_metric1", "foo", "boo", "replica", "a"),
+		labels.FromStrings("__name__", "test_metric1", "foo", "boo", "replica", "b"),
+		labels.FromStrings("__name__", "test_metric1", "foo", "zoo", "replica", "a"),
+	} {
+		_, err := app.Append(0, lset, 1000, 1)
+		testutil.Ok(t, err)
 	}
+	testutil.Ok(t, app.Commit())
 
-	tests = []endpointTestCase{
+	timeout := 100 * time.Second
+	api := &QueryAPI{
+		baseAPI: &baseAPI.BaseAPI{
+			Now: time.Now,
+		},
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
+		gate:            gate.New(nil, 4),
+		replicaLabels:   []string{"replica"},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		query     url.Values
+		response  []labels.Labels
+		truncated bool
+		errType   baseAPI.ErrorType
+	}{
 		{
-			endpoint: api.query,
-			query: url.Values{
-				"query": []string{"2"},
-				"time":  []string{"123.4"},
+			name:  "no limit",
+			query: url.Values{"match[]": []string{"test_metric1"}},
+			response: []labels.Labels{
+				labels.FromStrings("__name__", "test_metric1", "foo", "bar"),
+				labels.FromStrings("__name__", "test_metric1", "foo", "boo"),
+				labels.FromStrings("__name__", "test_metric1", "foo", "zoo"),
 			},
-			response: &queryData{},
 		},
 		{
-			endpoint: api.query,
-			query: url.Values{
-				"query": []string{"2"},
-				"time":  []string{"123.4"},
-				"stats": []string{"true"},
+			name:  "limit applied after deduplication",
+			query: url.Values{"match[]": []string{"test_metric1"}, "limit": []string{"2"}},
+			response: []labels.Labels{
+				labels.FromStrings("__name__", "test_metric1", "foo", "bar"),
+				labels.FromStrings("__name__", "test_metric1", "foo", "boo"),
 			},
-			response: &queryData{
-				Stats: &stats.QueryStats{},
+			truncated: true,
+		},
+		{
+			name:  "limit equal to number of series",
+			query: url.Values{"match[]": []string{"test_metric1"}, "limit": []string{"3"}},
+			response: []labels.Labels{
+				labels.FromStrings("__name__", "test_metric1", "foo", "bar"),
+				labels.FromStrings("__name__", "test_metric1", "foo", "boo"),
+				labels.FromStrings("__name__", "test_metric1", "foo", "zoo"),
 			},
 		},
-	}
+		{
+			name:  "limit applied on series merged across matchers",
+			query: url.Values{"match[]": []string{`test_metric1{foo="bar"}`, `test_metric1{foo=~"b.+"}`}, "limit": []string{"1"}},
+			response: []labels.Labels{
+				labels.FromStrings("__name__", "test_metric1", "foo", "bar"),
+			},
+			truncated: true,
+		},
+		{
+			name:    "negative limit",
+			query:   url.Values{"match[]": []string{"test_metric1"}, "limit": []string{"-1"}},
+			errType: baseAPI.ErrorBadData,
+		},
+		{
+			name:    "invalid limit",
+			query:   url.Values{"match[]": []string{"test_metric1"}, "limit": []string{"abc"}},
+			errType: baseAPI.ErrorBadData,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com?"+tc.query.Encode(), nil)
+			testutil.Ok(t, err)
 
-	for i, test := range tests {
-		if ok := testEndpoint(t, test, fmt.Sprintf("#%d %s", i, test.query.Encode()), lookupStats); !ok {
-			return
-		}
+			resp, warnings, apiErr := api.series(req)
+			if tc.errType != baseAPI.ErrorNone {
+				testutil.Assert(t, apiErr != nil, "expected error")
+				testutil.Equals(t, tc.errType, apiErr.Typ)
+				return
+			}
+			testutil.Assert(t, apiErr == nil, "unexpected error: %v", apiErr)
+			testutil.Equals(t, tc.response, resp)
+
+			if !tc.truncated {
+				testutil.Equals(t, 0, len(warnings))
+				return
+			}
+			testutil.Equals(t, []error{errSeriesLimitReached}, warnings)
+		})
 	}
 }
 
@@ -732,7 +1610,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -745,7 +1623,7 @@ func TestMetadataEndpoints(t *testing.T) {
 		baseAPI: &baseAPI.BaseAPI{
 			Now: func() time.Time { return now },
 		},
-		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout),
+		queryableCreate: query.NewQueryableCreator(nil, nil, store.NewTSDBStore(nil, db, component.Query, nil), 2, timeout, query.QueryableOptions{}),
 		queryEngine: func(int64) *promql.Engine {
 			return qe
 		},
@@ -1288,6 +2166,70 @@ func TestStoresEndpoint(t *testing.T) {
 	}
 }
 
+func TestQueryEndpoints_OpenMetrics(t *testing.T) {
+	vector := promql.Vector{
+		{Point: promql.Point{T: 1500, V: 1}, Metric: labels.FromStrings(labels.MetricName, "up", "job", `quote"back\slash`+"\nnewline")},
+		{Point: promql.Point{T: 2000, V: math.NaN()}, Metric: labels.FromStrings(labels.MetricName, "up", "job", "b")},
+		{Point: promql.Point{T: 2000, V: math.Inf(1)}, Metric: labels.FromStrings(labels.MetricName, "alerts", "severity", "critical")},
+		{Point: promql.Point{T: 2000, V: math.Inf(-1)}, Metric: labels.FromStrings("job", "c")},
+	}
+	matrix := promql.Matrix{{Metric: labels.FromStrings(labels.MetricName, "up"), Points: []promql.Point{{T: 1000, V: 1}}}}
+
+	for _, tcase := range []struct {
+		name        string
+		accept      string
+		result      parser.Value
+		contentType string
+		body        string
+	}{
+		{
+			name:        "vector in OpenMetrics",
+			accept:      "application/openmetrics-text; version=0.0.1,text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			result:      vector,
+			contentType: "application/openmetrics-text; version=0.0.1; charset=utf-8",
+			body: `# TYPE alerts unknown
+alerts{severity="critical"} +Inf 2.0
+# TYPE query_result unknown
+query_result{job="c"} -Inf 2.0
+# TYPE up unknown
+up{job="quote\"back\\slash\nnewline"} 1.0 1.5
+up{job="b"} NaN 2.0
+# EOF
+`,
+		},
+		{
+			name:        "vector without accepting OpenMetrics",
+			accept:      "application/json",
+			result:      vector[:1],
+			contentType: "application/json",
+		},
+		{
+			name:        "matrix can't be represented in OpenMetrics",
+			accept:      "application/openmetrics-text",
+			result:      matrix,
+			contentType: "application/json",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			instr := baseAPI.GetInstr(opentracing.NoopTracer{}, log.NewNopLogger(), extpromhttp.NewNopInstrumentationMiddleware(), logging.NewHTTPServerMiddleware(log.NewNopLogger()), false)
+			handler := instr("query", func(r *http.Request) (interface{}, []error, *baseAPI.ApiError) {
+				return &queryData{ResultType: tcase.result.Type(), Result: tcase.result}, nil, nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/query", nil)
+			req.Header.Set("Accept", tcase.accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			testutil.Equals(t, http.StatusOK, rec.Code)
+			testutil.Equals(t, tcase.contentType, rec.Header().Get("Content-Type"))
+			if tcase.body != "" {
+				testutil.Equals(t, tcase.body, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestParseTime(t *testing.T) {
 	ts, err := time.Parse(time.RFC3339Nano, "2015-06-03T13:21:58.555Z")
 	if err != nil {
@@ -44,7 +44,8 @@ const (
 
 // Download downloads directory that is mean to be block directory. If any of the files
 // have a hash calculated in the meta file and it matches with what is in the destination path then
-// we do not download it. We always re-download the meta file.
+// we do not download it. We always re-download the meta file. Compressed chunk files are always downloaded and
+// decompressed, and the local meta file describes the decompressed ones.
 func Download(ctx context.Context, logger log.Logger, bucket objstore.Bucket, id ulid.ULID, dst string, options ...objstore.DownloadOption) error {
 	if err := os.MkdirAll(dst, 0750); err != nil {
 		return errors.Wrap(err, "create dir")
@@ -58,11 +59,16 @@ func Download(ctx context.Context, logger log.Logger, bucket objstore.Bucket, id
 		return errors.Wrapf(err, "reading meta from %s", dst)
 	}
 
+	compressed := m.Thanos.ChunkCompression == ChunkCompressionZstd
 	ignoredPaths := []string{MetaFilename}
 	for _, fl := range m.Thanos.Files {
 		if fl.Hash == nil || fl.Hash.Func == metadata.NoneFunc || fl.RelPath == "" {
 			continue
 		}
+		// Hashes of compressed chunk files never match the decompressed local ones.
+		if compressed && isChunkFile(fl.RelPath) {
+			continue
+		}
 		actualHash, err := metadata.CalculateHash(filepath.Join(dst, fl.RelPath), fl.Hash.Func, logger)
 		if err != nil {
 			level.Info(logger).Log("msg", "failed to calculate hash when downloading; re-downloading", "relPath", fl.RelPath, "err", err)
@@ -89,7 +95,43 @@ func Download(ctx context.Context, logger log.Logger, bucket objstore.Bucket, id
 		return errors.Wrapf(err, "stat %s", chunksDir)
 	}
 
-	return nil
+	if !compressed {
+		return nil
+	}
+	// Compressed chunk files are only readable from the bucket, so they are stored locally as TSDB chunk files.
+	if err := DecompressChunks(logger, dst); err != nil {
+		return err
+	}
+	return writeDecompressedMeta(logger, dst, m)
+}
+
+func isChunkFile(relPath string) bool {
+	return strings.HasPrefix(relPath, ChunksDirname+"/")
+}
+
+// writeDecompressedMeta writes the meta of the block with decompressed chunk files, with their sizes and hashes.
+func writeDecompressedMeta(logger log.Logger, dir string, m *metadata.Meta) error {
+	m.Thanos.ChunkCompression = ""
+	for i, fl := range m.Thanos.Files {
+		if !isChunkFile(fl.RelPath) {
+			continue
+		}
+		fn := filepath.Join(dir, filepath.FromSlash(fl.RelPath))
+		stat, err := os.Stat(fn)
+		if err != nil {
+			return errors.Wrapf(err, "stat %s", fn)
+		}
+		m.Thanos.Files[i].SizeBytes = stat.Size()
+		if fl.Hash == nil || fl.Hash.Func == metadata.NoneFunc {
+			continue
+		}
+		hash, err := metadata.CalculateHash(fn, fl.Hash.Func, logger)
+		if err != nil {
+			return errors.Wrapf(err, "calculate hash of %s", fn)
+		}
+		m.Thanos.Files[i].Hash = &hash
+	}
+	return m.WriteToDir(logger, dir)
 }
 
 // Upload uploads a TSDB block to the object storage. It verifies basic
@@ -149,7 +191,7 @@ func upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload chunks"))
 	}
 
-	if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename)); err != nil {
+	if err := objstore.UploadFile(ctx, logger, bkt, filepath.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename), options...); err != nil {
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
 	}
 
@@ -0,0 +1,400 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// Compressions of the chunk files of blocks.
+const (
+	// ChunkCompressionNone keeps chunk files in the TSDB format.
+	ChunkCompressionNone = "none"
+	// ChunkCompressionZstd compresses chunk files with zstd.
+	ChunkCompressionZstd = "zstd"
+)
+
+// A zstd compressed chunk file starts with a header in place of the TSDB chunk file header, followed by a seek table
+// and the frames:
+//
+//	┌──────────────────────────────┬────────────────────┬──────────────────────┬──────────────────────────┬─────────────────────┐
+//	│ magic(0x5A43484B) <4 byte>   │ version(1) <1 byte>│ padding(0) <3 byte>  │ frame size <4 byte>      │ file size <8 byte>  │
+//	├──────────────────────────────┴────────────────────┴──────────────────────┴──────────────────────────┴─────────────────────┤
+//	│ frames <4 byte>                                                                                                           │
+//	├───────────────────────────────────────────────────────────────────────────────────────────────────────────────────────────┤
+//	│ compressed size of frame 1 <4 byte> ... compressed size of frame n <4 byte>                                               │
+//	├───────────────────────────────────────────────────────────────────────────────────────────────────────────────────────────┤
+//	│ frame 1 ... frame n                                                                                                       │
+//	└───────────────────────────────────────────────────────────────────────────────────────────────────────────────────────────┘
+//
+// Every frame holds frame size bytes of the uncompressed file, the last one the rest, and is compressed on its own,
+// so that byte ranges of the uncompressed file can be read by fetching and decompressing only the frames holding them.
+// Chunk references of the index keep pointing at offsets of the uncompressed file.
+const (
+	// MagicChunksZstd is the magic number of zstd compressed chunk files, differing from the one of TSDB chunk files.
+	MagicChunksZstd = 0x5A43484B
+
+	chunksZstdVersion1   = 1
+	chunksZstdHeaderSize = 4 + 1 + 3 + 4 + 8 + 4
+	chunksZstdFrameSize  = 256 * 1024
+)
+
+var (
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+)
+
+// decodeZstd decompresses a zstd frame. The decoder is shared, as it supports concurrent DecodeAll calls.
+func decodeZstd(dst, src []byte) ([]byte, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil)
+	})
+	if zstdDecoderErr != nil {
+		return nil, zstdDecoderErr
+	}
+	return zstdDecoder.DecodeAll(src, dst)
+}
+
+// CompressChunks compresses the chunk files of the block in the given directory with zstd, in place. Chunk files
+// already compressed or not getting smaller are kept as they are. If any chunk file is compressed, the compression is
+// recorded in the meta file of the block, so that readers don't need to check chunk files which are not compressed.
+// It returns the number of bytes saved.
+func CompressChunks(logger log.Logger, blockDir string) (saved int64, err error) {
+	files, err := ioutil.ReadDir(filepath.Join(blockDir, ChunksDirname))
+	if err != nil {
+		return 0, errors.Wrapf(err, "read dir %v", filepath.Join(blockDir, ChunksDirname))
+	}
+	anyCompressed := false
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		s, compressed, err := compressChunkFile(logger, filepath.Join(blockDir, ChunksDirname, f.Name()))
+		if err != nil {
+			return saved, errors.Wrapf(err, "compress chunk file %s", f.Name())
+		}
+		saved += s
+		anyCompressed = anyCompressed || compressed
+	}
+	if !anyCompressed {
+		return saved, nil
+	}
+
+	m, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return saved, errors.Wrap(err, "read meta")
+	}
+	m.Thanos.ChunkCompression = ChunkCompressionZstd
+	return saved, errors.Wrap(m.WriteToDir(logger, blockDir), "write meta")
+}
+
+// compressChunkFile compresses the chunk file, unless it doesn't get smaller. It returns whether the chunk file is
+// compressed, including if it already was.
+func compressChunkFile(logger log.Logger, fn string) (saved int64, compressed bool, err error) {
+	f, err := os.Open(filepath.Clean(fn))
+	if err != nil {
+		return 0, false, err
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close chunk file")
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	if compressed, err := isZstdChunkFile(f); err != nil || compressed {
+		return 0, compressed, err
+	}
+
+	tmp := fn + ".tmp"
+	out, err := os.Create(filepath.Clean(tmp))
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		if err != nil || saved == 0 {
+			runutil.CloseWithLogOnErr(logger, out, "close compressed chunk file")
+			if rerr := os.Remove(tmp); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+				err = rerr
+			}
+		}
+	}()
+
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return 0, false, errors.Wrap(err, "create zstd encoder")
+	}
+	defer runutil.CloseWithErrCapture(&err, enc, "close zstd encoder")
+
+	frames := int((stat.Size() + chunksZstdFrameSize - 1) / chunksZstdFrameSize)
+	header := make([]byte, chunksZstdHeaderSize+4*frames)
+	binary.BigEndian.PutUint32(header[0:4], MagicChunksZstd)
+	header[4] = chunksZstdVersion1
+	binary.BigEndian.PutUint32(header[8:12], chunksZstdFrameSize)
+	binary.BigEndian.PutUint64(header[12:20], uint64(stat.Size()))
+	binary.BigEndian.PutUint32(header[20:24], uint32(frames))
+
+	// The seek table is written once all frames are, so the header is skipped first.
+	if _, err := out.Seek(int64(len(header)), io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	var (
+		size   = int64(len(header))
+		buf    = make([]byte, chunksZstdFrameSize)
+		frame  []byte
+		reader = io.NewSectionReader(f, 0, stat.Size())
+	)
+	for i := 0; i < frames; i++ {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, false, errors.Wrap(err, "read chunk file")
+		}
+		frame = enc.EncodeAll(buf[:n], frame[:0])
+		if _, err := out.Write(frame); err != nil {
+			return 0, false, errors.Wrap(err, "write frame")
+		}
+		binary.BigEndian.PutUint32(header[chunksZstdHeaderSize+4*i:], uint32(len(frame)))
+		size += int64(len(frame))
+	}
+	if size >= stat.Size() {
+		return 0, false, nil
+	}
+	if _, err := out.WriteAt(header, 0); err != nil {
+		return 0, false, errors.Wrap(err, "write header")
+	}
+	if err := out.Sync(); err != nil {
+		return 0, false, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, false, err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return 0, false, err
+	}
+	return stat.Size() - size, true, nil
+}
+
+// DecompressChunks decompresses the zstd compressed chunk files of the block in the given directory, in place, so
+// that the block can be opened as a TSDB block. Chunk files which are not compressed are kept as they are.
+func DecompressChunks(logger log.Logger, blockDir string) error {
+	files, err := ioutil.ReadDir(filepath.Join(blockDir, ChunksDirname))
+	if err != nil {
+		return errors.Wrapf(err, "read dir %v", filepath.Join(blockDir, ChunksDirname))
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if err := decompressChunkFile(logger, filepath.Join(blockDir, ChunksDirname, f.Name())); err != nil {
+			return errors.Wrapf(err, "decompress chunk file %s", f.Name())
+		}
+	}
+	return nil
+}
+
+func decompressChunkFile(logger log.Logger, fn string) (err error) {
+	f, err := os.Open(filepath.Clean(fn))
+	if err != nil {
+		return err
+	}
+	defer runutil.CloseWithErrCapture(&err, f, "close chunk file")
+
+	if compressed, err := isZstdChunkFile(f); err != nil || !compressed {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	cf, err := readZstdChunkFileHeader(io.NewSectionReader(f, 0, stat.Size()))
+	if err != nil {
+		return err
+	}
+
+	tmp := fn + ".tmp"
+	out, err := os.Create(filepath.Clean(tmp))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			runutil.CloseWithLogOnErr(logger, out, "close decompressed chunk file")
+			if rerr := os.Remove(tmp); rerr != nil && !os.IsNotExist(rerr) {
+				err = rerr
+			}
+		}
+	}()
+
+	var src, dst []byte
+	for i := 0; i < len(cf.offsets)-1; i++ {
+		if n := int(cf.offsets[i+1] - cf.offsets[i]); cap(src) < n {
+			src = make([]byte, n)
+		} else {
+			src = src[:n]
+		}
+		if _, err := f.ReadAt(src, cf.offsets[i]); err != nil {
+			return errors.Wrapf(err, "read frame %d", i)
+		}
+		if dst, err = decodeZstd(dst[:0], src); err != nil {
+			return errors.Wrapf(err, "decompress frame %d", i)
+		}
+		if _, err := out.Write(dst); err != nil {
+			return errors.Wrapf(err, "write frame %d", i)
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func isZstdChunkFile(r io.ReaderAt) (bool, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "read magic number")
+	}
+	return binary.BigEndian.Uint32(magic) == MagicChunksZstd, nil
+}
+
+// ZstdChunkFile locates the frames of a zstd compressed chunk file, to read ranges of the uncompressed file.
+type ZstdChunkFile struct {
+	frameSize int64
+	size      int64
+	// offsets holds the offset of every frame in the compressed file, followed by the size of the compressed file.
+	offsets []int64
+}
+
+func readZstdChunkFileHeader(r io.ReaderAt) (*ZstdChunkFile, error) {
+	header := make([]byte, chunksZstdHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	cf, frames, err := parseZstdChunkFileHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]byte, 4*frames)
+	if _, err := r.ReadAt(table, chunksZstdHeaderSize); err != nil {
+		return nil, errors.Wrap(err, "read seek table")
+	}
+	cf.parseSeekTable(table)
+	return cf, nil
+}
+
+func parseZstdChunkFileHeader(header []byte) (*ZstdChunkFile, int, error) {
+	if m := binary.BigEndian.Uint32(header[0:4]); m != MagicChunksZstd {
+		return nil, 0, errors.Errorf("invalid magic number %x", m)
+	}
+	if v := header[4]; v != chunksZstdVersion1 {
+		return nil, 0, errors.Errorf("unsupported version %d", v)
+	}
+	cf := &ZstdChunkFile{
+		frameSize: int64(binary.BigEndian.Uint32(header[8:12])),
+		size:      int64(binary.BigEndian.Uint64(header[12:20])),
+	}
+	if cf.frameSize <= 0 {
+		return nil, 0, errors.Errorf("invalid frame size %d", cf.frameSize)
+	}
+	return cf, int(binary.BigEndian.Uint32(header[20:24])), nil
+}
+
+func (cf *ZstdChunkFile) parseSeekTable(table []byte) {
+	frames := len(table) / 4
+	cf.offsets = make([]int64, frames+1)
+	cf.offsets[0] = int64(chunksZstdHeaderSize + len(table))
+	for i := 0; i < frames; i++ {
+		cf.offsets[i+1] = cf.offsets[i] + int64(binary.BigEndian.Uint32(table[4*i:]))
+	}
+}
+
+// ReadZstdChunkFileHeader reads the header of the chunk file with the given name from the bucket. It returns nil if
+// the chunk file is not zstd compressed.
+func ReadZstdChunkFileHeader(ctx context.Context, bkt objstore.BucketReader, name string) (_ *ZstdChunkFile, err error) {
+	header, err := readObjectRange(ctx, bkt, name, 0, chunksZstdHeaderSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	if len(header) < chunksZstdHeaderSize || binary.BigEndian.Uint32(header[0:4]) != MagicChunksZstd {
+		return nil, nil
+	}
+	cf, frames, err := parseZstdChunkFileHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	table, err := readObjectRange(ctx, bkt, name, chunksZstdHeaderSize, int64(4*frames))
+	if err != nil {
+		return nil, errors.Wrap(err, "read seek table")
+	}
+	if len(table) != 4*frames {
+		return nil, errors.Errorf("truncated seek table of %d bytes, expected %d", len(table), 4*frames)
+	}
+	cf.parseSeekTable(table)
+	return cf, nil
+}
+
+// GetRange returns a reader of the given range of the uncompressed chunk file, fetching and decompressing the frames
+// holding it from the bucket. Like object storage range reads, ranges past the end of the file are truncated.
+func (cf *ZstdChunkFile) GetRange(ctx context.Context, bkt objstore.BucketReader, name string, off, length int64) (io.ReadCloser, error) {
+	if off < 0 || length < 0 || off >= cf.size {
+		return nil, errors.Errorf("invalid range %d+%d of chunk file of %d bytes", off, length, cf.size)
+	}
+	if off+length > cf.size {
+		length = cf.size - off
+	}
+	if length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	first, last := off/cf.frameSize, (off+length-1)/cf.frameSize
+	src, err := readObjectRange(ctx, bkt, name, cf.offsets[first], cf.offsets[last+1]-cf.offsets[first])
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(src)) != cf.offsets[last+1]-cf.offsets[first] {
+		return nil, errors.Errorf("truncated frames of %d bytes, expected %d", len(src), cf.offsets[last+1]-cf.offsets[first])
+	}
+
+	dst := make([]byte, 0, (last-first+1)*cf.frameSize)
+	for i := first; i <= last; i++ {
+		frame := src[cf.offsets[i]-cf.offsets[first] : cf.offsets[i+1]-cf.offsets[first]]
+		if dst, err = decodeZstd(dst, frame); err != nil {
+			return nil, errors.Wrapf(err, "decompress frame %d", i)
+		}
+	}
+	start := off - first*cf.frameSize
+	if start+length > int64(len(dst)) {
+		return nil, errors.Errorf("decompressed frames of %d bytes don't hold range %d+%d", len(dst), start, length)
+	}
+	return ioutil.NopCloser(bytes.NewReader(dst[start : start+length])), nil
+}
+
+func readObjectRange(ctx context.Context, bkt objstore.BucketReader, name string, off, length int64) (_ []byte, err error) {
+	r, err := bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, errors.Wrap(err, "get range reader")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close range reader")
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+func TestCompressChunks(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	logger := log.NewNopLogger()
+
+	// Series with the same samples make chunk files of several frames which compress well.
+	var samples []tsdbutil.Sample
+	for i := int64(0); i < 120; i++ {
+		samples = append(samples, sample{t: i * 15000, v: float64(i % 7)})
+	}
+	var series []storage.Series
+	for i := 0; i < 5000; i++ {
+		series = append(series, storage.NewListSeries(labels.FromStrings("__name__", "metric", "i", fmt.Sprintf("%d", i)), samples))
+	}
+	bdir, err := tsdb.CreateBlock(series, tmpDir, 0, logger)
+	testutil.Ok(t, err)
+	id, err := ulid.Parse(filepath.Base(bdir))
+	testutil.Ok(t, err)
+
+	segment := filepath.Join(bdir, ChunksDirname, "000001")
+	original, err := ioutil.ReadFile(segment)
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(original) > 2*chunksZstdFrameSize, "expected a chunk file of several frames, got %d bytes", len(original))
+
+	saved, err := CompressChunks(logger, bdir)
+	testutil.Ok(t, err)
+	compressed, err := ioutil.ReadFile(segment)
+	testutil.Ok(t, err)
+	testutil.Assert(t, saved > 0, "expected chunk files to be compressed")
+	testutil.Equals(t, int64(len(original)-len(compressed)), saved)
+	testutil.Equals(t, uint32(MagicChunksZstd), binary.BigEndian.Uint32(compressed[0:4]))
+	meta, err := metadata.ReadFromDir(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ChunkCompressionZstd, meta.Thanos.ChunkCompression)
+
+	// Compressed chunk files are kept as they are.
+	saved, err = CompressChunks(logger, bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(0), saved)
+
+	bkt := objstore.NewInMemBucket()
+	testutil.Ok(t, UploadPromBlock(ctx, logger, bkt, bdir, metadata.SHA256Func))
+	name := path.Join(id.String(), ChunksDirname, "000001")
+
+	t.Run("read ranges", func(t *testing.T) {
+		cf, err := ReadZstdChunkFileHeader(ctx, bkt, name)
+		testutil.Ok(t, err)
+		testutil.Assert(t, cf != nil, "expected a compressed chunk file")
+
+		for _, r := range []struct{ off, length int64 }{
+			{off: 0, length: 8},
+			{off: 100, length: 1000},
+			// Spanning frames.
+			{off: chunksZstdFrameSize - 10, length: chunksZstdFrameSize + 20},
+			// Truncated at the end of the file.
+			{off: int64(len(original)) - 100, length: 1000},
+		} {
+			rc, err := cf.GetRange(ctx, bkt, name, r.off, r.length)
+			testutil.Ok(t, err)
+			got, err := ioutil.ReadAll(rc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, rc.Close())
+
+			end := r.off + r.length
+			if end > int64(len(original)) {
+				end = int64(len(original))
+			}
+			testutil.Assert(t, bytes.Equal(original[r.off:end], got), "range %d+%d differs", r.off, r.length)
+		}
+	})
+
+	t.Run("download decompresses", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), id.String())
+		// Downloading again over the decompressed chunk files gives the same block.
+		for i := 0; i < 2; i++ {
+			testutil.Ok(t, Download(ctx, logger, bkt, id, dst))
+			got, err := ioutil.ReadFile(filepath.Join(dst, ChunksDirname, "000001"))
+			testutil.Ok(t, err)
+			testutil.Assert(t, bytes.Equal(original, got), "decompressed chunk file differs")
+
+			// The local meta describes the decompressed chunk files.
+			meta, err := metadata.ReadFromDir(dst)
+			testutil.Ok(t, err)
+			testutil.Equals(t, "", meta.Thanos.ChunkCompression)
+			for _, f := range meta.Thanos.Files {
+				if f.Hash == nil {
+					continue
+				}
+				hash, err := metadata.CalculateHash(filepath.Join(dst, f.RelPath), f.Hash.Func, logger)
+				testutil.Ok(t, err)
+				testutil.Equals(t, hash, *f.Hash, "hash of %s", f.RelPath)
+			}
+			testutil.Equals(t, int64(len(original)), meta.Thanos.Files[0].SizeBytes)
+
+			b, err := tsdb.OpenBlock(logger, dst, nil)
+			testutil.Ok(t, err)
+			testutil.Ok(t, b.Close())
+		}
+	})
+
+	t.Run("uncompressed chunk files", func(t *testing.T) {
+		testutil.Ok(t, bkt.Upload(ctx, "plain", bytes.NewReader(original)))
+		cf, err := ReadZstdChunkFileHeader(ctx, bkt, "plain")
+		testutil.Ok(t, err)
+		testutil.Assert(t, cf == nil, "expected an uncompressed chunk file")
+	})
+
+	t.Run("incompressible chunk files", func(t *testing.T) {
+		// Random samples don't compress, so their chunk files are kept as they are.
+		id, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "val1"}}, 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		segment := filepath.Join(tmpDir, id.String(), ChunksDirname, "000001")
+		before, err := ioutil.ReadFile(segment)
+		testutil.Ok(t, err)
+
+		saved, err := CompressChunks(logger, filepath.Join(tmpDir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(0), saved)
+		after, err := ioutil.ReadFile(segment)
+		testutil.Ok(t, err)
+		testutil.Equals(t, before, after)
+		meta, err := metadata.ReadFromDir(filepath.Join(tmpDir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, "", meta.Thanos.ChunkCompression)
+		_, err = os.Stat(segment + ".tmp")
+		testutil.Assert(t, os.IsNotExist(err), "expected no temporary file left")
+	})
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func (s sample) T() int64   { return s.t }
+func (s sample) V() float64 { return s.v }
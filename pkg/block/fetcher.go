@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/golang/groupcache/singleflight"
@@ -23,6 +24,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/tsdb"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v2"
 
@@ -70,6 +72,7 @@ const (
 
 	// Synced label values.
 	labelExcludedMeta = "label-excluded"
+	shardExcludedMeta = "shard-excluded"
 	timeExcludedMeta  = "time-excluded"
 	tooFreshMeta      = "too-fresh"
 	duplicateMeta     = "duplicate"
@@ -118,6 +121,7 @@ func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExt
 			{tooFreshMeta},
 			{FailedMeta},
 			{labelExcludedMeta},
+			{shardExcludedMeta},
 			{timeExcludedMeta},
 			{duplicateMeta},
 			{MarkedForDeletionMeta},
@@ -569,6 +573,42 @@ func (f *LabelShardedMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*
 	return nil
 }
 
+var _ MetadataFilter = &BlockIDShardedMetaFilter{}
+
+// BlockIDShardedMetaFilter is a BaseFetcher filter that filters out blocks whose ID doesn't hash to the given shard.
+// Each block belongs to exactly one of the shards, so that replicas using all shards serve every block once.
+// Not go-routine safe.
+type BlockIDShardedMetaFilter struct {
+	shardID, totalShards int
+}
+
+// NewBlockIDShardedMetaFilter creates BlockIDShardedMetaFilter keeping blocks of the shard shardID, out of totalShards.
+func NewBlockIDShardedMetaFilter(shardID, totalShards int) (*BlockIDShardedMetaFilter, error) {
+	if totalShards < 1 {
+		return nil, errors.Errorf("total shards must be positive, got %d", totalShards)
+	}
+	if shardID < 0 || shardID >= totalShards {
+		return nil, errors.Errorf("shard ID must be in [0, %d), got %d", totalShards, shardID)
+	}
+	return &BlockIDShardedMetaFilter{shardID: shardID, totalShards: totalShards}, nil
+}
+
+// BlockIDShard returns the shard the given block belongs to, out of totalShards.
+func BlockIDShard(id ulid.ULID, totalShards int) int {
+	return int(xxhash.Sum64(id[:]) % uint64(totalShards))
+}
+
+// Filter filters out blocks of other shards.
+func (f *BlockIDShardedMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, modified *extprom.TxGaugeVec) error {
+	for id := range metas {
+		if BlockIDShard(id, f.totalShards) != f.shardID {
+			synced.WithLabelValues(shardExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+	return nil
+}
+
 var _ MetadataFilter = &DeduplicateFilter{}
 
 // DeduplicateFilter is a BaseFetcher filter that filters out older blocks that have exactly the same data.
@@ -681,6 +721,59 @@ func contains(s1, s2 []ulid.ULID) bool {
 	return true
 }
 
+var _ MetadataFilter = &IdenticalBlocksFilter{}
+
+// IdenticalBlocksFilter is a BaseFetcher filter that filters out blocks with the same content as another block
+// uploaded under a different ULID, e.g. on re-upload. Blocks are identical if they have the same time range,
+// resolution, external labels, source and series, chunks and samples counts. The block with the lowest ULID is kept.
+// Not go-routine safe.
+type IdenticalBlocksFilter struct {
+	logger log.Logger
+}
+
+// NewIdenticalBlocksFilter creates IdenticalBlocksFilter.
+func NewIdenticalBlocksFilter(logger log.Logger) *IdenticalBlocksFilter {
+	return &IdenticalBlocksFilter{logger: logger}
+}
+
+type blockContentKey struct {
+	minTime, maxTime int64
+	resolution       int64
+	labels           string
+	source           metadata.SourceType
+	stats            tsdb.BlockStats
+}
+
+// Filter filters out blocks with the same content as a block with a lower ULID.
+func (f *IdenticalBlocksFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec, modified *extprom.TxGaugeVec) error {
+	ids := make([]ulid.ULID, 0, len(metas))
+	for id := range metas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+
+	kept := make(map[blockContentKey]ulid.ULID, len(ids))
+	for _, id := range ids {
+		meta := metas[id]
+		key := blockContentKey{
+			minTime:    meta.MinTime,
+			maxTime:    meta.MaxTime,
+			resolution: meta.Thanos.Downsample.Resolution,
+			labels:     labels.FromMap(meta.Thanos.Labels).String(),
+			source:     meta.Thanos.Source,
+			stats:      meta.Stats,
+		}
+		if original, ok := kept[key]; ok {
+			level.Warn(f.logger).Log("msg", "skipping block with the same content as another block", "block", id, "original", original)
+			synced.WithLabelValues(duplicateMeta).Inc()
+			delete(metas, id)
+			continue
+		}
+		kept[key] = id
+	}
+	return nil
+}
+
 var _ MetadataFilter = &ReplicaLabelRemover{}
 
 // ReplicaLabelRemover is a BaseFetcher filter that modifies external labels of existing blocks, it removes given replica labels from the metadata of blocks that have it.
@@ -23,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -31,6 +32,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/objtesting"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
 func newTestFetcherMetrics() *FetcherMetrics {
@@ -462,6 +464,53 @@ func TestLabelShardedMetaFilter_Filter_Hashmod(t *testing.T) {
 	}
 }
 
+func TestBlockIDShardedMetaFilter_Filter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	const totalShards = 3
+	input := map[ulid.ULID]*metadata.Meta{}
+	for i := 0; i < 100; i++ {
+		input[ULID(i)] = &metadata.Meta{}
+	}
+
+	// Every block is kept by exactly one shard.
+	owners := map[ulid.ULID]int{}
+	for i := 0; i < totalShards; i++ {
+		f, err := NewBlockIDShardedMetaFilter(i, totalShards)
+		testutil.Ok(t, err)
+
+		metas := map[ulid.ULID]*metadata.Meta{}
+		for id, m := range input {
+			metas[id] = m
+		}
+		m := newTestFetcherMetrics()
+		testutil.Ok(t, f.Filter(ctx, metas, m.Synced, nil))
+
+		testutil.Assert(t, len(metas) > 0, "shard %d has no blocks", i)
+		testutil.Equals(t, float64(len(input)-len(metas)), promtest.ToFloat64(m.Synced.WithLabelValues(shardExcludedMeta)))
+		for id := range metas {
+			prev, ok := owners[id]
+			testutil.Assert(t, !ok, "block %s kept by shards %d and %d", id, prev, i)
+			owners[id] = i
+			testutil.Equals(t, i, BlockIDShard(id, totalShards))
+		}
+	}
+	testutil.Equals(t, len(input), len(owners))
+
+	// A single shard keeps all blocks.
+	f, err := NewBlockIDShardedMetaFilter(0, 1)
+	testutil.Ok(t, err)
+	m := newTestFetcherMetrics()
+	testutil.Ok(t, f.Filter(ctx, input, m.Synced, nil))
+	testutil.Equals(t, 100, len(input))
+
+	_, err = NewBlockIDShardedMetaFilter(3, 3)
+	testutil.NotOk(t, err)
+	_, err = NewBlockIDShardedMetaFilter(0, 0)
+	testutil.NotOk(t, err)
+}
+
 func TestTimePartitionMetaFilter_Filter(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
@@ -876,6 +925,41 @@ func TestDeduplicateFilter_Filter(t *testing.T) {
 	}
 }
 
+func TestIdenticalBlocksFilter_Filter(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-identical-blocks")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	series := []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+	}
+	extLset := labels.FromStrings("ext1", "val1")
+
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	var ids []ulid.ULID
+	for _, lset := range []labels.Labels{extLset, extLset, labels.FromStrings("ext1", "val2")} {
+		id, err := e2eutil.CreateBlock(ctx, tmpDir, series, 100, 0, 1000, lset, 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, Upload(ctx, log.NewNopLogger(), bkt, path.Join(tmpDir, id.String()), metadata.NoneFunc))
+		ids = append(ids, id)
+	}
+
+	m := newTestFetcherMetrics()
+	fetcher, err := NewRawMetaFetcher(log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	fetched, _, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(fetched))
+
+	// The re-uploaded copy of the first block is filtered out, the block with other external labels is kept.
+	testutil.Ok(t, NewIdenticalBlocksFilter(log.NewNopLogger()).Filter(ctx, fetched, m.Synced, nil))
+	compareSliceWithMapKeys(t, fetched, []ulid.ULID{ids[0], ids[2]})
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.Synced.WithLabelValues(duplicateMeta)))
+}
+
 func TestReplicaLabelRemover_Modify(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
@@ -5,6 +5,8 @@ package indexheader
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -13,19 +15,35 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promgate "github.com/prometheus/prometheus/util/gate"
 
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/objstore"
 )
 
 // ReaderPoolMetrics holds metrics tracked by ReaderPool.
 type ReaderPoolMetrics struct {
 	lazyReader *LazyBinaryReaderMetrics
+
+	generationDuration prometheus.Histogram
+	generationInFlight prometheus.Gauge
 }
 
 // NewReaderPoolMetrics makes new ReaderPoolMetrics.
 func NewReaderPoolMetrics(reg prometheus.Registerer) *ReaderPoolMetrics {
 	return &ReaderPoolMetrics{
 		lazyReader: NewLazyBinaryReaderMetrics(reg),
+		generationDuration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "indexheader_generation_duration_seconds",
+			Help:    "Duration of the index-header generation from the block index in the bucket, in seconds.",
+			Buckets: []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 15, 30, 60, 120, 300},
+		}),
+		generationInFlight: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "indexheader_generation_in_flight",
+			Help: "Number of index-headers currently being generated.",
+		}),
 	}
 }
 
@@ -39,6 +57,9 @@ type ReaderPool struct {
 	logger                log.Logger
 	metrics               *ReaderPoolMetrics
 
+	// Gate limiting the number of index-headers generated concurrently.
+	generationGate gate.Gate
+
 	// Channel used to signal once the pool is closing.
 	close chan struct{}
 
@@ -47,17 +68,23 @@ type ReaderPool struct {
 	lazyReaders   map[*LazyBinaryReader]struct{}
 }
 
-// NewReaderPool makes a new ReaderPool.
-func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, metrics *ReaderPoolMetrics) *ReaderPool {
+// NewReaderPool makes a new ReaderPool. The generationConcurrency limits how many index-headers
+// missing on local disk can be built at the same time; 0 means no limit.
+func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, generationConcurrency int, metrics *ReaderPoolMetrics) *ReaderPool {
 	p := &ReaderPool{
 		logger:                logger,
 		metrics:               metrics,
 		lazyReaderEnabled:     lazyReaderEnabled,
 		lazyReaderIdleTimeout: lazyReaderIdleTimeout,
+		generationGate:        gate.NewNoop(),
 		lazyReaders:           make(map[*LazyBinaryReader]struct{}),
 		close:                 make(chan struct{}),
 	}
 
+	if generationConcurrency > 0 {
+		p.generationGate = promgate.New(generationConcurrency)
+	}
+
 	// Start a goroutine to close idle readers (only if required).
 	if p.lazyReaderEnabled && p.lazyReaderIdleTimeout > 0 {
 		checkFreq := p.lazyReaderIdleTimeout / 10
@@ -84,6 +111,10 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	var reader Reader
 	var err error
 
+	if err := p.ensureIndexHeader(ctx, logger, bkt, dir, id); err != nil {
+		return nil, err
+	}
+
 	if p.lazyReaderEnabled {
 		reader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, p.metrics.lazyReader, p.onLazyReaderClosed)
 	} else {
@@ -104,6 +135,37 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	return reader, err
 }
 
+// ensureIndexHeader builds the index-header for the given block, unless it already exists
+// on the local disk. The number of concurrent builds is limited by the pool generation gate,
+// since each of them downloads the symbols and postings offsets tables from the bucket.
+func (p *ReaderPool) ensureIndexHeader(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID) error {
+	fn := filepath.Join(dir, id.String(), block.IndexHeaderFilename)
+	if _, err := os.Stat(fn); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "read index header")
+	}
+
+	if err := p.generationGate.Start(ctx); err != nil {
+		return errors.Wrap(err, "wait for index header generation turn")
+	}
+	defer p.generationGate.Done()
+
+	p.metrics.generationInFlight.Inc()
+	defer p.metrics.generationInFlight.Dec()
+
+	level.Debug(logger).Log("msg", "the index-header doesn't exist on disk; recreating", "path", fn)
+
+	start := time.Now()
+	if err := WriteBinary(ctx, bkt, id, fn); err != nil {
+		return errors.Wrap(err, "write index header")
+	}
+	p.metrics.generationDuration.Observe(time.Since(start).Seconds())
+
+	level.Debug(logger).Log("msg", "built index-header file", "path", fn, "elapsed", time.Since(start))
+	return nil
+}
+
 // Close the pool and stop checking for idle readers. No reader tracked by this pool
 // will be closed. It's the caller responsibility to close readers.
 func (p *ReaderPool) Close() {
@@ -5,18 +5,23 @@ package indexheader
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
 	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
@@ -60,7 +65,7 @@ func TestReaderPool_NewBinaryReader(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, NewReaderPoolMetrics(nil))
+			pool := NewReaderPool(log.NewNopLogger(), testData.lazyReaderEnabled, testData.lazyReaderIdleTimeout, 0, NewReaderPoolMetrics(nil))
 			defer pool.Close()
 
 			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -97,7 +102,7 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
 
 	metrics := NewReaderPoolMetrics(nil)
-	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, metrics)
+	pool := NewReaderPool(log.NewNopLogger(), true, idleTimeout, 0, metrics)
 	defer pool.Close()
 
 	r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3)
@@ -133,3 +138,91 @@ func TestReaderPool_ShouldCloseIdleLazyReaders(t *testing.T) {
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.loadCount))
 	testutil.Equals(t, float64(2), promtestutil.ToFloat64(metrics.lazyReader.unloadCount))
 }
+
+// concurrencyTrackingBucket tracks the max number of concurrent GetRange calls.
+type concurrencyTrackingBucket struct {
+	objstore.BucketReader
+
+	mtx         sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (b *concurrencyTrackingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mtx.Unlock()
+
+	defer func() {
+		b.mtx.Lock()
+		b.inFlight--
+		b.mtx.Unlock()
+	}()
+
+	// Give other generations a chance to run concurrently.
+	time.Sleep(10 * time.Millisecond)
+	return b.BucketReader.GetRange(ctx, name, off, length)
+}
+
+func TestReaderPool_ShouldGenerateIndexHeadersConcurrently(t *testing.T) {
+	const (
+		numBlocks             = 6
+		generationConcurrency = 2
+	)
+
+	ctx := context.Background()
+
+	tmpDir, err := ioutil.TempDir("", "test-indexheader")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(tmpDir)) }()
+
+	fsBkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, fsBkt.Close()) }()
+
+	var blockIDs []ulid.ULID
+	for i := 0; i < numBlocks; i++ {
+		blockID, err := e2eutil.CreateBlock(ctx, tmpDir, []labels.Labels{
+			{{Name: "a", Value: "1"}},
+			{{Name: "a", Value: "2"}},
+		}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), fsBkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+		blockIDs = append(blockIDs, blockID)
+	}
+
+	bkt := &concurrencyTrackingBucket{BucketReader: fsBkt}
+	metrics := NewReaderPoolMetrics(nil)
+	pool := NewReaderPool(log.NewNopLogger(), false, 0, generationConcurrency, metrics)
+	defer pool.Close()
+
+	headersDir := filepath.Join(tmpDir, "headers")
+	readers := make([]Reader, numBlocks)
+	wg := sync.WaitGroup{}
+	for i, id := range blockIDs {
+		wg.Add(1)
+		go func(i int, id ulid.ULID) {
+			defer wg.Done()
+
+			r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, headersDir, id, 3)
+			testutil.Ok(t, err)
+			readers[i] = r
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, r := range readers {
+		labelNames, err := r.LabelNames()
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a"}, labelNames)
+		testutil.Ok(t, r.Close())
+	}
+
+	testutil.Equals(t, generationConcurrency, bkt.maxInFlight)
+	m := &dto.Metric{}
+	testutil.Ok(t, metrics.generationDuration.Write(m))
+	testutil.Equals(t, uint64(numBlocks), m.GetHistogram().GetSampleCount())
+}
@@ -70,6 +70,12 @@ const (
 	IndexSizeExceedingNoCompactReason = "index-size-exceeding"
 	// OutOfOrderChunksNoCompactReason is a reason of to no compact block with index contains out of order chunk so that the compaction is not blocked.
 	OutOfOrderChunksNoCompactReason = "block-index-out-of-order-chunk"
+	// CompactionFailedNoCompactReason is a reason to no compact blocks of a group which repeatedly failed to be compacted,
+	// so that it doesn't block compaction of other groups.
+	CompactionFailedNoCompactReason = "compaction-failed"
+	// SplitBlockNoCompactReason is a reason to no compact blocks resulting from a compaction split because of the max
+	// block size, so that they aren't compacted back together.
+	SplitBlockNoCompactReason = "split-block"
 )
 
 // NoCompactMark marker stores reason of block being excluded from compaction if needed.
@@ -90,6 +90,10 @@ type Thanos struct {
 
 	// Rewrites is present when any rewrite (deletion, relabel etc) were applied to this block. Optional.
 	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// ChunkCompression is the compression of the chunk files of this block, e.g. zstd, if any of them is compressed.
+	// Chunk files are in the TSDB format otherwise. Optional.
+	ChunkCompression string `json:"chunk_compression,omitempty"`
 }
 
 type Rewrite struct {
@@ -132,11 +136,15 @@ type ThanosDownsample struct {
 
 // InjectThanos sets Thanos meta to the block meta JSON and saves it to the disk.
 // NOTE: It should be used after writing any block by any Thanos component, otherwise we will miss crucial metadata.
+// The chunk compression already recorded in the meta, when chunk files were compressed, is kept if meta has none.
 func InjectThanos(logger log.Logger, bdir string, meta Thanos, downsampledMeta *tsdb.BlockMeta) (*Meta, error) {
 	newMeta, err := ReadFromDir(bdir)
 	if err != nil {
 		return nil, errors.Wrap(err, "read new meta")
 	}
+	if meta.ChunkCompression == "" {
+		meta.ChunkCompression = newMeta.Thanos.ChunkCompression
+	}
 	newMeta.Thanos = meta
 
 	// While downsampling we need to copy original compaction.
@@ -0,0 +1,60 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block"
+)
+
+// chunkCompressingCompactor compresses the chunk files of the blocks written by the wrapped compactor with zstd.
+type chunkCompressingCompactor struct {
+	Compactor
+	logger     log.Logger
+	savedBytes prometheus.Counter
+}
+
+// NewChunkCompressingCompactor returns a compactor compressing the chunk files of the blocks written by comp with zstd,
+// before they are uploaded. The compression is recorded in the meta of the blocks for readers of blocks from the bucket.
+func NewChunkCompressingCompactor(logger log.Logger, comp Compactor, savedBytes prometheus.Counter) Compactor {
+	return &chunkCompressingCompactor{Compactor: comp, logger: logger, savedBytes: savedBytes}
+}
+
+func (c *chunkCompressingCompactor) Write(dest string, b tsdb.BlockReader, mint, maxt int64, parent *tsdb.BlockMeta) (ulid.ULID, error) {
+	id, err := c.Compactor.Write(dest, b, mint, maxt, parent)
+	if err != nil {
+		return id, err
+	}
+	return id, c.compress(dest, id)
+}
+
+func (c *chunkCompressingCompactor) Compact(dest string, dirs []string, open []*tsdb.Block) (ulid.ULID, error) {
+	id, err := c.Compactor.Compact(dest, dirs, open)
+	if err != nil {
+		return id, err
+	}
+	return id, c.compress(dest, id)
+}
+
+func (c *chunkCompressingCompactor) compress(dest string, id ulid.ULID) error {
+	// No block is written if it would have no samples.
+	if id == (ulid.ULID{}) {
+		return nil
+	}
+	saved, err := block.CompressChunks(c.logger, filepath.Join(dest, id.String()))
+	if err != nil {
+		return errors.Wrapf(err, "compress chunks of block %s", id)
+	}
+	c.savedBytes.Add(float64(saved))
+	level.Debug(c.logger).Log("msg", "compressed chunks", "block", id, "savedBytes", saved)
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// blockCreatingCompactor creates a block of the given series instead of compacting blocks.
+type blockCreatingCompactor struct {
+	Compactor
+	series []storage.Series
+}
+
+func (c *blockCreatingCompactor) Compact(dest string, _ []string, _ []*tsdb.Block) (ulid.ULID, error) {
+	if len(c.series) == 0 {
+		return ulid.ULID{}, nil
+	}
+	dir, err := tsdb.CreateBlock(c.series, dest, 0, log.NewNopLogger())
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	return ulid.Parse(filepath.Base(dir))
+}
+
+func TestChunkCompressingCompactor(t *testing.T) {
+	var samples []tsdbutil.Sample
+	for i := int64(0); i < 120; i++ {
+		samples = append(samples, sample{t: i * 15000, v: float64(i % 7)})
+	}
+	var series []storage.Series
+	for i := 0; i < 1000; i++ {
+		series = append(series, storage.NewListSeries(labels.FromStrings("__name__", "metric", "i", fmt.Sprintf("%d", i)), samples))
+	}
+
+	saved := prometheus.NewCounter(prometheus.CounterOpts{})
+	dir := t.TempDir()
+	comp := NewChunkCompressingCompactor(log.NewNopLogger(), &blockCreatingCompactor{series: series}, saved)
+	id, err := comp.Compact(dir, nil, nil)
+	testutil.Ok(t, err)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, id.String(), block.ChunksDirname, "000001"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint32(block.MagicChunksZstd), binary.BigEndian.Uint32(b[0:4]))
+	testutil.Assert(t, promtestutil.ToFloat64(saved) > 0, "expected saved bytes")
+
+	// The compression is recorded in the meta, and kept when the Thanos meta of the compacted block is injected.
+	meta, err := metadata.InjectThanos(log.NewNopLogger(), filepath.Join(dir, id.String()), metadata.Thanos{Source: metadata.CompactorSource}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, block.ChunkCompressionZstd, meta.Thanos.ChunkCompression)
+
+	// Compactions without samples write no block.
+	comp = NewChunkCompressingCompactor(log.NewNopLogger(), &blockCreatingCompactor{}, saved)
+	id, err = comp.Compact(dir, nil, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, ulid.ULID{}, id)
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+func (s sample) T() int64   { return s.t }
+func (s sample) V() float64 { return s.v }
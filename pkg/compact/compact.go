@@ -30,6 +30,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/errutil"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/tracing"
@@ -233,9 +234,14 @@ type DefaultGrouper struct {
 	blocksMarkedForNoCompact prometheus.Counter
 	hashFunc                 metadata.HashFunc
 	blockFilesConcurrency    int
+	blocksDownloadGate       gate.Gate
+	maxBlockSize             int64
+	splitBlocksMarked        prometheus.Counter
 }
 
 // NewDefaultGrouper makes a new DefaultGrouper.
+// If blocksDownloadConcurrency is greater than 0, it limits the number of source blocks downloaded at once by all groups.
+// If maxBlockSize is greater than 0, it caps the estimated size of compacted blocks, see NewGroup.
 func NewDefaultGrouper(
 	logger log.Logger,
 	bkt objstore.Bucket,
@@ -247,7 +253,14 @@ func NewDefaultGrouper(
 	blocksMarkedForNoCompact prometheus.Counter,
 	hashFunc metadata.HashFunc,
 	blockFilesConcurrency int,
+	blocksDownloadConcurrency int,
+	maxBlockSize int64,
+	splitBlocksMarkedForNoCompact prometheus.Counter,
 ) *DefaultGrouper {
+	blocksDownloadGate := gate.NewNoop()
+	if blocksDownloadConcurrency > 0 {
+		blocksDownloadGate = gate.New(extprom.WrapRegistererWithPrefix("thanos_compact_blocks_download_", reg), blocksDownloadConcurrency)
+	}
 	return &DefaultGrouper{
 		bkt:                      bkt,
 		logger:                   logger,
@@ -278,6 +291,9 @@ func NewDefaultGrouper(
 		blocksMarkedForDeletion:  blocksMarkedForDeletion,
 		hashFunc:                 hashFunc,
 		blockFilesConcurrency:    blockFilesConcurrency,
+		blocksDownloadGate:       blocksDownloadGate,
+		maxBlockSize:             maxBlockSize,
+		splitBlocksMarked:        splitBlocksMarkedForNoCompact,
 	}
 }
 
@@ -308,6 +324,9 @@ func (g *DefaultGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res []*Gro
 				g.blocksMarkedForNoCompact,
 				g.hashFunc,
 				g.blockFilesConcurrency,
+				g.blocksDownloadGate,
+				g.maxBlockSize,
+				g.splitBlocksMarked,
 			)
 			if err != nil {
 				return nil, errors.Wrap(err, "create compaction group")
@@ -347,9 +366,19 @@ type Group struct {
 	blocksMarkedForNoCompact    prometheus.Counter
 	hashFunc                    metadata.HashFunc
 	blockFilesConcurrency       int
+	blocksDownloadGate          gate.Gate
+	maxBlockSize                int64
+	splitBlocksMarked           prometheus.Counter
+
+	// planned are the blocks planned by the last compaction of the group.
+	planned []ulid.ULID
 }
 
 // NewGroup returns a new compaction group.
+// Downloads of source blocks wait for blocksDownloadGate, which can be shared by several groups. Nil gate doesn't limit them.
+// If maxBlockSize is greater than 0 and the downloaded source blocks of a compaction exceed it in total, consecutive runs
+// of them, each within maxBlockSize if possible, are compacted into separate blocks. These blocks are marked for no
+// compaction, counted by splitBlocksMarkedForNoCompact, so that they aren't compacted back together.
 func NewGroup(
 	logger log.Logger,
 	bkt objstore.Bucket,
@@ -368,10 +397,16 @@ func NewGroup(
 	blocksMarkedForNoCompact prometheus.Counter,
 	hashFunc metadata.HashFunc,
 	blockFilesConcurrency int,
+	blocksDownloadGate gate.Gate,
+	maxBlockSize int64,
+	splitBlocksMarkedForNoCompact prometheus.Counter,
 ) (*Group, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
+	if blocksDownloadGate == nil {
+		blocksDownloadGate = gate.NewNoop()
+	}
 
 	if blockFilesConcurrency <= 0 {
 		return nil, errors.Errorf("invalid concurrency level (%d), blockFilesConcurrency level must be > 0", blockFilesConcurrency)
@@ -395,6 +430,9 @@ func NewGroup(
 		blocksMarkedForNoCompact:    blocksMarkedForNoCompact,
 		hashFunc:                    hashFunc,
 		blockFilesConcurrency:       blockFilesConcurrency,
+		blocksDownloadGate:          blocksDownloadGate,
+		maxBlockSize:                maxBlockSize,
+		splitBlocksMarked:           splitBlocksMarkedForNoCompact,
 	}
 	return g, nil
 }
@@ -970,6 +1008,16 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	return nil
 }
 
+// downloadBlock downloads the given source block into bdir, once the blocks download gate lets it.
+func (cg *Group) downloadBlock(ctx context.Context, id ulid.ULID, bdir string) error {
+	if err := cg.blocksDownloadGate.Start(ctx); err != nil {
+		return errors.Wrap(err, "wait for blocks download gate")
+	}
+	defer cg.blocksDownloadGate.Done()
+
+	return block.Download(ctx, cg.logger, cg.bkt, id, bdir, objstore.WithFetchConcurrency(cg.blockFilesConcurrency))
+}
+
 func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp Compactor) (shouldRerun bool, compID ulid.ULID, err error) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
@@ -991,9 +1039,13 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		toCompact, err = planner.Plan(ctx, cg.metasByMinTime)
 		return err
 	})
+	cg.planned = cg.planned[:0]
 	if err != nil {
 		return false, ulid.ULID{}, errors.Wrap(err, "plan compaction")
 	}
+	for _, m := range toCompact {
+		cg.planned = append(cg.planned, m.ULID)
+	}
 	if len(toCompact) == 0 {
 		// Nothing to do.
 		return false, ulid.ULID{}, nil
@@ -1009,6 +1061,7 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 	begin := time.Now()
 
 	toCompactDirs := make([]string, 0, len(toCompact))
+	blockSizes := make(map[ulid.ULID]int64, len(toCompact))
 	for _, meta := range toCompact {
 		bdir := filepath.Join(dir, meta.ULID.String())
 		for _, s := range meta.Compaction.Sources {
@@ -1019,7 +1072,7 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		}
 
 		tracing.DoInSpanWithErr(ctx, "compaction_block_download", func(ctx context.Context) error {
-			err = block.Download(ctx, cg.logger, cg.bkt, meta.ULID, bdir, objstore.WithFetchConcurrency(cg.blockFilesConcurrency))
+			err = cg.downloadBlock(ctx, meta.ULID, bdir)
 			return err
 		}, opentracing.Tags{"block.id": meta.ULID})
 		if err != nil {
@@ -1053,16 +1106,95 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 				"block id %s, try running with --debug.accept-malformed-index", meta.ULID)
 		}
 		toCompactDirs = append(toCompactDirs, bdir)
+
+		if cg.maxBlockSize > 0 {
+			files, err := block.GatherFileStats(bdir, metadata.NoneFunc, cg.logger)
+			if err != nil {
+				return false, ulid.ULID{}, errors.Wrapf(err, "gather file stats of block %s", bdir)
+			}
+			for _, f := range files {
+				blockSizes[meta.ULID] += f.SizeBytes
+			}
+		}
 	}
 	level.Info(cg.logger).Log("msg", "downloaded and verified blocks; compacting blocks", "plan", fmt.Sprintf("%v", toCompactDirs), "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
 
-	begin = time.Now()
+	runs := [][]*metadata.Meta{toCompact}
+	if cg.maxBlockSize > 0 && !overlappingBlocks {
+		runs = splitBySize(toCompact, blockSizes, cg.maxBlockSize)
+		if len(runs) > 1 {
+			level.Info(cg.logger).Log("msg", "compacted block would exceed max block size; compacting source blocks in several runs",
+				"runs", len(runs), "max_block_size", cg.maxBlockSize)
+		}
+	}
+
+	for _, run := range runs {
+		if len(runs) > 1 && len(run) == 1 {
+			// Compacting a single block would only rewrite it.
+			if err := block.MarkForNoCompact(ctx, cg.logger, cg.bkt, run[0].ULID, metadata.SplitBlockNoCompactReason,
+				fmt.Sprintf("block exceeds max block size %d", cg.maxBlockSize), cg.splitBlocksMarked); err != nil {
+				return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark block %s for no compaction", run[0].ULID))
+			}
+			continue
+		}
+
+		id, err := cg.compactRun(ctx, dir, comp, run, overlappingBlocks)
+		if err != nil {
+			return false, ulid.ULID{}, err
+		}
+		if id == (ulid.ULID{}) {
+			continue
+		}
+		if len(runs) > 1 {
+			if err := block.MarkForNoCompact(ctx, cg.logger, cg.bkt, id, metadata.SplitBlockNoCompactReason,
+				fmt.Sprintf("compacted in %d runs due to max block size %d", len(runs), cg.maxBlockSize), cg.splitBlocksMarked); err != nil {
+				return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark block %s for no compaction", id))
+			}
+		}
+		if compID == (ulid.ULID{}) {
+			compID = id
+		}
+	}
+	return true, compID, nil
+}
+
+// splitBySize splits metas sorted by min time into consecutive runs whose total size, as given by sizes, doesn't exceed
+// maxSize, unless a single block does.
+func splitBySize(metas []*metadata.Meta, sizes map[ulid.ULID]int64, maxSize int64) [][]*metadata.Meta {
+	var (
+		runs    [][]*metadata.Meta
+		run     []*metadata.Meta
+		runSize int64
+	)
+	for _, m := range metas {
+		if len(run) > 0 && runSize+sizes[m.ULID] > maxSize {
+			runs = append(runs, run)
+			run, runSize = nil, 0
+		}
+		run = append(run, m)
+		runSize += sizes[m.ULID]
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// compactRun compacts the given downloaded blocks, uploads the resulting block and marks the blocks for deletion.
+// It returns the ID of the uploaded block, or an empty ID if the compacted block would have no samples.
+func (cg *Group) compactRun(ctx context.Context, dir string, comp Compactor, toCompact []*metadata.Meta, overlappingBlocks bool) (compID ulid.ULID, err error) {
+	toCompactDirs := make([]string, 0, len(toCompact))
+	for _, meta := range toCompact {
+		toCompactDirs = append(toCompactDirs, filepath.Join(dir, meta.ULID.String()))
+	}
+
+	begin := time.Now()
 	tracing.DoInSpanWithErr(ctx, "compaction", func(ctx context.Context) error {
 		compID, err = comp.Compact(dir, toCompactDirs, nil)
 		return err
 	})
 	if err != nil {
-		return false, ulid.ULID{}, halt(errors.Wrapf(err, "compact blocks %v", toCompactDirs))
+		return ulid.ULID{}, halt(errors.Wrapf(err, "compact blocks %v", toCompactDirs))
 	}
 	if compID == (ulid.ULID{}) {
 		// Prometheus compactor found that the compacted block would have no samples.
@@ -1075,7 +1207,7 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 			}
 		}
 		// Even though this block was empty, there may be more work to do.
-		return true, ulid.ULID{}, nil
+		return ulid.ULID{}, nil
 	}
 	cg.compactions.Inc()
 	if overlappingBlocks {
@@ -1094,11 +1226,11 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		SegmentFiles: block.GetSegmentFiles(bdir),
 	}, nil)
 	if err != nil {
-		return false, ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
+		return ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
 	}
 
 	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
-		return false, ulid.ULID{}, errors.Wrap(err, "remove tombstones")
+		return ulid.ULID{}, errors.Wrap(err, "remove tombstones")
 	}
 
 	// Ensure the output block is valid.
@@ -1107,14 +1239,14 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		return err
 	})
 	if !cg.acceptMalformedIndex && err != nil {
-		return false, ulid.ULID{}, halt(errors.Wrapf(err, "invalid result block %s", bdir))
+		return ulid.ULID{}, halt(errors.Wrapf(err, "invalid result block %s", bdir))
 	}
 
 	// Ensure the output block is not overlapping with anything else,
 	// unless vertical compaction is enabled.
 	if !cg.enableVerticalCompaction {
 		if err := cg.areBlocksOverlapping(newMeta, toCompact...); err != nil {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
+			return ulid.ULID{}, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
 		}
 	}
 
@@ -1125,7 +1257,7 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 		return err
 	})
 	if err != nil {
-		return false, ulid.ULID{}, retry(errors.Wrapf(err, "upload of %s failed", compID))
+		return ulid.ULID{}, retry(errors.Wrapf(err, "upload of %s failed", compID))
 	}
 	level.Info(cg.logger).Log("msg", "uploaded block", "result_block", compID, "duration", time.Since(begin), "duration_ms", time.Since(begin).Milliseconds())
 
@@ -1138,11 +1270,11 @@ func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp
 			return err
 		}, opentracing.Tags{"block.id": meta.ULID})
 		if err != nil {
-			return false, ulid.ULID{}, retry(errors.Wrapf(err, "mark old block for deletion from bucket"))
+			return ulid.ULID{}, retry(errors.Wrapf(err, "mark old block for deletion from bucket"))
 		}
 		cg.groupGarbageCollectedBlocks.Inc()
 	}
-	return true, compID, nil
+	return compID, nil
 }
 
 func (cg *Group) deleteBlock(id ulid.ULID, bdir string) error {
@@ -1171,9 +1303,16 @@ type BucketCompactor struct {
 	bkt                            objstore.Bucket
 	concurrency                    int
 	skipBlocksWithOutOfOrderChunks bool
+
+	maxGroupCompactionAttempts int
+	quarantinedGroups          prometheus.Counter
+	blocksMarkedForNoCompact   prometheus.Counter
 }
 
 // NewBucketCompactor creates a new bucket compactor.
+// If maxGroupCompactionAttempts is greater than 0, a group failing to be compacted is retried up to that number of
+// attempts in total and then quarantined: the blocks planned to be compacted are marked for no compaction and other
+// groups are compacted instead of returning the error, whatever the error is, unless the compaction was canceled.
 func NewBucketCompactor(
 	logger log.Logger,
 	sy *Syncer,
@@ -1184,10 +1323,16 @@ func NewBucketCompactor(
 	bkt objstore.Bucket,
 	concurrency int,
 	skipBlocksWithOutOfOrderChunks bool,
+	maxGroupCompactionAttempts int,
+	quarantinedGroups prometheus.Counter,
+	blocksMarkedForNoCompact prometheus.Counter,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
 		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", concurrency)
 	}
+	if maxGroupCompactionAttempts < 0 {
+		return nil, errors.Errorf("invalid max group compaction attempts (%d), must be >= 0", maxGroupCompactionAttempts)
+	}
 	return &BucketCompactor{
 		logger:                         logger,
 		sy:                             sy,
@@ -1198,9 +1343,48 @@ func NewBucketCompactor(
 		bkt:                            bkt,
 		concurrency:                    concurrency,
 		skipBlocksWithOutOfOrderChunks: skipBlocksWithOutOfOrderChunks,
+		maxGroupCompactionAttempts:     maxGroupCompactionAttempts,
+		quarantinedGroups:              quarantinedGroups,
+		blocksMarkedForNoCompact:       blocksMarkedForNoCompact,
 	}, nil
 }
 
+// compactGroup compacts the group, retrying failed attempts up to the configured number of attempts.
+func (c *BucketCompactor) compactGroup(ctx context.Context, g *Group) (shouldRerun bool, err error) {
+	for attempt := 1; ; attempt++ {
+		shouldRerun, _, err = g.Compact(ctx, c.compactDir, c.planner, c.comp)
+		if err == nil || attempt >= c.maxGroupCompactionAttempts || ctx.Err() != nil {
+			return shouldRerun, err
+		}
+		// These are handled without retrying.
+		if IsIssue347Error(err) || (IsOutOfOrderChunkError(err) && c.skipBlocksWithOutOfOrderChunks) {
+			return shouldRerun, err
+		}
+		level.Warn(c.logger).Log("msg", "group compaction failed, retrying", "group", g.Key(), "attempt", attempt, "err", err)
+	}
+}
+
+// quarantineGroup marks the blocks planned by the failed compaction of the group for no compaction, so they are skipped
+// from now on and the other blocks of the group can still be compacted.
+func (c *BucketCompactor) quarantineGroup(ctx context.Context, g *Group, cause error) error {
+	g.mtx.Lock()
+	planned := append([]ulid.ULID(nil), g.planned...)
+	g.mtx.Unlock()
+	if len(planned) == 0 {
+		return errors.New("no blocks were planned to be compacted")
+	}
+
+	details := fmt.Sprintf("group %s failed to be compacted %d times, last error: %v", g.Key(), c.maxGroupCompactionAttempts, cause)
+	for _, id := range planned {
+		if err := block.MarkForNoCompact(ctx, c.logger, c.bkt, id, metadata.CompactionFailedNoCompactReason, details, c.blocksMarkedForNoCompact); err != nil {
+			return errors.Wrapf(err, "mark block %s for no compaction", id)
+		}
+	}
+	c.quarantinedGroups.Inc()
+	level.Error(c.logger).Log("msg", "quarantined group after failed compaction attempts, its blocks are marked for no compaction", "group", g.Key(), "attempts", c.maxGroupCompactionAttempts, "err", cause)
+	return nil
+}
+
 // Compact runs compaction over bucket.
 func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 	defer func() {
@@ -1234,7 +1418,7 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 			go func() {
 				defer wg.Done()
 				for g := range groupChan {
-					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.planner, c.comp)
+					shouldRerunGroup, err := c.compactGroup(workCtx, g)
 					if err == nil {
 						if shouldRerunGroup {
 							mtx.Lock()
@@ -1269,6 +1453,15 @@ func (c *BucketCompactor) Compact(ctx context.Context) (rerr error) {
 							continue
 						}
 					}
+					// Halt and retry errors quarantine the group as well, otherwise the group would keep halting or
+					// failing the whole compaction. Only canceled compactions don't.
+					if c.maxGroupCompactionAttempts > 0 && workCtx.Err() == nil {
+						qerr := c.quarantineGroup(ctx, g, err)
+						if qerr == nil {
+							continue
+						}
+						level.Error(c.logger).Log("msg", "failed to quarantine group", "group", g.Key(), "err", qerr)
+					}
 					errChan <- errors.Wrapf(err, "group %s", g.Key())
 					return
 				}
@@ -8,22 +8,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"go.uber.org/atomic"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -139,7 +143,7 @@ func TestSyncer_GarbageCollect_e2e(t *testing.T) {
 		testutil.Ok(t, sy.GarbageCollect(ctx))
 
 		// Only the level 3 block, the last source block in both resolutions should be left.
-		grouper := NewDefaultGrouper(nil, bkt, false, false, nil, blocksMarkedForDeletion, garbageCollectedBlocks, blockMarkedForNoCompact, metadata.NoneFunc, 1)
+		grouper := NewDefaultGrouper(nil, bkt, false, false, nil, blocksMarkedForDeletion, garbageCollectedBlocks, blockMarkedForNoCompact, metadata.NoneFunc, 1, 0, 0, nil)
 		groups, err := grouper.Groups(sy.Metas())
 		testutil.Ok(t, err)
 
@@ -180,6 +184,86 @@ func TestGroupCompactPenaltyDedupE2E(t *testing.T) {
 	testGroupCompactE2e(t, dedup.NewChunkSeriesMerger())
 }
 
+func TestVerticalCompaction_OverlappingBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		mergeFunc storage.VerticalChunkSeriesMergeFunc
+	}{
+		{name: "one-to-one", mergeFunc: storage.NewCompactingChunkSeriesMerger(storage.ChainedSeriesMerge)},
+		{name: "penalty", mergeFunc: dedup.NewChunkSeriesMerger()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+			defer cancel()
+
+			logger := log.NewNopLogger()
+			bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+			dir := t.TempDir()
+
+			// Two replicas of the same series with samples at the same timestamps, like produced by Receive replication.
+			series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+			metas := createAndUpload(t, bkt, []blockgenSpec{
+				{numSamples: 100, mint: 0, maxt: 1000, extLset: labels.FromStrings("ext", "1", "replica", "1"), res: 124, series: series},
+				{numSamples: 100, mint: 0, maxt: 1000, extLset: labels.FromStrings("ext", "1", "replica", "2"), res: 124, series: series},
+			}, nil)
+
+			ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 48*time.Hour, fetcherConcurrency)
+			duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+			noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, bkt, 2)
+			metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{
+				ignoreDeletionMarkFilter,
+				block.NewReplicaLabelRemover(logger, []string{"replica"}),
+				duplicateBlocksFilter,
+				noCompactMarkerFilter,
+			})
+			testutil.Ok(t, err)
+
+			blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			blocksMarkedForNoCompact := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			garbageCollectedBlocks := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks)
+			testutil.Ok(t, err)
+
+			comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, tc.mergeFunc)
+			testutil.Ok(t, err)
+
+			planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter, 0)
+			grouper := NewDefaultGrouper(logger, bkt, false, true, nil, blocksMarkedForDeletion, garbageCollectedBlocks, blocksMarkedForNoCompact, metadata.NoneFunc, 1, 0, 0, nil)
+			bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 1, true, 0, nil, nil)
+			testutil.Ok(t, err)
+
+			testutil.Ok(t, bComp.Compact(ctx))
+			testutil.Equals(t, 1.0, promtest.ToFloat64(grouper.verticalCompactions))
+
+			// Both replicas are marked for deletion and replaced by a single deduplicated block without the replica label.
+			for _, m := range metas {
+				ok, err := bkt.Exists(ctx, path.Join(m.ULID.String(), metadata.DeletionMarkFilename))
+				testutil.Ok(t, err)
+				testutil.Assert(t, ok, "block %s should be marked for deletion", m.ULID)
+			}
+
+			var compacted []*metadata.Meta
+			testutil.Ok(t, bkt.Iter(ctx, "", func(n string) error {
+				id, ok := block.IsBlockDir(n)
+				if !ok || id == metas[0].ULID || id == metas[1].ULID {
+					return nil
+				}
+				m, err := block.DownloadMeta(ctx, logger, bkt, id)
+				if err != nil {
+					return err
+				}
+				compacted = append(compacted, &m)
+				return nil
+			}))
+			testutil.Equals(t, 1, len(compacted))
+			testutil.Equals(t, labels.FromStrings("ext", "1").Map(), compacted[0].Thanos.Labels)
+			testutil.Equals(t, uint64(len(series)), compacted[0].Stats.NumSeries)
+			testutil.Equals(t, uint64(len(series)*100), compacted[0].Stats.NumSamples)
+			testutil.Equals(t, []ulid.ULID{metas[0].ULID, metas[1].ULID}, compacted[0].Compaction.Sources)
+		})
+	}
+}
+
 func testGroupCompactE2e(t *testing.T, mergeFunc storage.VerticalChunkSeriesMergeFunc) {
 	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
@@ -213,9 +297,9 @@ func testGroupCompactE2e(t *testing.T, mergeFunc storage.VerticalChunkSeriesMerg
 		comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, []int64{1000, 3000}, nil, mergeFunc)
 		testutil.Ok(t, err)
 
-		planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter)
-		grouper := NewDefaultGrouper(logger, bkt, false, false, reg, blocksMarkedForDeletion, garbageCollectedBlocks, blocksMaredForNoCompact, metadata.NoneFunc, 1)
-		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, true)
+		planner := NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter, 0)
+		grouper := NewDefaultGrouper(logger, bkt, false, false, reg, blocksMarkedForDeletion, garbageCollectedBlocks, blocksMaredForNoCompact, metadata.NoneFunc, 1, 0, 0, nil)
+		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, true, 0, nil, nil)
 		testutil.Ok(t, err)
 
 		// Compaction on empty should not fail.
@@ -422,6 +506,148 @@ func testGroupCompactE2e(t *testing.T, mergeFunc storage.VerticalChunkSeriesMerg
 	})
 }
 
+// groupFailingCompactor fails compactions of blocks from the given group.
+type groupFailingCompactor struct {
+	Compactor
+
+	groupKey string
+	attempts atomic.Int64
+}
+
+func (c *groupFailingCompactor) Compact(dest string, dirs []string, open []*tsdb.Block) (ulid.ULID, error) {
+	if strings.Contains(dirs[0], c.groupKey) {
+		c.attempts.Inc()
+		return ulid.ULID{}, errors.New("compaction failed")
+	}
+	return c.Compactor.Compact(dest, dirs, open)
+}
+
+// prefixFailingBucket fails reads of objects with the given prefix.
+type prefixFailingBucket struct {
+	objstore.Bucket
+
+	prefix string
+}
+
+func (b *prefixFailingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if strings.HasPrefix(name, b.prefix) {
+		return nil, errors.New("get failed")
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+// groupCountingPlanner counts the planned compactions of the given group.
+type groupCountingPlanner struct {
+	Planner
+
+	groupKey string
+	attempts atomic.Int64
+}
+
+func (p *groupCountingPlanner) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	plan, err := p.Planner.Plan(ctx, metasByMinTime)
+	if len(plan) > 0 && plan[0].Thanos.GroupKey() == p.groupKey {
+		p.attempts.Inc()
+	}
+	return plan, err
+}
+
+func TestBucketCompactor_QuarantinesFailingGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// Corrupting the index of a block fails the compaction of its group without halting.
+		corruptIndex bool
+		// Compactions failing in the TSDB compactor return a halt error.
+		failCompactor bool
+		// Failing downloads return a retry error.
+		failDownload bool
+	}{
+		{name: "failing group is quarantined", corruptIndex: true},
+		{name: "group failing with halt error is quarantined", failCompactor: true},
+		{name: "group failing with retry error is quarantined", failDownload: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+			defer cancel()
+
+			logger := log.NewNopLogger()
+			bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+			dir := t.TempDir()
+
+			var specs []blockgenSpec
+			for _, extLset := range []labels.Labels{labels.FromStrings("e1", "failing"), labels.FromStrings("e1", "healthy")} {
+				for mint := int64(0); mint < 4000; mint += 1000 {
+					specs = append(specs, blockgenSpec{
+						numSamples: 10, mint: mint, maxt: mint + 1000, extLset: extLset, res: 0,
+						series: []labels.Labels{labels.FromStrings("a", "1")},
+					})
+				}
+			}
+			metas := createAndUpload(t, bkt, specs, nil)
+			failingMetas, healthyMetas := metas[:4], metas[4:]
+			if tc.corruptIndex {
+				testutil.Ok(t, bkt.Upload(ctx, path.Join(failingMetas[0].ULID.String(), block.IndexFilename), strings.NewReader("corrupted")))
+			}
+
+			ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 48*time.Hour, fetcherConcurrency)
+			duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+			noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, bkt, 2)
+			metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{
+				ignoreDeletionMarkFilter,
+				duplicateBlocksFilter,
+				noCompactMarkerFilter,
+			})
+			testutil.Ok(t, err)
+
+			reg := prometheus.NewRegistry()
+			blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			garbageCollectedBlocks := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks)
+			testutil.Ok(t, err)
+
+			var comp Compactor
+			comp, err = tsdb.NewLeveledCompactor(ctx, reg, logger, []int64{1000, 3000}, nil, nil)
+			testutil.Ok(t, err)
+			if tc.failCompactor {
+				comp = &groupFailingCompactor{Compactor: comp, groupKey: failingMetas[0].Thanos.GroupKey()}
+			}
+
+			var groupBkt objstore.Bucket = bkt
+			if tc.failDownload {
+				groupBkt = &prefixFailingBucket{Bucket: bkt, prefix: path.Join(failingMetas[0].ULID.String(), block.ChunksDirname)}
+			}
+
+			planner := &groupCountingPlanner{Planner: NewPlanner(logger, []int64{1000, 3000}, noCompactMarkerFilter, 0), groupKey: failingMetas[0].Thanos.GroupKey()}
+			grouper := NewDefaultGrouper(logger, groupBkt, false, false, reg, blocksMarkedForDeletion, garbageCollectedBlocks, promauto.With(nil).NewCounter(prometheus.CounterOpts{}), metadata.NoneFunc, 1, 0, 0, nil)
+			quarantinedGroups := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			blocksMarkedForNoCompact := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+			bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 1, false, 3, quarantinedGroups, blocksMarkedForNoCompact)
+			testutil.Ok(t, err)
+
+			testutil.Ok(t, bComp.Compact(ctx))
+
+			// The failing group was attempted the configured number of times and then quarantined.
+			testutil.Equals(t, int64(3), planner.attempts.Load())
+			testutil.Equals(t, 1.0, promtest.ToFloat64(quarantinedGroups))
+			testutil.Equals(t, 3.0, promtest.ToFloat64(blocksMarkedForNoCompact))
+			// Only the blocks planned to be compacted are marked for no compaction.
+			for i, m := range failingMetas {
+				ok, err := bkt.Exists(ctx, path.Join(m.ULID.String(), metadata.NoCompactMarkFilename))
+				testutil.Ok(t, err)
+				testutil.Equals(t, i < 3, ok)
+			}
+
+			// The other group was compacted: its first three blocks were replaced by a compacted one.
+			for _, m := range healthyMetas[:3] {
+				ok, err := bkt.Exists(ctx, path.Join(m.ULID.String(), metadata.DeletionMarkFilename))
+				testutil.Ok(t, err)
+				testutil.Assert(t, ok, "expected block %s of the healthy group to be compacted", m.ULID)
+			}
+			testutil.Equals(t, 1.0, promtest.ToFloat64(grouper.compactions.WithLabelValues(healthyMetas[0].Thanos.GroupKey())))
+		})
+	}
+}
+
 type blockgenSpec struct {
 	mint, maxt int64
 	series     []labels.Labels
@@ -470,6 +696,100 @@ func createBlock(t testing.TB, ctx context.Context, prepareDir string, b blockge
 }
 
 // Regression test for #2459 issue.
+func TestBucketCompactor_SplitsOversizedCompaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+	dir := t.TempDir()
+
+	var specs []blockgenSpec
+	for mint := int64(0); mint < 5000; mint += 1000 {
+		specs = append(specs, blockgenSpec{
+			numSamples: 100, mint: mint, maxt: mint + 1000, extLset: labels.FromStrings("e1", "1"), res: 0,
+			series: []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2"), labels.FromStrings("a", "3")},
+		})
+	}
+	metas := createAndUpload(t, bkt, specs, nil)
+
+	// Allow two source blocks per compacted block.
+	m, err := block.DownloadMeta(ctx, logger, bkt, metas[0].ULID)
+	testutil.Ok(t, err)
+	var blockSize int64
+	for _, f := range m.Thanos.Files {
+		blockSize += f.SizeBytes
+	}
+	testutil.Assert(t, blockSize > 0, "expected block size")
+
+	ignoreDeletionMarkFilter := block.NewIgnoreDeletionMarkFilter(logger, bkt, 48*time.Hour, fetcherConcurrency)
+	duplicateBlocksFilter := block.NewDeduplicateFilter(fetcherConcurrency)
+	noCompactMarkerFilter := NewGatherNoCompactionMarkFilter(logger, bkt, 2)
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil, []block.MetadataFilter{
+		ignoreDeletionMarkFilter,
+		duplicateBlocksFilter,
+		noCompactMarkerFilter,
+	})
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	garbageCollectedBlocks := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion, garbageCollectedBlocks)
+	testutil.Ok(t, err)
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, []int64{1000, 4000}, nil, nil)
+	testutil.Ok(t, err)
+
+	splitBlocksMarked := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	planner := NewPlanner(logger, []int64{1000, 4000}, noCompactMarkerFilter, 0)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, blocksMarkedForDeletion, garbageCollectedBlocks, promauto.With(nil).NewCounter(prometheus.CounterOpts{}), metadata.NoneFunc, 1, 0, blockSize*5/2, splitBlocksMarked)
+	bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 1, false, 0, nil, nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bComp.Compact(ctx))
+
+	// The first four blocks were compacted in two runs of two blocks.
+	for _, m := range metas[:4] {
+		ok, err := bkt.Exists(ctx, path.Join(m.ULID.String(), metadata.DeletionMarkFilename))
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok, "expected block %s to be compacted", m.ULID)
+	}
+	testutil.Equals(t, 2.0, promtest.ToFloat64(grouper.compactions.WithLabelValues(metas[0].Thanos.GroupKey())))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(splitBlocksMarked))
+
+	sources := map[ulid.ULID]struct{}{}
+	for _, m := range metas {
+		sources[m.ULID] = struct{}{}
+	}
+	var compacted [][2]int64
+	testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+		if _, ok := sources[id]; ok {
+			return nil
+		}
+		m, err := block.DownloadMeta(ctx, logger, bkt, id)
+		if err != nil {
+			return err
+		}
+		compacted = append(compacted, [2]int64{m.MinTime, m.MaxTime})
+
+		ok, err = bkt.Exists(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("expected block %s to be marked for no compaction", id)
+		}
+		return nil
+	}))
+	sort.Slice(compacted, func(i, j int) bool { return compacted[i][0] < compacted[j][0] })
+	testutil.Equals(t, [][2]int64{{0, 2000}, {2000, 4000}}, compacted)
+}
+
 func TestGarbageCollectDoesntCreateEmptyBlocksWithDeletionMarksOnly(t *testing.T) {
 	logger := log.NewLogfmtLogger(os.Stderr)
 
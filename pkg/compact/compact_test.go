@@ -8,8 +8,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,7 +24,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/tsdb"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/errutil"
@@ -210,7 +216,7 @@ func TestRetentionProgressCalculate(t *testing.T) {
 
 	var bkt objstore.Bucket
 	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for compact progress tests"})
-	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1, 0, 0, nil)
 
 	type groupedResult map[string]float64
 
@@ -376,7 +382,7 @@ func TestCompactProgressCalculate(t *testing.T) {
 
 	var bkt objstore.Bucket
 	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for compact progress tests"})
-	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1, 0, 0, nil)
 
 	for _, tcase := range []struct {
 		testName string
@@ -498,7 +504,7 @@ func TestDownsampleProgressCalculate(t *testing.T) {
 
 	var bkt objstore.Bucket
 	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for downsample progress tests"})
-	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1)
+	grouper := NewDefaultGrouper(logger, bkt, false, false, reg, temp, temp, temp, "", 1, 0, 0, nil)
 
 	for _, tcase := range []struct {
 		testName string
@@ -595,3 +601,82 @@ func TestDownsampleProgressCalculate(t *testing.T) {
 		}
 	}
 }
+
+// concurrencyTrackingBucket records the maximum number of Get calls in flight at once.
+type concurrencyTrackingBucket struct {
+	objstore.Bucket
+
+	mtx         sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (b *concurrencyTrackingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mtx.Unlock()
+
+	defer func() {
+		b.mtx.Lock()
+		b.inFlight--
+		b.mtx.Unlock()
+	}()
+	// Make downloads slow enough to overlap.
+	time.Sleep(10 * time.Millisecond)
+	return b.Bucket.Get(ctx, name)
+}
+
+func TestBlocksDownloadConcurrency(t *testing.T) {
+	const limit = 2
+
+	ctx := context.Background()
+	bkt := &concurrencyTrackingBucket{Bucket: objstore.NewInMemBucket()}
+
+	// Blocks of several groups, all downloaded at once.
+	var metas []*metadata.Meta
+	for i := 0; i < 12; i++ {
+		m := createBlockMeta(uint64(i+1), 0, 100, map[string]string{"group": fmt.Sprintf("%d", i%3)}, downsample.ResLevel0, []uint64{uint64(i + 1)})
+		m.Version = metadata.TSDBVersion1
+		m.Thanos.Version = metadata.ThanosVersion1
+		b, err := json.Marshal(m)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), metadata.MetaFilename), bytes.NewReader(b)))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+		metas = append(metas, m)
+	}
+
+	reg := prometheus.NewRegistry()
+	temp := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_metric_for_group", Help: "this is a test metric for download concurrency tests"})
+	grouper := NewDefaultGrouper(log.NewNopLogger(), bkt, false, false, reg, temp, temp, temp, "", 1, limit, 0, nil)
+
+	blocks := map[ulid.ULID]*metadata.Meta{}
+	for _, m := range metas {
+		blocks[m.ULID] = m
+	}
+	groups, err := grouper.Groups(blocks)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(groups))
+
+	dir := t.TempDir()
+	var g errgroup.Group
+	for _, group := range groups {
+		group := group
+		for _, m := range group.metasByMinTime {
+			id := m.ULID
+			g.Go(func() error {
+				return group.downloadBlock(ctx, id, filepath.Join(dir, id.String()))
+			})
+		}
+	}
+	testutil.Ok(t, g.Wait())
+
+	testutil.Assert(t, bkt.maxInFlight <= limit, "downloads in flight %d exceeded the limit %d", bkt.maxInFlight, limit)
+	testutil.Equals(t, limit, bkt.maxInFlight)
+	for _, m := range metas {
+		_, err := os.Stat(filepath.Join(dir, m.ULID.String(), block.IndexFilename))
+		testutil.Ok(t, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// RemoveExpiredNoCompactMarks removes the no-compact markers which were created more than maxAge ago, so that their
+// blocks become compactable again. Blocks excluded from compaction by the compactor itself, e.g. because of out of
+// order chunks, are marked again if they still can't be compacted. A maxAge of 0 disables it.
+func RemoveExpiredNoCompactMarks(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	noCompactMarks map[ulid.ULID]*metadata.NoCompactMark,
+	maxAge time.Duration,
+	noCompactMarksRemoved prometheus.Counter,
+) error {
+	if maxAge <= 0 {
+		return nil
+	}
+
+	for id, m := range noCompactMarks {
+		markedAt := time.Unix(m.NoCompactTime, 0)
+		if time.Since(markedAt) <= maxAge {
+			continue
+		}
+
+		if err := bkt.Delete(ctx, path.Join(id.String(), metadata.NoCompactMarkFilename)); err != nil && !bkt.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "remove no-compact mark of block %s", id)
+		}
+		noCompactMarksRemoved.Inc()
+		level.Info(logger).Log("msg", "removed expired no-compact mark, block is compactable again", "block", id, "reason", m.Reason, "markedAt", markedAt.String(), "details", m.Details)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRemoveExpiredNoCompactMarks(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := objstore.WithNoopInstr(objstore.NewInMemBucket())
+
+	aged := ulid.MustParse("01CPHBEX20729MJQZXE3W0BW48")
+	fresh := ulid.MustParse("01CPHBEX20729MJQZXE3W0BW49")
+	now := time.Now()
+	for _, id := range []ulid.ULID{aged, fresh} {
+		uploadMockBlock(t, bkt, id.String(), now.Add(-4*time.Hour), now.Add(-2*time.Hour), int64(compact.ResolutionLevelRaw))
+	}
+	b, err := json.Marshal(metadata.NoCompactMark{
+		ID:            aged,
+		Version:       metadata.NoCompactMarkVersion1,
+		NoCompactTime: now.Add(-8 * 24 * time.Hour).Unix(),
+		Reason:        metadata.ManualNoCompactReason,
+	})
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(aged.String(), metadata.NoCompactMarkFilename), bytes.NewReader(b)))
+	testutil.Ok(t, block.MarkForNoCompact(ctx, logger, bkt, fresh, metadata.ManualNoCompactReason, "", prometheus.NewCounter(prometheus.CounterOpts{})))
+
+	filter := compact.NewGatherNoCompactionMarkFilter(logger, bkt, 1)
+	gather := func() map[ulid.ULID]*metadata.NoCompactMark {
+		metas := map[ulid.ULID]*metadata.Meta{aged: {}, fresh: {}}
+		testutil.Ok(t, filter.Filter(ctx, metas, extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"}), nil))
+		return filter.NoCompactMarkedBlocks()
+	}
+	testutil.Equals(t, 2, len(gather()))
+
+	removed := prometheus.NewCounter(prometheus.CounterOpts{})
+	// A max age of 0 disables it.
+	testutil.Ok(t, compact.RemoveExpiredNoCompactMarks(ctx, logger, bkt, gather(), 0, removed))
+	testutil.Equals(t, 2, len(gather()))
+
+	testutil.Ok(t, compact.RemoveExpiredNoCompactMarks(ctx, logger, bkt, gather(), 7*24*time.Hour, removed))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(removed))
+
+	// The aged block is compactable again, while the freshly marked one is still excluded.
+	marked := gather()
+	testutil.Equals(t, 1, len(marked))
+	_, ok := marked[fresh]
+	testutil.Assert(t, ok, "fresh block should still be marked")
+	exists, err := bkt.Exists(ctx, path.Join(aged.String(), metadata.NoCompactMarkFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, !exists, "no-compact mark of the aged block should be removed")
+}
@@ -0,0 +1,187 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// OverlapReport lists the blocks with overlapping time ranges of every compaction group, i.e. the blocks vertical
+// compaction would merge.
+type OverlapReport struct {
+	Groups []*GroupOverlaps `json:"groups"`
+}
+
+// GroupOverlaps are the overlapping blocks of a compaction group.
+type GroupOverlaps struct {
+	Key        string            `json:"key"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	// Planned are the blocks the planner would merge in the first vertical compaction of the group.
+	Planned []ulid.ULID     `json:"planned"`
+	Pairs   []*BlockOverlap `json:"pairs"`
+}
+
+// BlockOverlap describes two blocks of a group with overlapping time ranges.
+type BlockOverlap struct {
+	A ulid.ULID `json:"a"`
+	B ulid.ULID `json:"b"`
+	// MinTime and MaxTime are the time range covered by both blocks.
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+	// SamplesEstimate is the estimated number of samples of the overlap found in both blocks, assuming samples are
+	// evenly spread over the time range of each block.
+	SamplesEstimate uint64 `json:"samples_estimate"`
+	// CommonSeries is the number of series found in both blocks. It's only set once the indexes of the blocks were read.
+	CommonSeries *uint64 `json:"common_series,omitempty"`
+}
+
+// FindOverlaps groups the given blocks by compaction group and returns the pairs of blocks with overlapping time
+// ranges. Groups without overlaps are left out.
+func FindOverlaps(metas map[ulid.ULID]*metadata.Meta) *OverlapReport {
+	groups := map[string][]*metadata.Meta{}
+	for _, m := range metas {
+		groups[m.Thanos.GroupKey()] = append(groups[m.Thanos.GroupKey()], m)
+	}
+
+	r := &OverlapReport{Groups: []*GroupOverlaps{}}
+	for key, metasByMinTime := range groups {
+		sort.Slice(metasByMinTime, func(i, j int) bool {
+			if metasByMinTime[i].MinTime == metasByMinTime[j].MinTime {
+				return metasByMinTime[i].ULID.Compare(metasByMinTime[j].ULID) < 0
+			}
+			return metasByMinTime[i].MinTime < metasByMinTime[j].MinTime
+		})
+
+		g := &GroupOverlaps{
+			Key:        key,
+			Labels:     metasByMinTime[0].Thanos.Labels,
+			Resolution: metasByMinTime[0].Thanos.Downsample.Resolution,
+		}
+		for i, a := range metasByMinTime {
+			for _, b := range metasByMinTime[i+1:] {
+				if b.MinTime >= a.MaxTime {
+					break
+				}
+				g.Pairs = append(g.Pairs, newBlockOverlap(a, b))
+			}
+		}
+		if len(g.Pairs) == 0 {
+			continue
+		}
+		for _, m := range selectOverlappingMetas(metasByMinTime) {
+			g.Planned = append(g.Planned, m.ULID)
+		}
+		r.Groups = append(r.Groups, g)
+	}
+
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return r.Groups[i].Key < r.Groups[j].Key
+	})
+	return r
+}
+
+func newBlockOverlap(a, b *metadata.Meta) *BlockOverlap {
+	o := &BlockOverlap{A: a.ULID, B: b.ULID, MinTime: b.MinTime, MaxTime: a.MaxTime}
+	if b.MaxTime < o.MaxTime {
+		o.MaxTime = b.MaxTime
+	}
+
+	estimate := func(m *metadata.Meta) uint64 {
+		if m.MaxTime <= m.MinTime {
+			return m.Stats.NumSamples
+		}
+		return uint64(float64(m.Stats.NumSamples) * float64(o.MaxTime-o.MinTime) / float64(m.MaxTime-m.MinTime))
+	}
+	o.SamplesEstimate = estimate(a)
+	if e := estimate(b); e < o.SamplesEstimate {
+		o.SamplesEstimate = e
+	}
+	return o
+}
+
+// CountCommonSeries sets the number of series found in both blocks of every pair of the report. It downloads the
+// index files of the blocks to dir, one at a time, and removes them once read. Chunk files are never downloaded.
+func (r *OverlapReport) CountCommonSeries(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string) error {
+	series := map[ulid.ULID]map[uint64]struct{}{}
+	for _, g := range r.Groups {
+		for _, p := range g.Pairs {
+			for _, id := range []ulid.ULID{p.A, p.B} {
+				if _, ok := series[id]; ok {
+					continue
+				}
+				hashes, err := readSeriesHashes(ctx, logger, bkt, id, dir)
+				if err != nil {
+					return errors.Wrapf(err, "read series of block %s", id)
+				}
+				series[id] = hashes
+			}
+
+			var common uint64
+			for h := range series[p.A] {
+				if _, ok := series[p.B][h]; ok {
+					common++
+				}
+			}
+			p.CommonSeries = &common
+		}
+	}
+	return nil
+}
+
+// readSeriesHashes returns the hashes of the label sets of all series of the block, read from its index file.
+func readSeriesHashes(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, id ulid.ULID, dir string) (_ map[uint64]struct{}, err error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "create dir")
+	}
+	fn := filepath.Join(dir, id.String()+"-"+block.IndexFilename)
+	if err := objstore.DownloadFile(ctx, logger, bkt, path.Join(id.String(), block.IndexFilename), fn); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := os.Remove(fn); rerr != nil {
+			level.Warn(logger).Log("msg", "failed to remove index file", "file", fn, "err", rerr)
+		}
+	}()
+
+	ir, err := index.NewFileReader(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "open index file")
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "index reader")
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "get all postings")
+	}
+	var (
+		hashes = map[uint64]struct{}{}
+		lset   labels.Labels
+		chks   []chunks.Meta
+	)
+	for p.Next() {
+		if err := ir.Series(p.At(), &lset, &chks); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+		hashes[lset.Hash()] = struct{}{}
+	}
+	return hashes, p.Err()
+}
@@ -0,0 +1,99 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package compact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
+)
+
+// getRecordingBucket records the names of the objects read from it.
+type getRecordingBucket struct {
+	objstore.Bucket
+
+	mtx  sync.Mutex
+	gets []string
+}
+
+func (b *getRecordingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	b.gets = append(b.gets, name)
+	b.mtx.Unlock()
+	return b.Bucket.Get(ctx, name)
+}
+
+func TestOverlapReport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt := &getRecordingBucket{Bucket: objstore.NewInMemBucket()}
+
+	seriesRange := func(from, to int) []labels.Labels {
+		var series []labels.Labels
+		for i := from; i < to; i++ {
+			series = append(series, labels.FromStrings("a", fmt.Sprintf("%d", i)))
+		}
+		return series
+	}
+	metas := map[ulid.ULID]*metadata.Meta{}
+	createBlock := func(series []labels.Labels, mint, maxt int64, extLset labels.Labels) ulid.ULID {
+		id, err := e2eutil.CreateBlock(ctx, dir, series, 100, mint, maxt, extLset, 0, metadata.NoneFunc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(dir, id.String()), metadata.NoneFunc))
+		meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		metas[id] = meta
+		return id
+	}
+
+	extLset := labels.FromStrings("tenant", "a")
+	a := createBlock(seriesRange(0, 10), 0, 1000, extLset)
+	// Overlaps the second half of a, with half of its series.
+	b := createBlock(seriesRange(5, 15), 500, 1500, extLset)
+	// Overlaps neither a nor b.
+	createBlock(seriesRange(0, 10), 2000, 3000, extLset)
+	// Overlaps a and b, but belongs to another group.
+	createBlock(seriesRange(0, 10), 0, 1500, labels.FromStrings("tenant", "b"))
+	bkt.gets = nil
+
+	r := FindOverlaps(metas)
+	testutil.Equals(t, 1, len(r.Groups))
+	g := r.Groups[0]
+	testutil.Equals(t, map[string]string{"tenant": "a"}, g.Labels)
+	testutil.Equals(t, int64(0), g.Resolution)
+	testutil.Equals(t, []ulid.ULID{a, b}, g.Planned)
+	testutil.Equals(t, 1, len(g.Pairs))
+
+	p := g.Pairs[0]
+	testutil.Equals(t, a, p.A)
+	testutil.Equals(t, b, p.B)
+	testutil.Equals(t, int64(500), p.MinTime)
+	testutil.Equals(t, int64(1000), p.MaxTime)
+	// Half of the samples of both blocks fall into the overlap.
+	testutil.Equals(t, metas[a].Stats.NumSamples/2, p.SamplesEstimate)
+	testutil.Assert(t, p.CommonSeries == nil, "common series set before reading indexes")
+
+	testutil.Ok(t, r.CountCommonSeries(ctx, log.NewNopLogger(), bkt, t.TempDir()))
+	testutil.Equals(t, uint64(5), *p.CommonSeries)
+
+	// Only the indexes of the overlapping blocks were read.
+	testutil.Equals(t, 2, len(bkt.gets))
+	for _, name := range bkt.gets {
+		testutil.Assert(t, strings.HasSuffix(name, "/"+block.IndexFilename), "unexpected object read: %s", name)
+	}
+}
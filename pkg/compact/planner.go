@@ -8,11 +8,13 @@ import (
 	"fmt"
 	"math"
 	"path/filepath"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/timestamp"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
@@ -23,6 +25,9 @@ type tsdbBasedPlanner struct {
 	logger log.Logger
 
 	ranges []int64
+	// backfillWindow is the duration after which groups whose most recent block ended are considered backfilled.
+	// 0 disables it.
+	backfillWindow time.Duration
 
 	noCompBlocksFunc func() map[ulid.ULID]*metadata.NoCompactMark
 }
@@ -44,8 +49,10 @@ func NewTSDBBasedPlanner(logger log.Logger, ranges []int64) *tsdbBasedPlanner {
 
 // NewPlanner is a default Thanos planner with the same functionality as Prometheus' TSDB plus special handling of excluded blocks.
 // It's the same functionality just without accessing filesystem, and special handling of excluded blocks.
-func NewPlanner(logger log.Logger, ranges []int64, noCompBlocks *GatherNoCompactionMarkFilter) *tsdbBasedPlanner {
-	return &tsdbBasedPlanner{logger: logger, ranges: ranges, noCompBlocksFunc: noCompBlocks.NoCompactMarkedBlocks}
+// Groups whose most recent block ended longer than backfillWindow ago are considered backfilled historical data, which
+// won't be followed by newer blocks, so their most recent block and incomplete ranges are compacted as well. 0 disables it.
+func NewPlanner(logger log.Logger, ranges []int64, noCompBlocks *GatherNoCompactionMarkFilter, backfillWindow time.Duration) *tsdbBasedPlanner {
+	return &tsdbBasedPlanner{logger: logger, ranges: ranges, backfillWindow: backfillWindow, noCompBlocksFunc: noCompBlocks.NoCompactMarkedBlocks}
 }
 
 // TODO(bwplotka): Consider smarter algorithm, this prefers smaller iterative compactions vs big single one: https://github.com/thanos-io/thanos/issues/3405
@@ -70,11 +77,16 @@ func (p *tsdbBasedPlanner) plan(noCompactMarked map[ulid.ULID]*metadata.NoCompac
 
 	// We do not include a recently producted block with max(minTime), so the block which was just uploaded to bucket.
 	// This gives users a window of a full block size maintenance if needed.
-	if _, excluded := noCompactMarked[metasByMinTime[len(metasByMinTime)-1].ULID]; !excluded {
-		notExcludedMetasByMinTime = notExcludedMetasByMinTime[:len(notExcludedMetasByMinTime)-1]
+	// Backfilled blocks aren't followed by newer ones though, so all of them are included to not leave the most recent
+	// ones uncompacted and hence not downsampled forever.
+	backfilled := p.backfilled(metasByMinTime)
+	if !backfilled {
+		if _, excluded := noCompactMarked[metasByMinTime[len(metasByMinTime)-1].ULID]; !excluded {
+			notExcludedMetasByMinTime = notExcludedMetasByMinTime[:len(notExcludedMetasByMinTime)-1]
+		}
+		metasByMinTime = metasByMinTime[:len(metasByMinTime)-1]
 	}
-	metasByMinTime = metasByMinTime[:len(metasByMinTime)-1]
-	res = append(res, selectMetas(p.ranges, noCompactMarked, metasByMinTime)...)
+	res = append(res, selectMetas(p.ranges, noCompactMarked, metasByMinTime, backfilled)...)
 	if len(res) > 0 {
 		return res, nil
 	}
@@ -93,14 +105,32 @@ func (p *tsdbBasedPlanner) plan(noCompactMarked map[ulid.ULID]*metadata.NoCompac
 	return nil, nil
 }
 
+// backfilled returns true if the most recent of the given blocks ended longer than the backfill window ago.
+func (p *tsdbBasedPlanner) backfilled(metasByMinTime []*metadata.Meta) bool {
+	if p.backfillWindow <= 0 {
+		return false
+	}
+	var maxTime int64 = math.MinInt64
+	for _, m := range metasByMinTime {
+		if m.MaxTime > maxTime {
+			maxTime = m.MaxTime
+		}
+	}
+	return timestamp.Time(maxTime).Before(time.Now().Add(-p.backfillWindow))
+}
+
 // selectMetas returns the dir metas that should be compacted into a single new block.
 // If only a single block range is configured, the result is always nil.
+// Ranges which aren't complete yet are only selected if all blocks are backfilled, as no more blocks would fit in them.
 // Copied and adjusted from https://github.com/prometheus/prometheus/blob/3d8826a3d42566684283a9b7f7e812e412c24407/tsdb/compact.go#L229.
-func selectMetas(ranges []int64, noCompactMarked map[ulid.ULID]*metadata.NoCompactMark, metasByMinTime []*metadata.Meta) []*metadata.Meta {
+func selectMetas(ranges []int64, noCompactMarked map[ulid.ULID]*metadata.NoCompactMark, metasByMinTime []*metadata.Meta, backfilled bool) []*metadata.Meta {
 	if len(ranges) < 2 || len(metasByMinTime) < 1 {
 		return nil
 	}
 	highTime := metasByMinTime[len(metasByMinTime)-1].MinTime
+	if backfilled {
+		highTime = math.MaxInt64
+	}
 
 	for _, iv := range ranges[1:] {
 		parts := splitByRange(metasByMinTime, iv)
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
@@ -18,10 +19,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -464,7 +467,7 @@ func TestTSDBBasedPlanner_PlanWithNoCompactMarks(t *testing.T) {
 	}
 
 	g := &GatherNoCompactionMarkFilter{}
-	tsdbBasedPlanner := NewPlanner(log.NewNopLogger(), ranges, g)
+	tsdbBasedPlanner := NewPlanner(log.NewNopLogger(), ranges, g, 0)
 
 	for _, c := range []struct {
 		name           string
@@ -646,6 +649,65 @@ func TestTSDBBasedPlanner_PlanWithNoCompactMarks(t *testing.T) {
 	}
 }
 
+func TestTSDBBasedPlanner_PlanBackfilled(t *testing.T) {
+	const hour = int64(time.Hour / time.Millisecond)
+	ranges := []int64{2 * hour, 8 * hour, 48 * hour, 14 * 24 * hour}
+
+	// compactAll compacts the given blocks the way the compactor does, until there's nothing left to compact.
+	compactAll := func(t *testing.T, planner Planner, metas []*metadata.Meta) []*metadata.Meta {
+		for i := 0; ; i++ {
+			plan, err := planner.Plan(context.Background(), metas)
+			testutil.Ok(t, err)
+			if len(plan) == 0 {
+				return metas
+			}
+			planned := map[ulid.ULID]struct{}{}
+			for _, m := range plan {
+				planned[m.ULID] = struct{}{}
+			}
+			res := []*metadata.Meta{{BlockMeta: tsdb.BlockMeta{Version: 1, ULID: ulid.MustNew(uint64(1000+i), nil), MinTime: plan[0].MinTime, MaxTime: plan[len(plan)-1].MaxTime}}}
+			for _, m := range metas {
+				if _, ok := planned[m.ULID]; !ok {
+					res = append(res, m)
+				}
+			}
+			sort.Slice(res, func(i, j int) bool {
+				return res[i].MinTime < res[j].MinTime
+			})
+			metas = res
+		}
+	}
+	// blocks returns the 2h blocks of the given number of hours, starting at the given time.
+	blocks := func(start int64, hours int) []*metadata.Meta {
+		var metas []*metadata.Meta
+		for i := 0; i < hours/2; i++ {
+			metas = append(metas, &metadata.Meta{BlockMeta: tsdb.BlockMeta{Version: 1, ULID: ulid.MustNew(uint64(i), nil), MinTime: start + int64(i)*2*hour, MaxTime: start + int64(i+1)*2*hour}})
+		}
+		return metas
+	}
+
+	t.Run("backfilled blocks are compacted entirely and reach the downsampling range", func(t *testing.T) {
+		metas := compactAll(t, NewPlanner(log.NewNopLogger(), ranges, &GatherNoCompactionMarkFilter{}, 24*time.Hour), blocks(0, 48))
+		testutil.Equals(t, 1, len(metas))
+		testutil.Equals(t, int64(0), metas[0].MinTime)
+		testutil.Equals(t, 48*hour, metas[0].MaxTime)
+		testutil.Assert(t, metas[0].MaxTime-metas[0].MinTime >= downsample.ResLevel1DownsampleRange, "compacted block is too short to be downsampled")
+	})
+	t.Run("without the backfill window, the most recent backfilled blocks are never compacted", func(t *testing.T) {
+		metas := compactAll(t, NewPlanner(log.NewNopLogger(), ranges, &GatherNoCompactionMarkFilter{}, 0), blocks(0, 48))
+		last := metas[len(metas)-1]
+		testutil.Equals(t, 2*hour, last.MaxTime-last.MinTime)
+	})
+	t.Run("most recent block of recent blocks is held back", func(t *testing.T) {
+		now := timestamp.FromTime(time.Now())
+		start := now - now%(8*hour) - 8*hour
+		metas := compactAll(t, NewPlanner(log.NewNopLogger(), ranges, &GatherNoCompactionMarkFilter{}, 24*time.Hour), blocks(start, 12))
+		last := metas[len(metas)-1]
+		testutil.Equals(t, 2*hour, last.MaxTime-last.MinTime)
+		testutil.Equals(t, start+12*hour, last.MaxTime)
+	})
+}
+
 func TestLargeTotalIndexSizeFilter_Plan(t *testing.T) {
 	ranges := []int64{
 		20,
@@ -659,7 +721,7 @@ func TestLargeTotalIndexSizeFilter_Plan(t *testing.T) {
 	g := &GatherNoCompactionMarkFilter{}
 
 	marked := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
-	planner := WithLargeTotalIndexSizeFilter(NewPlanner(log.NewNopLogger(), ranges, g), bkt, 100, marked)
+	planner := WithLargeTotalIndexSizeFilter(NewPlanner(log.NewNopLogger(), ranges, g, 0), bkt, 100, marked)
 	var lastMarkValue float64
 	for _, c := range []struct {
 		name  string
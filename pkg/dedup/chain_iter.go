@@ -0,0 +1,122 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package dedup
+
+import (
+	"math"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// chainSeriesIterator concatenates the samples of replicas in timestamp order. It stays on the replica it takes samples
+// from until that replica has a gap, i.e. its next sample is more than twice its previous interval away or it has no
+// more samples, and only then switches to the replica with the earliest sample in the gap. Replicas scraped at offset
+// timestamps are therefore not interleaved, and the output is the same for the same replicas.
+type chainSeriesIterator struct {
+	replicas []*chainReplica
+
+	// cur is the replica of the current sample, -1 before the first one.
+	cur   int
+	lastT int64
+}
+
+// chainReplica is a replica iterator which tracks the intervals between its samples.
+type chainReplica struct {
+	it chunkenc.Iterator
+	ok bool
+
+	// prevT is the timestamp of the sample before the current one, and delta the interval before prevT, both unknown
+	// while they are math.MinInt64 and 0.
+	prevT int64
+	delta int64
+}
+
+func newChainSeriesIterator(its []chunkenc.Iterator) *chainSeriesIterator {
+	replicas := make([]*chainReplica, 0, len(its))
+	for _, it := range its {
+		replicas = append(replicas, &chainReplica{it: it, ok: it.Next(), prevT: math.MinInt64})
+	}
+	return &chainSeriesIterator{replicas: replicas, cur: -1, lastT: math.MinInt64}
+}
+
+// advance moves the replica to its first sample at or after t. Samples are iterated rather than sought, to keep track of
+// the intervals.
+func (r *chainReplica) advance(t int64) {
+	for r.ok {
+		rt, _ := r.it.At()
+		if rt >= t {
+			return
+		}
+		if r.prevT != math.MinInt64 {
+			r.delta = rt - r.prevT
+		}
+		r.prevT = rt
+		r.ok = r.it.Next()
+	}
+}
+
+// hasGap returns true if the replica has no more samples, or if its current sample is more than twice its previous
+// interval after the sample before.
+func (r *chainReplica) hasGap() bool {
+	if !r.ok {
+		return true
+	}
+	if r.delta <= 0 {
+		return false
+	}
+	rt, _ := r.it.At()
+	return rt-r.prevT > 2*r.delta
+}
+
+func (it *chainSeriesIterator) Next() bool {
+	if it.cur == -1 {
+		return it.seek(math.MinInt64)
+	}
+	return it.seek(it.lastT + 1)
+}
+
+func (it *chainSeriesIterator) Seek(t int64) bool {
+	if it.cur != -1 && it.lastT >= t {
+		return true
+	}
+	return it.seek(t)
+}
+
+// seek advances every replica to its first sample at or after t. It stays on the current replica unless it has a gap
+// in which another replica has a sample, and otherwise picks the replica with the earliest sample.
+func (it *chainSeriesIterator) seek(t int64) bool {
+	next, nextT := -1, int64(math.MaxInt64)
+	for i, r := range it.replicas {
+		r.advance(t)
+		if !r.ok {
+			continue
+		}
+		if rt, _ := r.it.At(); rt < nextT {
+			next, nextT = i, rt
+		}
+	}
+	if next == -1 {
+		return false
+	}
+	if cur := it.cur; cur != -1 && next != cur && it.replicas[cur].ok {
+		if ct, _ := it.replicas[cur].it.At(); ct == nextT || !it.replicas[cur].hasGap() {
+			next, nextT = cur, ct
+		}
+	}
+	it.cur, it.lastT = next, nextT
+	return true
+}
+
+func (it *chainSeriesIterator) At() (int64, float64) {
+	return it.replicas[it.cur].it.At()
+}
+
+func (it *chainSeriesIterator) Err() error {
+	for _, r := range it.replicas {
+		if err := r.it.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
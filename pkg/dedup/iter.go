@@ -11,6 +11,15 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 )
 
+const (
+	// AlgorithmPenalty deduplicates replicas by switching to another replica when the current one has a gap, and
+	// penalizing the replica it switched from so that samples close to each other aren't mixed.
+	AlgorithmPenalty = "penalty"
+	// AlgorithmChain deduplicates replicas by following a single replica until it has a gap, and then switching to the
+	// replica with the earliest sample in the gap. Unlike AlgorithmPenalty, it doesn't skip samples after switching replicas.
+	AlgorithmChain = "chain"
+)
+
 type dedupSeriesSet struct {
 	set           storage.SeriesSet
 	replicaLabels map[string]struct{}
@@ -28,6 +37,7 @@ type dedupSeriesSet struct {
 
 	f               string
 	pushdownEnabled bool
+	algorithm       string
 }
 
 // isCounter deduces whether a counter metric has been passed. There must be
@@ -36,9 +46,11 @@ func isCounter(f string) bool {
 	return f == "increase" || f == "rate" || f == "irate" || f == "resets"
 }
 
-func NewSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, f string, pushdownEnabled bool) storage.SeriesSet {
+// NewSeriesSet returns a series set deduplicating the replicas of the given set with the given algorithm, one of
+// AlgorithmPenalty and AlgorithmChain. Pushed down series are deduplicated with the penalty algorithm.
+func NewSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, f string, pushdownEnabled bool, algorithm string) storage.SeriesSet {
 	// TODO: remove dependency on knowing whether it is a counter.
-	s := &dedupSeriesSet{pushdownEnabled: pushdownEnabled, set: set, replicaLabels: replicaLabels, isCounter: isCounter(f), f: f}
+	s := &dedupSeriesSet{pushdownEnabled: pushdownEnabled, set: set, replicaLabels: replicaLabels, isCounter: isCounter(f), f: f, algorithm: algorithm}
 	s.ok = s.set.Next()
 	if s.ok {
 		s.peek = s.set.At()
@@ -147,7 +159,7 @@ func (s *dedupSeriesSet) At() storage.Series {
 		copy(pushedDown, s.pushedDown)
 	}
 
-	return newDedupSeries(s.lset, repl, pushedDown, s.f)
+	return newDedupSeries(s.lset, repl, pushedDown, s.f, s.algorithm)
 }
 
 func (s *dedupSeriesSet) Err() error {
@@ -172,10 +184,41 @@ type dedupSeries struct {
 
 	isCounter bool
 	f         string
+	algorithm string
+}
+
+func newDedupSeries(lset labels.Labels, replicas []storage.Series, pushedDown []storage.Series, f, algorithm string) *dedupSeries {
+	return &dedupSeries{lset: lset, isCounter: isCounter(f), replicas: replicas, pushedDown: pushedDown, f: f, algorithm: algorithm}
 }
 
-func newDedupSeries(lset labels.Labels, replicas []storage.Series, pushedDown []storage.Series, f string) *dedupSeries {
-	return &dedupSeries{lset: lset, isCounter: isCounter(f), replicas: replicas, pushedDown: pushedDown, f: f}
+// replicasIterator creates an iterator deduplicating the regular replicas
+// with the algorithm of the series.
+func (s *dedupSeries) replicasIterator() adjustableSeriesIterator {
+	if s.algorithm == AlgorithmChain {
+		its := make([]chunkenc.Iterator, 0, len(s.replicas))
+		for _, r := range s.replicas {
+			its = append(its, r.Iterator())
+		}
+		return noopAdjustableSeriesIterator{newChainSeriesIterator(its)}
+	}
+
+	var it adjustableSeriesIterator
+	if s.isCounter {
+		it = &counterErrAdjustSeriesIterator{Iterator: s.replicas[0].Iterator()}
+	} else {
+		it = noopAdjustableSeriesIterator{Iterator: s.replicas[0].Iterator()}
+	}
+
+	for _, o := range s.replicas[1:] {
+		var replicaIter adjustableSeriesIterator
+		if s.isCounter {
+			replicaIter = &counterErrAdjustSeriesIterator{Iterator: o.Iterator()}
+		} else {
+			replicaIter = noopAdjustableSeriesIterator{Iterator: o.Iterator()}
+		}
+		it = newDedupSeriesIterator(it, replicaIter)
+	}
+	return it
 }
 
 func (s *dedupSeries) Labels() labels.Labels {
@@ -212,21 +255,7 @@ func (s *dedupSeries) pushdownIterator() chunkenc.Iterator {
 func (s *dedupSeries) allSeriesIterator() chunkenc.Iterator {
 	var replicasIterator, pushedDownIterator adjustableSeriesIterator
 	if len(s.replicas) != 0 {
-		if s.isCounter {
-			replicasIterator = &counterErrAdjustSeriesIterator{Iterator: s.replicas[0].Iterator()}
-		} else {
-			replicasIterator = noopAdjustableSeriesIterator{Iterator: s.replicas[0].Iterator()}
-		}
-
-		for _, o := range s.replicas[1:] {
-			var replicaIter adjustableSeriesIterator
-			if s.isCounter {
-				replicaIter = &counterErrAdjustSeriesIterator{Iterator: o.Iterator()}
-			} else {
-				replicaIter = noopAdjustableSeriesIterator{Iterator: o.Iterator()}
-			}
-			replicasIterator = newDedupSeriesIterator(replicasIterator, replicaIter)
-		}
+		replicasIterator = s.replicasIterator()
 	}
 
 	if len(s.pushedDown) != 0 {
@@ -271,23 +300,7 @@ func (s *dedupSeries) Iterator() chunkenc.Iterator {
 	// Finally, if we have both then construct a tree out of them.
 	// Pushed down series have their own special iterator.
 	// We deduplicate everything in the end.
-	var it adjustableSeriesIterator
-	if s.isCounter {
-		it = &counterErrAdjustSeriesIterator{Iterator: s.replicas[0].Iterator()}
-	} else {
-		it = noopAdjustableSeriesIterator{Iterator: s.replicas[0].Iterator()}
-	}
-
-	for _, o := range s.replicas[1:] {
-		var replicaIter adjustableSeriesIterator
-		if s.isCounter {
-			replicaIter = &counterErrAdjustSeriesIterator{Iterator: o.Iterator()}
-		} else {
-			replicaIter = noopAdjustableSeriesIterator{Iterator: o.Iterator()}
-		}
-		it = newDedupSeriesIterator(it, replicaIter)
-	}
-
+	it := s.replicasIterator()
 	if len(s.pushedDown) == 0 {
 		return it
 	}
@@ -427,7 +427,7 @@ func TestDedupSeriesSet(t *testing.T) {
 			if tcase.isCounter {
 				f = "rate"
 			}
-			dedupSet := NewSeriesSet(&mockedSeriesSet{series: tcase.input}, tcase.dedupLabels, f, false)
+			dedupSet := NewSeriesSet(&mockedSeriesSet{series: tcase.input}, tcase.dedupLabels, f, false, AlgorithmPenalty)
 			var ats []storage.Series
 			for dedupSet.Next() {
 				ats = append(ats, dedupSet.At())
@@ -444,6 +444,105 @@ func TestDedupSeriesSet(t *testing.T) {
 	}
 }
 
+func TestDedupSeriesSet_Algorithms(t *testing.T) {
+	replicas := func(a, b []sample) []series {
+		return []series{
+			{lset: labels.FromStrings("a", "1", "replica", "1"), samples: a},
+			{lset: labels.FromStrings("a", "1", "replica", "2"), samples: b},
+			{lset: labels.FromStrings("a", "2", "replica", "1"), samples: []sample{{10000, 3}, {20000, 3}}},
+		}
+	}
+	for _, tcase := range []struct {
+		name       string
+		a, b       []sample
+		expPenalty []sample
+		expChain   []sample
+	}{
+		{
+			name: "identical timestamps with gaps",
+			a:    []sample{{10000, 1}, {20000, 1}, {30000, 1}, {70000, 1}, {80000, 1}},
+			b:    []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}, {50000, 2}, {60000, 2}, {70000, 2}},
+			// The penalty of the second replica skips the first samples of the gap.
+			expPenalty: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {60000, 2}, {70000, 2}},
+			// The gap of the first replica is filled, and the second one is kept until it ends.
+			expChain: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {40000, 2}, {50000, 2}, {60000, 2}, {70000, 2}, {80000, 1}},
+		},
+		{
+			name: "shifted timestamps",
+			a:    []sample{{10000, 1}, {20000, 1}, {30000, 1}},
+			b:    []sample{{15000, 2}, {25000, 2}, {35000, 2}, {45000, 2}},
+			// The penalty of the second replica skips its remaining samples.
+			expPenalty: []sample{{10000, 1}, {20000, 1}, {30000, 1}},
+			// The first replica is kept until it ends, instead of interleaving the replicas.
+			expChain: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {35000, 2}, {45000, 2}},
+		},
+		{
+			name: "non-overlapping",
+			a:    []sample{{10000, 1}, {20000, 1}},
+			b:    []sample{{40000, 2}, {50000, 2}},
+			// The penalty of the second replica skips its first sample.
+			expPenalty: []sample{{10000, 1}, {20000, 1}, {50000, 2}},
+			expChain:   []sample{{10000, 1}, {20000, 1}, {40000, 2}, {50000, 2}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			for algorithm, exp := range map[string][]sample{AlgorithmPenalty: tcase.expPenalty, AlgorithmChain: tcase.expChain} {
+				set := NewSeriesSet(&mockedSeriesSet{series: replicas(tcase.a, tcase.b)}, map[string]struct{}{"replica": {}}, "", false, algorithm)
+
+				testutil.Assert(t, set.Next())
+				testutil.Equals(t, labels.FromStrings("a", "1"), set.At().Labels())
+				// Iterating again over the same series gives the same samples.
+				testutil.Equals(t, exp, expandSeries(t, set.At().Iterator()), "algorithm %s", algorithm)
+				testutil.Equals(t, exp, expandSeries(t, set.At().Iterator()), "algorithm %s", algorithm)
+
+				testutil.Assert(t, set.Next())
+				testutil.Equals(t, labels.FromStrings("a", "2"), set.At().Labels())
+				testutil.Equals(t, []sample{{10000, 3}, {20000, 3}}, expandSeries(t, set.At().Iterator()))
+
+				testutil.Assert(t, !set.Next())
+				testutil.Ok(t, set.Err())
+			}
+		})
+	}
+}
+
+func TestChainSeriesIterator_Seek(t *testing.T) {
+	it := newChainSeriesIterator([]chunkenc.Iterator{
+		newMockedSeriesIterator([]sample{{10000, 1}, {20000, 1}, {50000, 1}}),
+		newMockedSeriesIterator([]sample{{20000, 2}, {30000, 2}, {40000, 2}}),
+	})
+	testutil.Assert(t, it.Seek(15000))
+	ts, v := it.At()
+	testutil.Equals(t, sample{20000, 1}, sample{ts, v})
+
+	// Seeking before the current sample doesn't move the iterator.
+	testutil.Assert(t, it.Seek(0))
+	ts, v = it.At()
+	testutil.Equals(t, sample{20000, 1}, sample{ts, v})
+
+	testutil.Assert(t, it.Seek(35000))
+	ts, v = it.At()
+	testutil.Equals(t, sample{40000, 2}, sample{ts, v})
+
+	testutil.Equals(t, []sample{{50000, 1}}, expandSeries(t, it))
+	testutil.Assert(t, !it.Seek(60000))
+}
+
+func TestChainSeriesIterator_OffsetReplicas(t *testing.T) {
+	// The replicas are scraped every 30s, 15s apart, and the first one misses a few scrapes.
+	it := newChainSeriesIterator([]chunkenc.Iterator{
+		newMockedSeriesIterator([]sample{{0, 1}, {30000, 1}, {60000, 1}, {180000, 1}, {210000, 1}, {240000, 1}}),
+		newMockedSeriesIterator([]sample{{15000, 2}, {45000, 2}, {75000, 2}, {105000, 2}, {135000, 2}, {165000, 2}, {195000, 2}}),
+	})
+
+	// The first replica is kept until its gap, which is filled by the second one until it ends.
+	testutil.Equals(t, []sample{
+		{0, 1}, {30000, 1}, {60000, 1},
+		{75000, 2}, {105000, 2}, {135000, 2}, {165000, 2}, {195000, 2},
+		{210000, 1}, {240000, 1},
+	}, expandSeries(t, it))
+}
+
 func TestDedupSeriesIterator(t *testing.T) {
 	// The deltas between timestamps should be at least 10000 to not be affected
 	// by the initial penalty of 5000, that will cause the second iterator to seek
@@ -5,9 +5,11 @@ package dns
 
 import (
 	"context"
+	"math/rand"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -28,6 +30,11 @@ type Provider struct {
 	resolved map[string][]string
 	logger   log.Logger
 
+	// jitter is the window DNS resolutions of the addresses are spread over, 0 resolves all of them at once.
+	jitter time.Duration
+	// A map from domain name to its resolution delay within the jitter window.
+	delays map[string]time.Duration
+
 	resolverAddrs         *extprom.TxGaugeVec
 	resolverLookupsCount  prometheus.Counter
 	resolverFailuresCount prometheus.Counter
@@ -54,13 +61,26 @@ func (t ResolverType) ToResolver(logger log.Logger) ipLookupResolver {
 	return r
 }
 
+// ProviderOption configures a Provider.
+type ProviderOption func(p *Provider)
+
+// WithResolveJitter spreads the DNS resolutions of the addresses passed to Resolve over the given window,
+// so that endpoints behind different addresses are not re-resolved, and reconnected to, at the same instant.
+// Each address gets a random delay within the window once and keeps it, so it's still re-resolved at a regular interval.
+func WithResolveJitter(jitter time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.jitter = jitter
+	}
+}
+
 // NewProvider returns a new empty provider with a given resolver type.
 // If empty resolver type is net.DefaultResolver.
-func NewProvider(logger log.Logger, reg prometheus.Registerer, resolverType ResolverType) *Provider {
+func NewProvider(logger log.Logger, reg prometheus.Registerer, resolverType ResolverType, opts ...ProviderOption) *Provider {
 	p := &Provider{
 		resolver: NewResolver(resolverType.ToResolver(logger), logger),
 		resolved: make(map[string][]string),
 		logger:   logger,
+		delays:   make(map[string]time.Duration),
 		resolverAddrs: extprom.NewTxGaugeVec(reg, prometheus.GaugeOpts{
 			Name: "dns_provider_results",
 			Help: "The number of resolved endpoints for each configured address",
@@ -74,6 +94,9 @@ func NewProvider(logger log.Logger, reg prometheus.Registerer, resolverType Reso
 			Help: "The number of DNS lookup failures",
 		}),
 	}
+	for _, o := range opts {
+		o(p)
+	}
 
 	return p
 }
@@ -84,6 +107,8 @@ func (p *Provider) Clone() *Provider {
 		resolver:              p.resolver,
 		resolved:              make(map[string][]string),
 		logger:                p.logger,
+		jitter:                p.jitter,
+		delays:                make(map[string]time.Duration),
 		resolverAddrs:         p.resolverAddrs,
 		resolverLookupsCount:  p.resolverLookupsCount,
 		resolverFailuresCount: p.resolverFailuresCount,
@@ -110,32 +135,58 @@ func GetQTypeName(addr string) (qtype, name string) {
 // Resolve stores a list of provided addresses or their DNS records if requested.
 // Addresses prefixed with `dns+` or `dnssrv+` will be resolved through respective DNS lookup (A/AAAA or SRV).
 // For non-SRV records, it will return an error if a port is not supplied.
+// With a resolve jitter, each address is resolved after its delay and its records are available as soon as
+// they are resolved; Resolve returns once all addresses are resolved.
 func (p *Provider) Resolve(ctx context.Context, addrs []string) error {
-	resolvedAddrs := map[string][]string{}
-	errs := errutil.MultiError{}
-
+	var (
+		mtx           sync.Mutex
+		wg            sync.WaitGroup
+		resolvedAddrs = map[string][]string{}
+		errs          = errutil.MultiError{}
+	)
+
+	// Addresses resolved with a jitter are stored by their own goroutine, so all writes to resolvedAddrs and errs
+	// hold mtx.
 	for _, addr := range addrs {
-		var resolved []string
 		qtype, name := GetQTypeName(addr)
 		if qtype == "" {
+			mtx.Lock()
 			resolvedAddrs[name] = []string{name}
+			mtx.Unlock()
 			continue
 		}
 
-		resolved, err := p.resolver.Resolve(ctx, name, QType(qtype))
-		p.resolverLookupsCount.Inc()
-		if err != nil {
-			// Append all the failed dns resolution in the error list.
+		if p.jitter <= 0 {
+			resolved, err := p.resolve(ctx, addr, name, QType(qtype))
+			mtx.Lock()
 			errs.Add(err)
-			// The DNS resolution failed. Continue without modifying the old records.
-			p.resolverFailuresCount.Inc()
-			// Use cached values.
-			p.RLock()
-			resolved = p.resolved[addr]
-			p.RUnlock()
+			resolvedAddrs[addr] = resolved
+			mtx.Unlock()
+			continue
 		}
-		resolvedAddrs[addr] = resolved
+
+		wg.Add(1)
+		go func(addr, name string, qtype QType, delay time.Duration) {
+			defer wg.Done()
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			resolved, err := p.resolve(ctx, addr, name, qtype)
+
+			// Publish the records right away, so that the consumers pick up the changes at staggered times too.
+			p.Lock()
+			p.resolved[addr] = resolved
+			p.Unlock()
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			errs.Add(err)
+			resolvedAddrs[addr] = resolved
+		}(addr, name, QType(qtype), p.resolveDelay(addr))
 	}
+	wg.Wait()
 
 	// All addresses have been resolved. We can now take an exclusive lock to
 	// update the resolved addresses metric and update the local state.
@@ -149,10 +200,43 @@ func (p *Provider) Resolve(ctx context.Context, addrs []string) error {
 	p.resolverAddrs.Submit()
 
 	p.resolved = resolvedAddrs
+	for addr := range p.delays {
+		if _, ok := resolvedAddrs[addr]; !ok {
+			delete(p.delays, addr)
+		}
+	}
 
 	return errs.Err()
 }
 
+// resolve looks up the given address, falling back to its previously resolved records on failure.
+func (p *Provider) resolve(ctx context.Context, addr, name string, qtype QType) ([]string, error) {
+	resolved, err := p.resolver.Resolve(ctx, name, qtype)
+	p.resolverLookupsCount.Inc()
+	if err != nil {
+		// The DNS resolution failed. Continue without modifying the old records.
+		p.resolverFailuresCount.Inc()
+		// Use cached values.
+		p.RLock()
+		resolved = p.resolved[addr]
+		p.RUnlock()
+	}
+	return resolved, err
+}
+
+// resolveDelay returns the delay of the resolution of the given address within the jitter window.
+func (p *Provider) resolveDelay(addr string) time.Duration {
+	p.Lock()
+	defer p.Unlock()
+
+	d, ok := p.delays[addr]
+	if !ok {
+		d = time.Duration(rand.Int63n(int64(p.jitter)))
+		p.delays[addr] = d
+	}
+	return d
+}
+
 // Addresses returns the latest addresses present in the Provider.
 func (p *Provider) Addresses() []string {
 	p.RLock()
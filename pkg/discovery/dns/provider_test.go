@@ -5,8 +5,11 @@ package dns
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
@@ -99,6 +102,81 @@ func TestProvider(t *testing.T) {
 
 }
 
+func TestProvider_ResolveJitter(t *testing.T) {
+	const jitter = 500 * time.Millisecond
+
+	res := &timingResolver{times: map[string]time.Time{}}
+	prv := NewProvider(log.NewNopLogger(), nil, "", WithResolveJitter(jitter))
+	prv.resolver = res
+
+	var addrs, expected []string
+	for i := 0; i < 10; i++ {
+		addrs = append(addrs, fmt.Sprintf("any+%d", i))
+		expected = append(expected, fmt.Sprintf("%d:9090", i))
+	}
+
+	start := time.Now()
+	testutil.Ok(t, prv.Resolve(context.Background(), addrs))
+	result := prv.Addresses()
+	sort.Strings(result)
+	testutil.Equals(t, expected, result)
+
+	// Resolutions are spread over the jitter window instead of happening at the same instant.
+	first, last := start.Add(jitter), start
+	for _, addr := range addrs {
+		ts := res.times[addr[len("any+"):]]
+		testutil.Assert(t, ts.Sub(start) < jitter+100*time.Millisecond, "resolution of %s not within the jitter window", addr)
+		if ts.Before(first) {
+			first = ts
+		}
+		if ts.After(last) {
+			last = ts
+		}
+	}
+	testutil.Assert(t, last.Sub(first) > jitter/4, "resolutions not spread, all within %v", last.Sub(first))
+
+	// The delay of each address is kept, so it's re-resolved at a regular interval.
+	delays := map[string]time.Duration{}
+	for _, addr := range addrs {
+		delays[addr] = prv.resolveDelay(addr)
+	}
+	testutil.Ok(t, prv.Resolve(context.Background(), addrs[:5]))
+	for _, addr := range addrs[:5] {
+		testutil.Equals(t, delays[addr], prv.resolveDelay(addr))
+	}
+	testutil.Equals(t, 5, len(prv.delays))
+}
+
+func TestProvider_ResolveJitterStaticAddresses(t *testing.T) {
+	prv := NewProvider(log.NewNopLogger(), nil, "", WithResolveJitter(time.Millisecond))
+	prv.resolver = &timingResolver{times: map[string]time.Time{}}
+
+	// Static addresses are stored while the dynamic ones before them are being resolved.
+	var addrs, expected []string
+	for i := 0; i < 100; i++ {
+		addrs = append(addrs, fmt.Sprintf("any+%d", i), fmt.Sprintf("static-%d:9090", i))
+		expected = append(expected, fmt.Sprintf("%d:9090", i), fmt.Sprintf("static-%d:9090", i))
+	}
+	testutil.Ok(t, prv.Resolve(context.Background(), addrs))
+	result := prv.Addresses()
+	sort.Strings(result)
+	sort.Strings(expected)
+	testutil.Equals(t, expected, result)
+}
+
+// timingResolver resolves any name to a single address and records when it was resolved.
+type timingResolver struct {
+	mtx   sync.Mutex
+	times map[string]time.Time
+}
+
+func (r *timingResolver) Resolve(_ context.Context, name string, _ QType) ([]string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.times[name] = time.Now()
+	return []string{name + ":9090"}, nil
+}
+
 type mockResolver struct {
 	res map[string][]string
 	err error
@@ -131,6 +131,17 @@ func dedupExemplarsResponse(exemplarsData []*exemplarspb.ExemplarData, replicaLa
 	return res
 }
 
+// traceIDLabels are the exemplar label names commonly used for trace IDs.
+var traceIDLabels = []string{"trace_id", "traceID", "traceId"}
+
+// exemplarKey identifies exemplars of the same trace recorded at the same time.
+type exemplarKey struct {
+	traceID string
+	ts      int64
+}
+
+// dedupExemplars removes duplicated exemplars, which are either identical or have the same trace ID and timestamp.
+// The latter happens when replicas of the same series record the same trace with e.g. slightly different values.
 func dedupExemplars(exemplars []*exemplarspb.Exemplar) []*exemplarspb.Exemplar {
 	for _, e := range exemplars {
 		sort.Slice(e.Labels.Labels, func(i, j int) bool {
@@ -142,16 +153,36 @@ func dedupExemplars(exemplars []*exemplarspb.Exemplar) []*exemplarspb.Exemplar {
 		return exemplars[i].Compare(exemplars[j]) < 0
 	})
 
-	i := 0
-	for j := 1; j < len(exemplars); j++ {
-		if exemplars[i].Compare(exemplars[j]) != 0 {
-			// Effectively retain exemplars[j] in the resulting slice.
-			i++
-			exemplars[i] = exemplars[j]
+	var (
+		seen = make(map[exemplarKey]struct{})
+		res  = exemplars[:0]
+	)
+	for _, e := range exemplars {
+		if len(res) > 0 && res[len(res)-1].Compare(e) == 0 {
+			continue
+		}
+		if id := traceID(e.Labels.Labels); id != "" {
+			k := exemplarKey{traceID: id, ts: e.Ts}
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
 		}
+		res = append(res, e)
 	}
+	return res
+}
 
-	return exemplars[:i+1]
+// traceID returns the trace ID of the exemplar with the given labels, or empty string if it has none.
+func traceID(lbls []labelpb.ZLabel) string {
+	for _, l := range lbls {
+		for _, n := range traceIDLabels {
+			if l.Name == n {
+				return l.Value
+			}
+		}
+	}
+	return ""
 }
 
 func removeReplicaLabels(labels []labelpb.ZLabel, replicaLabels map[string]struct{}) []labelpb.ZLabel {
@@ -217,6 +217,86 @@ func TestDedupExemplarsResponse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "same trace recorded by replicas",
+			replicaLabels: []string{"replica"},
+			exemplars: []*exemplarspb.ExemplarData{
+				{
+					SeriesLabels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+						{Name: "__name__", Value: "test_exemplar_metric_total"},
+						{Name: "replica", Value: "0"},
+					}},
+					Exemplars: []*exemplarspb.Exemplar{
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "EpTxMJ40fUus7aGY"},
+							}},
+							Value: 19,
+							Ts:    1600096955479,
+						},
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "foo"},
+							}},
+							Value: 19,
+							Ts:    1600096955479,
+						},
+					},
+				},
+				{
+					SeriesLabels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+						{Name: "__name__", Value: "test_exemplar_metric_total"},
+						{Name: "replica", Value: "1"},
+					}},
+					Exemplars: []*exemplarspb.Exemplar{
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "EpTxMJ40fUus7aGY"},
+							}},
+							Value: 19.5,
+							Ts:    1600096955479,
+						},
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "EpTxMJ40fUus7aGY"},
+							}},
+							Value: 20,
+							Ts:    1600096955480,
+						},
+					},
+				},
+			},
+			want: []*exemplarspb.ExemplarData{
+				{
+					SeriesLabels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+						{Name: "__name__", Value: "test_exemplar_metric_total"},
+					}},
+					Exemplars: []*exemplarspb.Exemplar{
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "EpTxMJ40fUus7aGY"},
+							}},
+							Value: 19,
+							Ts:    1600096955479,
+						},
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "foo"},
+							}},
+							Value: 19,
+							Ts:    1600096955479,
+						},
+						{
+							Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{
+								{Name: "trace_id", Value: "EpTxMJ40fUus7aGY"},
+							}},
+							Value: 20,
+							Ts:    1600096955480,
+						},
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			replicaLabels := make(map[string]struct{})
@@ -21,6 +21,16 @@ import (
 
 // StoreClientGRPCOpts creates gRPC dial options for connecting to a store client.
 func StoreClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, secure, skipVerify bool, cert, key, caCert, serverName string) ([]grpc.DialOption, error) {
+	tlsOpt, err := StoreClientTLSOpt(logger, secure, skipVerify, cert, key, caCert, serverName)
+	if err != nil {
+		return nil, err
+	}
+	return append(StoreClientBaseGRPCOpts(reg, tracer), tlsOpt), nil
+}
+
+// StoreClientBaseGRPCOpts creates gRPC dial options for connecting to a store client, without the transport security
+// option, which has to be added with StoreClientTLSOpt.
+func StoreClientBaseGRPCOpts(reg *prometheus.Registry, tracer opentracing.Tracer) []grpc.DialOption {
 	grpcMets := grpc_prometheus.NewClientMetrics()
 	grpcMets.EnableClientHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120, 240, 360, 720}),
@@ -47,9 +57,13 @@ func StoreClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer ope
 	if reg != nil {
 		reg.MustRegister(grpcMets)
 	}
+	return dialOpts
+}
 
+// StoreClientTLSOpt creates the gRPC dial option setting the transport security for connecting to a store client.
+func StoreClientTLSOpt(logger log.Logger, secure, skipVerify bool, cert, key, caCert, serverName string) (grpc.DialOption, error) {
 	if !secure {
-		return append(dialOpts, grpc.WithInsecure()), nil
+		return grpc.WithInsecure(), nil
 	}
 
 	level.Info(logger).Log("msg", "enabling client to server TLS")
@@ -58,5 +72,5 @@ func StoreClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer ope
 	if err != nil {
 		return nil, err
 	}
-	return append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg))), nil
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)), nil
 }
@@ -0,0 +1,78 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+// Package snappy registers a snappy compressor for gRPC. Importing it makes "snappy"
+// available as compression for both gRPC clients and servers.
+package snappy
+
+import (
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the name the snappy compressor is registered under.
+const Name = "snappy"
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+type compressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	wr, ok := c.writers.Get().(*snappy.Writer)
+	if !ok {
+		wr = snappy.NewBufferedWriter(w)
+	} else {
+		wr.Reset(w)
+	}
+	return &writer{Writer: wr, pool: &c.writers}, nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	dr, ok := c.readers.Get().(*snappy.Reader)
+	if !ok {
+		dr = snappy.NewReader(r)
+	} else {
+		dr.Reset(r)
+	}
+	return &reader{Reader: dr, pool: &c.readers}, nil
+}
+
+type writer struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+func (w *writer) Close() error {
+	defer w.pool.Put(w.Writer)
+	return w.Writer.Close()
+}
+
+type reader struct {
+	*snappy.Reader
+	pool *sync.Pool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.Reader == nil {
+		return 0, io.EOF
+	}
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		// The reader is no longer needed once the whole message has been read.
+		r.pool.Put(r.Reader)
+		r.Reader = nil
+	}
+	return n, err
+}
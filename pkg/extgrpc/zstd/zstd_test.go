@@ -0,0 +1,39 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package zstd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCompressor_RoundTrip(t *testing.T) {
+	c := encoding.GetCompressor(Name)
+	testutil.Assert(t, c != nil, "zstd compressor not registered")
+
+	// Run a few times to go through pooled encoders and decoders.
+	for i := 0; i < 3; i++ {
+		msg := []byte(strings.Repeat("thanos", 1000*(i+1)))
+
+		buf := &bytes.Buffer{}
+		w, err := c.Compress(buf)
+		testutil.Ok(t, err)
+		_, err = w.Write(msg)
+		testutil.Ok(t, err)
+		testutil.Ok(t, w.Close())
+		testutil.Assert(t, buf.Len() < len(msg), "expected compressed message to be smaller")
+
+		r, err := c.Decompress(buf)
+		testutil.Ok(t, err)
+		got, err := ioutil.ReadAll(r)
+		testutil.Ok(t, err)
+		testutil.Equals(t, msg, got)
+	}
+}
@@ -119,6 +119,11 @@ var xxx_messageInfo_InfoResponse proto.InternalMessageInfo
 type StoreInfo struct {
 	MinTime int64 `protobuf:"varint,1,opt,name=min_time,json=minTime,proto3" json:"min_time,omitempty"`
 	MaxTime int64 `protobuf:"varint,2,opt,name=max_time,json=maxTime,proto3" json:"max_time,omitempty"`
+	// supports_label_values_stream is true if the Store API implements the LabelValuesStream method.
+	SupportsLabelValuesStream bool `protobuf:"varint,3,opt,name=supports_label_values_stream,json=supportsLabelValuesStream,proto3" json:"supports_label_values_stream,omitempty"`
+	// supports_query_pushdown is true if the Store API evaluates the range functions of the pushdown field of
+	// series requests.
+	SupportsQueryPushdown bool `protobuf:"varint,4,opt,name=supports_query_pushdown,json=supportsQueryPushdown,proto3" json:"supports_query_pushdown,omitempty"`
 }
 
 func (m *StoreInfo) Reset()         { *m = StoreInfo{} }
@@ -355,37 +360,40 @@ func init() {
 func init() { proto.RegisterFile("info/infopb/rpc.proto", fileDescriptor_a1214ec45d2bf952) }
 
 var fileDescriptor_a1214ec45d2bf952 = []byte{
-	// 465 bytes of a gzipped FileDescriptorProto
+	// 525 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x93, 0xcf, 0x6a, 0xdb, 0x40,
-	0x10, 0xc6, 0xa5, 0xf8, 0x5f, 0x34, 0x8a, 0x53, 0xba, 0xa4, 0x45, 0xf6, 0x41, 0x31, 0x22, 0x07,
-	0x1f, 0x8a, 0x04, 0x2e, 0x94, 0x42, 0x4f, 0x49, 0x08, 0x34, 0xd0, 0x40, 0xab, 0xf8, 0x94, 0x8b,
-	0x59, 0xa7, 0x13, 0x57, 0xa0, 0xd5, 0x6e, 0xb4, 0x6b, 0xb0, 0xdf, 0xa2, 0xaf, 0xd2, 0xb7, 0xf0,
-	0x31, 0xc7, 0x9e, 0x4a, 0x6b, 0xbf, 0x48, 0xd9, 0x5d, 0x25, 0xb5, 0xa8, 0x4f, 0xb9, 0x48, 0xbb,
-	0xf3, 0xfb, 0xbe, 0xd9, 0x9d, 0x61, 0x16, 0x5e, 0x65, 0xc5, 0x1d, 0x4f, 0xf4, 0x47, 0x4c, 0x93,
-	0x52, 0xdc, 0xc6, 0xa2, 0xe4, 0x8a, 0x13, 0x5f, 0x7d, 0xa3, 0x05, 0x97, 0xb1, 0x06, 0xfd, 0x9e,
-	0x54, 0xbc, 0xc4, 0x24, 0xa7, 0x53, 0xcc, 0xc5, 0x34, 0x51, 0x4b, 0x81, 0xd2, 0xea, 0xfa, 0x47,
-	0x33, 0x3e, 0xe3, 0x66, 0x99, 0xe8, 0x95, 0x8d, 0x46, 0x5d, 0xf0, 0x2f, 0x8b, 0x3b, 0x9e, 0xe2,
-	0xfd, 0x1c, 0xa5, 0x8a, 0x7e, 0x34, 0xe0, 0xc0, 0xee, 0xa5, 0xe0, 0x85, 0x44, 0xf2, 0x0e, 0xc0,
-	0x24, 0x9b, 0x48, 0x54, 0x32, 0x70, 0x07, 0x8d, 0xa1, 0x3f, 0x7a, 0x19, 0x57, 0x47, 0xde, 0x7c,
-	0xd2, 0xe8, 0x1a, 0xd5, 0x59, 0x73, 0xf5, 0xeb, 0xd8, 0x49, 0xbd, 0xbc, 0xda, 0x4b, 0x72, 0x02,
-	0xdd, 0x73, 0xce, 0x04, 0x2f, 0xb0, 0x50, 0xe3, 0xa5, 0xc0, 0x60, 0x6f, 0xe0, 0x0e, 0xbd, 0xb4,
-	0x1e, 0x24, 0x6f, 0xa0, 0x65, 0x2e, 0x1c, 0x34, 0x06, 0xee, 0xd0, 0x1f, 0xbd, 0x8e, 0xb7, 0x6a,
-	0x89, 0xaf, 0x35, 0x31, 0x97, 0xb1, 0x22, 0xad, 0x2e, 0xe7, 0x39, 0xca, 0xa0, 0xb9, 0x43, 0x9d,
-	0x6a, 0x62, 0xd5, 0x46, 0x44, 0x3e, 0xc2, 0x0b, 0x86, 0xaa, 0xcc, 0x6e, 0x27, 0x0c, 0x15, 0xfd,
-	0x4a, 0x15, 0x0d, 0x5a, 0xc6, 0x77, 0x5c, 0xf3, 0x5d, 0x19, 0xcd, 0x55, 0x25, 0x31, 0x09, 0x0e,
-	0x59, 0x2d, 0x46, 0x46, 0xd0, 0x51, 0xb4, 0x9c, 0xe9, 0x06, 0xb4, 0x4d, 0x86, 0xa0, 0x96, 0x61,
-	0x6c, 0x99, 0xb1, 0x3e, 0x0a, 0xc9, 0x7b, 0xf0, 0x70, 0x81, 0x4c, 0xe4, 0xb4, 0x94, 0x41, 0xc7,
-	0xb8, 0xfa, 0x35, 0xd7, 0xc5, 0x23, 0x35, 0xbe, 0x7f, 0x62, 0x92, 0x40, 0xeb, 0x7e, 0x8e, 0xe5,
-	0x32, 0xd8, 0x37, 0xae, 0x5e, 0xcd, 0xf5, 0x45, 0x93, 0xd3, 0xcf, 0x97, 0xb6, 0x50, 0xa3, 0x8b,
-	0x4e, 0xc1, 0x7b, 0x6a, 0x15, 0xe9, 0xc1, 0x3e, 0xcb, 0x8a, 0x89, 0xca, 0x18, 0x06, 0xee, 0xc0,
-	0x1d, 0x36, 0xd2, 0x0e, 0xcb, 0x8a, 0x71, 0xc6, 0xd0, 0x20, 0xba, 0xb0, 0x68, 0xaf, 0x42, 0x74,
-	0xa1, 0x51, 0xe4, 0x83, 0xf7, 0xd4, 0xbf, 0xe8, 0x08, 0xc8, 0xff, 0x4d, 0xd1, 0x83, 0xb2, 0x55,
-	0x68, 0x74, 0x01, 0xdd, 0x5a, 0x05, 0xcf, 0x3c, 0xf8, 0x10, 0x0e, 0xb6, 0x4b, 0x1a, 0x9d, 0x43,
-	0xd3, 0x64, 0xfb, 0x50, 0xfd, 0xeb, 0x9d, 0xde, 0x9a, 0xd4, 0x7e, 0x6f, 0x07, 0xb1, 0x33, 0x7b,
-	0x76, 0xb2, 0xfa, 0x13, 0x3a, 0xab, 0x75, 0xe8, 0x3e, 0xac, 0x43, 0xf7, 0xf7, 0x3a, 0x74, 0xbf,
-	0x6f, 0x42, 0xe7, 0x61, 0x13, 0x3a, 0x3f, 0x37, 0xa1, 0x73, 0xd3, 0xb6, 0x2f, 0x68, 0xda, 0x36,
-	0x0f, 0xe0, 0xed, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x0b, 0x22, 0x37, 0x8b, 0x57, 0x03, 0x00,
-	0x00,
+	0x10, 0xc6, 0xad, 0xf8, 0xff, 0x3a, 0x4e, 0xe9, 0x92, 0xb4, 0xb2, 0x29, 0x8a, 0x11, 0x39, 0xf8,
+	0x50, 0x2c, 0x70, 0x21, 0x14, 0x7a, 0x28, 0x4d, 0x08, 0x34, 0xd0, 0x40, 0x2a, 0x9b, 0x1e, 0x72,
+	0x11, 0xeb, 0x64, 0xe2, 0x08, 0x24, 0xed, 0x46, 0xbb, 0x6a, 0xed, 0xb7, 0xe8, 0xab, 0xf4, 0xda,
+	0x27, 0xf0, 0x31, 0xc7, 0x9e, 0x4a, 0x6b, 0xbf, 0x48, 0xd9, 0x59, 0xd9, 0xb5, 0x68, 0x4e, 0xbd,
+	0x48, 0xbb, 0xfb, 0xfd, 0xbe, 0xd1, 0xce, 0x8c, 0x86, 0x1c, 0x84, 0xc9, 0x2d, 0xf7, 0xf4, 0x43,
+	0x4c, 0xbc, 0x54, 0x5c, 0x0f, 0x44, 0xca, 0x15, 0xa7, 0x2d, 0x75, 0xc7, 0x12, 0x2e, 0x07, 0x5a,
+	0xe8, 0x76, 0xa4, 0xe2, 0x29, 0x78, 0x11, 0x9b, 0x40, 0x24, 0x26, 0x9e, 0x9a, 0x0b, 0x90, 0x86,
+	0xeb, 0xee, 0x4f, 0xf9, 0x94, 0xe3, 0xd2, 0xd3, 0x2b, 0x73, 0xea, 0xb6, 0x49, 0xeb, 0x3c, 0xb9,
+	0xe5, 0x3e, 0xdc, 0x67, 0x20, 0x95, 0xfb, 0xad, 0x4c, 0x76, 0xcd, 0x5e, 0x0a, 0x9e, 0x48, 0xa0,
+	0xc7, 0x84, 0x60, 0xb0, 0x40, 0x82, 0x92, 0xb6, 0xd5, 0x2b, 0xf7, 0x5b, 0xc3, 0xa7, 0x83, 0xfc,
+	0x93, 0x57, 0x1f, 0xb4, 0x34, 0x02, 0x75, 0x52, 0x59, 0xfc, 0x3c, 0x2c, 0xf9, 0xcd, 0x28, 0xdf,
+	0x4b, 0x7a, 0x44, 0xda, 0xa7, 0x3c, 0x16, 0x3c, 0x81, 0x44, 0x8d, 0xe7, 0x02, 0xec, 0x9d, 0x9e,
+	0xd5, 0x6f, 0xfa, 0xc5, 0x43, 0xfa, 0x92, 0x54, 0xf1, 0xc2, 0x76, 0xb9, 0x67, 0xf5, 0x5b, 0xc3,
+	0x67, 0x83, 0xad, 0x5c, 0x06, 0x23, 0xad, 0xe0, 0x65, 0x0c, 0xa4, 0xe9, 0x34, 0x8b, 0x40, 0xda,
+	0x95, 0x47, 0x68, 0x5f, 0x2b, 0x86, 0x46, 0x88, 0xbe, 0x27, 0x4f, 0x62, 0x50, 0x69, 0x78, 0x1d,
+	0xc4, 0xa0, 0xd8, 0x0d, 0x53, 0xcc, 0xae, 0xa2, 0xef, 0xb0, 0xe0, 0xbb, 0x40, 0xe6, 0x22, 0x47,
+	0x30, 0xc0, 0x5e, 0x5c, 0x38, 0xa3, 0x43, 0x52, 0x57, 0x2c, 0x9d, 0xea, 0x02, 0xd4, 0x30, 0x82,
+	0x5d, 0x88, 0x30, 0x36, 0x1a, 0x5a, 0xd7, 0x20, 0x7d, 0x4d, 0x9a, 0x30, 0x83, 0x58, 0x44, 0x2c,
+	0x95, 0x76, 0x1d, 0x5d, 0xdd, 0x82, 0xeb, 0x6c, 0xad, 0xa2, 0xef, 0x2f, 0x4c, 0x3d, 0x52, 0xbd,
+	0xcf, 0x20, 0x9d, 0xdb, 0x0d, 0x74, 0x75, 0x0a, 0xae, 0x8f, 0x5a, 0x79, 0x77, 0x79, 0x6e, 0x12,
+	0x45, 0xce, 0xfd, 0x6e, 0x91, 0xe6, 0xa6, 0x56, 0xb4, 0x43, 0x1a, 0x71, 0x98, 0x04, 0x2a, 0x8c,
+	0xc1, 0xb6, 0x7a, 0x56, 0xbf, 0xec, 0xd7, 0xe3, 0x30, 0x19, 0x87, 0x31, 0xa0, 0xc4, 0x66, 0x46,
+	0xda, 0xc9, 0x25, 0x36, 0x43, 0xe9, 0x2d, 0x79, 0x21, 0x33, 0x21, 0x78, 0xaa, 0x64, 0x60, 0xfa,
+	0xfd, 0x99, 0x45, 0x19, 0xc8, 0x40, 0xaa, 0x14, 0x58, 0x8c, 0xfd, 0x69, 0xf8, 0x9d, 0x35, 0x83,
+	0x7d, 0xff, 0x84, 0xc4, 0x08, 0x01, 0x7a, 0x4c, 0x9e, 0x6f, 0x02, 0xe0, 0xb5, 0x02, 0x91, 0xc9,
+	0xbb, 0x1b, 0xfe, 0x25, 0xc1, 0x6e, 0x35, 0xfc, 0x83, 0xb5, 0x8c, 0x29, 0x5c, 0xe6, 0xa2, 0xdb,
+	0x22, 0xcd, 0x4d, 0xe7, 0xdc, 0x7d, 0x42, 0xff, 0x6d, 0x87, 0xfe, 0x45, 0xb7, 0x4a, 0xec, 0x9e,
+	0x91, 0x76, 0xa1, 0x76, 0xff, 0x97, 0xb1, 0xbb, 0x47, 0x76, 0xb7, 0x8b, 0x39, 0x3c, 0x25, 0x15,
+	0x8c, 0xf6, 0x26, 0x7f, 0x17, 0x7b, 0xbc, 0x35, 0x23, 0xdd, 0xce, 0x23, 0x8a, 0x99, 0x96, 0x93,
+	0xa3, 0xc5, 0x6f, 0xa7, 0xb4, 0x58, 0x3a, 0xd6, 0xc3, 0xd2, 0xb1, 0x7e, 0x2d, 0x1d, 0xeb, 0xeb,
+	0xca, 0x29, 0x3d, 0xac, 0x9c, 0xd2, 0x8f, 0x95, 0x53, 0xba, 0xaa, 0x99, 0xd9, 0x9d, 0xd4, 0x70,
+	0xf4, 0x5e, 0xfd, 0x19, 0x00, 0x73, 0xdf, 0x79, 0x05, 0xd1, 0x03, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -629,6 +637,26 @@ func (m *StoreInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SupportsQueryPushdown {
+		i--
+		if m.SupportsQueryPushdown {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.SupportsLabelValuesStream {
+		i--
+		if m.SupportsLabelValuesStream {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x18
+	}
 	if m.MaxTime != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.MaxTime))
 		i--
@@ -842,6 +870,12 @@ func (m *StoreInfo) Size() (n int) {
 	if m.MaxTime != 0 {
 		n += 1 + sovRpc(uint64(m.MaxTime))
 	}
+	if m.SupportsLabelValuesStream {
+		n += 2
+	}
+	if m.SupportsQueryPushdown {
+		n += 2
+	}
 	return n
 }
 
@@ -1351,6 +1385,46 @@ func (m *StoreInfo) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsLabelValuesStream", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsLabelValuesStream = bool(v != 0)
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsQueryPushdown", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsQueryPushdown = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
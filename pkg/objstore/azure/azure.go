@@ -42,13 +42,20 @@ var DefaultConfig = Config{
 
 // Config Azure storage configuration.
 type Config struct {
-	StorageAccountName string             `yaml:"storage_account"`
-	StorageAccountKey  string             `yaml:"storage_account_key"`
-	ContainerName      string             `yaml:"container"`
-	Endpoint           string             `yaml:"endpoint"`
-	MaxRetries         int                `yaml:"max_retries"`
-	MSIResource        string             `yaml:"msi_resource"`
-	UserAssignedID     string             `yaml:"user_assigned_id"`
+	StorageAccountName string `yaml:"storage_account"`
+	StorageAccountKey  string `yaml:"storage_account_key"`
+	ContainerName      string `yaml:"container"`
+	Endpoint           string `yaml:"endpoint"`
+	MaxRetries         int    `yaml:"max_retries"`
+	MSIResource        string `yaml:"msi_resource"`
+	UserAssignedID     string `yaml:"user_assigned_id"`
+	// FederatedTokenFile, ClientID and TenantID configure Azure AD workload identity authentication. They default to
+	// the AZURE_FEDERATED_TOKEN_FILE, AZURE_CLIENT_ID and AZURE_TENANT_ID environment variables set by the workload
+	// identity webhook, if no other credentials are configured.
+	FederatedTokenFile string             `yaml:"federated_token_file"`
+	ClientID           string             `yaml:"client_id"`
+	TenantID           string             `yaml:"tenant_id"`
+	AuthorityHost      string             `yaml:"authority_host"`
 	PipelineConfig     PipelineConfig     `yaml:"pipeline_config"`
 	ReaderConfig       ReaderConfig       `yaml:"reader_config"`
 	HTTPConfig         exthttp.HTTPConfig `yaml:"http_config"`
@@ -72,11 +79,46 @@ type Bucket struct {
 	config       *Config
 }
 
+// applyWorkloadIdentityEnv fills the workload identity settings from the environment variables set by the workload
+// identity webhook. The federated token file is only taken from the environment if no other credentials are
+// configured.
+func (conf *Config) applyWorkloadIdentityEnv() {
+	if conf.FederatedTokenFile == "" {
+		if conf.StorageAccountKey != "" || conf.MSIResource != "" || conf.UserAssignedID != "" {
+			return
+		}
+		conf.FederatedTokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		if conf.FederatedTokenFile == "" {
+			return
+		}
+	}
+	if conf.ClientID == "" {
+		conf.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if conf.TenantID == "" {
+		conf.TenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+	if conf.AuthorityHost == "" {
+		conf.AuthorityHost = os.Getenv("AZURE_AUTHORITY_HOST")
+	}
+}
+
 // Validate checks to see if any of the config options are set.
 func (conf *Config) validate() error {
+	conf.applyWorkloadIdentityEnv()
 
 	var errMsg []string
-	if conf.MSIResource == "" {
+	if conf.FederatedTokenFile != "" {
+		if conf.StorageAccountKey != "" || conf.MSIResource != "" || conf.UserAssignedID != "" {
+			return errors.New("conflicting Azure credentials: federated_token_file can't be used together with storage_account_key, msi_resource or user_assigned_id")
+		}
+		if conf.StorageAccountName == "" {
+			errMsg = append(errMsg, "workload identity is configured but storage account name is missing")
+		}
+		if conf.ClientID == "" || conf.TenantID == "" {
+			errMsg = append(errMsg, "workload identity is configured but client_id or tenant_id is missing")
+		}
+	} else if conf.MSIResource == "" {
 		if conf.UserAssignedID == "" {
 			if conf.StorageAccountName == "" ||
 				conf.StorageAccountKey == "" {
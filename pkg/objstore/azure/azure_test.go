@@ -160,6 +160,47 @@ container: "MyContainer"`),
 		wantFailParse:    false,
 		wantFailValidate: false,
 	},
+	{
+		name: "Valid Workload Identity Config",
+		config: []byte(`storage_account: "myAccount"
+federated_token_file: "/var/run/secrets/azure/tokens/azure-identity-token"
+client_id: "1234-56578678-655"
+tenant_id: "abcd-56578678-655"
+container: "MyContainer"`),
+		wantFailParse:    false,
+		wantFailValidate: false,
+	},
+	{
+		name: "Workload Identity Config without tenant",
+		config: []byte(`storage_account: "myAccount"
+federated_token_file: "/var/run/secrets/azure/tokens/azure-identity-token"
+client_id: "1234-56578678-655"
+container: "MyContainer"`),
+		wantFailParse:    false,
+		wantFailValidate: true,
+	},
+	{
+		name: "Workload Identity Config with storage account key",
+		config: []byte(`storage_account: "myAccount"
+storage_account_key: "abc123"
+federated_token_file: "/var/run/secrets/azure/tokens/azure-identity-token"
+client_id: "1234-56578678-655"
+tenant_id: "abcd-56578678-655"
+container: "MyContainer"`),
+		wantFailParse:    false,
+		wantFailValidate: true,
+	},
+	{
+		name: "Workload Identity Config with User Assigned Identity",
+		config: []byte(`storage_account: "myAccount"
+user_assigned_id: "1234-56578678-655"
+federated_token_file: "/var/run/secrets/azure/tokens/azure-identity-token"
+client_id: "1234-56578678-655"
+tenant_id: "abcd-56578678-655"
+container: "MyContainer"`),
+		wantFailParse:    false,
+		wantFailValidate: true,
+	},
 }
 
 func TestConfig_validate(t *testing.T) {
@@ -181,6 +222,26 @@ func TestConfig_validate(t *testing.T) {
 
 }
 
+func TestConfig_validate_WorkloadIdentityFromEnv(t *testing.T) {
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "/var/run/secrets/azure/tokens/azure-identity-token")
+	t.Setenv("AZURE_CLIENT_ID", "1234-56578678-655")
+	t.Setenv("AZURE_TENANT_ID", "abcd-56578678-655")
+
+	conf, err := parseConfig([]byte(`storage_account: "myAccount"
+container: "MyContainer"`))
+	testutil.Ok(t, err)
+	testutil.Ok(t, conf.validate())
+	testutil.Equals(t, "/var/run/secrets/azure/tokens/azure-identity-token", conf.FederatedTokenFile)
+	testutil.Equals(t, "1234-56578678-655", conf.ClientID)
+	testutil.Equals(t, "abcd-56578678-655", conf.TenantID)
+
+	// Explicitly configured credentials take precedence over the environment.
+	conf, err = parseConfig(validConfig)
+	testutil.Ok(t, err)
+	testutil.Ok(t, conf.validate())
+	testutil.Equals(t, "", conf.FederatedTokenFile)
+}
+
 func TestParseConfig_DefaultHTTPConfig(t *testing.T) {
 
 	cfg, err := parseConfig(validConfig)
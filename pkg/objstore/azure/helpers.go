@@ -6,17 +6,21 @@ package azure
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
 	blob "github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
 	"github.com/thanos-io/thanos/pkg/exthttp"
 )
 
@@ -37,8 +41,16 @@ func init() {
 }
 
 func getAzureStorageCredentials(logger log.Logger, conf Config) (blob.Credential, error) {
-	if conf.MSIResource != "" || conf.UserAssignedID != "" {
-		spt, err := getServicePrincipalToken(logger, conf)
+	if conf.FederatedTokenFile != "" || conf.MSIResource != "" || conf.UserAssignedID != "" {
+		var (
+			spt *adal.ServicePrincipalToken
+			err error
+		)
+		if conf.FederatedTokenFile != "" {
+			spt, err = getWorkloadIdentityToken(logger, conf)
+		} else {
+			spt, err = getServicePrincipalToken(logger, conf)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -49,7 +61,7 @@ func getAzureStorageCredentials(logger log.Logger, conf Config) (blob.Credential
 		return blob.NewTokenCredential(spt.Token().AccessToken, func(tc blob.TokenCredential) time.Duration {
 			err := spt.Refresh()
 			if err != nil {
-				level.Error(logger).Log("msg", "could not refresh MSI token", "err", err)
+				level.Error(logger).Log("msg", "could not refresh Azure AD token", "err", err)
 				// Retry later as the error can be related to API throttling
 				return 30 * time.Second
 			}
@@ -85,6 +97,37 @@ func getServicePrincipalToken(logger log.Logger, conf Config) (*adal.ServicePrin
 	return msiConfig.ServicePrincipalToken()
 }
 
+// federatedTokenSecret authenticates with the federated token of the workload identity, read from its file on every
+// token refresh, as the file is rotated by the kubelet.
+type federatedTokenSecret struct {
+	file string
+}
+
+func (s *federatedTokenSecret) SetAuthenticationValues(_ *adal.ServicePrincipalToken, v *url.Values) error {
+	token, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return errors.Wrap(err, "read federated token file")
+	}
+	v.Set("client_assertion", strings.TrimSpace(string(token)))
+	v.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	return nil
+}
+
+func getWorkloadIdentityToken(logger log.Logger, conf Config) (*adal.ServicePrincipalToken, error) {
+	authorityHost := conf.AuthorityHost
+	if authorityHost == "" {
+		authorityHost = azure.PublicCloud.ActiveDirectoryEndpoint
+	}
+	oauthConfig, err := adal.NewOAuthConfig(authorityHost, conf.TenantID)
+	if err != nil {
+		return nil, errors.Wrap(err, "create OAuth config")
+	}
+
+	level.Debug(logger).Log("msg", "using workload identity", "clientId", conf.ClientID, "tenantId", conf.TenantID)
+	resource := fmt.Sprintf("https://%s.%s", conf.StorageAccountName, conf.Endpoint)
+	return adal.NewServicePrincipalTokenWithSecret(*oauthConfig, conf.ClientID, resource, &federatedTokenSecret{file: conf.FederatedTokenFile})
+}
+
 func getContainerURL(ctx context.Context, logger log.Logger, conf Config) (blob.ContainerURL, error) {
 	credentials, err := getAzureStorageCredentials(logger, conf)
 
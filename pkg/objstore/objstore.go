@@ -53,6 +53,13 @@ type Bucket interface {
 	Name() string
 }
 
+// MultipartUploader is implemented by buckets which are able to upload an object in multiple parts concurrently.
+type MultipartUploader interface {
+	// UploadMultipart uploads size bytes of the reader as an object into the bucket, in parts of partSize bytes.
+	// Up to concurrency parts are uploaded at once.
+	UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, concurrency uint) error
+}
+
 // InstrumentedBucket is a Bucket with optional instrumentation control on reader.
 type InstrumentedBucket interface {
 	Bucket
@@ -157,9 +164,13 @@ func applyDownloadOptions(options ...DownloadOption) downloadParams {
 // UploadOption configures the provided params.
 type UploadOption func(params *uploadParams)
 
-// uploadParams holds the UploadDir() parameters and is used by objstore clients implementations.
+// uploadParams holds the UploadDir() and UploadFile() parameters and is used by objstore clients implementations.
 type uploadParams struct {
 	concurrency int
+
+	multipartThreshold   int64
+	multipartPartSize    uint64
+	multipartConcurrency uint
 }
 
 // WithUploadConcurrency is an option to set the concurrency of the upload operation.
@@ -169,6 +180,17 @@ func WithUploadConcurrency(concurrency int) UploadOption {
 	}
 }
 
+// WithMultipartUpload is an option to upload files of at least threshold bytes with multipart upload, in parts
+// of partSize bytes, uploading up to concurrency parts at once. It is used only for buckets implementing
+// MultipartUploader, other buckets upload such files with Upload.
+func WithMultipartUpload(threshold int64, partSize uint64, concurrency uint) UploadOption {
+	return func(params *uploadParams) {
+		params.multipartThreshold = threshold
+		params.multipartPartSize = partSize
+		params.multipartConcurrency = concurrency
+	}
+}
+
 func applyUploadOptions(options ...UploadOption) uploadParams {
 	out := uploadParams{
 		concurrency: 1,
@@ -261,7 +283,7 @@ func UploadDir(ctx context.Context, logger log.Logger, bkt Bucket, srcdir, dstdi
 			}
 
 			dst := path.Join(dstdir, filepath.ToSlash(srcRel))
-			return UploadFile(ctx, logger, bkt, src, dst)
+			return UploadFile(ctx, logger, bkt, src, dst, options...)
 		})
 
 		return nil
@@ -276,13 +298,29 @@ func UploadDir(ctx context.Context, logger log.Logger, bkt Bucket, srcdir, dstdi
 
 // UploadFile uploads the file with the given name to the bucket.
 // It is a caller responsibility to clean partial upload in case of failure.
-func UploadFile(ctx context.Context, logger log.Logger, bkt Bucket, src, dst string) error {
+func UploadFile(ctx context.Context, logger log.Logger, bkt Bucket, src, dst string, options ...UploadOption) error {
+	opts := applyUploadOptions(options...)
+
 	r, err := os.Open(filepath.Clean(src))
 	if err != nil {
 		return errors.Wrapf(err, "open file %s", src)
 	}
 	defer runutil.CloseWithLogOnErr(logger, r, "close file %s", src)
 
+	if opts.multipartThreshold > 0 {
+		fi, err := r.Stat()
+		if err != nil {
+			return errors.Wrapf(err, "stat file %s", src)
+		}
+		if fi.Size() >= opts.multipartThreshold {
+			if err := uploadMultipart(ctx, bkt, dst, r, fi.Size(), opts.multipartPartSize, opts.multipartConcurrency); err != nil {
+				return errors.Wrapf(err, "upload file %s as %s", src, dst)
+			}
+			level.Debug(logger).Log("msg", "uploaded file", "from", src, "dst", dst, "bucket", bkt.Name(), "multipart", true)
+			return nil
+		}
+	}
+
 	if err := bkt.Upload(ctx, dst, r); err != nil {
 		return errors.Wrapf(err, "upload file %s as %s", src, dst)
 	}
@@ -290,6 +328,14 @@ func UploadFile(ctx context.Context, logger log.Logger, bkt Bucket, src, dst str
 	return nil
 }
 
+// uploadMultipart uploads the object with multipart upload if the bucket supports it, and with Upload otherwise.
+func uploadMultipart(ctx context.Context, bkt Bucket, name string, r io.Reader, size int64, partSize uint64, concurrency uint) error {
+	if mu, ok := bkt.(MultipartUploader); ok {
+		return mu.UploadMultipart(ctx, name, r, size, partSize, concurrency)
+	}
+	return bkt.Upload(ctx, name, r)
+}
+
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
@@ -572,6 +618,24 @@ func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) err
 	return nil
 }
 
+// UploadMultipart uses multipart upload of the underlying bucket if supported, and Upload otherwise.
+// It is accounted as an upload operation.
+func (b *metricBucket) UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, concurrency uint) error {
+	const op = OpUpload
+	b.ops.WithLabelValues(op).Inc()
+
+	start := time.Now()
+	if err := uploadMultipart(ctx, b.bkt, name, r, size, partSize, concurrency); err != nil {
+		if !b.isOpFailureExpected(err) && ctx.Err() != context.Canceled {
+			b.opsFailures.WithLabelValues(op).Inc()
+		}
+		return err
+	}
+	b.lastSuccessfulUploadTime.WithLabelValues(b.bkt.Name()).SetToCurrentTime()
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	return nil
+}
+
 func (b *metricBucket) Delete(ctx context.Context, name string) error {
 	const op = OpDelete
 	b.ops.WithLabelValues(op).Inc()
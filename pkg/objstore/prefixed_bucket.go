@@ -85,6 +85,11 @@ func (p *PrefixedBucket) Upload(ctx context.Context, name string, r io.Reader) e
 	return p.bkt.Upload(ctx, conditionalPrefix(p.prefix, name), r)
 }
 
+// UploadMultipart uploads the object with multipart upload if the underlying bucket supports it, and with Upload otherwise.
+func (p *PrefixedBucket) UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, concurrency uint) error {
+	return uploadMultipart(ctx, p.bkt, conditionalPrefix(p.prefix, name), r, size, partSize, concurrency)
+}
+
 // Delete removes the object with the given name.
 // If object does not exists in the moment of deletion, Delete should throw error.
 func (p *PrefixedBucket) Delete(ctx context.Context, name string) error {
@@ -5,7 +5,10 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -146,6 +149,10 @@ type SSEConfig struct {
 	KMSKeyID             string            `yaml:"kms_key_id"`
 	KMSEncryptionContext map[string]string `yaml:"kms_encryption_context"`
 	EncryptionKey        string            `yaml:"encryption_key"`
+	// CustomerKey is the base64 encoded SSE-C key, an alternative to the EncryptionKey file.
+	CustomerKey string `yaml:"customer_key"`
+	// CustomerKeyMD5 is the optional base64 encoded MD5 digest of CustomerKey, checked against it.
+	CustomerKeyMD5 string `yaml:"customer_key_md5"`
 }
 
 type TraceConfig struct {
@@ -281,7 +288,7 @@ func NewBucketWithConfig(logger log.Logger, config Config, component string) (*B
 			}
 
 		case SSEC:
-			key, err := ioutil.ReadFile(config.SSEConfig.EncryptionKey)
+			key, err := sseCustomerKey(config.SSEConfig)
 			if err != nil {
 				return nil, err
 			}
@@ -344,8 +351,18 @@ func validate(conf Config) error {
 		return errors.New("no s3 secret_key specified while access_key is present in config file; either both should be present in config or envvars/IAM should be used.")
 	}
 
-	if conf.SSEConfig.Type == SSEC && conf.SSEConfig.EncryptionKey == "" {
-		return errors.New("encryption_key must be set if sse_config.type is set to 'SSE-C'")
+	if conf.SSEConfig.Type == SSEC {
+		if conf.SSEConfig.EncryptionKey == "" && conf.SSEConfig.CustomerKey == "" {
+			return errors.New("encryption_key or customer_key must be set if sse_config.type is set to 'SSE-C'")
+		}
+		if conf.SSEConfig.EncryptionKey != "" && conf.SSEConfig.CustomerKey != "" {
+			return errors.New("only one of encryption_key and customer_key can be set if sse_config.type is set to 'SSE-C'")
+		}
+		if conf.SSEConfig.CustomerKey != "" {
+			if _, err := sseCustomerKey(conf.SSEConfig); err != nil {
+				return err
+			}
+		}
 	}
 
 	if conf.SSEConfig.Type == SSEKMS && conf.SSEConfig.KMSKeyID == "" {
@@ -355,6 +372,31 @@ func validate(conf Config) error {
 	return nil
 }
 
+// sseCustomerKey returns the SSE-C key, read from the encryption_key file or decoded from customer_key.
+func sseCustomerKey(conf SSEConfig) ([]byte, error) {
+	if conf.CustomerKey == "" {
+		return ioutil.ReadFile(conf.EncryptionKey)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(conf.CustomerKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode customer_key")
+	}
+	if len(key) != 32 {
+		return nil, errors.Errorf("customer_key must be a 256 bit key, got %d bits", len(key)*8)
+	}
+	if conf.CustomerKeyMD5 != "" {
+		keyMD5, err := base64.StdEncoding.DecodeString(conf.CustomerKeyMD5)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode customer_key_md5")
+		}
+		if sum := md5.Sum(key); !bytes.Equal(sum[:], keyMD5) {
+			return nil, errors.New("customer_key_md5 doesn't match the MD5 digest of customer_key")
+		}
+	}
+	return key, nil
+}
+
 // ValidateForTests checks to see the config options for tests are set.
 func ValidateForTests(conf Config) error {
 	if conf.Endpoint == "" ||
@@ -446,7 +488,13 @@ func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (
 
 // Exists checks if the given object exists.
 func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
-	_, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{})
+	sse, err := b.getServerSideEncryption(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// SSE-C objects can't be stat'ed without their key.
+	_, err = b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{ServerSideEncryption: sse})
 	if err != nil {
 		if b.IsObjNotFoundErr(err) {
 			return false, nil
@@ -493,9 +541,41 @@ func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	return nil
 }
 
+// UploadMultipart uploads the object with multipart upload, in parts of partSize bytes uploaded with the given concurrency.
+// S3 requires parts of at least 5MiB, except for the last one.
+func (b *Bucket) UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, concurrency uint) error {
+	sse, err := b.getServerSideEncryption(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.client.PutObject(
+		ctx,
+		b.name,
+		name,
+		r,
+		size,
+		minio.PutObjectOptions{
+			PartSize:             partSize,
+			NumThreads:           concurrency,
+			ServerSideEncryption: sse,
+			UserMetadata:         b.putUserMetadata,
+		},
+	); err != nil {
+		return errors.Wrap(err, "multipart upload s3 object")
+	}
+
+	return nil
+}
+
 // Attributes returns information about the specified object.
 func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
-	objInfo, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{})
+	sse, err := b.getServerSideEncryption(ctx)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+
+	objInfo, err := b.client.StatObject(ctx, b.name, name, minio.StatObjectOptions{ServerSideEncryption: sse})
 	if err != nil {
 		return objstore.ObjectAttributes{}, err
 	}
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -120,6 +121,53 @@ sse_config:
 	testutil.Ok(t, err)
 	// Since the error handling for "proper type" if done as we're setting up the bucket.
 	testutil.Ok(t, validate(cfg))
+
+	// Base64 of a 256 bit key and of its MD5 digest.
+	key := base64.StdEncoding.EncodeToString([]byte("01234567890123456789012345678901"))
+	keyMD5 := "KYvwGXoFFJ42a2u2GDWhwQ=="
+
+	input9 := []byte(`bucket: abdd
+endpoint: "s3-endpoint"
+sse_config:
+  type: SSE-C
+  customer_key: ` + key + `
+  customer_key_md5: ` + keyMD5)
+
+	cfg, err = parseConfig(input9)
+	testutil.Ok(t, err)
+	testutil.Ok(t, validate(cfg))
+
+	input10 := []byte(`bucket: abdd
+endpoint: "s3-endpoint"
+sse_config:
+  type: SSE-C
+  customer_key: ` + key + `
+  customer_key_md5: ` + base64.StdEncoding.EncodeToString([]byte("not the md5")))
+
+	cfg, err = parseConfig(input10)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, validate(cfg))
+
+	input11 := []byte(`bucket: abdd
+endpoint: "s3-endpoint"
+sse_config:
+  type: SSE-C
+  customer_key: ` + base64.StdEncoding.EncodeToString([]byte("too short")))
+
+	cfg, err = parseConfig(input11)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, validate(cfg))
+
+	input12 := []byte(`bucket: abdd
+endpoint: "s3-endpoint"
+sse_config:
+  type: SSE-C
+  encryption_key: /some/file
+  customer_key: ` + key)
+
+	cfg, err = parseConfig(input12)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, validate(cfg))
 }
 
 func TestParseConfig_DefaultHTTPConfig(t *testing.T) {
@@ -419,3 +467,59 @@ func TestBucket_Get_ShouldReturnErrorIfServerTruncateResponse(t *testing.T) {
 	_, err = ioutil.ReadAll(reader)
 	testutil.Equals(t, io.ErrUnexpectedEOF, err)
 }
+
+func TestBucket_SSEC_SendsKeyOnEveryRequest(t *testing.T) {
+	const keyHeader = "X-Amz-Server-Side-Encryption-Customer-Key"
+	key := base64.StdEncoding.EncodeToString([]byte("01234567890123456789012345678901"))
+
+	requests := map[string]int{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, key, r.Header.Get(keyHeader), "no SSE-C key in %s request", r.Method)
+		requests[r.Method]++
+
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Length", "5")
+		if r.Method == http.MethodPut {
+			w.Header().Set("Content-Length", "0")
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, err := w.Write([]byte("12345"))
+			testutil.Ok(t, err)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig
+	cfg.Bucket = "test-bucket"
+	cfg.Endpoint = srv.Listener.Addr().String()
+	cfg.HTTPConfig.InsecureSkipVerify = true
+	cfg.Region = "test"
+	cfg.AccessKey = "test"
+	cfg.SecretKey = "test"
+	cfg.SSEConfig = SSEConfig{Type: SSEC, CustomerKey: key}
+	testutil.Ok(t, validate(cfg))
+
+	bkt, err := NewBucketWithConfig(log.NewNopLogger(), cfg, "test")
+	testutil.Ok(t, err)
+
+	ctx := context.Background()
+	testutil.Ok(t, bkt.Upload(ctx, "test", strings.NewReader("12345")))
+
+	r, err := bkt.Get(ctx, "test")
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Ok(t, r.Close())
+
+	ok, err := bkt.Exists(ctx, "test")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok)
+
+	attrs, err := bkt.Attributes(ctx, "test")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(5), attrs.Size)
+
+	testutil.Equals(t, map[string]int{http.MethodPut: 1, http.MethodGet: 1, http.MethodHead: 2}, requests)
+}
@@ -81,6 +81,14 @@ func (t TracingBucket) Upload(ctx context.Context, name string, r io.Reader) (er
 	return
 }
 
+func (t TracingBucket) UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, concurrency uint) (err error) {
+	tracing.DoWithSpan(ctx, "bucket_upload_multipart", func(spanCtx context.Context, span opentracing.Span) {
+		span.LogKV("name", name, "size", size, "part_size", partSize)
+		err = uploadMultipart(spanCtx, t.bkt, name, r, size, partSize, concurrency)
+	})
+	return
+}
+
 func (t TracingBucket) Delete(ctx context.Context, name string) (err error) {
 	tracing.DoWithSpan(ctx, "bucket_delete", func(spanCtx context.Context, span opentracing.Span) {
 		span.LogKV("name", name)
@@ -0,0 +1,239 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/extgrpc/snappy"
+	"github.com/thanos-io/thanos/pkg/extgrpc/zstd"
+)
+
+// CompressionNone disables gRPC compression for an endpoint.
+const CompressionNone = "none"
+
+// EndpointCompressions holds gRPC compression overrides for endpoints, in order of precedence. Endpoints rejecting
+// the compression of their override, because they don't support it, fall back to no compression.
+type EndpointCompressions struct {
+	logger    log.Logger
+	overrides []endpointCompression
+
+	mtx sync.Mutex
+	// unsupported holds the addresses of endpoints which rejected their compression.
+	unsupported map[string]struct{}
+
+	ratio *prometheus.HistogramVec
+}
+
+type endpointCompression struct {
+	addr        *regexp.Regexp
+	compression string
+}
+
+// ParseEndpointCompressions parses compression overrides in the `<address regex>=<compression>` form.
+// The regex has to match the whole endpoint address and compression is one of "none", "snappy", "gzip" or "zstd".
+func ParseEndpointCompressions(logger log.Logger, reg prometheus.Registerer, overrides []string) (*EndpointCompressions, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	ecs := &EndpointCompressions{
+		logger:      logger,
+		overrides:   make([]endpointCompression, 0, len(overrides)),
+		unsupported: map[string]struct{}{},
+		ratio: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_store_api_grpc_compression_ratio",
+			Help:    "Ratio of the uncompressed to the compressed size of the compressed gRPC messages received from Store API endpoints.",
+			Buckets: prometheus.ExponentialBuckets(1, 1.5, 10),
+		}, []string{"compression"}),
+	}
+	for _, o := range overrides {
+		i := strings.LastIndex(o, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid endpoint compression %q, expected <address regex>=<compression>", o)
+		}
+
+		compression := o[i+1:]
+		switch compression {
+		case CompressionNone, snappy.Name, gzip.Name, zstd.Name:
+		default:
+			return nil, errors.Errorf("unsupported compression %q for %q, must be one of %q, %q, %q or %q", compression, o[:i], CompressionNone, snappy.Name, gzip.Name, zstd.Name)
+		}
+
+		re, err := regexp.Compile("^(?:" + o[:i] + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "compile endpoint address regex %q", o[:i])
+		}
+		ecs.overrides = append(ecs.overrides, endpointCompression{addr: re, compression: compression})
+	}
+	return ecs, nil
+}
+
+// Compression returns the compression used for the endpoint with the given address: the compression of the first
+// override matching it, unless the endpoint rejected it, or "none".
+func (ecs *EndpointCompressions) Compression(addr string) string {
+	compression := ecs.configured(addr)
+	if compression == CompressionNone {
+		return compression
+	}
+
+	ecs.mtx.Lock()
+	defer ecs.mtx.Unlock()
+	if _, ok := ecs.unsupported[addr]; ok {
+		return CompressionNone
+	}
+	return compression
+}
+
+func (ecs *EndpointCompressions) configured(addr string) string {
+	for _, ec := range ecs.overrides {
+		if ec.addr.MatchString(addr) {
+			return ec.compression
+		}
+	}
+	return CompressionNone
+}
+
+// DialOptions returns dial options setting the compression of the first override matching the given address.
+// It returns no options if no override matches, so the endpoint keeps using the default compression.
+// Unary calls rejected by the endpoint for not supporting the compression are retried without compression, and
+// all following calls to the endpoint are sent without compression. As the Info call is the first one made to an
+// endpoint, streamed calls are normally not affected.
+func (ecs *EndpointCompressions) DialOptions(addr string) []grpc.DialOption {
+	compression := ecs.configured(addr)
+	if compression == CompressionNone {
+		return nil
+	}
+	return []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(compression)),
+		grpc.WithChainUnaryInterceptor(ecs.unaryClientInterceptor(addr, compression)),
+		grpc.WithChainStreamInterceptor(ecs.streamClientInterceptor(addr, compression)),
+		grpc.WithStatsHandler(&compressionRatioHandler{ratio: ecs.ratio}),
+	}
+}
+
+func (ecs *EndpointCompressions) unaryClientInterceptor(addr, compression string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ecs.Compression(addr) == CompressionNone {
+			return invoker(ctx, method, req, reply, cc, append(opts, grpc.UseCompressor(encoding.Identity))...)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if !isCompressionUnsupported(err) {
+			return err
+		}
+		ecs.markUnsupported(addr, compression, err)
+		return invoker(ctx, method, req, reply, cc, append(opts, grpc.UseCompressor(encoding.Identity))...)
+	}
+}
+
+func (ecs *EndpointCompressions) streamClientInterceptor(addr, compression string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if ecs.Compression(addr) == CompressionNone {
+			return streamer(ctx, desc, cc, method, append(opts, grpc.UseCompressor(encoding.Identity))...)
+		}
+		// Messages of a stream can't be sent again, so a rejected stream only disables compression for the next calls.
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &compressionCheckingStream{ClientStream: s, onUnsupported: func(err error) { ecs.markUnsupported(addr, compression, err) }}, nil
+	}
+}
+
+func (ecs *EndpointCompressions) markUnsupported(addr, compression string, err error) {
+	ecs.mtx.Lock()
+	defer ecs.mtx.Unlock()
+
+	if _, ok := ecs.unsupported[addr]; ok {
+		return
+	}
+	ecs.unsupported[addr] = struct{}{}
+	level.Warn(ecs.logger).Log("msg", "endpoint doesn't support the gRPC compression, falling back to no compression", "address", addr, "compression", compression, "err", err)
+}
+
+// isCompressionUnsupported returns whether the error was returned by a gRPC server without the compressor of the call.
+func isCompressionUnsupported(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.Unimplemented && strings.Contains(s.Message(), "Decompressor is not installed")
+}
+
+// WithEndpointCompressions reports the compression used for every endpoint in its status.
+func WithEndpointCompressions(ecs *EndpointCompressions) EndpointSetOption {
+	return func(e *EndpointSet) {
+		e.endpointCompression = ecs.Compression
+	}
+}
+
+// compressionCheckingStream reports if the endpoint rejected the compression of the stream.
+type compressionCheckingStream struct {
+	grpc.ClientStream
+	onUnsupported func(error)
+}
+
+func (s *compressionCheckingStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if isCompressionUnsupported(err) {
+		s.onUnsupported(err)
+	}
+	return err
+}
+
+// compressionRatioHandler observes the compression ratio of the compressed messages received by a client.
+type compressionRatioHandler struct {
+	ratio *prometheus.HistogramVec
+}
+
+type compressionCtxKey struct{}
+
+// rpcCompression holds the compression of the responses of an RPC, known once their header is received.
+type rpcCompression struct {
+	mtx         sync.Mutex
+	compression string
+}
+
+func (h *compressionRatioHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, compressionCtxKey{}, &rpcCompression{})
+}
+
+func (h *compressionRatioHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	c, ok := ctx.Value(compressionCtxKey{}).(*rpcCompression)
+	if !ok {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.InHeader:
+		c.mtx.Lock()
+		c.compression = s.Compression
+		c.mtx.Unlock()
+	case *stats.InPayload:
+		c.mtx.Lock()
+		compression := c.compression
+		c.mtx.Unlock()
+		if compression == "" || compression == encoding.Identity || s.WireLength == 0 {
+			return
+		}
+		h.ratio.WithLabelValues(compression).Observe(float64(s.Length) / float64(s.WireLength))
+	}
+}
+
+func (h *compressionRatioHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionRatioHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,241 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// WithEndpointSeriesConcurrency limits the number of concurrent Series calls to each endpoint, so that an overloaded
+// endpoint doesn't get an unbounded number of them. Calls above the limit wait for another call to the endpoint to
+// finish, or fail right away with a ResourceExhausted error if failFast is true. A limit of 0 disables it.
+func WithEndpointSeriesConcurrency(limit int, failFast bool) EndpointSetOption {
+	return func(e *EndpointSet) {
+		e.seriesConcurrency.endpoint.limit = func(string) int { return limit }
+		e.seriesConcurrency.endpoint.failFast = failFast
+	}
+}
+
+// StoreTypeConcurrency holds the maximum number of concurrent Series calls to all endpoints of a store type.
+type StoreTypeConcurrency map[component.StoreAPI]int
+
+// ParseStoreTypeConcurrency parses store type concurrency limits in the `<store type>=<limit>` form, e.g. `store=8`.
+func ParseStoreTypeConcurrency(flags []string) (StoreTypeConcurrency, error) {
+	res := StoreTypeConcurrency{}
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid store type concurrency %q, expected <store type>=<limit>", f)
+		}
+
+		storeType := component.FromString(parts[0])
+		if storeType == component.UnknownStoreAPI {
+			return nil, errors.Errorf("unknown store type %q in %q", parts[0], f)
+		}
+		if _, ok := res[storeType]; ok {
+			return nil, errors.Errorf("duplicate concurrency of store type %q", parts[0])
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit <= 0 {
+			return nil, errors.Errorf("invalid concurrency %q of store type %q, expected a positive integer", parts[1], parts[0])
+		}
+		res[storeType] = limit
+	}
+	return res, nil
+}
+
+// WithStoreTypeSeriesConcurrency limits the number of concurrent Series calls to all endpoints of each of the store
+// types, e.g. to throttle calls to heavy store gateways more than calls to sidecars. Calls above the limit of their
+// store type wait for another call to an endpoint of the type to finish. Store types without a limit are not limited.
+func WithStoreTypeSeriesConcurrency(limits StoreTypeConcurrency) EndpointSetOption {
+	byName := make(map[string]int, len(limits))
+	for storeType, limit := range limits {
+		byName[storeType.String()] = limit
+	}
+	return func(e *EndpointSet) {
+		e.seriesConcurrency.storeType.limit = func(storeType string) int { return byName[storeType] }
+	}
+}
+
+// seriesConcurrency limits the concurrent Series calls by endpoint and by store type.
+type seriesConcurrency struct {
+	endpoint  *seriesCallLimiter
+	storeType *seriesCallLimiter
+}
+
+// storeClient returns the store client of the endpoint, limiting its Series calls if enabled.
+func (c *seriesConcurrency) storeClient(addr string, storeType component.Component, client storepb.StoreClient) storepb.StoreClient {
+	if !c.endpoint.enabled() && !c.storeType.enabled() {
+		return client
+	}
+	return &limitedStoreClient{StoreClient: client, addr: addr, storeType: storeType.String(), concurrency: c}
+}
+
+// seriesCallLimiter tracks the in-flight Series calls of every key, e.g. endpoint, against the limit of the key.
+type seriesCallLimiter struct {
+	// kind is what calls are limited by, used in errors.
+	kind string
+	// limit returns the limit of a key, calls of keys without a positive limit are not limited.
+	// It is nil if no limit is set.
+	limit    func(key string) int
+	failFast bool
+
+	mtx   sync.Mutex
+	slots map[string]chan struct{}
+
+	inflight *prometheus.GaugeVec
+	limited  *prometheus.CounterVec
+}
+
+func newSeriesCallLimiter(kind string, inflight *prometheus.GaugeVec, limited *prometheus.CounterVec) *seriesCallLimiter {
+	return &seriesCallLimiter{
+		kind:     kind,
+		slots:    map[string]chan struct{}{},
+		inflight: inflight,
+		limited:  limited,
+	}
+}
+
+func (c *seriesCallLimiter) enabled() bool {
+	return c.limit != nil
+}
+
+// acquire takes a slot for a Series call of the key, returning the function releasing it.
+func (c *seriesCallLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	if !c.enabled() {
+		return func() {}, nil
+	}
+	limit := c.limit(key)
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	c.mtx.Lock()
+	slots, ok := c.slots[key]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		c.slots[key] = slots
+	}
+	c.mtx.Unlock()
+
+	if c.failFast {
+		select {
+		case slots <- struct{}{}:
+		default:
+			c.limited.WithLabelValues(key).Inc()
+			return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent Series calls to %s %s, limit is %d", c.kind, key, limit)
+		}
+	} else {
+		select {
+		case slots <- struct{}{}:
+		default:
+			c.limited.WithLabelValues(key).Inc()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	inflight := c.inflight.WithLabelValues(key)
+	inflight.Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inflight.Dec()
+			<-slots
+		})
+	}, nil
+}
+
+// remove drops the state of a key which is no longer used, e.g. an endpoint removed from the endpoint set.
+// Calls still in flight release their slot into the dropped state.
+func (c *seriesCallLimiter) remove(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.slots, key)
+	c.inflight.DeleteLabelValues(key)
+	c.limited.DeleteLabelValues(key)
+}
+
+// limitedStoreClient is a store client holding a slot of its endpoint and of its store type for the duration of
+// every Series call.
+type limitedStoreClient struct {
+	storepb.StoreClient
+
+	addr        string
+	storeType   string
+	concurrency *seriesConcurrency
+}
+
+func (c *limitedStoreClient) Series(ctx context.Context, req *storepb.SeriesRequest, opts ...grpc.CallOption) (storepb.Store_SeriesClient, error) {
+	// The slot of the endpoint is taken first, so that calls waiting for it don't hold a slot of the store type,
+	// which would block calls to other endpoints of the type.
+	releaseEndpoint, err := c.concurrency.endpoint.acquire(ctx, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	releaseStoreType, err := c.concurrency.storeType.acquire(ctx, c.storeType)
+	if err != nil {
+		releaseEndpoint()
+		return nil, err
+	}
+	release := func() {
+		releaseStoreType()
+		releaseEndpoint()
+	}
+
+	cl, err := c.StoreClient.Series(ctx, req, opts...)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	rcl := &releasingSeriesClient{Store_SeriesClient: cl, release: func() {
+		once.Do(func() {
+			close(done)
+			release()
+		})
+	}}
+	// The caller might stop receiving before the end of the stream, in which case it cancels the context.
+	go func() {
+		select {
+		case <-ctx.Done():
+			rcl.release()
+		case <-done:
+		}
+	}()
+	return rcl, nil
+}
+
+// releasingSeriesClient releases the slots of its Series call once the stream ends.
+type releasingSeriesClient struct {
+	storepb.Store_SeriesClient
+
+	release func()
+}
+
+func (c *releasingSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	resp, err := c.Store_SeriesClient.Recv()
+	if err != nil {
+		c.release()
+	}
+	return resp, err
+}
@@ -0,0 +1,208 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// blockingStoreClient returns Series streams ending once end is closed.
+type blockingStoreClient struct {
+	storepb.StoreClient
+
+	end chan struct{}
+}
+
+func (c *blockingStoreClient) Series(context.Context, *storepb.SeriesRequest, ...grpc.CallOption) (storepb.Store_SeriesClient, error) {
+	return &blockingSeriesClient{end: c.end}, nil
+}
+
+type blockingSeriesClient struct {
+	storepb.Store_SeriesClient
+
+	end chan struct{}
+}
+
+func (c *blockingSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	<-c.end
+	return nil, io.EOF
+}
+
+func TestEndpointSeriesConcurrency(t *testing.T) {
+	for _, failFast := range []bool{true, false} {
+		t.Run(fmt.Sprintf("failFast=%v", failFast), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			es := NewEndpointSet(nil, prometheus.NewRegistry(), nil, nil, time.Minute, WithEndpointSeriesConcurrency(2, failFast))
+			c := es.seriesConcurrency.endpoint
+			inflight := func(addr string) float64 { return promtest.ToFloat64(c.inflight.WithLabelValues(addr)) }
+			limited := func(addr string) float64 { return promtest.ToFloat64(c.limited.WithLabelValues(addr)) }
+
+			slow := &blockingStoreClient{end: make(chan struct{})}
+			other := &blockingStoreClient{end: make(chan struct{})}
+			slowClient := es.seriesConcurrency.storeClient("slow:10901", component.Store, slow)
+			otherClient := es.seriesConcurrency.storeClient("other:10901", component.Store, other)
+
+			var streams []storepb.Store_SeriesClient
+			for i := 0; i < 2; i++ {
+				s, err := slowClient.Series(ctx, &storepb.SeriesRequest{})
+				testutil.Ok(t, err)
+				streams = append(streams, s)
+			}
+			testutil.Equals(t, 2.0, inflight("slow:10901"))
+
+			// The limit of the endpoint is reached.
+			if failFast {
+				_, err := slowClient.Series(ctx, &storepb.SeriesRequest{})
+				testutil.NotOk(t, err)
+				testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+			} else {
+				tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				_, err := slowClient.Series(tctx, &storepb.SeriesRequest{})
+				cancel()
+				testutil.Equals(t, context.DeadlineExceeded, err)
+			}
+			testutil.Equals(t, 1.0, limited("slow:10901"))
+			testutil.Equals(t, 2.0, inflight("slow:10901"))
+
+			// Other endpoints are not affected.
+			s, err := otherClient.Series(ctx, &storepb.SeriesRequest{})
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1.0, inflight("other:10901"))
+			close(other.end)
+			_, err = s.Recv()
+			testutil.Equals(t, io.EOF, err)
+			testutil.Equals(t, 0.0, inflight("other:10901"))
+			testutil.Equals(t, 0.0, limited("other:10901"))
+
+			if failFast {
+				close(slow.end)
+				_, err = streams[0].Recv()
+				testutil.Equals(t, io.EOF, err)
+				testutil.Equals(t, 1.0, inflight("slow:10901"))
+				return
+			}
+
+			// Queued calls get the slot of a finished call.
+			queued := make(chan error, 1)
+			go func() {
+				_, err := slowClient.Series(ctx, &storepb.SeriesRequest{})
+				queued <- err
+			}()
+			testutil.Ok(t, waitFor(func() bool { return limited("slow:10901") == 2 }))
+			close(slow.end)
+			_, err = streams[0].Recv()
+			testutil.Equals(t, io.EOF, err)
+			testutil.Ok(t, <-queued)
+			testutil.Equals(t, 2.0, inflight("slow:10901"))
+		})
+	}
+}
+
+func TestEndpointSeriesConcurrency_ReleaseOnCancel(t *testing.T) {
+	es := NewEndpointSet(nil, nil, nil, nil, time.Minute, WithEndpointSeriesConcurrency(1, true))
+	c := es.seriesConcurrency.endpoint
+	client := es.seriesConcurrency.storeClient("slow:10901", component.Store, &blockingStoreClient{end: make(chan struct{})})
+
+	testCtx, testCancel := context.WithCancel(context.Background())
+	defer testCancel()
+
+	// Slots of calls whose stream is abandoned are released once their context is canceled.
+	ctx, cancel := context.WithCancel(testCtx)
+	_, err := client.Series(ctx, &storepb.SeriesRequest{})
+	testutil.Ok(t, err)
+	_, err = client.Series(testCtx, &storepb.SeriesRequest{})
+	testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+
+	cancel()
+	testutil.Ok(t, waitFor(func() bool { return promtest.ToFloat64(c.inflight.WithLabelValues("slow:10901")) == 0 }))
+	_, err = client.Series(testCtx, &storepb.SeriesRequest{})
+	testutil.Ok(t, err)
+}
+
+func TestStoreTypeSeriesConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limits, err := ParseStoreTypeConcurrency([]string{"store=1", "sidecar=3"})
+	testutil.Ok(t, err)
+	es := NewEndpointSet(nil, prometheus.NewRegistry(), nil, nil, time.Minute, WithStoreTypeSeriesConcurrency(limits))
+	c := es.seriesConcurrency.storeType
+	inflight := func(storeType string) float64 { return promtest.ToFloat64(c.inflight.WithLabelValues(storeType)) }
+
+	gateway := &blockingStoreClient{end: make(chan struct{})}
+	gateway1 := es.seriesConcurrency.storeClient("store-1:10901", component.Store, gateway)
+	gateway2 := es.seriesConcurrency.storeClient("store-2:10901", component.Store, &blockingStoreClient{end: make(chan struct{})})
+	sidecar := &blockingStoreClient{end: make(chan struct{})}
+	var sidecars []storepb.StoreClient
+	for i := 0; i < 3; i++ {
+		sidecars = append(sidecars, es.seriesConcurrency.storeClient(fmt.Sprintf("sidecar-%d:10901", i), component.Sidecar, sidecar))
+	}
+
+	gatewayStream, err := gateway1.Series(ctx, &storepb.SeriesRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1.0, inflight("store"))
+
+	// The limit of store gateways applies across all of them.
+	tctx, tcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = gateway2.Series(tctx, &storepb.SeriesRequest{})
+	tcancel()
+	testutil.Equals(t, context.DeadlineExceeded, err)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(c.limited.WithLabelValues("store")))
+
+	// Sidecars are limited independently of store gateways.
+	for _, s := range sidecars {
+		_, err := s.Series(ctx, &storepb.SeriesRequest{})
+		testutil.Ok(t, err)
+	}
+	testutil.Equals(t, 3.0, inflight("sidecar"))
+	testutil.Equals(t, 1.0, inflight("store"))
+	tctx, tcancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = sidecars[0].Series(tctx, &storepb.SeriesRequest{})
+	tcancel()
+	testutil.Equals(t, context.DeadlineExceeded, err)
+
+	// Store types without a limit are not limited.
+	for i := 0; i < 5; i++ {
+		_, err := es.seriesConcurrency.storeClient("receive:10901", component.Receive, &blockingStoreClient{end: make(chan struct{})}).Series(ctx, &storepb.SeriesRequest{})
+		testutil.Ok(t, err)
+	}
+
+	// A finished store gateway call frees a slot for the other store gateway.
+	close(gateway.end)
+	_, err = gatewayStream.Recv()
+	testutil.Equals(t, io.EOF, err)
+	_, err = gateway2.Series(ctx, &storepb.SeriesRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1.0, inflight("store"))
+	testutil.Equals(t, 3.0, inflight("sidecar"))
+}
+
+func waitFor(cond func() bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		if !cond() {
+			return errors.New("condition not met")
+		}
+		return nil
+	})
+}
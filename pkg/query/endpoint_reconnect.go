@@ -0,0 +1,80 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// errEndpointNotFound is returned when reconnecting to an endpoint which is not part of the endpoint set.
+var errEndpointNotFound = errors.New("endpoint not found")
+
+// Reconnect closes the connection to the endpoint with the given address, or to all endpoints if addr is empty, and
+// connects to them again right away, e.g. to recover connections stuck in a bad state after network issues. Calls
+// in flight to the endpoints fail. It returns the addresses of the endpoints reconnected to.
+func (e *EndpointSet) Reconnect(ctx context.Context, addr string) ([]string, error) {
+	e.updateMtx.Lock()
+	defer e.updateMtx.Unlock()
+
+	e.endpointsMtx.Lock()
+	var closed []*endpointRef
+	for a, er := range e.endpoints {
+		if addr != "" && a != addr {
+			continue
+		}
+		closed = append(closed, er)
+		// Endpoints missing from the set are connected to as new ones by the update.
+		delete(e.endpoints, a)
+	}
+	e.endpointsMtx.Unlock()
+
+	if addr != "" && len(closed) == 0 {
+		return nil, errors.Wrapf(errEndpointNotFound, "reconnect to %s", addr)
+	}
+
+	addrs := make([]string, 0, len(closed))
+	for _, er := range closed {
+		er.Close()
+		// The connection is not failing, so it's not backed off.
+		e.reconnects.succeeded(er.addr)
+		addrs = append(addrs, er.addr)
+	}
+	sort.Strings(addrs)
+
+	e.update(ctx)
+	return addrs, nil
+}
+
+// NewReconnectHandler returns the debug HTTP handler reconnecting to the endpoint given by the `endpoint` parameter,
+// or to all endpoints if it's not given. It responds with the addresses of the endpoints reconnected to.
+func NewReconnectHandler(logger log.Logger, endpoints *EndpointSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr := r.FormValue("endpoint")
+		addrs, err := endpoints.Reconnect(r.Context(), addr)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errEndpointNotFound) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		level.Info(logger).Log("msg", "reconnected to endpoints on request", "endpoints", len(addrs), "endpoint", addr)
+
+		b, err := json.Marshal(addrs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}
+}
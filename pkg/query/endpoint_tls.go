@@ -0,0 +1,81 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"regexp"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v2"
+
+	"github.com/thanos-io/thanos/pkg/httpconfig"
+	"github.com/thanos-io/thanos/pkg/tls"
+)
+
+// EndpointTLSConfig is the TLS configuration of gRPC connections to the endpoints with address fully matching any of
+// the regexes.
+type EndpointTLSConfig struct {
+	Endpoints []string             `yaml:"endpoints"`
+	TLSConfig httpconfig.TLSConfig `yaml:"tls_config"`
+}
+
+// EndpointTLS holds TLS overrides for endpoints, in order of precedence.
+type EndpointTLS []endpointTLS
+
+type endpointTLS struct {
+	addrs []*regexp.Regexp
+	creds credentials.TransportCredentials
+}
+
+// ParseEndpointTLS parses TLS overrides from a YAML list of EndpointTLSConfig.
+func ParseEndpointTLS(logger log.Logger, confYAML []byte) (EndpointTLS, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	var confs []EndpointTLSConfig
+	if err := yaml.UnmarshalStrict(confYAML, &confs); err != nil {
+		return nil, errors.Wrap(err, "parse endpoint TLS config")
+	}
+
+	ets := make(EndpointTLS, 0, len(confs))
+	for i, c := range confs {
+		if len(c.Endpoints) == 0 {
+			return nil, errors.Errorf("endpoint TLS config %d has no endpoints", i)
+		}
+
+		et := endpointTLS{}
+		for _, e := range c.Endpoints {
+			re, err := regexp.Compile("^(?:" + e + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(err, "compile endpoint address regex %q", e)
+			}
+			et.addrs = append(et.addrs, re)
+		}
+
+		tlsCfg, err := tls.NewClientConfig(logger, c.TLSConfig.CertFile, c.TLSConfig.KeyFile, c.TLSConfig.CAFile, c.TLSConfig.ServerName, c.TLSConfig.InsecureSkipVerify)
+		if err != nil {
+			return nil, errors.Wrapf(err, "build TLS config of endpoints %v", c.Endpoints)
+		}
+		et.creds = credentials.NewTLS(tlsCfg)
+		ets = append(ets, et)
+	}
+	return ets, nil
+}
+
+// DialOption returns the dial option setting the transport credentials of the first override matching the given
+// address and true, or false if no override matches, so the endpoint has to use the default transport credentials.
+func (ets EndpointTLS) DialOption(addr string) (grpc.DialOption, bool) {
+	for _, et := range ets {
+		for _, re := range et.addrs {
+			if re.MatchString(addr) {
+				return grpc.WithTransportCredentials(et.creds), true
+			}
+		}
+	}
+	return nil, false
+}
@@ -41,12 +41,14 @@ const (
 type GRPCEndpointSpec struct {
 	addr           string
 	isStrictStatic bool
+	dialOpts       []grpc.DialOption
 }
 
 // NewGRPCEndpointSpec creates gRPC endpoint spec.
-// It uses InfoAPI to get Metadata.
-func NewGRPCEndpointSpec(addr string, isStrictStatic bool) *GRPCEndpointSpec {
-	return &GRPCEndpointSpec{addr: addr, isStrictStatic: isStrictStatic}
+// It uses InfoAPI to get Metadata. Given dial options are applied on top of the ones of the EndpointSet
+// when connecting to this endpoint.
+func NewGRPCEndpointSpec(addr string, isStrictStatic bool, dialOpts ...grpc.DialOption) *GRPCEndpointSpec {
+	return &GRPCEndpointSpec{addr: addr, isStrictStatic: isStrictStatic, dialOpts: dialOpts}
 }
 
 // IsStrictStatic returns true if the endpoint has been statically defined and it is under a strict mode.
@@ -89,6 +91,10 @@ func (es *GRPCEndpointSpec) getMetadataUsingStoreAPI(ctx context.Context, client
 
 	infoResp := es.fillExpectedAPIs(component.FromProto(resp.StoreType), resp.MinTime, resp.MaxTime)
 	infoResp.LabelSets = resp.LabelSets
+	if infoResp.Store != nil {
+		infoResp.Store.SupportsLabelValuesStream = resp.SupportsLabelValuesStream
+		infoResp.Store.SupportsQueryPushdown = resp.SupportsQueryPushdown
+	}
 	infoResp.ComponentType = component.FromProto(resp.StoreType).String()
 
 	return &endpointMetadata{
@@ -177,6 +183,7 @@ type EndpointStatus struct {
 	ComponentType component.Component `json:"-"`
 	MinTime       int64               `json:"minTime"`
 	MaxTime       int64               `json:"maxTime"`
+	Compression   string              `json:"compression,omitempty"`
 }
 
 // endpointSetNodeCollector is a metric collector reporting the number of available storeAPIs for Querier.
@@ -260,6 +267,13 @@ type EndpointSet struct {
 	// Map of statuses used only by UI.
 	endpointStatuses         map[string]*EndpointStatus
 	unhealthyEndpointTimeout time.Duration
+
+	reconnects *reconnectBackoff
+
+	seriesConcurrency *seriesConcurrency
+
+	// endpointCompression returns the gRPC compression used for an endpoint, if known.
+	endpointCompression func(addr string) string
 }
 
 // NewEndpointSet returns a new set of Thanos APIs.
@@ -269,10 +283,31 @@ func NewEndpointSet(
 	endpointSpecs func() []*GRPCEndpointSpec,
 	dialOpts []grpc.DialOption,
 	unhealthyEndpointTimeout time.Duration,
+	opts ...EndpointSetOption,
 ) *EndpointSet {
 	endpointsMetric := newEndpointSetNodeCollector()
+	reconnectionAttempts := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_query_endpoint_reconnection_attempts_total",
+		Help: "The number of connection attempts to endpoints whose previous connection attempt failed.",
+	})
+	seriesInflight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_query_endpoint_inflight_series_calls",
+		Help: "The number of Series calls in flight to an endpoint, if their concurrency is limited.",
+	}, []string{"endpoint"})
+	seriesLimited := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_endpoint_series_calls_limited_total",
+		Help: "The number of Series calls to an endpoint which reached the concurrency limit, so they were queued or failed.",
+	}, []string{"endpoint"})
+	storeTypeSeriesInflight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_query_store_type_inflight_series_calls",
+		Help: "The number of Series calls in flight to all endpoints of a store type, if their concurrency is limited.",
+	}, []string{"store_type"})
+	storeTypeSeriesLimited := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_store_type_series_calls_limited_total",
+		Help: "The number of Series calls to endpoints of a store type which reached the concurrency limit of the store type, so they were queued.",
+	}, []string{"store_type"})
 	if reg != nil {
-		reg.MustRegister(endpointsMetric)
+		reg.MustRegister(endpointsMetric, reconnectionAttempts, seriesInflight, seriesLimited, storeTypeSeriesInflight, storeTypeSeriesLimited)
 	}
 
 	if logger == nil {
@@ -292,6 +327,14 @@ func NewEndpointSet(
 		endpointStatuses:         make(map[string]*EndpointStatus),
 		unhealthyEndpointTimeout: unhealthyEndpointTimeout,
 		endpointSpec:             endpointSpecs,
+		reconnects:               newReconnectBackoff(reconnectionAttempts),
+		seriesConcurrency: &seriesConcurrency{
+			endpoint:  newSeriesCallLimiter("endpoint", seriesInflight, seriesLimited),
+			storeType: newSeriesCallLimiter("store type", storeTypeSeriesInflight, storeTypeSeriesLimited),
+		},
+	}
+	for _, opt := range opts {
+		opt(es)
 	}
 	return es
 }
@@ -302,6 +345,10 @@ func (e *EndpointSet) Update(ctx context.Context) {
 	e.updateMtx.Lock()
 	defer e.updateMtx.Unlock()
 
+	e.update(ctx)
+}
+
+func (e *EndpointSet) update(ctx context.Context) {
 	e.endpointsMtx.RLock()
 	endpoints := make(map[string]*endpointRef, len(e.endpoints))
 	for addr, er := range e.endpoints {
@@ -325,6 +372,7 @@ func (e *EndpointSet) Update(ctx context.Context) {
 
 		er.Close()
 		delete(endpoints, addr)
+		e.seriesConcurrency.endpoint.remove(addr)
 		e.updateEndpointStatus(er, errors.New(unhealthyEndpointMessage))
 		level.Info(er.logger).Log("msg", unhealthyEndpointMessage, "address", addr, "extLset", labelpb.PromLabelSetsToString(er.LabelSets()))
 	}
@@ -370,7 +418,7 @@ func (e *EndpointSet) GetStoreClients() []store.Client {
 		if er.HasStoreAPI() {
 			// Make a new endpointRef with store client.
 			stores = append(stores, &endpointRef{
-				StoreClient: storepb.NewStoreClient(er.cc),
+				StoreClient: e.seriesConcurrency.storeClient(er.addr, er.ComponentType(), storepb.NewStoreClient(er.cc)),
 				addr:        er.addr,
 				metadata:    er.metadata,
 			})
@@ -489,9 +537,16 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 
 			er, seenAlready := endpoints[addr]
 			if !seenAlready {
+				if !e.reconnects.attempt(addr) {
+					level.Debug(e.logger).Log("msg", "backing off from reconnecting to node", "address", addr)
+					return
+				}
+
 				// New endpoint or was unactive and was removed in the past - create the new one.
-				conn, err := grpc.DialContext(ctx, addr, e.dialOpts...)
+				dialOpts := append(append([]grpc.DialOption{}, e.dialOpts...), spec.dialOpts...)
+				conn, err := grpc.DialContext(ctx, addr, dialOpts...)
 				if err != nil {
+					e.reconnects.failed(addr)
 					e.updateEndpointStatus(&endpointRef{addr: addr}, err)
 					level.Warn(e.logger).Log("msg", "update of node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr)
 					return
@@ -518,6 +573,7 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 				level.Warn(e.logger).Log("msg", "update of node failed", "err", errors.Wrap(err, "getting metadata"), "address", addr)
 
 				if !spec.IsStrictStatic() {
+					e.reconnects.failed(addr)
 					return
 				}
 
@@ -544,6 +600,7 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 
 			er.Update(metadata)
 			e.updateEndpointStatus(er, nil)
+			e.reconnects.succeeded(addr)
 
 			mtx.Lock()
 			defer mtx.Unlock()
@@ -552,6 +609,7 @@ func (e *EndpointSet) getActiveEndpoints(ctx context.Context, endpoints map[stri
 		}(es)
 	}
 	wg.Wait()
+	e.reconnects.retain(endpointAddrSet)
 
 	return activeEndpoints
 }
@@ -578,6 +636,9 @@ func (e *EndpointSet) updateEndpointStatus(er *endpointRef, err error) {
 		status.MinTime = mint
 		status.MaxTime = maxt
 		status.LastError = nil
+		if e.endpointCompression != nil {
+			status.Compression = e.endpointCompression(er.addr)
+		}
 	} else {
 		status.LastError = &stringError{originalErr: err}
 	}
@@ -689,6 +750,22 @@ func (er *endpointRef) HasExemplarsAPI() bool {
 	return er.metadata != nil && er.metadata.Exemplars != nil
 }
 
+// SupportsLabelValuesStream returns true if the endpoint advertises the streaming LabelValues method of the Store API.
+func (er *endpointRef) SupportsLabelValuesStream() bool {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	return er.metadata != nil && er.metadata.Store != nil && er.metadata.Store.SupportsLabelValuesStream
+}
+
+// SupportsQueryPushdown returns true if the endpoint advertises evaluating pushed down range functions in Series calls.
+func (er *endpointRef) SupportsQueryPushdown() bool {
+	er.mtx.RLock()
+	defer er.mtx.RUnlock()
+
+	return er.metadata != nil && er.metadata.Store != nil && er.metadata.Store.SupportsQueryPushdown
+}
+
 func (er *endpointRef) LabelSets() []labels.Labels {
 	er.mtx.RLock()
 	defer er.mtx.RUnlock()
@@ -5,15 +5,37 @@ package query
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
 
 	"github.com/pkg/errors"
 	"github.com/thanos-io/thanos/pkg/component"
@@ -112,6 +134,9 @@ func (s *mockedStoreSrv) LabelNames(context.Context, *storepb.LabelNamesRequest)
 func (s *mockedStoreSrv) LabelValues(context.Context, *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
 	return nil, nil
 }
+func (s *mockedStoreSrv) LabelValuesStream(*storepb.LabelValuesRequest, storepb.Store_LabelValuesStreamServer) error {
+	return nil
+}
 
 type APIs struct {
 	store          bool
@@ -1226,3 +1251,398 @@ func TestDeadlockLocking(t *testing.T) {
 
 	testutil.Ok(t, g.Wait())
 }
+
+func TestEndpointSet_Update_PerEndpointCompression(t *testing.T) {
+	var addrs []string
+	handlers := map[string]*compressionRecordingHandler{}
+	for i := 0; i < 3; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		testutil.Ok(t, err)
+
+		h := &compressionRecordingHandler{}
+		srv := grpc.NewServer(grpc.StatsHandler(h))
+		infopb.RegisterInfoServer(srv, &mockedEndpoint{info: *sidecarInfo})
+		go func() { _ = srv.Serve(listener) }()
+		defer srv.Stop()
+
+		addrs = append(addrs, listener.Addr().String())
+		handlers[listener.Addr().String()] = h
+	}
+
+	compressions, err := ParseEndpointCompressions(nil, nil, []string{
+		addrs[0] + "=zstd",
+		addrs[1] + "=gzip",
+		".*=none",
+	})
+	testutil.Ok(t, err)
+
+	endpointSet := NewEndpointSet(nil, nil,
+		func() (specs []*GRPCEndpointSpec) {
+			for _, addr := range addrs {
+				specs = append(specs, NewGRPCEndpointSpec(addr, false, compressions.DialOptions(addr)...))
+			}
+			return specs
+		},
+		testGRPCOpts, time.Minute, WithEndpointCompressions(compressions))
+	defer endpointSet.Close()
+
+	endpointSet.Update(context.Background())
+	statuses := map[string]string{}
+	for _, s := range endpointSet.GetEndpointStatus() {
+		statuses[s.Name] = s.Compression
+	}
+	testutil.Equals(t, map[string]string{addrs[0]: "zstd", addrs[1]: "gzip", addrs[2]: CompressionNone}, statuses)
+
+	testutil.Equals(t, []string{"zstd"}, handlers[addrs[0]].Compressions())
+	testutil.Equals(t, []string{"gzip"}, handlers[addrs[1]].Compressions())
+	testutil.Equals(t, []string{""}, handlers[addrs[2]].Compressions())
+
+	// The compression ratio of the compressed Info responses is observed.
+	testutil.Equals(t, 2, promtestutil.CollectAndCount(compressions.ratio))
+}
+
+func TestEndpointCompressions_FallbackToNone(t *testing.T) {
+	compressions, err := ParseEndpointCompressions(nil, nil, []string{".*=zstd"})
+	testutil.Ok(t, err)
+
+	var calls []string
+	unsupported := status.Error(codes.Unimplemented, `grpc: Decompressor is not installed for grpc-encoding "zstd"`)
+	invoker := func(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+		compression := "zstd"
+		for _, o := range opts {
+			if c, ok := o.(grpc.CompressorCallOption); ok {
+				compression = c.CompressorType
+			}
+		}
+		calls = append(calls, compression)
+		if compression == "zstd" {
+			return unsupported
+		}
+		return nil
+	}
+
+	// Other errors are returned as is.
+	err = compressions.unaryClientInterceptor("other:10901", "zstd")(context.Background(), "/thanos.Info/Info", nil, nil, nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return errors.New("other")
+		})
+	testutil.Equals(t, "other", err.Error())
+
+	interceptor := compressions.unaryClientInterceptor("store:10901", "zstd")
+	testutil.Ok(t, interceptor(context.Background(), "/thanos.Info/Info", nil, nil, nil, invoker))
+	testutil.Equals(t, []string{"zstd", "identity"}, calls)
+	testutil.Equals(t, CompressionNone, compressions.Compression("store:10901"))
+	testutil.Equals(t, "zstd", compressions.Compression("other:10901"))
+
+	// Following calls are sent without compression right away.
+	testutil.Ok(t, interceptor(context.Background(), "/thanos.Info/Info", nil, nil, nil, invoker))
+	testutil.Equals(t, []string{"zstd", "identity", "identity"}, calls)
+}
+
+// compressionRecordingHandler records compression of incoming RPCs.
+type compressionRecordingHandler struct {
+	mtx          sync.Mutex
+	compressions []string
+}
+
+func (h *compressionRecordingHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionRecordingHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InHeader); ok {
+		h.mtx.Lock()
+		h.compressions = append(h.compressions, in.Compression)
+		h.mtx.Unlock()
+	}
+}
+
+func (h *compressionRecordingHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionRecordingHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func (h *compressionRecordingHandler) Compressions() []string {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return append([]string(nil), h.compressions...)
+}
+
+func TestParseEndpointCompressions(t *testing.T) {
+	_, err := ParseEndpointCompressions(nil, nil, []string{"store-.*:10901=lz4"})
+	testutil.NotOk(t, err)
+
+	_, err = ParseEndpointCompressions(nil, nil, []string{"store-.*:10901"})
+	testutil.NotOk(t, err)
+
+	_, err = ParseEndpointCompressions(nil, nil, []string{"store-(:10901=zstd"})
+	testutil.NotOk(t, err)
+
+	compressions, err := ParseEndpointCompressions(nil, nil, []string{"store-.*:10901=zstd", "sidecar:10901=snappy", ".*=gzip"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 4, len(compressions.DialOptions("store-1:10901")))
+	testutil.Equals(t, "zstd", compressions.Compression("store-1:10901"))
+	testutil.Equals(t, "snappy", compressions.Compression("sidecar:10901"))
+	testutil.Equals(t, "gzip", compressions.Compression("receive:10901"))
+
+	none, err := ParseEndpointCompressions(nil, nil, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(none.DialOptions("sidecar:10901")))
+	testutil.Equals(t, CompressionNone, none.Compression("sidecar:10901"))
+}
+
+func TestEndpointSet_Update_PerEndpointTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	var (
+		addrs       []string
+		caFiles     []string
+		serverNames = []string{"store-a.example.com", "store-b.example.com"}
+	)
+	for _, serverName := range serverNames {
+		caFile, cert := generateTestTLSCerts(t, dir, serverName)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		testutil.Ok(t, err)
+
+		srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+		infopb.RegisterInfoServer(srv, &mockedEndpoint{info: *sidecarInfo})
+		go func() { _ = srv.Serve(listener) }()
+		defer srv.Stop()
+
+		addrs = append(addrs, listener.Addr().String())
+		caFiles = append(caFiles, caFile)
+	}
+	// conf returns the TLS config of the endpoint with the CA and server name of the given server.
+	conf := func(endpoint, server int) string {
+		return fmt.Sprintf("- endpoints: [%q]\n  tls_config:\n    ca_file: %s\n    server_name: %s\n", regexp.QuoteMeta(addrs[endpoint]), caFiles[server], serverNames[server])
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		conf     string
+		expected int
+	}{
+		{
+			name:     "matching CA and server name per endpoint",
+			conf:     conf(0, 0) + conf(1, 1),
+			expected: 2,
+		},
+		{
+			name:     "CA and server name of the other endpoint",
+			conf:     conf(0, 1) + conf(1, 0),
+			expected: 0,
+		},
+		{
+			name:     "only one endpoint configured",
+			conf:     conf(1, 1),
+			expected: 1,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			endpointTLS, err := ParseEndpointTLS(nil, []byte(tcase.conf))
+			testutil.Ok(t, err)
+
+			endpointSet := NewEndpointSet(nil, nil,
+				func() (specs []*GRPCEndpointSpec) {
+					for _, addr := range addrs {
+						tlsOpt, ok := endpointTLS.DialOption(addr)
+						if !ok {
+							tlsOpt = grpc.WithInsecure()
+						}
+						specs = append(specs, NewGRPCEndpointSpec(addr, false, tlsOpt))
+					}
+					return specs
+				},
+				[]grpc.DialOption{grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32))}, time.Minute)
+			defer endpointSet.Close()
+
+			// Connections failing the TLS handshake are only given up on the timeout.
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			endpointSet.Update(ctx)
+			testutil.Equals(t, tcase.expected, len(endpointSet.GetStoreClients()))
+		})
+	}
+}
+
+// generateTestTLSCerts writes a new CA into the directory and returns its path, with a certificate signed by it for the server name.
+func generateTestTLSCerts(t *testing.T, dir, serverName string) (string, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: serverName + " CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	testutil.Ok(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: serverName},
+		DNSNames:     []string{serverName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caTmpl, &key.PublicKey, caKey)
+	testutil.Ok(t, err)
+
+	caFile := filepath.Join(dir, serverName+"-ca.pem")
+	testutil.Ok(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	return caFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestParseEndpointTLS(t *testing.T) {
+	_, err := ParseEndpointTLS(nil, []byte("- tls_config:\n    server_name: store\n"))
+	testutil.NotOk(t, err)
+
+	_, err = ParseEndpointTLS(nil, []byte("- endpoints: [\"store-(:10901\"]\n"))
+	testutil.NotOk(t, err)
+
+	_, err = ParseEndpointTLS(nil, []byte("- endpoints: [\"store:10901\"]\n  tls_config:\n    ca_file: /nonexistent/ca.pem\n"))
+	testutil.NotOk(t, err)
+
+	endpointTLS, err := ParseEndpointTLS(nil, []byte("- endpoints: [\"store-.*:10901\"]\n  tls_config:\n    insecure_skip_verify: true\n"))
+	testutil.Ok(t, err)
+	_, ok := endpointTLS.DialOption("store-1:10901")
+	testutil.Assert(t, ok)
+	_, ok = endpointTLS.DialOption("sidecar:10901")
+	testutil.Assert(t, !ok)
+
+	endpointTLS, err = ParseEndpointTLS(nil, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(endpointTLS))
+}
+
+func TestEndpointSet_Update_ReconnectBackoff(t *testing.T) {
+	// Nothing listens on the address of a closed listener, so connections to it fail.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	addr := listener.Addr().String()
+	testutil.Ok(t, listener.Close())
+
+	endpointSet := NewEndpointSet(nil, nil,
+		func() []*GRPCEndpointSpec {
+			return []*GRPCEndpointSpec{NewGRPCEndpointSpec(addr, false)}
+		},
+		testGRPCOpts, time.Minute,
+		WithReconnectBackoff(backoff.Config{BaseDelay: time.Second, Multiplier: 2, MaxDelay: 4 * time.Second}),
+	)
+	defer endpointSet.Close()
+	endpointSet.gRPCInfoCallTimeout = 100 * time.Millisecond
+
+	now := time.Now()
+	endpointSet.reconnects.now = func() time.Time { return now }
+
+	// The first connection attempt isn't a reconnection.
+	endpointSet.Update(context.Background())
+	testutil.Equals(t, 0, len(endpointSet.GetStoreClients()))
+	testutil.Equals(t, 0.0, promtestutil.ToFloat64(endpointSet.reconnects.attempts))
+
+	// Reconnections are backed off by 1s, 2s, 4s and then 4s again after consecutive failures.
+	var attempts float64
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		now = now.Add(delay - time.Millisecond)
+		endpointSet.Update(context.Background())
+		testutil.Equals(t, attempts, promtestutil.ToFloat64(endpointSet.reconnects.attempts))
+
+		now = now.Add(time.Millisecond)
+		endpointSet.Update(context.Background())
+		attempts++
+		testutil.Equals(t, attempts, promtestutil.ToFloat64(endpointSet.reconnects.attempts))
+	}
+
+	// Once the endpoint is not discovered anymore, its backoff is forgotten.
+	endpointSet.endpointSpec = func() []*GRPCEndpointSpec { return nil }
+	endpointSet.Update(context.Background())
+	testutil.Equals(t, 0, len(endpointSet.reconnects.failures))
+}
+
+func TestEndpointSet_Reconnect(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		testutil.Ok(t, err)
+
+		srv := grpc.NewServer()
+		infopb.RegisterInfoServer(srv, &mockedEndpoint{info: *sidecarInfo})
+		go func() { _ = srv.Serve(listener) }()
+		defer srv.Stop()
+
+		addrs = append(addrs, listener.Addr().String())
+	}
+
+	var (
+		mtx   sync.Mutex
+		dials = map[string]int{}
+	)
+	dialOpts := append([]grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		mtx.Lock()
+		dials[addr]++
+		mtx.Unlock()
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	})}, testGRPCOpts...)
+	dialed := func() map[string]int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		res := map[string]int{}
+		for addr, n := range dials {
+			res[addr] = n
+		}
+		return res
+	}
+
+	endpointSet := NewEndpointSet(nil, nil,
+		func() (specs []*GRPCEndpointSpec) {
+			for _, addr := range addrs {
+				specs = append(specs, NewGRPCEndpointSpec(addr, false))
+			}
+			return specs
+		},
+		dialOpts, time.Minute)
+	defer endpointSet.Close()
+
+	endpointSet.Update(context.Background())
+	testutil.Equals(t, 2, len(endpointSet.GetStoreClients()))
+	testutil.Equals(t, map[string]int{addrs[0]: 1, addrs[1]: 1}, dialed())
+
+	reconnect := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		NewReconnectHandler(log.NewNopLogger(), endpointSet).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/stores/reconnect"+query, nil))
+		return rec
+	}
+
+	// Only the given endpoint is re-dialed, on a new connection.
+	endpointSet.endpointsMtx.RLock()
+	oldConn := endpointSet.endpoints[addrs[0]].cc
+	endpointSet.endpointsMtx.RUnlock()
+
+	rec := reconnect("?endpoint=" + addrs[0])
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	var reconnected []string
+	testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &reconnected))
+	testutil.Equals(t, []string{addrs[0]}, reconnected)
+	testutil.Equals(t, map[string]int{addrs[0]: 2, addrs[1]: 1}, dialed())
+	testutil.Equals(t, connectivity.Shutdown, oldConn.GetState())
+	testutil.Equals(t, 2, len(endpointSet.GetStoreClients()))
+
+	// All endpoints are re-dialed without an endpoint.
+	rec = reconnect("")
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Equals(t, map[string]int{addrs[0]: 3, addrs[1]: 2}, dialed())
+	testutil.Equals(t, 2, len(endpointSet.GetStoreClients()))
+
+	rec = reconnect("?endpoint=unknown:10901")
+	testutil.Equals(t, http.StatusNotFound, rec.Code)
+	testutil.Equals(t, map[string]int{addrs[0]: 3, addrs[1]: 2}, dialed())
+}
@@ -56,6 +56,10 @@ func (s *testStore) LabelValues(ctx context.Context, r *storepb.LabelValuesReque
 	return nil, status.Error(codes.Unimplemented, "not implemented")
 }
 
+func (s *testStore) LabelValuesStream(r *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	return status.Error(codes.Unimplemented, "not implemented")
+}
+
 type testStoreMeta struct {
 	extlsetFn func(addr string) []labelpb.ZLabelSet
 	storeType component.StoreAPI
@@ -0,0 +1,52 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// ErrLabelValueCardinality is returned for selects whose matchers match too many values of a label.
+var ErrLabelValueCardinality = errors.New("label value cardinality limit exceeded")
+
+// checkLabelValueCardinality estimates the number of values matched by every label of a non-equality matcher, using
+// the label values stores return for the matchers of the select, and returns ErrLabelValueCardinality if any exceeds
+// the limit. Stores ignoring the matchers of label values requests return all values of the label, overestimating it.
+func (q *querier) checkLabelValueCardinality(ctx context.Context, hints *storage.SelectHints, ms []*labels.Matcher, sms []storepb.LabelMatcher) error {
+	if q.opts.MaxLabelValueCardinality <= 0 {
+		return nil
+	}
+
+	checked := map[string]struct{}{}
+	for _, m := range ms {
+		if m.Type == labels.MatchEqual {
+			continue
+		}
+		if _, ok := checked[m.Name]; ok {
+			continue
+		}
+		checked[m.Name] = struct{}{}
+
+		resp, err := q.proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
+			Label:                   m.Name,
+			PartialResponseDisabled: !q.partialResponse,
+			Start:                   hints.Start,
+			End:                     hints.End,
+			Matchers:                sms,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "proxy LabelValues() of label %s", m.Name)
+		}
+		if len(resp.Values) > q.opts.MaxLabelValueCardinality {
+			return errors.Wrapf(ErrLabelValueCardinality, "matcher %s matches %d values, limit is %d", m, len(resp.Values), q.opts.MaxLabelValueCardinality)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/util/gate"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// labelValuesStoreServer estimates the cardinality of every label with its configured number of values.
+type labelValuesStoreServer struct {
+	requestRecordingStoreServer
+
+	values map[string]int
+}
+
+func (s *labelValuesStoreServer) LabelValues(_ context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	resp := &storepb.LabelValuesResponse{}
+	for i := 0; i < s.values[req.Label]; i++ {
+		resp.Values = append(resp.Values, fmt.Sprintf("%s-%d", req.Label, i))
+	}
+	return resp, nil
+}
+
+func TestQuerier_LabelValueCardinality(t *testing.T) {
+	s := &labelValuesStoreServer{values: map[string]int{"pod": 1000, "job": 3}}
+
+	sel := func(limit int, ms ...*labels.Matcher) error {
+		q := newQuerier(context.Background(), nil, 0, 1000, nil, nil, s, false, 0, true, false, false, gate.New(2), 5*time.Second, QueryableOptions{MaxLabelValueCardinality: limit})
+		t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+		set := q.Select(false, nil, ms...)
+		for set.Next() {
+		}
+		return set.Err()
+	}
+	name := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up")
+
+	err := sel(100, name, labels.MustNewMatcher(labels.MatchRegexp, "pod", ".+"))
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(errors.Cause(err), ErrLabelValueCardinality), "unexpected error %v", err)
+	// Rejected selects don't fan out to the stores.
+	testutil.Equals(t, 0, len(s.reqs))
+
+	// Equality matchers are not limited, nor labels with few values.
+	testutil.Ok(t, sel(100, name, labels.MustNewMatcher(labels.MatchEqual, "pod", "pod-1")))
+	testutil.Ok(t, sel(100, name, labels.MustNewMatcher(labels.MatchNotEqual, "job", "")))
+	testutil.Equals(t, 2, len(s.reqs))
+
+	// 0 disables the limit.
+	testutil.Ok(t, sel(0, name, labels.MustNewMatcher(labels.MatchRegexp, "pod", ".+")))
+	testutil.Equals(t, 3, len(s.reqs))
+}
@@ -0,0 +1,22 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// ErrTooManyMatchers is returned for selectors with more matchers than the limit.
+var ErrTooManyMatchers = errors.New("matchers per selector limit exceeded")
+
+// checkMatchersLimit returns ErrTooManyMatchers if the selector has more matchers than the limit. Long matcher lists,
+// e.g. generated by buggy tooling, make the intersection of postings in stores pathological, so they are rejected
+// before fanning out.
+func (q *querier) checkMatchersLimit(ms []*labels.Matcher) error {
+	if q.opts.MaxMatchersPerSelector <= 0 || len(ms) <= q.opts.MaxMatchersPerSelector {
+		return nil
+	}
+	return errors.Wrapf(ErrTooManyMatchers, "selector has %d matchers, limit is %d", len(ms), q.opts.MaxMatchersPerSelector)
+}
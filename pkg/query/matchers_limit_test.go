@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/util/gate"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQuerier_MaxMatchersPerSelector(t *testing.T) {
+	s := &requestRecordingStoreServer{}
+
+	newQ := func(limit int) *querier {
+		q := newQuerier(context.Background(), nil, 0, 1000, nil, nil, s, false, 0, true, false, false, gate.New(2), 5*time.Second, QueryableOptions{MaxMatchersPerSelector: limit})
+		t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+		return q
+	}
+	sel := func(q *querier, ms ...*labels.Matcher) error {
+		set := q.Select(false, nil, ms...)
+		for set.Next() {
+		}
+		return set.Err()
+	}
+
+	ms := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up")}
+	for i := 0; i < 3; i++ {
+		ms = append(ms, labels.MustNewMatcher(labels.MatchNotEqual, "pod", fmt.Sprintf("pod-%d", i)))
+	}
+
+	q := newQ(3)
+	err := sel(q, ms...)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(errors.Cause(err), ErrTooManyMatchers), "unexpected error %v", err)
+	_, _, err = q.LabelValues("pod", ms...)
+	testutil.Assert(t, errors.Is(errors.Cause(err), ErrTooManyMatchers), "unexpected error %v", err)
+	_, _, err = q.LabelNames(ms...)
+	testutil.Assert(t, errors.Is(errors.Cause(err), ErrTooManyMatchers), "unexpected error %v", err)
+	// Rejected selects don't fan out to the stores.
+	testutil.Equals(t, 0, len(s.reqs))
+
+	// Selectors within the limit are not rejected.
+	testutil.Ok(t, sel(q, ms[:3]...))
+	testutil.Equals(t, 1, len(s.reqs))
+
+	// 0 disables the limit.
+	testutil.Ok(t, sel(newQ(0), ms...))
+	testutil.Equals(t, 2, len(s.reqs))
+}
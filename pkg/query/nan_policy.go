@@ -0,0 +1,144 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// NaNPolicy controls how NaN float samples of query results are serialized.
+type NaNPolicy string
+
+const (
+	// NaNPolicyPreserve serializes NaN samples as "NaN", like Prometheus.
+	NaNPolicyPreserve NaNPolicy = "preserve"
+	// NaNPolicyDrop removes NaN samples from the result.
+	NaNPolicyDrop NaNPolicy = "drop"
+	// NaNPolicyNull serializes the value of NaN samples as null.
+	NaNPolicyNull NaNPolicy = "null"
+)
+
+// ParseNaNPolicy parses a NaN policy, an empty string being NaNPolicyPreserve.
+func ParseNaNPolicy(s string) (NaNPolicy, error) {
+	switch p := NaNPolicy(s); p {
+	case "":
+		return NaNPolicyPreserve, nil
+	case NaNPolicyPreserve, NaNPolicyDrop, NaNPolicyNull:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown NaN policy %q, must be one of %q, %q or %q", s, NaNPolicyPreserve, NaNPolicyDrop, NaNPolicyNull)
+}
+
+// ApplyNaNPolicy returns the query result to encode with the given NaN policy. With NaNPolicyDrop, NaN samples are
+// removed, as well as series left without samples. A scalar can't be removed, so it's returned as is. With
+// NaNPolicyNull, the result is wrapped to be encoded with null values for NaN samples.
+func ApplyNaNPolicy(v parser.Value, policy NaNPolicy) parser.Value {
+	switch policy {
+	case NaNPolicyDrop:
+		return dropNaN(v)
+	case NaNPolicyNull:
+		switch v := v.(type) {
+		case promql.Matrix:
+			return nullNaNMatrix(v)
+		case promql.Vector:
+			return nullNaNVector(v)
+		case promql.Scalar:
+			return nullNaNScalar(v)
+		}
+	}
+	return v
+}
+
+// dropNaN removes NaN samples. The result is not changed in place, as the engine still references it to release
+// its points on close.
+func dropNaN(v parser.Value) parser.Value {
+	switch v := v.(type) {
+	case promql.Matrix:
+		res := make(promql.Matrix, 0, len(v))
+		for _, s := range v {
+			points := make([]promql.Point, 0, len(s.Points))
+			for _, p := range s.Points {
+				if !math.IsNaN(p.V) {
+					points = append(points, p)
+				}
+			}
+			if len(points) > 0 {
+				res = append(res, promql.Series{Metric: s.Metric, Points: points})
+			}
+		}
+		return res
+	case promql.Vector:
+		res := make(promql.Vector, 0, len(v))
+		for _, s := range v {
+			if !math.IsNaN(s.V) {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return v
+}
+
+// nullNaNPoint is a point encoded with a null value if it's NaN.
+type nullNaNPoint promql.Point
+
+func (p nullNaNPoint) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(p.V) {
+		return json.Marshal([...]interface{}{float64(p.T) / 1000, nil})
+	}
+	return promql.Point(p).MarshalJSON()
+}
+
+type nullNaNMatrix promql.Matrix
+
+func (m nullNaNMatrix) Type() parser.ValueType { return parser.ValueTypeMatrix }
+func (m nullNaNMatrix) String() string         { return promql.Matrix(m).String() }
+
+func (m nullNaNMatrix) MarshalJSON() ([]byte, error) {
+	type series struct {
+		Metric labels.Labels  `json:"metric"`
+		Points []nullNaNPoint `json:"values"`
+	}
+	res := make([]series, 0, len(m))
+	for _, s := range m {
+		points := make([]nullNaNPoint, 0, len(s.Points))
+		for _, p := range s.Points {
+			points = append(points, nullNaNPoint(p))
+		}
+		res = append(res, series{Metric: s.Metric, Points: points})
+	}
+	return json.Marshal(res)
+}
+
+type nullNaNVector promql.Vector
+
+func (vec nullNaNVector) Type() parser.ValueType { return parser.ValueTypeVector }
+func (vec nullNaNVector) String() string         { return promql.Vector(vec).String() }
+
+func (vec nullNaNVector) MarshalJSON() ([]byte, error) {
+	type sample struct {
+		Metric labels.Labels `json:"metric"`
+		Point  nullNaNPoint  `json:"value"`
+	}
+	res := make([]sample, 0, len(vec))
+	for _, s := range vec {
+		res = append(res, sample{Metric: s.Metric, Point: nullNaNPoint(s.Point)})
+	}
+	return json.Marshal(res)
+}
+
+type nullNaNScalar promql.Scalar
+
+func (s nullNaNScalar) Type() parser.ValueType { return parser.ValueTypeScalar }
+func (s nullNaNScalar) String() string         { return promql.Scalar(s).String() }
+
+func (s nullNaNScalar) MarshalJSON() ([]byte, error) {
+	return nullNaNPoint{T: s.T, V: s.V}.MarshalJSON()
+}
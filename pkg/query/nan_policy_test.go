@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestApplyNaNPolicy(t *testing.T) {
+	matrix := promql.Matrix{
+		{Metric: labels.FromStrings("job", "a"), Points: []promql.Point{{T: 1000, V: 1}, {T: 2000, V: math.NaN()}}},
+		{Metric: labels.FromStrings("job", "b"), Points: []promql.Point{{T: 1000, V: math.NaN()}}},
+	}
+	vector := promql.Vector{
+		{Metric: labels.FromStrings("job", "a"), Point: promql.Point{T: 1000, V: 1}},
+		{Metric: labels.FromStrings("job", "b"), Point: promql.Point{T: 1000, V: math.NaN()}},
+	}
+	scalar := promql.Scalar{T: 1000, V: math.NaN()}
+
+	for _, tcase := range []struct {
+		policy NaNPolicy
+		// Expected JSON encodings of the matrix, vector and scalar results.
+		matrix, vector, scalar string
+	}{
+		{
+			policy: NaNPolicyPreserve,
+			matrix: `[{"metric":{"job":"a"},"values":[[1,"1"],[2,"NaN"]]},{"metric":{"job":"b"},"values":[[1,"NaN"]]}]`,
+			vector: `[{"metric":{"job":"a"},"value":[1,"1"]},{"metric":{"job":"b"},"value":[1,"NaN"]}]`,
+			scalar: `[1,"NaN"]`,
+		},
+		{
+			policy: NaNPolicyDrop,
+			matrix: `[{"metric":{"job":"a"},"values":[[1,"1"]]}]`,
+			vector: `[{"metric":{"job":"a"},"value":[1,"1"]}]`,
+			scalar: `[1,"NaN"]`,
+		},
+		{
+			policy: NaNPolicyNull,
+			matrix: `[{"metric":{"job":"a"},"values":[[1,"1"],[2,null]]},{"metric":{"job":"b"},"values":[[1,null]]}]`,
+			vector: `[{"metric":{"job":"a"},"value":[1,"1"]},{"metric":{"job":"b"},"value":[1,null]}]`,
+			scalar: `[1,null]`,
+		},
+	} {
+		t.Run(string(tcase.policy), func(t *testing.T) {
+			for _, c := range []struct {
+				v        parser.Value
+				expected string
+			}{{matrix, tcase.matrix}, {vector, tcase.vector}, {scalar, tcase.scalar}} {
+				res := ApplyNaNPolicy(c.v, tcase.policy)
+				testutil.Equals(t, c.v.Type(), res.Type())
+
+				b, err := json.Marshal(res)
+				testutil.Ok(t, err)
+				testutil.Equals(t, c.expected, string(b))
+			}
+			// The original result is not changed.
+			testutil.Equals(t, 2, len(matrix[0].Points))
+			testutil.Equals(t, 2, len(vector))
+		})
+	}
+}
+
+func TestParseNaNPolicy(t *testing.T) {
+	p, err := ParseNaNPolicy("")
+	testutil.Ok(t, err)
+	testutil.Equals(t, NaNPolicyPreserve, p)
+
+	p, err = ParseNaNPolicy("null")
+	testutil.Ok(t, err)
+	testutil.Equals(t, NaNPolicyNull, p)
+
+	_, err = ParseNaNPolicy("zero")
+	testutil.NotOk(t, err)
+}
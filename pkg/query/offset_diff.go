@@ -0,0 +1,69 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// OffsetDiff is the difference between the results of an instant query evaluated at two different times.
+type OffsetDiff struct {
+	// Diff has the value of the current result minus the value of the base result, for each series present in both
+	// results, with the labels and timestamp of the current result.
+	Diff promql.Vector
+	// OnlyCurrent has the series present in the current result only, as is.
+	OnlyCurrent promql.Vector
+	// OnlyBase has the series present in the base result only, as is.
+	OnlyBase promql.Vector
+}
+
+// DiffResults matches the series of two instant query results by their labels and returns their difference. Series
+// present in only one of the results can't be subtracted, so they are returned separately instead of being dropped
+// like by a PromQL binary operation. Scalar results are treated as a single series without labels.
+func DiffResults(current, base parser.Value) (*OffsetDiff, error) {
+	cur, err := resultVector(current)
+	if err != nil {
+		return nil, errors.Wrap(err, "current result")
+	}
+	b, err := resultVector(base)
+	if err != nil {
+		return nil, errors.Wrap(err, "base result")
+	}
+
+	baseByLabels := make(map[string]promql.Sample, len(b))
+	for _, s := range b {
+		baseByLabels[s.Metric.String()] = s
+	}
+
+	diff := &OffsetDiff{Diff: promql.Vector{}, OnlyCurrent: promql.Vector{}, OnlyBase: promql.Vector{}}
+	for _, s := range cur {
+		key := s.Metric.String()
+		bs, ok := baseByLabels[key]
+		if !ok {
+			diff.OnlyCurrent = append(diff.OnlyCurrent, s)
+			continue
+		}
+		delete(baseByLabels, key)
+		diff.Diff = append(diff.Diff, promql.Sample{Metric: s.Metric, Point: promql.Point{T: s.T, V: s.V - bs.V}})
+	}
+	// Keep the order of the base result.
+	for _, s := range b {
+		if _, ok := baseByLabels[s.Metric.String()]; ok {
+			diff.OnlyBase = append(diff.OnlyBase, s)
+		}
+	}
+	return diff, nil
+}
+
+func resultVector(v parser.Value) (promql.Vector, error) {
+	switch v := v.(type) {
+	case promql.Vector:
+		return v, nil
+	case promql.Scalar:
+		return promql.Vector{{Point: promql.Point{T: v.T, V: v.V}}}, nil
+	}
+	return nil, errors.Errorf("unsupported result type %s, only vector and scalar results can be diffed", v.Type())
+}
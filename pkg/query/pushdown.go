@@ -0,0 +1,158 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/dedup"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// pushdownMatcherName is the name of the matcher the range functions pushed down to stores are passed to the
+// querier with. Its value is the name of the function and its range in milliseconds, separated by a colon.
+const pushdownMatcherName = "__thanos_pushdown__"
+
+// PushDownRangeFunctions rewrites the range functions of the query which stores can evaluate, so that the querier
+// receives them with the selector of their range vector and the PromQL engine only picks the results at each step.
+// A function qualifies if its range vector is a selector without @ modifier outside of any subquery, and if the
+// query is an instant query or its step is longer than 1ms. The query is returned unchanged if it can't be parsed.
+func PushDownRangeFunctions(qs string, step time.Duration) string {
+	if step != 0 && step < 2*time.Millisecond {
+		return qs
+	}
+	expr, err := parser.ParseExpr(qs)
+	if err != nil {
+		return qs
+	}
+
+	var rewritten bool
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		call, ok := node.(*parser.Call)
+		if !ok || !store.IsPushdownFunc(call.Func.Name) {
+			return nil
+		}
+		// Subqueries are evaluated at steps of their own, which the engine doesn't pass to the querier.
+		for _, n := range path {
+			if _, ok := n.(*parser.SubqueryExpr); ok {
+				return nil
+			}
+		}
+		ms, ok := call.Args[0].(*parser.MatrixSelector)
+		if !ok {
+			return nil
+		}
+		vs, ok := ms.VectorSelector.(*parser.VectorSelector)
+		if !ok || vs.Timestamp != nil || vs.StartOrEnd != 0 {
+			return nil
+		}
+
+		m, err := labels.NewMatcher(labels.MatchEqual, pushdownMatcherName, fmt.Sprintf("%s:%d", call.Func.Name, ms.Range.Milliseconds()))
+		if err != nil {
+			return err
+		}
+		vs.LabelMatchers = append(vs.LabelMatchers, m)
+		call.Func = parser.Functions["max_over_time"]
+		ms.Range = time.Millisecond
+		rewritten = true
+		return nil
+	})
+	if !rewritten {
+		return qs
+	}
+	return expr.String()
+}
+
+// pushdownFromMatchers removes the pushdown matcher from the matchers of a selection, and returns the range function
+// it describes, to be evaluated over the steps of the selection. The pushdown is nil if there is no such matcher.
+func pushdownFromMatchers(hints *storage.SelectHints, ms []*labels.Matcher) ([]*labels.Matcher, *storepb.Pushdown, error) {
+	for i, m := range ms {
+		if m.Name != pushdownMatcherName {
+			continue
+		}
+		ms = append(append(make([]*labels.Matcher, 0, len(ms)-1), ms[:i]...), ms[i+1:]...)
+		if hints == nil {
+			return ms, nil, nil
+		}
+
+		parts := strings.SplitN(m.Value, ":", 2)
+		if len(parts) != 2 || !store.IsPushdownFunc(parts[0]) {
+			return nil, nil, errors.Errorf("invalid pushdown %q", m.Value)
+		}
+		rangeMillis, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid pushdown %q", m.Value)
+		}
+		// The engine selects the range of the rewritten function before the first step.
+		start := hints.Start + hints.Range
+		return ms, &storepb.Pushdown{Func: parts[0], RangeMillis: rangeMillis, Start: start, End: hints.End, StepMillis: hints.Step}, nil
+	}
+	return ms, nil, nil
+}
+
+// pushdownSeriesSet returns the results of the pushed down range function. Series evaluated by stores carry the
+// pushdown marker, the function is evaluated over the samples of the others.
+type pushdownSeriesSet struct {
+	storage.SeriesSet
+	pushdown *storepb.Pushdown
+
+	cur storage.Series
+	err error
+}
+
+func (s *pushdownSeriesSet) Next() bool {
+	for s.SeriesSet.Next() {
+		series := s.SeriesSet.At()
+		lset := series.Labels()
+		if lset.Has(dedup.PushdownMarker.Name) {
+			s.cur = &storage.SeriesEntry{
+				Lset:             labels.NewBuilder(lset).Del(dedup.PushdownMarker.Name).Labels(),
+				SampleIteratorFn: series.Iterator,
+			}
+			return true
+		}
+
+		chks, err := store.EvalPushdown(s.pushdown, series.Iterator())
+		if err != nil {
+			s.err = errors.Wrapf(err, "evaluate %s of series %s", s.pushdown.Func, lset)
+			return false
+		}
+		if len(chks) == 0 {
+			continue
+		}
+		s.cur = &storage.SeriesEntry{
+			Lset: lset,
+			SampleIteratorFn: func() chunkenc.Iterator {
+				its := make([]chunkenc.Iterator, 0, len(chks))
+				for _, c := range chks {
+					its = append(its, getFirstIterator(c.Raw))
+				}
+				return newChunkSeriesIterator(its)
+			},
+		}
+		return true
+	}
+	return false
+}
+
+func (s *pushdownSeriesSet) At() storage.Series {
+	return s.cur
+}
+
+func (s *pushdownSeriesSet) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.SeriesSet.Err()
+}
@@ -0,0 +1,186 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/dedup"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestPushDownRangeFunctions(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		step     time.Duration
+		expected string
+	}{
+		{
+			query:    `sum_over_time(a[5m])`,
+			expected: `max_over_time(a{__thanos_pushdown__="sum_over_time:300000"}[1ms])`,
+		},
+		{
+			query:    `sum by (b) (count_over_time(a{b="c"}[1m] offset 5m)) / avg_over_time(a[30s])`,
+			step:     time.Minute,
+			expected: `sum by(b) (max_over_time(a{__thanos_pushdown__="count_over_time:60000",b="c"}[1ms] offset 5m)) / max_over_time(a{__thanos_pushdown__="avg_over_time:30000"}[1ms])`,
+		},
+		{
+			query:    `min_over_time(a[5m])`,
+			step:     time.Millisecond,
+			expected: `min_over_time(a[5m])`,
+		},
+		{
+			query:    `rate(a[5m])`,
+			expected: `rate(a[5m])`,
+		},
+		{
+			query:    `max_over_time(a[5m] @ 100)`,
+			expected: `max_over_time(a[5m] @ 100)`,
+		},
+		{
+			query:    `max_over_time(sum_over_time(a[5m])[1h:1m])`,
+			expected: `max_over_time(sum_over_time(a[5m])[1h:1m])`,
+		},
+		{
+			query:    `sum_over_time(rate(a[5m])[1h:])`,
+			expected: `sum_over_time(rate(a[5m])[1h:])`,
+		},
+		{
+			query:    `sum_over_time(a[5m]`,
+			expected: `sum_over_time(a[5m]`,
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			testutil.Equals(t, tc.expected, PushDownRangeFunctions(tc.query, tc.step))
+		})
+	}
+}
+
+// pushdownStoreServer evaluates pushed down functions over the series of the underlying store.
+type pushdownStoreServer struct {
+	*testStoreServer
+
+	pushedDown atomic.Int64
+}
+
+func (s *pushdownStoreServer) Series(req *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	if req.Pushdown == nil {
+		return s.testStoreServer.Series(req, srv)
+	}
+	s.pushedDown.Inc()
+	for _, resp := range s.resps {
+		series := resp.GetSeries()
+		its := make([]chunkenc.Iterator, 0, len(series.Chunks))
+		for _, c := range series.Chunks {
+			its = append(its, getFirstIterator(c.Raw))
+		}
+		chks, err := store.EvalPushdown(req.Pushdown, newChunkSeriesIterator(its))
+		if err != nil {
+			return err
+		}
+		if len(chks) == 0 {
+			continue
+		}
+		lset := labels.NewBuilder(series.PromLabels()).Set(dedup.PushdownMarker.Name, dedup.PushdownMarker.Value).Labels()
+		if err := srv.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: labelpb.ZLabelsFromPromLabels(lset), Chunks: chks})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pushdownStoreClient struct {
+	*typedStoreClient
+}
+
+func (c *pushdownStoreClient) SupportsQueryPushdown() bool { return true }
+
+func TestQuerier_Pushdown(t *testing.T) {
+	// Counters with resets, irregular scrapes and staleness markers, split into several chunks.
+	newSeries := func(lset labels.Labels, offset int64) *storepb.SeriesResponse {
+		var chks [][]sample
+		for i := int64(0); i < 400; i++ {
+			if i%50 == 0 {
+				chks = append(chks, nil)
+			}
+			v := float64((i + offset) % 120)
+			if (i+offset)%61 == 0 {
+				v = math.Float64frombits(value.StaleNaN)
+			}
+			chks[len(chks)-1] = append(chks[len(chks)-1], sample{t: i*10000 + (i+offset)%4*1000, v: v})
+		}
+		return storeSeriesResponse(t, lset, chks...)
+	}
+	// The querier modifies the labels of the series it receives, so every store responds with series of its own.
+	resps := func() []*storepb.SeriesResponse {
+		return []*storepb.SeriesResponse{
+			newSeries(labels.FromStrings("__name__", "a", "b", "1", "replica", "1"), 0),
+			newSeries(labels.FromStrings("__name__", "a", "b", "1", "replica", "2"), 7),
+			newSeries(labels.FromStrings("__name__", "a", "b", "2", "replica", "1"), 13),
+		}
+	}
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: time.Minute})
+	exec := func(proxy storepb.StoreServer, deduplicate, pushdown bool, query string, step time.Duration) parser.Value {
+		queryable := NewQueryableCreator(nil, nil, proxy, 2, time.Minute, QueryableOptions{})(deduplicate, []string{"replica"}, nil, 0, false, pushdown, false)
+		if pushdown {
+			rewritten := PushDownRangeFunctions(query, step)
+			testutil.Assert(t, rewritten != query, "query %s not rewritten", query)
+			query = rewritten
+		}
+
+		var (
+			qry promql.Query
+			err error
+		)
+		if step == 0 {
+			qry, err = engine.NewInstantQuery(queryable, query, time.Unix(2000, 0))
+		} else {
+			qry, err = engine.NewRangeQuery(queryable, query, time.Unix(600, 0), time.Unix(3000, 0), step)
+		}
+		testutil.Ok(t, err)
+		res := qry.Exec(context.Background())
+		testutil.Ok(t, res.Err)
+		return res.Value
+	}
+
+	for _, f := range []string{"count_over_time", "sum_over_time", "avg_over_time", "min_over_time", "max_over_time"} {
+		for _, query := range []string{
+			f + `(a[2m])`,
+			`sum by (b) (` + f + `(a[5m] offset 3m))`,
+			f + `(a{b="1"}[1m]) * 2`,
+		} {
+			t.Run(query, func(t *testing.T) {
+				for _, step := range []time.Duration{0, 30 * time.Second, 7 * time.Second} {
+					for _, dedup := range []bool{false, true} {
+						expected := exec(&testStoreServer{resps: resps()}, dedup, false, query, step)
+						testutil.Equals(t, expected, exec(&testStoreServer{resps: resps()}, dedup, true, query, step))
+
+						remote := &pushdownStoreServer{testStoreServer: &testStoreServer{resps: resps()}}
+						proxy := store.NewProxyStore(nil, nil, func() []store.Client {
+							return []store.Client{&pushdownStoreClient{&typedStoreClient{StoreClient: storepb.ServerAsClient(remote, 0), name: "store", storeType: component.Store}}}
+						}, component.Query, nil, 0)
+						testutil.Equals(t, expected, exec(proxy, dedup, true, query, step))
+						// Stores evaluate functions only over series which aren't deduplicated.
+						testutil.Equals(t, !dedup, remote.pushedDown.Load() > 0)
+					}
+				}
+			})
+		}
+	}
+}
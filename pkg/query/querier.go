@@ -18,7 +18,9 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	promgate "github.com/prometheus/prometheus/util/gate"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/gate"
@@ -36,8 +38,26 @@ import (
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behavior of proxy.
 type QueryableCreator func(deduplicate bool, replicaLabels []string, storeDebugMatchers [][]*labels.Matcher, maxResolutionMillis int64, partialResponse, enableQueryPushdown, skipChunks bool) storage.Queryable
 
+// QueryableOptions are the options of the queryables created by a QueryableCreator. The zero value disables all of them.
+type QueryableOptions struct {
+	// StoreDeadlineHeadroom makes Store API calls get a deadline this much earlier than the deadline of the query, if any,
+	// to leave time for merging and serializing their results.
+	StoreDeadlineHeadroom time.Duration
+	// StoreTypeReplicaLabels are the replica labels series of stores of the given types are additionally deduplicated
+	// along. They are not overwritten by query time replica labels.
+	StoreTypeReplicaLabels StoreTypeReplicaLabels
+	// MaxLabelValueCardinality rejects selects before fetching series if a label of a non-equality matcher has more
+	// matching values, 0 meaning no limit.
+	MaxLabelValueCardinality int
+	// MaxMatchersPerSelector rejects selectors with more matchers before reaching the stores, 0 meaning no limit.
+	MaxMatchersPerSelector int
+	// DedupAlgorithm is the algorithm replicas are deduplicated with, one of dedup.AlgorithmPenalty, the default, and
+	// dedup.AlgorithmChain.
+	DedupAlgorithm string
+}
+
 // NewQueryableCreator creates QueryableCreator.
-func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration) QueryableCreator {
+func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy storepb.StoreServer, maxConcurrentSelects int, selectTimeout time.Duration, opts QueryableOptions) QueryableCreator {
 	duration := promauto.With(
 		extprom.WrapRegistererWithPrefix("concurrent_selects_", reg),
 	).NewHistogram(gate.DurationHistogramOpts)
@@ -58,6 +78,7 @@ func NewQueryableCreator(logger log.Logger, reg prometheus.Registerer, proxy sto
 			maxConcurrentSelects: maxConcurrentSelects,
 			selectTimeout:        selectTimeout,
 			enableQueryPushdown:  enableQueryPushdown,
+			opts:                 opts,
 		}
 	}
 }
@@ -75,11 +96,12 @@ type queryable struct {
 	maxConcurrentSelects int
 	selectTimeout        time.Duration
 	enableQueryPushdown  bool
+	opts                 QueryableOptions
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.partialResponse, q.enableQueryPushdown, q.skipChunks, q.gateProviderFn(), q.selectTimeout), nil
+	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.storeDebugMatchers, q.proxy, q.deduplicate, q.maxResolutionMillis, q.partialResponse, q.enableQueryPushdown, q.skipChunks, q.gateProviderFn(), q.selectTimeout, q.opts), nil
 }
 
 type querier struct {
@@ -97,6 +119,7 @@ type querier struct {
 	skipChunks          bool
 	selectGate          gate.Gate
 	selectTimeout       time.Duration
+	opts                QueryableOptions
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -113,6 +136,7 @@ func newQuerier(
 	partialResponse, enableQueryPushdown bool, skipChunks bool,
 	selectGate gate.Gate,
 	selectTimeout time.Duration,
+	opts QueryableOptions,
 ) *querier {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -140,11 +164,22 @@ func newQuerier(
 		partialResponse:     partialResponse,
 		skipChunks:          skipChunks,
 		enableQueryPushdown: enableQueryPushdown,
+		opts:                opts,
 	}
 }
 
+// withStoreDeadline returns the context for Store API calls, whose deadline is the deadline of the query
+// minus the headroom, if earlier than the deadline of ctx.
+func (q *querier) withStoreDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := q.ctx.Deadline()
+	if !ok || q.opts.StoreDeadlineHeadroom <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline.Add(-q.opts.StoreDeadlineHeadroom))
+}
+
 func (q *querier) isDedupEnabled() bool {
-	return q.deduplicate && len(q.replicaLabels) > 0
+	return q.deduplicate && (len(q.replicaLabels) > 0 || len(q.opts.StoreTypeReplicaLabels) > 0)
 }
 
 type seriesServer struct {
@@ -213,12 +248,30 @@ func storeHintsFromPromHints(hints *storage.SelectHints) *storepb.QueryHints {
 }
 
 func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
+	var pushdown *storepb.Pushdown
+	if q.enableQueryPushdown {
+		var err error
+		if ms, pushdown, err = pushdownFromMatchers(hints, ms); err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+	}
+	if err := q.checkMatchersLimit(ms); err != nil {
+		return storage.ErrSeriesSet(err)
+	}
 	if hints == nil {
 		hints = &storage.SelectHints{
 			Start: q.mint,
 			End:   q.maxt,
 		}
 	}
+	if pushdown != nil {
+		// Select the samples the pushed down function is evaluated over, as the engine would for the function itself.
+		rawHints := *hints
+		rawHints.Start = pushdown.Start - pushdown.RangeMillis
+		rawHints.Range = pushdown.RangeMillis
+		rawHints.Func = pushdown.Func
+		hints = &rawHints
+	}
 
 	matchers := make([]string, len(ms))
 	for i, m := range ms {
@@ -228,7 +281,21 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 	// The querier has a context but it gets canceled, as soon as query evaluation is completed, by the engine.
 	// We want to prevent this from happening for the async store API calls we make while preserving tracing context.
 	ctx := tracing.CopyTraceContext(context.Background(), q.ctx)
-	ctx, cancel := context.WithTimeout(ctx, q.selectTimeout)
+	if tracker := q.ctx.Value(store.PartialResponseTrackerKey); tracker != nil {
+		ctx = context.WithValue(ctx, store.PartialResponseTrackerKey, tracker)
+	}
+	if noCache := q.ctx.Value(store.NoCacheKey); noCache != nil {
+		ctx = context.WithValue(ctx, store.NoCacheKey, noCache)
+	}
+	if tenant := store.TenantFromContext(q.ctx); tenant != "" {
+		ctx = context.WithValue(ctx, store.TenantKey, tenant)
+	}
+	ctx, cancelTimeout := context.WithTimeout(ctx, q.selectTimeout)
+	ctx, cancelDeadline := q.withStoreDeadline(ctx)
+	cancel := func() {
+		cancelDeadline()
+		cancelTimeout()
+	}
 	span, ctx := tracing.StartSpan(ctx, "querier_select", opentracing.Tags{
 		"minTime":  hints.Start,
 		"maxTime":  hints.End,
@@ -252,11 +319,14 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 		span, ctx := tracing.StartSpan(ctx, "querier_select_select_fn")
 		defer span.Finish()
 
-		set, err := q.selectFn(ctx, hints, ms...)
+		set, err := q.selectFn(ctx, hints, pushdown, ms...)
 		if err != nil {
 			promise <- storage.ErrSeriesSet(err)
 			return
 		}
+		if pushdown != nil {
+			set = &pushdownSeriesSet{SeriesSet: set, pushdown: pushdown}
+		}
 
 		promise <- set
 	}()
@@ -274,7 +344,7 @@ func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Match
 	}}
 }
 
-func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms ...*labels.Matcher) (storage.SeriesSet, error) {
+func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, pushdown *storepb.Pushdown, ms ...*labels.Matcher) (storage.SeriesSet, error) {
 	sms, err := storepb.PromMatchersToMatchers(ms...)
 	if err != nil {
 		return nil, errors.Wrap(err, "convert matchers")
@@ -285,24 +355,39 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
 	ctx = context.WithValue(ctx, store.StoreMatcherKey, q.storeDebugMatchers)
 
-	// TODO(bwplotka): Use inprocess gRPC.
-	resp := &seriesServer{ctx: ctx}
-	var queryHints *storepb.QueryHints
-	if q.enableQueryPushdown {
-		queryHints = storeHintsFromPromHints(hints)
-	}
-	if err := q.proxy.Series(&storepb.SeriesRequest{
+	req := &storepb.SeriesRequest{
 		MinTime:                 hints.Start,
 		MaxTime:                 hints.End,
 		Matchers:                sms,
 		MaxResolutionWindow:     q.maxResolutionMillis,
 		Aggregates:              aggrs,
-		QueryHints:              queryHints,
 		PartialResponseDisabled: !q.partialResponse,
 		SkipChunks:              q.skipChunks,
 		Step:                    hints.Step,
 		Range:                   hints.Range,
-	}, resp); err != nil {
+	}
+	if q.enableQueryPushdown && pushdown == nil {
+		req.QueryHints = storeHintsFromPromHints(hints)
+	}
+	// Stores evaluate the function over the samples of a single replica, or raw samples only.
+	if pushdown != nil && !q.isDedupEnabled() && q.maxResolutionMillis == 0 {
+		req.Pushdown = pushdown
+	}
+	req.NoCache, _ = ctx.Value(store.NoCacheKey).(bool)
+
+	if err := q.checkLabelValueCardinality(ctx, hints, ms, sms); err != nil {
+		return nil, err
+	}
+
+	var resp *seriesServer
+	if q.isDedupEnabled() && len(q.opts.StoreTypeReplicaLabels) > 0 {
+		resp, err = q.seriesByStoreType(ctx, req)
+	} else {
+		// TODO(bwplotka): Use inprocess gRPC.
+		resp = &seriesServer{ctx: ctx}
+		err = q.proxy.Series(req, resp)
+	}
+	if err != nil {
 		return nil, errors.Wrap(err, "proxy Series()")
 	}
 
@@ -327,22 +412,42 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 		}
 	}
 
+	mint, maxt := q.mint, q.maxt
+	if pushdown != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+
 	if !q.isDedupEnabled() {
 		// Return data without any deduplication.
 		return &promSeriesSet{
-			mint:  q.mint,
-			maxt:  q.maxt,
+			mint:  mint,
+			maxt:  maxt,
 			set:   newStoreSeriesSet(resp.seriesSet),
 			aggrs: aggrs,
 			warns: warns,
 		}, nil
 	}
 
-	// TODO(fabxc): this could potentially pushed further down into the store API to make true streaming possible.
-	sortDedupLabels(resp.seriesSet, q.replicaLabels)
+	replicaLabels := q.replicaLabels
+	if len(q.opts.StoreTypeReplicaLabels) > 0 {
+		// Replica labels were already stripped according to the type of the store each series comes from,
+		// so replicas of a series have equal labels.
+		replicaLabels = nil
+	}
+	if len(replicaLabels) > 0 || q.enableQueryPushdown {
+		// The pushdown marker has to be moved to the end of the labels too, so that pushed down series
+		// come right after the replicas of the same series.
+		// TODO(fabxc): this could potentially pushed further down into the store API to make true streaming possible.
+		sortDedupLabels(resp.seriesSet, replicaLabels)
+	} else {
+		// Sort the set to bring the replicas of a series together.
+		sort.Slice(resp.seriesSet, func(i, j int) bool {
+			return labels.Compare(labelpb.ZLabelsToPromLabels(resp.seriesSet[i].Labels), labelpb.ZLabelsToPromLabels(resp.seriesSet[j].Labels)) < 0
+		})
+	}
 	set := &promSeriesSet{
-		mint:  q.mint,
-		maxt:  q.maxt,
+		mint:  mint,
+		maxt:  maxt,
 		set:   newStoreSeriesSet(resp.seriesSet),
 		aggrs: aggrs,
 		warns: warns,
@@ -350,7 +455,64 @@ func (q *querier) selectFn(ctx context.Context, hints *storage.SelectHints, ms .
 
 	// The merged series set assembles all potentially-overlapping time ranges of the same series into a single one.
 	// TODO(bwplotka): We could potentially dedup on chunk level, use chunk iterator for that when available.
-	return dedup.NewSeriesSet(set, q.replicaLabels, hints.Func, q.enableQueryPushdown), nil
+	return dedup.NewSeriesSet(set, replicaLabels, hints.Func, q.enableQueryPushdown, q.opts.DedupAlgorithm), nil
+}
+
+// seriesByStoreType requests series separately from the stores of each type with its own replica labels,
+// and from all remaining stores. Replica labels applying to the type of the store each series comes from
+// are removed from the returned series.
+func (q *querier) seriesByStoreType(ctx context.Context, req *storepb.SeriesRequest) (*seriesServer, error) {
+	filters := make([]store.StoreTypeFilter, 0, len(q.opts.StoreTypeReplicaLabels)+1)
+	replicaLabels := make([]map[string]struct{}, 0, len(q.opts.StoreTypeReplicaLabels)+1)
+	rest := store.StoreTypeFilter{Exclude: true}
+	for t, lbls := range q.opts.StoreTypeReplicaLabels {
+		rl := make(map[string]struct{}, len(q.replicaLabels)+len(lbls))
+		for l := range q.replicaLabels {
+			rl[l] = struct{}{}
+		}
+		for _, l := range lbls {
+			rl[l] = struct{}{}
+		}
+		filters = append(filters, store.StoreTypeFilter{Types: []component.StoreAPI{t}})
+		replicaLabels = append(replicaLabels, rl)
+		rest.Types = append(rest.Types, t)
+	}
+	filters = append(filters, rest)
+	replicaLabels = append(replicaLabels, q.replicaLabels)
+
+	resps := make([]*seriesServer, len(filters))
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range filters {
+		i := i
+		resps[i] = &seriesServer{ctx: context.WithValue(gctx, store.StoreTypeFilterKey, filters[i])}
+		g.Go(func() error {
+			return q.proxy.Series(req, resps[i])
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	resp := &seriesServer{ctx: ctx}
+	for i, r := range resps {
+		for _, s := range r.seriesSet {
+			s.Labels = stripReplicaLabels(s.Labels, replicaLabels[i])
+			resp.seriesSet = append(resp.seriesSet, s)
+		}
+		resp.warnings = append(resp.warnings, r.warnings...)
+	}
+	return resp, nil
+}
+
+// stripReplicaLabels removes the given replica labels from the label set, in place.
+func stripReplicaLabels(lset []labelpb.ZLabel, replicaLabels map[string]struct{}) []labelpb.ZLabel {
+	res := lset[:0]
+	for _, l := range lset {
+		if _, ok := replicaLabels[l.Name]; !ok {
+			res = append(res, l)
+		}
+	}
+	return res
 }
 
 // sortDedupLabels re-sorts the set so that the same series with different replica
@@ -384,7 +546,13 @@ func sortDedupLabels(set []storepb.Series, replicaLabels map[string]struct{}) {
 
 // LabelValues returns all potential values for a label name.
 func (q *querier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
-	span, ctx := tracing.StartSpan(q.ctx, "querier_label_values")
+	if err := q.checkMatchersLimit(matchers); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := q.withStoreDeadline(q.ctx)
+	defer cancel()
+	span, ctx := tracing.StartSpan(ctx, "querier_label_values")
 	defer span.Finish()
 
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
@@ -417,7 +585,13 @@ func (q *querier) LabelValues(name string, matchers ...*labels.Matcher) ([]strin
 // LabelNames returns all the unique label names present in the block in sorted order constrained
 // by the given matchers.
 func (q *querier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
-	span, ctx := tracing.StartSpan(q.ctx, "querier_label_names")
+	if err := q.checkMatchersLimit(matchers); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := q.withStoreDeadline(q.ctx)
+	defer cancel()
+	span, ctx := tracing.StartSpan(ctx, "querier_label_names")
 	defer span.Finish()
 
 	// TODO(bwplotka): Pass it using the SeriesRequest instead of relying on context.
@@ -13,6 +13,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -42,7 +43,7 @@ type sample struct {
 
 func TestQueryableCreator_MaxResolution(t *testing.T) {
 	testProxy := &testStoreServer{resps: []*storepb.SeriesResponse{}}
-	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second)
+	queryableCreator := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second, QueryableOptions{})
 
 	oneHourMillis := int64(1*time.Hour) / int64(time.Millisecond)
 	queryable := queryableCreator(false, nil, nil, oneHourMillis, false, false, false)
@@ -58,6 +59,30 @@ func TestQueryableCreator_MaxResolution(t *testing.T) {
 
 }
 
+func TestQuerier_NoCache(t *testing.T) {
+	for _, noCache := range []bool{false, true} {
+		t.Run(fmt.Sprintf("no_cache=%v", noCache), func(t *testing.T) {
+			testProxy := &requestRecordingStoreServer{}
+			queryable := NewQueryableCreator(nil, nil, testProxy, 2, 5*time.Second, QueryableOptions{})(false, nil, nil, 0, false, false, false)
+
+			ctx := context.Background()
+			if noCache {
+				ctx = context.WithValue(ctx, store.NoCacheKey, true)
+			}
+			q, err := queryable.Querier(ctx, 0, 42)
+			testutil.Ok(t, err)
+			t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+			set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+			testutil.Assert(t, !set.Next(), "expected no series")
+			testutil.Ok(t, set.Err())
+
+			testutil.Equals(t, 1, len(testProxy.reqs))
+			testutil.Equals(t, noCache, testProxy.reqs[0].NoCache)
+		})
+	}
+}
+
 // Tests E2E how PromQL works with downsampled data.
 func TestQuerier_DownsampledData(t *testing.T) {
 	testProxy := &testStoreServer{
@@ -72,7 +97,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 	}
 
 	timeout := 10 * time.Second
-	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout)(false, nil, nil, 9999999, false, false, false)
+	q := NewQueryableCreator(nil, nil, testProxy, 2, timeout, QueryableOptions{})(false, nil, nil, 9999999, false, false, false)
 	engine := promql.NewEngine(
 		promql.EngineOpts{
 			MaxSamples: math.MaxInt32,
@@ -363,7 +388,7 @@ func TestQuerier_Select_AfterPromQL(t *testing.T) {
 						g := gate.New(2)
 						mq := &mockedQueryable{
 							Creator: func(mint, maxt int64) storage.Querier {
-								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout)
+								return newQuerier(context.Background(), nil, mint, maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout, QueryableOptions{})
 							},
 						}
 						t.Cleanup(func() {
@@ -607,7 +632,7 @@ func TestQuerier_Select(t *testing.T) {
 				{dedup: true, expected: []series{tcase.expectedAfterDedup}},
 			} {
 				g := gate.New(2)
-				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout)
+				q := newQuerier(context.Background(), nil, tcase.mint, tcase.maxt, tcase.replicaLabels, nil, tcase.storeAPI, sc.dedup, 0, true, false, false, g, timeout, QueryableOptions{})
 				t.Cleanup(func() { testutil.Ok(t, q.Close()) })
 
 				t.Run(fmt.Sprintf("dedup=%v", sc.dedup), func(t *testing.T) {
@@ -836,7 +861,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 100 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, 0, true, false, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, false, 0, true, false, false, g, timeout, QueryableOptions{})
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -906,7 +931,7 @@ func TestQuerierWithDedupUnderstoodByPromQL_Rate(t *testing.T) {
 
 		timeout := 5 * time.Second
 		g := gate.New(2)
-		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, 0, true, false, false, g, timeout)
+		q := newQuerier(context.Background(), logger, realSeriesWithStaleMarkerMint, realSeriesWithStaleMarkerMaxt, []string{"replica"}, nil, s, true, 0, true, false, false, g, timeout, QueryableOptions{})
 		t.Cleanup(func() {
 			testutil.Ok(t, q.Close())
 		})
@@ -1043,6 +1068,131 @@ func expandSeries(t testing.TB, it chunkenc.Iterator) (res []sample) {
 	return res
 }
 
+func TestQuerier_Select_StoreTypeReplicaLabels(t *testing.T) {
+	smpls := []sample{{t: 0, v: 1}, {t: 1000, v: 2}}
+	stores := []store.Client{
+		&typedStoreClient{
+			StoreClient: storepb.ServerAsClient(&testStoreServer{resps: []*storepb.SeriesResponse{
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "prometheus", "prometheus_replica", "a"), smpls),
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "prometheus", "prometheus_replica", "b"), smpls),
+			}}, 0),
+			name:      "sidecar",
+			storeType: component.Sidecar,
+		},
+		// Receive series carry prometheus_replica as a regular label, which must not be deduplicated.
+		&typedStoreClient{
+			StoreClient: storepb.ServerAsClient(&testStoreServer{resps: []*storepb.SeriesResponse{
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "x", "receive_replica", "1"), smpls),
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "x", "receive_replica", "2"), smpls),
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "y", "receive_replica", "1"), smpls),
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "y", "receive_replica", "2"), smpls),
+			}}, 0),
+			name:      "receive",
+			storeType: component.Receive,
+		},
+		// Stores of other types are deduplicated only by the global replica labels.
+		&typedStoreClient{
+			StoreClient: storepb.ServerAsClient(&testStoreServer{resps: []*storepb.SeriesResponse{
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "rule", "replica", "1", "receive_replica", "1"), smpls),
+				storeSeriesResponse(t, labels.FromStrings("__name__", "up", "job", "rule", "replica", "2", "receive_replica", "1"), smpls),
+			}}, 0),
+			name:      "rule",
+			storeType: component.Rule,
+		},
+	}
+	proxy := store.NewProxyStore(nil, nil, func() []store.Client { return stores }, component.Query, nil, 0)
+
+	storeTypeReplicaLabels, err := ParseStoreTypeReplicaLabels([]string{"sidecar=prometheus_replica", "receive=receive_replica"})
+	testutil.Ok(t, err)
+
+	q := newQuerier(context.Background(), nil, 0, 1000, []string{"replica"}, nil, proxy, true, 0, true, false, false, gate.New(2), 5*time.Second, QueryableOptions{StoreTypeReplicaLabels: storeTypeReplicaLabels})
+	t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+	set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+	var got []labels.Labels
+	for set.Next() {
+		got = append(got, set.At().Labels())
+		testutil.Equals(t, smpls, expandSeries(t, set.At().Iterator()))
+	}
+	testutil.Ok(t, set.Err())
+
+	testutil.Equals(t, []labels.Labels{
+		labels.FromStrings("__name__", "up", "job", "prometheus"),
+		labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "x"),
+		labels.FromStrings("__name__", "up", "job", "remote", "prometheus_replica", "y"),
+		labels.FromStrings("__name__", "up", "job", "rule", "receive_replica", "1"),
+	}, got)
+}
+
+func TestQuerier_StoreDeadlineHeadroom(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	s := &deadlineRecordingStoreServer{}
+	// The select timeout is longer than the deadline of the query, which takes precedence.
+	q := newQuerier(ctx, nil, 0, 1000, nil, nil, s, false, 0, true, false, false, gate.New(2), 2*time.Minute, QueryableOptions{StoreDeadlineHeadroom: 10 * time.Second})
+	t.Cleanup(func() { testutil.Ok(t, q.Close()) })
+
+	set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up"))
+	for set.Next() {
+	}
+	testutil.Ok(t, set.Err())
+	_, _, err := q.LabelValues("job")
+	testutil.Ok(t, err)
+	_, _, err = q.LabelNames()
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, 3, len(s.deadlines))
+	for _, d := range s.deadlines {
+		testutil.Assert(t, d.Equal(deadline.Add(-10*time.Second)), "expected store deadline 10s before %v, got %v", deadline, d)
+	}
+}
+
+// deadlineRecordingStoreServer records the deadlines of calls without returning any data.
+type deadlineRecordingStoreServer struct {
+	storepb.StoreServer
+
+	mtx       sync.Mutex
+	deadlines []time.Time
+}
+
+func (s *deadlineRecordingStoreServer) record(ctx context.Context) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	d, _ := ctx.Deadline()
+	s.deadlines = append(s.deadlines, d)
+}
+
+func (s *deadlineRecordingStoreServer) Series(_ *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.record(srv.Context())
+	return nil
+}
+
+func (s *deadlineRecordingStoreServer) LabelValues(ctx context.Context, _ *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	s.record(ctx)
+	return &storepb.LabelValuesResponse{}, nil
+}
+
+func (s *deadlineRecordingStoreServer) LabelNames(ctx context.Context, _ *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	s.record(ctx)
+	return &storepb.LabelNamesResponse{}, nil
+}
+
+// typedStoreClient is a store client reporting the component type of its store.
+type typedStoreClient struct {
+	storepb.StoreClient
+
+	name      string
+	storeType component.StoreAPI
+}
+
+func (c *typedStoreClient) LabelSets() []labels.Labels         { return nil }
+func (c *typedStoreClient) TimeRange() (int64, int64)          { return math.MinInt64, math.MaxInt64 }
+func (c *typedStoreClient) String() string                     { return c.name }
+func (c *typedStoreClient) Addr() string                       { return c.name }
+func (c *typedStoreClient) ComponentType() component.Component { return c.storeType }
+
 type testStoreServer struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
 	storepb.StoreServer
@@ -1060,6 +1210,21 @@ func (s *testStoreServer) Series(_ *storepb.SeriesRequest, srv storepb.Store_Ser
 	return nil
 }
 
+// requestRecordingStoreServer records Series requests without returning any series.
+type requestRecordingStoreServer struct {
+	storepb.StoreServer
+
+	mtx  sync.Mutex
+	reqs []*storepb.SeriesRequest
+}
+
+func (s *requestRecordingStoreServer) Series(req *storepb.SeriesRequest, _ storepb.Store_SeriesServer) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.reqs = append(s.reqs, req)
+	return nil
+}
+
 // storeSeriesResponse creates test storepb.SeriesResponse that includes series with single chunk that stores all the given samples.
 func storeSeriesResponse(t testing.TB, lset labels.Labels, smplChunks ...[]sample) *storepb.SeriesResponse {
 	var s storepb.Series
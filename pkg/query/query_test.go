@@ -39,6 +39,7 @@ func TestQuerier_Proxy(t *testing.T) {
 				component.Debug, nil, 5*time.Minute),
 			1000000,
 			5*time.Minute,
+			QueryableOptions{},
 		)
 
 		createQueryableFn := func(stores []*testStore) storage.Queryable {
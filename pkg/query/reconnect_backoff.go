@@ -0,0 +1,124 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+)
+
+// EndpointSetOption configures an EndpointSet.
+type EndpointSetOption func(*EndpointSet)
+
+// WithReconnectBackoff makes the EndpointSet back off exponentially, with jitter, from reconnecting to endpoints
+// failing consecutively, instead of reconnecting on every update. The connections kept open to endpoints,
+// e.g. to strict ones, reconnect with the same backoff.
+func WithReconnectBackoff(cfg backoff.Config) EndpointSetOption {
+	return func(e *EndpointSet) {
+		e.reconnects.cfg = cfg
+		e.dialOpts = append(append([]grpc.DialOption{}, e.dialOpts...), grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: cfg,
+			// Same as the gRPC default.
+			MinConnectTimeout: 20 * time.Second,
+		}))
+	}
+}
+
+// reconnectBackoff tracks the consecutive failures of endpoints, so that reconnections to them are backed off.
+// A zero base delay disables the backoff, while reconnection attempts are still counted.
+type reconnectBackoff struct {
+	cfg backoff.Config
+	now func() time.Time
+
+	mtx      sync.Mutex
+	failures map[string]*endpointFailures
+
+	attempts prometheus.Counter
+}
+
+type endpointFailures struct {
+	count   int
+	retryAt time.Time
+}
+
+func newReconnectBackoff(attempts prometheus.Counter) *reconnectBackoff {
+	return &reconnectBackoff{
+		now:      time.Now,
+		failures: map[string]*endpointFailures{},
+		attempts: attempts,
+	}
+}
+
+// attempt returns true if the endpoint can be connected to, i.e. if it's not backed off.
+func (b *reconnectBackoff) attempt(addr string) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	f, ok := b.failures[addr]
+	if !ok {
+		return true
+	}
+	if b.now().Before(f.retryAt) {
+		return false
+	}
+	b.attempts.Inc()
+	return true
+}
+
+// failed records a failed connection to the endpoint and backs it off.
+func (b *reconnectBackoff) failed(addr string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	f, ok := b.failures[addr]
+	if !ok {
+		f = &endpointFailures{}
+		b.failures[addr] = f
+	}
+	f.count++
+	f.retryAt = b.now().Add(b.delay(f.count))
+}
+
+// succeeded resets the backoff of the endpoint.
+func (b *reconnectBackoff) succeeded(addr string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.failures, addr)
+}
+
+// retain forgets the failures of endpoints which are not in addrs anymore.
+func (b *reconnectBackoff) retain(addrs map[string]struct{}) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for addr := range b.failures {
+		if _, ok := addrs[addr]; !ok {
+			delete(b.failures, addr)
+		}
+	}
+}
+
+// delay returns the backoff after the given number of consecutive failures, which grows from the base delay
+// by the multiplier up to the max delay, randomized by the jitter.
+func (b *reconnectBackoff) delay(failures int) time.Duration {
+	if b.cfg.BaseDelay <= 0 {
+		return 0
+	}
+
+	d, max := float64(b.cfg.BaseDelay), float64(b.cfg.MaxDelay)
+	for i := 1; i < failures && d < max; i++ {
+		d *= b.cfg.Multiplier
+	}
+	if d > max {
+		d = max
+	}
+	d *= 1 + b.cfg.Jitter*(rand.Float64()*2-1)
+	return time.Duration(d)
+}
@@ -0,0 +1,35 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/component"
+)
+
+// StoreTypeReplicaLabels holds replica labels which are deduplicated only on series coming from stores
+// of the given component type, in addition to the replica labels applying to all series.
+type StoreTypeReplicaLabels map[component.StoreAPI][]string
+
+// ParseStoreTypeReplicaLabels parses store type replica labels in the `<store type>=<replica label>` form,
+// e.g. `sidecar=prometheus_replica`.
+func ParseStoreTypeReplicaLabels(flags []string) (StoreTypeReplicaLabels, error) {
+	res := StoreTypeReplicaLabels{}
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, errors.Errorf("invalid store type replica label %q, expected <store type>=<replica label>", f)
+		}
+
+		storeType := component.FromString(parts[0])
+		if storeType == component.UnknownStoreAPI {
+			return nil, errors.Errorf("unknown store type %q in %q", parts[0], f)
+		}
+		res[storeType] = append(res[storeType], parts[1])
+	}
+	return res, nil
+}
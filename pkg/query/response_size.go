@@ -0,0 +1,98 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ErrResponseTooLarge is returned when the encoded query result would exceed the configured size limit.
+var ErrResponseTooLarge = errors.New("query response too large")
+
+// CheckResponseSize estimates the size of the JSON encoding of the given query result and returns
+// ErrResponseTooLarge as soon as the estimate exceeds maxBytes. The estimate is accumulated series
+// by series, so oversized results are rejected without walking them fully. The escaping of label names and values
+// isn't accounted for, so the encoded result can be slightly larger than the estimate. 0 means no limit.
+func CheckResponseSize(v parser.Value, maxBytes int64) error {
+	return CheckResponsesSize([]parser.Value{v}, maxBytes)
+}
+
+// CheckResponsesSize is like CheckResponseSize, for the total size of several query results served in one response.
+func CheckResponsesSize(vs []parser.Value, maxBytes int64) error {
+	if maxBytes <= 0 {
+		return nil
+	}
+
+	e := &responseSizeEstimator{max: maxBytes}
+	for _, v := range vs {
+		e.addValue(v)
+		if e.exceeded() {
+			return errors.Wrapf(ErrResponseTooLarge, "estimated size exceeds the limit of %d bytes", maxBytes)
+		}
+	}
+	return nil
+}
+
+type responseSizeEstimator struct {
+	size int64
+	max  int64
+}
+
+func (e *responseSizeEstimator) addValue(v parser.Value) {
+	switch v := v.(type) {
+	case promql.Matrix:
+		for _, s := range v {
+			// {"metric":<labels>,"values":[<points>]},
+			e.add(len(`{"metric":,"values":[]},`))
+			e.addLabels(s.Metric)
+			for _, p := range s.Points {
+				e.addPoint(p.T, p.V)
+			}
+			if e.exceeded() {
+				break
+			}
+		}
+	case promql.Vector:
+		for _, s := range v {
+			// {"metric":<labels>,"value":<point>},
+			e.add(len(`{"metric":,"value":},`))
+			e.addLabels(s.Metric)
+			e.addPoint(s.T, s.V)
+			if e.exceeded() {
+				break
+			}
+		}
+	case promql.Scalar:
+		e.addPoint(v.T, v.V)
+	case promql.String:
+		e.addPoint(v.T, 0)
+		e.add(len(v.V))
+	}
+}
+
+func (e *responseSizeEstimator) add(n int) {
+	e.size += int64(n)
+}
+
+func (e *responseSizeEstimator) exceeded() bool {
+	return e.size > e.max
+}
+
+func (e *responseSizeEstimator) addLabels(lset labels.Labels) {
+	// {"name":"value",...}
+	e.add(2)
+	for _, l := range lset {
+		e.add(len(l.Name) + len(l.Value) + len(`"":"",`))
+	}
+}
+
+func (e *responseSizeEstimator) addPoint(t int64, v float64) {
+	// [<seconds>,"<value>"],
+	e.add(len(strconv.FormatFloat(float64(t)/1000, 'f', -1, 64)) + len(strconv.FormatFloat(v, 'f', -1, 64)) + len(`[,""],`))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestCheckResponseSize(t *testing.T) {
+	matrix := promql.Matrix{}
+	for i := 0; i < 10; i++ {
+		s := promql.Series{Metric: labels.FromStrings("__name__", "up", "instance", "localhost:9090", "job", "prometheus")}
+		for ts := int64(0); ts < 100; ts++ {
+			s.Points = append(s.Points, promql.Point{T: ts * 15000, V: float64(ts) / 3})
+		}
+		matrix = append(matrix, s)
+	}
+	vector := promql.Vector{
+		{Metric: labels.FromStrings("__name__", "up", "job", "prometheus"), Point: promql.Point{T: 1000, V: 1}},
+		{Metric: labels.FromStrings("__name__", "up", "job", "node"), Point: promql.Point{T: 1000, V: 0}},
+	}
+
+	for _, v := range []parser.Value{matrix, vector, promql.Scalar{T: 1000, V: 2.5}} {
+		t.Run(string(v.Type()), func(t *testing.T) {
+			b, err := json.Marshal(v)
+			testutil.Ok(t, err)
+			size := int64(len(b))
+
+			// The estimate may slightly overshoot the real size due to trailing separators.
+			testutil.Ok(t, CheckResponseSize(v, size+size/10+8))
+			testutil.Ok(t, CheckResponseSize(v, 0))
+
+			err = CheckResponseSize(v, size/2)
+			testutil.NotOk(t, err)
+			testutil.Assert(t, errors.Is(err, ErrResponseTooLarge), "unexpected error: %v", err)
+		})
+	}
+}
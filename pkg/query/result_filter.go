@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// FilterResult returns the series of the query result whose labels match any of the matcher sets, after the whole
+// query was evaluated. The matchers only see the labels of the result series: a label dropped by an aggregation or
+// a function is absent, so it only matches matchers accepting an empty value. Scalar and string results are returned
+// as is, as well as any result if there are no matcher sets.
+func FilterResult(v parser.Value, matcherSets [][]*labels.Matcher) parser.Value {
+	if len(matcherSets) == 0 {
+		return v
+	}
+
+	// The result is not filtered in place, as the engine still references it to release its points on close.
+	switch v := v.(type) {
+	case promql.Matrix:
+		res := make(promql.Matrix, 0, len(v))
+		for _, s := range v {
+			if matchesAnySet(matcherSets, s.Metric) {
+				res = append(res, s)
+			}
+		}
+		return res
+	case promql.Vector:
+		res := make(promql.Vector, 0, len(v))
+		for _, s := range v {
+			if matchesAnySet(matcherSets, s.Metric) {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return v
+}
+
+func matchesAnySet(matcherSets [][]*labels.Matcher, lset labels.Labels) bool {
+	for _, ms := range matcherSets {
+		matches := true
+		for _, m := range ms {
+			if !m.Matches(lset.Get(m.Name)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
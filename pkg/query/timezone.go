@@ -0,0 +1,136 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"time"
+	// Embed the IANA time zone database, so time zones can be loaded on hosts without one.
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// calendarFunctions are the PromQL functions returning calendar values of timestamps, which the engine evaluates in UTC.
+var calendarFunctions = map[string]struct{}{
+	"day_of_month":  {},
+	"day_of_week":   {},
+	"days_in_month": {},
+	"hour":          {},
+	"minute":        {},
+	"month":         {},
+	"year":          {},
+}
+
+// ShiftCalendarFunctions rewrites the query so calendar functions (e.g. hour or day_of_week) are evaluated in the given
+// location instead of UTC, for evaluation times between start and end. Their input timestamps are shifted by the UTC
+// offset the location has at the evaluation time, so offset changes like daylight saving time transitions between
+// start and end are accounted for.
+func ShiftCalendarFunctions(query string, loc *time.Location, start, end time.Time) (string, error) {
+	offset := utcOffsetExpr(loc, start, end)
+	if offset == nil {
+		return query, nil
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", errors.Wrap(err, "parse query")
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		call, ok := node.(*parser.Call)
+		if !ok {
+			return nil
+		}
+		if _, ok := calendarFunctions[call.Func.Name]; !ok {
+			return nil
+		}
+
+		// Calendar functions without argument are evaluated on the evaluation time.
+		arg := parser.Expr(&parser.Call{
+			Func: parser.Functions["vector"],
+			Args: parser.Expressions{&parser.Call{Func: parser.Functions["time"]}},
+		})
+		if len(call.Args) > 0 {
+			arg = &parser.ParenExpr{Expr: call.Args[0]}
+		}
+		call.Args = parser.Expressions{&parser.BinaryExpr{
+			Op:  parser.ADD,
+			LHS: arg,
+			RHS: offset,
+		}}
+		return nil
+	})
+	return expr.String(), nil
+}
+
+// utcOffsetExpr returns the scalar expression of the UTC offset of the location at the evaluation time, for evaluation
+// times between start and end, or nil if the offset is 0 all along. Every offset change between start and end adds the
+// difference to the previous offset from the time of the change on, e.g. 3600 + 3600 * (time() >= bool 1.6483428e+09).
+func utcOffsetExpr(loc *time.Location, start, end time.Time) parser.Expr {
+	offset := utcOffset(loc, start.Unix())
+	var expr parser.Expr = &parser.NumberLiteral{Val: float64(offset)}
+
+	for t := start.Unix(); ; {
+		change, next, ok := nextOffsetChange(loc, t, end.Unix(), offset)
+		if !ok {
+			break
+		}
+		expr = &parser.BinaryExpr{
+			Op:  parser.ADD,
+			LHS: expr,
+			RHS: &parser.BinaryExpr{
+				Op:  parser.MUL,
+				LHS: &parser.NumberLiteral{Val: float64(next - offset)},
+				RHS: &parser.ParenExpr{Expr: &parser.BinaryExpr{
+					Op:         parser.GTE,
+					LHS:        &parser.Call{Func: parser.Functions["time"]},
+					RHS:        &parser.NumberLiteral{Val: float64(change)},
+					ReturnBool: true,
+				}},
+			},
+		}
+		t, offset = change, next
+	}
+	if _, ok := expr.(*parser.NumberLiteral); ok {
+		if offset == 0 {
+			return nil
+		}
+		return expr
+	}
+	return &parser.ParenExpr{Expr: expr}
+}
+
+// nextOffsetChange returns the first Unix time after t and not after end at which the UTC offset of the location differs
+// from the given one, and the offset from then on. Time zones change their offset at most a few times a year, so the
+// time range is scanned by the day and the change is then searched to the second.
+func nextOffsetChange(loc *time.Location, t, end int64, offset int) (int64, int, bool) {
+	const day = 24 * 60 * 60
+	for lo := t; lo < end; lo += day {
+		hi := lo + day
+		if hi > end {
+			hi = end
+		}
+		if utcOffset(loc, hi) == offset {
+			continue
+		}
+		// The offset changes in (lo, hi].
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if utcOffset(loc, mid) == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return hi, utcOffset(loc, hi), true
+	}
+	return 0, 0, false
+}
+
+// utcOffset returns the UTC offset of the location at the given Unix time, in seconds.
+func utcOffset(loc *time.Location, t int64) int {
+	_, offset := time.Unix(t, 0).In(loc).Zone()
+	return offset
+}
@@ -0,0 +1,114 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/promql"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestShiftCalendarFunctions(t *testing.T) {
+	at := time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		query    string
+		loc      *time.Location
+		expected string
+	}{
+		{query: `hour()`, loc: time.UTC, expected: `hour()`},
+		{query: `hour()`, loc: kolkata, expected: `hour(vector(time()) + 19800)`},
+		{query: `day_of_week(timestamp(up))`, loc: kolkata, expected: `day_of_week((timestamp(up)) + 19800)`},
+		{query: `hour(a > 5)`, loc: kolkata, expected: `hour((a > 5) + 19800)`},
+		{query: `sum(up) and on() hour() > 9 and on() minute(foo) < 30`, loc: kolkata, expected: `sum(up) and on() hour(vector(time()) + 19800) > 9 and on() minute((foo) + 19800) < 30`},
+		{query: `rate(up[5m])`, loc: kolkata, expected: `rate(up[5m])`},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := ShiftCalendarFunctions(tc.query, tc.loc, at, at)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, q)
+		})
+	}
+
+	_, err = ShiftCalendarFunctions(`hour(`, kolkata, at, at)
+	testutil.NotOk(t, err)
+
+	t.Run("offset changes", func(t *testing.T) {
+		newYork, err := time.LoadLocation("America/New_York")
+		testutil.Ok(t, err)
+
+		// Daylight saving time starts at 2022-03-13 07:00 UTC and ends at 2022-11-06 06:00 UTC in New York.
+		q, err := ShiftCalendarFunctions(`hour()`, newYork, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC))
+		testutil.Ok(t, err)
+		testutil.Equals(t, `hour(vector(time()) + (-18000 + 3600 * (time() >= bool 1.6471548e+09) + -3600 * (time() >= bool 1.6677144e+09)))`, q)
+	})
+}
+
+func TestShiftCalendarFunctions_Hour(t *testing.T) {
+	timeout := 10 * time.Second
+	q := NewQueryableCreator(nil, nil, &testStoreServer{resps: []*storepb.SeriesResponse{}}, 2, timeout, QueryableOptions{})(false, nil, nil, 0, false, false, false)
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 100, Timeout: timeout})
+
+	at := time.Date(2022, 1, 1, 10, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		zone     string
+		expected float64
+	}{
+		{zone: "UTC", expected: 10},
+		{zone: "Asia/Kolkata", expected: 16},
+		{zone: "America/New_York", expected: 5},
+		{zone: "Pacific/Auckland", expected: 23},
+	} {
+		t.Run(tc.zone, func(t *testing.T) {
+			loc, err := time.LoadLocation(tc.zone)
+			testutil.Ok(t, err)
+
+			qs, err := ShiftCalendarFunctions(`hour()`, loc, at, at)
+			testutil.Ok(t, err)
+
+			qry, err := engine.NewInstantQuery(q, qs, at)
+			testutil.Ok(t, err)
+			defer qry.Close()
+
+			res := qry.Exec(context.Background())
+			testutil.Ok(t, res.Err)
+			vec, err := res.Vector()
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(vec))
+			testutil.Equals(t, tc.expected, vec[0].V)
+		})
+	}
+
+	t.Run("daylight saving time starts", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		testutil.Ok(t, err)
+
+		start, end := time.Date(2022, 3, 13, 5, 0, 0, 0, time.UTC), time.Date(2022, 3, 13, 8, 0, 0, 0, time.UTC)
+		qs, err := ShiftCalendarFunctions(`hour()`, loc, start, end)
+		testutil.Ok(t, err)
+
+		qry, err := engine.NewRangeQuery(q, qs, start, end, time.Hour)
+		testutil.Ok(t, err)
+		defer qry.Close()
+
+		res := qry.Exec(context.Background())
+		testutil.Ok(t, res.Err)
+		m, err := res.Matrix()
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(m))
+		var hours []float64
+		for _, p := range m[0].Points {
+			hours = append(hours, p.V)
+		}
+		// Clocks jump from 01:59:59 to 03:00:00.
+		testutil.Equals(t, []float64{0, 1, 3, 4}, hours)
+	})
+}
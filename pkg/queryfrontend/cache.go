@@ -4,41 +4,111 @@
 package queryfrontend
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/prometheus/client_golang/prometheus"
+	prommodel "github.com/prometheus/common/model"
+	"go.uber.org/atomic"
 
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 )
 
 // thanosCacheKeyGenerator is a utility for using split interval when determining cache keys.
 type thanosCacheKeyGenerator struct {
-	interval    time.Duration
-	resolutions []int64
+	interval     time.Duration
+	tenantLimits *TenantLimitsConfig
+	resolutions  []int64
+	// alignment is the duration the range of labels and series requests is aligned to in their key.
+	// 0 leaves the range out of the key.
+	alignment time.Duration
 }
 
-func newThanosCacheKeyGenerator(interval time.Duration) thanosCacheKeyGenerator {
+func newThanosCacheKeyGenerator(interval time.Duration, tenantLimits *TenantLimitsConfig) thanosCacheKeyGenerator {
 	return thanosCacheKeyGenerator{
-		interval:    interval,
-		resolutions: []int64{downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0},
+		interval:     interval,
+		tenantLimits: tenantLimits,
+		resolutions:  []int64{downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0},
 	}
 }
 
 // GenerateCacheKey generates a cache key based on the Request and interval.
 // TODO(yeya24): Add other request params as request key.
 func (t thanosCacheKeyGenerator) GenerateCacheKey(userID string, r queryrange.Request) string {
-	currentInterval := r.GetStart() / t.interval.Milliseconds()
+	interval := t.tenantLimits.splitInterval(userID, t.interval)
+	currentInterval := r.GetStart() / interval.Milliseconds()
+	if interval != t.interval {
+		// Keep results split by an overridden interval apart from the ones split by the default interval.
+		userID = fmt.Sprintf("%s@%s", userID, prommodel.Duration(interval))
+	}
 	switch tr := r.(type) {
 	case *ThanosQueryRangeRequest:
 		i := 0
 		for ; i < len(t.resolutions) && t.resolutions[i] > tr.MaxSourceResolution; i++ {
 		}
-		return fmt.Sprintf("fe:%s:%s:%d:%d:%d", userID, tr.Query, tr.Step, currentInterval, i)
+		key := fmt.Sprintf("fe:%s:%s:%d:%d:%d", userID, tr.Query, tr.Step, currentInterval, i)
+		// Parameters changing the result are only appended when set, which keeps the keys of other requests unchanged.
+		if len(tr.ResultMatchers) > 0 {
+			key += fmt.Sprintf(":%s", tr.ResultMatchers)
+		}
+		if tr.Timezone != "" {
+			key += ":tz=" + tr.Timezone
+		}
+		if tr.EndExclusive {
+			key += ":end_exclusive"
+		}
+		if tr.NaNPolicy != "" {
+			key += ":nan_policy=" + string(tr.NaNPolicy)
+		}
+		return key
 	case *ThanosLabelsRequest:
-		return fmt.Sprintf("fe:%s:%s:%s:%d", userID, tr.Label, tr.Matchers, currentInterval)
+		return fmt.Sprintf("fe:%s:%s:%s:%d%s", userID, tr.Label, tr.Matchers, currentInterval, t.alignedRange(r))
 	case *ThanosSeriesRequest:
-		return fmt.Sprintf("fe:%s:%s:%d", userID, tr.Matchers, currentInterval)
+		return fmt.Sprintf("fe:%s:%s:%d%s", userID, tr.Matchers, currentInterval, t.alignedRange(r))
+	case *ThanosExemplarsRequest:
+		return fmt.Sprintf("fe:%s:%s:%d", userID, tr.Query, currentInterval)
 	}
 	return fmt.Sprintf("fe:%s:%s:%d:%d", userID, r.GetQuery(), r.GetStep(), currentInterval)
 }
+
+// alignedRange returns the range of the request aligned outwards to the alignment, e.g. to the duration of blocks.
+// Labels and series responses can't be narrowed down to a part of their range, so they are only reused for requests
+// covering the same aligned range, which return the same labels at the granularity of blocks.
+func (t thanosCacheKeyGenerator) alignedRange(r queryrange.Request) string {
+	if t.alignment <= 0 {
+		return ""
+	}
+	alignment := t.alignment.Milliseconds()
+	start := r.GetStart() / alignment
+	end := (r.GetEnd() + alignment - 1) / alignment
+	return fmt.Sprintf(":%d:%d", start, end)
+}
+
+type cacheHitCtxKey struct{}
+
+// cacheHitsMiddlewares returns middlewares counting the requests which were entirely served by the results cache placed
+// between them: the first one counts the requests to the cache and the second one marks those reaching the downstream.
+func cacheHitsMiddlewares(requests, hits prometheus.Counter) (queryrange.Middleware, queryrange.Middleware) {
+	outer := queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			missed := atomic.NewBool(false)
+			resp, err := next.Do(context.WithValue(ctx, cacheHitCtxKey{}, missed), r)
+			requests.Inc()
+			if err == nil && !missed.Load() {
+				hits.Inc()
+			}
+			return resp, err
+		})
+	})
+	inner := queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			if missed, ok := ctx.Value(cacheHitCtxKey{}).(*atomic.Bool); ok {
+				missed.Store(true)
+			}
+			return next.Do(ctx, r)
+		})
+	})
+	return outer, inner
+}
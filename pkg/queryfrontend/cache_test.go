@@ -5,15 +5,18 @@ package queryfrontend
 
 import (
 	"testing"
+	"time"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 
+	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
 func TestGenerateCacheKey(t *testing.T) {
-	splitter := newThanosCacheKeyGenerator(hour)
+	splitter := newThanosCacheKeyGenerator(hour, nil)
 
 	for _, tc := range []struct {
 		name     string
@@ -77,6 +80,46 @@ func TestGenerateCacheKey(t *testing.T) {
 			},
 			expected: "fe::up:10000:0:0",
 		},
+		{
+			name: "result matchers, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:          "up",
+				Start:          0,
+				Step:           60 * seconds,
+				ResultMatchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "job", "a")}},
+			},
+			expected: `fe::up:60000:0:2:[[job="a"]]`,
+		},
+		{
+			name: "timezone, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:    "day_of_week()",
+				Start:    0,
+				Step:     60 * seconds,
+				Timezone: "Europe/Paris",
+			},
+			expected: "fe::day_of_week():60000:0:2:tz=Europe/Paris",
+		},
+		{
+			name: "exclusive end, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:        "up",
+				Start:        0,
+				Step:         60 * seconds,
+				EndExclusive: true,
+			},
+			expected: "fe::up:60000:0:2:end_exclusive",
+		},
+		{
+			name: "NaN policy, different cache key",
+			req: &ThanosQueryRangeRequest{
+				Query:     "up",
+				Start:     0,
+				Step:      60 * seconds,
+				NaNPolicy: query.NaNPolicyDrop,
+			},
+			expected: "fe::up:60000:0:2:nan_policy=drop",
+		},
 		{
 			name: "label names, no matcher",
 			req: &ThanosLabelsRequest{
@@ -137,3 +180,33 @@ func TestGenerateCacheKey(t *testing.T) {
 		testutil.Equals(t, tc.expected, key)
 	}
 }
+
+func TestGenerateCacheKey_TenantSplitInterval(t *testing.T) {
+	splitter := newThanosCacheKeyGenerator(day, &TenantLimitsConfig{
+		Tenants: map[string]TenantLimits{"a": {SplitQueriesByInterval: model.Duration(time.Hour)}},
+	})
+	req := &ThanosQueryRangeRequest{
+		Query: "up",
+		Start: 2 * hour,
+		Step:  60 * seconds,
+	}
+
+	testutil.Equals(t, "fe:a@1h:up:60000:2:2", splitter.GenerateCacheKey("a", req))
+	testutil.Equals(t, "fe:b:up:60000:0:2", splitter.GenerateCacheKey("b", req))
+}
+
+func TestGenerateCacheKey_Alignment(t *testing.T) {
+	splitter := newThanosCacheKeyGenerator(day, nil)
+	splitter.alignment = 2 * time.Hour
+
+	req := func(start, end int64) *ThanosLabelsRequest {
+		return &ThanosLabelsRequest{Label: "foo", Start: start, End: end}
+	}
+	testutil.Equals(t, "fe::foo:[]:0:0:1", splitter.GenerateCacheKey("", req(0, 2*hour)))
+	testutil.Equals(t, "fe::foo:[]:0:0:1", splitter.GenerateCacheKey("", req(hour, hour+1)))
+	testutil.Equals(t, "fe::foo:[]:0:0:2", splitter.GenerateCacheKey("", req(hour, 3*hour)))
+	testutil.Equals(t, "fe::[]:0:1:2", splitter.GenerateCacheKey("", &ThanosSeriesRequest{Start: 2 * hour, End: 3 * hour}))
+
+	// Range requests are not aligned.
+	testutil.Equals(t, "fe::up:60000:0:2", splitter.GenerateCacheKey("", &ThanosQueryRangeRequest{Query: "up", Start: 0, End: 3 * hour, Step: 60 * seconds}))
+}
@@ -196,6 +196,7 @@ type DownstreamTripperConfig struct {
 type Config struct {
 	QueryRangeConfig
 	LabelsConfig
+	ExemplarsConfig
 	DownstreamTripperConfig
 
 	CortexHandlerConfig    *transport.HandlerConfig
@@ -220,6 +221,10 @@ type QueryRangeConfig struct {
 	SplitQueriesByInterval time.Duration
 	MaxRetries             int
 	Limits                 *cortexvalidation.Limits
+
+	// TenantLimits overrides limits of specific tenants, if set.
+	TenantLimits              *TenantLimitsConfig
+	TenantLimitsPathOrContent extflag.PathOrContent
 }
 
 // LabelsConfig holds the config for labels tripperware.
@@ -229,6 +234,21 @@ type LabelsConfig struct {
 	PartialResponseStrategy bool
 	DefaultTimeRange        time.Duration
 
+	ResultsCacheConfig *queryrange.ResultsCacheConfig
+	CachePathOrContent extflag.PathOrContent
+	// CacheAlignment is the duration the range of requests is aligned to when caching their responses.
+	CacheAlignment time.Duration
+
+	SplitQueriesByInterval time.Duration
+	MaxRetries             int
+
+	Limits *cortexvalidation.Limits
+}
+
+// ExemplarsConfig holds the config for exemplars tripperware.
+type ExemplarsConfig struct {
+	DefaultTimeRange time.Duration
+
 	ResultsCacheConfig *queryrange.ResultsCacheConfig
 	CachePathOrContent extflag.PathOrContent
 
@@ -258,6 +278,15 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.ExemplarsConfig.ResultsCacheConfig != nil {
+		if cfg.ExemplarsConfig.SplitQueriesByInterval <= 0 {
+			return errors.New("split queries interval should be greater than 0 when caching is enabled")
+		}
+		if err := cfg.ExemplarsConfig.ResultsCacheConfig.Validate(); err != nil {
+			return errors.Wrap(err, "invalid ResultsCache config for exemplars tripperware")
+		}
+	}
+
 	if cfg.LabelsConfig.DefaultTimeRange == 0 {
 		return errors.New("labels.default-time-range cannot be set to 0")
 	}
@@ -0,0 +1,205 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+)
+
+// exemplarsCodec is used to encode/decode Thanos exemplars requests and responses.
+type exemplarsCodec struct {
+	queryrange.Codec
+	defaultTimeRange time.Duration
+}
+
+// NewThanosExemplarsCodec initializes an exemplarsCodec.
+func NewThanosExemplarsCodec(defaultTimeRange time.Duration) *exemplarsCodec {
+	return &exemplarsCodec{
+		Codec:            queryrange.PrometheusCodec,
+		defaultTimeRange: defaultTimeRange,
+	}
+}
+
+// MergeResponse merges multiple responses into a single Response. Exemplars of the same series are merged together,
+// keeping a single exemplar per timestamp, and the series labels are left as they were returned.
+func (c exemplarsCodec) MergeResponse(responses ...queryrange.Response) (queryrange.Response, error) {
+	if len(responses) == 0 {
+		return &ThanosExemplarsResponse{
+			Status: queryrange.StatusSuccess,
+			Data:   []*exemplarspb.ExemplarData{},
+		}, nil
+	}
+
+	var (
+		data       = make([]*exemplarspb.ExemplarData, 0)
+		series     = make(map[string]*exemplarspb.ExemplarData)
+		timestamps = make(map[string]map[int64]struct{})
+	)
+	for _, res := range responses {
+		resp, ok := res.(*ThanosExemplarsResponse)
+		if !ok {
+			return nil, httpgrpc.Errorf(http.StatusInternalServerError, "invalid response format")
+		}
+		for _, d := range resp.Data {
+			key := d.SeriesLabels.PromLabels().String()
+			s, ok := series[key]
+			if !ok {
+				s = &exemplarspb.ExemplarData{SeriesLabels: d.SeriesLabels}
+				series[key] = s
+				timestamps[key] = make(map[int64]struct{})
+				data = append(data, s)
+			}
+			for _, e := range d.Exemplars {
+				if _, ok := timestamps[key][e.Ts]; ok {
+					continue
+				}
+				timestamps[key][e.Ts] = struct{}{}
+				s.Exemplars = append(s.Exemplars, e)
+			}
+		}
+	}
+
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Compare(data[j]) < 0
+	})
+	for _, d := range data {
+		sort.Slice(d.Exemplars, func(i, j int) bool {
+			return d.Exemplars[i].Ts < d.Exemplars[j].Ts
+		})
+	}
+	return &ThanosExemplarsResponse{
+		Status: queryrange.StatusSuccess,
+		Data:   data,
+	}, nil
+}
+
+func (c exemplarsCodec) DecodeRequest(_ context.Context, r *http.Request, forwardHeaders []string) (queryrange.Request, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	var (
+		result ThanosExemplarsRequest
+		err    error
+	)
+	result.Start, result.End, err = parseMetadataTimeRange(r, c.defaultTimeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Query = r.FormValue("query")
+	result.Path = r.URL.Path
+
+	for _, value := range r.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			result.CachingOptions.Disabled = true
+			break
+		}
+	}
+
+	// Include the specified headers from http request in prometheusRequest.
+	for _, header := range forwardHeaders {
+		for h, hv := range r.Header {
+			if strings.EqualFold(h, header) {
+				result.Headers = append(result.Headers, &RequestHeader{Name: h, Values: hv})
+				break
+			}
+		}
+	}
+
+	return &result, nil
+}
+
+func (c exemplarsCodec) EncodeRequest(ctx context.Context, r queryrange.Request) (*http.Request, error) {
+	thanosReq, ok := r.(*ThanosExemplarsRequest)
+	if !ok {
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "invalid request format")
+	}
+
+	var params = url.Values{
+		"start": []string{encodeTime(thanosReq.Start)},
+		"end":   []string{encodeTime(thanosReq.End)},
+		"query": []string{thanosReq.Query},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, hv := range thanosReq.Headers {
+		for _, v := range hv.Values {
+			req.Header.Add(hv.Name, v)
+		}
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func (c exemplarsCodec) DecodeResponse(ctx context.Context, r *http.Response, _ queryrange.Request) (queryrange.Response, error) {
+	if r.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(r.Body)
+		return nil, httpgrpc.Errorf(r.StatusCode, string(body))
+	}
+	log, _ := spanlogger.New(ctx, "ParseQueryResponse") //nolint:ineffassign,staticcheck
+	defer log.Finish()
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err) //nolint:errcheck
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "error decoding response: %v", err)
+	}
+
+	log.LogFields(otlog.Int("bytes", len(buf)))
+
+	var resp ThanosExemplarsResponse
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "error decoding response: %v", err)
+	}
+	for h, hv := range r.Header {
+		resp.Headers = append(resp.Headers, &ResponseHeader{Name: h, Values: hv})
+	}
+	return &resp, nil
+}
+
+func (c exemplarsCodec) EncodeResponse(ctx context.Context, res queryrange.Response) (*http.Response, error) {
+	sp, _ := opentracing.StartSpanFromContext(ctx, "APIResponse.ToHTTPResponse")
+	defer sp.Finish()
+
+	resp, ok := res.(*ThanosExemplarsResponse)
+	if !ok {
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "invalid response format")
+	}
+
+	sp.LogFields(otlog.Int("series", len(resp.Data)))
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "error encoding response: %v", err)
+	}
+
+	sp.LogFields(otlog.Int("bytes", len(b)))
+	return &http.Response{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body:       ioutil.NopCloser(bytes.NewBuffer(b)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
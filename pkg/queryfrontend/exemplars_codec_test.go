@@ -0,0 +1,100 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestExemplarsCodec_MergeResponse(t *testing.T) {
+	var (
+		seriesA = labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}}}
+		seriesB = labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "b"}}}
+		traceA  = labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "a"}}}
+		traceB  = labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "b"}}}
+	)
+
+	for _, tc := range []struct {
+		name             string
+		expectedError    error
+		responses        []queryrange.Response
+		expectedResponse queryrange.Response
+	}{
+		{
+			name: "Prometheus range query response format, not valid",
+			responses: []queryrange.Response{
+				&queryrange.PrometheusResponse{Status: "success"},
+			},
+			expectedError: httpgrpc.Errorf(http.StatusInternalServerError, "invalid response format"),
+		},
+		{
+			name:             "Empty response",
+			responses:        nil,
+			expectedResponse: &ThanosExemplarsResponse{Status: queryrange.StatusSuccess, Data: []*exemplarspb.ExemplarData{}},
+		},
+		{
+			name: "Exemplars of the same series are merged and sorted",
+			responses: []queryrange.Response{
+				&ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+					{SeriesLabels: seriesB, Exemplars: []*exemplarspb.Exemplar{{Labels: traceB, Value: 2, Ts: 20}}},
+					{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceA, Value: 1, Ts: 10}}},
+				}},
+				&ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{}},
+				&ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+					{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceB, Value: 3, Ts: 5}}},
+				}},
+			},
+			expectedResponse: &ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+				{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceB, Value: 3, Ts: 5}, {Labels: traceA, Value: 1, Ts: 10}}},
+				{SeriesLabels: seriesB, Exemplars: []*exemplarspb.Exemplar{{Labels: traceB, Value: 2, Ts: 20}}},
+			}},
+		},
+		{
+			name: "Exemplars on identical timestamps are deduplicated",
+			responses: []queryrange.Response{
+				&ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+					{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceA, Value: 1, Ts: 10}}},
+				}},
+				&ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+					{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceA, Value: 1, Ts: 10}, {Labels: traceA, Value: 1, Ts: 15}}},
+				}},
+			},
+			expectedResponse: &ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+				{SeriesLabels: seriesA, Exemplars: []*exemplarspb.Exemplar{{Labels: traceA, Value: 1, Ts: 10}, {Labels: traceA, Value: 1, Ts: 15}}},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := NewThanosExemplarsCodec(0).MergeResponse(tc.responses...)
+			if tc.expectedError != nil {
+				testutil.Equals(t, tc.expectedError, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expectedResponse, resp)
+		})
+	}
+}
+
+func TestThanosResponseExtractor_Exemplars(t *testing.T) {
+	series := labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}}}
+	resp := &ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+		{SeriesLabels: series, Exemplars: []*exemplarspb.Exemplar{{Value: 1, Ts: 10}, {Value: 2, Ts: 20}}},
+	}}
+
+	testutil.Equals(t, &ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{
+		{SeriesLabels: series, Exemplars: []*exemplarspb.Exemplar{{Value: 2, Ts: 20}}},
+	}}, ThanosResponseExtractor{}.Extract(15, 30, resp))
+	testutil.Equals(t, &ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{}}, ThanosResponseExtractor{}.Extract(30, 40, resp))
+	// The extracted response doesn't modify the original one.
+	testutil.Equals(t, 2, len(resp.Data[0].Exemplars))
+}
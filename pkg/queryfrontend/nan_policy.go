@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/prometheus/common/model"
+
+	"github.com/thanos-io/thanos/pkg/query"
+)
+
+// NullNaNMiddleware creates a new Middleware serving range queries with the null NaN policy. Responses with null
+// sample values can't be decoded, so they are queried with NaN samples preserved, which are encoded as null in the
+// response to the original request.
+func NullNaNMiddleware() queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		return queryrange.HandlerFunc(func(ctx context.Context, req queryrange.Request) (queryrange.Response, error) {
+			tqrr, ok := req.(*ThanosQueryRangeRequest)
+			if !ok || tqrr.NaNPolicy != query.NaNPolicyNull {
+				return next.Do(ctx, req)
+			}
+
+			r := *tqrr
+			r.NaNPolicy = ""
+			resp, err := next.Do(ctx, &r)
+			if err != nil {
+				return nil, err
+			}
+			if promResp, ok := resp.(*queryrange.PrometheusResponse); ok {
+				return &nullNaNResponse{PrometheusResponse: promResp}, nil
+			}
+			return resp, nil
+		})
+	})
+}
+
+// nullNaNResponse is a range query response encoded with null values for NaN samples.
+type nullNaNResponse struct {
+	*queryrange.PrometheusResponse
+}
+
+func (r *nullNaNResponse) MarshalJSON() ([]byte, error) {
+	type stream struct {
+		Metric model.Metric    `json:"metric"`
+		Values []nullNaNSample `json:"values"`
+	}
+	var res struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string   `json:"resultType"`
+			Result     []stream `json:"result"`
+		} `json:"data,omitempty"`
+		ErrorType string `json:"errorType,omitempty"`
+		Error     string `json:"error,omitempty"`
+	}
+	res.Status, res.ErrorType, res.Error = r.Status, r.ErrorType, r.Error
+	res.Data.ResultType = r.Data.ResultType
+	res.Data.Result = make([]stream, 0, len(r.Data.Result))
+	for _, s := range r.Data.Result {
+		values := make([]nullNaNSample, 0, len(s.Samples))
+		for _, sample := range s.Samples {
+			values = append(values, nullNaNSample(sample))
+		}
+		res.Data.Result = append(res.Data.Result, stream{Metric: cortexpb.FromLabelAdaptersToMetric(s.Labels), Values: values})
+	}
+	return json.Marshal(res)
+}
+
+// nullNaNSample is a sample encoded with a null value if it's NaN.
+type nullNaNSample cortexpb.Sample
+
+func (s nullNaNSample) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(s.Value) {
+		return json.Marshal([...]interface{}{model.Time(s.TimestampMs), nil})
+	}
+	return json.Marshal([...]interface{}{model.Time(s.TimestampMs), model.SampleValue(s.Value)})
+}
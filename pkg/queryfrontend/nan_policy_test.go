@@ -0,0 +1,59 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+
+	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestNullNaNMiddleware(t *testing.T) {
+	downstream := queryrange.HandlerFunc(func(_ context.Context, r queryrange.Request) (queryrange.Response, error) {
+		// NaN samples are queried as preserved, as null values can't be decoded.
+		testutil.Equals(t, query.NaNPolicy(""), r.(*ThanosQueryRangeRequest).NaNPolicy)
+		return &queryrange.PrometheusResponse{
+			Status: queryrange.StatusSuccess,
+			Data: queryrange.PrometheusData{
+				ResultType: "matrix",
+				Result: []queryrange.SampleStream{{
+					Labels:  []cortexpb.LabelAdapter{{Name: "foo", Value: "bar"}},
+					Samples: []cortexpb.Sample{{TimestampMs: 1000, Value: 1}, {TimestampMs: 2000, Value: math.NaN()}},
+				}},
+			},
+		}, nil
+	})
+	codec := NewThanosQueryRangeCodec(false)
+
+	for _, tc := range []struct {
+		policy   query.NaNPolicy
+		expected string
+	}{
+		{
+			expected: `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"foo":"bar"},"values":[[1,"1"],[2,"NaN"]]}]}}`,
+		},
+		{
+			policy:   query.NaNPolicyNull,
+			expected: `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"foo":"bar"},"values":[[1,"1"],[2,null]]}]}}`,
+		},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			resp, err := NullNaNMiddleware().Wrap(downstream).Do(context.Background(), &ThanosQueryRangeRequest{NaNPolicy: tc.policy})
+			testutil.Ok(t, err)
+
+			httpResp, err := codec.EncodeResponse(context.Background(), resp)
+			testutil.Ok(t, err)
+			b, err := ioutil.ReadAll(httpResp.Body)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, string(b))
+		})
+	}
+}
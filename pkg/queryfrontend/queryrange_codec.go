@@ -6,6 +6,8 @@ package queryfrontend
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"net/url"
@@ -15,12 +17,15 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
 	cortexutil "github.com/cortexproject/cortex/pkg/util"
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/weaveworks/common/httpgrpc"
 
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
+	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 )
 
@@ -116,9 +121,41 @@ func (c queryRangeCodec) DecodeRequest(_ context.Context, r *http.Request, forwa
 		return nil, err
 	}
 
+	if len(r.Form[queryv1.ResultMatcherParam]) > 0 {
+		result.ResultMatchers, err = parseMatchersParam(r.Form, queryv1.ResultMatcherParam)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Timezone = r.FormValue(queryv1.TimezoneParam)
+	if result.Timezone != "" {
+		if _, err := time.LoadLocation(result.Timezone); err != nil {
+			return nil, httpgrpc.Errorf(http.StatusBadRequest, errCannotParse, queryv1.TimezoneParam)
+		}
+	}
+
+	result.NoCache, err = parseNoCacheParam(r.FormValue(queryv1.NoCacheParam))
+	if err != nil {
+		return nil, err
+	}
+
+	endInclusive, err := parseEndInclusiveParam(r.FormValue(queryv1.EndInclusiveParam))
+	if err != nil {
+		return nil, err
+	}
+	result.EndExclusive = !endInclusive
+
+	result.NaNPolicy, err = parseNaNPolicyParam(r.FormValue(queryv1.NaNPolicyParam))
+	if err != nil {
+		return nil, err
+	}
+
 	result.Query = r.FormValue("query")
 	result.Path = r.URL.Path
 
+	// Requests bypassing the caches of stores bypass the results cache too.
+	result.CachingOptions.Disabled = result.NoCache
 	for _, value := range r.Header.Values(cacheControlHeader) {
 		if strings.Contains(value, noStoreValue) {
 			result.CachingOptions.Disabled = true
@@ -164,6 +201,26 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 		params[queryv1.StoreMatcherParam] = matchersToStringSlice(thanosReq.StoreMatchers)
 	}
 
+	if len(thanosReq.ResultMatchers) > 0 {
+		params[queryv1.ResultMatcherParam] = matchersToStringSlice(thanosReq.ResultMatchers)
+	}
+
+	if thanosReq.Timezone != "" {
+		params[queryv1.TimezoneParam] = []string{thanosReq.Timezone}
+	}
+
+	if thanosReq.NoCache {
+		params[queryv1.NoCacheParam] = []string{"true"}
+	}
+
+	if thanosReq.EndExclusive {
+		params[queryv1.EndInclusiveParam] = []string{"false"}
+	}
+
+	if thanosReq.NaNPolicy != "" {
+		params[queryv1.NaNPolicyParam] = []string{string(thanosReq.NaNPolicy)}
+	}
+
 	req, err := http.NewRequest(http.MethodPost, thanosReq.Path, bytes.NewBufferString(params.Encode()))
 	if err != nil {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, "error creating request: %s", err.Error())
@@ -177,6 +234,32 @@ func (c queryRangeCodec) EncodeRequest(ctx context.Context, r queryrange.Request
 	return req.WithContext(ctx), nil
 }
 
+func (c queryRangeCodec) EncodeResponse(ctx context.Context, res queryrange.Response) (*http.Response, error) {
+	resp, ok := res.(*nullNaNResponse)
+	if !ok {
+		return c.Codec.EncodeResponse(ctx, res)
+	}
+
+	sp, _ := opentracing.StartSpanFromContext(ctx, "APIResponse.ToHTTPResponse")
+	defer sp.Finish()
+	sp.LogFields(otlog.Int("series", len(resp.Data.Result)))
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusInternalServerError, "error encoding response: %v", err)
+	}
+
+	sp.LogFields(otlog.Int("bytes", len(b)))
+	return &http.Response{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body:          ioutil.NopCloser(bytes.NewBuffer(b)),
+		StatusCode:    http.StatusOK,
+		ContentLength: int64(len(b)),
+	}, nil
+}
+
 func parseDurationMillis(s string) (int64, error) {
 	if d, err := strconv.ParseFloat(s, 64); err == nil {
 		ts := d * float64(time.Second/time.Millisecond)
@@ -233,6 +316,40 @@ func parsePartialResponseParam(s string, defaultEnablePartialResponse bool) (boo
 	return defaultEnablePartialResponse, nil
 }
 
+func parseNoCacheParam(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	noCache, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, httpgrpc.Errorf(http.StatusBadRequest, errCannotParse, queryv1.NoCacheParam)
+	}
+	return noCache, nil
+}
+
+func parseEndInclusiveParam(s string) (bool, error) {
+	if s == "" {
+		return true, nil
+	}
+	endInclusive, err := strconv.ParseBool(s)
+	if err != nil {
+		return true, httpgrpc.Errorf(http.StatusBadRequest, errCannotParse, queryv1.EndInclusiveParam)
+	}
+	return endInclusive, nil
+}
+
+// parseNaNPolicyParam parses the NaN policy, returning an empty one for the default policy preserving NaN samples.
+func parseNaNPolicyParam(s string) (query.NaNPolicy, error) {
+	policy, err := query.ParseNaNPolicy(s)
+	if err != nil {
+		return "", httpgrpc.Errorf(http.StatusBadRequest, errCannotParse, queryv1.NaNPolicyParam)
+	}
+	if policy == query.NaNPolicyPreserve {
+		return "", nil
+	}
+	return policy, nil
+}
+
 func parseMatchersParam(ss url.Values, matcherParam string) ([][]*labels.Matcher, error) {
 	matchers := make([][]*labels.Matcher, 0, len(ss[matcherParam]))
 	for _, s := range ss[matcherParam] {
@@ -15,6 +15,7 @@ import (
 
 	queryv1 "github.com/thanos-io/thanos/pkg/api/query"
 	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -166,6 +167,120 @@ func TestQueryRangeCodec_DecodeRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:            "resultMatchers",
+			url:             `/api/v1/query_range?start=123&end=456&step=1&result_match[]={job="a"}`,
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:           "/api/v1/query_range",
+				Start:          123000,
+				End:            456000,
+				Step:           1000,
+				Dedup:          true,
+				StoreMatchers:  [][]*labels.Matcher{},
+				ResultMatchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "job", "a")}},
+			},
+		},
+		{
+			name:            "cannot parse resultMatchers",
+			url:             `/api/v1/query_range?start=123&end=456&step=1&result_match[]={job=}`,
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter result_match[]"),
+		},
+		{
+			name:            "timezone",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&timezone=Europe/Paris",
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StoreMatchers: [][]*labels.Matcher{},
+				Timezone:      "Europe/Paris",
+			},
+		},
+		{
+			name:            "cannot parse timezone",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&timezone=Nowhere/Somewhere",
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter timezone"),
+		},
+		{
+			name:            "no_cache disables the results cache",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&no_cache=true",
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:           "/api/v1/query_range",
+				Start:          123000,
+				End:            456000,
+				Step:           1000,
+				Dedup:          true,
+				StoreMatchers:  [][]*labels.Matcher{},
+				NoCache:        true,
+				CachingOptions: queryrange.CachingOptions{Disabled: true},
+			},
+		},
+		{
+			name:            "cannot parse no_cache",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&no_cache=baz",
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter no_cache"),
+		},
+		{
+			name:            "end_inclusive set to false",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&end_inclusive=false",
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StoreMatchers: [][]*labels.Matcher{},
+				EndExclusive:  true,
+			},
+		},
+		{
+			name:            "cannot parse end_inclusive",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&end_inclusive=baz",
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter end_inclusive"),
+		},
+		{
+			name:            "nan_policy set to drop",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&nan_policy=drop",
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StoreMatchers: [][]*labels.Matcher{},
+				NaNPolicy:     query.NaNPolicyDrop,
+			},
+		},
+		{
+			name:            "nan_policy set to preserve, the default",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&nan_policy=preserve",
+			partialResponse: false,
+			expectedRequest: &ThanosQueryRangeRequest{
+				Path:          "/api/v1/query_range",
+				Start:         123000,
+				End:           456000,
+				Step:          1000,
+				Dedup:         true,
+				StoreMatchers: [][]*labels.Matcher{},
+			},
+		},
+		{
+			name:            "cannot parse nan_policy",
+			url:             "/api/v1/query_range?start=123&end=456&step=1&nan_policy=baz",
+			partialResponse: false,
+			expectedError:   httpgrpc.Errorf(http.StatusBadRequest, "cannot parse parameter nan_policy"),
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			r, err := http.NewRequest(http.MethodGet, tc.url, nil)
@@ -268,6 +383,81 @@ func TestQueryRangeCodec_EncodeRequest(t *testing.T) {
 					r.FormValue(queryv1.MaxSourceResolutionParam) == "3600"
 			},
 		},
+		{
+			name: "Result matchers set",
+			req: &ThanosQueryRangeRequest{
+				Start:          123000,
+				End:            456000,
+				Step:           1000,
+				ResultMatchers: [][]*labels.Matcher{{labels.MustNewMatcher(labels.MatchEqual, "job", "a")}},
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.ResultMatcherParam) == `{job="a"}`
+			},
+		},
+		{
+			name: "Timezone set",
+			req: &ThanosQueryRangeRequest{
+				Start:    123000,
+				End:      456000,
+				Step:     1000,
+				Timezone: "Europe/Paris",
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.TimezoneParam) == "Europe/Paris"
+			},
+		},
+		{
+			name: "No cache set",
+			req: &ThanosQueryRangeRequest{
+				Start:   123000,
+				End:     456000,
+				Step:    1000,
+				NoCache: true,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.NoCacheParam) == "true"
+			},
+		},
+		{
+			name: "Exclusive end set",
+			req: &ThanosQueryRangeRequest{
+				Start:        123000,
+				End:          456000,
+				Step:         1000,
+				EndExclusive: true,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.EndInclusiveParam) == "false"
+			},
+		},
+		{
+			name: "NaN policy set",
+			req: &ThanosQueryRangeRequest{
+				Start:     123000,
+				End:       456000,
+				Step:      1000,
+				NaNPolicy: query.NaNPolicyDrop,
+			},
+			checkFunc: func(r *http.Request) bool {
+				return r.FormValue("start") == "123" &&
+					r.FormValue("end") == "456" &&
+					r.FormValue("step") == "1" &&
+					r.FormValue(queryv1.NaNPolicyParam) == "drop"
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			// Default partial response value doesn't matter when encoding requests.
@@ -283,6 +473,14 @@ func TestQueryRangeCodec_EncodeRequest(t *testing.T) {
 	}
 }
 
+func TestQueryRangeRequest_WithStartEnd_EndExclusive(t *testing.T) {
+	req := &ThanosQueryRangeRequest{Start: 0, End: 2 * hour, Step: 60 * seconds, EndExclusive: true}
+
+	// Only the request ending on the original end drops its last evaluation point.
+	testutil.Equals(t, false, req.WithStartEnd(0, hour-60*seconds).(*ThanosQueryRangeRequest).EndExclusive)
+	testutil.Equals(t, true, req.WithStartEnd(hour, 2*hour).(*ThanosQueryRangeRequest).EndExclusive)
+}
+
 func BenchmarkQueryRangeCodecEncodeAndDecodeRequest(b *testing.B) {
 	codec := NewThanosQueryRangeCodec(true)
 	ctx := context.TODO()
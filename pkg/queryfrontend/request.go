@@ -11,6 +11,8 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
+
+	"github.com/thanos-io/thanos/pkg/query"
 )
 
 // ThanosRequestStoreMatcherGetter is a an interface for store matching that all request share.
@@ -42,6 +44,11 @@ type ThanosQueryRangeRequest struct {
 	MaxSourceResolution int64
 	ReplicaLabels       []string
 	StoreMatchers       [][]*labels.Matcher
+	ResultMatchers      [][]*labels.Matcher
+	Timezone            string
+	NoCache             bool
+	EndExclusive        bool
+	NaNPolicy           query.NaNPolicy
 	CachingOptions      queryrange.CachingOptions
 	Headers             []*RequestHeader
 }
@@ -73,6 +80,11 @@ func (r *ThanosQueryRangeRequest) WithStartEnd(start, end int64) queryrange.Requ
 	q := *r
 	q.Start = start
 	q.End = end
+	// Only the evaluation point on the end of the original request is dropped, so requests
+	// for a part of its range ending before it include their end.
+	if end != r.End {
+		q.EndExclusive = false
+	}
 	return &q
 }
 
@@ -94,6 +106,11 @@ func (r *ThanosQueryRangeRequest) LogToSpan(sp opentracing.Span) {
 		otlog.Bool("partial_response", r.PartialResponse),
 		otlog.Object("replicaLabels", r.ReplicaLabels),
 		otlog.Object("storeMatchers", r.StoreMatchers),
+		otlog.Object("resultMatchers", r.ResultMatchers),
+		otlog.String("timezone", r.Timezone),
+		otlog.Bool("no_cache", r.NoCache),
+		otlog.Bool("end_exclusive", r.EndExclusive),
+		otlog.String("nan_policy", string(r.NaNPolicy)),
 		otlog.Bool("auto-downsampling", r.AutoDownsampling),
 		otlog.Int64("max_source_resolution (ms)", r.MaxSourceResolution),
 	}
@@ -259,3 +276,68 @@ func (r *ThanosSeriesRequest) String() string { return "" }
 // ProtoMessage implements proto.Message interface required by queryrange.Request,
 // which is not used in thanos.
 func (r *ThanosSeriesRequest) ProtoMessage() {}
+
+type ThanosExemplarsRequest struct {
+	Path           string
+	Start          int64
+	End            int64
+	Query          string
+	CachingOptions queryrange.CachingOptions
+	Headers        []*RequestHeader
+}
+
+// GetStart returns the start timestamp of the request in milliseconds.
+func (r *ThanosExemplarsRequest) GetStart() int64 { return r.Start }
+
+// GetEnd returns the end timestamp of the request in milliseconds.
+func (r *ThanosExemplarsRequest) GetEnd() int64 { return r.End }
+
+// GetStep returns the step of the request in milliseconds. Returns 1 so that the request is split like a range query
+// with the finest step, and to avoid panic in
+// https://github.com/cortexproject/cortex/blob/master/pkg/querier/queryrange/results_cache.go#L447.
+func (r *ThanosExemplarsRequest) GetStep() int64 { return 1 }
+
+// GetQuery returns the query of the request.
+func (r *ThanosExemplarsRequest) GetQuery() string { return r.Query }
+
+func (r *ThanosExemplarsRequest) GetCachingOptions() queryrange.CachingOptions {
+	return r.CachingOptions
+}
+
+// WithStartEnd clone the current request with different start and end timestamp.
+func (r *ThanosExemplarsRequest) WithStartEnd(start, end int64) queryrange.Request {
+	q := *r
+	q.Start = start
+	q.End = end
+	return &q
+}
+
+// WithQuery clone the current request with a different query.
+func (r *ThanosExemplarsRequest) WithQuery(query string) queryrange.Request {
+	q := *r
+	q.Query = query
+	return &q
+}
+
+// LogToSpan writes information about this request to an OpenTracing span.
+func (r *ThanosExemplarsRequest) LogToSpan(sp opentracing.Span) {
+	fields := []otlog.Field{
+		otlog.String("query", r.GetQuery()),
+		otlog.String("start", timestamp.Time(r.GetStart()).String()),
+		otlog.String("end", timestamp.Time(r.GetEnd()).String()),
+	}
+
+	sp.LogFields(fields...)
+}
+
+// Reset implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosExemplarsRequest) Reset() {}
+
+// String implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosExemplarsRequest) String() string { return "" }
+
+// ProtoMessage implements proto.Message interface required by queryrange.Request,
+// which is not used in thanos.
+func (r *ThanosExemplarsRequest) ProtoMessage() {}
@@ -7,17 +7,39 @@ import (
 	"unsafe"
 
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 )
 
 // ThanosResponseExtractor helps extracting specific info from Query Response.
 type ThanosResponseExtractor struct{}
 
 // Extract extracts response for specific a range from a response.
-// This interface is not used for labels and series responses.
-func (ThanosResponseExtractor) Extract(_, _ int64, resp queryrange.Response) queryrange.Response {
+// Labels and series responses can't be narrowed down to a part of their range, so they are returned as they are.
+func (ThanosResponseExtractor) Extract(start, end int64, resp queryrange.Response) queryrange.Response {
+	if tr, ok := resp.(*ThanosExemplarsResponse); ok {
+		return &ThanosExemplarsResponse{Status: queryrange.StatusSuccess, Data: extractExemplars(start, end, tr.Data), Headers: tr.Headers}
+	}
 	return resp
 }
 
+// extractExemplars returns the exemplars within [start, end], leaving out series without any. Given data isn't modified.
+func extractExemplars(start, end int64, data []*exemplarspb.ExemplarData) []*exemplarspb.ExemplarData {
+	res := make([]*exemplarspb.ExemplarData, 0, len(data))
+	for _, d := range data {
+		var exemplars []*exemplarspb.Exemplar
+		for _, e := range d.Exemplars {
+			if e.Ts >= start && e.Ts <= end {
+				exemplars = append(exemplars, e)
+			}
+		}
+		if len(exemplars) > 0 {
+			res = append(res, &exemplarspb.ExemplarData{SeriesLabels: d.SeriesLabels, Exemplars: exemplars})
+		}
+	}
+	return res
+}
+
 // ResponseWithoutHeaders returns the response without HTTP headers.
 func (ThanosResponseExtractor) ResponseWithoutHeaders(resp queryrange.Response) queryrange.Response {
 	switch tr := resp.(type) {
@@ -25,6 +47,9 @@ func (ThanosResponseExtractor) ResponseWithoutHeaders(resp queryrange.Response)
 		return &ThanosLabelsResponse{Status: queryrange.StatusSuccess, Data: tr.Data}
 	case *ThanosSeriesResponse:
 		return &ThanosSeriesResponse{Status: queryrange.StatusSuccess, Data: tr.Data}
+	case *ThanosExemplarsResponse:
+		// Responses without exemplars are cached as well, marking their range as empty so that it isn't requested again.
+		return &ThanosExemplarsResponse{Status: queryrange.StatusSuccess, Data: tr.Data}
 	}
 	return resp
 }
@@ -44,3 +69,8 @@ func (m *ThanosLabelsResponse) GetHeaders() []*queryrange.PrometheusResponseHead
 func (m *ThanosSeriesResponse) GetHeaders() []*queryrange.PrometheusResponseHeader {
 	return headersToQueryRangeHeaders(m.Headers)
 }
+
+// GetHeaders returns the HTTP headers in the response.
+func (m *ThanosExemplarsResponse) GetHeaders() []*queryrange.PrometheusResponseHeader {
+	return headersToQueryRangeHeaders(m.Headers)
+}
@@ -11,6 +11,7 @@ import (
 
 	_ "github.com/gogo/protobuf/gogoproto"
 	proto "github.com/gogo/protobuf/proto"
+	exemplarspb "github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	labelpb "github.com/thanos-io/thanos/pkg/store/labelpb"
 )
 
@@ -107,6 +108,47 @@ func (m *ThanosSeriesResponse) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_ThanosSeriesResponse proto.InternalMessageInfo
 
+type ThanosExemplarsResponse struct {
+	Status    string                      `protobuf:"bytes,1,opt,name=Status,proto3" json:"status"`
+	Data      []*exemplarspb.ExemplarData `protobuf:"bytes,2,rep,name=Data,proto3" json:"data"`
+	ErrorType string                      `protobuf:"bytes,3,opt,name=ErrorType,proto3" json:"errorType,omitempty"`
+	Error     string                      `protobuf:"bytes,4,opt,name=Error,proto3" json:"error,omitempty"`
+	Headers   []*ResponseHeader           `protobuf:"bytes,5,rep,name=Headers,proto3" json:"-"`
+}
+
+func (m *ThanosExemplarsResponse) Reset()         { *m = ThanosExemplarsResponse{} }
+func (m *ThanosExemplarsResponse) String() string { return proto.CompactTextString(m) }
+func (*ThanosExemplarsResponse) ProtoMessage()    {}
+func (*ThanosExemplarsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b882fa7024d92f38, []int{2}
+}
+func (m *ThanosExemplarsResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ThanosExemplarsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ThanosExemplarsResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ThanosExemplarsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ThanosExemplarsResponse.Merge(m, src)
+}
+func (m *ThanosExemplarsResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *ThanosExemplarsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ThanosExemplarsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ThanosExemplarsResponse proto.InternalMessageInfo
+
 type ResponseHeader struct {
 	Name   string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"-"`
 	Values []string `protobuf:"bytes,2,rep,name=Values,proto3" json:"-"`
@@ -116,7 +158,7 @@ func (m *ResponseHeader) Reset()         { *m = ResponseHeader{} }
 func (m *ResponseHeader) String() string { return proto.CompactTextString(m) }
 func (*ResponseHeader) ProtoMessage()    {}
 func (*ResponseHeader) Descriptor() ([]byte, []int) {
-	return fileDescriptor_b882fa7024d92f38, []int{2}
+	return fileDescriptor_b882fa7024d92f38, []int{3}
 }
 func (m *ResponseHeader) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -148,36 +190,40 @@ var xxx_messageInfo_ResponseHeader proto.InternalMessageInfo
 func init() {
 	proto.RegisterType((*ThanosLabelsResponse)(nil), "queryfrontend.ThanosLabelsResponse")
 	proto.RegisterType((*ThanosSeriesResponse)(nil), "queryfrontend.ThanosSeriesResponse")
+	proto.RegisterType((*ThanosExemplarsResponse)(nil), "queryfrontend.ThanosExemplarsResponse")
 	proto.RegisterType((*ResponseHeader)(nil), "queryfrontend.ResponseHeader")
 }
 
 func init() { proto.RegisterFile("queryfrontend/response.proto", fileDescriptor_b882fa7024d92f38) }
 
 var fileDescriptor_b882fa7024d92f38 = []byte{
-	// 367 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x92, 0x41, 0x4f, 0xea, 0x40,
-	0x14, 0x85, 0x5b, 0x28, 0x7d, 0x8f, 0xe1, 0x3d, 0x8d, 0x03, 0x89, 0x85, 0x40, 0x4b, 0x58, 0x61,
-	0xa2, 0x6d, 0x02, 0x71, 0xeb, 0xa2, 0xd1, 0xc4, 0x18, 0xe3, 0xa2, 0x10, 0x17, 0xee, 0x86, 0x70,
-	0x45, 0x12, 0xe8, 0xd4, 0x99, 0x61, 0xd1, 0x7f, 0xa1, 0xff, 0x8a, 0x25, 0x4b, 0x57, 0x8d, 0xc2,
-	0xae, 0x3f, 0xc1, 0x95, 0x61, 0x3a, 0x8d, 0xb0, 0x74, 0xe9, 0x6e, 0xe6, 0x9c, 0xef, 0xde, 0xe4,
-	0x9c, 0x5c, 0xd4, 0x7c, 0x5e, 0x00, 0x8b, 0x1f, 0x19, 0x0d, 0x05, 0x84, 0x63, 0x8f, 0x01, 0x8f,
-	0x68, 0xc8, 0xc1, 0x8d, 0x18, 0x15, 0x14, 0xff, 0xdf, 0x73, 0x1b, 0xb5, 0x09, 0x9d, 0x50, 0xe9,
-	0x78, 0xdb, 0x57, 0x06, 0x35, 0xea, 0x5c, 0x50, 0x06, 0xde, 0x8c, 0x8c, 0x60, 0x16, 0x8d, 0x3c,
-	0x11, 0x47, 0xc0, 0x33, 0xab, 0xf3, 0xa9, 0xa3, 0xda, 0xf0, 0x89, 0x84, 0x94, 0xdf, 0x6e, 0x5d,
-	0x1e, 0xa8, 0xf5, 0xb8, 0x83, 0xcc, 0x81, 0x20, 0x62, 0xc1, 0x2d, 0xbd, 0xad, 0x77, 0xcb, 0x3e,
-	0x4a, 0x13, 0xc7, 0xe4, 0x52, 0x09, 0x94, 0x83, 0x9b, 0xc8, 0xb8, 0x24, 0x82, 0x58, 0x85, 0x76,
-	0xb1, 0x5b, 0xf6, 0xff, 0xa6, 0x89, 0x63, 0x8c, 0x89, 0x20, 0x81, 0x54, 0xf1, 0x39, 0x2a, 0x5f,
-	0x31, 0x46, 0xd9, 0x30, 0x8e, 0xc0, 0x2a, 0xca, 0x25, 0xc7, 0x69, 0xe2, 0x54, 0x21, 0x17, 0x4f,
-	0xe9, 0x7c, 0x2a, 0x60, 0x1e, 0x89, 0x38, 0xf8, 0x26, 0xf1, 0x09, 0x2a, 0xc9, 0x8f, 0x65, 0xc8,
-	0x91, 0x6a, 0x9a, 0x38, 0x87, 0x72, 0x64, 0x07, 0xcf, 0x08, 0x7c, 0x81, 0xfe, 0x5c, 0x03, 0x19,
-	0x03, 0xe3, 0x56, 0xa9, 0x5d, 0xec, 0x56, 0x7a, 0x2d, 0x77, 0xaf, 0x0e, 0x37, 0x4f, 0x93, 0x51,
-	0x7e, 0x29, 0x4d, 0x1c, 0xfd, 0x2c, 0xc8, 0x87, 0x3a, 0xaf, 0x85, 0x3c, 0xfc, 0x00, 0xd8, 0x14,
-	0x7e, 0x16, 0xbe, 0xbf, 0x13, 0xbe, 0xd2, 0x3b, 0x72, 0x85, 0x5c, 0xe4, 0x3e, 0xc8, 0x1e, 0x07,
-	0x20, 0xfc, 0x7f, 0xcb, 0xc4, 0xd1, 0x7e, 0x5d, 0x27, 0x37, 0xe8, 0x60, 0x9f, 0xc0, 0x75, 0x64,
-	0xdc, 0x91, 0x39, 0xa8, 0x2a, 0x14, 0x2f, 0x25, 0xdc, 0x42, 0xe6, 0x3d, 0x99, 0x2d, 0x80, 0xab,
-	0x13, 0x50, 0xa6, 0x12, 0xfd, 0xe6, 0xf2, 0xc3, 0xd6, 0x96, 0x6b, 0x5b, 0x5f, 0xad, 0x6d, 0xfd,
-	0x7d, 0x6d, 0xeb, 0x2f, 0x1b, 0x5b, 0x5b, 0x6d, 0x6c, 0xed, 0x6d, 0x63, 0x6b, 0x23, 0x53, 0x5e,
-	0x60, 0xff, 0x2b, 0x00, 0x00, 0xff, 0xff, 0x6d, 0x4c, 0xcd, 0xdf, 0xe1, 0x02, 0x00, 0x00,
+	// 408 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x93, 0xcf, 0xae, 0xd2, 0x40,
+	0x18, 0xc5, 0x5b, 0x28, 0x55, 0xe6, 0xfa, 0x27, 0xce, 0x25, 0xb9, 0xbd, 0x37, 0xd0, 0x12, 0x56,
+	0x98, 0x68, 0x9b, 0x40, 0xdc, 0xba, 0x68, 0x24, 0x31, 0xc6, 0xb8, 0x28, 0xc4, 0x85, 0xbb, 0xa9,
+	0x7c, 0x22, 0x49, 0xdb, 0x19, 0x67, 0x86, 0xc4, 0xbe, 0x85, 0xc6, 0x97, 0x62, 0xc9, 0xd2, 0x55,
+	0xa3, 0xb0, 0xeb, 0x23, 0xb8, 0x32, 0x4c, 0xa7, 0x4a, 0x97, 0x2c, 0xd9, 0x4d, 0xcf, 0x39, 0xdf,
+	0xd7, 0x9c, 0x5f, 0x66, 0x50, 0xff, 0xcb, 0x06, 0x78, 0xfe, 0x89, 0xd3, 0x4c, 0x42, 0xb6, 0x0c,
+	0x38, 0x08, 0x46, 0x33, 0x01, 0x3e, 0xe3, 0x54, 0x52, 0xfc, 0xb0, 0xe1, 0xde, 0xf5, 0x56, 0x74,
+	0x45, 0x95, 0x13, 0x1c, 0x4f, 0x55, 0xe8, 0xee, 0x56, 0x48, 0xca, 0x21, 0x48, 0x48, 0x0c, 0x09,
+	0x8b, 0x03, 0x99, 0x33, 0x10, 0xda, 0xf2, 0xe0, 0x2b, 0xa4, 0x2c, 0x21, 0x5c, 0x04, 0xff, 0x4e,
+	0x2c, 0x0e, 0x38, 0xfb, 0x58, 0x05, 0x46, 0x7f, 0x4c, 0xd4, 0x5b, 0x7c, 0x26, 0x19, 0x15, 0x6f,
+	0x8f, 0xe3, 0x22, 0xd2, 0xff, 0xc7, 0x23, 0x64, 0xcf, 0x25, 0x91, 0x1b, 0xe1, 0x98, 0x43, 0x73,
+	0xdc, 0x0d, 0x51, 0x59, 0x78, 0xb6, 0x50, 0x4a, 0xa4, 0x1d, 0xdc, 0x47, 0xd6, 0x2b, 0x22, 0x89,
+	0xd3, 0x1a, 0xb6, 0xc7, 0xdd, 0xf0, 0x7e, 0x59, 0x78, 0xd6, 0x92, 0x48, 0x12, 0x29, 0x15, 0xbf,
+	0x40, 0xdd, 0x19, 0xe7, 0x94, 0x2f, 0x72, 0x06, 0x4e, 0x5b, 0x2d, 0xb9, 0x29, 0x0b, 0xef, 0x1a,
+	0x6a, 0xf1, 0x19, 0x4d, 0xd7, 0x12, 0x52, 0x26, 0xf3, 0xe8, 0x7f, 0x12, 0x3f, 0x45, 0x1d, 0xf5,
+	0xe1, 0x58, 0x6a, 0xe4, 0xba, 0x2c, 0xbc, 0xc7, 0x6a, 0xe4, 0x24, 0x5e, 0x25, 0xf0, 0x4b, 0x74,
+	0xef, 0x35, 0x90, 0x25, 0x70, 0xe1, 0x74, 0x86, 0xed, 0xf1, 0xd5, 0x64, 0xe0, 0x37, 0x78, 0xf9,
+	0x75, 0x9b, 0x2a, 0x15, 0x76, 0xca, 0xc2, 0x33, 0x9f, 0x47, 0xf5, 0xd0, 0xe8, 0x7b, 0xab, 0x2e,
+	0x3f, 0x07, 0xbe, 0x86, 0xf3, 0xca, 0x4f, 0x4f, 0xca, 0x5f, 0x4d, 0x9e, 0xf8, 0x52, 0x2d, 0xf2,
+	0x3f, 0x28, 0x8e, 0x73, 0x90, 0xe1, 0x83, 0x6d, 0xe1, 0x19, 0x17, 0xc7, 0xe4, 0x47, 0x0b, 0xdd,
+	0x54, 0x4c, 0x66, 0xf5, 0x85, 0x39, 0x0b, 0xcb, 0xa4, 0x81, 0xa5, 0x57, 0x63, 0xa9, 0x97, 0x1d,
+	0xbd, 0x0b, 0xbc, 0x29, 0x6f, 0xd0, 0xa3, 0x66, 0x02, 0xdf, 0x22, 0xeb, 0x1d, 0x49, 0x41, 0x93,
+	0xd0, 0x79, 0x25, 0xe1, 0x01, 0xb2, 0xdf, 0x93, 0x64, 0x03, 0x42, 0x3f, 0x0c, 0x6d, 0x6a, 0x31,
+	0xec, 0x6f, 0x7f, 0xbb, 0xc6, 0x76, 0xef, 0x9a, 0xbb, 0xbd, 0x6b, 0xfe, 0xda, 0xbb, 0xe6, 0xb7,
+	0x83, 0x6b, 0xec, 0x0e, 0xae, 0xf1, 0xf3, 0xe0, 0x1a, 0xb1, 0xad, 0xde, 0xe5, 0xf4, 0xef, 0x00,
+	0x80, 0xe4, 0x4f, 0x3c, 0x18, 0x04, 0x00, 0x00,
 }
 
 func (m *ThanosLabelsResponse) Marshal() (dAtA []byte, err error) {
@@ -319,6 +365,78 @@ func (m *ThanosSeriesResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *ThanosExemplarsResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ThanosExemplarsResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ThanosExemplarsResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Headers) > 0 {
+		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Headers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintResponse(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
+	if len(m.Error) > 0 {
+		i -= len(m.Error)
+		copy(dAtA[i:], m.Error)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.Error)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.ErrorType) > 0 {
+		i -= len(m.ErrorType)
+		copy(dAtA[i:], m.ErrorType)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.ErrorType)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Data) > 0 {
+		for iNdEx := len(m.Data) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Data[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintResponse(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Status) > 0 {
+		i -= len(m.Status)
+		copy(dAtA[i:], m.Status)
+		i = encodeVarintResponse(dAtA, i, uint64(len(m.Status)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *ResponseHeader) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -435,6 +553,39 @@ func (m *ThanosSeriesResponse) Size() (n int) {
 	return n
 }
 
+func (m *ThanosExemplarsResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Status)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	if len(m.Data) > 0 {
+		for _, e := range m.Data {
+			l = e.Size()
+			n += 1 + l + sovResponse(uint64(l))
+		}
+	}
+	l = len(m.ErrorType)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	l = len(m.Error)
+	if l > 0 {
+		n += 1 + l + sovResponse(uint64(l))
+	}
+	if len(m.Headers) > 0 {
+		for _, e := range m.Headers {
+			l = e.Size()
+			n += 1 + l + sovResponse(uint64(l))
+		}
+	}
+	return n
+}
+
 func (m *ResponseHeader) Size() (n int) {
 	if m == nil {
 		return 0
@@ -886,6 +1037,220 @@ func (m *ThanosSeriesResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ThanosExemplarsResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowResponse
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ThanosExemplarsResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ThanosExemplarsResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Status", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Status = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data, &exemplarspb.ExemplarData{})
+			if err := m.Data[len(m.Data)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ErrorType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ErrorType = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Error", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Error = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Headers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowResponse
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthResponse
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Headers = append(m.Headers, &ResponseHeader{})
+			if err := m.Headers[len(m.Headers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipResponse(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthResponse
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *ResponseHeader) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
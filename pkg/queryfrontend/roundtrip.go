@@ -4,6 +4,7 @@
 package queryfrontend
 
 import (
+	"context"
 	"net/http"
 	"regexp"
 	"strings"
@@ -25,6 +26,7 @@ const (
 	labelNamesOp   = "label_names"
 	labelValuesOp  = "label_values"
 	seriesOp       = "series"
+	exemplarsOp    = "exemplars"
 )
 
 var labelValuesPattern = regexp.MustCompile("/api/v1/label/.+/values$")
@@ -32,8 +34,8 @@ var labelValuesPattern = regexp.MustCompile("/api/v1/label/.+/values$")
 // NewTripperware returns a Tripperware which sends requests to different sub tripperwares based on the query type.
 func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger) (queryrange.Tripperware, error) {
 	var (
-		queryRangeLimits, labelsLimits queryrange.Limits
-		err                            error
+		queryRangeLimits, labelsLimits, exemplarsLimits queryrange.Limits
+		err                                             error
 	)
 	if config.QueryRangeConfig.Limits != nil {
 		queryRangeLimits, err = validation.NewOverrides(*config.QueryRangeConfig.Limits, nil)
@@ -49,8 +51,16 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 		}
 	}
 
+	if config.ExemplarsConfig.Limits != nil {
+		exemplarsLimits, err = validation.NewOverrides(*config.ExemplarsConfig.Limits, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "initialize exemplars limits")
+		}
+	}
+
 	queryRangeCodec := NewThanosQueryRangeCodec(config.QueryRangeConfig.PartialResponseStrategy)
-	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.DefaultTimeRange)
+	labelsCodec := NewThanosLabelsCodec(config.LabelsConfig.PartialResponseStrategy, config.LabelsConfig.DefaultTimeRange)
+	exemplarsCodec := NewThanosExemplarsCodec(config.ExemplarsConfig.DefaultTimeRange)
 
 	queryRangeTripperware, err := newQueryRangeTripperware(config.QueryRangeConfig, queryRangeLimits, queryRangeCodec,
 		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "query_range"}, reg), logger, config.ForwardHeaders)
@@ -64,22 +74,29 @@ func NewTripperware(config Config, reg prometheus.Registerer, logger log.Logger)
 		return nil, err
 	}
 
+	exemplarsTripperware, err := newExemplarsTripperware(config.ExemplarsConfig, exemplarsLimits, exemplarsCodec,
+		prometheus.WrapRegistererWith(prometheus.Labels{"tripperware": "exemplars"}, reg), logger, config.ForwardHeaders)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(next http.RoundTripper) http.RoundTripper {
-		return newRoundTripper(next, queryRangeTripperware(next), labelsTripperware(next), reg)
+		return newRoundTripper(next, queryRangeTripperware(next), labelsTripperware(next), exemplarsTripperware(next), reg)
 	}, nil
 }
 
 type roundTripper struct {
-	next, queryRange, labels http.RoundTripper
+	next, queryRange, labels, exemplars http.RoundTripper
 
 	queriesCount *prometheus.CounterVec
 }
 
-func newRoundTripper(next, queryRange, metadata http.RoundTripper, reg prometheus.Registerer) roundTripper {
+func newRoundTripper(next, queryRange, metadata, exemplars http.RoundTripper, reg prometheus.Registerer) roundTripper {
 	r := roundTripper{
 		next:       next,
 		queryRange: queryRange,
 		labels:     metadata,
+		exemplars:  exemplars,
 		queriesCount: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "thanos_query_frontend_queries_total",
 			Help: "Total queries passing through query frontend",
@@ -91,6 +108,7 @@ func newRoundTripper(next, queryRange, metadata http.RoundTripper, reg prometheu
 	r.queriesCount.WithLabelValues(labelNamesOp)
 	r.queriesCount.WithLabelValues(labelValuesOp)
 	r.queriesCount.WithLabelValues(seriesOp)
+	r.queriesCount.WithLabelValues(exemplarsOp)
 	return r
 }
 
@@ -104,6 +122,9 @@ func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	case labelNamesOp, labelValuesOp, seriesOp:
 		r.queriesCount.WithLabelValues(op).Inc()
 		return r.labels.RoundTrip(req)
+	case exemplarsOp:
+		r.queriesCount.WithLabelValues(exemplarsOp).Inc()
+		return r.exemplars.RoundTrip(req)
 	default:
 	}
 
@@ -121,6 +142,8 @@ func getOperation(r *http.Request) string {
 			return labelNamesOp
 		case strings.HasSuffix(r.URL.Path, "/api/v1/series"):
 			return seriesOp
+		case strings.HasSuffix(r.URL.Path, "/api/v1/query_exemplars"):
+			return exemplarsOp
 		default:
 			if labelValuesPattern.MatchString(r.URL.Path) {
 				return labelValuesOp
@@ -141,7 +164,7 @@ func newQueryRangeTripperware(
 	logger log.Logger,
 	forwardHeaders []string,
 ) (queryrange.Tripperware, error) {
-	queryRangeMiddleware := []queryrange.Middleware{queryrange.NewLimitsMiddleware(limits)}
+	queryRangeMiddleware := []queryrange.Middleware{NullNaNMiddleware(), queryrange.NewLimitsMiddleware(limits)}
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
 
 	// step align middleware.
@@ -161,15 +184,11 @@ func newQueryRangeTripperware(
 		)
 	}
 
-	queryIntervalFn := func(_ queryrange.Request) time.Duration {
-		return config.SplitQueriesByInterval
-	}
-
-	if config.SplitQueriesByInterval != 0 {
+	if config.SplitQueriesByInterval != 0 || config.TenantLimits.overridesSplitInterval() {
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("split_by_interval", m),
-			SplitByIntervalMiddleware(queryIntervalFn, limits, codec, reg),
+			SplitByIntervalMiddleware(tenantIntervalFn(config.TenantLimits, config.SplitQueriesByInterval), limits, codec, reg),
 		)
 	}
 
@@ -177,7 +196,7 @@ func newQueryRangeTripperware(
 		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
 			logger,
 			*config.ResultsCacheConfig,
-			newThanosCacheKeyGenerator(config.SplitQueriesByInterval),
+			newThanosCacheKeyGenerator(config.SplitQueriesByInterval, config.TenantLimits),
 			limits,
 			codec,
 			queryrange.PrometheusResponseExtractor{},
@@ -192,7 +211,7 @@ func newQueryRangeTripperware(
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
 			queryrange.InstrumentMiddleware("results_cache", m),
-			queryCacheMiddleware,
+			tenantCacheBypassMiddleware(config.TenantLimits, queryCacheMiddleware),
 		)
 	}
 
@@ -225,7 +244,7 @@ func newLabelsTripperware(
 	labelsMiddleware := []queryrange.Middleware{}
 	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
 
-	queryIntervalFn := func(_ queryrange.Request) time.Duration {
+	queryIntervalFn := func(_ context.Context, _ queryrange.Request) time.Duration {
 		return config.SplitQueriesByInterval
 	}
 
@@ -238,10 +257,12 @@ func newLabelsTripperware(
 	}
 
 	if config.ResultsCacheConfig != nil {
+		keyGenerator := newThanosCacheKeyGenerator(config.SplitQueriesByInterval, nil)
+		keyGenerator.alignment = config.CacheAlignment
 		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
 			logger,
 			*config.ResultsCacheConfig,
-			newThanosCacheKeyGenerator(config.SplitQueriesByInterval),
+			keyGenerator,
 			limits,
 			codec,
 			ThanosResponseExtractor{},
@@ -253,10 +274,22 @@ func newLabelsTripperware(
 			return nil, errors.Wrap(err, "create results cache middleware")
 		}
 
+		countRequests, countMisses := cacheHitsMiddlewares(
+			promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "thanos_frontend_labels_cache_requests_total",
+				Help: "Total number of labels and series requests to the results cache.",
+			}),
+			promauto.With(reg).NewCounter(prometheus.CounterOpts{
+				Name: "thanos_frontend_labels_cache_hits_total",
+				Help: "Total number of labels and series requests entirely served by the results cache.",
+			}),
+		)
 		labelsMiddleware = append(
 			labelsMiddleware,
 			queryrange.InstrumentMiddleware("results_cache", m),
+			countRequests,
 			queryCacheMiddleware,
+			countMisses,
 		)
 	}
 
@@ -275,6 +308,75 @@ func newLabelsTripperware(
 	}, nil
 }
 
+// newExemplarsTripperware returns a Tripperware for exemplars requests
+// configured with middlewares of split by interval, cache requests and retry.
+func newExemplarsTripperware(
+	config ExemplarsConfig,
+	limits queryrange.Limits,
+	codec *exemplarsCodec,
+	reg prometheus.Registerer,
+	logger log.Logger,
+	forwardHeaders []string,
+) (queryrange.Tripperware, error) {
+	exemplarsMiddleware := []queryrange.Middleware{}
+	m := queryrange.NewInstrumentMiddlewareMetrics(reg)
+
+	queriesCount := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_frontend_exemplar_queries_total",
+		Help: "Total number of exemplars requests passing through the exemplars tripperware.",
+	})
+
+	queryIntervalFn := func(_ context.Context, _ queryrange.Request) time.Duration {
+		return config.SplitQueriesByInterval
+	}
+
+	if config.SplitQueriesByInterval != 0 {
+		exemplarsMiddleware = append(
+			exemplarsMiddleware,
+			queryrange.InstrumentMiddleware("split_interval", m),
+			SplitByIntervalMiddleware(queryIntervalFn, limits, codec, reg),
+		)
+	}
+
+	if config.ResultsCacheConfig != nil {
+		queryCacheMiddleware, _, err := queryrange.NewResultsCacheMiddleware(
+			logger,
+			*config.ResultsCacheConfig,
+			newThanosCacheKeyGenerator(config.SplitQueriesByInterval, nil),
+			limits,
+			codec,
+			ThanosResponseExtractor{},
+			nil,
+			shouldCache,
+			reg,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "create results cache middleware")
+		}
+
+		exemplarsMiddleware = append(
+			exemplarsMiddleware,
+			queryrange.InstrumentMiddleware("results_cache", m),
+			queryCacheMiddleware,
+		)
+	}
+
+	if config.MaxRetries > 0 {
+		exemplarsMiddleware = append(
+			exemplarsMiddleware,
+			queryrange.InstrumentMiddleware("retry", m),
+			queryrange.NewRetryMiddleware(logger, config.MaxRetries, queryrange.NewRetryMiddlewareMetrics(reg)),
+		)
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		rt := queryrange.NewRoundTripper(next, codec, forwardHeaders, exemplarsMiddleware...)
+		return queryrange.RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			queriesCount.Inc()
+			return rt.RoundTrip(r)
+		})
+	}, nil
+}
+
 // shouldCache controls what kind of Thanos request should be cached.
 // For more information about requests that skip caching logic, please visit
 // the query-frontend documentation.
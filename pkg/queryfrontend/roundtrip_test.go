@@ -18,11 +18,13 @@ import (
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
 	cortexvalidation "github.com/cortexproject/cortex/pkg/util/validation"
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/weaveworks/common/user"
 
+	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
@@ -373,6 +375,68 @@ func TestRoundTripSplitIntervalMiddleware(t *testing.T) {
 	}
 }
 
+// TestRoundTripTenantSplitIntervalMiddleware tests that range queries are split by the interval of their tenant,
+// also when range queries aren't split by default.
+func TestRoundTripTenantSplitIntervalMiddleware(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+	}
+
+	tenantLimits, err := ParseTenantLimitsConfig([]byte(`
+tenants:
+  short-range:
+    split_queries_by_interval: 1h
+`))
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		name          string
+		splitInterval time.Duration
+		tenant        string
+		expected      int
+	}{
+		{name: "overridden interval", splitInterval: day, tenant: "short-range", expected: 2},
+		{name: "default interval", splitInterval: day, tenant: "long-range", expected: 1},
+		{name: "overridden interval without default", splitInterval: 0, tenant: "short-range", expected: 2},
+		{name: "no interval", splitInterval: 0, tenant: "long-range", expected: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpw, err := NewTripperware(
+				Config{
+					QueryRangeConfig: QueryRangeConfig{
+						Limits:                 defaultLimits,
+						SplitQueriesByInterval: tc.splitInterval,
+						TenantLimits:           tenantLimits,
+					},
+					LabelsConfig: LabelsConfig{
+						Limits:                 defaultLimits,
+						SplitQueriesByInterval: day,
+					},
+				}, nil, log.NewNopLogger(),
+			)
+			testutil.Ok(t, err)
+
+			rt, err := newFakeRoundTripper()
+			testutil.Ok(t, err)
+			defer rt.Close()
+			res, handler := promqlResults(false)
+			rt.setHandler(handler)
+
+			ctx := user.InjectOrgID(context.Background(), tc.tenant)
+			httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, testRequest)
+			testutil.Ok(t, err)
+
+			_, err = tpw(rt).RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, *res)
+		})
+	}
+}
+
 // TestRoundTripQueryRangeCacheMiddleware tests the cache middleware.
 func TestRoundTripQueryRangeCacheMiddleware(t *testing.T) {
 	testRequest := &ThanosQueryRangeRequest{
@@ -516,6 +580,83 @@ func TestRoundTripQueryRangeCacheMiddleware(t *testing.T) {
 	}
 }
 
+// TestRoundTripTenantCacheBypass tests that requests of tenants bypassing the results cache never read or write it.
+func TestRoundTripTenantCacheBypass(t *testing.T) {
+	testRequest := &ThanosQueryRangeRequest{
+		Path:  "/api/v1/query_range",
+		Start: 0,
+		End:   2 * hour,
+		Step:  10 * seconds,
+		Dedup: true,
+	}
+
+	tenantLimits, err := ParseTenantLimitsConfig([]byte(`
+tenants:
+  realtime:
+    bypass_results_cache: true
+`))
+	testutil.Ok(t, err)
+
+	reg := prometheus.NewRegistry()
+	tpw, err := NewTripperware(
+		Config{
+			QueryRangeConfig: QueryRangeConfig{
+				Limits: defaultLimits,
+				ResultsCacheConfig: &queryrange.ResultsCacheConfig{
+					CacheConfig: cortexcache.Config{
+						EnableFifoCache: true,
+						Fifocache: cortexcache.FifoCacheConfig{
+							MaxSizeBytes: "1MiB",
+							MaxSizeItems: 1000,
+							Validity:     time.Hour,
+						},
+					},
+				},
+				SplitQueriesByInterval: day,
+				TenantLimits:           tenantLimits,
+			},
+		}, reg, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := promqlResults(false)
+	rt.setHandler(handler)
+	// Middlewares register their metrics when wrapping the round tripper.
+	queryRangeRT := tpw(rt)
+
+	for _, tc := range []struct {
+		name        string
+		tenant      string
+		expected    int
+		expectedGet float64
+	}{
+		{name: "bypass tenant is evaluated", tenant: "realtime", expected: 1},
+		{name: "bypass tenant is evaluated again", tenant: "realtime", expected: 2},
+		{name: "other tenant isn't served results of the bypass tenant", tenant: "other", expected: 3, expectedGet: 1},
+		{name: "other tenant uses cache", tenant: "other", expected: 3, expectedGet: 2},
+		{name: "bypass tenant is still evaluated", tenant: "realtime", expected: 4, expectedGet: 2},
+	} {
+		if !t.Run(tc.name, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), tc.tenant)
+			httpReq, err := NewThanosQueryRangeCodec(true).EncodeRequest(ctx, testRequest)
+			testutil.Ok(t, err)
+
+			_, err = queryRangeRT.RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, *res)
+			testutil.Equals(t, tc.expectedGet, counterValue(t, reg, "querier_cache_gets_total"))
+		}) {
+			break
+		}
+	}
+	// Only the first request of the other tenant was written to the cache.
+	testutil.Equals(t, 1.0, counterValue(t, reg, "querier_cache_added_new_total"))
+}
+
 // TestRoundTripLabelsCacheMiddleware tests the cache middleware for labels requests.
 func TestRoundTripLabelsCacheMiddleware(t *testing.T) {
 	testRequest := &ThanosLabelsRequest{
@@ -640,6 +781,81 @@ func TestRoundTripLabelsCacheMiddleware(t *testing.T) {
 	}
 }
 
+func TestRoundTripLabelsCacheAlignment(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tpw, err := NewTripperware(
+		Config{
+			LabelsConfig: LabelsConfig{
+				Limits: defaultLimits,
+				ResultsCacheConfig: &queryrange.ResultsCacheConfig{
+					CacheConfig: cortexcache.Config{
+						EnableFifoCache: true,
+						Fifocache: cortexcache.FifoCacheConfig{
+							MaxSizeBytes: "1MiB",
+							MaxSizeItems: 1000,
+							Validity:     time.Hour,
+						},
+					},
+				},
+				CacheAlignment:         2 * time.Hour,
+				SplitQueriesByInterval: day,
+			},
+		}, reg, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := labelsResults(false)
+	rt.setHandler(handler)
+	// Middlewares register their metrics when wrapping the round tripper.
+	labelsRT := tpw(rt)
+
+	for _, tc := range []struct {
+		name         string
+		start, end   int64
+		expected     int
+		expectedHits float64
+	}{
+		{name: "first request", start: 0, end: 2 * hour, expected: 1},
+		{name: "range within the same blocks, use cache", start: 0, end: hour, expected: 1, expectedHits: 1},
+		{name: "range crossing a block boundary, won't use cache", start: 0, end: 3 * hour, expected: 2, expectedHits: 1},
+		{name: "range within the same blocks as the previous one, use cache", start: hour, end: 2*hour + 1, expected: 2, expectedHits: 2},
+		{name: "range of other blocks, won't use cache", start: 2 * hour, end: 4 * hour, expected: 3, expectedHits: 2},
+	} {
+		if !t.Run(tc.name, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "1")
+			httpReq, err := NewThanosLabelsCodec(true, 24*time.Hour).EncodeRequest(ctx, &ThanosLabelsRequest{
+				Path:  "/api/v1/labels",
+				Start: tc.start,
+				End:   tc.end,
+			})
+			testutil.Ok(t, err)
+
+			_, err = labelsRT.RoundTrip(httpReq)
+			testutil.Ok(t, err)
+
+			testutil.Equals(t, tc.expected, *res)
+			testutil.Equals(t, tc.expectedHits, counterValue(t, reg, "thanos_frontend_labels_cache_hits_total"))
+		}) {
+			break
+		}
+	}
+	testutil.Equals(t, 5.0, counterValue(t, reg, "thanos_frontend_labels_cache_requests_total"))
+}
+
+func counterValue(t *testing.T, g prometheus.Gatherer, name string) float64 {
+	mfs, err := g.Gather()
+	testutil.Ok(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
 // TestRoundTripSeriesCacheMiddleware tests the cache middleware for series requests.
 func TestRoundTripSeriesCacheMiddleware(t *testing.T) {
 	testRequest := &ThanosSeriesRequest{
@@ -731,6 +947,73 @@ func TestRoundTripSeriesCacheMiddleware(t *testing.T) {
 	}
 }
 
+// TestRoundTripExemplarsCacheMiddleware tests the split and cache middlewares for exemplars requests.
+func TestRoundTripExemplarsCacheMiddleware(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tpw, err := NewTripperware(
+		Config{
+			ExemplarsConfig: ExemplarsConfig{
+				Limits: defaultLimits,
+				ResultsCacheConfig: &queryrange.ResultsCacheConfig{
+					CacheConfig: cortexcache.Config{
+						EnableFifoCache: true,
+						Fifocache: cortexcache.FifoCacheConfig{
+							MaxSizeBytes: "1MiB",
+							MaxSizeItems: 1000,
+							Validity:     time.Hour,
+						},
+					},
+				},
+				SplitQueriesByInterval: day,
+			},
+		}, reg, log.NewNopLogger(),
+	)
+	testutil.Ok(t, err)
+
+	rt, err := newFakeRoundTripper()
+	testutil.Ok(t, err)
+	defer rt.Close()
+	res, handler := exemplarsResults()
+	rt.setHandler(handler)
+	exemplarsRT := tpw(rt)
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		// The second day has no exemplars, its empty response is cached as well.
+		{name: "first request, split by day", query: "up", expected: 2},
+		{name: "same request as the first one, directly use cache", query: "up", expected: 2},
+		{name: "different query, not use cache", query: "down", expected: 4},
+	} {
+		if !t.Run(tc.name, func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "1")
+			httpReq, err := NewThanosExemplarsCodec(24*time.Hour).EncodeRequest(ctx, &ThanosExemplarsRequest{
+				Path:  "/api/v1/query_exemplars",
+				Start: 0,
+				End:   2*day.Milliseconds() - 1,
+				Query: tc.query,
+			})
+			testutil.Ok(t, err)
+
+			resp, err := exemplarsRT.RoundTrip(httpReq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tc.expected, *res)
+
+			var got ThanosExemplarsResponse
+			testutil.Ok(t, json.NewDecoder(resp.Body).Decode(&got))
+			testutil.Equals(t, []*exemplarspb.ExemplarData{{
+				SeriesLabels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "foo", Value: "bar"}}},
+				Exemplars:    []*exemplarspb.Exemplar{{Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "abc"}}}, Value: 1, Ts: hour}},
+			}}, got.Data)
+		}) {
+			break
+		}
+	}
+	testutil.Equals(t, 3.0, counterValue(t, reg, "thanos_frontend_exemplar_queries_total"))
+}
+
 // promqlResults is a mock handler used to test split and cache middleware.
 // Modified from Loki https://github.com/grafana/loki/blob/master/pkg/querier/queryrange/roundtrip_test.go#L547.
 func promqlResults(fail bool) (*int, http.Handler) {
@@ -814,3 +1097,32 @@ func seriesResults(fail bool) (*int, http.Handler) {
 		count++
 	})
 }
+
+// exemplarsResults is a mock handler used to test split and cache middleware for exemplars requests.
+// It returns an exemplar at 1h for ranges including it and no exemplars otherwise.
+func exemplarsResults() (*int, http.Handler) {
+	count := 0
+	var lock sync.Mutex
+	data := []*exemplarspb.ExemplarData{{
+		SeriesLabels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "__name__", Value: "up"}, {Name: "foo", Value: "bar"}}},
+		Exemplars:    []*exemplarspb.Exemplar{{Labels: labelpb.ZLabelSet{Labels: []labelpb.ZLabel{{Name: "trace_id", Value: "abc"}}}, Value: 1, Ts: hour}},
+	}}
+
+	return &count, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		q := ThanosExemplarsResponse{Status: "success", Data: []*exemplarspb.ExemplarData{}}
+		start, end, err := parseMetadataTimeRange(r, 0)
+		if err != nil {
+			panic(err)
+		}
+		if start <= hour && hour <= end {
+			q.Data = data
+		}
+		if err := json.NewEncoder(w).Encode(q); err != nil {
+			panic(err)
+		}
+		count++
+	})
+}
@@ -15,8 +15,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// IntervalFn returns the interval to split the given request by.
+type IntervalFn func(ctx context.Context, r queryrange.Request) time.Duration
+
 // SplitByIntervalMiddleware creates a new Middleware that splits requests by a given interval.
-func SplitByIntervalMiddleware(interval queryrange.IntervalFn, limits queryrange.Limits, merger queryrange.Merger, registerer prometheus.Registerer) queryrange.Middleware {
+func SplitByIntervalMiddleware(interval IntervalFn, limits queryrange.Limits, merger queryrange.Merger, registerer prometheus.Registerer) queryrange.Middleware {
 	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
 		return splitByInterval{
 			next:     next,
@@ -36,16 +39,23 @@ type splitByInterval struct {
 	next     queryrange.Handler
 	limits   queryrange.Limits
 	merger   queryrange.Merger
-	interval queryrange.IntervalFn
+	interval IntervalFn
 
 	// Metrics.
 	splitByCounter prometheus.Counter
 }
 
 func (s splitByInterval) Do(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+	interval := s.interval(ctx, r)
+	if interval <= 0 {
+		// Only some tenants split their requests, as the default interval is 0.
+		s.splitByCounter.Inc()
+		return s.next.Do(ctx, r)
+	}
+
 	// First we're going to build new requests, one for each day, taking care
 	// to line up the boundaries with step.
-	reqs := splitQuery(r, s.interval(r))
+	reqs := splitQuery(r, interval)
 	s.splitByCounter.Add(float64(len(reqs)))
 
 	reqResps, err := queryrange.DoRequests(ctx, s.next, reqs, s.limits)
@@ -67,7 +77,8 @@ func (s splitByInterval) Do(ctx context.Context, r queryrange.Request) (queryran
 
 func splitQuery(r queryrange.Request, interval time.Duration) []queryrange.Request {
 	var reqs []queryrange.Request
-	if _, ok := r.(*ThanosQueryRangeRequest); ok {
+	switch r.(type) {
+	case *ThanosQueryRangeRequest, *ThanosExemplarsRequest:
 		if start := r.GetStart(); start == r.GetEnd() {
 			reqs = append(reqs, r.WithStartEnd(start, start))
 		} else {
@@ -80,7 +91,7 @@ func splitQuery(r queryrange.Request, interval time.Duration) []queryrange.Reque
 				reqs = append(reqs, r.WithStartEnd(start, end))
 			}
 		}
-	} else {
+	default:
 		dur := int64(interval / time.Millisecond)
 		for start := r.GetStart(); start < r.GetEnd(); start = start + dur {
 			end := start + dur
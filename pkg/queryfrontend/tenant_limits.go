@@ -0,0 +1,105 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package queryfrontend
+
+import (
+	"context"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/pkg/errors"
+	prommodel "github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// TenantLimits holds the limits overridden for a single tenant.
+type TenantLimits struct {
+	// SplitQueriesByInterval overrides the interval query range requests of the tenant are split by. 0 keeps the default.
+	SplitQueriesByInterval prommodel.Duration `yaml:"split_queries_by_interval"`
+	// BypassResultsCache makes requests of the tenant always evaluated, without reading or writing the results cache.
+	BypassResultsCache bool `yaml:"bypass_results_cache"`
+}
+
+// TenantLimitsConfig holds the per-tenant limits, keyed by tenant ID.
+type TenantLimitsConfig struct {
+	Tenants map[string]TenantLimits `yaml:"tenants"`
+}
+
+// ParseTenantLimitsConfig parses the per-tenant limits from YAML.
+func ParseTenantLimitsConfig(confContentYaml []byte) (*TenantLimitsConfig, error) {
+	conf := &TenantLimitsConfig{}
+	if err := yaml.UnmarshalStrict(confContentYaml, conf); err != nil {
+		return nil, errors.Wrap(err, "parsing tenant limits config YAML file")
+	}
+	for id, l := range conf.Tenants {
+		if l.SplitQueriesByInterval < 0 {
+			return nil, errors.Errorf("split_queries_by_interval of tenant %q must not be negative", id)
+		}
+	}
+	return conf, nil
+}
+
+// splitInterval returns the split interval of the given tenant, or def if it's not overridden.
+func (c *TenantLimitsConfig) splitInterval(userID string, def time.Duration) time.Duration {
+	if c == nil {
+		return def
+	}
+	if l, ok := c.Tenants[userID]; ok && l.SplitQueriesByInterval > 0 {
+		return time.Duration(l.SplitQueriesByInterval)
+	}
+	return def
+}
+
+// overridesSplitInterval returns true if any tenant overrides the split interval.
+func (c *TenantLimitsConfig) overridesSplitInterval() bool {
+	if c == nil {
+		return false
+	}
+	for _, l := range c.Tenants {
+		if l.SplitQueriesByInterval > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantIntervalFn returns an IntervalFn splitting requests by the interval of their tenant, falling back to def.
+// Tenants are identified the same way as by the results cache, so cache keys follow the same interval.
+func tenantIntervalFn(limits *TenantLimitsConfig, def time.Duration) IntervalFn {
+	return func(ctx context.Context, _ queryrange.Request) time.Duration {
+		tenantIDs, err := tenant.TenantIDs(ctx)
+		if err != nil {
+			return def
+		}
+		return limits.splitInterval(tenant.JoinTenantIDs(tenantIDs), def)
+	}
+}
+
+// bypassResultsCache returns true if any of the given tenants bypasses the results cache.
+func (c *TenantLimitsConfig) bypassResultsCache(tenantIDs []string) bool {
+	if c == nil {
+		return false
+	}
+	for _, id := range tenantIDs {
+		if c.Tenants[id].BypassResultsCache {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantCacheBypassMiddleware wraps the given results cache middleware so that requests of tenants bypassing the
+// results cache skip it, going straight to the next handler.
+func tenantCacheBypassMiddleware(limits *TenantLimitsConfig, cacheMiddleware queryrange.Middleware) queryrange.Middleware {
+	return queryrange.MiddlewareFunc(func(next queryrange.Handler) queryrange.Handler {
+		cached := cacheMiddleware.Wrap(next)
+		return queryrange.HandlerFunc(func(ctx context.Context, r queryrange.Request) (queryrange.Response, error) {
+			if tenantIDs, err := tenant.TenantIDs(ctx); err == nil && limits.bypassResultsCache(tenantIDs) {
+				return next.Do(ctx, r)
+			}
+			return cached.Do(ctx, r)
+		})
+	})
+}
@@ -0,0 +1,20 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/pkg/errors"
+)
+
+// errActiveSeriesLimit is returned for samples of new series of a tenant whose head already has the maximum
+// number of active series of the tenant.
+var errActiveSeriesLimit = errors.New("active series limit of the tenant reached")
+
+// activeSeriesLimitError keeps the details of an error caused by the active series limit, e.g. the tenant and the
+// number of dropped series, while its cause is errActiveSeriesLimit.
+type activeSeriesLimitError struct {
+	error
+}
+
+func (e activeSeriesLimitError) Cause() error { return errActiveSeriesLimit }
@@ -43,6 +43,10 @@ type HashringConfig struct {
 	Hashring  string   `json:"hashring,omitempty"`
 	Tenants   []string `json:"tenants,omitempty"`
 	Endpoints []string `json:"endpoints"`
+	// Algorithm overrides the algorithm used to distribute series in the hashring.
+	Algorithm HashringAlgorithm `json:"algorithm,omitempty"`
+	// LoadFactor is the maximum ratio of the load of a node to the mean with the ketama-bounded algorithm.
+	LoadFactor float64 `json:"load_factor,omitempty"`
 }
 
 // ConfigWatcher is able to watch a file containing a hashring configuration
@@ -292,8 +296,21 @@ func readFile(logger log.Logger, path string) ([]byte, error) {
 // parseConfig parses the raw configuration content and returns a HashringConfig.
 func parseConfig(content []byte) ([]HashringConfig, error) {
 	var config []HashringConfig
-	err := json.Unmarshal(content, &config)
-	return config, err
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+
+	for _, c := range config {
+		switch c.Algorithm {
+		case "", AlgorithmHashmod, AlgorithmKetama, AlgorithmKetamaBounded:
+		default:
+			return nil, errors.Errorf("unknown algorithm %q of hashring %q", c.Algorithm, c.Hashring)
+		}
+		if c.LoadFactor != 0 && c.LoadFactor < 1 {
+			return nil, errors.Errorf("load factor %v of hashring %q must not be lower than 1", c.LoadFactor, c.Hashring)
+		}
+	}
+	return config, nil
 }
 
 // hashAsMetricValue generates metric value from hash of data.
@@ -0,0 +1,156 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// errDiskPressure is returned for writes rejected because the local disk usage is too high.
+var errDiskPressure = errors.New("local disk usage too high")
+
+// DiskUsageProbe returns the used fraction of the local storage, from 0 to 1.
+type DiskUsageProbe func() (float64, error)
+
+// NewDiskUsageProbe returns a DiskUsageProbe of the disks the given paths are on, reporting the usage of the fullest one.
+func NewDiskUsageProbe(paths ...string) DiskUsageProbe {
+	return func() (float64, error) {
+		var max float64
+		for _, p := range paths {
+			usage, err := diskUsage(p)
+			if err != nil {
+				return 0, errors.Wrapf(err, "disk usage of %s", p)
+			}
+			if usage > max {
+				max = usage
+			}
+		}
+		return max, nil
+	}
+}
+
+// Disk pressure states, exposed by the thanos_receive_disk_pressure metric.
+const (
+	diskPressureNone = iota
+	// diskPressureOptional is the state in which writes of optional tenants are rejected.
+	diskPressureOptional
+	// diskPressureFull is the state in which writes of all tenants are rejected.
+	diskPressureFull
+)
+
+// DiskPressureMonitor tracks the usage of the local storage to reject writes before the disk fills up. Once the usage
+// reaches the high watermark, writes of all tenants are rejected until it drops below the low watermark. Writes of
+// optional tenants are rejected as soon as the usage reaches the low watermark, to shed their load first.
+type DiskPressureMonitor struct {
+	logger        log.Logger
+	probe         DiskUsageProbe
+	lowWatermark  float64
+	highWatermark float64
+
+	mtx   sync.RWMutex
+	state int
+
+	stateGauge prometheus.Gauge
+	usageGauge prometheus.Gauge
+	rejected   *prometheus.CounterVec
+}
+
+// NewDiskPressureMonitor creates a DiskPressureMonitor with the given watermarks, as used fractions of the local storage.
+func NewDiskPressureMonitor(logger log.Logger, reg prometheus.Registerer, probe DiskUsageProbe, lowWatermark, highWatermark float64) (*DiskPressureMonitor, error) {
+	if lowWatermark <= 0 || highWatermark > 1 || lowWatermark > highWatermark {
+		return nil, errors.Errorf("disk usage watermarks must satisfy 0 < low <= high <= 1, got low %v and high %v", lowWatermark, highWatermark)
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return &DiskPressureMonitor{
+		logger:        logger,
+		probe:         probe,
+		lowWatermark:  lowWatermark,
+		highWatermark: highWatermark,
+		stateGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_disk_pressure",
+			Help: "The disk pressure state: 0 if writes are accepted, 1 if writes of optional tenants are rejected, 2 if writes of all tenants are rejected.",
+		}),
+		usageGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_disk_usage_ratio",
+			Help: "The used fraction of the local storage, as last observed by the disk pressure monitor.",
+		}),
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_disk_pressure_rejected_requests_total",
+			Help: "The number of local writes rejected because of disk pressure.",
+		}, []string{"tenant"}),
+	}, nil
+}
+
+// Update probes the disk usage and updates the disk pressure state accordingly.
+// The state is kept as is if the probe fails.
+func (m *DiskPressureMonitor) Update() error {
+	usage, err := m.probe()
+	if err != nil {
+		return errors.Wrap(err, "probe disk usage")
+	}
+	m.usageGauge.Set(usage)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	prev := m.state
+	switch {
+	case usage >= m.highWatermark:
+		m.state = diskPressureFull
+	case usage < m.lowWatermark:
+		m.state = diskPressureNone
+	case m.state == diskPressureNone:
+		m.state = diskPressureOptional
+	}
+	if m.state != prev {
+		level.Warn(m.logger).Log("msg", "disk pressure state changed", "usage", usage, "state", m.state, "previous", prev)
+	}
+	m.stateGauge.Set(float64(m.state))
+	return nil
+}
+
+// Run updates the disk pressure state every interval until the context is canceled.
+func (m *DiskPressureMonitor) Run(ctx context.Context, interval time.Duration) error {
+	return runutil.Repeat(interval, ctx.Done(), func() error {
+		if err := m.Update(); err != nil {
+			level.Error(m.logger).Log("msg", "failed to update disk pressure state", "err", err)
+		}
+		return nil
+	})
+}
+
+// admitLocalWrite returns errDiskPressure if writes of the tenant to the local storage have to be rejected.
+func (h *Handler) admitLocalWrite(tenant string) error {
+	if h.options.DiskPressure == nil {
+		return nil
+	}
+	optional := h.options.TenantOverrides != nil && h.options.TenantOverrides.ForTenant(tenant).DiskPressureOptional
+	return h.options.DiskPressure.admit(tenant, optional)
+}
+
+// admit returns errDiskPressure if writes of the tenant have to be rejected.
+func (m *DiskPressureMonitor) admit(tenant string, optional bool) error {
+	m.mtx.RLock()
+	state := m.state
+	m.mtx.RUnlock()
+
+	if state == diskPressureFull || (state == diskPressureOptional && optional) {
+		m.rejected.WithLabelValues(tenant).Inc()
+		return errDiskPressure
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package receive
+
+import "syscall"
+
+// diskUsage returns the fraction of the disk of the path which is not available to unprivileged users.
+func diskUsage(path string) (float64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+	if fs.Blocks == 0 {
+		return 0, nil
+	}
+	return 1 - float64(fs.Bavail)/float64(fs.Blocks), nil
+}
@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +33,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
@@ -76,11 +78,41 @@ var (
 	// errConflict is returned whenever an operation fails due to any conflict-type error.
 	errConflict = errors.New("conflict")
 
-	errBadReplica  = errors.New("request replica exceeds receiver replication factor")
-	errNotReady    = errors.New("target not ready")
-	errUnavailable = errors.New("target not available")
+	errBadReplica          = errors.New("request replica exceeds receiver replication factor")
+	errDisallowedMetrics   = errors.New("metric names not allowed for tenant")
+	errTooManyRequests     = errors.New("too many concurrent requests for tenant")
+	errTooManySamples      = errors.New("too many outstanding samples")
+	errTooManyLabels       = errors.New("series exceed the labels limit")
+	errRequestBodyTooLarge = errors.New("request body exceeds the size limit")
+	errNotReady            = errors.New("target not ready")
+	errUnavailable         = errors.New("target not available")
 )
 
+// OutstandingSamplesLimitAction is the action taken on write requests which would exceed the outstanding samples limit.
+type OutstandingSamplesLimitAction string
+
+const (
+	// OutstandingSamplesReject rejects the request with 429 Too Many Requests.
+	OutstandingSamplesReject OutstandingSamplesLimitAction = "reject"
+	// OutstandingSamplesBlock blocks the request until enough outstanding samples are written or the request is canceled.
+	OutstandingSamplesBlock OutstandingSamplesLimitAction = "block"
+)
+
+// LabelsLimitAction is the action taken on series with more labels than the labels limit.
+type LabelsLimitAction string
+
+const (
+	// LabelsLimitReject rejects the whole write request with 400 Bad Request.
+	LabelsLimitReject LabelsLimitAction = "reject"
+	// LabelsLimitDropExtra ingests the series with the labels above the limit replaced by the DroppedLabelsHashLabel
+	// label, so series differing only by dropped labels stay distinct. The metric name is always kept.
+	LabelsLimitDropExtra LabelsLimitAction = "drop-extra"
+)
+
+// DroppedLabelsHashLabel is the label replacing the labels dropped by LabelsLimitDropExtra. Its value is the hash of
+// the dropped labels.
+const DroppedLabelsHashLabel = "dropped_labels_hash"
+
 // Options for the web Handler.
 type Options struct {
 	Writer            *Writer
@@ -97,8 +129,48 @@ type Options struct {
 	TLSConfig         *tls.Config
 	DialOpts          []grpc.DialOption
 	ForwardTimeout    time.Duration
-	RelabelConfigs    []*relabel.Config
-	TSDBStats         TSDBStats
+	// ReadTimeout, WriteTimeout and IdleTimeout configure the remote write HTTP server.
+	// They have the semantics of the respective http.Server fields; 0 means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// MaxHeaderBytes is the maximum size of the headers of remote write requests, with the semantics of the
+	// http.Server field. Requests with larger headers are rejected with 431 before they are handled.
+	MaxHeaderBytes int
+	// MaxBodyBytes is the maximum size of the compressed body of remote write requests. Requests with larger bodies
+	// are rejected with 413 without reading the body further. 0 means no limit.
+	MaxBodyBytes    int64
+	RelabelConfigs  []*relabel.Config
+	TSDBStats       TSDBStats
+	TenantOverrides *TenantOverrides
+	// MaxOutstandingSamples is the maximum number of samples of write requests being handled at once.
+	// 0 means no limit.
+	MaxOutstandingSamples         int64
+	OutstandingSamplesLimitAction OutstandingSamplesLimitAction
+	// MaxLabelsPerSeries is the maximum number of labels of a written series, including the metric name.
+	// 0 means no limit.
+	MaxLabelsPerSeries int
+	LabelsLimitAction  LabelsLimitAction
+	// PartialSuccessDetails makes responses to remote write requests carry WriteDetails as the body.
+	PartialSuccessDetails bool
+	// ShadowHashring is the hashring remote write requests are mirrored to asynchronously once written, e.g. to validate
+	// a new hashring before cutting over to it. Mirrored requests never affect the written ones. nil disables mirroring.
+	ShadowHashring Hashring
+	// ShadowMaxInflightRequests is the maximum number of remote write requests being mirrored at once. Requests above it
+	// are not mirrored. 0 means no limit.
+	ShadowMaxInflightRequests int
+	// DiskPressure rejects local writes while the local disk usage is too high. nil disables it.
+	DiskPressure *DiskPressureMonitor
+	// EnableAdminAPI registers the admin endpoints pausing and resuming the ingestion of tenants.
+	EnableAdminAPI bool
+	// SplitTenantLabelName is the label whose value is the tenant of a written series, instead of the tenant header.
+	// The label is removed from the series, and series without it belong to the tenant of the request. Empty disables it.
+	SplitTenantLabelName string
+	// OTLPPromoteResourceAttributes are the resource attributes of OTLP metrics kept as labels of their series.
+	OTLPPromoteResourceAttributes []string
+	// SplitRequestBytes is the maximum encoded size of the write requests forwarded at once. Larger requests are split
+	// into requests of at most this size, forwarded one after the other. 0 disables splitting.
+	SplitRequestBytes int
 }
 
 // Handler serves a Prometheus remote write receiving HTTP endpoint.
@@ -116,12 +188,29 @@ type Handler struct {
 	peerStates   map[string]*retryState
 	receiverMode ReceiverMode
 
+	tenantRequests     *tenantRequestLimiter
+	outstandingSamples *outstandingSamplesLimiter
+	pausedTenants      *pausedTenants
+
 	forwardRequests   *prometheus.CounterVec
 	replications      *prometheus.CounterVec
 	replicationFactor prometheus.Gauge
 
 	writeSamplesTotal    *prometheus.HistogramVec
 	writeTimeseriesTotal *prometheus.HistogramVec
+	disallowedTimeseries *prometheus.CounterVec
+	limitedRequests      *prometheus.CounterVec
+	samplesLimited       prometheus.Counter
+	labelsLimitedSeries  *prometheus.CounterVec
+
+	shadowInflight        chan struct{}
+	shadowForwardRequests *prometheus.CounterVec
+	shadowDroppedRequests prometheus.Counter
+
+	splitRequests prometheus.Counter
+
+	remoteWriteWritten *prometheus.CounterVec
+	remoteWriteDropped *prometheus.CounterVec
 }
 
 func NewHandler(logger log.Logger, o *Options) *Handler {
@@ -141,6 +230,11 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 		options:      o,
 		peers:        newPeerGroup(o.DialOpts...),
 		receiverMode: o.ReceiverMode,
+		tenantRequests: &tenantRequestLimiter{
+			inFlight: map[string]int{},
+		},
+		outstandingSamples: newOutstandingSamplesLimiter(o.MaxOutstandingSamples),
+		pausedTenants:      newPausedTenants(registerer),
 		expBackoff: backoff.Backoff{
 			Factor: 2,
 			Min:    100 * time.Millisecond,
@@ -183,12 +277,86 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 				Buckets:   []float64{10, 50, 100, 500, 1000, 5000, 10000},
 			}, []string{"code", "tenant"},
 		),
+		disallowedTimeseries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_disallowed_timeseries_total",
+				Help: "The number of timeseries dropped or rejected because their metric name is not in the tenant allowlist.",
+			}, []string{"tenant", "action"},
+		),
+		limitedRequests: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_concurrency_limited_requests_total",
+				Help: "The number of remote write requests rejected because the tenant exceeded its concurrent requests limit.",
+			}, []string{"tenant"},
+		),
+		samplesLimited: promauto.With(registerer).NewCounter(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_outstanding_samples_limited_requests_total",
+				Help: "The number of remote write requests rejected because they would exceed the outstanding samples limit.",
+			},
+		),
+		labelsLimitedSeries: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_labels_limited_timeseries_total",
+				Help: "The number of timeseries rejected or with labels dropped because they exceeded the labels per series limit.",
+			}, []string{"tenant", "action"},
+		),
+		shadowForwardRequests: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_shadow_forward_requests_total",
+				Help: "The number of write requests mirrored to endpoints of the shadow hashring.",
+			}, []string{"result"},
+		),
+		shadowDroppedRequests: promauto.With(registerer).NewCounter(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_shadow_dropped_requests_total",
+				Help: "The number of remote write requests not mirrored to the shadow hashring because too many were being mirrored already.",
+			},
+		),
+		splitRequests: promauto.With(registerer).NewCounter(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_split_requests_total",
+				Help: "The number of write requests split into smaller requests before being forwarded, because they exceeded the split size.",
+			},
+		),
+		remoteWriteWritten: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_remote_write_written_total",
+				Help: "The number of samples and exemplars of remote write requests which were written, by remote write protocol version.",
+			}, []string{"version", "type"},
+		),
+		remoteWriteDropped: promauto.With(registerer).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "thanos_receive_remote_write_dropped_total",
+				Help: "The number of samples, exemplars and native histograms of successful remote write requests which were not written, e.g. as they were dropped by relabeling, by remote write protocol version.",
+			}, []string{"version", "type"},
+		),
+	}
+	if o.ShadowMaxInflightRequests > 0 {
+		h.shadowInflight = make(chan struct{}, o.ShadowMaxInflightRequests)
 	}
 
+	promauto.With(registerer).NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "thanos_receive_outstanding_samples",
+			Help: "The number of samples of remote write requests currently being handled.",
+		}, func() float64 { return float64(h.outstandingSamples.load()) },
+	)
+	promauto.With(registerer).NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "thanos_receive_outstanding_samples_limit",
+			Help: "The maximum number of samples of remote write requests handled at once. 0 means no limit.",
+		}, func() float64 { return float64(o.MaxOutstandingSamples) },
+	)
+
 	h.forwardRequests.WithLabelValues(labelSuccess)
 	h.forwardRequests.WithLabelValues(labelError)
 	h.replications.WithLabelValues(labelSuccess)
 	h.replications.WithLabelValues(labelError)
+	if o.ShadowHashring != nil {
+		h.shadowForwardRequests.WithLabelValues(labelSuccess)
+		h.shadowForwardRequests.WithLabelValues(labelError)
+	}
 
 	if o.ReplicationFactor > 1 {
 		h.replicationFactor.Set(float64(o.ReplicationFactor))
@@ -227,6 +395,22 @@ func NewHandler(logger log.Logger, o *Options) *Handler {
 		),
 	)
 
+	h.router.Post(
+		"/otlp/v1/metrics",
+		instrf(
+			"receive_otlp",
+			readyf(
+				middleware.RequestID(
+					http.HandlerFunc(h.receiveOTLPHTTP),
+				),
+			),
+		),
+	)
+
+	if o.EnableAdminAPI {
+		h.registerAdminAPI(instrf)
+	}
+
 	statusAPI := statusapi.New(statusapi.Options{
 		GetStats: h.getStats,
 		Registry: h.options.Registry,
@@ -297,6 +481,15 @@ func (h *Handler) getStats(r *http.Request, statsByLabelName string) ([]statusap
 	return h.options.TSDBStats.TenantStats(statsByLabelName, tenantID), nil
 }
 
+// RefreshPeerDNS resolves the addresses of the peers requests are forwarded to again at every interval, reconnecting
+// to the peers whose IPs changed, until the context is canceled.
+func (h *Handler) RefreshPeerDNS(ctx context.Context, interval time.Duration) error {
+	return runutil.Repeat(interval, ctx.Done(), func() error {
+		h.peers.refreshDNS(ctx, h.logger, h.options.ForwardTimeout)
+		return nil
+	})
+}
+
 // Close stops the Handler.
 func (h *Handler) Close() {
 	if h.listener != nil {
@@ -319,13 +512,7 @@ func (h *Handler) Run() error {
 		conntrack.TrackWithName("http"),
 		conntrack.TrackWithTracing())
 
-	errlog := stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0)
-
-	httpSrv := &http.Server{
-		Handler:   h.router,
-		ErrorLog:  errlog,
-		TLSConfig: h.options.TLSConfig,
-	}
+	httpSrv := h.newHTTPServer()
 
 	if h.options.TLSConfig != nil {
 		level.Info(h.logger).Log("msg", "Serving HTTPS", "address", h.options.ListenAddress)
@@ -337,6 +524,22 @@ func (h *Handler) Run() error {
 	return httpSrv.Serve(h.listener)
 }
 
+// newHTTPServer returns the HTTP server serving the Handler's endpoints, with the configured timeouts.
+// The remote write endpoint is served only by this server, so its timeouts do not affect the other HTTP endpoints of receive.
+func (h *Handler) newHTTPServer() *http.Server {
+	errlog := stdlog.New(log.NewStdlibAdapter(level.Error(h.logger)), "", 0)
+
+	return &http.Server{
+		Handler:        h.router,
+		ErrorLog:       errlog,
+		TLSConfig:      h.options.TLSConfig,
+		ReadTimeout:    h.options.ReadTimeout,
+		WriteTimeout:   h.options.WriteTimeout,
+		IdleTimeout:    h.options.IdleTimeout,
+		MaxHeaderBytes: h.options.MaxHeaderBytes,
+	}
+}
+
 // replica encapsulates the replica number of a request and if the request is
 // already replicated.
 type replica struct {
@@ -370,17 +573,105 @@ func (h *Handler) handleRequest(ctx context.Context, rep uint64, tenant string,
 		r.n--
 	}
 
+	if h.options.SplitRequestBytes > 0 && wreq.Size() > h.options.SplitRequestBytes {
+		return h.forwardSplit(ctx, tenant, r, wreq)
+	}
+
 	// Forward any time series as necessary. All time series
 	// destined for the local node will be written to the receiver.
 	// Time series will be replicated as necessary.
 	return h.forward(ctx, tenant, r, wreq)
 }
 
+// forwardSplit splits the write request into requests of at most SplitRequestBytes and forwards them one after the
+// other, so that the samples of series split across requests are written in order. All requests are forwarded even
+// if some fail. The cause of the failure of each request is returned, so that the cause of the whole request is the
+// most common one.
+func (h *Handler) forwardSplit(ctx context.Context, tenant string, r replica, wreq *prompb.WriteRequest) error {
+	h.splitRequests.Inc()
+
+	var errs errutil.MultiError
+	for _, sub := range splitWriteRequest(wreq, h.options.SplitRequestBytes) {
+		if err := h.forward(ctx, tenant, r, sub); err != nil {
+			errs.Add(determineWriteErrorCause(err, 1))
+		}
+	}
+	return errs.Err()
+}
+
 func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
-	var err error
 	span, ctx := tracing.StartSpan(r.Context(), "receive_http")
 	defer span.Finish()
 
+	version, err := remoteWriteVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var received writeCounts
+	details, code, err := h.receive(ctx, r, func(r *http.Request, body []byte) (*prompb.WriteRequest, error) {
+		if version == remoteWriteV2 {
+			wreq, counts, err := decodeRemoteWriteV2Request(body)
+			received = counts
+			return wreq, err
+		}
+		wreq, err := decodeRemoteWriteRequest(r, body)
+		if err == nil {
+			received = countWriteRequest(wreq)
+		}
+		return wreq, err
+	})
+
+	var written writeCounts
+	if details != nil {
+		written = details.written
+	}
+	h.countRemoteWrite(version, received, written, err == nil)
+	if version == remoteWriteV2 {
+		setWrittenHeaders(w, written)
+	}
+	h.respond(w, details, err, code)
+}
+
+// countRemoteWrite counts the samples, exemplars and native histograms of a remote write request which were written.
+// Those of successful requests which were not written, e.g. as they were dropped by relabeling, are counted as dropped.
+func (h *Handler) countRemoteWrite(version string, received, written writeCounts, success bool) {
+	h.remoteWriteWritten.WithLabelValues(version, "samples").Add(float64(written.samples))
+	h.remoteWriteWritten.WithLabelValues(version, "exemplars").Add(float64(written.exemplars))
+	if !success {
+		return
+	}
+	h.remoteWriteDropped.WithLabelValues(version, "samples").Add(float64(received.samples - written.samples))
+	h.remoteWriteDropped.WithLabelValues(version, "exemplars").Add(float64(received.exemplars - written.exemplars))
+	h.remoteWriteDropped.WithLabelValues(version, "histograms").Add(float64(received.histograms - written.histograms))
+}
+
+// writeRequestDecoder decodes the body of a write request into a remote write request.
+type writeRequestDecoder func(r *http.Request, body []byte) (*prompb.WriteRequest, error)
+
+// decodeRemoteWriteRequest decodes the snappy compressed protobuf body of a Prometheus remote write request.
+func decodeRemoteWriteRequest(_ *http.Request, body []byte) (*prompb.WriteRequest, error) {
+	reqBuf, err := s2.Decode(nil, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "snappy decode error")
+	}
+
+	// NOTE: Due to zero copy ZLabels, Labels used from WriteRequests keeps memory
+	// from the whole request. Ensure that we always copy those when we want to
+	// store them for longer time.
+	var wreq prompb.WriteRequest
+	if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
+		return nil, err
+	}
+	return &wreq, nil
+}
+
+// receive reads the write request of the HTTP request, decodes it with decode and writes it to its tenants.
+// It returns the details and the status code of the response. Requests rejected before any series was written
+// have no details.
+func (h *Handler) receive(ctx context.Context, r *http.Request, decode writeRequestDecoder) (*WriteDetails, int, error) {
+	var err error
 	tenant := r.Header.Get(h.options.TenantHeader)
 	if tenant == "" {
 		tenant = h.options.DefaultTenantID
@@ -390,13 +681,28 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		tenant, err = h.getTenantFromCertificate(r)
 		if err != nil {
 			// This must hard fail to ensure hard tenancy when feature is enabled.
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return nil, http.StatusBadRequest, err
 		}
 	}
 
 	tLogger := log.With(h.logger, "tenant", tenant)
 
+	// Tenants of requests split by a label are only known once the request is decoded.
+	splitByLabel := h.options.SplitTenantLabelName != ""
+	if !splitByLabel {
+		release, code, err := h.admitTenant(tenant)
+		if err != nil {
+			return nil, code, err
+		}
+		defer release()
+	}
+
+	maxBodyBytes := h.options.MaxBodyBytes
+	if maxBodyBytes > 0 && r.ContentLength > maxBodyBytes {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", errRequestBodyTooLarge, "size", r.ContentLength, "limit", maxBodyBytes)
+		return nil, http.StatusRequestEntityTooLarge, errRequestBodyTooLarge
+	}
+
 	// ioutil.ReadAll dynamically adjust the byte slice for read data, starting from 512B.
 	// Since this is receive hot path, grow upfront saving allocations and CPU time.
 	compressed := bytes.Buffer{}
@@ -405,34 +711,31 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		compressed.Grow(512)
 	}
-	_, err = io.Copy(&compressed, r.Body)
-	if err != nil {
-		http.Error(w, errors.Wrap(err, "read compressed request body").Error(), http.StatusInternalServerError)
-		return
+	body := io.Reader(r.Body)
+	if maxBodyBytes > 0 {
+		// Bodies of unknown size are read up to one byte over the limit, to tell whether they exceed it.
+		body = io.LimitReader(r.Body, maxBodyBytes+1)
 	}
-
-	reqBuf, err := s2.Decode(nil, compressed.Bytes())
+	_, err = io.Copy(&compressed, body)
 	if err != nil {
-		level.Error(tLogger).Log("msg", "snappy decode error", "err", err)
-		http.Error(w, errors.Wrap(err, "snappy decode error").Error(), http.StatusBadRequest)
-		return
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "read compressed request body")
+	}
+	if maxBodyBytes > 0 && int64(compressed.Len()) > maxBodyBytes {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", errRequestBodyTooLarge, "limit", maxBodyBytes)
+		return nil, http.StatusRequestEntityTooLarge, errRequestBodyTooLarge
 	}
 
-	// NOTE: Due to zero copy ZLabels, Labels used from WriteRequests keeps memory
-	// from the whole request. Ensure that we always copy those when we want to
-	// store them for longer time.
-	var wreq prompb.WriteRequest
-	if err := proto.Unmarshal(reqBuf, &wreq); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	wreq, err := decode(r, compressed.Bytes())
+	if err != nil {
+		level.Debug(tLogger).Log("msg", "write request decode error", "err", err)
+		return nil, http.StatusBadRequest, err
 	}
 
 	rep := uint64(0)
 	// If the header is empty, we assume the request is not yet replicated.
 	if replicaRaw := r.Header.Get(h.options.ReplicaHeader); replicaRaw != "" {
 		if rep, err = strconv.ParseUint(replicaRaw, 10, 64); err != nil {
-			http.Error(w, "could not parse replica header", http.StatusBadRequest)
-			return
+			return nil, http.StatusBadRequest, errors.New("could not parse replica header")
 		}
 	}
 
@@ -443,23 +746,174 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 		if len(wreq.Metadata) > 0 {
 			// TODO(bwplotka): Do we need this error message?
 			level.Debug(tLogger).Log("msg", "only metadata from client; metadata ingestion not supported; skipping")
-			return
+			return nil, http.StatusOK, nil
 		}
 		level.Debug(tLogger).Log("msg", "empty remote write request; client bug or newer remote write protocol used?; skipping")
-		return
+		return nil, http.StatusOK, nil
 	}
 
 	// Apply relabeling configs.
-	h.relabel(&wreq)
+	h.relabel(tenant, wreq)
 	if len(wreq.Timeseries) == 0 {
 		level.Debug(tLogger).Log("msg", "remote write request dropped due to relabeling.")
+		return nil, http.StatusOK, nil
+	}
+
+	if splitByLabel {
+		return h.writeSplitTenants(ctx, rep, tenant, wreq)
+	}
+	return h.writeTenant(ctx, rep, tenant, wreq)
+}
+
+// respond writes the response of a write request. Requests rejected before any series was written get a plain text error.
+func (h *Handler) respond(w http.ResponseWriter, details *WriteDetails, err error, code int) {
+	if details == nil {
+		if err != nil {
+			http.Error(w, err.Error(), code)
+		}
 		return
 	}
+	h.writeResponse(w, details, err, code)
+}
+
+// writeSplitTenants writes the series of the remote write request to the tenants named by their split tenant label.
+// Every tenant is admitted and limited as if its series were sent in a request of their own. It returns the merged
+// details, all errors and the highest status code of the tenants, so that retryable errors take precedence.
+func (h *Handler) writeSplitTenants(ctx context.Context, rep uint64, defaultTenant string, wreq *prompb.WriteRequest) (*WriteDetails, int, error) {
+	wreqs, err := splitTenants(wreq, h.options.SplitTenantLabelName, defaultTenant)
+	if err != nil {
+		level.Debug(h.logger).Log("msg", "remote write request rejected", "err", err)
+		return nil, http.StatusBadRequest, err
+	}
+
+	tenants := make([]string, 0, len(wreqs))
+	for tenant := range wreqs {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	var (
+		details = &WriteDetails{}
+		errs    errutil.MultiError
+		code    = http.StatusOK
+	)
+	for _, tenant := range tenants {
+		tDetails, tCode, tErr := h.writeSplitTenant(ctx, rep, tenant, wreqs[tenant])
+		if tDetails != nil {
+			details.AcceptedSeries += tDetails.AcceptedSeries
+			details.Rejected = append(details.Rejected, tDetails.Rejected...)
+			details.written.add(tDetails.written)
+		}
+		if tErr != nil {
+			errs.Add(errors.Wrapf(tErr, "tenant %s", tenant))
+		}
+		if tCode > code {
+			code = tCode
+		}
+	}
+	return details, code, errs.Err()
+}
 
+func (h *Handler) writeSplitTenant(ctx context.Context, rep uint64, tenant string, wreq *prompb.WriteRequest) (*WriteDetails, int, error) {
+	release, code, err := h.admitTenant(tenant)
+	if err != nil {
+		return nil, code, err
+	}
+	defer release()
+	return h.writeTenant(ctx, rep, tenant, wreq)
+}
+
+// splitTenants splits the series of the remote write request by the value of their tenant label, which is removed
+// from them. Series without the label belong to the default tenant.
+func splitTenants(wreq *prompb.WriteRequest, labelName, defaultTenant string) (map[string]*prompb.WriteRequest, error) {
+	wreqs := map[string]*prompb.WriteRequest{}
+	for _, ts := range wreq.Timeseries {
+		tenant := defaultTenant
+		for i, l := range ts.Labels {
+			if l.Name != labelName {
+				continue
+			}
+			if l.Value != "" {
+				// Tenants outlive the request, so their names must not keep its memory.
+				tenant = string([]byte(l.Value))
+			}
+			ts.Labels = append(ts.Labels[:i:i], ts.Labels[i+1:]...)
+			break
+		}
+		if tenant == "" || tenant == "." || tenant == ".." || strings.ContainsAny(tenant, "/\\") {
+			return nil, errors.Errorf("invalid tenant %q in label %s", tenant, labelName)
+		}
+
+		tReq, ok := wreqs[tenant]
+		if !ok {
+			tReq = &prompb.WriteRequest{}
+			wreqs[tenant] = tReq
+		}
+		tReq.Timeseries = append(tReq.Timeseries, ts)
+	}
+	return wreqs, nil
+}
+
+// admitTenant admits a remote write request of the tenant, unless the tenant is paused or has too many requests
+// in flight. The returned function has to be called once the request is handled.
+func (h *Handler) admitTenant(tenant string) (release func(), code int, err error) {
+	tLogger := log.With(h.logger, "tenant", tenant)
+
+	if err := h.pausedTenants.admit(tenant); err != nil {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", err)
+		return nil, http.StatusTooManyRequests, err
+	}
+
+	if h.options.TenantOverrides != nil {
+		limit := h.options.TenantOverrides.ForTenant(tenant).MaxConcurrentRequests
+		if !h.tenantRequests.tryAcquire(tenant, limit) {
+			level.Debug(tLogger).Log("msg", "remote write request rejected", "err", errTooManyRequests, "limit", limit)
+			h.limitedRequests.WithLabelValues(tenant).Inc()
+			return nil, http.StatusTooManyRequests, errTooManyRequests
+		}
+		return func() { h.tenantRequests.release(tenant) }, 0, nil
+	}
+	return func() {}, 0, nil
+}
+
+// writeTenant enforces the limits of the tenant on the decoded remote write request and writes it.
+// It returns the details and the status code of the response.
+func (h *Handler) writeTenant(ctx context.Context, rep uint64, tenant string, wreq *prompb.WriteRequest) (*WriteDetails, int, error) {
+	tLogger := log.With(h.logger, "tenant", tenant)
+	details := &WriteDetails{}
+
+	// Enforce the tenant metric name allowlist.
+	if err := h.filterDisallowedMetrics(tenant, wreq, details); err != nil {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", err)
+		return details, http.StatusBadRequest, err
+	}
+	if len(wreq.Timeseries) == 0 {
+		level.Debug(tLogger).Log("msg", "remote write request dropped due to metric name allowlist.")
+		return details, http.StatusOK, nil
+	}
+
+	// Enforce the labels per series limit.
+	if err := h.limitLabels(tenant, wreq, details); err != nil {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", err)
+		return details, http.StatusBadRequest, err
+	}
+
+	counts := countWriteRequest(wreq)
+	totalSamples := counts.samples
+
+	if err := h.outstandingSamples.acquire(ctx, int64(totalSamples), h.options.OutstandingSamplesLimitAction == OutstandingSamplesBlock); err != nil {
+		level.Debug(tLogger).Log("msg", "remote write request rejected", "err", err, "samples", totalSamples)
+		h.samplesLimited.Inc()
+		return details, http.StatusTooManyRequests, err
+	}
+	defer h.outstandingSamples.release(int64(totalSamples))
+
+	details.AcceptedSeries = len(wreq.Timeseries)
 	responseStatusCode := http.StatusOK
-	if err = h.handleRequest(ctx, rep, tenant, &wreq); err != nil {
+	err := h.handleRequest(ctx, rep, tenant, wreq)
+	if err != nil {
 		level.Debug(tLogger).Log("msg", "failed to handle request", "err", err)
-		switch determineWriteErrorCause(err, 1) {
+		switch errors.Cause(determineWriteErrorCause(err, 1)) {
 		case errNotReady:
 			responseStatusCode = http.StatusServiceUnavailable
 		case errUnavailable:
@@ -468,18 +922,22 @@ func (h *Handler) receiveHTTP(w http.ResponseWriter, r *http.Request) {
 			responseStatusCode = http.StatusConflict
 		case errBadReplica:
 			responseStatusCode = http.StatusBadRequest
+		case errActiveSeriesLimit, errTenantPaused:
+			responseStatusCode = http.StatusTooManyRequests
 		default:
 			level.Error(tLogger).Log("err", err, "msg", "internal server error")
 			responseStatusCode = http.StatusInternalServerError
 		}
-		http.Error(w, err.Error(), responseStatusCode)
+	} else {
+		details.written = counts
+		if h.options.ShadowHashring != nil && rep == 0 {
+			// Requests replicated by other receivers were mirrored by them already.
+			h.shadowWrite(tenant, wreq)
+		}
 	}
 	h.writeTimeseriesTotal.WithLabelValues(strconv.Itoa(responseStatusCode), tenant).Observe(float64(len(wreq.Timeseries)))
-	totalSamples := 0
-	for _, timeseries := range wreq.Timeseries {
-		totalSamples += len(timeseries.Samples)
-	}
 	h.writeSamplesTotal.WithLabelValues(strconv.Itoa(responseStatusCode), tenant).Observe(float64(totalSamples))
+	return details, responseStatusCode, err
 }
 
 // forward accepts a write request, batches its time series by
@@ -599,10 +1057,12 @@ func (h *Handler) fanoutForward(pctx context.Context, tenant string, replicas ma
 			go func(endpoint string) {
 				defer wg.Done()
 
-				var err error
-				tracing.DoInSpan(fctx, "receive_tsdb_write", func(_ context.Context) {
-					err = h.writer.Write(fctx, tenant, wreqs[endpoint])
-				})
+				err := h.admitLocalWrite(tenant)
+				if err == nil {
+					tracing.DoInSpan(fctx, "receive_tsdb_write", func(_ context.Context) {
+						err = h.writer.Write(fctx, tenant, wreqs[endpoint])
+					})
+				}
 				if err != nil {
 					// When a MultiError is added to another MultiError, the error slices are concatenated, not nested.
 					// To avoid breaking the counting logic, we need to flatten the error.
@@ -769,11 +1229,17 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 	span, ctx := tracing.StartSpan(ctx, "receive_grpc")
 	defer span.Finish()
 
+	// Replicated requests are checked too, so a tenant paused on this receiver isn't written by others.
+	if err := h.pausedTenants.admit(r.Tenant); err != nil {
+		level.Debug(h.logger).Log("msg", "remote write request rejected", "tenant", r.Tenant, "err", err)
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
 	err := h.handleRequest(ctx, uint64(r.Replica), r.Tenant, &prompb.WriteRequest{Timeseries: r.Timeseries})
 	if err != nil {
 		level.Debug(h.logger).Log("msg", "failed to handle request", "err", err)
 	}
-	switch determineWriteErrorCause(err, 1) {
+	switch errors.Cause(determineWriteErrorCause(err, 1)) {
 	case nil:
 		return &storepb.WriteResponse{}, nil
 	case errNotReady:
@@ -784,19 +1250,30 @@ func (h *Handler) RemoteWrite(ctx context.Context, r *storepb.WriteRequest) (*st
 		return nil, status.Error(codes.AlreadyExists, err.Error())
 	case errBadReplica:
 		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errActiveSeriesLimit:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errTenantPaused:
+		return nil, status.Error(codes.ResourceExhausted, errTenantPaused.Error())
 	default:
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 }
 
-// relabel relabels the time series labels in the remote write request.
-func (h *Handler) relabel(wreq *prompb.WriteRequest) {
-	if len(h.options.RelabelConfigs) == 0 {
+// relabel relabels the time series labels in the remote write request with the relabel configs of the tenant,
+// falling back to the global ones.
+func (h *Handler) relabel(tenant string, wreq *prompb.WriteRequest) {
+	relabelConfigs := h.options.RelabelConfigs
+	if h.options.TenantOverrides != nil {
+		if tenantConfigs := h.options.TenantOverrides.ForTenant(tenant).RelabelConfigs; len(tenantConfigs) > 0 {
+			relabelConfigs = tenantConfigs
+		}
+	}
+	if len(relabelConfigs) == 0 {
 		return
 	}
 	timeSeries := make([]prompb.TimeSeries, 0, len(wreq.Timeseries))
 	for _, ts := range wreq.Timeseries {
-		lbls := relabel.Process(labelpb.ZLabelsToPromLabels(ts.Labels), h.options.RelabelConfigs...)
+		lbls := relabel.Process(labelpb.ZLabelsToPromLabels(ts.Labels), relabelConfigs...)
 		if lbls == nil {
 			continue
 		}
@@ -806,6 +1283,207 @@ func (h *Handler) relabel(wreq *prompb.WriteRequest) {
 	wreq.Timeseries = timeSeries
 }
 
+// filterDisallowedMetrics removes the time series whose metric name is not allowed for the tenant from
+// the remote write request. If the tenant is configured to reject such requests, an error is returned instead.
+// Removed or rejected series are recorded in details.
+func (h *Handler) filterDisallowedMetrics(tenant string, wreq *prompb.WriteRequest, details *WriteDetails) error {
+	if h.options.TenantOverrides == nil {
+		return nil
+	}
+	tc := h.options.TenantOverrides.ForTenant(tenant)
+
+	var disallowed []string
+	timeSeries := wreq.Timeseries[:0]
+	for _, ts := range wreq.Timeseries {
+		name := metricName(ts.Labels)
+		if tc.IsMetricAllowed(name) {
+			timeSeries = append(timeSeries, ts)
+			continue
+		}
+		disallowed = append(disallowed, name)
+	}
+	if len(disallowed) == 0 {
+		return nil
+	}
+
+	h.disallowedTimeseries.WithLabelValues(tenant, string(tc.DisallowedMetricsAction)).Add(float64(len(disallowed)))
+	details.reject(RejectionDisallowedMetric, string(tc.DisallowedMetricsAction), len(disallowed))
+	if tc.DisallowedMetricsAction == DisallowedMetricsReject {
+		return errors.Wrapf(errDisallowedMetrics, "%d series, e.g. %q", len(disallowed), disallowed[0])
+	}
+	wreq.Timeseries = timeSeries
+	return nil
+}
+
+// limitLabels enforces the labels per series limit on the remote write request. Series above the limit either
+// cause the whole request to be rejected, the default, or get their extra labels dropped, depending on the configured
+// action. When dropping, the metric name and the first labels in the sorted order are kept, and the dropped ones are
+// replaced by their hash.
+func (h *Handler) limitLabels(tenant string, wreq *prompb.WriteRequest, details *WriteDetails) error {
+	limit := h.options.MaxLabelsPerSeries
+	if limit <= 0 {
+		return nil
+	}
+	action := h.options.LabelsLimitAction
+	if action == "" {
+		action = LabelsLimitReject
+	}
+
+	var (
+		limited int
+		example []labelpb.ZLabel
+	)
+	for i, ts := range wreq.Timeseries {
+		if len(ts.Labels) <= limit {
+			continue
+		}
+		limited++
+		if example == nil {
+			example = ts.Labels
+		}
+		if action == LabelsLimitReject {
+			continue
+		}
+		wreq.Timeseries[i].Labels = truncateLabels(ts.Labels, limit)
+	}
+	if limited == 0 {
+		return nil
+	}
+
+	h.labelsLimitedSeries.WithLabelValues(tenant, string(action)).Add(float64(limited))
+	details.reject(RejectionTooManyLabels, string(action), limited)
+	if action == LabelsLimitReject {
+		return errors.Wrapf(errTooManyLabels, "%d series with more than %d labels, e.g. %s", limited, limit, labelpb.ZLabelsToPromLabels(example).String())
+	}
+	return nil
+}
+
+// truncateLabels returns the sorted labels reduced to limit labels: the metric name, the first other ones and the
+// DroppedLabelsHashLabel label with the hash of the dropped ones, so truncated series don't collide. The limit must
+// leave room for the metric name and the hash.
+func truncateLabels(lbls []labelpb.ZLabel, limit int) []labelpb.ZLabel {
+	// One label is taken by the hash.
+	others := limit - 1
+	if metricName(lbls) != "" {
+		others--
+	}
+
+	res := make([]labelpb.ZLabel, 0, limit)
+	var dropped labels.Labels
+	for _, l := range lbls {
+		if l.Name != labels.MetricName {
+			if others <= 0 {
+				dropped = append(dropped, labels.Label{Name: l.Name, Value: l.Value})
+				continue
+			}
+			others--
+		}
+		res = append(res, l)
+	}
+	res = append(res, labelpb.ZLabel{Name: DroppedLabelsHashLabel, Value: strconv.FormatUint(dropped.Hash(), 16)})
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// metricName returns the value of the metric name label.
+func metricName(lbls []labelpb.ZLabel) string {
+	for _, l := range lbls {
+		if l.Name == labels.MetricName {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// tenantRequestLimiter keeps track of the in-flight requests of each tenant.
+type tenantRequestLimiter struct {
+	mtx      sync.Mutex
+	inFlight map[string]int
+}
+
+// tryAcquire registers a new in-flight request for the tenant, unless it already has
+// limit requests in flight. A limit of 0 or lower means no limit.
+func (l *tenantRequestLimiter) tryAcquire(tenant string, limit int) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if limit > 0 && l.inFlight[tenant] >= limit {
+		return false
+	}
+	l.inFlight[tenant]++
+	return true
+}
+
+// release marks one in-flight request of the tenant as done.
+func (l *tenantRequestLimiter) release(tenant string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.inFlight[tenant]--
+	if l.inFlight[tenant] <= 0 {
+		delete(l.inFlight, tenant)
+	}
+}
+
+// outstandingSamplesLimiter keeps track of the samples of write requests being handled.
+type outstandingSamplesLimiter struct {
+	limit int64
+
+	mtx         sync.Mutex
+	outstanding int64
+	// released is closed and replaced every time samples are released, waking up blocked requests.
+	released chan struct{}
+}
+
+func newOutstandingSamplesLimiter(limit int64) *outstandingSamplesLimiter {
+	return &outstandingSamplesLimiter{limit: limit, released: make(chan struct{})}
+}
+
+// acquire registers n new outstanding samples. If that would exceed the limit, it either returns
+// errTooManySamples or, if block is true, waits until enough samples are released or ctx is done.
+// A request is always admitted if there are no outstanding samples, so requests larger than
+// the limit are handled one at a time instead of never.
+func (l *outstandingSamplesLimiter) acquire(ctx context.Context, n int64, block bool) error {
+	for {
+		l.mtx.Lock()
+		if l.limit <= 0 || l.outstanding == 0 || l.outstanding+n <= l.limit {
+			l.outstanding += n
+			l.mtx.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mtx.Unlock()
+
+		if !block {
+			return errTooManySamples
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(errTooManySamples, ctx.Err().Error())
+		case <-released:
+		}
+	}
+}
+
+// release marks n outstanding samples as handled.
+func (l *outstandingSamplesLimiter) release(n int64) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.outstanding -= n
+	if l.limit > 0 {
+		close(l.released)
+		l.released = make(chan struct{})
+	}
+}
+
+func (l *outstandingSamplesLimiter) load() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.outstanding
+}
+
 // isConflict returns whether or not the given error represents a conflict.
 func isConflict(err error) bool {
 	if err == nil {
@@ -815,6 +1493,8 @@ func isConflict(err error) bool {
 		err == storage.ErrDuplicateSampleForTimestamp ||
 		err == storage.ErrOutOfOrderSample ||
 		err == storage.ErrOutOfBounds ||
+		err == errSampleBeyondReorderingTolerance ||
+		err == errInvalidLabels ||
 		status.Code(err) == codes.AlreadyExists
 }
 
@@ -828,9 +1508,18 @@ func isNotReady(err error) bool {
 // isUnavailable returns whether or not the given error represents an unavailable error.
 func isUnavailable(err error) bool {
 	return err == errUnavailable ||
+		err == errDiskPressure ||
 		status.Code(err) == codes.Unavailable
 }
 
+// isActiveSeriesLimited returns whether or not the given error was caused by the active series limit of a tenant.
+// Other receivers report it as a ResourceExhausted error carrying the message of errActiveSeriesLimit, while other
+// ResourceExhausted errors, e.g. of paused tenants or too large messages, are not caused by the limit.
+func isActiveSeriesLimited(err error) bool {
+	return err == errActiveSeriesLimit ||
+		(status.Code(err) == codes.ResourceExhausted && strings.HasSuffix(status.Convert(err).Message(), errActiveSeriesLimit.Error()))
+}
+
 // retryState encapsulates the number of request attempt made against a peer and,
 // next allowed time for the next attempt.
 type retryState struct {
@@ -873,18 +1562,28 @@ func determineWriteErrorCause(err error, threshold int) error {
 		{err: errConflict, cause: isConflict},
 		{err: errNotReady, cause: isNotReady},
 		{err: errUnavailable, cause: isUnavailable},
+		{err: errTenantPaused, cause: isTenantPaused},
+		{err: errActiveSeriesLimit, cause: isActiveSeriesLimited},
 	}
+	var firstLimited error
 	for _, exp := range expErrs {
 		exp.count = 0
 		for _, err := range errs {
 			if exp.cause(errors.Cause(err)) {
 				exp.count++
+				if exp.err == errActiveSeriesLimit && firstLimited == nil {
+					firstLimited = err
+				}
 			}
 		}
 	}
 	// Determine which error occurred most.
 	sort.Sort(sort.Reverse(expErrs))
 	if exp := expErrs[0]; exp.count >= threshold {
+		if exp.err == errActiveSeriesLimit {
+			// Keep which tenant and how many series were dropped, for the response to the client.
+			return activeSeriesLimitError{firstLimited}
+		}
 		return exp.err
 	}
 
@@ -893,20 +1592,28 @@ func determineWriteErrorCause(err error, threshold int) error {
 
 func newPeerGroup(dialOpts ...grpc.DialOption) *peerGroup {
 	return &peerGroup{
-		dialOpts: dialOpts,
-		cache:    map[string]storepb.WriteableStoreClient{},
-		m:        sync.RWMutex{},
-		dialer:   grpc.DialContext,
+		dialOpts:   dialOpts,
+		cache:      map[string]storepb.WriteableStoreClient{},
+		conns:      map[string]*grpc.ClientConn{},
+		resolved:   map[string][]string{},
+		m:          sync.RWMutex{},
+		dialer:     grpc.DialContext,
+		lookupHost: net.DefaultResolver.LookupHost,
 	}
 }
 
 type peerGroup struct {
 	dialOpts []grpc.DialOption
 	cache    map[string]storepb.WriteableStoreClient
+	// conns are the connections of the cached clients, and resolved the sorted IPs of the host of their address,
+	// as of the last DNS refresh.
+	conns    map[string]*grpc.ClientConn
+	resolved map[string][]string
 	m        sync.RWMutex
 
-	// dialer is used for testing.
-	dialer func(ctx context.Context, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error)
+	// dialer and lookupHost are used for testing.
+	dialer     func(ctx context.Context, target string, opts ...grpc.DialOption) (conn *grpc.ClientConn, err error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
 }
 
 func (p *peerGroup) get(ctx context.Context, addr string) (storepb.WriteableStoreClient, error) {
@@ -932,9 +1639,57 @@ func (p *peerGroup) get(ctx context.Context, addr string) (storepb.WriteableStor
 
 	client := storepb.NewWriteableStoreClient(conn)
 	p.cache[addr] = client
+	p.conns[addr] = conn
 	return client, nil
 }
 
+// refreshDNS resolves the hosts of the addresses of the peers connected to again, and drops the connections of the
+// peers whose IPs changed, so that the next request to them dials the new IPs. The IPs are first recorded by the
+// refresh following the dial. Dropped connections are closed after closeDelay, to let in-flight requests complete.
+func (p *peerGroup) refreshDNS(ctx context.Context, logger log.Logger, closeDelay time.Duration) {
+	p.m.RLock()
+	addrs := make([]string, 0, len(p.conns))
+	for addr := range p.conns {
+		addrs = append(addrs, addr)
+	}
+	p.m.RUnlock()
+
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := p.lookupHost(ctx, host)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to resolve peer address", "addr", addr, "err", err)
+			continue
+		}
+		sort.Strings(ips)
+
+		p.m.Lock()
+		conn, ok := p.conns[addr]
+		if !ok {
+			p.m.Unlock()
+			continue
+		}
+		prev, ok := p.resolved[addr]
+		if !ok || strings.Join(prev, ",") == strings.Join(ips, ",") {
+			p.resolved[addr] = ips
+			p.m.Unlock()
+			continue
+		}
+		delete(p.cache, addr)
+		delete(p.conns, addr)
+		delete(p.resolved, addr)
+		p.m.Unlock()
+
+		level.Info(logger).Log("msg", "peer IPs changed, reconnecting", "addr", addr, "previous", strings.Join(prev, ","), "current", strings.Join(ips, ","))
+		time.AfterFunc(closeDelay, func() {
+			runutil.CloseWithLogOnErr(logger, conn, "peer connection")
+		})
+	}
+}
+
 // getTenantFromCertificate extracts the tenant value from a client's presented certificate. The x509 field to use as
 // value can be configured with Options.TenantField. An error is returned when the extraction has not succeeded.
 func (h *Handler) getTenantFromCertificate(r *http.Request) (string, error) {
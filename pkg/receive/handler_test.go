@@ -6,16 +6,20 @@ package receive
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -26,10 +30,12 @@ import (
 	"github.com/golang/snappy"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"google.golang.org/grpc"
@@ -42,6 +48,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -177,6 +184,35 @@ func TestDetermineWriteErrorCause(t *testing.T) {
 			threshold: 1,
 			exp:       errors.New("baz: 3 errors: 3 errors: qux; rpc error: code = AlreadyExists desc = conflict; rpc error: code = AlreadyExists desc = conflict; foo; bar"),
 		},
+		{
+			name: "matching active series limit multierror keeps details",
+			err: errutil.NonNilMultiError([]error{
+				errors.Wrap(errors.Wrapf(errActiveSeriesLimit, "drop 2 series of tenant foo"), "store locally for endpoint a"),
+				status.Error(codes.ResourceExhausted, "drop 3 series of tenant foo: active series limit of the tenant reached"),
+				errors.New("bar"),
+			}),
+			threshold: 2,
+			exp:       errors.New("store locally for endpoint a: drop 2 series of tenant foo: active series limit of the tenant reached"),
+		},
+		{
+			name: "other resource exhausted errors are not caused by the active series limit",
+			err: errutil.NonNilMultiError([]error{
+				status.Error(codes.ResourceExhausted, "grpc: received message larger than max"),
+				status.Error(codes.ResourceExhausted, "grpc: received message larger than max"),
+			}),
+			threshold: 1,
+			exp:       errors.New("2 errors: rpc error: code = ResourceExhausted desc = grpc: received message larger than max; rpc error: code = ResourceExhausted desc = grpc: received message larger than max"),
+		},
+		{
+			name: "matching paused tenant multierror",
+			err: errutil.NonNilMultiError([]error{
+				status.Error(codes.ResourceExhausted, errTenantPaused.Error()),
+				status.Error(codes.ResourceExhausted, errTenantPaused.Error()),
+				errors.New("foo"),
+			}),
+			threshold: 2,
+			exp:       errTenantPaused,
+		},
 	} {
 		err := determineWriteErrorCause(tc.err, tc.threshold)
 		if tc.exp != nil {
@@ -243,6 +279,7 @@ func newFakeAppender(appendErr, commitErr, rollbackErr func() error) *fakeAppend
 	}
 	return &fakeAppender{
 		samples:     make(map[storage.SeriesRef][]prompb.Sample),
+		exemplars:   make(map[storage.SeriesRef][]exemplar.Exemplar),
 		appendErr:   appendErr,
 		commitErr:   commitErr,
 		rollbackErr: rollbackErr,
@@ -315,7 +352,7 @@ func newTestHandlerHashring(appendables []*fakeAppendable, replicationFactor uin
 			ReplicaHeader:     DefaultReplicaHeader,
 			ReplicationFactor: replicationFactor,
 			ForwardTimeout:    5 * time.Second,
-			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i])),
+			Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(appendables[i]), nil),
 		})
 		handlers = append(handlers, h)
 		h.peers = peers
@@ -1163,7 +1200,7 @@ func benchmarkHandlerMultiTSDBReceiveRemoteWrite(b testutil.TB) {
 		metadata.NoneFunc,
 	)
 	defer func() { testutil.Ok(b, m.Close()) }()
-	handler.writer = NewWriter(logger, m)
+	handler.writer = NewWriter(logger, m, nil)
 
 	testutil.Ok(b, m.Flush())
 	testutil.Ok(b, m.Open())
@@ -1666,8 +1703,1140 @@ func TestRelabel(t *testing.T) {
 				RelabelConfigs: tcase.relabel,
 			})
 
-			h.relabel(&tcase.writeRequest)
+			h.relabel("", &tcase.writeRequest)
 			testutil.Equals(t, tcase.expectedWriteRequest, tcase.writeRequest)
 		})
 	}
 }
+
+func TestReceiveMetricNameAllowlist(t *testing.T) {
+	const conf = `
+default:
+  metric_name_allowlist: ["up", "http_.*"]
+tenants:
+  strict:
+    disallowed_metrics_action: reject
+  unrestricted:
+    metric_name_allowlist: []
+`
+	series := func(names ...string) *prompb.WriteRequest {
+		wreq := &prompb.WriteRequest{}
+		for _, name := range names {
+			wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+				Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: name}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+			})
+		}
+		return wreq
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		tenant       string
+		wreq         *prompb.WriteRequest
+		expectedCode int
+		expectedIn   []string
+		expectedOut  []string
+	}{
+		{
+			name:         "allowed metrics pass",
+			tenant:       "foo",
+			wreq:         series("up", "http_requests_total"),
+			expectedCode: http.StatusOK,
+			expectedIn:   []string{"up", "http_requests_total"},
+		},
+		{
+			name:         "disallowed metrics are dropped",
+			tenant:       "foo",
+			wreq:         series("up", "node_cpu_seconds_total", "upper"),
+			expectedCode: http.StatusOK,
+			expectedIn:   []string{"up"},
+			expectedOut:  []string{"node_cpu_seconds_total", "upper"},
+		},
+		{
+			name:         "request with only disallowed metrics is dropped",
+			tenant:       "foo",
+			wreq:         series("node_cpu_seconds_total"),
+			expectedCode: http.StatusOK,
+			expectedOut:  []string{"node_cpu_seconds_total"},
+		},
+		{
+			name:         "request with disallowed metrics is rejected",
+			tenant:       "strict",
+			wreq:         series("up", "node_cpu_seconds_total"),
+			expectedCode: http.StatusBadRequest,
+			expectedOut:  []string{"up", "node_cpu_seconds_total"},
+		},
+		{
+			name:         "tenant overriding the allowlist",
+			tenant:       "unrestricted",
+			wreq:         series("up", "node_cpu_seconds_total"),
+			expectedCode: http.StatusOK,
+			expectedIn:   []string{"up", "node_cpu_seconds_total"},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			overrides := NewTenantOverrides(nil)
+			testutil.Ok(t, overrides.Load([]byte(conf)))
+
+			app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+			handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+			h := handlers[0]
+			h.options.TenantOverrides = overrides
+
+			rec, err := makeRequest(h, tcase.tenant, tcase.wreq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedCode, rec.Code)
+
+			appender := app.appender.(*fakeAppender)
+			for _, name := range tcase.expectedIn {
+				testutil.Equals(t, 1, len(appender.Get(labels.FromStrings(labels.MetricName, name))))
+			}
+			for _, name := range tcase.expectedOut {
+				testutil.Equals(t, 0, len(appender.Get(labels.FromStrings(labels.MetricName, name))))
+			}
+		})
+	}
+}
+
+func TestReceiveTenantRelabel(t *testing.T) {
+	const conf = `
+tenants:
+  drop-pod:
+    relabel_configs:
+    - action: labeldrop
+      regex: pod
+  rename-job:
+    relabel_configs:
+    - source_labels: [job]
+      target_label: service
+    - action: labeldrop
+      regex: job
+`
+	global := []*relabel.Config{
+		{
+			SourceLabels: model.LabelNames{labels.MetricName},
+			Regex:        relabel.MustNewRegexp("debug_.*"),
+			Action:       relabel.Drop,
+		},
+	}
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(conf)))
+
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+	h := handlers[0]
+	h.options.TenantOverrides = overrides
+	h.options.RelabelConfigs = global
+
+	write := func(tenant, name string) {
+		wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, name, "job", "node", "pod", "p-1")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}}}
+		rec, err := makeRequest(h, tenant, wreq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+	}
+	appender := app.appender.(*fakeAppender)
+	written := func(lset labels.Labels) bool { return len(appender.Get(lset)) > 0 }
+
+	write("drop-pod", "up")
+	testutil.Assert(t, written(labels.FromStrings(labels.MetricName, "up", "job", "node")))
+
+	write("rename-job", "up")
+	testutil.Assert(t, written(labels.FromStrings(labels.MetricName, "up", "pod", "p-1", "service", "node")))
+
+	// Tenants without relabel configs fall back to the global ones.
+	write("other", "debug_metric")
+	testutil.Assert(t, !written(labels.FromStrings(labels.MetricName, "debug_metric", "job", "node", "pod", "p-1")))
+	write("drop-pod", "debug_metric")
+	testutil.Assert(t, written(labels.FromStrings(labels.MetricName, "debug_metric", "job", "node")))
+
+	// Reloaded relabel configs apply to the next requests.
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  drop-pod:
+    relabel_configs:
+    - action: labeldrop
+      regex: job
+`)))
+	write("drop-pod", "http_requests_total")
+	testutil.Assert(t, written(labels.FromStrings(labels.MetricName, "http_requests_total", "pod", "p-1")))
+	write("rename-job", "http_requests_total")
+	testutil.Assert(t, written(labels.FromStrings(labels.MetricName, "http_requests_total", "job", "node", "pod", "p-1")))
+}
+
+func TestReceiveLabelsLimit(t *testing.T) {
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "a", "1", "b", "2")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "a", "1", "b", "2", "c", "3", "d", "4")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 2}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings("A", "0", labels.MetricName, "http_requests_total", "a", "1", "b", "2")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+	}}
+
+	for _, tcase := range []struct {
+		name         string
+		action       LabelsLimitAction
+		expectedCode int
+		// Number of appended samples by series.
+		expectedIn map[string]int
+	}{
+		{
+			name:         "series above the limit reject the request",
+			action:       LabelsLimitReject,
+			expectedCode: http.StatusBadRequest,
+			expectedIn: map[string]int{
+				`{__name__="up", a="1", b="2"}`: 0,
+			},
+		},
+		{
+			name:         "series above the limit reject the request by default",
+			expectedCode: http.StatusBadRequest,
+			expectedIn: map[string]int{
+				`{__name__="up", a="1", b="2"}`: 0,
+				`{__name__="up", a="1"}`:        0,
+			},
+		},
+		{
+			name:         "extra labels are replaced by their hash",
+			action:       LabelsLimitDropExtra,
+			expectedCode: http.StatusOK,
+			expectedIn: map[string]int{
+				// The first series is kept as is, and doesn't collide with the truncated second one.
+				`{__name__="up", a="1", b="2"}`: 1,
+				fmt.Sprintf(`{__name__="up", a="1", dropped_labels_hash="%x"}`, labels.FromStrings("b", "2", "c", "3", "d", "4").Hash()):        1,
+				fmt.Sprintf(`{A="0", __name__="http_requests_total", dropped_labels_hash="%x"}`, labels.FromStrings("a", "1", "b", "2").Hash()): 1,
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+			handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+			h := handlers[0]
+			h.options.MaxLabelsPerSeries = 3
+			h.options.LabelsLimitAction = tcase.action
+
+			rec, err := makeRequest(h, "foo", wreq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedCode, rec.Code)
+			action := tcase.action
+			if action == "" {
+				action = LabelsLimitReject
+			}
+			testutil.Equals(t, float64(2), promtestutil.ToFloat64(h.labelsLimitedSeries.WithLabelValues("foo", string(action))))
+
+			appender := app.appender.(*fakeAppender)
+			for series, samples := range tcase.expectedIn {
+				lset, err := parser.ParseMetric(series)
+				testutil.Ok(t, err)
+				testutil.Equals(t, samples, len(appender.Get(lset)), "series %s", series)
+			}
+		})
+	}
+}
+
+func TestReceivePartialSuccessDetails(t *testing.T) {
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+default:
+  metric_name_allowlist: ["up", "http_.*"]
+tenants:
+  strict:
+    disallowed_metrics_action: reject
+`)))
+
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "a", "1")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "http_requests_total", "a", "1", "b", "2", "c", "3")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "node_cpu_seconds_total")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "upper")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+	}}
+
+	for _, tcase := range []struct {
+		name            string
+		tenant          string
+		details         bool
+		expectedCode    int
+		expectedDetails WriteDetails
+	}{
+		{
+			name:         "partially rejected request",
+			tenant:       "foo",
+			details:      true,
+			expectedCode: http.StatusOK,
+			expectedDetails: WriteDetails{
+				AcceptedSeries: 2,
+				Rejected: []SeriesRejection{
+					{Reason: RejectionDisallowedMetric, Action: string(DisallowedMetricsDrop), Series: 2},
+					{Reason: RejectionTooManyLabels, Action: string(LabelsLimitDropExtra), Series: 1},
+				},
+			},
+		},
+		{
+			name:         "rejected request",
+			tenant:       "strict",
+			details:      true,
+			expectedCode: http.StatusBadRequest,
+			expectedDetails: WriteDetails{
+				Rejected: []SeriesRejection{
+					{Reason: RejectionDisallowedMetric, Action: string(DisallowedMetricsReject), Series: 2},
+				},
+				Error: `2 series, e.g. "node_cpu_seconds_total": metric names not allowed for tenant`,
+			},
+		},
+		{
+			name:         "details disabled",
+			tenant:       "foo",
+			expectedCode: http.StatusOK,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+			handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+			h := handlers[0]
+			h.options.TenantOverrides = overrides
+			h.options.MaxLabelsPerSeries = 3
+			h.options.LabelsLimitAction = LabelsLimitDropExtra
+			h.options.PartialSuccessDetails = tcase.details
+
+			// The handler modifies the request.
+			req := &prompb.WriteRequest{Timeseries: append([]prompb.TimeSeries(nil), wreq.Timeseries...)}
+			rec, err := makeRequest(h, tcase.tenant, req)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expectedCode, rec.Code)
+
+			if !tcase.details {
+				// Vanilla Prometheus gets the default empty response.
+				testutil.Equals(t, 0, rec.Body.Len())
+				return
+			}
+			testutil.Equals(t, "application/json", rec.Header().Get("Content-Type"))
+			var details WriteDetails
+			testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &details))
+			testutil.Equals(t, tcase.expectedDetails, details)
+		})
+	}
+}
+
+// blockingTenantStorage blocks writes of the given tenant until unblocked.
+type blockingTenantStorage struct {
+	blockedTenant string
+	blocked       chan struct{}
+	unblock       chan struct{}
+	appendable    *fakeAppendable
+}
+
+func (s *blockingTenantStorage) TenantAppendable(tenant string) (Appendable, error) {
+	if tenant == s.blockedTenant {
+		s.blocked <- struct{}{}
+		<-s.unblock
+	}
+	return s.appendable, nil
+}
+
+func TestReceiveTenantConcurrencyLimit(t *testing.T) {
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+default:
+  max_concurrent_requests: 1
+tenants:
+  unlimited:
+    max_concurrent_requests: 0
+`)))
+
+	s := &blockingTenantStorage{
+		blockedTenant: "noisy",
+		blocked:       make(chan struct{}),
+		unblock:       make(chan struct{}),
+		appendable:    &fakeAppendable{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{s.appendable}, 1)
+	h := handlers[0]
+	h.writer = NewWriter(log.NewNopLogger(), s, nil)
+	h.options.TenantOverrides = overrides
+
+	wreq := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "up"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}},
+	}
+	do := func(tenant string) int {
+		rec, err := makeRequest(h, tenant, wreq)
+		testutil.Ok(t, err)
+		return rec.Code
+	}
+
+	// Keep one request of the noisy tenant in flight.
+	codec := make(chan int)
+	go func() { codec <- do("noisy") }()
+	<-s.blocked
+
+	// The noisy tenant reached its limit.
+	testutil.Equals(t, http.StatusTooManyRequests, do("noisy"))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.limitedRequests.WithLabelValues("noisy")))
+
+	// Other tenants are not affected.
+	testutil.Equals(t, http.StatusOK, do("quiet"))
+	testutil.Equals(t, http.StatusOK, do("unlimited"))
+
+	close(s.unblock)
+	testutil.Equals(t, http.StatusOK, <-codec)
+
+	// Once the in-flight request is done, the noisy tenant can write again.
+	go func() { <-s.blocked }()
+	testutil.Equals(t, http.StatusOK, do("noisy"))
+}
+
+func TestReceiveOutstandingSamplesLimit(t *testing.T) {
+	s := &blockingTenantStorage{
+		blockedTenant: "noisy",
+		blocked:       make(chan struct{}),
+		unblock:       make(chan struct{}),
+		appendable:    &fakeAppendable{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{s.appendable}, 1)
+	h := handlers[0]
+	h.writer = NewWriter(log.NewNopLogger(), s, nil)
+	h.outstandingSamples = newOutstandingSamplesLimiter(3)
+
+	writeRequest := func(samples int) *prompb.WriteRequest {
+		ts := prompb.TimeSeries{Labels: []labelpb.ZLabel{{Name: labels.MetricName, Value: "up"}}}
+		for i := 0; i < samples; i++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: 1, Timestamp: int64(i)})
+		}
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{ts}}
+	}
+	do := func(tenant string, samples int) int {
+		rec, err := makeRequest(h, tenant, writeRequest(samples))
+		testutil.Ok(t, err)
+		return rec.Code
+	}
+
+	// Keep a request with 2 samples in flight.
+	codec := make(chan int)
+	go func() { codec <- do("noisy", 2) }()
+	<-s.blocked
+	testutil.Equals(t, int64(2), h.outstandingSamples.load())
+
+	// Requests exceeding the limit are rejected, the ones fitting in are not.
+	testutil.Equals(t, http.StatusTooManyRequests, do("other", 2))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.samplesLimited))
+	testutil.Equals(t, http.StatusOK, do("other", 1))
+
+	close(s.unblock)
+	testutil.Equals(t, http.StatusOK, <-codec)
+	testutil.Equals(t, int64(0), h.outstandingSamples.load())
+
+	// With no outstanding samples, even a request above the limit is admitted.
+	testutil.Equals(t, http.StatusOK, do("other", 5))
+}
+
+func TestOutstandingSamplesLimiter(t *testing.T) {
+	l := newOutstandingSamplesLimiter(10)
+	ctx := context.Background()
+
+	testutil.Ok(t, l.acquire(ctx, 8, false))
+	testutil.Equals(t, errTooManySamples, l.acquire(ctx, 5, false))
+
+	// Blocking acquire waits until enough samples are released.
+	acquired := make(chan error)
+	go func() { acquired <- l.acquire(ctx, 5, true) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block until samples are released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(8)
+	testutil.Ok(t, <-acquired)
+	testutil.Equals(t, int64(5), l.load())
+
+	// Blocking acquire gives up once the context is done.
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err := l.acquire(cctx, 6, true)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, errTooManySamples, errors.Cause(err))
+	testutil.Equals(t, int64(5), l.load())
+}
+
+func TestReceiveHTTPServerTimeouts(t *testing.T) {
+	s := &blockingTenantStorage{
+		blockedTenant: "slow",
+		blocked:       make(chan struct{}, 1),
+		unblock:       make(chan struct{}),
+		appendable:    &fakeAppendable{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{s.appendable}, 1)
+	h := handlers[0]
+	h.writer = NewWriter(log.NewNopLogger(), s, nil)
+	h.options.ReadTimeout = 1 * time.Minute
+	h.options.WriteTimeout = 100 * time.Millisecond
+	h.options.IdleTimeout = 2 * time.Minute
+
+	httpSrv := h.newHTTPServer()
+	testutil.Equals(t, 1*time.Minute, httpSrv.ReadTimeout)
+	testutil.Equals(t, 100*time.Millisecond, httpSrv.WriteTimeout)
+	testutil.Equals(t, 2*time.Minute, httpSrv.IdleTimeout)
+
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = httpSrv
+	srv.Start()
+	defer srv.Close()
+
+	buf, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}})
+	testutil.Ok(t, err)
+	do := func(tenant string) (*http.Response, error) {
+		req, err := http.NewRequest("POST", srv.URL+"/api/v1/receive", bytes.NewReader(snappy.Encode(nil, buf)))
+		testutil.Ok(t, err)
+		req.Header.Add(h.options.TenantHeader, tenant)
+		return srv.Client().Do(req)
+	}
+
+	resp, err := do("fast")
+	testutil.Ok(t, err)
+	testutil.Ok(t, resp.Body.Close())
+	testutil.Equals(t, http.StatusOK, resp.StatusCode)
+
+	// The response to a remote write request handled for longer than the write timeout is not delivered.
+	go func() {
+		<-s.blocked
+		time.Sleep(300 * time.Millisecond)
+		close(s.unblock)
+	}()
+	resp, err = do("slow")
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+	testutil.NotOk(t, err)
+}
+
+func TestReceiveHTTPServerRequestSizeLimits(t *testing.T) {
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+	h := handlers[0]
+	h.options.MaxHeaderBytes = 1024
+	h.options.MaxBodyBytes = 1024
+
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = h.newHTTPServer()
+	srv.Start()
+	defer srv.Close()
+
+	buf, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}})
+	testutil.Ok(t, err)
+	writeRequest := snappy.Encode(nil, buf)
+	// Oversized bodies are rejected before being decoded.
+	oversized := make([]byte, 4096)
+	_, err = rand.Read(oversized)
+	testutil.Ok(t, err)
+
+	for _, tc := range []struct {
+		name         string
+		body         []byte
+		unknownSize  bool
+		headerSize   int
+		expectedCode int
+	}{
+		{name: "within the limits", body: writeRequest, headerSize: 100, expectedCode: http.StatusOK},
+		// The server tolerates headers a few KB over the limit, as it reads them in chunks.
+		{name: "oversized header", body: writeRequest, headerSize: 64 * 1024, expectedCode: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "oversized body", body: oversized, expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "oversized body of unknown size", body: oversized, unknownSize: true, expectedCode: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader = bytes.NewReader(tc.body)
+			if tc.unknownSize {
+				// Hide the size of the body, so that it's sent chunked.
+				body = io.MultiReader(body)
+			}
+			req, err := http.NewRequest("POST", srv.URL+"/api/v1/receive", body)
+			testutil.Ok(t, err)
+			if tc.unknownSize {
+				testutil.Equals(t, int64(0), req.ContentLength)
+			}
+			req.Header.Add("X-Forwarded-Labels", strings.Repeat("a", tc.headerSize))
+
+			resp, err := srv.Client().Do(req)
+			testutil.Ok(t, err)
+			testutil.Ok(t, resp.Body.Close())
+			testutil.Equals(t, tc.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+// blockingRemoteWriteClient fails remote write requests once unblocked.
+type blockingRemoteWriteClient struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (c *blockingRemoteWriteClient) RemoteWrite(ctx context.Context, _ *storepb.WriteRequest, _ ...grpc.CallOption) (*storepb.WriteResponse, error) {
+	c.started <- struct{}{}
+	select {
+	case <-c.unblock:
+	case <-ctx.Done():
+	}
+	return nil, status.Error(codes.Unavailable, "shadow endpoint unavailable")
+}
+
+func TestReceiveShadowHashring(t *testing.T) {
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+	h := handlers[0]
+
+	shadow := &blockingRemoteWriteClient{started: make(chan struct{}, 1), unblock: make(chan struct{})}
+	h.peers.cache["shadow"] = shadow
+	h.options.ShadowHashring = newMultiHashring(AlgorithmHashmod, []HashringConfig{{Endpoints: []string{"shadow"}}})
+	h.shadowInflight = make(chan struct{}, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	write := func(ts int64) {
+		rec, err := makeRequest(h, "foo", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts}},
+		}}})
+		testutil.Ok(t, err)
+		testutil.Equals(t, http.StatusOK, rec.Code)
+	}
+	waitForShadowErrors := func(n float64) {
+		testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+			if v := promtestutil.ToFloat64(h.shadowForwardRequests.WithLabelValues(labelError)); v != n {
+				return errors.Errorf("expected %v shadow errors, got %v", n, v)
+			}
+			return nil
+		}))
+	}
+	appender := app.appender.(*fakeAppender)
+	lset := labels.FromStrings(labels.MetricName, "up")
+
+	// The request is written while its mirrored request hangs.
+	write(1)
+	<-shadow.started
+	testutil.Equals(t, 1, len(appender.Get(lset)))
+
+	// Requests are still written, but not mirrored, while too many mirrored requests are in flight.
+	write(2)
+	testutil.Equals(t, 2, len(appender.Get(lset)))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.shadowDroppedRequests))
+
+	// Failures of mirrored requests are only counted.
+	close(shadow.unblock)
+	waitForShadowErrors(1)
+
+	write(3)
+	<-shadow.started
+	testutil.Equals(t, 3, len(appender.Get(lset)))
+	waitForShadowErrors(2)
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(h.shadowForwardRequests.WithLabelValues(labelSuccess)))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.shadowDroppedRequests))
+}
+
+func TestReceiveDiskPressure(t *testing.T) {
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+	h := handlers[0]
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  optional:
+    disk_pressure_optional: true
+`)))
+	h.options.TenantOverrides = overrides
+
+	var (
+		usage    float64
+		probeErr error
+	)
+	m, err := NewDiskPressureMonitor(nil, nil, func() (float64, error) { return usage, probeErr }, 0.8, 0.9)
+	testutil.Ok(t, err)
+	h.options.DiskPressure = m
+
+	ts := int64(0)
+	write := func(tenant string) int {
+		ts++
+		rec, err := makeRequest(h, tenant, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "tenant", tenant)),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts}},
+		}}})
+		testutil.Ok(t, err)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		usage                float64
+		probeErr             error
+		expectedState        int
+		expectedCodeDefault  int
+		expectedCodeOptional int
+	}{
+		{usage: 0.5, expectedState: diskPressureNone, expectedCodeDefault: http.StatusOK, expectedCodeOptional: http.StatusOK},
+		// Optional tenants are shed first.
+		{usage: 0.85, expectedState: diskPressureOptional, expectedCodeDefault: http.StatusOK, expectedCodeOptional: http.StatusServiceUnavailable},
+		{usage: 0.9, expectedState: diskPressureFull, expectedCodeDefault: http.StatusServiceUnavailable, expectedCodeOptional: http.StatusServiceUnavailable},
+		// Writes are accepted again only once the usage drops below the low watermark.
+		{usage: 0.85, expectedState: diskPressureFull, expectedCodeDefault: http.StatusServiceUnavailable, expectedCodeOptional: http.StatusServiceUnavailable},
+		{usage: 0.5, probeErr: errors.New("probe failed"), expectedState: diskPressureFull, expectedCodeDefault: http.StatusServiceUnavailable, expectedCodeOptional: http.StatusServiceUnavailable},
+		{usage: 0.79, expectedState: diskPressureNone, expectedCodeDefault: http.StatusOK, expectedCodeOptional: http.StatusOK},
+	} {
+		t.Run(fmt.Sprintf("usage=%v,probeErr=%v", tc.usage, tc.probeErr), func(t *testing.T) {
+			usage, probeErr = tc.usage, tc.probeErr
+			if err := m.Update(); tc.probeErr == nil {
+				testutil.Ok(t, err)
+			} else {
+				testutil.NotOk(t, err)
+			}
+			testutil.Equals(t, float64(tc.expectedState), promtestutil.ToFloat64(m.stateGauge))
+
+			testutil.Equals(t, tc.expectedCodeDefault, write("default"))
+			testutil.Equals(t, tc.expectedCodeOptional, write("optional"))
+		})
+	}
+	testutil.Equals(t, float64(3), promtestutil.ToFloat64(m.rejected.WithLabelValues("default")))
+	testutil.Equals(t, float64(4), promtestutil.ToFloat64(m.rejected.WithLabelValues("optional")))
+
+	_, err = NewDiskPressureMonitor(nil, nil, nil, 0.9, 0.8)
+	testutil.NotOk(t, err)
+}
+
+func TestReceivePauseTenant(t *testing.T) {
+	appender := newFakeAppender(nil, nil, nil)
+	h := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: 1,
+		ForwardTimeout:    5 * time.Second,
+		Endpoint:          randomAddr(),
+		Writer:            NewWriter(log.NewNopLogger(), newFakeTenantAppendable(&fakeAppendable{appender: appender}), nil),
+		EnableAdminAPI:    true,
+	})
+	h.Hashring(newMultiHashring(AlgorithmHashmod, []HashringConfig{{Hashring: "test", Endpoints: []string{h.options.Endpoint}}}))
+
+	ts := int64(0)
+	write := func(tenant string) int {
+		ts++
+		rec, err := makeRequest(h, tenant, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "tenant", tenant)),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts}},
+		}}})
+		testutil.Ok(t, err)
+		return rec.Code
+	}
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	samples := func(tenant string) int {
+		return len(appender.Get(labels.FromStrings(labels.MetricName, "up", "tenant", tenant)))
+	}
+
+	testutil.Equals(t, http.StatusOK, write("noisy"))
+	testutil.Equals(t, http.StatusOK, write("other"))
+
+	testutil.Equals(t, http.StatusNoContent, admin(http.MethodPost, "/api/v1/admin/tenants/noisy/pause").Code)
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.pausedTenants.pausedGauge))
+	rec := admin(http.MethodGet, "/api/v1/admin/tenants/paused")
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Equals(t, `["noisy"]`, rec.Body.String())
+
+	// Writes of the paused tenant are rejected, while the samples written before are kept.
+	testutil.Equals(t, http.StatusTooManyRequests, write("noisy"))
+	testutil.Equals(t, http.StatusTooManyRequests, write("noisy"))
+	testutil.Equals(t, http.StatusOK, write("other"))
+	testutil.Equals(t, 1, samples("noisy"))
+	testutil.Equals(t, 2, samples("other"))
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(h.pausedTenants.rejected.WithLabelValues("noisy")))
+
+	// Requests replicated by other receivers through gRPC are rejected as well, with an error the sender recognizes.
+	_, err := h.RemoteWrite(context.Background(), &storepb.WriteRequest{Tenant: "noisy", Replica: 1, Timeseries: []prompb.TimeSeries{{
+		Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "tenant", "noisy")),
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 100}},
+	}}})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+	testutil.Equals(t, errTenantPaused, determineWriteErrorCause(err, 1))
+	testutil.Equals(t, 1, samples("noisy"))
+	testutil.Equals(t, float64(3), promtestutil.ToFloat64(h.pausedTenants.rejected.WithLabelValues("noisy")))
+
+	testutil.Equals(t, http.StatusNoContent, admin(http.MethodPost, "/api/v1/admin/tenants/noisy/resume").Code)
+	testutil.Equals(t, `[]`, admin(http.MethodGet, "/api/v1/admin/tenants/paused").Body.String())
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(h.pausedTenants.pausedGauge))
+
+	testutil.Equals(t, http.StatusOK, write("noisy"))
+	testutil.Equals(t, 2, samples("noisy"))
+
+	// The admin API is only served if enabled.
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{{appender: newFakeAppender(nil, nil, nil)}}, 1)
+	rec = httptest.NewRecorder()
+	handlers[0].router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/tenants/noisy/pause", nil))
+	testutil.Equals(t, http.StatusNotFound, rec.Code)
+}
+
+func TestReceiveActiveSeriesLimit(t *testing.T) {
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "a", "1")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 1, Timestamp: 2}},
+		},
+		{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "a", "2")),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		},
+	}}
+
+	// Replicated requests are rejected by the other receivers with a ResourceExhausted error, and the series are
+	// spread over them.
+	for _, replicationFactor := range []int{1, 3} {
+		t.Run(fmt.Sprintf("replicationFactor=%d", replicationFactor), func(t *testing.T) {
+			var appendables []*fakeAppendable
+			for i := 0; i < replicationFactor; i++ {
+				appendables = append(appendables, &fakeAppendable{appender: newFakeAppender(func() error { return errActiveSeriesLimit }, nil, nil)})
+			}
+			handlers, _ := newTestHandlerHashring(appendables, uint64(replicationFactor))
+
+			rec, err := makeRequest(handlers[0], "foo", wreq)
+			testutil.Ok(t, err)
+			testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+			testutil.Assert(t, strings.Contains(rec.Body.String(), "series of tenant foo: active series limit of the tenant reached"), rec.Body.String())
+		})
+	}
+}
+
+// tenantAppenders writes every tenant to an appender of its own.
+type tenantAppenders struct {
+	mtx       sync.Mutex
+	appenders map[string]*fakeAppender
+}
+
+func (s *tenantAppenders) TenantAppendable(tenant string) (Appendable, error) {
+	return &fakeAppendable{appender: s.get(tenant)}, nil
+}
+
+func (s *tenantAppenders) get(tenant string) *fakeAppender {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.appenders[tenant]; !ok {
+		s.appenders[tenant] = newFakeAppender(nil, nil, nil)
+	}
+	return s.appenders[tenant]
+}
+
+func TestReceiveSplitTenantLabel(t *testing.T) {
+	storage := &tenantAppenders{appenders: map[string]*fakeAppender{}}
+	h := NewHandler(nil, &Options{
+		TenantHeader:         DefaultTenantHeader,
+		DefaultTenantID:      DefaultTenant,
+		ReplicaHeader:        DefaultReplicaHeader,
+		ReplicationFactor:    1,
+		ForwardTimeout:       5 * time.Second,
+		Endpoint:             randomAddr(),
+		Writer:               NewWriter(log.NewNopLogger(), storage, nil),
+		SplitTenantLabelName: "team",
+	})
+	h.Hashring(newMultiHashring(AlgorithmHashmod, []HashringConfig{{Hashring: "test", Endpoints: []string{h.options.Endpoint}}}))
+
+	series := func(lbls ...string) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels:  labelpb.ZLabelsFromPromLabels(labels.FromStrings(lbls...)),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}
+	}
+	samples := func(tenant string, lbls ...string) int {
+		return len(storage.get(tenant).Get(labels.FromStrings(lbls...)))
+	}
+
+	rec, err := makeRequest(h, "", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		series(labels.MetricName, "up", "team", "a", "job", "a"),
+		series(labels.MetricName, "up", "team", "b", "job", "b"),
+		series(labels.MetricName, "up", "job", "c"),
+	}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	// The tenant label is removed, and series without it are written to the tenant of the request.
+	testutil.Equals(t, 1, samples("a", labels.MetricName, "up", "job", "a"))
+	testutil.Equals(t, 1, samples("b", labels.MetricName, "up", "job", "b"))
+	testutil.Equals(t, 1, samples(DefaultTenant, labels.MetricName, "up", "job", "c"))
+	testutil.Equals(t, 0, samples("a", labels.MetricName, "up", "job", "b"))
+
+	// Tenants are admitted on their own, so a paused tenant doesn't prevent writing the others.
+	h.pausedTenants.pause("b")
+	rec, err = makeRequest(h, "", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		series(labels.MetricName, "http_requests_total", "team", "a"),
+		series(labels.MetricName, "http_requests_total", "team", "b"),
+	}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+	testutil.Assert(t, strings.Contains(rec.Body.String(), "tenant b"), rec.Body.String())
+	testutil.Equals(t, 1, samples("a", labels.MetricName, "http_requests_total"))
+	testutil.Equals(t, 0, samples("b", labels.MetricName, "http_requests_total"))
+
+	// Tenants which can't be used as a directory name are rejected.
+	rec, err = makeRequest(h, "", &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		series(labels.MetricName, "up", "team", "../a"),
+	}})
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSplitWriteRequest(t *testing.T) {
+	series := func(name string, samples int) prompb.TimeSeries {
+		ts := prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, name))}
+		for i := 0; i < samples; i++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: float64(i), Timestamp: int64(i)})
+		}
+		return ts
+	}
+	large := series("large", 100)
+	large.Exemplars = []prompb.Exemplar{{Value: 1, Timestamp: 1}}
+	wreq := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series("a", 10), series("b", 10), large, series("c", 1)}}
+
+	const maxBytes = 300
+	wreqs := splitWriteRequest(wreq, maxBytes)
+	testutil.Assert(t, len(wreqs) > 2, "expected the request to be split, got %d requests", len(wreqs))
+
+	// Requests are at most maxBytes, and have all the samples of the request in order.
+	var (
+		merged    []prompb.TimeSeries
+		exemplars int
+	)
+	for _, r := range wreqs {
+		testutil.Assert(t, r.Size() <= maxBytes, "request of %d bytes", r.Size())
+		for _, ts := range r.Timeseries {
+			exemplars += len(ts.Exemplars)
+			if n := len(merged); n > 0 && labelpb.ZLabelsToPromLabels(merged[n-1].Labels).Hash() == labelpb.ZLabelsToPromLabels(ts.Labels).Hash() {
+				merged[n-1].Samples = append(merged[n-1].Samples, ts.Samples...)
+				continue
+			}
+			merged = append(merged, prompb.TimeSeries{Labels: ts.Labels, Samples: ts.Samples})
+		}
+	}
+	testutil.Equals(t, 1, exemplars)
+	large.Exemplars = nil
+	testutil.Equals(t, []prompb.TimeSeries{series("a", 10), series("b", 10), large, series("c", 1)}, merged)
+
+	// Requests below maxBytes aren't split.
+	testutil.Equals(t, []*prompb.WriteRequest{wreq}, splitWriteRequest(wreq, wreq.Size()))
+}
+
+func TestReceiveSplitRequest(t *testing.T) {
+	appendables := []*fakeAppendable{
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+		{appender: newFakeAppender(nil, nil, nil)},
+	}
+	handlers, _ := newTestHandlerHashring(appendables, 3)
+	h := handlers[0]
+	h.options.SplitRequestBytes = 1000
+
+	wreq := &prompb.WriteRequest{}
+	for i := 1; i <= 20; i++ {
+		ts := prompb.TimeSeries{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings(labels.MetricName, "up", "instance", strconv.Itoa(i)))}
+		for j := 0; j < 10*i; j++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: float64(j), Timestamp: int64(j)})
+		}
+		wreq.Timeseries = append(wreq.Timeseries, ts)
+	}
+	testutil.Assert(t, wreq.Size() > 10*h.options.SplitRequestBytes, "request of %d bytes", wreq.Size())
+
+	rec, err := makeRequest(h, "foo", wreq)
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, rec.Code)
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.splitRequests))
+
+	// Every replica has all the samples, in order.
+	for _, app := range appendables {
+		for _, ts := range wreq.Timeseries {
+			testutil.Equals(t, ts.Samples, app.appender.(*fakeAppender).Get(labelpb.ZLabelsToPromLabels(ts.Labels)))
+		}
+	}
+}
+
+func TestReceiveRemoteWriteV2(t *testing.T) {
+	app := &fakeAppendable{appender: newFakeAppender(nil, nil, nil)}
+	handlers, _ := newTestHandlerHashring([]*fakeAppendable{app}, 1)
+	h := handlers[0]
+	appender := app.appender.(*fakeAppender)
+
+	post := func(body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", h.options.Endpoint, bytes.NewBuffer(snappy.Encode(nil, body)))
+		testutil.Ok(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.receiveHTTP(rec, req)
+		return rec
+	}
+	v2Headers := map[string]string{
+		"Content-Type":           "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+		remoteWriteVersionHeader: "2.0.0",
+	}
+
+	req := &writev2pb.Request{
+		Symbols: []string{"", labels.MetricName, "http_requests_total", "job", "a", "trace_id", "abc", "Total requests.", "latency_seconds"},
+		Timeseries: []writev2pb.TimeSeries{
+			{
+				// Labels don't have to be sorted.
+				LabelsRefs: []uint32{3, 4, 1, 2},
+				Samples:    []writev2pb.Sample{{Value: 1, Timestamp: 10}, {Value: 2, Timestamp: 20}},
+				Exemplars:  []writev2pb.Exemplar{{LabelsRefs: []uint32{5, 6}, Value: 2, Timestamp: 20}},
+				Metadata:   writev2pb.Metadata{Type: writev2pb.Metadata_METRIC_TYPE_COUNTER, HelpRef: 7},
+			},
+			{
+				LabelsRefs: []uint32{1, 8},
+				Histograms: []writev2pb.Histogram{{Count: &writev2pb.Histogram_CountInt{CountInt: 1}, Timestamp: 10}},
+			},
+		},
+	}
+	body, err := proto.Marshal(req)
+	testutil.Ok(t, err)
+
+	// Samples and exemplars are written, native histograms are dropped.
+	rec := post(body, v2Headers)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "2", rec.Header().Get(samplesWrittenHeader))
+	testutil.Equals(t, "1", rec.Header().Get(exemplarsWrittenHeader))
+	testutil.Equals(t, "0", rec.Header().Get(histogramsWrittenHeader))
+
+	lset := labels.FromStrings(labels.MetricName, "http_requests_total", "job", "a")
+	testutil.Equals(t, []prompb.Sample{{Value: 1, Timestamp: 10}, {Value: 2, Timestamp: 20}}, appender.Get(lset))
+	exemplars := appender.exemplars[storage.SeriesRef(lset.Hash())]
+	testutil.Equals(t, 1, len(exemplars))
+	testutil.Equals(t, labels.FromStrings("trace_id", "abc"), exemplars[0].Labels)
+
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(h.remoteWriteWritten.WithLabelValues(remoteWriteV2, "samples")))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.remoteWriteWritten.WithLabelValues(remoteWriteV2, "exemplars")))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(h.remoteWriteDropped.WithLabelValues(remoteWriteV2, "histograms")))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(h.remoteWriteDropped.WithLabelValues(remoteWriteV2, "samples")))
+
+	// The metadata of series becomes the metadata of their metric family.
+	wreq, err := writeV2ToWriteRequest(req)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []prompb.MetricMetadata{{Type: prompb.MetricMetadata_COUNTER, MetricFamilyName: "http_requests_total", Help: "Total requests."}}, wreq.Metadata)
+
+	// Clients advertising 2.0 only with the version header send 2.0 requests too.
+	req.Timeseries[0].Samples = []writev2pb.Sample{{Value: 3, Timestamp: 30}}
+	body, err = proto.Marshal(req)
+	testutil.Ok(t, err)
+	rec = post(body, map[string]string{remoteWriteVersionHeader: "2.0.0"})
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "1", rec.Header().Get(samplesWrittenHeader))
+	testutil.Equals(t, 3, len(appender.Get(lset)))
+
+	// Requests referencing missing symbols are rejected.
+	req.Timeseries[0].LabelsRefs = []uint32{1, 9}
+	body, err = proto.Marshal(req)
+	testutil.Ok(t, err)
+	rec = post(body, v2Headers)
+	testutil.Equals(t, http.StatusBadRequest, rec.Code)
+	testutil.Equals(t, "0", rec.Header().Get(samplesWrittenHeader))
+
+	// Unknown protobuf messages are not supported.
+	rec = post(body, map[string]string{"Content-Type": "application/x-protobuf;proto=io.prometheus.write.v3.Request"})
+	testutil.Equals(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	// Clients which don't advertise 2.0 send 1.0 requests, whose responses don't have the written headers.
+	body, err = proto.Marshal(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  labelpb.ZLabelsFromPromLabels(lset),
+		Samples: []prompb.Sample{{Value: 4, Timestamp: 40}},
+	}}})
+	testutil.Ok(t, err)
+	for _, headers := range []map[string]string{
+		nil,
+		{"Content-Type": "application/x-protobuf;proto=prometheus.WriteRequest", remoteWriteVersionHeader: "0.1.0"},
+	} {
+		rec = post(body, headers)
+		testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+		testutil.Equals(t, "", rec.Header().Get(samplesWrittenHeader))
+	}
+	testutil.Equals(t, 5, len(appender.Get(lset)))
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(h.remoteWriteWritten.WithLabelValues(remoteWriteV1, "samples")))
+}
+
+func TestPeerGroupRefreshDNS(t *testing.T) {
+	var (
+		dials int
+		ips   = []string{"10.0.0.1"}
+	)
+	// The connections are never used, as no request is sent to the peers.
+	dialer := func(ctx context.Context, target string, _ ...grpc.DialOption) (*grpc.ClientConn, error) {
+		dials++
+		conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("unexpected connection in testing")
+		}))
+		if err == nil {
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+		return conn, err
+	}
+	peers := newPeerGroup()
+	peers.dialer = dialer
+	peers.lookupHost = func(context.Context, string) ([]string, error) {
+		return ips, nil
+	}
+
+	ctx := context.Background()
+	const addr = "receive-0.receive:10901"
+	first, err := peers.get(ctx, addr)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, dials)
+
+	// The same IPs keep the connection.
+	peers.refreshDNS(ctx, log.NewNopLogger(), 0)
+	peers.refreshDNS(ctx, log.NewNopLogger(), 0)
+	c, err := peers.get(ctx, addr)
+	testutil.Ok(t, err)
+	testutil.Equals(t, first, c)
+	testutil.Equals(t, 1, dials)
+
+	// Changed IPs make the next request to the peer dial it again.
+	ips = []string{"10.0.0.2"}
+	peers.refreshDNS(ctx, log.NewNopLogger(), 0)
+	c, err = peers.get(ctx, addr)
+	testutil.Ok(t, err)
+	testutil.Assert(t, c != first, "expected a new client after the peer IPs changed")
+	testutil.Equals(t, 2, dials)
+
+	// Peers addressed by IP are never resolved.
+	peers = newPeerGroup()
+	peers.dialer = dialer
+	peers.lookupHost = func(context.Context, string) ([]string, error) {
+		t.Fatal("unexpected lookup")
+		return nil, nil
+	}
+	_, err = peers.get(ctx, "10.0.0.3:10901")
+	testutil.Ok(t, err)
+	peers.refreshDNS(ctx, log.NewNopLogger(), 0)
+}
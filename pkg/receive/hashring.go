@@ -6,6 +6,7 @@ package receive
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"sync"
@@ -22,13 +23,23 @@ import (
 type HashringAlgorithm string
 
 const (
-	AlgorithmHashmod HashringAlgorithm = "hashmod"
-	AlgorithmKetama  HashringAlgorithm = "ketama"
+	AlgorithmHashmod       HashringAlgorithm = "hashmod"
+	AlgorithmKetama        HashringAlgorithm = "ketama"
+	AlgorithmKetamaBounded HashringAlgorithm = "ketama-bounded"
 
 	// SectionsPerNode is the number of sections in the ring assigned to each node
 	// in the ketama hashring. A higher number yields a better series distribution,
 	// but also comes with a higher memory cost.
 	SectionsPerNode = 1000
+
+	// BoundedLoadPartitions is the number of partitions series are hashed to in the
+	// ketama-bounded hashring. Partitions are the unit of load assigned to nodes,
+	// so it has to be much higher than the number of nodes.
+	BoundedLoadPartitions = 16384
+
+	// DefaultBoundedLoadFactor is the default maximum ratio of the partitions assigned
+	// to a node to the mean in the ketama-bounded hashring.
+	DefaultBoundedLoadFactor = 1.25
 )
 
 // insufficientNodesError is returned when a hashring does not
@@ -140,20 +151,92 @@ func (c ketamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (st
 	}
 
 	v := labelpb.HashWithPrefix(tenant, ts.Labels)
+	i := (c.sectionIndex(v) + n) % uint64(len(c.sections))
+	nodeIndex := c.sections[i].endpointIndex
+	return c.endpoints[nodeIndex], nil
+}
 
-	var i uint64
-	i = uint64(sort.Search(len(c.sections), func(i int) bool {
+// sectionIndex returns the index of the first section of the ring whose hash is not lower than the given one.
+func (c ketamaHashring) sectionIndex(v uint64) uint64 {
+	i := uint64(sort.Search(len(c.sections), func(i int) bool {
 		return c.sections[i].hash >= v
 	}))
-
-	numSections := uint64(len(c.sections))
-	if i == numSections {
+	if i == uint64(len(c.sections)) {
 		i = 0
 	}
+	return i
+}
 
-	i = (i + n) % numSections
-	nodeIndex := c.sections[i].endpointIndex
-	return c.endpoints[nodeIndex], nil
+type boundedPartition struct {
+	// start is the index of the section of the ring the partition is hashed to.
+	start         uint64
+	endpointIndex uint64
+}
+
+// boundedKetamaHashring represents a group of nodes handling write requests with consistent
+// hashing with bounded loads. Series are hashed to a fixed number of partitions, and every
+// partition is assigned to the first node following it on the ketama ring which has less
+// partitions than the load factor times the mean. Adding or removing a node thus only moves
+// a small fraction of the partitions, while no node gets more than its bounded share.
+type boundedKetamaHashring struct {
+	ring       *ketamaHashring
+	partitions []boundedPartition
+}
+
+func newBoundedKetamaHashring(endpoints []string, sectionsPerNode, numPartitions int, loadFactor float64) *boundedKetamaHashring {
+	c := &boundedKetamaHashring{ring: newKetamaHashring(endpoints, sectionsPerNode)}
+	if len(endpoints) == 0 {
+		return c
+	}
+
+	// As the load factor is at least 1, the capacity of all nodes fits all partitions.
+	capacity := uint64(math.Ceil(float64(numPartitions) / float64(len(endpoints)) * loadFactor))
+	loads := make([]uint64, len(endpoints))
+	numSections := uint64(len(c.ring.sections))
+	c.partitions = make([]boundedPartition, numPartitions)
+	for p := range c.partitions {
+		start := c.ring.sectionIndex(xxhash.Sum64String("partition:" + strconv.Itoa(p)))
+		for i := start; ; i = (i + 1) % numSections {
+			e := c.ring.sections[i].endpointIndex
+			if loads[e] < capacity {
+				loads[e]++
+				c.partitions[p] = boundedPartition{start: start, endpointIndex: e}
+				break
+			}
+		}
+	}
+	return c
+}
+
+func (c *boundedKetamaHashring) Get(tenant string, ts *prompb.TimeSeries) (string, error) {
+	return c.GetN(tenant, ts, 0)
+}
+
+// GetN returns the nth target to handle the given tenant and time series. The first one is the node
+// the partition of the series is assigned to, the following ones are the next distinct nodes on the ring.
+func (c *boundedKetamaHashring) GetN(tenant string, ts *prompb.TimeSeries, n uint64) (string, error) {
+	if n >= c.ring.numEndpoints {
+		return "", &insufficientNodesError{have: c.ring.numEndpoints, want: n + 1}
+	}
+
+	p := c.partitions[labelpb.HashWithPrefix(tenant, ts.Labels)%uint64(len(c.partitions))]
+	if n == 0 {
+		return c.ring.endpoints[p.endpointIndex], nil
+	}
+
+	seen := make([]bool, c.ring.numEndpoints)
+	seen[p.endpointIndex] = true
+	numSections := uint64(len(c.ring.sections))
+	for i := p.start; ; i = (i + 1) % numSections {
+		e := c.ring.sections[i].endpointIndex
+		if seen[e] {
+			continue
+		}
+		seen[e] = true
+		if n--; n == 0 {
+			return c.ring.endpoints[e], nil
+		}
+	}
 }
 
 // multiHashring represents a set of hashrings.
@@ -213,19 +296,30 @@ func newMultiHashring(algorithm HashringAlgorithm, cfg []HashringConfig) Hashrin
 		cache: make(map[string]Hashring),
 	}
 
-	newHashring := func(endpoints []string) Hashring {
-		switch algorithm {
+	newHashring := func(h HashringConfig) Hashring {
+		// The algorithm of a hashring configuration overrides the default one.
+		a := algorithm
+		if h.Algorithm != "" {
+			a = h.Algorithm
+		}
+		switch a {
 		case AlgorithmHashmod:
-			return simpleHashring(endpoints)
+			return simpleHashring(h.Endpoints)
 		case AlgorithmKetama:
-			return newKetamaHashring(endpoints, SectionsPerNode)
+			return newKetamaHashring(h.Endpoints, SectionsPerNode)
+		case AlgorithmKetamaBounded:
+			loadFactor := h.LoadFactor
+			if loadFactor == 0 {
+				loadFactor = DefaultBoundedLoadFactor
+			}
+			return newBoundedKetamaHashring(h.Endpoints, SectionsPerNode, BoundedLoadPartitions, loadFactor)
 		default:
-			return simpleHashring(endpoints)
+			return simpleHashring(h.Endpoints)
 		}
 	}
 
 	for _, h := range cfg {
-		m.hashrings = append(m.hashrings, newHashring(h.Endpoints))
+		m.hashrings = append(m.hashrings, newHashring(h))
 		var t map[string]struct{}
 		if len(h.Tenants) != 0 {
 			t = make(map[string]struct{})
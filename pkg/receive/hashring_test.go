@@ -5,6 +5,7 @@ package receive
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -362,3 +363,108 @@ func assignReplicatedSeries(series []*prompb.TimeSeries, nodes []string, replica
 
 	return assignments, nil
 }
+
+func TestBoundedKetamaHashringMovement(t *testing.T) {
+	series := makeSeries()
+	assign := func(nodes []string) map[string]string {
+		ring := newBoundedKetamaHashring(nodes, SectionsPerNode, BoundedLoadPartitions, DefaultBoundedLoadFactor)
+		assignments := make(map[string]string, len(series))
+		for _, ts := range series {
+			node, err := ring.Get("tenant", ts)
+			require.NoError(t, err)
+			assignments[labelpb.ZLabelsToPromLabels(ts.Labels).String()] = node
+		}
+		return assignments
+	}
+	moved := func(a, b map[string]string) float64 {
+		var n int
+		for s, node := range a {
+			if b[s] != node {
+				n++
+			}
+		}
+		return float64(n) / float64(len(a))
+	}
+
+	for _, numNodes := range []int{3, 5, 10} {
+		t.Run(fmt.Sprintf("%d nodes", numNodes), func(t *testing.T) {
+			before := assign(makeNodes(numNodes))
+			// Adding a node should only move its share of the series, with some slack for the load bound.
+			added := assign(makeNodes(numNodes + 1))
+			fraction := moved(before, added)
+			require.Less(t, fraction, 1.5/float64(numNodes+1), "too many series moved when adding a node")
+			require.Greater(t, fraction, 0.5/float64(numNodes+1), "too few series moved to the added node")
+
+			// Removing a node from the middle should only move the series of that node.
+			nodes := makeNodes(numNodes)
+			removed := assign(append(nodes[:1:1], nodes[2:]...))
+			fraction = moved(before, removed)
+			require.Less(t, fraction, 1.5/float64(numNodes), "too many series moved when removing a node")
+			for s, node := range before {
+				if node != "node-2" {
+					continue
+				}
+				require.NotEqual(t, "node-2", removed[s])
+			}
+		})
+	}
+}
+
+func TestBoundedKetamaHashringLoadBound(t *testing.T) {
+	for _, loadFactor := range []float64{1, 1.1, 1.25, 2} {
+		t.Run(fmt.Sprintf("load factor %v", loadFactor), func(t *testing.T) {
+			for _, numNodes := range []int{2, 7, 30} {
+				ring := newBoundedKetamaHashring(makeNodes(numNodes), SectionsPerNode, BoundedLoadPartitions, loadFactor)
+				loads := map[uint64]int{}
+				for _, p := range ring.partitions {
+					loads[p.endpointIndex]++
+				}
+				mean := float64(BoundedLoadPartitions) / float64(numNodes)
+				for e, load := range loads {
+					require.LessOrEqual(t, float64(load), math.Ceil(mean*loadFactor), "node %d exceeds the load bound", e)
+				}
+			}
+		})
+	}
+}
+
+func TestBoundedKetamaHashringReplicas(t *testing.T) {
+	nodes := makeNodes(5)
+	ring := newBoundedKetamaHashring(nodes, SectionsPerNode, BoundedLoadPartitions, DefaultBoundedLoadFactor)
+	for _, ts := range makeSeries()[:1000] {
+		seen := map[string]struct{}{}
+		for n := uint64(0); n < uint64(len(nodes)); n++ {
+			node, err := ring.GetN("tenant", ts, n)
+			require.NoError(t, err)
+			_, ok := seen[node]
+			require.False(t, ok, "replica %d of the series is on the same node %s as another one", n, node)
+			seen[node] = struct{}{}
+		}
+		_, err := ring.GetN("tenant", ts, uint64(len(nodes)))
+		require.Error(t, err)
+	}
+
+	_, err := newBoundedKetamaHashring(nil, SectionsPerNode, BoundedLoadPartitions, DefaultBoundedLoadFactor).Get("tenant", makeSeries()[0])
+	require.Error(t, err)
+}
+
+func TestHashringConfigAlgorithm(t *testing.T) {
+	h, err := HashringFromConfig(AlgorithmHashmod, `[{"hashring": "a", "tenants": ["a"], "endpoints": ["node-1", "node-2"], "algorithm": "ketama-bounded", "load_factor": 1.1}, {"endpoints": ["node-1"]}]`)
+	require.NoError(t, err)
+	m := h.(*multiHashring)
+	require.IsType(t, &boundedKetamaHashring{}, m.hashrings[0])
+	require.IsType(t, simpleHashring{}, m.hashrings[1])
+
+	_, err = HashringFromConfig(AlgorithmHashmod, `[{"endpoints": ["node-1"], "algorithm": "unknown"}]`)
+	require.Error(t, err)
+	_, err = HashringFromConfig(AlgorithmHashmod, `[{"endpoints": ["node-1"], "algorithm": "ketama-bounded", "load_factor": 0.5}]`)
+	require.Error(t, err)
+}
+
+func makeNodes(n int) []string {
+	nodes := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		nodes = append(nodes, fmt.Sprintf("node-%d", i))
+	}
+	return nodes
+}
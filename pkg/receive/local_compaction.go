@@ -0,0 +1,53 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/prometheus/prometheus/tsdb"
+	"go.uber.org/atomic"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/shipper"
+)
+
+// localCompactionRange returns the largest range TSDB compacts blocks into for the given min and max block durations,
+// as it merges blocks in ranges growing by a factor of three from the min block duration.
+func localCompactionRange(minBlockDuration, maxBlockDuration int64) int64 {
+	rng := minBlockDuration
+	for _, r := range tsdb.ExponentialBlockRanges(minBlockDuration, 10, 3) {
+		if r > maxBlockDuration {
+			break
+		}
+		rng = r
+	}
+	return rng
+}
+
+// localCompactionPending returns the function holding back blocks from shipping as long as TSDB might still compact
+// them into a block of up to the given range, so only the resulting blocks get shipped. A block can't be compacted
+// anymore once it spans its whole range window, or once a newer block starts after the window and no other block is
+// left in the window. All blocks are shipped once shipAll is set.
+func localCompactionPending(rng int64, shipAll *atomic.Bool) shipper.PendingFunc {
+	return func(m *metadata.Meta, metas []*metadata.Meta) bool {
+		if shipAll.Load() || m.MaxTime-m.MinTime >= rng {
+			return false
+		}
+		windowStart := m.MinTime - m.MinTime%rng
+		windowEnd := windowStart + rng
+		if m.MaxTime > windowEnd {
+			// Blocks crossing range windows are never compacted.
+			return false
+		}
+		if metas[len(metas)-1].MinTime < windowEnd {
+			// Blocks of the window can still be cut from the head.
+			return true
+		}
+		for _, o := range metas {
+			if o.ULID != m.ULID && o.MinTime >= windowStart && o.MaxTime <= windowEnd {
+				return true
+			}
+		}
+		return false
+	}
+}
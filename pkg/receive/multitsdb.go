@@ -6,20 +6,28 @@ package receive
 import (
 	"context"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
+	stdatomic "sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/thanos-io/thanos/pkg/api/status"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
@@ -41,7 +49,6 @@ type TSDBStats interface {
 }
 
 type MultiTSDB struct {
-	dataDir         string
 	logger          log.Logger
 	reg             prometheus.Registerer
 	tsdbOpts        *tsdb.Options
@@ -53,6 +60,84 @@ type MultiTSDB struct {
 	tenants               map[string]*tenant
 	allowOutOfOrderUpload bool
 	hashFunc              metadata.HashFunc
+	staggerHeadCompaction bool
+	tenantOverrides       *TenantOverrides
+	uploadOptions         []objstore.UploadOption
+
+	tenantPaths *TenantPaths
+	// Maximum number of tenants shipped concurrently, 0 means no limit.
+	shipConcurrency int
+	// Enables compaction of tenant blocks up to the max block duration before shipping them.
+	localCompaction bool
+	// A map from tenant ID to its TSDB directory found on Open.
+	tenantDirs map[string]string
+
+	samplesBeyondReorderingTolerance *prometheus.CounterVec
+	roundedSamplesDropped            *prometheus.CounterVec
+	activeSeriesLimit                *prometheus.GaugeVec
+	seriesLimited                    *prometheus.CounterVec
+	seriesCreated                    *prometheus.CounterVec
+	highSeriesChurn                  *prometheus.GaugeVec
+	outOfOrderness                   *outOfOrdernessMetrics
+	walReplayDuration                *prometheus.GaugeVec
+	walReplayProgress                *prometheus.GaugeVec
+}
+
+// MultiTSDBOption configures a MultiTSDB.
+type MultiTSDBOption func(t *MultiTSDB)
+
+// WithStaggeredHeadCompaction staggers the head compactions of the tenants.
+func WithStaggeredHeadCompaction(enabled bool) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.staggerHeadCompaction = enabled
+	}
+}
+
+// WithTenantOverrides applies the per-tenant overrides to the tenants. Already shipped blocks are deleted according
+// to the local retention of their tenant.
+func WithTenantOverrides(overrides *TenantOverrides) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.tenantOverrides = overrides
+	}
+}
+
+// WithTenantPaths places the TSDB directories of tenants across the base paths of tenantPaths instead of the data
+// directory.
+func WithTenantPaths(tenantPaths *TenantPaths) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.tenantPaths = tenantPaths
+	}
+}
+
+// WithShipConcurrency ships the blocks of at most n tenants at a time if positive.
+func WithShipConcurrency(n int) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.shipConcurrency = n
+	}
+}
+
+// WithLocalCompaction makes tenant TSDBs compact their blocks up to the max block duration of the TSDB options. Blocks
+// are only shipped once they can't be compacted locally anymore, so the bucket never holds overlapping blocks.
+// Tenants for which local compaction is disabled in the tenant overrides don't compact their blocks.
+func WithLocalCompaction(enabled bool) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.localCompaction = enabled
+	}
+}
+
+// WithOutOfOrdernessMaxTenants reports the out-of-orderness of the samples of at most n tenants separately if
+// positive, the other tenants are reported together.
+func WithOutOfOrdernessMaxTenants(n int) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.outOfOrderness.maxTenants = n
+	}
+}
+
+// WithUploadOptions sets the options of the uploads of shipped blocks.
+func WithUploadOptions(opts ...objstore.UploadOption) MultiTSDBOption {
+	return func(t *MultiTSDB) {
+		t.uploadOptions = opts
+	}
 }
 
 // NewMultiTSDB creates new MultiTSDB.
@@ -67,13 +152,13 @@ func NewMultiTSDB(
 	bucket objstore.Bucket,
 	allowOutOfOrderUpload bool,
 	hashFunc metadata.HashFunc,
+	opts ...MultiTSDBOption,
 ) *MultiTSDB {
 	if l == nil {
 		l = log.NewNopLogger()
 	}
 
-	return &MultiTSDB{
-		dataDir:               dataDir,
+	t := &MultiTSDB{
 		logger:                log.With(l, "component", "multi-tsdb"),
 		reg:                   reg,
 		tsdbOpts:              tsdbOpts,
@@ -84,7 +169,48 @@ func NewMultiTSDB(
 		bucket:                bucket,
 		allowOutOfOrderUpload: allowOutOfOrderUpload,
 		hashFunc:              hashFunc,
+		tenantDirs:            map[string]string{},
+		samplesBeyondReorderingTolerance: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_samples_beyond_reordering_tolerance_total",
+			Help: "The number of samples rejected for lagging behind the newest sample of their tenant by more than the sample reordering tolerance of the tenant.",
+		}, []string{"tenant"}),
+		roundedSamplesDropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_rounded_samples_dropped_total",
+			Help: "The number of samples dropped for having their timestamp rounded to the timestamp of a previous sample of their series.",
+		}, []string{"tenant"}),
+		activeSeriesLimit: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_active_series_limit",
+			Help: "The maximum number of series in the head of the tenant. 0 means no limit.",
+		}, []string{"tenant"}),
+		seriesLimited: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_head_series_limited_total",
+			Help: "The number of new series rejected for exceeding the active series limit of their tenant.",
+		}, []string{"tenant"}),
+		seriesCreated: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_tenant_series_created_total",
+			Help: "The number of series created in the head of the tenant.",
+		}, []string{"tenant"}),
+		highSeriesChurn: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_high_series_churn",
+			Help: "Whether the tenant created more series per minute than its series churn threshold at the last check.",
+		}, []string{"tenant"}),
+		outOfOrderness: newOutOfOrdernessMetrics(reg),
+		walReplayDuration: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_wal_replay_duration_seconds",
+			Help: "The time it took to open the TSDB of the tenant, including the replay of its WAL.",
+		}, []string{"tenant"}),
+		walReplayProgress: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenant_wal_replay_progress_ratio",
+			Help: "The ratio of WAL segments of the tenant replayed while its TSDB is opened, 1 once it's open.",
+		}, []string{"tenant"}),
 	}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.tenantPaths == nil {
+		t.tenantPaths = &TenantPaths{paths: []string{dataDir}}
+	}
+	return t
 }
 
 type tenant struct {
@@ -93,6 +219,21 @@ type tenant struct {
 	exemplarsTSDB *exemplars.TSDB
 	ship          *shipper.Shipper
 
+	// lastHeadCompaction is the last scheduled head compaction time of the tenant, used
+	// only if head compaction is staggered.
+	lastHeadCompaction time.Time
+
+	// shipAll makes the shipper ship blocks still pending local compaction, e.g. before the TSDB is pruned.
+	shipAll atomic.Bool
+
+	// seriesCreated is the number of series created in the head of the tenant.
+	seriesCreated atomic.Uint64
+	// churnCheck is the state of the tenant at the last series churn check, used only by CheckSeriesChurn.
+	churnCheck struct {
+		time          time.Time
+		seriesCreated uint64
+	}
+
 	mtx *sync.RWMutex
 }
 
@@ -134,25 +275,66 @@ func (t *tenant) set(storeTSDB *store.TSDBStore, tenantTSDB *tsdb.DB, ship *ship
 	t.mtx.Unlock()
 }
 
+// Open opens the TSDBs of all tenants found in the data directories, and returns once their WAL is replayed.
 func (t *MultiTSDB) Open() error {
-	if err := os.MkdirAll(t.dataDir, 0750); err != nil {
-		return err
-	}
+	return t.open(true)
+}
 
-	files, err := ioutil.ReadDir(t.dataDir)
-	if err != nil {
-		return err
+// OpenAsync is like Open, but returns before the TSDBs are opened. Writes of tenants are rejected until the WAL of
+// their TSDB is replayed, and WALReplayed reports when all of them are.
+func (t *MultiTSDB) OpenAsync() error {
+	return t.open(false)
+}
+
+// WALReplayed returns whether the TSDBs of all tenants found on Open replayed their WAL. TSDBs which failed to
+// open aren't waited for.
+func (t *MultiTSDB) WALReplayed() bool {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	for tenantID := range t.tenantDirs {
+		if tenant, ok := t.tenants[tenantID]; ok && tenant.readyStorage().Get() == nil {
+			return false
+		}
 	}
+	return true
+}
 
-	var g errgroup.Group
-	for _, f := range files {
-		f := f
-		if !f.IsDir() {
-			continue
+func (t *MultiTSDB) open(blockingStart bool) error {
+	tenantDirs := map[string]string{}
+	for _, basePath := range t.tenantPaths.paths {
+		if err := os.MkdirAll(basePath, 0750); err != nil {
+			return err
 		}
 
+		files, err := ioutil.ReadDir(basePath)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !f.IsDir() {
+				continue
+			}
+			dir := path.Join(basePath, f.Name())
+			if other, ok := tenantDirs[f.Name()]; ok {
+				return errors.Errorf("TSDB of tenant %s found in both %s and %s", f.Name(), other, dir)
+			}
+			// Existing TSDBs stay where they are, even if the tenant is placed on another base path now.
+			if expected := t.tenantPaths.basePath(f.Name()); path.Clean(expected) != path.Clean(basePath) {
+				level.Warn(t.logger).Log("msg", "TSDB of tenant is not on its configured base path, keeping it in place", "tenant", f.Name(), "dir", dir, "configured", expected)
+			}
+			tenantDirs[f.Name()] = dir
+		}
+	}
+
+	t.mtx.Lock()
+	t.tenantDirs = tenantDirs
+	t.mtx.Unlock()
+
+	var g errgroup.Group
+	for tenantID := range tenantDirs {
+		tenantID := tenantID
 		g.Go(func() error {
-			_, err := t.getOrLoadTenant(f.Name(), true)
+			_, err := t.getOrLoadTenant(tenantID, blockingStart)
 			return err
 		})
 	}
@@ -190,6 +372,53 @@ func (t *MultiTSDB) Flush() error {
 	return merr.Err()
 }
 
+// CompactHeads compacts heads of tenants whose scheduled head compaction time passed since the last call.
+// It's used when head compaction is staggered, in which case automatic compaction of tenant TSDBs is disabled
+// and every tenant is compacted once per block duration, at its own offset within it. Head of a tenant holds up
+// to one more block duration of data than with automatic compaction.
+func (t *MultiTSDB) CompactHeads(now time.Time) error {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	merr := errutil.MultiError{}
+	for id, tenant := range t.tenants {
+		db := tenant.readyStorage().Get()
+		if db == nil {
+			continue
+		}
+
+		scheduled := lastScheduledHeadCompaction(now, time.Duration(t.tsdbOpts.MinBlockDuration)*time.Millisecond, id)
+
+		tenant.mtx.Lock()
+		last := tenant.lastHeadCompaction
+		tenant.lastHeadCompaction = scheduled
+		tenant.mtx.Unlock()
+
+		// Don't compact tenants seen for the first time, so they don't all compact at once after a restart.
+		if last.IsZero() || !scheduled.After(last) {
+			continue
+		}
+
+		level.Debug(t.logger).Log("msg", "compacting TSDB head", "tenant", id, "scheduled", scheduled)
+		// Compact is a no-op if the head doesn't hold enough data to be compacted yet.
+		if err := db.Compact(); err != nil {
+			merr.Add(errors.Wrapf(err, "compact head of tenant %s", id))
+		}
+	}
+	return merr.Err()
+}
+
+// headCompactionOffset returns the deterministic offset of the head compaction of the tenant within the block duration.
+func headCompactionOffset(blockDuration time.Duration, tenantID string) time.Duration {
+	return time.Duration(xxhash.Sum64String(tenantID) % uint64(blockDuration))
+}
+
+// lastScheduledHeadCompaction returns the latest head compaction time of the tenant not after now.
+func lastScheduledHeadCompaction(now time.Time, blockDuration time.Duration, tenantID string) time.Time {
+	sinceOffset := now.Sub(time.Unix(0, 0)) - headCompactionOffset(blockDuration, tenantID)
+	return now.Add(-(sinceOffset % blockDuration))
+}
+
 func (t *MultiTSDB) Close() error {
 	t.mtx.Lock()
 	defer t.mtx.Unlock()
@@ -249,6 +478,8 @@ func (t *MultiTSDB) Prune(ctx context.Context) error {
 	for _, tenantID := range prunedTenants {
 		level.Info(t.logger).Log("msg", "Pruned tenant", "tenant", tenantID)
 		delete(t.tenants, tenantID)
+		// A new TSDB of the tenant is placed according to the current configuration.
+		delete(t.tenantDirs, tenantID)
 	}
 
 	return merr.Err()
@@ -276,8 +507,16 @@ func (t *MultiTSDB) pruneTSDB(ctx context.Context, logger log.Logger, tenantInst
 	if err := tdb.CompactHead(tsdb.NewRangeHead(head, head.MinTime(), head.MaxTime())); err != nil {
 		return false, err
 	}
+	if t.localCompaction {
+		// Merge the blocks now compactable, as the head block is the most recent one.
+		if err := tdb.Compact(); err != nil {
+			return false, err
+		}
+	}
 
 	if tenantInstance.shipper() != nil {
+		// Blocks still pending local compaction would be lost otherwise.
+		tenantInstance.shipAll.Store(true)
 		uploaded, err := tenantInstance.shipper().Sync(ctx)
 		if err != nil {
 			return false, err
@@ -312,7 +551,11 @@ func (t *MultiTSDB) Sync(ctx context.Context) (int, error) {
 		merr     = errutil.MultiError{}
 		wg       = &sync.WaitGroup{}
 		uploaded atomic.Int64
+		sem      chan struct{}
 	)
+	if t.shipConcurrency > 0 {
+		sem = make(chan struct{}, t.shipConcurrency)
+	}
 
 	for tenantID, tenant := range t.tenants {
 		level.Debug(t.logger).Log("msg", "uploading block for tenant", "tenant", tenantID)
@@ -322,6 +565,10 @@ func (t *MultiTSDB) Sync(ctx context.Context) (int, error) {
 		}
 		wg.Add(1)
 		go func() {
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
 			up, err := s.Sync(ctx)
 			if err != nil {
 				errmtx.Lock()
@@ -337,29 +584,99 @@ func (t *MultiTSDB) Sync(ctx context.Context) (int, error) {
 }
 
 func (t *MultiTSDB) RemoveLockFilesIfAny() error {
-	fis, err := ioutil.ReadDir(t.dataDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+	merr := errutil.MultiError{}
+	for _, basePath := range t.tenantPaths.paths {
+		fis, err := ioutil.ReadDir(basePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				merr.Add(err)
+			}
+			continue
+		}
+
+		for _, fi := range fis {
+			if !fi.IsDir() {
+				continue
+			}
+			if err := os.Remove(filepath.Join(basePath, fi.Name(), "lock")); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				merr.Add(err)
+				continue
+			}
+			level.Info(t.logger).Log("msg", "a leftover lockfile found and removed", "tenant", fi.Name())
 		}
-		return err
 	}
+	return merr.Err()
+}
 
+// RemoveOrphanedDirsIfAny removes the directories left in the TSDBs of tenants by crashes, which are clearly incomplete:
+// temporary block directories and block directories without a meta file. Blocks are only renamed to their final
+// directory once their meta file is written, so a block without one was never complete. Nothing else is removed.
+func (t *MultiTSDB) RemoveOrphanedDirsIfAny() error {
 	merr := errutil.MultiError{}
+	for _, basePath := range t.tenantPaths.paths {
+		fis, err := ioutil.ReadDir(basePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				merr.Add(err)
+			}
+			continue
+		}
+
+		for _, fi := range fis {
+			if !fi.IsDir() {
+				continue
+			}
+			tenantDir := filepath.Join(basePath, fi.Name())
+			dirs, err := orphanedBlockDirs(tenantDir)
+			if err != nil {
+				merr.Add(errors.Wrapf(err, "find orphaned directories of tenant %s", fi.Name()))
+				continue
+			}
+			for _, dir := range dirs {
+				if err := os.RemoveAll(filepath.Join(tenantDir, dir)); err != nil {
+					merr.Add(err)
+					continue
+				}
+				level.Info(t.logger).Log("msg", "an orphaned directory found and removed", "tenant", fi.Name(), "dir", dir)
+			}
+		}
+	}
+	return merr.Err()
+}
+
+// orphanedBlockDirs returns the names of the incomplete block directories of a TSDB directory.
+func orphanedBlockDirs(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned []string
 	for _, fi := range fis {
 		if !fi.IsDir() {
 			continue
 		}
-		if err := os.Remove(filepath.Join(t.defaultTenantDataDir(fi.Name()), "lock")); err != nil {
-			if os.IsNotExist(err) {
-				continue
+		name := fi.Name()
+		if ext := filepath.Ext(name); ext == ".tmp" || ext == ".tmp-for-creation" || ext == ".tmp-for-deletion" {
+			if _, err := ulid.ParseStrict(strings.TrimSuffix(name, ext)); err == nil {
+				orphaned = append(orphaned, name)
 			}
-			merr.Add(err)
 			continue
 		}
-		level.Info(t.logger).Log("msg", "a leftover lockfile found and removed", "tenant", fi.Name())
+		if _, err := ulid.ParseStrict(name); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name, metadata.MetaFilename)); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			orphaned = append(orphaned, name)
+		}
 	}
-	return merr.Err()
+	return orphaned, nil
 }
 
 func (t *MultiTSDB) TSDBStores() map[string]store.InfoStoreServer {
@@ -393,7 +710,9 @@ func (t *MultiTSDB) TSDBExemplars() map[string]*exemplars.TSDB {
 func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []status.TenantStats {
 	t.mtx.RLock()
 	defer t.mtx.RUnlock()
-	if len(tenantIDs) == 0 {
+	// Explicitly requested tenants without a ready TSDB get empty stats, while all tenants only cover the ready ones.
+	requested := len(tenantIDs) > 0
+	if !requested {
 		for tenantID := range t.tenants {
 			tenantIDs = append(tenantIDs, tenantID)
 		}
@@ -402,18 +721,26 @@ func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []
 	var (
 		mu     sync.Mutex
 		wg     sync.WaitGroup
-		result = make([]status.TenantStats, 0, len(t.tenants))
+		result = make([]status.TenantStats, 0, len(tenantIDs))
 	)
 	for _, tenantID := range tenantIDs {
-		tenantInstance, ok := t.tenants[tenantID]
-		if !ok {
+		var db *tsdb.DB
+		if tenantInstance, ok := t.tenants[tenantID]; ok {
+			db = tenantInstance.readyS.Get()
+		}
+		if db == nil {
+			if requested {
+				mu.Lock()
+				result = append(result, status.TenantStats{Tenant: tenantID, Stats: emptyTSDBStats()})
+				mu.Unlock()
+			}
 			continue
 		}
 
 		wg.Add(1)
-		go func(tenantID string, tenantInstance *tenant) {
+		go func(tenantID string, db *tsdb.DB) {
 			defer wg.Done()
-			stats := tenantInstance.readyS.get().db.Head().Stats(statsByLabelName)
+			stats := db.Head().Stats(statsByLabelName)
 
 			mu.Lock()
 			defer mu.Unlock()
@@ -421,7 +748,7 @@ func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []
 				Tenant: tenantID,
 				Stats:  stats,
 			})
-		}(tenantID, tenantInstance)
+		}(tenantID, db)
 	}
 	wg.Wait()
 
@@ -431,26 +758,53 @@ func (t *MultiTSDB) TenantStats(statsByLabelName string, tenantIDs ...string) []
 	return result
 }
 
+// emptyTSDBStats returns the stats of an empty head.
+func emptyTSDBStats() *tsdb.Stats {
+	return &tsdb.Stats{
+		MinTime:           math.MaxInt64,
+		MaxTime:           math.MinInt64,
+		IndexPostingStats: &index.PostingsStats{},
+	}
+}
+
 func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant) error {
 	reg := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": tenantID}, t.reg)
 	lset := labelpb.ExtendSortedLabels(t.labels, labels.FromStrings(t.tenantLabelName, tenantID))
-	dataDir := t.defaultTenantDataDir(tenantID)
+	dataDir := t.tenantDataDir(tenantID)
 
 	level.Info(logger).Log("msg", "opening TSDB")
 	opts := *t.tsdbOpts
+	localCompaction := t.tenantLocalCompaction(tenantID)
+	if t.localCompaction && !localCompaction {
+		// Blocks are only compacted into ranges up to the max block duration.
+		opts.MaxBlockDuration = opts.MinBlockDuration
+	}
+	var db stdatomic.Value
+	if t.tenantOverrides != nil {
+		opts.BlocksToDelete = t.blocksToDelete(logger, tenantID, dataDir, &db)
+	}
+	start := time.Now()
+	stats := tsdb.NewDBStats()
+	stopProgress := t.reportWALReplayProgress(tenantID, stats.Head.WALReplayStatus)
 	s, err := tsdb.Open(
 		dataDir,
 		logger,
 		&UnRegisterer{Registerer: reg},
 		&opts,
-		nil,
+		stats,
 	)
+	stopProgress()
 	if err != nil {
 		t.mtx.Lock()
 		delete(t.tenants, tenantID)
 		t.mtx.Unlock()
 		return err
 	}
+	db.Store(s)
+	if t.staggerHeadCompaction {
+		// Heads are compacted by CompactHeads instead.
+		s.DisableCompactions()
+	}
 	var ship *shipper.Shipper
 	if t.bucket != nil {
 		ship = shipper.New(
@@ -460,18 +814,110 @@ func (t *MultiTSDB) startTSDB(logger log.Logger, tenantID string, tenant *tenant
 			t.bucket,
 			func() labels.Labels { return lset },
 			metadata.ReceiveSource,
-			false,
+			// Blocks compacted before local compaction was disabled for the tenant are still shipped.
+			t.localCompaction,
 			t.allowOutOfOrderUpload,
 			t.hashFunc,
+			t.uploadOptions...,
 		)
+		if localCompaction {
+			ship.WithPendingFunc(localCompactionPending(localCompactionRange(opts.MinBlockDuration, opts.MaxBlockDuration), &tenant.shipAll))
+		}
 	}
 	tenant.set(store.NewTSDBStore(logger, s, component.Receive, lset), s, ship, exemplars.NewTSDB(s, lset))
-	level.Info(logger).Log("msg", "TSDB is now ready")
+	t.walReplayDuration.WithLabelValues(tenantID).Set(time.Since(start).Seconds())
+	t.walReplayProgress.WithLabelValues(tenantID).Set(1)
+	level.Info(logger).Log("msg", "TSDB is now ready", "duration", time.Since(start))
 	return nil
 }
 
-func (t *MultiTSDB) defaultTenantDataDir(tenantID string) string {
-	return path.Join(t.dataDir, tenantID)
+// tenantLocalCompaction returns true if the blocks of the tenant are compacted locally.
+func (t *MultiTSDB) tenantLocalCompaction(tenantID string) bool {
+	if !t.localCompaction {
+		return false
+	}
+	return t.tenantOverrides == nil || !t.tenantOverrides.ForTenant(tenantID).DisableLocalCompaction
+}
+
+// reportWALReplayProgress updates the WAL replay progress of the tenant from the given status every second, until
+// the returned function is called.
+func (t *MultiTSDB) reportWALReplayProgress(tenantID string, status *tsdb.WALReplayStatus) (stop func()) {
+	progress := t.walReplayProgress.WithLabelValues(tenantID)
+	progress.Set(0)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if s := status.GetWALReplayStatus(); s.Max > s.Min {
+					progress.Set(float64(s.Current-s.Min) / float64(s.Max-s.Min))
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// blocksToDelete returns the function deciding which blocks of the tenant's TSDB are deleted. On top of the
+// default TSDB retention, it deletes blocks which are beyond the local retention of the tenant, if configured,
+// but only if they were already shipped to the object storage.
+func (t *MultiTSDB) blocksToDelete(logger log.Logger, tenantID, dataDir string, db *stdatomic.Value) tsdb.BlocksToDeleteFunc {
+	return func(blocks []*tsdb.Block) map[ulid.ULID]struct{} {
+		var deletable map[ulid.ULID]struct{}
+		if s, ok := db.Load().(*tsdb.DB); ok {
+			deletable = tsdb.DefaultBlocksToDelete(s)(blocks)
+		} else {
+			// The TSDB is being opened, so the default time and size based retention is applied
+			// only on the next reload of its blocks. Blocks already compacted into other ones are deleted right away.
+			deletable = make(map[ulid.ULID]struct{})
+			for _, b := range blocks {
+				if b.Meta().Compaction.Deletable {
+					deletable[b.Meta().ULID] = struct{}{}
+				}
+			}
+		}
+
+		retention := time.Duration(t.tenantOverrides.ForTenant(tenantID).LocalRetention)
+		if retention <= 0 || t.bucket == nil {
+			return deletable
+		}
+
+		meta, err := shipper.ReadMetaFile(dataDir)
+		if err != nil {
+			if !os.IsNotExist(errors.Cause(err)) {
+				level.Warn(logger).Log("msg", "reading shipper meta file failed, skipping local retention", "err", err)
+			}
+			return deletable
+		}
+		shipped := make(map[ulid.ULID]struct{}, len(meta.Uploaded))
+		for _, id := range meta.Uploaded {
+			shipped[id] = struct{}{}
+		}
+
+		minTime := timestamp.FromTime(time.Now().Add(-retention))
+		for _, b := range blocks {
+			if _, ok := shipped[b.Meta().ULID]; ok && b.Meta().MaxTime < minTime {
+				deletable[b.Meta().ULID] = struct{}{}
+			}
+		}
+		return deletable
+	}
+}
+
+// tenantDataDir returns the TSDB directory of the given tenant, which is the one found on Open if it existed.
+func (t *MultiTSDB) tenantDataDir(tenantID string) string {
+	t.mtx.RLock()
+	dir, ok := t.tenantDirs[tenantID]
+	t.mtx.RUnlock()
+	if ok {
+		return dir
+	}
+	return path.Join(t.tenantPaths.basePath(tenantID), tenantID)
 }
 
 func (t *MultiTSDB) getOrLoadTenant(tenantID string, blockingStart bool) (*tenant, error) {
@@ -514,7 +960,17 @@ func (t *MultiTSDB) TenantAppendable(tenantID string) (Appendable, error) {
 	if err != nil {
 		return nil, err
 	}
-	return tenant.readyStorage(), nil
+	return &tenantAppendable{
+		tenant:                tenant,
+		tenantID:              tenantID,
+		overrides:             t.tenantOverrides,
+		created:               t.seriesCreated.WithLabelValues(tenantID),
+		rejected:              t.samplesBeyondReorderingTolerance.WithLabelValues(tenantID),
+		activeSeriesLimit:     t.activeSeriesLimit.WithLabelValues(tenantID),
+		limited:               t.seriesLimited.WithLabelValues(tenantID),
+		outOfOrderness:        t.outOfOrderness,
+		roundedSamplesDropped: t.roundedSamplesDropped.WithLabelValues(tenantID),
+	}, nil
 }
 
 // ErrNotReady is returned if the underlying storage is not ready yet.
@@ -6,8 +6,12 @@ package receive
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,19 +19,26 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/types"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/exemplars/exemplarspb"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/shipper"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/testutil/e2eutil"
 )
 
 func TestMultiTSDB(t *testing.T) {
@@ -477,6 +488,403 @@ func TestMultiTSDBPrune(t *testing.T) {
 	}
 }
 
+func TestMultiTSDBStaggeredHeadCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-stagger")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	const blockDuration = 2 * time.Hour
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  blockDuration.Milliseconds(),
+			MaxBlockDuration:  blockDuration.Milliseconds(),
+			RetentionDuration: (6 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithStaggeredHeadCompaction(true),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	// Enough samples for the heads to be compactable.
+	for i := 0; i < 210; i++ {
+		testutil.Ok(t, appendSample(m, "foo", time.UnixMilli(0).Add(time.Duration(i)*time.Minute)))
+		testutil.Ok(t, appendSample(m, "bar", time.UnixMilli(0).Add(time.Duration(i)*time.Minute)))
+	}
+
+	first, second := "foo", "bar"
+	if headCompactionOffset(blockDuration, first) > headCompactionOffset(blockDuration, second) {
+		first, second = second, first
+	}
+	firstOffset, secondOffset := headCompactionOffset(blockDuration, first), headCompactionOffset(blockDuration, second)
+	testutil.Assert(t, firstOffset < secondOffset, "expected different offsets, got %v and %v", firstOffset, secondOffset)
+	testutil.Assert(t, secondOffset < blockDuration, "expected offset within block duration, got %v", secondOffset)
+
+	numBlocks := func(tenant string) int {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+		return len(m.tenants[tenant].readyStorage().Get().Blocks())
+	}
+
+	windowStart := time.Unix(0, 0).Add(1000 * blockDuration)
+
+	// Tenants seen for the first time are not compacted.
+	testutil.Ok(t, m.CompactHeads(windowStart))
+	testutil.Equals(t, 0, numBlocks(first))
+	testutil.Equals(t, 0, numBlocks(second))
+
+	testutil.Ok(t, m.CompactHeads(windowStart.Add(firstOffset).Add(-time.Second)))
+	testutil.Equals(t, 0, numBlocks(first))
+
+	testutil.Ok(t, m.CompactHeads(windowStart.Add(firstOffset)))
+	testutil.Equals(t, 1, numBlocks(first))
+	testutil.Equals(t, 0, numBlocks(second))
+
+	testutil.Ok(t, m.CompactHeads(windowStart.Add(secondOffset)))
+	testutil.Equals(t, 1, numBlocks(first))
+	testutil.Equals(t, 1, numBlocks(second))
+}
+
+func TestMultiTSDBLocalCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-local-compaction")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := objstore.NewInMemBucket()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (6 * time.Hour).Milliseconds(),
+			RetentionDuration: (15 * 24 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		bkt,
+		false,
+		metadata.NoneFunc,
+		WithLocalCompaction(true),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	for i := 0; i < 14*60; i++ {
+		testutil.Ok(t, appendSample(m, "foo", time.UnixMilli(0).Add(time.Duration(i)*time.Minute)))
+	}
+
+	shipped := func() []metadata.Meta {
+		var metas []metadata.Meta
+		testutil.Ok(t, bkt.Iter(context.Background(), "", func(name string) error {
+			id, ok := block.IsBlockDir(name)
+			testutil.Assert(t, ok, "unexpected object %s", name)
+			meta, err := block.DownloadMeta(context.Background(), log.NewNopLogger(), bkt, id)
+			testutil.Ok(t, err)
+			metas = append(metas, meta)
+			return nil
+		}))
+		sort.Slice(metas, func(i, j int) bool { return metas[i].MinTime < metas[j].MinTime })
+		return metas
+	}
+
+	// The head is cut into 2h blocks up to 12h, and the 2h blocks up to 6h are merged. The others are merged only
+	// once a newer block is cut, as TSDB never compacts the most recent block.
+	m.mtx.RLock()
+	db := m.tenants["foo"].readyStorage().Get()
+	m.mtx.RUnlock()
+	testutil.Ok(t, db.Compact())
+	testutil.Equals(t, 4, len(db.Blocks()))
+
+	// Only the merged block is shipped, as the 2h blocks from 6h to 12h are yet to be merged.
+	uploaded, err := m.Sync(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, uploaded)
+	metas := shipped()
+	testutil.Equals(t, 1, len(metas))
+	testutil.Equals(t, int64(0), metas[0].MinTime)
+	testutil.Equals(t, (6 * time.Hour).Milliseconds(), metas[0].MaxTime)
+	testutil.Equals(t, 2, metas[0].Compaction.Level)
+
+	// Blocks are merged and all of them shipped, including the most recent one, before the TSDB is pruned.
+	testutil.Ok(t, m.Prune(context.Background()))
+	metas = shipped()
+	testutil.Equals(t, 3, len(metas))
+	testutil.Equals(t, []int64{0, (6 * time.Hour).Milliseconds(), (12 * time.Hour).Milliseconds()}, []int64{metas[0].MinTime, metas[1].MinTime, metas[2].MinTime})
+	testutil.Equals(t, (12 * time.Hour).Milliseconds(), metas[1].MaxTime)
+	testutil.Equals(t, 2, metas[1].Compaction.Level)
+}
+
+func TestMultiTSDBTenantLocalCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  bar:
+    disable_local_compaction: true
+`)))
+
+	bkt := objstore.NewInMemBucket()
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (6 * time.Hour).Milliseconds(),
+			RetentionDuration: (15 * 24 * time.Hour).Milliseconds(),
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		bkt,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+		WithLocalCompaction(true),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+
+	db := func(tenant string) *tsdb.DB {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+		return m.tenants[tenant].readyStorage().Get()
+	}
+	for _, tenant := range []string{"foo", "bar"} {
+		testutil.Ok(t, appendSample(m, tenant, time.UnixMilli(0)))
+		// Blocks are compacted by the test only, not while samples are appended.
+		db(tenant).DisableCompactions()
+	}
+	for i := 1; i < 14*60; i++ {
+		testutil.Ok(t, appendSample(m, "foo", time.UnixMilli(0).Add(time.Duration(i)*time.Minute)))
+		testutil.Ok(t, appendSample(m, "bar", time.UnixMilli(0).Add(time.Duration(i)*time.Minute)))
+	}
+
+	blocks := func(tenant string) []*tsdb.Block {
+		testutil.Ok(t, db(tenant).Compact())
+		return db(tenant).Blocks()
+	}
+	// The 2h blocks up to 6h of the enabled tenant are merged, while the blocks of the disabled one are only cut.
+	testutil.Equals(t, 4, len(blocks("foo")))
+	barBlocks := blocks("bar")
+	testutil.Equals(t, 6, len(barBlocks))
+	for _, b := range barBlocks {
+		testutil.Equals(t, 1, b.Meta().Compaction.Level)
+	}
+
+	// All blocks of the disabled tenant are shipped right away, while those of the enabled one wait to be merged.
+	uploaded, err := m.Sync(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1+6, uploaded)
+}
+
+func TestMultiTSDBTenantPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-tenant-paths")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	basePaths := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")}
+	newMultiTSDB := func(mapping map[string]string) *MultiTSDB {
+		tenantPaths, err := NewTenantPaths(basePaths, mapping)
+		testutil.Ok(t, err)
+		return NewMultiTSDB(basePaths[0], log.NewNopLogger(), prometheus.NewRegistry(),
+			&tsdb.Options{
+				MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+				MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+				RetentionDuration: (6 * time.Hour).Milliseconds(),
+			},
+			labels.FromStrings("replica", "test"),
+			"tenant_id",
+			nil,
+			false,
+			metadata.NoneFunc,
+			WithTenantPaths(tenantPaths),
+		)
+	}
+	tenantBasePaths := func() map[string]string {
+		res := map[string]string{}
+		for _, bp := range basePaths {
+			fis, err := ioutil.ReadDir(bp)
+			testutil.Ok(t, err)
+			for _, fi := range fis {
+				_, ok := res[fi.Name()]
+				testutil.Assert(t, !ok, "TSDB of tenant %s in more than one base path", fi.Name())
+				res[fi.Name()] = bp
+			}
+		}
+		return res
+	}
+
+	var tenants []string
+	for i := 0; i < 12; i++ {
+		tenants = append(tenants, fmt.Sprintf("tenant-%d", i))
+	}
+
+	m := newMultiTSDB(map[string]string{"tenant-0": basePaths[2]})
+	testutil.Ok(t, m.Open())
+	for _, tenant := range tenants {
+		testutil.Ok(t, appendSample(m, tenant, time.Now()))
+	}
+	testutil.Ok(t, m.Close())
+
+	placed := tenantBasePaths()
+	testutil.Equals(t, len(tenants), len(placed))
+	testutil.Equals(t, basePaths[2], placed["tenant-0"])
+	perBasePath := map[string]int{}
+	for _, tenant := range tenants {
+		testutil.Equals(t, m.tenantPaths.basePath(tenant), placed[tenant])
+		perBasePath[placed[tenant]]++
+	}
+	// Tenants are distributed across all base paths.
+	for _, bp := range basePaths {
+		testutil.Assert(t, perBasePath[bp] > 0, "no tenant placed on %s", bp)
+	}
+
+	// Existing TSDBs are kept in place when the placement changes.
+	m = newMultiTSDB(map[string]string{"tenant-0": basePaths[1]})
+	testutil.Ok(t, m.Open())
+	testutil.Equals(t, filepath.Join(basePaths[2], "tenant-0"), m.tenantDataDir("tenant-0"))
+	testutil.Ok(t, appendSample(m, "tenant-0", time.Now()))
+	testutil.Ok(t, m.Close())
+	testutil.Equals(t, placed, tenantBasePaths())
+}
+
+func TestMultiTSDBRemoveOrphanedDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-orphaned-dirs")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	newMultiTSDB := func() *MultiTSDB {
+		return NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+			&tsdb.Options{
+				MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+				MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+				RetentionDuration: (6 * time.Hour).Milliseconds(),
+			},
+			labels.FromStrings("replica", "test"),
+			"tenant_id",
+			nil,
+			false,
+			metadata.NoneFunc,
+		)
+	}
+
+	m := newMultiTSDB()
+	testutil.Ok(t, appendSample(m, "foo", time.Now().Add(-time.Minute)))
+	testutil.Ok(t, appendSample(m, "foo", time.Now()))
+	testutil.Ok(t, m.Flush())
+	testutil.Ok(t, m.Close())
+
+	tenantDir := filepath.Join(dir, "foo")
+	fis, err := ioutil.ReadDir(tenantDir)
+	testutil.Ok(t, err)
+	var blocks []string
+	for _, fi := range fis {
+		if _, err := ulid.ParseStrict(fi.Name()); err == nil {
+			blocks = append(blocks, fi.Name())
+		}
+	}
+	testutil.Equals(t, 1, len(blocks))
+
+	// Leave directories of blocks being written and deleted by a crash, and other directories which must be kept.
+	var (
+		partial  = ulid.MustNew(1, nil).String()
+		creating = ulid.MustNew(2, nil).String() + ".tmp-for-creation"
+		other    = "other.tmp"
+	)
+	for _, d := range []string{filepath.Join(partial, "chunks"), creating, other} {
+		testutil.Ok(t, os.MkdirAll(filepath.Join(tenantDir, d), 0750))
+	}
+
+	m = newMultiTSDB()
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.RemoveOrphanedDirsIfAny())
+	testutil.Ok(t, m.Open())
+
+	for _, d := range []string{partial, creating} {
+		_, err := os.Stat(filepath.Join(tenantDir, d))
+		testutil.Assert(t, os.IsNotExist(err), "orphaned directory %s not removed", d)
+	}
+	for _, d := range append(blocks, other) {
+		_, err := os.Stat(filepath.Join(tenantDir, d))
+		testutil.Ok(t, err)
+	}
+
+	m.mtx.RLock()
+	db := m.tenants["foo"].readyStorage().Get()
+	m.mtx.RUnlock()
+	testutil.Equals(t, 1, len(db.Blocks()))
+	testutil.Equals(t, blocks[0], db.Blocks()[0].Meta().ULID.String())
+}
+
+func TestMultiTSDBWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multitsdb-wal-replay")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	newMultiTSDB := func() *MultiTSDB {
+		return NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+			&tsdb.Options{
+				MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+				MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+				RetentionDuration: (6 * time.Hour).Milliseconds(),
+			},
+			labels.FromStrings("replica", "test"),
+			"tenant_id",
+			nil,
+			false,
+			metadata.NoneFunc,
+		)
+	}
+
+	// Leave a WAL large enough for its replay to take a while.
+	m := newMultiTSDB()
+	app, err := m.TenantAppendable("foo")
+	testutil.Ok(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var a storage.Appender
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		a, err = app.Appender(ctx)
+		return err
+	}))
+	now := time.Now()
+	for i := 0; i < 2000; i++ {
+		lset := labels.FromStrings("a", fmt.Sprintf("%d", i))
+		for j := 0; j < 100; j++ {
+			_, err := a.Append(0, lset, now.Add(time.Duration(j-100)*time.Second).UnixMilli(), float64(j))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, a.Commit())
+	testutil.Ok(t, m.Close())
+
+	m = newMultiTSDB()
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.OpenAsync())
+
+	// Writes of the tenant are rejected until its WAL is replayed.
+	testutil.Assert(t, !m.WALReplayed(), "WAL replayed before the TSDB was opened")
+	app, err = m.TenantAppendable("foo")
+	testutil.Ok(t, err)
+	_, err = app.Appender(ctx)
+	testutil.Equals(t, ErrNotReady, err)
+	// New tenants don't wait for the replay.
+	testutil.Ok(t, appendSample(m, "bar", now))
+	testutil.Assert(t, !m.WALReplayed(), "WAL replayed before the TSDB was opened")
+
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		if !m.WALReplayed() {
+			return errors.New("WAL not replayed")
+		}
+		return nil
+	}))
+	_, err = app.Appender(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(m.walReplayProgress.WithLabelValues("foo")))
+	testutil.Assert(t, promtestutil.ToFloat64(m.walReplayDuration.WithLabelValues("foo")) > 0, "WAL replay duration not reported")
+
+	stats := m.TenantStats("", "foo")
+	testutil.Equals(t, 1, len(stats))
+	testutil.Equals(t, uint64(2000), stats[0].Stats.NumSeries)
+}
+
 func TestMultiTSDBStats(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -491,12 +899,12 @@ func TestMultiTSDBStats(t *testing.T) {
 		{
 			name:          "missing tenant",
 			tenants:       []string{"missing-foo"},
-			expectedStats: 0,
+			expectedStats: 1,
 		},
 		{
 			name:          "multiple tenants with missing tenant",
 			tenants:       []string{"foo", "missing-foo"},
-			expectedStats: 1,
+			expectedStats: 2,
 		},
 		{
 			name:          "all tenants",
@@ -532,6 +940,15 @@ func TestMultiTSDBStats(t *testing.T) {
 
 			stats := m.TenantStats(labels.MetricName, test.tenants...)
 			testutil.Equals(t, test.expectedStats, len(stats))
+			for _, s := range stats {
+				if s.Tenant != "missing-foo" {
+					testutil.Equals(t, uint64(1), s.Stats.NumSeries)
+					continue
+				}
+				// Tenants without a TSDB get the stats of an empty head.
+				testutil.Equals(t, uint64(0), s.Stats.NumSeries)
+				testutil.Equals(t, 0, s.Stats.IndexPostingStats.NumLabelPairs)
+			}
 		})
 	}
 }
@@ -603,3 +1020,158 @@ func BenchmarkMultiTSDB(b *testing.B) {
 		_, _ = a.Append(0, l, int64(i), float64(i))
 	}
 }
+
+func TestMultiTSDBLocalRetention(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  short:
+    local_retention: 1h
+  long:
+    local_retention: 24h
+`)))
+
+	type tenantBlocks struct {
+		oldShipped, oldNotShipped, recentShipped ulid.ULID
+	}
+	now := time.Now()
+	createBlocks := func(tenant string) tenantBlocks {
+		tenantDir := filepath.Join(dir, tenant)
+		series := []labels.Labels{labels.FromStrings("a", "1")}
+		createBlock := func(maxt time.Time) ulid.ULID {
+			id, err := e2eutil.CreateBlock(ctx, tenantDir, series, 10, timestamp.FromTime(maxt.Add(-time.Hour)), timestamp.FromTime(maxt), nil, 0, metadata.NoneFunc)
+			testutil.Ok(t, err)
+			return id
+		}
+
+		b := tenantBlocks{
+			oldShipped:    createBlock(now.Add(-10 * time.Hour)),
+			oldNotShipped: createBlock(now.Add(-8 * time.Hour)),
+			recentShipped: createBlock(now.Add(-10 * time.Minute)),
+		}
+		testutil.Ok(t, shipper.WriteMetaFile(log.NewNopLogger(), tenantDir, &shipper.Meta{
+			Version:  shipper.MetaVersion1,
+			Uploaded: []ulid.ULID{b.oldShipped, b.recentShipped},
+		}))
+		return b
+	}
+	short, long := createBlocks("short"), createBlocks("long")
+
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(),
+		&tsdb.Options{
+			MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+			MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+			RetentionDuration: (15 * 24 * time.Hour).Milliseconds(),
+			NoLockfile:        true,
+		},
+		labels.FromStrings("replica", "test"),
+		"tenant_id",
+		objstore.NewInMemBucket(),
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	blocks := func(tenant string) map[ulid.ULID]struct{} {
+		m.mtx.RLock()
+		defer m.mtx.RUnlock()
+		res := map[ulid.ULID]struct{}{}
+		for _, b := range m.tenants[tenant].readyStorage().Get().Blocks() {
+			res[b.Meta().ULID] = struct{}{}
+		}
+		return res
+	}
+
+	// Shipped blocks beyond the local retention of the tenant are deleted, the ones not shipped yet are kept.
+	testutil.Equals(t, map[ulid.ULID]struct{}{short.oldNotShipped: {}, short.recentShipped: {}}, blocks("short"))
+	testutil.Equals(t, map[ulid.ULID]struct{}{long.oldShipped: {}, long.oldNotShipped: {}, long.recentShipped: {}}, blocks("long"))
+
+	// Changes of the local retention are applied on the next reload of blocks.
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  short:
+    local_retention: 1h
+  long:
+    local_retention: 1h
+`)))
+	testutil.Ok(t, m.Flush())
+	testutil.Equals(t, map[ulid.ULID]struct{}{short.oldNotShipped: {}, short.recentShipped: {}}, blocks("short"))
+	testutil.Equals(t, map[ulid.ULID]struct{}{long.oldNotShipped: {}, long.recentShipped: {}}, blocks("long"))
+}
+
+// concurrencyTrackingBucket tracks the maximum number of concurrent uploads, each taking the given delay.
+type concurrencyTrackingBucket struct {
+	objstore.Bucket
+	delay time.Duration
+
+	mtx         sync.Mutex
+	inflight    int
+	maxInflight int
+}
+
+func (b *concurrencyTrackingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.mtx.Lock()
+	b.inflight++
+	if b.inflight > b.maxInflight {
+		b.maxInflight = b.inflight
+	}
+	b.mtx.Unlock()
+
+	defer func() {
+		b.mtx.Lock()
+		b.inflight--
+		b.mtx.Unlock()
+	}()
+
+	time.Sleep(b.delay)
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func TestMultiTSDBSyncConcurrency(t *testing.T) {
+	ctx := context.Background()
+	tenants := []string{"a", "b", "c", "d", "e"}
+
+	for _, shipConcurrency := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("concurrency=%d", shipConcurrency), func(t *testing.T) {
+			tenantsDir := t.TempDir()
+			for _, tenant := range tenants {
+				_, err := e2eutil.CreateBlock(ctx, filepath.Join(tenantsDir, tenant), []labels.Labels{labels.FromStrings("a", "1")}, 10, 0, 1000, nil, 0, metadata.NoneFunc)
+				testutil.Ok(t, err)
+			}
+
+			bkt := &concurrencyTrackingBucket{Bucket: objstore.NewInMemBucket(), delay: 20 * time.Millisecond}
+			m := NewMultiTSDB(tenantsDir, log.NewNopLogger(), prometheus.NewRegistry(),
+				&tsdb.Options{
+					MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+					MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+					RetentionDuration: (15 * 24 * time.Hour).Milliseconds(),
+					NoLockfile:        true,
+				},
+				labels.FromStrings("replica", "test"),
+				"tenant_id",
+				bkt,
+				false,
+				metadata.NoneFunc,
+				WithShipConcurrency(shipConcurrency),
+			)
+			defer func() { testutil.Ok(t, m.Close()) }()
+			testutil.Ok(t, m.Open())
+
+			uploaded, err := m.Sync(ctx)
+			testutil.Ok(t, err)
+			testutil.Equals(t, len(tenants), uploaded)
+
+			// Each tenant uploads the files of its block one at a time, so concurrent uploads are from different tenants.
+			expectedMaxInflight := shipConcurrency
+			if shipConcurrency == 0 {
+				expectedMaxInflight = len(tenants)
+			}
+			testutil.Equals(t, expectedMaxInflight, bkt.maxInflight)
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+const (
+	otlpContentTypeProtobuf = "application/x-protobuf"
+	otlpContentTypeJSON     = "application/json"
+)
+
+// receiveOTLPHTTP serves OTLP/HTTP metrics export requests. Their metrics are translated to Prometheus series and
+// written like remote write requests.
+func (h *Handler) receiveOTLPHTTP(w http.ResponseWriter, r *http.Request) {
+	span, ctx := tracing.StartSpan(r.Context(), "receive_otlp_http")
+	defer span.Finish()
+
+	details, code, err := h.receive(ctx, r, h.decodeOTLPRequest)
+	if err == nil && !h.options.PartialSuccessDetails {
+		writeOTLPResponse(w, r)
+		return
+	}
+	h.respond(w, details, err, code)
+}
+
+// decodeOTLPRequest decodes the optionally gzip compressed protobuf or JSON body of an OTLP/HTTP metrics export request.
+func (h *Handler) decodeOTLPRequest(r *http.Request, body []byte) (*prompb.WriteRequest, error) {
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip decode error")
+		}
+		if body, err = ioutil.ReadAll(gr); err != nil {
+			return nil, errors.Wrap(err, "gzip decode error")
+		}
+	}
+
+	// The export request has the same encoding as MetricsData, which doesn't pull the OTLP gRPC service.
+	var md metricspb.MetricsData
+	switch otlpContentType(r) {
+	case otlpContentTypeJSON:
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &md); err != nil {
+			return nil, errors.Wrap(err, "decode OTLP JSON request")
+		}
+	default:
+		if err := protobuf.Unmarshal(body, &md); err != nil {
+			return nil, errors.Wrap(err, "decode OTLP protobuf request")
+		}
+	}
+	return otlpToWriteRequest(&md, h.options.OTLPPromoteResourceAttributes), nil
+}
+
+func otlpContentType(r *http.Request) string {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return otlpContentTypeProtobuf
+	}
+	return t
+}
+
+// writeOTLPResponse writes the empty export response, in the encoding of the request.
+func writeOTLPResponse(w http.ResponseWriter, r *http.Request) {
+	if otlpContentType(r) == otlpContentTypeJSON {
+		w.Header().Set("Content-Type", otlpContentTypeJSON)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("{}"))
+		return
+	}
+	w.Header().Set("Content-Type", otlpContentTypeProtobuf)
+	w.WriteHeader(http.StatusOK)
+}
+
+// otlpToWriteRequest translates OTLP metrics to Prometheus series, the way the Prometheus remote write exporter of
+// the OpenTelemetry Collector does:
+//   - Metric and label names are sanitized to the Prometheus charset.
+//   - Monotonic cumulative sums get a _total suffix, non monotonic sums are gauges.
+//   - Histograms are translated to _bucket, _sum and _count series, summaries to quantile, _sum and _count series.
+//   - The service.name and service.namespace resource attributes make the job label, service.instance.id the
+//     instance label. Other resource attributes are only kept if promoted.
+//   - Points without a recorded value are stale markers.
+//
+// Delta temporality metrics and exponential histograms have no Prometheus equivalent and are dropped.
+func otlpToWriteRequest(md *metricspb.MetricsData, promoteResourceAttributes []string) *prompb.WriteRequest {
+	t := &otlpTranslator{series: map[string]int{}}
+	for _, rm := range md.GetResourceMetrics() {
+		resourceLabels := otlpResourceLabels(rm.GetResource().GetAttributes(), promoteResourceAttributes)
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				t.addMetric(resourceLabels, m)
+			}
+		}
+		for _, ilm := range rm.GetInstrumentationLibraryMetrics() {
+			for _, m := range ilm.GetMetrics() {
+				t.addMetric(resourceLabels, m)
+			}
+		}
+	}
+
+	for _, ts := range t.wreq.Timeseries {
+		sort.Slice(ts.Samples, func(i, j int) bool { return ts.Samples[i].Timestamp < ts.Samples[j].Timestamp })
+	}
+	return &t.wreq
+}
+
+type otlpTranslator struct {
+	wreq prompb.WriteRequest
+	// series maps the labels of the series to their index in the write request, so points of the same series are
+	// written as one series.
+	series map[string]int
+}
+
+func (t *otlpTranslator) addMetric(resourceLabels labels.Labels, m *metricspb.Metric) {
+	name := sanitizeMetricName(m.GetName())
+	switch m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range m.GetGauge().GetDataPoints() {
+			t.addNumberPoint(resourceLabels, name, p)
+		}
+	case *metricspb.Metric_Sum:
+		sum := m.GetSum()
+		if sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			return
+		}
+		if sum.GetIsMonotonic() && !strings.HasSuffix(name, "_total") {
+			name += "_total"
+		}
+		for _, p := range sum.GetDataPoints() {
+			t.addNumberPoint(resourceLabels, name, p)
+		}
+	case *metricspb.Metric_Histogram:
+		if m.GetHistogram().GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			return
+		}
+		for _, p := range m.GetHistogram().GetDataPoints() {
+			t.addHistogramPoint(resourceLabels, name, p)
+		}
+	case *metricspb.Metric_Summary:
+		for _, p := range m.GetSummary().GetDataPoints() {
+			t.addSummaryPoint(resourceLabels, name, p)
+		}
+	}
+}
+
+func (t *otlpTranslator) addNumberPoint(resourceLabels labels.Labels, name string, p *metricspb.NumberDataPoint) {
+	v := p.GetAsDouble()
+	if _, ok := p.Value.(*metricspb.NumberDataPoint_AsInt); ok {
+		v = float64(p.GetAsInt())
+	}
+	lset := otlpLabels(resourceLabels, p.GetAttributes())
+	t.add(lset, name, nil, otlpSample(p.GetTimeUnixNano(), p.GetFlags(), v))
+}
+
+func (t *otlpTranslator) addHistogramPoint(resourceLabels labels.Labels, name string, p *metricspb.HistogramDataPoint) {
+	lset := otlpLabels(resourceLabels, p.GetAttributes())
+	ts, flags := p.GetTimeUnixNano(), p.GetFlags()
+
+	// Buckets of OTLP histograms are not cumulative, and the last bucket is the +Inf one.
+	var cumulative uint64
+	for i, bound := range p.GetExplicitBounds() {
+		if i < len(p.GetBucketCounts()) {
+			cumulative += p.GetBucketCounts()[i]
+		}
+		le := labels.Label{Name: labels.BucketLabel, Value: strconv.FormatFloat(bound, 'f', -1, 64)}
+		t.add(lset, name+"_bucket", &le, otlpSample(ts, flags, float64(cumulative)))
+	}
+	inf := labels.Label{Name: labels.BucketLabel, Value: "+Inf"}
+	t.add(lset, name+"_bucket", &inf, otlpSample(ts, flags, float64(p.GetCount())))
+	if p.Sum != nil {
+		t.add(lset, name+"_sum", nil, otlpSample(ts, flags, p.GetSum()))
+	}
+	t.add(lset, name+"_count", nil, otlpSample(ts, flags, float64(p.GetCount())))
+}
+
+func (t *otlpTranslator) addSummaryPoint(resourceLabels labels.Labels, name string, p *metricspb.SummaryDataPoint) {
+	lset := otlpLabels(resourceLabels, p.GetAttributes())
+	ts, flags := p.GetTimeUnixNano(), p.GetFlags()
+
+	for _, q := range p.GetQuantileValues() {
+		quantile := labels.Label{Name: "quantile", Value: strconv.FormatFloat(q.GetQuantile(), 'f', -1, 64)}
+		t.add(lset, name, &quantile, otlpSample(ts, flags, q.GetValue()))
+	}
+	t.add(lset, name+"_sum", nil, otlpSample(ts, flags, p.GetSum()))
+	t.add(lset, name+"_count", nil, otlpSample(ts, flags, float64(p.GetCount())))
+}
+
+// add adds the sample to the series with the given labels, metric name and extra label.
+func (t *otlpTranslator) add(lset labels.Labels, name string, extra *labels.Label, s prompb.Sample) {
+	b := labels.NewBuilder(lset).Set(labels.MetricName, name)
+	if extra != nil {
+		b.Set(extra.Name, extra.Value)
+	}
+	lset = b.Labels()
+
+	key := lset.String()
+	if i, ok := t.series[key]; ok {
+		t.wreq.Timeseries[i].Samples = append(t.wreq.Timeseries[i].Samples, s)
+		return
+	}
+	t.series[key] = len(t.wreq.Timeseries)
+	t.wreq.Timeseries = append(t.wreq.Timeseries, prompb.TimeSeries{
+		Labels:  labelpb.ZLabelsFromPromLabels(lset),
+		Samples: []prompb.Sample{s},
+	})
+}
+
+func otlpSample(timeUnixNano uint64, flags uint32, v float64) prompb.Sample {
+	if flags&uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE) != 0 {
+		v = math.Float64frombits(value.StaleNaN)
+	}
+	return prompb.Sample{Timestamp: int64(timeUnixNano / 1e6), Value: v}
+}
+
+// otlpResourceLabels returns the labels of the series of a resource: job and instance, and the promoted attributes.
+func otlpResourceLabels(attrs []*commonpb.KeyValue, promote []string) labels.Labels {
+	b := labels.NewBuilder(nil)
+	var serviceName, serviceNamespace string
+	for _, kv := range attrs {
+		switch kv.GetKey() {
+		case "service.name":
+			serviceName = otlpAttributeValue(kv.GetValue())
+		case "service.namespace":
+			serviceNamespace = otlpAttributeValue(kv.GetValue())
+		case "service.instance.id":
+			b.Set("instance", otlpAttributeValue(kv.GetValue()))
+		}
+		for _, p := range promote {
+			if kv.GetKey() == p {
+				b.Set(sanitizeLabelName(p), otlpAttributeValue(kv.GetValue()))
+				break
+			}
+		}
+	}
+	if serviceName != "" {
+		job := serviceName
+		if serviceNamespace != "" {
+			job = serviceNamespace + "/" + serviceName
+		}
+		b.Set("job", job)
+	}
+	return b.Labels()
+}
+
+// otlpLabels returns the labels of the series of a point, its attributes taking precedence over resource labels.
+func otlpLabels(resourceLabels labels.Labels, attrs []*commonpb.KeyValue) labels.Labels {
+	b := labels.NewBuilder(resourceLabels)
+	for _, kv := range attrs {
+		b.Set(sanitizeLabelName(kv.GetKey()), otlpAttributeValue(kv.GetValue()))
+	}
+	return b.Labels()
+}
+
+// otlpAttributeValue returns the label value of an attribute. Arrays and maps are encoded as JSON.
+func otlpAttributeValue(v *commonpb.AnyValue) string {
+	switch v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.GetStringValue()
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.GetBoolValue())
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.GetIntValue(), 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.GetDoubleValue(), 'f', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.GetBytesValue())
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		b, _ := json.Marshal(otlpAttributeJSON(v))
+		return string(b)
+	}
+	return ""
+}
+
+func otlpAttributeJSON(v *commonpb.AnyValue) interface{} {
+	switch v.GetValue().(type) {
+	case *commonpb.AnyValue_ArrayValue:
+		res := make([]interface{}, 0, len(v.GetArrayValue().GetValues()))
+		for _, e := range v.GetArrayValue().GetValues() {
+			res = append(res, otlpAttributeJSON(e))
+		}
+		return res
+	case *commonpb.AnyValue_KvlistValue:
+		res := make(map[string]interface{}, len(v.GetKvlistValue().GetValues()))
+		for _, kv := range v.GetKvlistValue().GetValues() {
+			res[kv.GetKey()] = otlpAttributeJSON(kv.GetValue())
+		}
+		return res
+	}
+	return otlpAttributeValue(v)
+}
+
+// sanitizeMetricName replaces characters not allowed in metric names with underscores.
+func sanitizeMetricName(name string) string {
+	return sanitizeName(name, func(r rune) bool { return r == ':' })
+}
+
+// sanitizeLabelName replaces characters not allowed in label names with underscores.
+func sanitizeLabelName(name string) string {
+	return sanitizeName(name, func(rune) bool { return false })
+}
+
+func sanitizeName(name string, allowed func(rune) bool) string {
+	if name == "" {
+		return name
+	}
+	s := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || allowed(r)) {
+			return r
+		}
+		return '_'
+	}, name)
+	if unicode.IsDigit(rune(s[0])) {
+		s = "key_" + s
+	}
+	return s
+}
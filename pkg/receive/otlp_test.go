@@ -0,0 +1,206 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func testOTLPMetrics() *metricspb.MetricsData {
+	const ts = uint64(10 * time.Millisecond)
+	sum := 4.5
+	return &metricspb.MetricsData{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttr("service.name", "api"),
+			stringAttr("service.namespace", "shop"),
+			stringAttr("service.instance.id", "pod-1"),
+			stringAttr("k8s.namespace.name", "prod"),
+			stringAttr("host.name", "node-1"),
+		}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{
+				Name: "queue.size",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+					{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}, Attributes: []*commonpb.KeyValue{stringAttr("queue", "a")}},
+					{TimeUnixNano: 2 * ts, Flags: uint32(metricspb.DataPointFlags_FLAG_NO_RECORDED_VALUE), Attributes: []*commonpb.KeyValue{stringAttr("queue", "a")}},
+				}}},
+			},
+			{
+				Name: "http.requests",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             []*metricspb.NumberDataPoint{{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 7}}},
+				}},
+			},
+			{
+				Name: "connections",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             []*metricspb.NumberDataPoint{{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 2}}},
+				}},
+			},
+			{
+				Name: "deltas",
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints:             []*metricspb.NumberDataPoint{{TimeUnixNano: ts, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1}}},
+				}},
+			},
+			{
+				Name: "latency",
+				Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*metricspb.HistogramDataPoint{{
+						TimeUnixNano:   ts,
+						Count:          5,
+						Sum:            &sum,
+						ExplicitBounds: []float64{0.1, 1},
+						BucketCounts:   []uint64{1, 3, 1},
+					}},
+				}},
+			},
+			{
+				Name: "size",
+				Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{DataPoints: []*metricspb.SummaryDataPoint{{
+					TimeUnixNano:   ts,
+					Count:          2,
+					Sum:            3,
+					QuantileValues: []*metricspb.SummaryDataPoint_ValueAtQuantile{{Quantile: 0.5, Value: 1}},
+				}}}},
+			},
+		}}},
+	}}}
+}
+
+func TestOTLPToWriteRequest(t *testing.T) {
+	wreq := otlpToWriteRequest(testOTLPMetrics(), []string{"k8s.namespace.name"})
+
+	got := map[string][]prompb.Sample{}
+	for _, ts := range wreq.Timeseries {
+		got[labelpb.ZLabelsToPromLabels(ts.Labels).String()] = ts.Samples
+	}
+
+	// Resource attributes make the job and instance labels, only the promoted one is kept besides them.
+	series := func(lbls ...string) string {
+		return labels.FromStrings(append([]string{"job", "shop/api", "instance", "pod-1", "k8s_namespace_name", "prod"}, lbls...)...).String()
+	}
+	sample := func(v float64) []prompb.Sample { return []prompb.Sample{{Timestamp: 10, Value: v}} }
+
+	gauge := got[series(labels.MetricName, "queue_size", "queue", "a")]
+	testutil.Equals(t, 2, len(gauge))
+	testutil.Equals(t, prompb.Sample{Timestamp: 10, Value: 3}, gauge[0])
+	// Points without a recorded value are stale markers.
+	testutil.Equals(t, int64(20), gauge[1].Timestamp)
+	testutil.Assert(t, value.IsStaleNaN(gauge[1].Value), "expected stale marker, got %v", gauge[1].Value)
+	delete(got, series(labels.MetricName, "queue_size", "queue", "a"))
+
+	testutil.Equals(t, map[string][]prompb.Sample{
+		series(labels.MetricName, "http_requests_total"):          sample(7),
+		series(labels.MetricName, "connections"):                  sample(2),
+		series(labels.MetricName, "latency_bucket", "le", "0.1"):  sample(1),
+		series(labels.MetricName, "latency_bucket", "le", "1"):    sample(4),
+		series(labels.MetricName, "latency_bucket", "le", "+Inf"): sample(5),
+		series(labels.MetricName, "latency_sum"):                  sample(4.5),
+		series(labels.MetricName, "latency_count"):                sample(5),
+		series(labels.MetricName, "size", "quantile", "0.5"):      sample(1),
+		series(labels.MetricName, "size_sum"):                     sample(3),
+		series(labels.MetricName, "size_count"):                   sample(2),
+	}, got)
+}
+
+func TestSanitizeName(t *testing.T) {
+	testutil.Equals(t, "http_server_duration", sanitizeMetricName("http.server.duration"))
+	testutil.Equals(t, "ns:rate_5m", sanitizeMetricName("ns:rate-5m"))
+	testutil.Equals(t, "ns_rate", sanitizeLabelName("ns:rate"))
+	testutil.Equals(t, "key_0abc", sanitizeLabelName("0abc"))
+	testutil.Equals(t, "_private", sanitizeLabelName("_private"))
+}
+
+func TestReceiveOTLP(t *testing.T) {
+	appenders := &tenantAppenders{appenders: map[string]*fakeAppender{}}
+	h := NewHandler(nil, &Options{
+		TenantHeader:      DefaultTenantHeader,
+		DefaultTenantID:   DefaultTenant,
+		ReplicaHeader:     DefaultReplicaHeader,
+		ReplicationFactor: 1,
+		ForwardTimeout:    5 * time.Second,
+		Endpoint:          randomAddr(),
+		Writer:            NewWriter(log.NewNopLogger(), appenders, nil),
+	})
+	h.Hashring(newMultiHashring(AlgorithmHashmod, []HashringConfig{{Hashring: "test", Endpoints: []string{h.options.Endpoint}}}))
+
+	send := func(tenant, contentType, contentEncoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/otlp/v1/metrics", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		req.Header.Set(DefaultTenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		h.receiveOTLPHTTP(rec, req)
+		return rec
+	}
+	samples := func(tenant string, lbls ...string) []prompb.Sample {
+		return appenders.get(tenant).Get(labels.FromStrings(append([]string{"job", "shop/api", "instance", "pod-1"}, lbls...)...))
+	}
+
+	pb, err := protobuf.Marshal(testOTLPMetrics())
+	testutil.Ok(t, err)
+	rec := send("a", "application/x-protobuf", "", pb)
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "application/x-protobuf", rec.Header().Get("Content-Type"))
+	testutil.Equals(t, []prompb.Sample{{Timestamp: 10, Value: 7}}, samples("a", labels.MetricName, "http_requests_total"))
+	testutil.Equals(t, 0, len(samples(DefaultTenant, labels.MetricName, "http_requests_total")))
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	js, err := protojson.Marshal(testOTLPMetrics())
+	testutil.Ok(t, err)
+	_, err = gw.Write(js)
+	testutil.Ok(t, err)
+	testutil.Ok(t, gw.Close())
+	rec = send("b", "application/json", "gzip", gz.Bytes())
+	testutil.Equals(t, http.StatusOK, rec.Code, rec.Body.String())
+	testutil.Equals(t, "{}", rec.Body.String())
+	testutil.Equals(t, []prompb.Sample{{Timestamp: 10, Value: 5}}, samples("b", labels.MetricName, "latency_count"))
+
+	// Failed writes get the status code of remote write requests.
+	h.pausedTenants.pause("c")
+	rec = send("c", "application/x-protobuf", "", pb)
+	testutil.Equals(t, http.StatusTooManyRequests, rec.Code)
+
+	rec = send("a", "application/x-protobuf", "", []byte("not protobuf"))
+	testutil.Equals(t, http.StatusBadRequest, rec.Code)
+
+	// Duplicated samples are a conflict.
+	appenders.get("d").appendErr = func() error { return storage.ErrDuplicateSampleForTimestamp }
+	rec = send("d", "application/x-protobuf", "", pb)
+	testutil.Equals(t, http.StatusConflict, rec.Code)
+
+}
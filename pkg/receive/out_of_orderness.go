@@ -0,0 +1,60 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// otherTenantsLabel is the tenant label value of the out-of-orderness histograms of the tenants above the cap.
+const otherTenantsLabel = "__other__"
+
+// outOfOrdernessMetrics are the histograms of how far the samples of tenants lag behind, for the tenants whose
+// out-of-orderness is reported.
+type outOfOrdernessMetrics struct {
+	// maxTenants is the number of tenants with histograms of their own. Other tenants share the histograms
+	// labeled with otherTenantsLabel. 0 means no limit.
+	maxTenants int
+
+	mtx     sync.Mutex
+	tenants map[string]struct{}
+
+	age    *prometheus.HistogramVec
+	behind *prometheus.HistogramVec
+}
+
+func newOutOfOrdernessMetrics(reg prometheus.Registerer) *outOfOrdernessMetrics {
+	buckets := []float64{0, 1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200}
+	return &outOfOrdernessMetrics{
+		tenants: map[string]struct{}{},
+		age: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_receive_sample_age_seconds",
+			Help:    "How far in the past samples of the tenant are when written, i.e. the time of receiving them minus their timestamp.",
+			Buckets: buckets,
+		}, []string{"tenant"}),
+		behind: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_receive_sample_out_of_orderness_seconds",
+			Help:    "How far out-of-order samples of the tenant lag behind the newest sample of the tenant when written.",
+			Buckets: buckets,
+		}, []string{"tenant"}),
+	}
+}
+
+// tenantLabel returns the tenant label value of the histograms of the given tenant.
+func (m *outOfOrdernessMetrics) tenantLabel(tenantID string) string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.tenants[tenantID]; ok {
+		return tenantID
+	}
+	if m.maxTenants > 0 && len(m.tenants) >= m.maxTenants {
+		return otherTenantsLabel
+	}
+	m.tenants[tenantID] = struct{}{}
+	return tenantID
+}
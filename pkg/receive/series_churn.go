@@ -0,0 +1,38 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// CheckSeriesChurn flags the tenants which created more series per minute since the previous check than their series
+// churn threshold, so that high churn tenants can be alerted on. The first check of a tenant only records its state.
+func (t *MultiTSDB) CheckSeriesChurn(now time.Time) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	for tenantID, tenant := range t.tenants {
+		created := tenant.seriesCreated.Load()
+		last := tenant.churnCheck
+		tenant.churnCheck.time, tenant.churnCheck.seriesCreated = now, created
+		if last.time.IsZero() || !now.After(last.time) {
+			continue
+		}
+
+		var threshold int
+		if t.tenantOverrides != nil {
+			threshold = t.tenantOverrides.ForTenant(tenantID).SeriesChurnThreshold
+		}
+		perMinute := float64(created-last.seriesCreated) / now.Sub(last.time).Minutes()
+		if threshold <= 0 || perMinute <= float64(threshold) {
+			t.highSeriesChurn.WithLabelValues(tenantID).Set(0)
+			continue
+		}
+		level.Warn(t.logger).Log("msg", "high series churn of tenant", "tenant", tenantID, "seriesPerMinute", perMinute, "threshold", threshold)
+		t.highSeriesChurn.WithLabelValues(tenantID).Set(1)
+	}
+}
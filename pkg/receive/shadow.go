@@ -0,0 +1,97 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// shadowKey identifies a mirrored write request to an endpoint of the shadow hashring, as replica n.
+type shadowKey struct {
+	endpoint string
+	n        uint64
+}
+
+// shadowWrite asynchronously mirrors the write request to the endpoints of the shadow hashring, replicated the same way
+// as in the primary hashring. It never blocks nor fails: errors of mirrored requests are only counted and logged, and
+// the request is not mirrored at all if too many mirrored requests are in flight already.
+func (h *Handler) shadowWrite(tenant string, wreq *prompb.WriteRequest) {
+	if h.shadowInflight != nil {
+		select {
+		case h.shadowInflight <- struct{}{}:
+		default:
+			h.shadowDroppedRequests.Inc()
+			return
+		}
+	}
+
+	go func() {
+		if h.shadowInflight != nil {
+			defer func() { <-h.shadowInflight }()
+		}
+		h.shadowForward(tenant, wreq)
+	}()
+}
+
+func (h *Handler) shadowForward(tenant string, wreq *prompb.WriteRequest) {
+	tLogger := log.With(h.logger, "tenant", tenant, "hashring", "shadow")
+
+	replicationFactor := h.options.ReplicationFactor
+	if replicationFactor < 1 {
+		replicationFactor = 1
+	}
+
+	wreqs := make(map[shadowKey]*prompb.WriteRequest)
+	for i := range wreq.Timeseries {
+		for n := uint64(0); n < replicationFactor; n++ {
+			endpoint, err := h.options.ShadowHashring.GetN(tenant, &wreq.Timeseries[i], n)
+			if err != nil {
+				h.shadowForwardRequests.WithLabelValues(labelError).Inc()
+				level.Debug(tLogger).Log("msg", "shadow write failed", "err", errors.Wrap(err, "get endpoint"))
+				return
+			}
+			key := shadowKey{endpoint: endpoint, n: n}
+			if _, ok := wreqs[key]; !ok {
+				wreqs[key] = &prompb.WriteRequest{}
+			}
+			wreqs[key].Timeseries = append(wreqs[key].Timeseries, wreq.Timeseries[i])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.ForwardTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for key, wr := range wreqs {
+		wg.Add(1)
+		go func(key shadowKey, wr *prompb.WriteRequest) {
+			defer wg.Done()
+
+			cl, err := h.peers.get(ctx, key.endpoint)
+			if err == nil {
+				_, err = cl.RemoteWrite(ctx, &storepb.WriteRequest{
+					Timeseries: wr.Timeseries,
+					Tenant:     tenant,
+					// Mirrored requests are always marked as replicated, so that shadow endpoints don't replicate them again.
+					Replica: int64(key.n + 1),
+				})
+			}
+			if err != nil {
+				h.shadowForwardRequests.WithLabelValues(labelError).Inc()
+				level.Debug(tLogger).Log("msg", "shadow write failed", "err", err, "endpoint", key.endpoint)
+				return
+			}
+			h.shadowForwardRequests.WithLabelValues(labelSuccess).Inc()
+		}(key, wr)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,62 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+)
+
+// fieldSize returns the encoded size of a length-delimited protobuf field with a single byte tag and a message of
+// the given size.
+func fieldSize(size int) int {
+	n := 1
+	for v := uint64(size); v >= 0x80; v >>= 7 {
+		n++
+	}
+	return 1 + n + size
+}
+
+// splitWriteRequest splits the series of the write request into requests whose encoded size is at most maxBytes,
+// in the order of the series. Series larger than maxBytes are split by samples, their exemplars going with their
+// first samples. A request is larger than maxBytes only if the labels and exemplars of a series with a single sample are.
+func splitWriteRequest(wreq *prompb.WriteRequest, maxBytes int) []*prompb.WriteRequest {
+	var (
+		wreqs []*prompb.WriteRequest
+		cur   = &prompb.WriteRequest{}
+		size  int
+	)
+	add := func(ts prompb.TimeSeries, tsSize int) {
+		if len(cur.Timeseries) > 0 && size+tsSize > maxBytes {
+			wreqs = append(wreqs, cur)
+			cur, size = &prompb.WriteRequest{}, 0
+		}
+		cur.Timeseries = append(cur.Timeseries, ts)
+		size += tsSize
+	}
+
+	for _, ts := range wreq.Timeseries {
+		if tsSize := fieldSize(ts.Size()); tsSize <= maxBytes {
+			add(ts, tsSize)
+			continue
+		}
+
+		part := prompb.TimeSeries{Labels: ts.Labels, Exemplars: ts.Exemplars}
+		partSize := part.Size()
+		for _, s := range ts.Samples {
+			sampleSize := fieldSize(s.Size())
+			if len(part.Samples) > 0 && fieldSize(partSize+sampleSize) > maxBytes {
+				add(part, fieldSize(partSize))
+				part = prompb.TimeSeries{Labels: ts.Labels}
+				partSize = part.Size()
+			}
+			part.Samples = append(part.Samples, s)
+			partSize += sampleSize
+		}
+		add(part, fieldSize(partSize))
+	}
+	if len(cur.Timeseries) > 0 {
+		wreqs = append(wreqs, cur)
+	}
+	return wreqs
+}
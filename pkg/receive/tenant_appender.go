@@ -0,0 +1,181 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// errSampleBeyondReorderingTolerance is returned for samples lagging behind the newest sample of the tenant
+// by more than the sample reordering tolerance of the tenant.
+var errSampleBeyondReorderingTolerance = errors.New("sample older than the sample reordering tolerance of the tenant")
+
+// tenantAppendable is the Appendable of a tenant. It counts the series created by the tenant and applies the
+// overrides of the tenant, if any: the sample reordering tolerance, the active series limit, the out-of-orderness
+// reporting and the timestamp rounding. The overrides are read on every Appender call, so they follow config reloads.
+type tenantAppendable struct {
+	tenant    *tenant
+	tenantID  string
+	overrides *TenantOverrides
+
+	created               prometheus.Counter
+	rejected              prometheus.Counter
+	activeSeriesLimit     prometheus.Gauge
+	limited               prometheus.Counter
+	outOfOrderness        *outOfOrdernessMetrics
+	roundedSamplesDropped prometheus.Counter
+}
+
+func (a *tenantAppendable) Appender(ctx context.Context) (storage.Appender, error) {
+	app, err := a.tenant.readyStorage().Appender(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ta := &tenantAppender{
+		Appender:     app,
+		tenant:       a.tenant,
+		created:      a.created,
+		minValidTime: math.MinInt64,
+	}
+	db := a.tenant.readyStorage().Get()
+	if a.overrides == nil || db == nil {
+		return ta, nil
+	}
+
+	conf := a.overrides.ForTenant(a.tenantID)
+	head := db.Head()
+	maxt := head.MaxTime()
+
+	// Nothing was written to the head yet if its max time is still math.MinInt64.
+	if tolerance := time.Duration(conf.SampleReorderingTolerance); tolerance > 0 && maxt != math.MinInt64 {
+		ta.minValidTime = maxt - tolerance.Milliseconds()
+		ta.rejected = a.rejected
+	}
+
+	a.activeSeriesLimit.Set(float64(conf.MaxActiveSeries))
+	if conf.MaxActiveSeries > 0 {
+		ta.head = head
+		ta.seriesLimit = uint64(conf.MaxActiveSeries)
+		ta.limited = a.limited
+	}
+
+	if conf.ReportOutOfOrderness {
+		tenant := a.outOfOrderness.tenantLabel(a.tenantID)
+		ta.maxt = maxt
+		ta.age = a.outOfOrderness.age.WithLabelValues(tenant)
+		ta.behind = a.outOfOrderness.behind.WithLabelValues(tenant)
+	}
+
+	if granularity := time.Duration(conf.TimestampRounding).Milliseconds(); granularity > 1 {
+		ta.granularity = granularity
+		ta.dropped = a.roundedSamplesDropped
+		ta.appended = map[storage.SeriesRef]int64{}
+	}
+	return ta, nil
+}
+
+// tenantAppender appends the samples of a tenant, applying the overrides resolved by tenantAppendable.Appender.
+// Samples are, in this order:
+//   - rounded to the timestamp rounding granularity, if set. Samples rounded to the timestamp of a previous sample
+//     of their series are dropped without error, as their series already has a sample at that time;
+//   - observed in the out-of-orderness histograms, if reported, whether they are appended or not, as rejected samples
+//     are out-of-order too;
+//   - rejected if they are of a new series and the head already has the active series limit of series. Existing
+//     series are checked before appending, so rejected series never get into the head. Concurrent appenders may
+//     still exceed the limit slightly, by the series they add at the same time;
+//   - rejected if they are older than minValidTime, derived from the sample reordering tolerance.
+//
+// Series which didn't exist in the head before a sample was appended to them are counted as created.
+type tenantAppender struct {
+	storage.Appender
+	tenant  *tenant
+	created prometheus.Counter
+
+	minValidTime int64
+	rejected     prometheus.Counter
+
+	// head is only set if the active series limit is.
+	head        *tsdb.Head
+	seriesLimit uint64
+	limited     prometheus.Counter
+
+	// maxt is the newest sample time of the tenant, starting from the max time of the head. age and behind are only
+	// set if the out-of-orderness is reported.
+	maxt   int64
+	age    prometheus.Observer
+	behind prometheus.Observer
+
+	// granularity is only set if timestamps are rounded.
+	granularity int64
+	dropped     prometheus.Counter
+	// appended is the last timestamp appended to every series, as the TSDB only detects duplicates of committed samples.
+	appended map[storage.SeriesRef]int64
+}
+
+func (a *tenantAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	// References are only missing for series not cached by the caller, which are mostly new ones.
+	if ref == 0 {
+		ref, _ = a.GetRef(l)
+	}
+	existing := ref != 0
+
+	rounded := t
+	if a.granularity > 0 {
+		rounded = roundTimestamp(t, a.granularity)
+		if last, ok := a.appended[ref]; ok && rounded == last && rounded != t {
+			a.dropped.Inc()
+			return ref, nil
+		}
+	}
+
+	if a.age != nil {
+		a.age.Observe(math.Max(0, float64(time.Now().UnixMilli()-rounded)/1000))
+		if rounded < a.maxt {
+			a.behind.Observe(float64(a.maxt-rounded) / 1000)
+		} else {
+			a.maxt = rounded
+		}
+	}
+
+	if a.head != nil && !existing && a.head.NumSeries() >= a.seriesLimit {
+		a.limited.Inc()
+		return 0, errActiveSeriesLimit
+	}
+
+	if rounded < a.minValidTime {
+		a.rejected.Inc()
+		return 0, errSampleBeyondReorderingTolerance
+	}
+
+	newRef, err := a.Appender.Append(ref, l, rounded, v)
+	if err == storage.ErrDuplicateSampleForTimestamp && rounded != t {
+		a.dropped.Inc()
+		return ref, nil
+	}
+	if err != nil {
+		return newRef, err
+	}
+	if a.appended != nil {
+		a.appended[newRef] = rounded
+	}
+	if !existing {
+		a.tenant.seriesCreated.Inc()
+		a.created.Inc()
+	}
+	return newRef, nil
+}
+
+// GetRef implements storage.GetRef, which the TSDB appender implements too.
+func (a *tenantAppender) GetRef(lset labels.Labels) (storage.SeriesRef, labels.Labels) {
+	return a.Appender.(storage.GetRef).GetRef(lset)
+}
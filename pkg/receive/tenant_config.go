@@ -0,0 +1,230 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+	"gopkg.in/yaml.v2"
+)
+
+// DisallowedMetricsAction is the action taken on series whose metric name is not allowed for a tenant.
+type DisallowedMetricsAction string
+
+const (
+	// DisallowedMetricsDrop drops the disallowed series and ingests the rest of the request.
+	DisallowedMetricsDrop DisallowedMetricsAction = "drop"
+	// DisallowedMetricsReject rejects the whole request if it contains any disallowed series.
+	DisallowedMetricsReject DisallowedMetricsAction = "reject"
+)
+
+// TenantsConfig is the root of the per-tenant configuration file. Settings of
+// every tenant entry are applied on top of the default ones, so a tenant only
+// needs to specify what it overrides.
+type TenantsConfig struct {
+	Default TenantConfig             `yaml:"default"`
+	Tenants map[string]yaml.MapSlice `yaml:"tenants"`
+
+	tenants map[string]*TenantConfig
+}
+
+// TenantConfig holds the configuration that can be overridden per tenant.
+type TenantConfig struct {
+	// MetricNameAllowlist is a list of regular expressions, anchored on both ends, which metric names
+	// written by the tenant have to match. Empty list allows all metrics.
+	MetricNameAllowlist []string `yaml:"metric_name_allowlist"`
+	// DisallowedMetricsAction is the action taken on series not matching MetricNameAllowlist.
+	DisallowedMetricsAction DisallowedMetricsAction `yaml:"disallowed_metrics_action"`
+	// MaxConcurrentRequests is the maximum number of remote write requests of the tenant
+	// handled concurrently. Requests above it are rejected. 0 means no limit.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+	// LocalRetention is the duration for which blocks of the tenant are kept on the local storage once they
+	// were shipped to the object storage. Blocks which were not shipped yet are never deleted because of it.
+	// 0 means that only the global TSDB retention applies.
+	LocalRetention model.Duration `yaml:"local_retention"`
+	// SampleReorderingTolerance is how far a sample may lag behind the newest sample written by the tenant.
+	// Older samples are rejected. 0 means that only the TSDB limit applies, which is half of the block duration.
+	SampleReorderingTolerance model.Duration `yaml:"sample_reordering_tolerance"`
+	// MaxActiveSeries is the maximum number of series in the head of the tenant. Samples of new series above it
+	// are rejected, while samples of existing series are still ingested. 0 means no limit.
+	MaxActiveSeries int `yaml:"max_active_series"`
+	// SeriesChurnThreshold is the number of new series per minute above which the tenant is flagged as having a high
+	// series churn. 0 disables the detection.
+	SeriesChurnThreshold int `yaml:"series_churn_threshold"`
+	// DiskPressureOptional marks the tenant as optional, so that its writes are rejected as soon as the local disk usage
+	// reaches the low watermark of the disk pressure monitor, before those of other tenants.
+	DiskPressureOptional bool `yaml:"disk_pressure_optional"`
+	// RelabelConfigs are applied to the series written by the tenant instead of the global relabel configs.
+	// Empty list falls back to the global relabel configs.
+	RelabelConfigs []*relabel.Config `yaml:"relabel_configs"`
+	// Trusted marks the tenant as sending series with sorted labels without empty or duplicated names, so that
+	// their labels are written as is instead of being normalized and validated, saving its cost.
+	Trusted bool `yaml:"trusted"`
+	// ReportOutOfOrderness enables the histograms of the age and the out-of-orderness of the samples written by
+	// the tenant, to help tuning its sample reordering tolerance.
+	ReportOutOfOrderness bool `yaml:"report_out_of_orderness"`
+	// TimestampRounding is the granularity the timestamps of the samples written by the tenant are rounded to, to the
+	// nearest multiple. Samples rounded to the timestamp of a previous sample of their series are dropped. 0 disables it.
+	TimestampRounding model.Duration `yaml:"timestamp_rounding"`
+	// DisableLocalCompaction keeps the blocks of the tenant from being compacted locally when local compaction is
+	// enabled, so that they are shipped as soon as they are cut. It applies once the TSDB of the tenant is opened.
+	DisableLocalCompaction bool `yaml:"disable_local_compaction"`
+
+	metricNameAllowlist []*regexp.Regexp
+}
+
+// compile validates the configuration and prepares it for use on the write path.
+func (c *TenantConfig) compile() error {
+	switch c.DisallowedMetricsAction {
+	case "":
+		c.DisallowedMetricsAction = DisallowedMetricsDrop
+	case DisallowedMetricsDrop, DisallowedMetricsReject:
+	default:
+		return errors.Errorf("unknown disallowed metrics action %q, must be one of %q or %q", c.DisallowedMetricsAction, DisallowedMetricsDrop, DisallowedMetricsReject)
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return errors.Errorf("max concurrent requests must be equal or greater than 0, got %d", c.MaxConcurrentRequests)
+	}
+	if c.MaxActiveSeries < 0 {
+		return errors.Errorf("max active series must be equal or greater than 0, got %d", c.MaxActiveSeries)
+	}
+	if c.SeriesChurnThreshold < 0 {
+		return errors.Errorf("series churn threshold must be equal or greater than 0, got %d", c.SeriesChurnThreshold)
+	}
+
+	c.metricNameAllowlist = make([]*regexp.Regexp, 0, len(c.MetricNameAllowlist))
+	for _, expr := range c.MetricNameAllowlist {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "compile metric name allowlist regex %q", expr)
+		}
+		c.metricNameAllowlist = append(c.metricNameAllowlist, re)
+	}
+	return nil
+}
+
+// IsMetricAllowed returns true if the given metric name can be written by the tenant.
+func (c *TenantConfig) IsMetricAllowed(name string) bool {
+	if len(c.metricNameAllowlist) == 0 {
+		return true
+	}
+	for _, re := range c.metricNameAllowlist {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTenantsConfig parses the per-tenant configuration file content.
+func ParseTenantsConfig(content []byte) (*TenantsConfig, error) {
+	conf := &TenantsConfig{}
+	if err := yaml.UnmarshalStrict(content, conf); err != nil {
+		return nil, errors.Wrap(err, "parse tenants config")
+	}
+
+	if err := conf.Default.compile(); err != nil {
+		return nil, errors.Wrap(err, "default tenant config")
+	}
+
+	conf.tenants = make(map[string]*TenantConfig, len(conf.Tenants))
+	for tenant, overrides := range conf.Tenants {
+		b, err := yaml.Marshal(overrides)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal config of tenant %s", tenant)
+		}
+
+		// Start from the defaults, so the tenant entry only overrides what it specifies.
+		tc := conf.Default
+		tc.MetricNameAllowlist = append([]string(nil), conf.Default.MetricNameAllowlist...)
+		if err := yaml.UnmarshalStrict(b, &tc); err != nil {
+			return nil, errors.Wrapf(err, "parse config of tenant %s", tenant)
+		}
+		if err := tc.compile(); err != nil {
+			return nil, errors.Wrapf(err, "config of tenant %s", tenant)
+		}
+		conf.tenants[tenant] = &tc
+	}
+	return conf, nil
+}
+
+// TenantOverrides holds the current per-tenant configuration and allows reloading it at runtime.
+type TenantOverrides struct {
+	mtx  sync.RWMutex
+	conf *TenantsConfig
+	hash float64
+
+	successGauge         prometheus.Gauge
+	lastSuccessTimeGauge prometheus.Gauge
+	hashGauge            prometheus.Gauge
+}
+
+// NewTenantOverrides creates new TenantOverrides, with all tenants using the default configuration.
+func NewTenantOverrides(reg prometheus.Registerer) *TenantOverrides {
+	o := &TenantOverrides{
+		conf: &TenantsConfig{tenants: map[string]*TenantConfig{}},
+		successGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenants_config_last_reload_successful",
+			Help: "Whether the last tenants configuration reload attempt was successful.",
+		}),
+		lastSuccessTimeGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenants_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful tenants configuration reload.",
+		}),
+		hashGauge: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_receive_tenants_config_hash",
+			Help: "Hash of the currently loaded tenants configuration.",
+		}),
+	}
+	// Defaults are always valid.
+	_ = o.conf.Default.compile()
+	return o
+}
+
+// Load parses the given configuration content and, if valid, replaces the current one.
+// It's a no-op if the content didn't change since the last successful load.
+func (o *TenantOverrides) Load(content []byte) error {
+	hash := hashAsMetricValue(content)
+
+	o.mtx.RLock()
+	unchanged := o.hash == hash && hash != 0
+	o.mtx.RUnlock()
+	if unchanged {
+		o.successGauge.Set(1)
+		return nil
+	}
+
+	conf, err := ParseTenantsConfig(content)
+	if err != nil {
+		o.successGauge.Set(0)
+		return err
+	}
+
+	o.mtx.Lock()
+	o.conf = conf
+	o.hash = hash
+	o.mtx.Unlock()
+
+	o.successGauge.Set(1)
+	o.lastSuccessTimeGauge.SetToCurrentTime()
+	o.hashGauge.Set(hash)
+	return nil
+}
+
+// ForTenant returns the configuration of the given tenant.
+func (o *TenantOverrides) ForTenant(tenant string) *TenantConfig {
+	o.mtx.RLock()
+	defer o.mtx.RUnlock()
+
+	if tc, ok := o.conf.tenants[tenant]; ok {
+		return tc
+	}
+	return &o.conf.Default
+}
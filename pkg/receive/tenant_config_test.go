@@ -0,0 +1,122 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseTenantsConfig(t *testing.T) {
+	for _, tcase := range []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "valid",
+			content: `
+default:
+  metric_name_allowlist: ["up"]
+tenants:
+  foo:
+    disallowed_metrics_action: reject
+`,
+		},
+		{
+			name: "invalid regex",
+			content: `
+tenants:
+  foo:
+    metric_name_allowlist: ["(up"]
+`,
+			err: true,
+		},
+		{
+			name: "unknown action",
+			content: `
+default:
+  disallowed_metrics_action: ignore
+`,
+			err: true,
+		},
+		{
+			name: "negative max active series",
+			content: `
+tenants:
+  foo:
+    max_active_series: -1
+`,
+			err: true,
+		},
+		{
+			name: "negative series churn threshold",
+			content: `
+default:
+  series_churn_threshold: -1
+`,
+			err: true,
+		},
+		{
+			name: "unknown field",
+			content: `
+tenants:
+  foo:
+    unknown: true
+`,
+			err: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := ParseTenantsConfig([]byte(tcase.content))
+			if tcase.err {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+		})
+	}
+}
+
+func TestTenantOverrides(t *testing.T) {
+	o := NewTenantOverrides(nil)
+
+	// Without configuration all metrics are allowed.
+	testutil.Assert(t, o.ForTenant("foo").IsMetricAllowed("anything"))
+
+	testutil.Ok(t, o.Load([]byte(`
+default:
+  metric_name_allowlist: ["up"]
+tenants:
+  foo:
+    disallowed_metrics_action: reject
+`)))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(o.successGauge))
+
+	// Tenants inherit defaults they don't override.
+	foo := o.ForTenant("foo")
+	testutil.Equals(t, DisallowedMetricsReject, foo.DisallowedMetricsAction)
+	testutil.Assert(t, foo.IsMetricAllowed("up"))
+	testutil.Assert(t, !foo.IsMetricAllowed("up_total"))
+
+	bar := o.ForTenant("bar")
+	testutil.Equals(t, DisallowedMetricsDrop, bar.DisallowedMetricsAction)
+	testutil.Assert(t, !bar.IsMetricAllowed("down"))
+
+	// Invalid configuration keeps the previous one.
+	testutil.NotOk(t, o.Load([]byte(`default: {metric_name_allowlist: ["(up"]}`)))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(o.successGauge))
+	testutil.Assert(t, o.ForTenant("foo").IsMetricAllowed("up"))
+
+	// Reloaded configuration is applied.
+	testutil.Ok(t, o.Load([]byte(`default: {metric_name_allowlist: ["down"]}`)))
+	testutil.Assert(t, !o.ForTenant("foo").IsMetricAllowed("up"))
+	testutil.Assert(t, o.ForTenant("foo").IsMetricAllowed("down"))
+}
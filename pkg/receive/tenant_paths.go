@@ -0,0 +1,66 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"path"
+	"strings"
+
+	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
+)
+
+// TenantPaths places the TSDB directories of tenants across multiple base paths, e.g. to spread their I/O
+// over several disks. Tenants are placed on the base path they are mapped to, or spread by the hash of
+// their ID otherwise.
+type TenantPaths struct {
+	paths   []string
+	tenants map[string]string
+}
+
+// NewTenantPaths returns TenantPaths spreading tenants over the given base paths. Tenants in the mapping
+// are placed on their mapped base path, which has to be one of the given ones.
+func NewTenantPaths(paths []string, tenants map[string]string) (*TenantPaths, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one base path is required")
+	}
+	known := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		p = path.Clean(p)
+		if _, ok := known[p]; ok {
+			return nil, errors.Errorf("duplicated base path %q", p)
+		}
+		known[p] = struct{}{}
+	}
+	for tenantID, p := range tenants {
+		if _, ok := known[path.Clean(p)]; !ok {
+			return nil, errors.Errorf("path %q of tenant %q is not one of the base paths", p, tenantID)
+		}
+	}
+	return &TenantPaths{paths: paths, tenants: tenants}, nil
+}
+
+// ParseTenantPathMapping parses tenant to base path mappings in the `<tenant>=<path>` form.
+func ParseTenantPathMapping(flags []string) (map[string]string, error) {
+	res := make(map[string]string, len(flags))
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid tenant path %q, expected <tenant>=<path>", f)
+		}
+		if _, ok := res[parts[0]]; ok {
+			return nil, errors.Errorf("tenant %q mapped to more than one path", parts[0])
+		}
+		res[parts[0]] = parts[1]
+	}
+	return res, nil
+}
+
+// basePath returns the base path a new TSDB directory of the given tenant is placed on.
+func (p *TenantPaths) basePath(tenantID string) string {
+	if bp, ok := p.tenants[tenantID]; ok {
+		return bp
+	}
+	return p.paths[xxhash.Sum64String(tenantID)%uint64(len(p.paths))]
+}
@@ -0,0 +1,127 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/route"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errTenantPaused is returned for writes of tenants whose ingestion was paused through the admin API.
+var errTenantPaused = errors.New("ingestion paused for tenant")
+
+// pausedTenants holds the tenants whose ingestion is paused. It is kept in memory only, so a restart resumes all tenants.
+type pausedTenants struct {
+	mtx     sync.RWMutex
+	tenants map[string]struct{}
+
+	pausedGauge prometheus.GaugeFunc
+	rejected    *prometheus.CounterVec
+}
+
+func newPausedTenants(reg prometheus.Registerer) *pausedTenants {
+	p := &pausedTenants{
+		tenants: map[string]struct{}{},
+		rejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_paused_rejected_requests_total",
+			Help: "The number of remote write requests rejected because the ingestion of their tenant is paused.",
+		}, []string{"tenant"}),
+	}
+	p.pausedGauge = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_receive_paused_tenants",
+		Help: "The number of tenants whose ingestion is paused.",
+	}, func() float64 {
+		p.mtx.RLock()
+		defer p.mtx.RUnlock()
+		return float64(len(p.tenants))
+	})
+	return p
+}
+
+func (p *pausedTenants) pause(tenant string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.tenants[tenant] = struct{}{}
+}
+
+func (p *pausedTenants) resume(tenant string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.tenants, tenant)
+}
+
+// admit returns errTenantPaused if the ingestion of the tenant is paused.
+func (p *pausedTenants) admit(tenant string) error {
+	p.mtx.RLock()
+	_, ok := p.tenants[tenant]
+	p.mtx.RUnlock()
+
+	if ok {
+		p.rejected.WithLabelValues(tenant).Inc()
+		return errTenantPaused
+	}
+	return nil
+}
+
+// isTenantPaused returns whether or not the given error was caused by the tenant being paused, locally or on the
+// receiver the request was forwarded to.
+func isTenantPaused(err error) bool {
+	return err == errTenantPaused ||
+		(status.Code(err) == codes.ResourceExhausted && status.Convert(err).Message() == errTenantPaused.Error())
+}
+
+func (p *pausedTenants) list() []string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	tenants := make([]string, 0, len(p.tenants))
+	for t := range p.tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// registerAdminAPI registers the endpoints pausing and resuming the ingestion of tenants. Writes of paused tenants
+// are rejected with 429 Too Many Requests, or ResourceExhausted when replicated through gRPC, while their TSDB is kept
+// open, so their data stays queryable. Tenants are paused on this receiver only.
+func (h *Handler) registerAdminAPI(instrf func(name string, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc) {
+	h.router.Post("/api/v1/admin/tenants/:tenant/pause", instrf("admin_pause_tenant", h.pauseTenant))
+	h.router.Post("/api/v1/admin/tenants/:tenant/resume", instrf("admin_resume_tenant", h.resumeTenant))
+	h.router.Get("/api/v1/admin/tenants/paused", instrf("admin_paused_tenants", h.listPausedTenants))
+}
+
+func (h *Handler) pauseTenant(w http.ResponseWriter, r *http.Request) {
+	tenant := route.Param(r.Context(), "tenant")
+	h.pausedTenants.pause(tenant)
+	level.Info(h.logger).Log("msg", "ingestion paused", "tenant", tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) resumeTenant(w http.ResponseWriter, r *http.Request) {
+	tenant := route.Param(r.Context(), "tenant")
+	h.pausedTenants.resume(tenant)
+	level.Info(h.logger).Log("msg", "ingestion resumed", "tenant", tenant)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listPausedTenants(w http.ResponseWriter, _ *http.Request) {
+	b, err := json.Marshal(h.pausedTenants.list())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,16 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+// roundTimestamp rounds the timestamp to the nearest multiple of the granularity, halves being rounded up.
+func roundTimestamp(t, granularity int64) int64 {
+	r := t % granularity
+	if r < 0 {
+		r += granularity
+	}
+	if 2*r >= granularity {
+		return t - r + granularity
+	}
+	return t - r
+}
@@ -0,0 +1,67 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Reasons of series not being written as they were sent.
+const (
+	// RejectionDisallowedMetric is the reason of series whose metric name is not allowed for the tenant.
+	RejectionDisallowedMetric = "disallowed_metric"
+	// RejectionTooManyLabels is the reason of series exceeding the labels per series limit.
+	RejectionTooManyLabels = "too_many_labels"
+)
+
+// WriteDetails details the outcome of a remote write request. It's the response body of remote write requests
+// if partial success details are enabled, so that clients can tell which parts of a request need a retry.
+type WriteDetails struct {
+	// AcceptedSeries is the number of series of the request passed on to be written.
+	AcceptedSeries int `json:"acceptedSeries"`
+	// Rejected holds the number of series which were not written as they were sent, by reason.
+	Rejected []SeriesRejection `json:"rejected,omitempty"`
+	// Error is the error the request failed with, if any. Series accepted before the error might not be
+	// written entirely, e.g. some of their samples can be out of order.
+	Error string `json:"error,omitempty"`
+
+	// written are the counts of the request which were written, for the response headers of remote write 2.0 requests.
+	written writeCounts
+}
+
+// SeriesRejection is the number of series which were not written as they were sent for the same reason.
+type SeriesRejection struct {
+	Reason string `json:"reason"`
+	// Action is the action taken on the series, e.g. "drop" if they were dropped, or "reject" if they made the whole request fail.
+	Action string `json:"action"`
+	Series int    `json:"series"`
+}
+
+func (d *WriteDetails) reject(reason, action string, series int) {
+	d.Rejected = append(d.Rejected, SeriesRejection{Reason: reason, Action: action, Series: series})
+}
+
+// writeResponse responds to a remote write request which went through the series limits. With partial success details
+// enabled, the body is the JSON encoded details, with the same status code as otherwise.
+func (h *Handler) writeResponse(w http.ResponseWriter, details *WriteDetails, err error, code int) {
+	if !h.options.PartialSuccessDetails {
+		if err != nil {
+			http.Error(w, err.Error(), code)
+		}
+		return
+	}
+
+	if err != nil {
+		details.Error = err.Error()
+	}
+	b, jerr := json.Marshal(details)
+	if jerr != nil {
+		http.Error(w, jerr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
@@ -5,6 +5,7 @@ package receive
 
 import (
 	"context"
+	"sort"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -27,16 +28,40 @@ type TenantStorage interface {
 	TenantAppendable(string) (Appendable, error)
 }
 
+// errInvalidLabels is returned for series whose labels have empty or duplicated names.
+var errInvalidLabels = errors.New("series with empty or duplicated label names")
+
 type Writer struct {
-	logger    log.Logger
-	multiTSDB TenantStorage
+	logger          log.Logger
+	multiTSDB       TenantStorage
+	tenantOverrides *TenantOverrides
 }
 
-func NewWriter(logger log.Logger, multiTSDB TenantStorage) *Writer {
+// NewWriter returns a Writer writing to the tenants of the given storage. If tenantOverrides is not nil,
+// series of trusted tenants are written without normalizing their labels.
+func NewWriter(logger log.Logger, multiTSDB TenantStorage, tenantOverrides *TenantOverrides) *Writer {
 	return &Writer{
-		logger:    logger,
-		multiTSDB: multiTSDB,
+		logger:          logger,
+		multiTSDB:       multiTSDB,
+		tenantOverrides: tenantOverrides,
+	}
+}
+
+// normalizeLabels sorts the labels of a series by name, as the TSDB expects them, and checks
+// that none of their names are empty or duplicated.
+func normalizeLabels(lset []labelpb.ZLabel) error {
+	for i := 1; i < len(lset); i++ {
+		if lset[i].Name < lset[i-1].Name {
+			sort.Slice(lset, func(i, j int) bool { return lset[i].Name < lset[j].Name })
+			break
+		}
+	}
+	for i, l := range lset {
+		if l.Name == "" || (i > 0 && l.Name == lset[i-1].Name) {
+			return errInvalidLabels
+		}
 	}
+	return nil
 }
 
 func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteRequest) error {
@@ -46,6 +71,9 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		numOutOfOrder           = 0
 		numDuplicates           = 0
 		numOutOfBounds          = 0
+		numBeyondTolerance      = 0
+		numSeriesLimited        = 0
+		numInvalidLabels        = 0
 		numExemplarsOutOfOrder  = 0
 		numExemplarsDuplicate   = 0
 		numExemplarsLabelLength = 0
@@ -65,11 +93,21 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 	}
 	getRef := app.(storage.GetRef)
 
+	// Trusted tenants send sorted and valid labels, so the cost of normalizing them is saved.
+	trusted := r.tenantOverrides != nil && r.tenantOverrides.ForTenant(tenantID).Trusted
+
 	var (
 		ref  storage.SeriesRef
 		errs errutil.MultiError
 	)
 	for _, t := range wreq.Timeseries {
+		if !trusted {
+			if err := normalizeLabels(t.Labels); err != nil {
+				numInvalidLabels++
+				level.Debug(tLogger).Log("msg", "Invalid labels", "lset", labelpb.ZLabelsToPromLabels(t.Labels))
+				continue
+			}
+		}
 		lset := labelpb.ZLabelsToPromLabels(t.Labels)
 
 		// Check if the TSDB has cached reference for those labels.
@@ -82,6 +120,7 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		}
 
 		// Append as many valid samples as possible, but keep track of the errors.
+	samples:
 		for _, s := range t.Samples {
 			ref, err = app.Append(ref, lset, s.Timestamp, s.Value)
 			switch err {
@@ -94,6 +133,14 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 			case storage.ErrOutOfBounds:
 				numOutOfBounds++
 				level.Debug(tLogger).Log("msg", "Out of bounds metric", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
+			case errSampleBeyondReorderingTolerance:
+				numBeyondTolerance++
+				level.Debug(tLogger).Log("msg", "Sample beyond reordering tolerance", "lset", lset, "value", s.Value, "timestamp", s.Timestamp)
+			case errActiveSeriesLimit:
+				// None of the samples of the series can be appended.
+				numSeriesLimited++
+				level.Debug(tLogger).Log("msg", "Active series limit reached", "lset", lset)
+				break samples
 			}
 		}
 
@@ -141,6 +188,18 @@ func (r *Writer) Write(ctx context.Context, tenantID string, wreq *prompb.WriteR
 		level.Warn(tLogger).Log("msg", "Error on ingesting samples that are too old or are too far into the future", "numDropped", numOutOfBounds)
 		errs.Add(errors.Wrapf(storage.ErrOutOfBounds, "add %d samples", numOutOfBounds))
 	}
+	if numBeyondTolerance > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting samples older than the sample reordering tolerance", "numDropped", numBeyondTolerance)
+		errs.Add(errors.Wrapf(errSampleBeyondReorderingTolerance, "add %d samples", numBeyondTolerance))
+	}
+	if numSeriesLimited > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting new series above the active series limit", "numDropped", numSeriesLimited)
+		errs.Add(errors.Wrapf(errActiveSeriesLimit, "drop %d series of tenant %s", numSeriesLimited, tenantID))
+	}
+	if numInvalidLabels > 0 {
+		level.Warn(tLogger).Log("msg", "Error on ingesting series with empty or duplicated label names", "numDropped", numInvalidLabels)
+		errs.Add(errors.Wrapf(errInvalidLabels, "drop %d series", numInvalidLabels))
+	}
 	if numExemplarsOutOfOrder > 0 {
 		level.Warn(tLogger).Log("msg", "Error on ingesting out-of-order exemplars", "numDropped", numExemplarsOutOfOrder)
 		errs.Add(errors.Wrapf(storage.ErrOutOfOrderExemplar, "add %d exemplars", numExemplarsOutOfOrder))
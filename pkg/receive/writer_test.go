@@ -5,6 +5,7 @@ package receive
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -14,6 +15,8 @@ import (
 	"github.com/go-kit/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/exemplar"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -117,6 +120,38 @@ func TestWriter(t *testing.T) {
 			expectedErr:  errors.Wrapf(storage.ErrExemplarLabelLength, "add 1 exemplars"),
 			maxExemplars: 2,
 		},
+		"should succeed on series with unsorted labels": {
+			reqs: []*prompb.WriteRequest{{
+				Timeseries: []prompb.TimeSeries{{
+					Labels:  []labelpb.ZLabel{{Name: "job", Value: "test"}, {Name: "__name__", Value: "test"}},
+					Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+				}},
+			}},
+		},
+		"should error out on series with duplicated label names": {
+			reqs: []*prompb.WriteRequest{{
+				Timeseries: []prompb.TimeSeries{
+					{
+						Labels:  []labelpb.ZLabel{{Name: "__name__", Value: "test"}, {Name: "job", Value: "a"}, {Name: "job", Value: "b"}},
+						Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+					},
+					{
+						Labels:  lbls,
+						Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+					},
+				},
+			}},
+			expectedErr: errors.Wrapf(errInvalidLabels, "drop 1 series"),
+		},
+		"should error out on series with empty label names": {
+			reqs: []*prompb.WriteRequest{{
+				Timeseries: []prompb.TimeSeries{{
+					Labels:  []labelpb.ZLabel{{Name: "", Value: "test"}, {Name: "__name__", Value: "test"}},
+					Samples: []prompb.Sample{{Value: 1, Timestamp: 10}},
+				}},
+			}},
+			expectedErr: errors.Wrapf(errInvalidLabels, "drop 1 series"),
+		},
 	}
 
 	for testName, testData := range tests {
@@ -157,7 +192,7 @@ func TestWriter(t *testing.T) {
 				return err
 			}))
 
-			w := NewWriter(logger, m)
+			w := NewWriter(logger, m, nil)
 
 			for idx, req := range testData.reqs {
 				err = w.Write(context.Background(), DefaultTenant, req)
@@ -174,3 +209,533 @@ func TestWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestWriterSampleReorderingTolerance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  strict:
+    sample_reordering_tolerance: 1m
+`)))
+
+	logger := log.NewNopLogger()
+	m := NewMultiTSDB(dir, logger, prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	now := time.Now()
+	sample := func(name string, ts time.Time) *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: name}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+		}}}
+	}
+
+	w := NewWriter(logger, m, nil)
+	for _, tenant := range []string{"strict", "default"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+
+		testutil.Ok(t, w.Write(context.Background(), tenant, sample("newest", now)))
+		// A sample lagging behind the newest one within the tolerance is accepted.
+		testutil.Ok(t, w.Write(context.Background(), tenant, sample("lagging", now.Add(-30*time.Second))))
+	}
+
+	// A sample lagging behind by more than the tolerance is rejected.
+	err = w.Write(context.Background(), "strict", sample("late", now.Add(-5*time.Minute)))
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "add 1 samples: sample older than the sample reordering tolerance of the tenant", err.Error())
+	testutil.Equals(t, errConflict, determineWriteErrorCause(err, 1))
+	testutil.Equals(t, float64(1), promtestutil.ToFloat64(m.samplesBeyondReorderingTolerance.WithLabelValues("strict")))
+
+	// Tenants without a tolerance accept it, as it's within the TSDB limit.
+	testutil.Ok(t, w.Write(context.Background(), "default", sample("late", now.Add(-5*time.Minute))))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(m.samplesBeyondReorderingTolerance.WithLabelValues("default")))
+}
+
+func TestWriterOutOfOrderness(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+default:
+  report_out_of_orderness: true
+tenants:
+  unreported:
+    report_out_of_orderness: false
+`)))
+
+	logger := log.NewNopLogger()
+	m := NewMultiTSDB(dir, logger, prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+		WithOutOfOrdernessMaxTenants(2),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	now := time.Now()
+	sample := func(name string, ts time.Time) *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: name}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts.UnixMilli()}},
+		}}}
+	}
+	histogram := func(vec *prometheus.HistogramVec, tenant string) *dto.Histogram {
+		m := &dto.Metric{}
+		testutil.Ok(t, vec.WithLabelValues(tenant).(prometheus.Metric).Write(m))
+		return m.GetHistogram()
+	}
+
+	w := NewWriter(logger, m, nil)
+	for _, tenant := range []string{"a", "b", "c", "unreported"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+
+		testutil.Ok(t, w.Write(context.Background(), tenant, sample("newest", now)))
+		// A sample of another series lagging behind the newest sample of the tenant.
+		testutil.Ok(t, w.Write(context.Background(), tenant, sample("lagging", now.Add(-30*time.Second))))
+	}
+
+	// Only the first two tenants have histograms of their own, and unreported tenants have none.
+	testutil.Equals(t, 3, promtestutil.CollectAndCount(m.outOfOrderness.behind))
+	for _, tenant := range []string{"a", "b", otherTenantsLabel} {
+		age := histogram(m.outOfOrderness.age, tenant)
+		testutil.Equals(t, uint64(2), age.GetSampleCount())
+		testutil.Assert(t, age.GetSampleSum() >= 30, "unexpected sample age sum %v of tenant %s", age.GetSampleSum(), tenant)
+
+		behind := histogram(m.outOfOrderness.behind, tenant)
+		testutil.Equals(t, uint64(1), behind.GetSampleCount())
+		testutil.Equals(t, float64(30), behind.GetSampleSum())
+	}
+}
+
+func TestWriterActiveSeriesLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  limited:
+    max_active_series: 2
+`)))
+
+	logger := log.NewNopLogger()
+	m := NewMultiTSDB(dir, logger, prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	now := time.Now()
+	series := func(ts time.Time, names ...string) *prompb.WriteRequest {
+		wreq := &prompb.WriteRequest{}
+		for _, name := range names {
+			wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+				Labels: []labelpb.ZLabel{{Name: labels.MetricName, Value: name}},
+				Samples: []prompb.Sample{
+					{Value: 1, Timestamp: ts.UnixMilli()},
+					{Value: 2, Timestamp: ts.Add(time.Second).UnixMilli()},
+				},
+			})
+		}
+		return wreq
+	}
+
+	w := NewWriter(logger, m, nil)
+	for _, tenant := range []string{"limited", "default"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+	}
+
+	// Series within the limit are ingested, even if the same request has series above it.
+	err = w.Write(context.Background(), "limited", series(now, "a", "b", "c", "d"))
+	testutil.NotOk(t, err)
+	testutil.Equals(t, "drop 2 series of tenant limited: active series limit of the tenant reached", err.Error())
+	testutil.Equals(t, errActiveSeriesLimit, errors.Cause(determineWriteErrorCause(err, 1)))
+	testutil.Equals(t, err.Error(), determineWriteErrorCause(err, 1).Error())
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(m.seriesLimited.WithLabelValues("limited")))
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(m.activeSeriesLimit.WithLabelValues("limited")))
+
+	// Samples of existing series are still ingested once the limit is reached.
+	testutil.Ok(t, w.Write(context.Background(), "limited", series(now.Add(time.Minute), "a", "b")))
+	testutil.NotOk(t, w.Write(context.Background(), "limited", series(now.Add(time.Minute), "e")))
+	testutil.Equals(t, float64(3), promtestutil.ToFloat64(m.seriesLimited.WithLabelValues("limited")))
+
+	testutil.Equals(t, uint64(2), m.tenants["limited"].readyStorage().Get().Head().NumSeries())
+
+	// Tenants without a limit are not limited.
+	testutil.Ok(t, w.Write(context.Background(), "default", series(now, "a", "b", "c", "d")))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(m.seriesLimited.WithLabelValues("default")))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(m.activeSeriesLimit.WithLabelValues("default")))
+}
+
+func TestWriterSeriesChurn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  churning:
+    series_churn_threshold: 2
+`)))
+
+	logger := log.NewNopLogger()
+	m := NewMultiTSDB(dir, logger, prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	now := time.Now()
+	series := func(names ...string) *prompb.WriteRequest {
+		wreq := &prompb.WriteRequest{}
+		for _, name := range names {
+			wreq.Timeseries = append(wreq.Timeseries, prompb.TimeSeries{
+				Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: name}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixMilli()}},
+			})
+		}
+		now = now.Add(time.Second)
+		return wreq
+	}
+
+	w := NewWriter(logger, m, nil)
+	for _, tenant := range []string{"churning", "default"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+	}
+	created := func(tenant string) float64 {
+		return promtestutil.ToFloat64(m.seriesCreated.WithLabelValues(tenant))
+	}
+	highChurn := func(tenant string) float64 {
+		return promtestutil.ToFloat64(m.highSeriesChurn.WithLabelValues(tenant))
+	}
+
+	checked := time.Now()
+	m.CheckSeriesChurn(checked)
+
+	// Only new series are counted.
+	testutil.Ok(t, w.Write(context.Background(), "churning", series("a", "b")))
+	testutil.Equals(t, float64(2), created("churning"))
+	testutil.Ok(t, w.Write(context.Background(), "churning", series("a", "b", "c")))
+	testutil.Equals(t, float64(3), created("churning"))
+	testutil.Ok(t, w.Write(context.Background(), "default", series("a", "b", "c")))
+	testutil.Equals(t, float64(3), created("default"))
+
+	// 3 series per minute are above the threshold of the churning tenant, while the default tenant has no threshold.
+	checked = checked.Add(time.Minute)
+	m.CheckSeriesChurn(checked)
+	testutil.Equals(t, float64(1), highChurn("churning"))
+	testutil.Equals(t, float64(0), highChurn("default"))
+
+	testutil.Ok(t, w.Write(context.Background(), "churning", series("a", "b", "c", "d")))
+	testutil.Equals(t, float64(4), created("churning"))
+	checked = checked.Add(time.Minute)
+	m.CheckSeriesChurn(checked)
+	testutil.Equals(t, float64(0), highChurn("churning"))
+}
+
+func newTrustedTenantMultiTSDB(t testing.TB, dir string) *MultiTSDB {
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  trusted:
+    trusted: true
+`)))
+
+	m := NewMultiTSDB(dir, log.NewNopLogger(), prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	testutil.Ok(t, m.Open())
+	for _, tenant := range []string{"trusted", "default"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+	}
+	return m
+}
+
+func TestWriterTrustedTenant(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	m := newTrustedTenantMultiTSDB(t, dir)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	w := NewWriter(log.NewNopLogger(), m, m.tenantOverrides)
+
+	now := time.Now()
+	wreq := func() *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "a"}, {Name: "job", Value: "test"}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixMilli()}, {Value: 2, Timestamp: now.Add(time.Second).UnixMilli()}},
+			},
+			{
+				Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "b"}, {Name: "job", Value: "test"}},
+				Samples: []prompb.Sample{{Value: 3, Timestamp: now.UnixMilli()}},
+			},
+		}}
+	}
+	for _, tenant := range []string{"trusted", "default"} {
+		testutil.Ok(t, w.Write(context.Background(), tenant, wreq()))
+	}
+
+	// Series of the trusted tenant are ingested the same way as the ones of others.
+	read := func(tenant string) map[string][]float64 {
+		q, err := m.tenants[tenant].readyStorage().Get().Querier(context.Background(), 0, now.Add(time.Minute).UnixMilli())
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+
+		res := map[string][]float64{}
+		ss := q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, "job", "test"))
+		for ss.Next() {
+			it := ss.At().Iterator()
+			for it.Next() {
+				_, v := it.At()
+				res[ss.At().Labels().String()] = append(res[ss.At().Labels().String()], v)
+			}
+		}
+		testutil.Ok(t, ss.Err())
+		return res
+	}
+	expected := map[string][]float64{
+		`{__name__="a", job="test"}`: {1, 2},
+		`{__name__="b", job="test"}`: {3},
+	}
+	testutil.Equals(t, expected, read("trusted"))
+	testutil.Equals(t, expected, read("default"))
+
+	// Labels of trusted tenants are written as is.
+	unsorted := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []labelpb.ZLabel{{Name: "job", Value: "test"}, {Name: labels.MetricName, Value: "c"}},
+		Samples: []prompb.Sample{{Value: 4, Timestamp: now.UnixMilli()}},
+	}}}
+	testutil.Ok(t, w.Write(context.Background(), "trusted", unsorted))
+	testutil.Equals(t, "job", unsorted.Timeseries[0].Labels[0].Name)
+	testutil.Ok(t, w.Write(context.Background(), "default", unsorted))
+	testutil.Equals(t, labels.MetricName, unsorted.Timeseries[0].Labels[0].Name)
+}
+
+func TestWriterTimestampRounding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	overrides := NewTenantOverrides(nil)
+	testutil.Ok(t, overrides.Load([]byte(`
+tenants:
+  rounded:
+    timestamp_rounding: 1s
+`)))
+
+	logger := log.NewNopLogger()
+	m := NewMultiTSDB(dir, logger, prometheus.NewRegistry(), &tsdb.Options{
+		MinBlockDuration:  (2 * time.Hour).Milliseconds(),
+		MaxBlockDuration:  (2 * time.Hour).Milliseconds(),
+		RetentionDuration: (6 * time.Hour).Milliseconds(),
+		NoLockfile:        true,
+	},
+		labels.FromStrings("replica", "01"),
+		"tenant_id",
+		nil,
+		false,
+		metadata.NoneFunc,
+		WithTenantOverrides(overrides),
+	)
+	defer func() { testutil.Ok(t, m.Close()) }()
+	testutil.Ok(t, m.Open())
+
+	base := time.Now().Truncate(time.Second).UnixMilli()
+	wreq := func(samples ...prompb.Sample) *prompb.WriteRequest {
+		return &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+			Labels:  []labelpb.ZLabel{{Name: labels.MetricName, Value: "a"}},
+			Samples: samples,
+		}}}
+	}
+	read := func(tenant string) []prompb.Sample {
+		q, err := m.tenants[tenant].readyStorage().Get().Querier(context.Background(), 0, base+time.Minute.Milliseconds())
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+
+		var res []prompb.Sample
+		ss := q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "a"))
+		for ss.Next() {
+			it := ss.At().Iterator()
+			for it.Next() {
+				t, v := it.At()
+				res = append(res, prompb.Sample{Timestamp: t, Value: v})
+			}
+		}
+		testutil.Ok(t, ss.Err())
+		return res
+	}
+
+	w := NewWriter(logger, m, nil)
+	for _, tenant := range []string{"rounded", "default"} {
+		app, err := m.TenantAppendable(tenant)
+		testutil.Ok(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		testutil.Ok(t, runutil.Retry(1*time.Second, ctx.Done(), func() error {
+			_, err = app.Appender(context.Background())
+			return err
+		}))
+		cancel()
+
+		testutil.Ok(t, w.Write(context.Background(), tenant, wreq(
+			prompb.Sample{Value: 1, Timestamp: base + 3},
+			prompb.Sample{Value: 2, Timestamp: base + 1600},
+			// Rounded to the timestamp of the previous sample of the same request.
+			prompb.Sample{Value: 3, Timestamp: base + 2100},
+			prompb.Sample{Value: 4, Timestamp: base + 3499},
+		)))
+	}
+	// Rounded to the timestamp of a sample already committed.
+	testutil.Ok(t, w.Write(context.Background(), "rounded", wreq(prompb.Sample{Value: 5, Timestamp: base + 3200})))
+
+	testutil.Equals(t, []prompb.Sample{
+		{Timestamp: base, Value: 1},
+		{Timestamp: base + 2000, Value: 2},
+		{Timestamp: base + 3000, Value: 4},
+	}, read("rounded"))
+	testutil.Equals(t, float64(2), promtestutil.ToFloat64(m.roundedSamplesDropped.WithLabelValues("rounded")))
+
+	// Timestamps of other tenants are left as is.
+	testutil.Equals(t, []prompb.Sample{
+		{Timestamp: base + 3, Value: 1},
+		{Timestamp: base + 1600, Value: 2},
+		{Timestamp: base + 2100, Value: 3},
+		{Timestamp: base + 3499, Value: 4},
+	}, read("default"))
+	testutil.Equals(t, float64(0), promtestutil.ToFloat64(m.roundedSamplesDropped.WithLabelValues("default")))
+}
+
+func BenchmarkWriterTrustedTenant(b *testing.B) {
+	dir, err := ioutil.TempDir("", "test")
+	testutil.Ok(b, err)
+	defer func() { testutil.Ok(b, os.RemoveAll(dir)) }()
+
+	m := newTrustedTenantMultiTSDB(b, dir)
+	defer func() { testutil.Ok(b, m.Close()) }()
+	w := NewWriter(log.NewNopLogger(), m, m.tenantOverrides)
+
+	const numSeries = 1000
+	now := time.Now()
+	for _, tenant := range []string{"default", "trusted"} {
+		b.Run(tenant, func(b *testing.B) {
+			wreq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, numSeries)}
+			for i := range wreq.Timeseries {
+				wreq.Timeseries[i] = prompb.TimeSeries{
+					Labels: []labelpb.ZLabel{
+						{Name: labels.MetricName, Value: "metric"},
+						{Name: "instance", Value: fmt.Sprintf("instance-%d", i)},
+						{Name: "job", Value: "benchmark"},
+						{Name: "namespace", Value: "default"},
+						{Name: "pod", Value: fmt.Sprintf("pod-%d", i)},
+					},
+					Samples: []prompb.Sample{{Value: 1}},
+				}
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := range wreq.Timeseries {
+					wreq.Timeseries[i].Samples[0].Timestamp = now.Add(time.Duration(n) * time.Millisecond).UnixMilli()
+				}
+				testutil.Ok(b, w.Write(context.Background(), tenant, wreq))
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package receive
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/klauspost/compress/s2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/prompb"
+	"github.com/thanos-io/thanos/pkg/store/storepb/writev2pb"
+)
+
+const (
+	// Versions of the Prometheus remote write protocol.
+	remoteWriteV1 = "1.0"
+	remoteWriteV2 = "2.0"
+
+	remoteWriteVersionHeader = "X-Prometheus-Remote-Write-Version"
+	// Names of the protobuf messages of the remote write versions, as the proto parameter of the Content-Type header.
+	remoteWriteV1Message = "prometheus.WriteRequest"
+	remoteWriteV2Message = "io.prometheus.write.v2.Request"
+
+	// Headers of the responses to remote write 2.0 requests.
+	samplesWrittenHeader    = "X-Prometheus-Remote-Write-Samples-Written"
+	histogramsWrittenHeader = "X-Prometheus-Remote-Write-Histograms-Written"
+	exemplarsWrittenHeader  = "X-Prometheus-Remote-Write-Exemplars-Written"
+)
+
+// remoteWriteVersion returns the remote write version of the request, from the protobuf message named by its
+// Content-Type header. Requests which don't name one are 2.0 requests if their X-Prometheus-Remote-Write-Version
+// header advertises it, 1.0 requests otherwise.
+func remoteWriteVersion(r *http.Request) (string, error) {
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		switch msg := params["proto"]; msg {
+		case "":
+		case remoteWriteV1Message:
+			return remoteWriteV1, nil
+		case remoteWriteV2Message:
+			return remoteWriteV2, nil
+		default:
+			return "", errors.Errorf("unsupported remote write protobuf message %q, expected %s or %s", msg, remoteWriteV1Message, remoteWriteV2Message)
+		}
+	}
+	if strings.HasPrefix(r.Header.Get(remoteWriteVersionHeader), "2.") {
+		return remoteWriteV2, nil
+	}
+	return remoteWriteV1, nil
+}
+
+// writeCounts are the numbers of samples, exemplars and native histograms of a remote write request.
+type writeCounts struct {
+	samples    int
+	exemplars  int
+	histograms int
+}
+
+func (c *writeCounts) add(o writeCounts) {
+	c.samples += o.samples
+	c.exemplars += o.exemplars
+	c.histograms += o.histograms
+}
+
+func countWriteRequest(wreq *prompb.WriteRequest) writeCounts {
+	var c writeCounts
+	for _, ts := range wreq.Timeseries {
+		c.samples += len(ts.Samples)
+		c.exemplars += len(ts.Exemplars)
+	}
+	return c
+}
+
+// decodeRemoteWriteV2Request decodes the snappy compressed protobuf body of a Prometheus remote write 2.0 request,
+// and translates it to a remote write 1.0 request. It also returns the counts of the decoded request.
+func decodeRemoteWriteV2Request(body []byte) (*prompb.WriteRequest, writeCounts, error) {
+	reqBuf, err := s2.Decode(nil, body)
+	if err != nil {
+		return nil, writeCounts{}, errors.Wrap(err, "snappy decode error")
+	}
+
+	var req writev2pb.Request
+	if err := proto.Unmarshal(reqBuf, &req); err != nil {
+		return nil, writeCounts{}, err
+	}
+	var counts writeCounts
+	for _, ts := range req.Timeseries {
+		counts.samples += len(ts.Samples)
+		counts.exemplars += len(ts.Exemplars)
+		counts.histograms += len(ts.Histograms)
+	}
+	wreq, err := writeV2ToWriteRequest(&req)
+	return wreq, counts, err
+}
+
+// writeV2ToWriteRequest translates a remote write 2.0 request to a remote write 1.0 request. The labels of series and
+// exemplars are resolved from the symbols of the request, and the metadata of series becomes the metadata of their
+// metric family. Native histograms have no equivalent and are dropped, as are created timestamps.
+func writeV2ToWriteRequest(req *writev2pb.Request) (*prompb.WriteRequest, error) {
+	wreq := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(req.Timeseries))}
+	families := map[string]struct{}{}
+	for i, ts := range req.Timeseries {
+		lset, err := desymbolizeLabels(ts.LabelsRefs, req.Symbols)
+		if err != nil {
+			return nil, errors.Wrapf(err, "labels of series %d", i)
+		}
+		if len(ts.Samples) > 0 || len(ts.Exemplars) > 0 {
+			pts := prompb.TimeSeries{Labels: lset, Samples: make([]prompb.Sample, 0, len(ts.Samples))}
+			for _, s := range ts.Samples {
+				pts.Samples = append(pts.Samples, prompb.Sample{Value: s.Value, Timestamp: s.Timestamp})
+			}
+			for j, e := range ts.Exemplars {
+				elset, err := desymbolizeLabels(e.LabelsRefs, req.Symbols)
+				if err != nil {
+					return nil, errors.Wrapf(err, "labels of exemplar %d of series %d", j, i)
+				}
+				pts.Exemplars = append(pts.Exemplars, prompb.Exemplar{Labels: elset, Value: e.Value, Timestamp: e.Timestamp})
+			}
+			wreq.Timeseries = append(wreq.Timeseries, pts)
+		}
+
+		md, err := writeV2Metadata(ts.Metadata, lset, req.Symbols)
+		if err != nil {
+			return nil, errors.Wrapf(err, "metadata of series %d", i)
+		}
+		if md == nil {
+			continue
+		}
+		if _, ok := families[md.MetricFamilyName]; ok {
+			continue
+		}
+		families[md.MetricFamilyName] = struct{}{}
+		wreq.Metadata = append(wreq.Metadata, *md)
+	}
+	return wreq, nil
+}
+
+// desymbolizeLabels resolves the label name and value pairs referenced by refs, sorted by name.
+func desymbolizeLabels(refs []uint32, symbols []string) ([]labelpb.ZLabel, error) {
+	if len(refs)%2 != 0 {
+		return nil, errors.Errorf("odd number of label references %d", len(refs))
+	}
+	lset := make([]labelpb.ZLabel, 0, len(refs)/2)
+	for i := 0; i < len(refs); i += 2 {
+		name, err := symbol(refs[i], symbols)
+		if err != nil {
+			return nil, err
+		}
+		value, err := symbol(refs[i+1], symbols)
+		if err != nil {
+			return nil, err
+		}
+		lset = append(lset, labelpb.ZLabel{Name: name, Value: value})
+	}
+	sort.Slice(lset, func(i, j int) bool { return lset[i].Name < lset[j].Name })
+	return lset, nil
+}
+
+func symbol(ref uint32, symbols []string) (string, error) {
+	if int(ref) >= len(symbols) {
+		return "", errors.Errorf("symbol reference %d out of range of %d symbols", ref, len(symbols))
+	}
+	return symbols[ref], nil
+}
+
+// writeV2Metadata translates the metadata of a series to the metadata of its metric family, if it has any.
+func writeV2Metadata(md writev2pb.Metadata, lset []labelpb.ZLabel, symbols []string) (*prompb.MetricMetadata, error) {
+	if md.Type == writev2pb.Metadata_METRIC_TYPE_UNSPECIFIED && md.HelpRef == 0 && md.UnitRef == 0 {
+		return nil, nil
+	}
+	help, err := symbol(md.HelpRef, symbols)
+	if err != nil {
+		return nil, errors.Wrap(err, "help")
+	}
+	unit, err := symbol(md.UnitRef, symbols)
+	if err != nil {
+		return nil, errors.Wrap(err, "unit")
+	}
+
+	var name string
+	for _, l := range lset {
+		if l.Name == labels.MetricName {
+			name = l.Value
+			break
+		}
+	}
+	// The metric types of both versions are in the same order.
+	return &prompb.MetricMetadata{
+		Type:             prompb.MetricMetadata_MetricType(md.Type),
+		MetricFamilyName: name,
+		Help:             help,
+		Unit:             unit,
+	}, nil
+}
+
+// setWrittenHeaders sets the headers of the response to a remote write 2.0 request, with the counts of what was written.
+func setWrittenHeaders(w http.ResponseWriter, written writeCounts) {
+	w.Header().Set(samplesWrittenHeader, strconv.Itoa(written.samples))
+	w.Header().Set(histogramsWrittenHeader, strconv.Itoa(written.histograms))
+	w.Header().Set(exemplarsWrittenHeader, strconv.Itoa(written.exemplars))
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
 	"gopkg.in/yaml.v3"
 
@@ -120,6 +121,8 @@ type Manager struct {
 	mtx         sync.RWMutex
 	ruleFiles   map[string]string
 	externalURL string
+	// Tenants of rule groups setting one, keyed by rules.GroupKey of their file in the work dir.
+	groupTenants map[string]string
 }
 
 // NewManager creates new Manager.
@@ -204,6 +207,8 @@ func (m *Manager) Active() []*rulespb.AlertInstance {
 
 type configRuleAdapter struct {
 	PartialResponseStrategy *storepb.PartialResponseStrategy
+	// Tenant the results of the group are written to, empty for the default one.
+	Tenant string
 
 	group           rulefmt.RuleGroup
 	nativeRuleGroup map[string]interface{}
@@ -213,6 +218,7 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 	rs := struct {
 		RuleGroup rulefmt.RuleGroup `yaml:",inline"`
 		Strategy  string            `yaml:"partial_response_strategy"`
+		Tenant    string            `yaml:"tenant"`
 	}{}
 
 	if err := unmarshal(&rs); err != nil {
@@ -224,6 +230,10 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 	if err := g.PartialResponseStrategy.UnmarshalJSON([]byte("\"" + rs.Strategy + "\"")); err != nil {
 		return err
 	}
+	if err := validateTenant(rs.Tenant); err != nil {
+		return errors.Wrapf(err, "group %q", rs.RuleGroup.Name)
+	}
+	g.Tenant = rs.Tenant
 	g.group = rs.RuleGroup
 
 	var native map[string]interface{}
@@ -231,6 +241,7 @@ func (g *configRuleAdapter) UnmarshalYAML(unmarshal func(interface{}) error) err
 		return errors.Wrap(err, "failed to unmarshal rulefmt.configRuleAdapter")
 	}
 	delete(native, "partial_response_strategy")
+	delete(native, "tenant")
 
 	g.nativeRuleGroup = native
 	return nil
@@ -244,6 +255,14 @@ func (g configRuleAdapter) MarshalYAML() (interface{}, error) {
 	}, nil
 }
 
+// validateTenant returns an error if the tenant can't be used as a directory name.
+func validateTenant(tenant string) error {
+	if tenant == "." || tenant == ".." || strings.ContainsAny(tenant, `/\`) {
+		return errors.Errorf("invalid tenant %q", tenant)
+	}
+	return nil
+}
+
 // TODO(bwplotka): Replace this with upstream implementation after https://github.com/prometheus/prometheus/issues/7128 is fixed.
 func (g configRuleAdapter) validate() (errs []error) {
 	set := map[string]struct{}{}
@@ -317,6 +336,7 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 		errs            errutil.MultiError
 		filesByStrategy = map[storepb.PartialResponseStrategy][]string{}
 		ruleFiles       = map[string]string{}
+		groupTenants    = map[string]string{}
 	)
 
 	// Initialize filesByStrategy for existing managers' strategies to make
@@ -371,6 +391,11 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 			}
 			filesByStrategy[s] = append(filesByStrategy[s], newFn)
 			ruleFiles[newFn] = fn
+			for _, g := range rg {
+				if g.Tenant != "" {
+					groupTenants[rules.GroupKey(newFn, g.group.Name)] = g.Tenant
+				}
+			}
 		}
 	}
 
@@ -389,11 +414,26 @@ func (m *Manager) Update(evalInterval time.Duration, files []string) error {
 		}
 	}
 	m.ruleFiles = ruleFiles
+	m.groupTenants = groupTenants
 	m.mtx.Unlock()
 
 	return errs.Err()
 }
 
+// GroupTenant returns the tenant of the rule group evaluated with the given context, as set by the tenant field of
+// the group, or an empty string if the group doesn't set one or the context isn't the one of a rule group evaluation.
+func (m *Manager) GroupTenant(ctx context.Context) string {
+	origin, _ := ctx.Value(promql.QueryOrigin{}).(map[string]interface{})
+	group, ok := origin["ruleGroup"].(map[string]string)
+	if !ok {
+		return ""
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.groupTenants[rules.GroupKey(group["file"], group["name"])]
+}
+
 // Rules returns specified rules from manager. This is used by gRPC and locally for HTTP and UI purposes.
 func (m *Manager) Rules(r *rulespb.RulesRequest, s rulespb.Rules_RulesServer) (err error) {
 	groups := m.protoRuleGroups()
@@ -303,7 +303,10 @@ func TestConfigRuleAdapterUnmarshalMarshalYAML(t *testing.T) {
   - alert: some
     expr: rate(some_metric[1h:5m] offset 1d)
   partial_response_strategy: WARN
+  tenant: team-a
 `), &c))
+	testutil.Equals(t, "", c.Groups[0].Tenant)
+	testutil.Equals(t, "team-a", c.Groups[1].Tenant)
 	b, err := yaml.Marshal(c)
 	testutil.Ok(t, err)
 	testutil.Equals(t, `groups:
@@ -319,6 +322,20 @@ func TestConfigRuleAdapterUnmarshalMarshalYAML(t *testing.T) {
 `, string(b))
 }
 
+func TestConfigRuleAdapterUnmarshalYAML_InvalidTenant(t *testing.T) {
+	for _, tenant := range []string{".", "..", "a/b", `a\\b`} {
+		c := configGroups{}
+		err := yaml.Unmarshal([]byte(fmt.Sprintf(`groups:
+- name: something
+  rules:
+  - alert: some
+    expr: up
+  tenant: "%s"
+`, tenant)), &c)
+		testutil.NotOk(t, err)
+	}
+}
+
 func TestManager_Rules(t *testing.T) {
 	dir, err := ioutil.TempDir("", "test_rule_run")
 	testutil.Ok(t, err)
@@ -458,3 +475,118 @@ groups:
 	}))
 	testutil.Equals(t, "exceeded limit of 1 with 2 alerts", thanosRuleMgr.protoRuleGroups()[0].Rules[0].GetAlert().LastError)
 }
+
+type recordingAppendable struct {
+	mtx     sync.Mutex
+	samples []labels.Labels
+}
+
+func (a *recordingAppendable) Appender(_ context.Context) storage.Appender {
+	return &recordingAppender{a: a}
+}
+
+type recordingAppender struct {
+	nopAppender
+	a *recordingAppendable
+}
+
+func (r *recordingAppender) Append(_ storage.SeriesRef, l labels.Labels, _ int64, _ float64) (storage.SeriesRef, error) {
+	r.a.mtx.Lock()
+	defer r.a.mtx.Unlock()
+	r.a.samples = append(r.a.samples, l)
+	return 0, nil
+}
+
+func TestManager_TenantAppendable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_rule_tenants")
+	testutil.Ok(t, err)
+	t.Cleanup(func() { testutil.Ok(t, os.RemoveAll(dir)) })
+	filename := filepath.Join(dir, "tenants.yaml")
+	testutil.Ok(t, ioutil.WriteFile(filename, []byte(`
+groups:
+- name: "default"
+  interval: 10ms
+  rules:
+  - record: "default_rule"
+    expr: "up"
+- name: "tenant-a"
+  interval: 10ms
+  tenant: a
+  rules:
+  - record: "a_rule"
+    expr: "up"
+- name: "tenant-b"
+  interval: 10ms
+  tenant: b
+  partial_response_strategy: WARN
+  rules:
+  - record: "b_rule"
+    expr: "up"
+`), os.ModePerm))
+
+	var (
+		thanosRuleMgr *Manager
+		mtx           sync.Mutex
+		appendables   = map[string]*recordingAppendable{}
+	)
+	appendable := NewTenantAppendable(
+		"default",
+		func(ctx context.Context) string { return thanosRuleMgr.GroupTenant(ctx) },
+		func(tenant string) (storage.Appendable, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			appendables[tenant] = &recordingAppendable{}
+			return appendables[tenant], nil
+		},
+	)
+	thanosRuleMgr = NewManager(
+		context.Background(),
+		nil,
+		dir,
+		rules.ManagerOptions{
+			Logger:     log.NewLogfmtLogger(os.Stderr),
+			Appendable: appendable,
+			Queryable:  nopQueryable{},
+		},
+		func(partialResponseStrategy storepb.PartialResponseStrategy) rules.QueryFunc {
+			return func(ctx context.Context, q string, ts time.Time) (promql.Vector, error) {
+				return []promql.Sample{{Point: promql.Point{T: 0, V: 1}, Metric: labels.FromStrings("foo", "bar")}}, nil
+			}
+		},
+		nil,
+		"http://localhost",
+	)
+	thanosRuleMgr.Run()
+	t.Cleanup(thanosRuleMgr.Stop)
+	testutil.Ok(t, thanosRuleMgr.Update(10*time.Millisecond, []string{filename}))
+
+	expected := map[string]string{"default": "default_rule", "a": "a_rule", "b": "b_rule"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	testutil.Ok(t, runutil.Retry(10*time.Millisecond, ctx.Done(), func() error {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if len(appendables) != len(expected) {
+			return errors.Errorf("expected %d tenants, got %d", len(expected), len(appendables))
+		}
+		for tenant, name := range expected {
+			app, ok := appendables[tenant]
+			if !ok {
+				return errors.Errorf("no appendable for tenant %q", tenant)
+			}
+			app.mtx.Lock()
+			samples := app.samples
+			app.mtx.Unlock()
+			if len(samples) == 0 {
+				return errors.Errorf("no samples for tenant %q", tenant)
+			}
+			for _, s := range samples {
+				if s.Get(labels.MetricName) != name {
+					return errors.Errorf("unexpected sample %v for tenant %q", s, tenant)
+				}
+			}
+		}
+		return nil
+	}))
+}
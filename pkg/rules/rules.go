@@ -163,19 +163,58 @@ func dedupRules(rules []*rulespb.Rule, replicaLabels map[string]struct{}) []*rul
 				continue
 			}
 		case rules[i].GetAlert() != nil && rules[j].GetAlert() != nil:
-			if rules[i].GetAlert().Compare(rules[j].GetAlert()) <= 0 {
-				continue
+			// Replicas might not agree on the active alerts, e.g. right after a restart, so keep all of them.
+			alerts := mergeAlerts(rules[i].GetAlert().Alerts, rules[j].GetAlert().Alerts)
+			if rules[i].GetAlert().Compare(rules[j].GetAlert()) > 0 {
+				rules[i] = rules[j]
 			}
+			rules[i].GetAlert().Alerts = alerts
+			continue
 		default:
 			continue
 		}
 
-		// Swap if we found a younger recording rule or a younger firing alerting rule.
+		// Swap if we found a younger recording rule.
 		rules[i] = rules[j]
 	}
 	return rules[:i+1]
 }
 
+// mergeAlerts returns the union of the active alerts of two replicas of an alerting rule. Of the alerts with the same
+// labels, the one in the most critical state is kept, or the one active for the longest time if in the same state.
+func mergeAlerts(a, b []*rulespb.AlertInstance) []*rulespb.AlertInstance {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+
+	alerts := append(append(make([]*rulespb.AlertInstance, 0, len(a)+len(b)), a...), b...)
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if d := labels.Compare(alerts[i].Labels.PromLabels(), alerts[j].Labels.PromLabels()); d != 0 {
+			return d < 0
+		}
+		if d := alerts[i].State.Compare(alerts[j].State); d != 0 {
+			return d < 0
+		}
+		if alerts[i].ActiveAt == nil || alerts[j].ActiveAt == nil {
+			return alerts[j].ActiveAt == nil && alerts[i].ActiveAt != nil
+		}
+		return alerts[i].ActiveAt.Before(*alerts[j].ActiveAt)
+	})
+
+	i := 0
+	for j := 1; j < len(alerts); j++ {
+		if labels.Equal(alerts[i].Labels.PromLabels(), alerts[j].Labels.PromLabels()) {
+			continue
+		}
+		i++
+		alerts[i] = alerts[j]
+	}
+	return alerts[:i+1]
+}
+
 func removeReplicaLabels(r *rulespb.Rule, replicaLabels map[string]struct{}) {
 	lbls := r.GetLabels()
 	newLabels := make(labels.Labels, 0, len(lbls))
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -1422,3 +1423,54 @@ func TestFilterRules(t *testing.T) {
 		})
 	}
 }
+
+func TestGRPCClient_MergesHARulers(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	ruler := func(replica string, alerts ...*rulespb.AlertInstance) rulespb.RulesClient {
+		return &testRulesClient{
+			response: rulespb.NewRuleGroupRulesResponse(&rulespb.RuleGroup{
+				Name: "group",
+				File: "alerts.yaml",
+				Rules: []*rulespb.Rule{
+					rulespb.NewAlertingRule(&rulespb.Alert{
+						Name:   "HighLatency",
+						Labels: labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("replica", replica, "severity", "page"))},
+						State:  rulespb.AlertState_FIRING,
+						Alerts: alerts,
+					}),
+				},
+			}),
+		}
+	}
+	alert := func(instance string, state rulespb.AlertState, activeAt time.Time) *rulespb.AlertInstance {
+		return &rulespb.AlertInstance{
+			Labels:   labelpb.ZLabelSet{Labels: labelpb.ZLabelsFromPromLabels(labels.FromStrings("instance", instance))},
+			State:    state,
+			ActiveAt: &activeAt,
+		}
+	}
+
+	proxy := NewProxy(log.NewNopLogger(), func() []rulespb.RulesClient {
+		return []rulespb.RulesClient{
+			ruler("a", alert("1", rulespb.AlertState_FIRING, earlier)),
+			// Restarted recently, so the alert of instance 1 is pending again.
+			ruler("b", alert("1", rulespb.AlertState_PENDING, now), alert("2", rulespb.AlertState_FIRING, now)),
+		}
+	})
+	groups, warnings, err := NewGRPCClientWithDedup(proxy, []string{"replica"}).Rules(context.Background(), &rulespb.RulesRequest{
+		Type:                    rulespb.RulesRequest_ALL,
+		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(warnings))
+
+	testutil.Equals(t, 1, len(groups.Groups))
+	testutil.Equals(t, 1, len(groups.Groups[0].Rules))
+	rule := groups.Groups[0].Rules[0].GetAlert()
+	testutil.Equals(t, labels.FromStrings("severity", "page"), rule.Labels.PromLabels())
+	testutil.Equals(t, []*rulespb.AlertInstance{
+		alert("1", rulespb.AlertState_FIRING, earlier),
+		alert("2", rulespb.AlertState_FIRING, now),
+	}, rule.Alerts)
+}
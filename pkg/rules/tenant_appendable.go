@@ -0,0 +1,83 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package rules
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// TenantAppendable is a storage.Appendable routing the results of rule groups to the appendable of their tenant.
+// Appendables are created on the first append of their tenant, and kept afterwards.
+type TenantAppendable struct {
+	defaultTenant string
+	tenantFn      func(ctx context.Context) string
+	newAppendable func(tenant string) (storage.Appendable, error)
+
+	mtx         sync.Mutex
+	appendables map[string]storage.Appendable
+}
+
+// NewTenantAppendable creates a TenantAppendable. tenantFn returns the tenant of the rule group evaluated with the
+// given context, e.g. Manager.GroupTenant, the default tenant being used if it's empty.
+func NewTenantAppendable(
+	defaultTenant string,
+	tenantFn func(ctx context.Context) string,
+	newAppendable func(tenant string) (storage.Appendable, error),
+) *TenantAppendable {
+	return &TenantAppendable{
+		defaultTenant: defaultTenant,
+		tenantFn:      tenantFn,
+		newAppendable: newAppendable,
+		appendables:   map[string]storage.Appendable{},
+	}
+}
+
+// Appender returns an appender of the tenant of the rule group evaluated with the given context. If the appendable
+// of the tenant can't be created, the appender fails every append.
+func (a *TenantAppendable) Appender(ctx context.Context) storage.Appender {
+	tenant := a.tenantFn(ctx)
+	if tenant == "" {
+		tenant = a.defaultTenant
+	}
+
+	app, err := a.appendable(tenant)
+	if err != nil {
+		return errAppender{err: errors.Wrapf(err, "create appendable of tenant %q", tenant)}
+	}
+	return app.Appender(ctx)
+}
+
+func (a *TenantAppendable) appendable(tenant string) (storage.Appendable, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if app, ok := a.appendables[tenant]; ok {
+		return app, nil
+	}
+	app, err := a.newAppendable(tenant)
+	if err != nil {
+		return nil, err
+	}
+	a.appendables[tenant] = app
+	return app, nil
+}
+
+type errAppender struct {
+	err error
+}
+
+func (a errAppender) Append(storage.SeriesRef, labels.Labels, int64, float64) (storage.SeriesRef, error) {
+	return 0, a.err
+}
+func (a errAppender) AppendExemplar(storage.SeriesRef, labels.Labels, exemplar.Exemplar) (storage.SeriesRef, error) {
+	return 0, a.err
+}
+func (a errAppender) Commit() error   { return a.err }
+func (a errAppender) Rollback() error { return nil }
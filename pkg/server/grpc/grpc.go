@@ -24,12 +24,18 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	// Register gzip compressor so clients can compress requests to Thanos components.
+	_ "google.golang.org/grpc/encoding/gzip"
 	grpc_health "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	// Register snappy compressor so clients can compress requests to Thanos components.
+	_ "github.com/thanos-io/thanos/pkg/extgrpc/snappy"
+	// Register zstd compressor so clients can compress requests to Thanos components.
+	_ "github.com/thanos-io/thanos/pkg/extgrpc/zstd"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
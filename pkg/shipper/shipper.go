@@ -83,11 +83,18 @@ type Shipper struct {
 	uploadCompacted        bool
 	allowOutOfOrderUploads bool
 	hashFunc               metadata.HashFunc
+	uploadOptions          []objstore.UploadOption
+	pending                PendingFunc
 }
 
+// PendingFunc reports whether the block is held back from shipping for now, given the metas of all local blocks
+// sorted by min time.
+type PendingFunc func(m *metadata.Meta, metas []*metadata.Meta) bool
+
 // New creates a new shipper that detects new TSDB blocks in dir and uploads them to
 // remote if necessary. It attaches the Thanos metadata section in each meta JSON file.
 // If uploadCompacted is enabled, it also uploads compacted blocks which are already in filesystem.
+// The upload options are applied to uploads of block files, e.g. to enable multipart upload of large files.
 func New(
 	logger log.Logger,
 	r prometheus.Registerer,
@@ -98,6 +105,7 @@ func New(
 	uploadCompacted bool,
 	allowOutOfOrderUploads bool,
 	hashFunc metadata.HashFunc,
+	uploadOptions ...objstore.UploadOption,
 ) *Shipper {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -116,9 +124,17 @@ func New(
 		allowOutOfOrderUploads: allowOutOfOrderUploads,
 		uploadCompacted:        uploadCompacted,
 		hashFunc:               hashFunc,
+		uploadOptions:          uploadOptions,
 	}
 }
 
+// WithPendingFunc holds back the blocks for which f returns true from shipping, e.g. because they are still to be
+// compacted locally. Held back blocks are reconsidered on every Sync.
+func (s *Shipper) WithPendingFunc(f PendingFunc) *Shipper {
+	s.pending = f
+	return s
+}
+
 // Timestamps returns the minimum timestamp for which data is available and the highest timestamp
 // of blocks that were successfully uploaded.
 func (s *Shipper) Timestamps() (minTime, maxSyncTime int64, err error) {
@@ -280,6 +296,11 @@ func (s *Shipper) Sync(ctx context.Context) (uploaded int, err error) {
 			}
 		}
 
+		if s.pending != nil && s.pending(m, metas) {
+			level.Debug(s.logger).Log("msg", "holding back pending block", "block", m.ULID)
+			continue
+		}
+
 		// Check against bucket if the meta file for this block exists.
 		ok, err := s.bucket.Exists(ctx, path.Join(m.ULID.String(), block.MetaFilename))
 		if err != nil {
@@ -363,7 +384,7 @@ func (s *Shipper) upload(ctx context.Context, meta *metadata.Meta) error {
 	if err := meta.WriteToDir(s.logger, updir); err != nil {
 		return errors.Wrap(err, "write meta file")
 	}
-	return block.Upload(ctx, s.logger, s.bucket, updir, s.hashFunc)
+	return block.Upload(ctx, s.logger, s.bucket, updir, s.hashFunc, s.uploadOptions...)
 }
 
 // blockMetasFromOldest returns the block meta of each block found in dir
@@ -4,18 +4,22 @@
 package shipper
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 
@@ -197,6 +201,90 @@ func TestShipperAddsSegmentFiles(t *testing.T) {
 	testutil.Equals(t, []string{segmentFile}, meta.Thanos.SegmentFiles)
 }
 
+// multipartRecordingBucket is an in-memory bucket supporting multipart upload, which records the sizes of uploaded parts.
+type multipartRecordingBucket struct {
+	*objstore.InMemBucket
+
+	mtx   sync.Mutex
+	parts map[string][]int
+}
+
+func (b *multipartRecordingBucket) UploadMultipart(ctx context.Context, name string, r io.Reader, size int64, partSize uint64, _ uint) error {
+	var (
+		buf   bytes.Buffer
+		parts []int
+	)
+	for {
+		n, err := io.CopyN(&buf, r, int64(partSize))
+		if n > 0 {
+			parts = append(parts, int(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if int64(buf.Len()) != size {
+		return errors.Errorf("expected %d bytes, got %d", size, buf.Len())
+	}
+
+	b.mtx.Lock()
+	b.parts[name] = parts
+	b.mtx.Unlock()
+	return b.Upload(ctx, name, &buf)
+}
+
+func TestShipperMultipartUpload(t *testing.T) {
+	dir := t.TempDir()
+
+	lbls := labels.FromStrings("test", "test")
+	bkt := &multipartRecordingBucket{InMemBucket: objstore.NewInMemBucket(), parts: map[string][]int{}}
+	s := New(nil, nil, dir, objstore.BucketWithMetrics("test", bkt, nil), func() labels.Labels { return lbls }, metadata.TestSource, false, false, metadata.NoneFunc,
+		objstore.WithMultipartUpload(1000, 1024, 2))
+
+	id := ulid.MustNew(1, nil)
+	blockDir := path.Join(dir, id.String())
+	chunksDir := path.Join(blockDir, block.ChunksDirname)
+	testutil.Ok(t, os.MkdirAll(chunksDir, os.ModePerm))
+
+	testutil.Ok(t, metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    id,
+			MaxTime: 2000,
+			MinTime: 1000,
+			Version: 1,
+			Stats: tsdb.BlockStats{
+				NumSamples: 1000, // Not really, but shipper needs nonzero value.
+			},
+		},
+	}.WriteToDir(log.NewNopLogger(), blockDir))
+	testutil.Ok(t, os.WriteFile(filepath.Join(blockDir, "index"), []byte("index file"), 0666))
+	chunks := bytes.Repeat([]byte("a"), 2500)
+	testutil.Ok(t, os.WriteFile(filepath.Join(chunksDir, "000001"), chunks, 0666))
+
+	uploaded, err := s.Sync(context.Background())
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, uploaded)
+
+	// Only the chunks file is above the threshold.
+	testutil.Equals(t, map[string][]int{
+		path.Join(id.String(), block.ChunksDirname, "000001"): {1024, 1024, 452},
+	}, bkt.parts)
+
+	rc, err := bkt.Get(context.Background(), path.Join(id.String(), block.ChunksDirname, "000001"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, rc.Close()) }()
+	b, err := io.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, chunks, b)
+
+	ok, err := bkt.Exists(context.Background(), path.Join(id.String(), block.IndexFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "index should be uploaded")
+}
+
 func TestReadMetaFile(t *testing.T) {
 	t.Run("Missing meta file", func(t *testing.T) {
 		// Create TSDB directory without meta file
@@ -34,6 +34,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"github.com/prometheus/prometheus/tsdb/index"
+	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -43,6 +44,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/model"
@@ -119,6 +121,7 @@ type bucketStoreMetrics struct {
 	resultSeriesCount     prometheus.Summary
 	chunkSizeBytes        prometheus.Histogram
 	queriesDropped        *prometheus.CounterVec
+	queriesLimited        *prometheus.CounterVec
 	seriesRefetches       prometheus.Counter
 
 	cachedPostingsCompressions           *prometheus.CounterVec
@@ -129,6 +132,8 @@ type bucketStoreMetrics struct {
 
 	seriesFetchDuration   prometheus.Histogram
 	postingsFetchDuration prometheus.Histogram
+	postingsLazyExpanded  prometheus.Counter
+	postingsEagerExpanded prometheus.Counter
 }
 
 func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
@@ -208,6 +213,10 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Name: "thanos_bucket_store_queries_dropped_total",
 		Help: "Number of queries that were dropped due to the limit.",
 	}, []string{"reason"})
+	m.queriesLimited = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_queries_limited_total",
+		Help: "Number of Series requests that were aborted due to the request limits of their tenant.",
+	}, []string{"reason"})
 	m.seriesRefetches = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_bucket_store_series_refetches_total",
 		Help: fmt.Sprintf("Total number of cases where %v bytes was not enough was to fetch series from index, resulting in refetch.", maxSeriesSize),
@@ -255,6 +264,15 @@ func newBucketStoreMetrics(reg prometheus.Registerer) *bucketStoreMetrics {
 		Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
 	})
 
+	m.postingsLazyExpanded = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_postings_lazy_expanded_total",
+		Help: "Total number of regex matchers whose postings were expanded lazily, against the postings of the other matchers of a block.",
+	})
+	m.postingsEagerExpanded = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_bucket_store_postings_eager_expanded_total",
+		Help: "Total number of regex matchers whose postings were expanded at once by the auto postings strategy, because the other matchers of a block matched too many series to expand them lazily.",
+	})
+
 	return &m
 }
 
@@ -289,6 +307,8 @@ type BucketStore struct {
 	debugLogging bool
 	// Number of goroutines to use when syncing blocks from object storage.
 	blockSyncConcurrency int
+	// Maximum number of index-headers built concurrently, 0 means no limit.
+	indexHeaderGenerationConcurrency int
 
 	// Query gate which limits the maximum amount of concurrent queries.
 	queryGate gate.Gate
@@ -309,6 +329,33 @@ type BucketStore struct {
 
 	// Enables hints in the Series() response.
 	enableSeriesResponseHints bool
+
+	// Number of largest blocks to expose statistics metrics for, 0 disables them.
+	blockStatsTopN int
+
+	// Series selectors to load into the index cache during the initial sync.
+	indexCacheWarmupMatchers [][]*labels.Matcher
+
+	// Enables bypassing the caches for Series requests with no_cache set.
+	enableNoCacheRequests bool
+
+	// Maximum bytes of chunk data held in memory by each Series() call, 0 means no limit.
+	seriesMemoryBudget uint64
+	// Limits of the Series requests of each tenant, nil if there are none.
+	requestLimits *TenantRequestLimits
+
+	// Label names and values results of blocks, cached for labelsCacheTTL. Nil if disabled.
+	labelsCache         *labelsCache
+	labelsCacheTTL      time.Duration
+	labelsCacheMaxItems int
+
+	// Maximum number of series label sets cached per block, 0 disables the cache.
+	seriesLabelsCacheMaxSeries int
+	seriesLabelsCacheMetrics   *seriesLabelsCacheMetrics
+
+	// How postings of regex matchers are expanded.
+	postingsStrategy      PostingsStrategy
+	lazyPostingsMaxSeries int
 }
 
 func (b *BucketStore) validate() error {
@@ -375,6 +422,14 @@ func WithFilterConfig(filter *FilterConfig) BucketStoreOption {
 	}
 }
 
+// WithIndexHeaderGenerationConcurrency limits the number of index-headers built concurrently
+// from object storage. By default it's only bounded by the block sync concurrency.
+func WithIndexHeaderGenerationConcurrency(concurrency int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.indexHeaderGenerationConcurrency = concurrency
+	}
+}
+
 // WithDebugLogging enables debug logging.
 func WithDebugLogging() BucketStoreOption {
 	return func(s *BucketStore) {
@@ -382,6 +437,78 @@ func WithDebugLogging() BucketStoreOption {
 	}
 }
 
+// WithBlockStatsTopN exposes metrics with statistics of the n largest loaded blocks, labeled by block ULID.
+func WithBlockStatsTopN(n int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.blockStatsTopN = n
+	}
+}
+
+// WithNoCacheRequests makes the store honor the no_cache field of Series requests by reading their
+// index and chunks directly from the object storage, bypassing the index cache and the caching bucket.
+func WithNoCacheRequests(enabled bool) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.enableNoCacheRequests = enabled
+	}
+}
+
+// WithSeriesMemoryBudget aborts Series calls with a ResourceExhausted error once the chunk data they hold
+// in memory exceeds the given number of bytes. 0 disables the budget.
+func WithSeriesMemoryBudget(bytes uint64) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.seriesMemoryBudget = bytes
+	}
+}
+
+// WithRequestLimits aborts the Series calls exceeding the request limits of their tenant with a ResourceExhausted
+// error. The tenant of a call is read from its TenantGRPCMetadataKey gRPC metadata.
+func WithRequestLimits(limits *TenantRequestLimits) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.requestLimits = limits
+	}
+}
+
+// WithLabelsCache caches up to maxItems label names and label values results of blocks for the given TTL,
+// including empty results. A TTL of 0 disables the cache.
+func WithLabelsCache(ttl time.Duration, maxItems int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.labelsCacheTTL = ttl
+		s.labelsCacheMaxItems = maxItems
+	}
+}
+
+// WithSeriesLabelsCache caches the decoded label sets of up to maxSeriesPerBlock series of each block, so repeated
+// queries selecting the same series reuse them. 0 disables the cache.
+func WithSeriesLabelsCache(maxSeriesPerBlock int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.seriesLabelsCacheMaxSeries = maxSeriesPerBlock
+	}
+}
+
+// PostingsStrategy is how the postings of regex matchers are expanded.
+type PostingsStrategy string
+
+const (
+	// EagerPostings fetches the postings of regex matchers at once with the ones of the other matchers.
+	EagerPostings PostingsStrategy = "eager"
+	// LazyPostings fetches the postings of regex matchers only after the ones of the other matchers of a query, in
+	// batches of label values, keeping only the series matched by the other matchers. Fetching stops once all of
+	// them are matched, and is skipped if there are none.
+	LazyPostings PostingsStrategy = "lazy"
+	// AutoPostings fetches the postings of regex matchers after the ones of the other matchers too, lazily if the
+	// other matchers matched few series, and all at once otherwise.
+	AutoPostings PostingsStrategy = "auto"
+)
+
+// WithPostingsStrategy sets how postings of regex matchers are expanded. With AutoPostings, they are expanded lazily
+// if the other matchers of the query matched at most lazyMaxSeries series of the block.
+func WithPostingsStrategy(strategy PostingsStrategy, lazyMaxSeries int) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.postingsStrategy = strategy
+		s.lazyPostingsMaxSeries = lazyMaxSeries
+	}
+}
+
 // NewBucketStore creates a new bucket backed store that implements the store API against
 // an object store bucket. It is optimized to work against high latency backends.
 func NewBucketStore(
@@ -424,13 +551,24 @@ func NewBucketStore(
 
 	// Depend on the options
 	indexReaderPoolMetrics := indexheader.NewReaderPoolMetrics(extprom.WrapRegistererWithPrefix("thanos_bucket_store_", s.reg))
-	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, indexReaderPoolMetrics)
+	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, s.indexHeaderGenerationConcurrency, indexReaderPoolMetrics)
 	s.metrics = newBucketStoreMetrics(s.reg) // TODO(metalmatze): Might be possible via Option too
+	if s.blockStatsTopN > 0 && s.reg != nil {
+		s.reg.MustRegister(newBlockStatsCollector(s, s.blockStatsTopN))
+	}
 
 	if err := s.validate(); err != nil {
 		return nil, errors.Wrap(err, "validate config")
 	}
 
+	var err error
+	if s.labelsCache, err = newLabelsCache(s.reg, s.labelsCacheTTL, s.labelsCacheMaxItems); err != nil {
+		return nil, errors.Wrap(err, "create labels cache")
+	}
+	if s.seriesLabelsCacheMaxSeries > 0 {
+		s.seriesLabelsCacheMetrics = newSeriesLabelsCacheMetrics(s.reg)
+	}
+
 	if err := os.MkdirAll(dir, 0750); err != nil {
 		return nil, errors.Wrap(err, "create dir")
 	}
@@ -550,6 +688,7 @@ func (s *BucketStore) InitialSync(ctx context.Context) error {
 		}
 	}
 
+	s.warmIndexCache(ctx)
 	return nil
 }
 
@@ -618,6 +757,11 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		}
 	}()
 
+	if b.seriesLabels, err = newSeriesLabelsCache(s.seriesLabelsCacheMaxSeries, s.seriesLabelsCacheMetrics); err != nil {
+		return errors.Wrap(err, "create series labels cache")
+	}
+	b.postingsStrategy, b.lazyPostingsMaxSeries = s.postingsStrategy, s.lazyPostingsMaxSeries
+
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
@@ -633,6 +777,8 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 		return errors.Wrap(err, "add block to set")
 	}
 	s.blocks[b.meta.ULID] = b
+	// Nothing should be cached for a new block, unless it was loaded before.
+	s.labelsCache.dropBlock(b.meta.ULID)
 
 	s.metrics.blocksLoaded.Inc()
 	s.metrics.lastLoadedBlock.SetToCurrentTime()
@@ -653,6 +799,10 @@ func (s *BucketStore) removeBlock(id ulid.ULID) error {
 		return nil
 	}
 
+	s.labelsCache.dropBlock(id)
+	if c, ok := s.indexCache.(storecache.BlockEvictingIndexCache); ok {
+		c.EvictBlock(id)
+	}
 	s.metrics.blocksLoaded.Dec()
 	if err := b.Close(); err != nil {
 		return errors.Wrap(err, "close block")
@@ -703,6 +853,9 @@ func (s *BucketStore) Info(context.Context, *storepb.InfoRequest) (*storepb.Info
 		MinTime:   mint,
 		MaxTime:   maxt,
 		LabelSets: s.LabelSet(),
+
+		SupportsLabelValuesStream: true,
+		SupportsQueryPushdown:     true,
 	}
 
 	return res, nil
@@ -780,11 +933,12 @@ func blockSeries(
 	matchers []*labels.Matcher, // Series matchers.
 	chunksLimiter ChunksLimiter, // Rate limiter for loading chunks.
 	seriesLimiter SeriesLimiter, // Rate limiter for loading series.
+	requestLimiter *requestLimiter, // Limits of the request.
 	skipChunks bool, // If true, chunks are not loaded.
 	minTime, maxTime int64, // Series must have data in this time range to be returned.
 	loadAggregates []storepb.Aggr, // List of aggregates to load when loading chunks.
 ) (storepb.SeriesSet, *queryStats, error) {
-	ps, err := indexr.ExpandedPostings(ctx, matchers)
+	ps, deferred, err := indexr.expandedPostings(ctx, matchers, true)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "expanded matching posting")
 	}
@@ -797,6 +951,9 @@ func blockSeries(
 	if err := seriesLimiter.Reserve(uint64(len(ps))); err != nil {
 		return nil, nil, errors.Wrap(err, "exceeded series limit")
 	}
+	if err := requestLimiter.ReserveSeries(uint64(len(ps))); err != nil {
+		return nil, nil, errors.Wrap(err, "exceeded request series limit")
+	}
 
 	// Preload all series index data.
 	// TODO(bwplotka): Consider not keeping all series in memory all the time.
@@ -822,6 +979,12 @@ func blockSeries(
 			// No matching chunks for this time duration, skip series.
 			continue
 		}
+		if err := indexr.lookupSeriesLabels(id, symbolizedLset, &lset); err != nil {
+			return nil, nil, errors.Wrap(err, "Lookup labels symbols")
+		}
+		if !matchesLabels(deferred, lset) {
+			continue
+		}
 
 		s := seriesEntry{}
 		if !skipChunks {
@@ -846,10 +1009,6 @@ func blockSeries(
 				return nil, nil, errors.Wrap(err, "exceeded chunks limit")
 			}
 		}
-		if err := indexr.LookupLabelsSymbols(symbolizedLset, &lset); err != nil {
-			return nil, nil, errors.Wrap(err, "Lookup labels symbols")
-		}
-
 		s.lset = labelpb.ExtendSortedLabels(lset, extLset)
 		res = append(res, s)
 	}
@@ -865,6 +1024,16 @@ func blockSeries(
 	return newBucketSeriesSet(res), indexr.stats.merge(chunkr.stats), nil
 }
 
+// matchesLabels returns true if all matchers match the labels.
+func matchesLabels(ms []*labels.Matcher, lset labels.Labels) bool {
+	for _, m := range ms {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
 func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Aggr, save func([]byte) ([]byte, error)) error {
 	if in.Encoding() == chunkenc.EncXOR {
 		b, err := save(in.Bytes())
@@ -1002,8 +1171,15 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		reqBlockMatchers []*labels.Matcher
 		chunksLimiter    = s.chunksLimiterFactory(s.metrics.queriesDropped.WithLabelValues("chunks"))
 		seriesLimiter    = s.seriesLimiterFactory(s.metrics.queriesDropped.WithLabelValues("series"))
+		memory           = newMemoryTracker(s.seriesMemoryBudget, s.metrics.queriesDropped.WithLabelValues("memory"))
+		requestLimiter   = newRequestLimiter(s.requestLimits.ForTenant(TenantFromContext(ctx)), s.metrics.queriesLimited)
 	)
 
+	noCache := req.NoCache && s.enableNoCacheRequests
+	if noCache {
+		gctx = storecache.WithCachingDisabled(gctx)
+	}
+
 	if req.Hints != nil {
 		reqHints := &hintspb.SeriesRequestHints{}
 		if err := types.UnmarshalAny(req.Hints, reqHints); err != nil {
@@ -1038,11 +1214,16 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				resHints.AddQueriedBlock(b.meta.ULID)
 			}
 
+			b.markQueried()
+
 			var chunkr *bucketChunkReader
 			// We must keep the readers open until all their data has been sent.
 			indexr := b.indexReader()
+			if noCache {
+				indexr.indexCache = noopCache{}
+			}
 			if !req.SkipChunks {
-				chunkr = b.chunkReader()
+				chunkr = b.chunkReader(memory, requestLimiter)
 				defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
 			}
 
@@ -1066,6 +1247,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 					blockMatchers,
 					chunksLimiter,
 					seriesLimiter,
+					requestLimiter,
 					req.SkipChunks,
 					req.MinTime, req.MaxTime,
 					req.Aggregates,
@@ -1139,6 +1321,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	tracing.DoInSpan(ctx, "bucket_store_merge_all", func(ctx context.Context) {
 		begin := time.Now()
 
+		// Range functions are only evaluated over raw data, the querier evaluates them over downsampled data itself.
+		pushdown := req.Pushdown
+		if req.SkipChunks || req.MaxResolutionWindow > 0 {
+			pushdown = nil
+		}
+
 		// NOTE: We "carefully" assume series and chunks are sorted within each SeriesSet. This should be guaranteed by
 		// blockSeries method. In worst case deduplication logic won't deduplicate correctly, which will be accounted later.
 		set := storepb.MergeSeriesSets(res...)
@@ -1152,6 +1340,16 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				lset, _ = set.At()
 			} else {
 				lset, series.Chunks = set.At()
+				if pushdown != nil {
+					if series.Chunks, err = EvalPushdown(pushdown, newRawChunksIterator(series.Chunks)); err != nil {
+						err = status.Error(codes.Internal, errors.Wrap(err, "evaluate pushed down function").Error())
+						return
+					}
+					if len(series.Chunks) == 0 {
+						continue
+					}
+					lset = labels.NewBuilder(lset).Set(dedup.PushdownMarker.Name, dedup.PushdownMarker.Value).Labels()
+				}
 
 				stats.mergedChunksCount += len(series.Chunks)
 				s.metrics.chunkSizeBytes.Observe(float64(chunksSize(series.Chunks)))
@@ -1237,8 +1435,14 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 		if len(reqBlockMatchers) > 0 && !b.matchRelabelLabels(reqBlockMatchers) {
 			continue
 		}
+		// Matchers on external labels are resolved against the block's external labels, since the index doesn't contain them.
+		seriesMatchers, ok := extLabelMatchers(b.extLset, reqSeriesMatchers...)
+		if !ok {
+			continue
+		}
 
 		resHints.AddQueriedBlock(b.meta.ULID)
+		b.markQueried()
 
 		indexr := b.indexReader()
 
@@ -1252,49 +1456,53 @@ func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesReq
 			defer span.Finish()
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label names")
 
-			var result []string
-			if len(reqSeriesMatchers) == 0 {
-				// Do it via index reader to have pending reader registered correctly.
-				// LabelNames are already sorted.
-				res, err := indexr.block.indexHeaderReader.LabelNames()
-				if err != nil {
-					return errors.Wrapf(err, "label names for block %s", b.meta.ULID)
-				}
+			cacheKey := newLabelsCacheKey(b, labelsCacheTypeNames, "", seriesMatchers, req.Start, req.End)
+			result, ok := s.labelsCache.get(cacheKey)
+			if !ok {
+				if len(seriesMatchers) == 0 {
+					// Do it via index reader to have pending reader registered correctly.
+					// LabelNames are already sorted.
+					res, err := indexr.block.indexHeaderReader.LabelNames()
+					if err != nil {
+						return errors.Wrapf(err, "label names for block %s", b.meta.ULID)
+					}
 
-				// Add  a set for the external labels as well.
-				// We're not adding them directly to res because there could be duplicates.
-				// b.extLset is already sorted by label name, no need to sort it again.
-				extRes := make([]string, 0, len(b.extLset))
-				for _, l := range b.extLset {
-					extRes = append(extRes, l.Name)
-				}
+					// Add  a set for the external labels as well.
+					// We're not adding them directly to res because there could be duplicates.
+					// b.extLset is already sorted by label name, no need to sort it again.
+					extRes := make([]string, 0, len(b.extLset))
+					for _, l := range b.extLset {
+						extRes = append(extRes, l.Name)
+					}
 
-				result = strutil.MergeSlices(res, extRes)
-			} else {
-				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, reqSeriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
-				if err != nil {
-					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
-				}
+					result = strutil.MergeSlices(res, extRes)
+				} else {
+					seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, seriesMatchers, nil, seriesLimiter, nil, true, req.Start, req.End, nil)
+					if err != nil {
+						return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
+					}
 
-				// Extract label names from all series. Many label names will be the same, so we need to deduplicate them.
-				// Note that label names will already include external labels (passed to blockSeries), so we don't need
-				// to add them again.
-				labelNames := map[string]struct{}{}
-				for seriesSet.Next() {
-					ls, _ := seriesSet.At()
-					for _, l := range ls {
-						labelNames[l.Name] = struct{}{}
+					// Extract label names from all series. Many label names will be the same, so we need to deduplicate them.
+					// Note that label names will already include external labels (passed to blockSeries), so we don't need
+					// to add them again.
+					labelNames := map[string]struct{}{}
+					for seriesSet.Next() {
+						ls, _ := seriesSet.At()
+						for _, l := range ls {
+							labelNames[l.Name] = struct{}{}
+						}
+					}
+					if seriesSet.Err() != nil {
+						return errors.Wrapf(seriesSet.Err(), "iterate series for block %s", b.meta.ULID)
 					}
-				}
-				if seriesSet.Err() != nil {
-					return errors.Wrapf(seriesSet.Err(), "iterate series for block %s", b.meta.ULID)
-				}
 
-				result = make([]string, 0, len(labelNames))
-				for n := range labelNames {
-					result = append(result, n)
+					result = make([]string, 0, len(labelNames))
+					for n := range labelNames {
+						result = append(result, n)
+					}
+					sort.Strings(result)
 				}
-				sort.Strings(result)
+				s.labelsCache.set(cacheKey, result)
 			}
 
 			if len(result) > 0 {
@@ -1375,7 +1583,14 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 			continue
 		}
 
+		// Matchers on external labels are resolved against the block's external labels, since the index doesn't contain them.
+		seriesMatchers, ok := extLabelMatchers(b.extLset, reqSeriesMatchers...)
+		if !ok {
+			continue
+		}
+
 		resHints.AddQueriedBlock(b.meta.ULID)
+		b.markQueried()
 
 		indexr := b.indexReader()
 		g.Go(func() error {
@@ -1388,44 +1603,48 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 			defer span.Finish()
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label values")
 
-			var result []string
-			if len(reqSeriesMatchers) == 0 {
-				// Do it via index reader to have pending reader registered correctly.
-				res, err := indexr.block.indexHeaderReader.LabelValues(req.Label)
-				if err != nil {
-					return errors.Wrapf(err, "index header label values for block %s", b.meta.ULID)
-				}
+			cacheKey := newLabelsCacheKey(b, labelsCacheTypeValues, req.Label, seriesMatchers, req.Start, req.End)
+			result, ok := s.labelsCache.get(cacheKey)
+			if !ok {
+				if len(seriesMatchers) == 0 {
+					// Do it via index reader to have pending reader registered correctly.
+					res, err := indexr.block.indexHeaderReader.LabelValues(req.Label)
+					if err != nil {
+						return errors.Wrapf(err, "index header label values for block %s", b.meta.ULID)
+					}
 
-				// Add the external label value as well.
-				if extLabelValue := b.extLset.Get(req.Label); extLabelValue != "" {
-					res = strutil.MergeSlices(res, []string{extLabelValue})
-				}
-				result = res
-			} else {
-				seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, reqSeriesMatchers, nil, seriesLimiter, true, req.Start, req.End, nil)
-				if err != nil {
-					return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
-				}
+					// Add the external label value as well.
+					if extLabelValue := b.extLset.Get(req.Label); extLabelValue != "" {
+						res = strutil.MergeSlices(res, []string{extLabelValue})
+					}
+					result = res
+				} else {
+					seriesSet, _, err := blockSeries(newCtx, b.extLset, indexr, nil, seriesMatchers, nil, seriesLimiter, nil, true, req.Start, req.End, nil)
+					if err != nil {
+						return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
+					}
 
-				// Extract given label's value from all series and deduplicate them.
-				// We don't need to deal with external labels, since they are already added by blockSeries.
-				values := map[string]struct{}{}
-				for seriesSet.Next() {
-					ls, _ := seriesSet.At()
-					val := ls.Get(req.Label)
-					if val != "" { // Should never be empty since we added labelName!="" matcher to the list of matchers.
-						values[val] = struct{}{}
+					// Extract given label's value from all series and deduplicate them.
+					// We don't need to deal with external labels, since they are already added by blockSeries.
+					values := map[string]struct{}{}
+					for seriesSet.Next() {
+						ls, _ := seriesSet.At()
+						val := ls.Get(req.Label)
+						if val != "" { // Should never be empty since we added labelName!="" matcher to the list of matchers.
+							values[val] = struct{}{}
+						}
+					}
+					if seriesSet.Err() != nil {
+						return errors.Wrapf(seriesSet.Err(), "iterate series for block %s", b.meta.ULID)
 					}
-				}
-				if seriesSet.Err() != nil {
-					return errors.Wrapf(seriesSet.Err(), "iterate series for block %s", b.meta.ULID)
-				}
 
-				result = make([]string, 0, len(values))
-				for n := range values {
-					result = append(result, n)
+					result = make([]string, 0, len(values))
+					for n := range values {
+						result = append(result, n)
+					}
+					sort.Strings(result)
 				}
-				sort.Strings(result)
+				s.labelsCache.set(cacheKey, result)
 			}
 
 			if len(result) > 0 {
@@ -1455,6 +1674,15 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	}, nil
 }
 
+// LabelValuesStream implements the storepb.StoreServer interface.
+func (s *BucketStore) LabelValuesStream(req *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), req)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
+
 // bucketBlockSet holds all blocks of an equal label set. It internally splits
 // them up by downsampling resolution and allows querying.
 type bucketBlockSet struct {
@@ -1575,10 +1803,16 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64, blockMatc
 // labelMatchers verifies whether the block set matches the given matchers and returns a new
 // set of matchers that is equivalent when querying data within the block.
 func (s *bucketBlockSet) labelMatchers(matchers ...*labels.Matcher) ([]*labels.Matcher, bool) {
+	return extLabelMatchers(s.labels, matchers...)
+}
+
+// extLabelMatchers verifies whether the given external labels match the given matchers and returns
+// the matchers which are left to be evaluated against the series within the block.
+func extLabelMatchers(extLset labels.Labels, matchers ...*labels.Matcher) ([]*labels.Matcher, bool) {
 	res := make([]*labels.Matcher, 0, len(matchers))
 
 	for _, m := range matchers {
-		v := s.labels.Get(m.Name)
+		v := extLset.Get(m.Name)
 		if v == "" {
 			res = append(res, m)
 			continue
@@ -1605,6 +1839,9 @@ type bucketBlock struct {
 	indexHeaderReader indexheader.Reader
 
 	chunkObjs []string
+	// zstdChunkFiles holds the frames of the chunk files whose header was read, nil for uncompressed ones.
+	zstdChunkFilesMtx sync.Mutex
+	zstdChunkFiles    map[int]*block.ZstdChunkFile
 
 	pendingReaders sync.WaitGroup
 
@@ -1613,6 +1850,16 @@ type bucketBlock struct {
 	// Block's labels used by block-level matchers to filter blocks to query. These are used to select blocks using
 	// request hints' BlockMatchers.
 	relabelLabels labels.Labels
+
+	// Decoded label sets of the block's series. Nil if disabled.
+	seriesLabels *seriesLabelsCache
+
+	// How postings of regex matchers are expanded, see WithPostingsStrategy.
+	postingsStrategy      PostingsStrategy
+	lazyPostingsMaxSeries int
+
+	// Time the block was last queried at in milliseconds since epoch, 0 if it wasn't queried since it was loaded.
+	lastQueried atomic.Int64
 }
 
 func newBucketBlock(
@@ -1696,7 +1943,7 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 	}
 
 	// Get a reader for the required range.
-	reader, err := b.bkt.GetRange(ctx, b.chunkObjs[seq], off, length)
+	reader, err := b.getChunkRange(ctx, seq, off, length)
 	if err != nil {
 		return nil, errors.Wrap(err, "get range reader")
 	}
@@ -1721,7 +1968,53 @@ func (b *bucketBlock) chunkRangeReader(ctx context.Context, seq int, off, length
 		return nil, errors.Errorf("unknown segment file for index %d", seq)
 	}
 
-	return b.bkt.GetRange(ctx, b.chunkObjs[seq], off, length)
+	return b.getChunkRange(ctx, seq, off, length)
+}
+
+// getChunkRange returns a reader of the given range of the chunk file, decompressing it if the chunk file is compressed.
+func (b *bucketBlock) getChunkRange(ctx context.Context, seq int, off, length int64) (io.ReadCloser, error) {
+	cf, err := b.zstdChunkFile(ctx, seq)
+	if err != nil {
+		return nil, err
+	}
+	if cf == nil {
+		return b.bkt.GetRange(ctx, b.chunkObjs[seq], off, length)
+	}
+	return cf.GetRange(ctx, b.bkt, b.chunkObjs[seq], off, length)
+}
+
+// zstdChunkFile returns the frames of the chunk file if it's compressed, reading its header on first use. Chunk files
+// of blocks whose meta records no chunk compression are not compressed.
+func (b *bucketBlock) zstdChunkFile(ctx context.Context, seq int) (*block.ZstdChunkFile, error) {
+	if b.meta.Thanos.ChunkCompression != block.ChunkCompressionZstd {
+		return nil, nil
+	}
+
+	b.zstdChunkFilesMtx.Lock()
+	cf, ok := b.zstdChunkFiles[seq]
+	b.zstdChunkFilesMtx.Unlock()
+	if ok {
+		return cf, nil
+	}
+
+	// The header is read without holding the lock, so concurrent first reads of a chunk file may read it more than once.
+	cf, err := block.ReadZstdChunkFileHeader(ctx, b.bkt, b.chunkObjs[seq])
+	if err != nil {
+		return nil, errors.Wrapf(err, "read header of chunk file %s", b.chunkObjs[seq])
+	}
+
+	b.zstdChunkFilesMtx.Lock()
+	defer b.zstdChunkFilesMtx.Unlock()
+	if b.zstdChunkFiles == nil {
+		b.zstdChunkFiles = map[int]*block.ZstdChunkFile{}
+	}
+	b.zstdChunkFiles[seq] = cf
+	return cf, nil
+}
+
+// markQueried records that the block is being queried.
+func (b *bucketBlock) markQueried() {
+	b.lastQueried.Store(time.Now().UnixNano() / int64(time.Millisecond))
 }
 
 func (b *bucketBlock) indexReader() *bucketIndexReader {
@@ -1729,9 +2022,9 @@ func (b *bucketBlock) indexReader() *bucketIndexReader {
 	return newBucketIndexReader(b)
 }
 
-func (b *bucketBlock) chunkReader() *bucketChunkReader {
+func (b *bucketBlock) chunkReader(memory *memoryTracker, limiter *requestLimiter) *bucketChunkReader {
 	b.pendingReaders.Add(1)
-	return newBucketChunkReader(b)
+	return newBucketChunkReader(b, memory, limiter)
 }
 
 // matchRelabelLabels verifies whether the block matches the given matchers.
@@ -1760,9 +2053,10 @@ func (b *bucketBlock) Close() error {
 // bucketIndexReader is a custom index reader (not conforming index.Reader interface) that reads index that is stored in
 // object storage without having to fully download it.
 type bucketIndexReader struct {
-	block *bucketBlock
-	dec   *index.Decoder
-	stats *queryStats
+	block      *bucketBlock
+	dec        *index.Decoder
+	stats      *queryStats
+	indexCache storecache.IndexCache
 
 	mtx          sync.Mutex
 	loadedSeries map[storage.SeriesRef][]byte
@@ -1775,6 +2069,7 @@ func newBucketIndexReader(block *bucketBlock) *bucketIndexReader {
 			LookupSymbol: block.indexHeaderReader.LookupSymbol,
 		},
 		stats:        &queryStats{},
+		indexCache:   block.indexCache,
 		loadedSeries: map[storage.SeriesRef][]byte{},
 	}
 	return r
@@ -1790,26 +2085,71 @@ func newBucketIndexReader(block *bucketBlock) *bucketIndexReader {
 // chunk where the series contains the matching label-value pair for a given block of data. Postings can be fetched by
 // single label name=value.
 func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms []*labels.Matcher) ([]storage.SeriesRef, error) {
+	ps, _, err := r.expandedPostings(ctx, ms, false)
+	return ps, err
+}
+
+// expandedPostings returns the expanded postings of the matchers, like ExpandedPostings. With deferByName set and
+// an equality matcher on the metric name, the postings of the name are looked up first, and matchers whose postings
+// are much larger than them are not intersected, but returned to be matched against the labels of the series instead.
+// Loading the series of the name is then cheaper than fetching those postings, e.g. for `metric{pod=~".+"}`.
+func (r *bucketIndexReader) expandedPostings(ctx context.Context, ms []*labels.Matcher, deferByName bool) ([]storage.SeriesRef, []*labels.Matcher, error) {
 	var (
 		postingGroups []*postingGroup
 		allRequested  = false
 		hasAdds       = false
 		keys          []labels.Label
+
+		deferred []*labels.Matcher
+		// Postings larger than this many bytes are deferred to be matched against series labels, 0 defers nothing.
+		deferAbove int64
+
+		// Groups of regex matchers expanded after the others, unless postings are expanded eagerly.
+		lazyGroups []*postingGroup
 	)
 
+	if deferByName {
+		var err error
+		ms, deferAbove, err = r.metricNameFirst(ms)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deferAbove < 0 {
+			// The block has no series of the metric name.
+			return nil, nil, nil
+		}
+	}
+
 	// NOTE: Derived from tsdb.PostingsForMatchers.
-	for _, m := range ms {
+	for i, m := range ms {
 		// Each group is separate to tell later what postings are intersecting with what.
 		pg, err := toPostingGroup(r.block.indexHeaderReader.LabelValues, m)
 		if err != nil {
-			return nil, errors.Wrap(err, "toPostingGroup")
+			return nil, nil, errors.Wrap(err, "toPostingGroup")
 		}
 
 		// If this groups adds nothing, it's an empty group. We can shortcut this, since intersection with empty
 		// postings would return no postings anyway.
 		// E.g. label="non-existing-value" returns empty group.
 		if !pg.addAll && len(pg.addKeys) == 0 {
-			return nil, nil
+			return nil, nil, nil
+		}
+
+		// The metric name matcher is the first one and never deferred.
+		if i > 0 && deferAbove > 0 {
+			larger, err := r.postingsLargerThan(pg, deferAbove)
+			if err != nil {
+				return nil, nil, err
+			}
+			if larger {
+				deferred = append(deferred, m)
+				continue
+			}
+		}
+
+		if (r.block.postingsStrategy == LazyPostings || r.block.postingsStrategy == AutoPostings) && isLazyRegexMatcher(m) {
+			lazyGroups = append(lazyGroups, pg)
+			continue
 		}
 
 		postingGroups = append(postingGroups, pg)
@@ -1823,8 +2163,18 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms []*labels.M
 		keys = append(keys, pg.removeKeys...)
 	}
 
+	// Lazy groups need the postings of other groups to be intersected with, otherwise they're expanded as usual.
+	if !hasAdds {
+		for _, pg := range lazyGroups {
+			postingGroups = append(postingGroups, pg)
+			hasAdds = true
+			keys = append(keys, pg.addKeys...)
+		}
+		lazyGroups = nil
+	}
+
 	if len(postingGroups) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// We only need special All postings if there are no other adds. If there are, we can skip fetching
@@ -1840,7 +2190,7 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms []*labels.M
 
 	fetchedPostings, err := r.fetchPostings(ctx, keys)
 	if err != nil {
-		return nil, errors.Wrap(err, "get postings")
+		return nil, nil, errors.Wrap(err, "get postings")
 	}
 
 	// Get "add" and "remove" postings from groups. We iterate over postingGroups and their keys
@@ -1871,14 +2221,32 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms []*labels.M
 
 	ps, err := index.ExpandPostings(result)
 	if err != nil {
-		return nil, errors.Wrap(err, "expand")
+		return nil, nil, errors.Wrap(err, "expand")
+	}
+
+	for _, pg := range lazyGroups {
+		if len(ps) == 0 {
+			break
+		}
+		if r.block.postingsStrategy == AutoPostings && len(ps) > r.block.lazyPostingsMaxSeries {
+			// Most batches would be fetched anyway, so fetch them at once.
+			if ps, err = r.intersectEagerly(ctx, ps, pg); err != nil {
+				return nil, nil, errors.Wrap(err, "expand")
+			}
+			r.block.metrics.postingsEagerExpanded.Inc()
+			continue
+		}
+		if ps, err = r.intersectLazily(ctx, ps, pg); err != nil {
+			return nil, nil, errors.Wrap(err, "expand lazily")
+		}
+		r.block.metrics.postingsLazyExpanded.Inc()
 	}
 
 	// As of version two all series entries are 16 byte padded. All references
 	// we get have to account for that to get the correct offset.
 	version, err := r.block.indexHeaderReader.IndexVersion()
 	if err != nil {
-		return nil, errors.Wrap(err, "get index version")
+		return nil, nil, errors.Wrap(err, "get index version")
 	}
 	if version >= 2 {
 		for i, id := range ps {
@@ -1886,7 +2254,130 @@ func (r *bucketIndexReader) ExpandedPostings(ctx context.Context, ms []*labels.M
 		}
 	}
 
-	return ps, nil
+	return ps, deferred, nil
+}
+
+// lazyPostingsBatchSize is the number of label values whose postings are fetched at once by lazy expansion.
+const lazyPostingsBatchSize = 128
+
+// isLazyRegexMatcher returns true if the postings of the regex matcher can be expanded lazily: it matches label
+// values by a regex that isn't a set of values, and doesn't select series without the label.
+func isLazyRegexMatcher(m *labels.Matcher) bool {
+	return m.Type == labels.MatchRegexp && !m.Matches("") && len(findSetMatches(m.Value)) == 0
+}
+
+// intersectEagerly returns the sorted series of ps in the postings of the group, which only has add keys. Postings
+// of all keys are fetched at once.
+func (r *bucketIndexReader) intersectEagerly(ctx context.Context, ps []storage.SeriesRef, pg *postingGroup) ([]storage.SeriesRef, error) {
+	fetched, err := r.fetchPostings(ctx, pg.addKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "get postings")
+	}
+	toMerge := make([]index.Postings, 0, len(pg.addKeys))
+	for i, l := range pg.addKeys {
+		toMerge = append(toMerge, checkNilPosting(l, fetched[i]))
+	}
+	return index.ExpandPostings(index.Intersect(index.NewListPostings(ps), index.Merge(toMerge...)))
+}
+
+// intersectLazily returns the sorted series of ps in the postings of the group, which only has add keys. Postings of
+// the keys are fetched in batches, through the index cache, only until all series of ps are matched, so that at
+// most a batch of them is held in memory besides ps.
+func (r *bucketIndexReader) intersectLazily(ctx context.Context, ps []storage.SeriesRef, pg *postingGroup) ([]storage.SeriesRef, error) {
+	var (
+		matched   = make([]bool, len(ps))
+		unmatched = len(ps)
+	)
+	for i := 0; i < len(pg.addKeys) && unmatched > 0; i += lazyPostingsBatchSize {
+		keys := pg.addKeys[i:]
+		if len(keys) > lazyPostingsBatchSize {
+			keys = keys[:lazyPostingsBatchSize]
+		}
+		fetched, err := r.fetchPostings(ctx, keys)
+		if err != nil {
+			return nil, errors.Wrap(err, "get postings")
+		}
+		toMerge := make([]index.Postings, 0, len(keys))
+		for j, l := range keys {
+			toMerge = append(toMerge, checkNilPosting(l, fetched[j]))
+		}
+
+		it := index.Merge(toMerge...)
+		for j, id := range ps {
+			if matched[j] {
+				continue
+			}
+			if !it.Seek(id) {
+				break
+			}
+			if it.At() == id {
+				matched[j] = true
+				unmatched--
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, errors.Wrap(err, "merge postings")
+		}
+	}
+
+	res := make([]storage.SeriesRef, 0, len(ps)-unmatched)
+	for j, id := range ps {
+		if matched[j] {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// deferredPostingsFactor is how many times larger than the postings of the metric name the postings of a matcher
+// have to be for it to be matched against series labels instead. Postings take 4 bytes per series, while series
+// entries usually take more than 64 bytes, so this keeps loading the series of the name cheaper than the postings.
+const deferredPostingsFactor = 16
+
+// metricNameFirst moves the equality matcher on the metric name, if any, first in the returned matchers. It also
+// returns the size above which postings of the other matchers can be deferred, which is 0 without such a matcher,
+// or -1 if the block has no series of the name.
+func (r *bucketIndexReader) metricNameFirst(ms []*labels.Matcher) ([]*labels.Matcher, int64, error) {
+	for i, m := range ms {
+		if m.Type != labels.MatchEqual || m.Name != labels.MetricName || m.Value == "" {
+			continue
+		}
+
+		rng, err := r.block.indexHeaderReader.PostingsOffset(m.Name, m.Value)
+		if err == indexheader.NotFoundRangeErr {
+			return ms, -1, nil
+		}
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "index header PostingsOffset")
+		}
+
+		sorted := make([]*labels.Matcher, 0, len(ms))
+		sorted = append(sorted, m)
+		sorted = append(sorted, ms[:i]...)
+		sorted = append(sorted, ms[i+1:]...)
+		return sorted, (rng.End - rng.Start) * deferredPostingsFactor, nil
+	}
+	return ms, 0, nil
+}
+
+// postingsLargerThan returns true if the postings of the group take more than size bytes in the index.
+func (r *bucketIndexReader) postingsLargerThan(pg *postingGroup, size int64) (bool, error) {
+	var total int64
+	for _, keys := range [][]labels.Label{pg.addKeys, pg.removeKeys} {
+		for _, key := range keys {
+			rng, err := r.block.indexHeaderReader.PostingsOffset(key.Name, key.Value)
+			if err == indexheader.NotFoundRangeErr {
+				continue
+			}
+			if err != nil {
+				return false, errors.Wrap(err, "index header PostingsOffset")
+			}
+			if total += rng.End - rng.Start; total > size {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
 }
 
 // postingGroup keeps posting keys for single matcher. Logical result of the group is:
@@ -1982,7 +2473,7 @@ func (r *bucketIndexReader) fetchPostings(ctx context.Context, keys []labels.Lab
 	output := make([]index.Postings, len(keys))
 
 	// Fetch postings from the cache with a single call.
-	fromCache, _ := r.block.indexCache.FetchMultiPostings(ctx, r.block.meta.ULID, keys)
+	fromCache, _ := r.indexCache.FetchMultiPostings(ctx, r.block.meta.ULID, keys)
 
 	// Iterate over all groups and fetch posting from cache.
 	// If we have a miss, mark key to be fetched in `ptrs` slice.
@@ -2103,7 +2594,7 @@ func (r *bucketIndexReader) fetchPostings(ctx context.Context, keys []labels.Lab
 				// Truncate first 4 bytes which are length of posting.
 				output[p.keyID] = newBigEndianPostings(pBytes[4:])
 
-				r.block.indexCache.StorePostings(ctx, r.block.meta.ULID, keys[p.keyID], dataToCache)
+				r.indexCache.StorePostings(ctx, r.block.meta.ULID, keys[p.keyID], dataToCache)
 
 				// If we just fetched it we still have to update the stats for touched postings.
 				r.stats.postingsTouched++
@@ -2197,7 +2688,7 @@ func (r *bucketIndexReader) PreloadSeries(ctx context.Context, ids []storage.Ser
 
 	// Load series from cache, overwriting the list of ids to preload
 	// with the missing ones.
-	fromCache, ids := r.block.indexCache.FetchMultiSeries(ctx, r.block.meta.ULID, ids)
+	fromCache, ids := r.indexCache.FetchMultiSeries(ctx, r.block.meta.ULID, ids)
 	for id, b := range fromCache {
 		r.loadedSeries[id] = b
 	}
@@ -2254,7 +2745,7 @@ func (r *bucketIndexReader) loadSeries(ctx context.Context, ids []storage.Series
 		c = c[n : n+int(l)]
 		r.mtx.Lock()
 		r.loadedSeries[id] = c
-		r.block.indexCache.StoreSeries(ctx, r.block.meta.ULID, id, c)
+		r.indexCache.StoreSeries(ctx, r.block.meta.ULID, id, c)
 		r.mtx.Unlock()
 	}
 	return nil
@@ -2360,6 +2851,21 @@ func (r *bucketIndexReader) LookupLabelsSymbols(symbolized []symbolizedLabel, lb
 	return nil
 }
 
+// lookupSeriesLabels populates the label set of the series from the block's series labels cache if enabled,
+// falling back to looking up the symbols of the symbolized label set.
+func (r *bucketIndexReader) lookupSeriesLabels(ref storage.SeriesRef, symbolized []symbolizedLabel, lbls *labels.Labels) error {
+	if cached, ok := r.block.seriesLabels.get(ref); ok {
+		// The cached label set is copied as the buffer is modified afterwards.
+		*lbls = append((*lbls)[:0], cached...)
+		return nil
+	}
+	if err := r.LookupLabelsSymbols(symbolized, lbls); err != nil {
+		return err
+	}
+	r.block.seriesLabels.set(ref, *lbls)
+	return nil
+}
+
 // decodeSeriesForTime decodes a series entry from the given byte slice decoding only chunk metas that are within given min and max time.
 // If skipChunks is specified decodeSeriesForTime does not return any chunks, but only labels and only if at least single chunk is within time range.
 // decodeSeriesForTime returns false, when there are no series data for given time range.
@@ -2435,13 +2941,20 @@ type bucketChunkReader struct {
 	mtx        sync.Mutex
 	stats      *queryStats
 	chunkBytes []*[]byte // Byte slice to return to the chunk pool on close.
+
+	// memory tracks the chunk data held by the Series call the reader is used by.
+	memory *memoryTracker
+	// limiter enforces the request limits of the Series call the reader is used by.
+	limiter *requestLimiter
 }
 
-func newBucketChunkReader(block *bucketBlock) *bucketChunkReader {
+func newBucketChunkReader(block *bucketBlock, memory *memoryTracker, limiter *requestLimiter) *bucketChunkReader {
 	return &bucketChunkReader{
-		block:  block,
-		stats:  &queryStats{},
-		toLoad: make([][]loadIdx, len(block.chunkObjs)),
+		block:   block,
+		stats:   &queryStats{},
+		toLoad:  make([][]loadIdx, len(block.chunkObjs)),
+		memory:  memory,
+		limiter: limiter,
 	}
 }
 
@@ -2449,6 +2962,7 @@ func (r *bucketChunkReader) Close() error {
 	r.block.pendingReaders.Done()
 
 	for _, b := range r.chunkBytes {
+		r.memory.Release(uint64(cap(*b)))
 		r.block.chunkPool.Put(b)
 	}
 	return nil
@@ -2530,6 +3044,11 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		n        int
 	)
 
+	if err := r.memory.Reserve(EstimatedMaxChunkSize); err != nil {
+		return errors.Wrap(err, "allocate chunk read buffer")
+	}
+	defer r.memory.Release(EstimatedMaxChunkSize)
+
 	bufPooled, err := r.block.chunkPool.Get(EstimatedMaxChunkSize)
 	if err == nil {
 		buf = *bufPooled
@@ -2573,6 +3092,9 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		// There is also crc32 after the chunk, but we ignore that.
 		chunkLen = n + 1 + int(chunkDataLen)
 		if chunkLen <= len(cb) {
+			if err := r.reserveSamples(rawChunk(cb[n:chunkLen])); err != nil {
+				return err
+			}
 			err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), rawChunk(cb[n:chunkLen]), aggrs, r.save)
 			if err != nil {
 				return errors.Wrap(err, "populate chunk")
@@ -2590,11 +3112,16 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 
 		// Read entire chunk into new buffer.
 		// TODO: readChunkRange call could be avoided for any chunk but last in this particular part.
+		if err := r.memory.Reserve(uint64(chunkLen)); err != nil {
+			return errors.Wrap(err, "allocate chunk bytes")
+		}
 		nb, err := r.block.readChunkRange(ctx, seq, int64(pIdx.offset), int64(chunkLen), []byteRange{{offset: 0, length: chunkLen}})
 		if err != nil {
+			r.memory.Release(uint64(chunkLen))
 			return errors.Wrapf(err, "preloaded chunk too small, expecting %d, and failed to fetch full chunk", chunkLen)
 		}
 		if len(*nb) != chunkLen {
+			r.memory.Release(uint64(chunkLen))
 			return errors.Errorf("preloaded chunk too small, expecting %d", chunkLen)
 		}
 
@@ -2604,19 +3131,50 @@ func (r *bucketChunkReader) loadChunks(ctx context.Context, res []seriesEntry, a
 		r.stats.chunksFetchCount++
 		r.stats.ChunksFetchDurationSum += time.Since(fetchBegin)
 		r.stats.ChunksFetchedSizeSum += units.Base2Bytes(len(*nb))
-		err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), rawChunk((*nb)[n:]), aggrs, r.save)
+		err = r.reserveSamples(rawChunk((*nb)[n:]))
+		if err == nil {
+			err = populateChunk(&(res[pIdx.seriesEntry].chks[pIdx.chunk]), rawChunk((*nb)[n:]), aggrs, r.save)
+		}
+		r.block.chunkPool.Put(nb)
+		r.memory.Release(uint64(chunkLen))
 		if err != nil {
-			r.block.chunkPool.Put(nb)
 			return errors.Wrap(err, "populate chunk")
 		}
 		r.stats.chunksTouched++
 		r.stats.ChunksTouchedSizeSum += units.Base2Bytes(int(chunkDataLen))
-
-		r.block.chunkPool.Put(nb)
 	}
 	return nil
 }
 
+// reserveSamples reserves the samples of the chunk out of the samples limit of the request.
+func (r *bucketChunkReader) reserveSamples(c rawChunk) error {
+	if r.limiter == nil {
+		return nil
+	}
+	n, err := numSamples(c)
+	if err != nil {
+		return errors.Wrap(err, "read chunk samples")
+	}
+	return errors.Wrap(r.limiter.ReserveSamples(uint64(n)), "exceeded request samples limit")
+}
+
+// numSamples returns the number of samples of a raw chunk, which is the number of samples of its count aggregate for
+// downsampled chunks.
+func numSamples(c rawChunk) (int, error) {
+	if c.Encoding() == downsample.ChunkEncAggr {
+		x, err := downsample.AggrChunk(c.Bytes()).Get(downsample.AggrCount)
+		if err != nil {
+			return 0, err
+		}
+		return x.NumSamples(), nil
+	}
+	x, err := chunkenc.FromData(c.Encoding(), c.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return x.NumSamples(), nil
+}
+
 // save saves a copy of b's payload to a memory pool of its own and returns a new byte slice referencing said copy.
 // Returned slice becomes invalid once r.block.chunkPool.Put() is called.
 func (r *bucketChunkReader) save(b []byte) ([]byte, error) {
@@ -2627,6 +3185,10 @@ func (r *bucketChunkReader) save(b []byte) ([]byte, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "allocate chunk bytes")
 		}
+		if err := r.memory.Reserve(uint64(cap(*s))); err != nil {
+			r.block.chunkPool.Put(s)
+			return nil, errors.Wrap(err, "allocate chunk bytes")
+		}
 		r.chunkBytes = append(r.chunkBytes, s)
 	}
 	slab := r.chunkBytes[len(r.chunkBytes)-1]
@@ -0,0 +1,101 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// blockStatsCollector is a metric collector reporting statistics of the largest blocks loaded by the BucketStore.
+// A Collector is required as the reported blocks change with every sync.
+type blockStatsCollector struct {
+	store *BucketStore
+	topN  int
+
+	seriesDesc  *prometheus.Desc
+	chunksDesc  *prometheus.Desc
+	sizeDesc    *prometheus.Desc
+	minTimeDesc *prometheus.Desc
+	maxTimeDesc *prometheus.Desc
+
+	lastQueriedDesc *prometheus.Desc
+}
+
+func newBlockStatsCollector(s *BucketStore, topN int) *blockStatsCollector {
+	lbls := []string{"block", "resolution"}
+	return &blockStatsCollector{
+		store: s,
+		topN:  topN,
+
+		seriesDesc:  prometheus.NewDesc("thanos_bucket_store_block_series", "Number of series in the loaded block.", lbls, nil),
+		chunksDesc:  prometheus.NewDesc("thanos_bucket_store_block_chunks", "Number of chunks in the loaded block.", lbls, nil),
+		sizeDesc:    prometheus.NewDesc("thanos_bucket_store_block_size_bytes", "Size of the files of the loaded block, if known from its meta.json.", lbls, nil),
+		minTimeDesc: prometheus.NewDesc("thanos_bucket_store_block_min_time_seconds", "Minimum time of the loaded block.", lbls, nil),
+		maxTimeDesc: prometheus.NewDesc("thanos_bucket_store_block_max_time_seconds", "Maximum time of the loaded block.", lbls, nil),
+
+		lastQueriedDesc: prometheus.NewDesc("thanos_bucket_store_block_last_queried_timestamp_seconds", "Time the loaded block was last queried at, 0 if it wasn't queried since it was loaded.", lbls, nil),
+	}
+}
+
+func (c *blockStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.seriesDesc
+	ch <- c.chunksDesc
+	ch <- c.sizeDesc
+	ch <- c.minTimeDesc
+	ch <- c.maxTimeDesc
+	ch <- c.lastQueriedDesc
+}
+
+func (c *blockStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, b := range c.largestBlocks() {
+		m := b.meta
+		lbls := []string{m.ULID.String(), strconv.FormatInt(m.Thanos.Downsample.Resolution, 10)}
+		ch <- prometheus.MustNewConstMetric(c.seriesDesc, prometheus.GaugeValue, float64(m.Stats.NumSeries), lbls...)
+		ch <- prometheus.MustNewConstMetric(c.chunksDesc, prometheus.GaugeValue, float64(m.Stats.NumChunks), lbls...)
+		ch <- prometheus.MustNewConstMetric(c.sizeDesc, prometheus.GaugeValue, float64(blockSize(m)), lbls...)
+		ch <- prometheus.MustNewConstMetric(c.minTimeDesc, prometheus.GaugeValue, float64(m.MinTime)/1000, lbls...)
+		ch <- prometheus.MustNewConstMetric(c.maxTimeDesc, prometheus.GaugeValue, float64(m.MaxTime)/1000, lbls...)
+		ch <- prometheus.MustNewConstMetric(c.lastQueriedDesc, prometheus.GaugeValue, float64(b.lastQueried.Load())/1000, lbls...)
+	}
+}
+
+// largestBlocks returns the topN loaded blocks with the biggest size, or the most series if sizes are equal.
+func (c *blockStatsCollector) largestBlocks() []*bucketBlock {
+	c.store.mtx.RLock()
+	blocks := make([]*bucketBlock, 0, len(c.store.blocks))
+	for _, b := range c.store.blocks {
+		blocks = append(blocks, b)
+	}
+	c.store.mtx.RUnlock()
+
+	sort.Slice(blocks, func(i, j int) bool {
+		mi, mj := blocks[i].meta, blocks[j].meta
+		if si, sj := blockSize(mi), blockSize(mj); si != sj {
+			return si > sj
+		}
+		if mi.Stats.NumSeries != mj.Stats.NumSeries {
+			return mi.Stats.NumSeries > mj.Stats.NumSeries
+		}
+		return mi.ULID.Compare(mj.ULID) < 0
+	})
+	if len(blocks) > c.topN {
+		blocks = blocks[:c.topN]
+	}
+	return blocks
+}
+
+// blockSize returns the total size of the block files listed in the meta. It's 0 for blocks
+// uploaded by older versions, which don't record files.
+func blockSize(m *metadata.Meta) int64 {
+	var size int64
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
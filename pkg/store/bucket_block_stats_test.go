@@ -0,0 +1,79 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestBlockStatsCollector(t *testing.T) {
+	newMeta := func(id string, series, chunks uint64, resolution int64, sizes ...int64) *metadata.Meta {
+		m := &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustParse(id),
+				MinTime: 1000,
+				MaxTime: 7201000,
+				Stats:   tsdb.BlockStats{NumSeries: series, NumChunks: chunks},
+			},
+			Thanos: metadata.Thanos{Downsample: metadata.ThanosDownsample{Resolution: resolution}},
+		}
+		for _, s := range sizes {
+			m.Thanos.Files = append(m.Thanos.Files, metadata.File{SizeBytes: s})
+		}
+		return m
+	}
+
+	s := &BucketStore{blocks: map[ulid.ULID]*bucketBlock{}}
+	for _, m := range []*metadata.Meta{
+		newMeta("01FZ0000000000000000000001", 100, 200, 0, 1000, 24),
+		newMeta("01FZ0000000000000000000002", 50, 100, 300000, 512),
+		// Blocks without recorded files are ranked by the number of series.
+		newMeta("01FZ0000000000000000000003", 10, 10, 0),
+		newMeta("01FZ0000000000000000000004", 20, 10, 0),
+	} {
+		s.blocks[m.ULID] = &bucketBlock{meta: m}
+	}
+	s.blocks[ulid.MustParse("01FZ0000000000000000000002")].lastQueried.Store(1650000000500)
+
+	testutil.Ok(t, promtest.CollectAndCompare(newBlockStatsCollector(s, 3), strings.NewReader(`
+# HELP thanos_bucket_store_block_chunks Number of chunks in the loaded block.
+# TYPE thanos_bucket_store_block_chunks gauge
+thanos_bucket_store_block_chunks{block="01FZ0000000000000000000001",resolution="0"} 200
+thanos_bucket_store_block_chunks{block="01FZ0000000000000000000002",resolution="300000"} 100
+thanos_bucket_store_block_chunks{block="01FZ0000000000000000000004",resolution="0"} 10
+# HELP thanos_bucket_store_block_last_queried_timestamp_seconds Time the loaded block was last queried at, 0 if it wasn't queried since it was loaded.
+# TYPE thanos_bucket_store_block_last_queried_timestamp_seconds gauge
+thanos_bucket_store_block_last_queried_timestamp_seconds{block="01FZ0000000000000000000001",resolution="0"} 0
+thanos_bucket_store_block_last_queried_timestamp_seconds{block="01FZ0000000000000000000002",resolution="300000"} 1.6500000005e+09
+thanos_bucket_store_block_last_queried_timestamp_seconds{block="01FZ0000000000000000000004",resolution="0"} 0
+# HELP thanos_bucket_store_block_max_time_seconds Maximum time of the loaded block.
+# TYPE thanos_bucket_store_block_max_time_seconds gauge
+thanos_bucket_store_block_max_time_seconds{block="01FZ0000000000000000000001",resolution="0"} 7201
+thanos_bucket_store_block_max_time_seconds{block="01FZ0000000000000000000002",resolution="300000"} 7201
+thanos_bucket_store_block_max_time_seconds{block="01FZ0000000000000000000004",resolution="0"} 7201
+# HELP thanos_bucket_store_block_min_time_seconds Minimum time of the loaded block.
+# TYPE thanos_bucket_store_block_min_time_seconds gauge
+thanos_bucket_store_block_min_time_seconds{block="01FZ0000000000000000000001",resolution="0"} 1
+thanos_bucket_store_block_min_time_seconds{block="01FZ0000000000000000000002",resolution="300000"} 1
+thanos_bucket_store_block_min_time_seconds{block="01FZ0000000000000000000004",resolution="0"} 1
+# HELP thanos_bucket_store_block_series Number of series in the loaded block.
+# TYPE thanos_bucket_store_block_series gauge
+thanos_bucket_store_block_series{block="01FZ0000000000000000000001",resolution="0"} 100
+thanos_bucket_store_block_series{block="01FZ0000000000000000000002",resolution="300000"} 50
+thanos_bucket_store_block_series{block="01FZ0000000000000000000004",resolution="0"} 20
+# HELP thanos_bucket_store_block_size_bytes Size of the files of the loaded block, if known from its meta.json.
+# TYPE thanos_bucket_store_block_size_bytes gauge
+thanos_bucket_store_block_size_bytes{block="01FZ0000000000000000000001",resolution="0"} 1024
+thanos_bucket_store_block_size_bytes{block="01FZ0000000000000000000002",resolution="300000"} 512
+thanos_bucket_store_block_size_bytes{block="01FZ0000000000000000000004",resolution="0"} 0
+`)))
+}
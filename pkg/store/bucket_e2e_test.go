@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,16 +18,20 @@ import (
 	"github.com/gogo/status"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/weaveworks/common/httpgrpc"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	grpcmeta "google.golang.org/grpc/metadata"
 
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/objtesting"
@@ -521,6 +526,101 @@ func TestBucketStore_e2e(t *testing.T) {
 	})
 }
 
+func TestBucketStore_IndexCacheWarmup_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucket_index_cache_warmup_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+
+	indexCache, err := storecache.NewInMemoryIndexCacheWithConfig(s.logger, nil, storecache.DefaultInMemoryIndexCacheConfig)
+	testutil.Ok(t, err)
+	s.cache.SwapWith(indexCache)
+
+	// Blocks with the ext2 external label don't match and are skipped.
+	WithIndexCacheWarmupMatchers([][]*labels.Matcher{{
+		labels.MustNewMatcher(labels.MatchEqual, "a", "1"),
+		labels.MustNewMatcher(labels.MatchNotEqual, "ext2", "value2"),
+	}})(s.store)
+	testutil.Ok(t, s.store.InitialSync(ctx))
+
+	key := labels.Label{Name: "a", Value: "1"}
+	warmed := 0
+	for id, b := range s.store.blocks {
+		hits, _ := indexCache.FetchMultiPostings(ctx, id, []labels.Label{key})
+		if labels.Equal(b.extLset, labels.FromStrings("ext2", "value2")) {
+			testutil.Equals(t, 0, len(hits))
+			continue
+		}
+		testutil.Equals(t, 1, len(hits))
+		warmed++
+
+		indexr := b.indexReader()
+		ps, err := indexr.ExpandedPostings(ctx, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")})
+		testutil.Ok(t, err)
+		testutil.Ok(t, indexr.Close())
+		testutil.Equals(t, 2, len(ps))
+
+		series, misses := indexCache.FetchMultiSeries(ctx, id, ps)
+		testutil.Equals(t, 2, len(series))
+		testutil.Equals(t, 0, len(misses))
+	}
+	testutil.Equals(t, 3, warmed)
+}
+
+func TestBucketStore_NoCache_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucket_no_cache_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime: s.minTime,
+		MaxTime: s.maxTime,
+		NoCache: true,
+	}
+	cachedPostings := func(indexCache storecache.IndexCache) (n int) {
+		for id := range s.store.blocks {
+			hits, _ := indexCache.FetchMultiPostings(ctx, id, []labels.Label{{Name: "a", Value: "1"}})
+			n += len(hits)
+		}
+		return n
+	}
+
+	for _, tcase := range []struct {
+		name           string
+		enableNoCache  bool
+		expectedCached int
+	}{
+		{name: "no_cache requests disabled, cache is used", enableNoCache: false, expectedCached: len(s.store.blocks)},
+		{name: "no_cache requests enabled, cache is bypassed", enableNoCache: true, expectedCached: 0},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			indexCache, err := storecache.NewInMemoryIndexCacheWithConfig(s.logger, nil, storecache.DefaultInMemoryIndexCacheConfig)
+			testutil.Ok(t, err)
+			s.cache.SwapWith(indexCache)
+			WithNoCacheRequests(tcase.enableNoCache)(s.store)
+
+			srv := newStoreSeriesServer(ctx)
+			testutil.Ok(t, s.store.Series(req, srv))
+			testutil.Equals(t, 4, len(srv.SeriesSet))
+			testutil.Equals(t, tcase.expectedCached, cachedPostings(indexCache))
+		})
+	}
+}
+
 type naivePartitioner struct{}
 
 func (g naivePartitioner) Partition(length int, rng func(int) (uint64, uint64)) (parts []Part) {
@@ -680,6 +780,259 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_MemoryBudget_e2e(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		budget      uint64
+		expectedErr bool
+	}{
+		"should succeed without a budget": {},
+		"should succeed if the budget is not exceeded": {
+			budget: 100 * EstimatedMaxChunkSize,
+		},
+		"should fail if the budget is exceeded": {
+			// Fits the read buffer of a single part, but not the chunks read with it.
+			budget:      EstimatedMaxChunkSize,
+			expectedErr: true,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			bkt := objstore.NewInMemBucket()
+
+			dir, err := ioutil.TempDir("", "test_bucket_memory_budget_e2e")
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+			s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+			testutil.Ok(t, s.store.SyncBlocks(ctx))
+			s.store.seriesMemoryBudget = testData.budget
+
+			req := &storepb.SeriesRequest{
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				},
+				MinTime: minTimeDuration.PrometheusTimestamp(),
+				MaxTime: maxTimeDuration.PrometheusTimestamp(),
+			}
+
+			s.cache.SwapWith(noopCache{})
+			srv := newStoreSeriesServer(ctx)
+			err = s.store.Series(req, srv)
+
+			if !testData.expectedErr {
+				testutil.Ok(t, err)
+				testutil.Equals(t, 4, len(srv.SeriesSet))
+				testutil.Equals(t, float64(0), promtest.ToFloat64(s.store.metrics.queriesDropped.WithLabelValues("memory")))
+				return
+			}
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.Contains(err.Error(), "memory budget"), "unexpected error: %v", err)
+			status, ok := status.FromError(err)
+			testutil.Equals(t, true, ok)
+			testutil.Equals(t, codes.ResourceExhausted, status.Code())
+			testutil.Equals(t, float64(1), promtest.ToFloat64(s.store.metrics.queriesDropped.WithLabelValues("memory")))
+		})
+	}
+}
+
+func TestBucketStore_Series_RequestLimits_e2e(t *testing.T) {
+	const limitsConfig = `
+tenants:
+  unlimited:
+    request_series: 0
+    request_samples: 0
+  limited:
+    request_series: 1
+`
+	for testName, testData := range map[string]struct {
+		limits         RequestLimits
+		tenant         string
+		expectedReason string
+	}{
+		"should succeed without limits": {},
+		"should succeed if the limits are not exceeded": {
+			limits: RequestLimits{Series: 100, Samples: 100000},
+		},
+		"should fail if the series limit is exceeded": {
+			limits:         RequestLimits{Series: 1},
+			expectedReason: "series",
+		},
+		"should fail if the samples limit is exceeded": {
+			limits:         RequestLimits{Samples: 1},
+			expectedReason: "samples",
+		},
+		"should succeed if the limits are overridden for the tenant": {
+			limits: RequestLimits{Series: 1, Samples: 1},
+			tenant: "unlimited",
+		},
+		"should fail if the limits of the tenant are exceeded": {
+			tenant:         "limited",
+			expectedReason: "series",
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			bkt := objstore.NewInMemBucket()
+
+			dir, err := ioutil.TempDir("", "test_bucket_request_limits_e2e")
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+			s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+			testutil.Ok(t, s.store.SyncBlocks(ctx))
+			s.store.requestLimits, err = ParseTenantRequestLimits(testData.limits, []byte(limitsConfig))
+			testutil.Ok(t, err)
+
+			req := &storepb.SeriesRequest{
+				Matchers: []storepb.LabelMatcher{
+					{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+				},
+				MinTime: minTimeDuration.PrometheusTimestamp(),
+				MaxTime: maxTimeDuration.PrometheusTimestamp(),
+			}
+
+			s.cache.SwapWith(noopCache{})
+			if testData.tenant != "" {
+				ctx = grpcmeta.NewIncomingContext(ctx, grpcmeta.Pairs(TenantGRPCMetadataKey, testData.tenant))
+			}
+			srv := newStoreSeriesServer(ctx)
+			err = s.store.Series(req, srv)
+
+			if testData.expectedReason == "" {
+				testutil.Ok(t, err)
+				testutil.Equals(t, 4, len(srv.SeriesSet))
+				return
+			}
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.Contains(err.Error(), "exceeded request "+testData.expectedReason+" limit"), "unexpected error: %v", err)
+			status, ok := status.FromError(err)
+			testutil.Equals(t, true, ok)
+			testutil.Equals(t, codes.ResourceExhausted, status.Code())
+			testutil.Equals(t, float64(1), promtest.ToFloat64(s.store.metrics.queriesLimited.WithLabelValues(testData.expectedReason)))
+		})
+	}
+}
+
+func TestProxyStore_Series_TenantRequestLimits_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_proxy_tenant_request_limits_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	testutil.Ok(t, s.store.SyncBlocks(ctx))
+	s.store.requestLimits, err = ParseTenantRequestLimits(RequestLimits{}, []byte("tenants: {limited: {request_series: 1}}"))
+	testutil.Ok(t, err)
+	s.cache.SwapWith(noopCache{})
+
+	// The bucket store is queried through gRPC, so the tenant has to be sent as gRPC metadata.
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, s.store)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, cc.Close()) }()
+
+	proxy := NewProxyStore(nil, nil, func() []Client {
+		return []Client{testClient{
+			StoreClient: storepb.NewStoreClient(cc),
+			labelSets:   []labels.Labels{labels.FromStrings("ext1", "value1")},
+			minTime:     s.minTime,
+			maxTime:     s.maxTime,
+		}}
+	}, component.Query, nil, 0)
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime:                 minTimeDuration.PrometheusTimestamp(),
+		MaxTime:                 maxTimeDuration.PrometheusTimestamp(),
+		PartialResponseDisabled: true,
+	}
+
+	t.Run("tenant without limits", func(t *testing.T) {
+		srv := newStoreSeriesServer(context.WithValue(ctx, TenantKey, "unlimited"))
+		testutil.Ok(t, proxy.Series(req, srv))
+		testutil.Equals(t, 4, len(srv.SeriesSet))
+	})
+
+	for name, ctx := range map[string]context.Context{
+		"tenant set in the context":           context.WithValue(ctx, TenantKey, "limited"),
+		"tenant of the incoming gRPC request": grpcmeta.NewIncomingContext(ctx, grpcmeta.Pairs(TenantGRPCMetadataKey, "limited")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := proxy.Series(req, newStoreSeriesServer(ctx))
+			testutil.NotOk(t, err)
+			testutil.Assert(t, strings.Contains(err.Error(), "exceeded request series limit"), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestBucketStore_BlockLastQueried_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucket_block_last_queried_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	s.cache.SwapWith(noopCache{})
+
+	lastQueried := func() map[ulid.ULID]int64 {
+		s.store.mtx.RLock()
+		defer s.store.mtx.RUnlock()
+		res := map[ulid.ULID]int64{}
+		for id, b := range s.store.blocks {
+			res[id] = b.lastQueried.Load()
+		}
+		return res
+	}
+	for _, ts := range lastQueried() {
+		testutil.Equals(t, int64(0), ts)
+	}
+
+	// Only the blocks of the first time slot are queried.
+	before := timestamp.FromTime(time.Now())
+	srv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.store.Series(&storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+		MinTime:  s.minTime,
+		MaxTime:  s.minTime + time.Hour.Milliseconds(),
+	}, srv))
+	testutil.Equals(t, 4, len(srv.SeriesSet))
+	after := timestamp.FromTime(time.Now())
+
+	var queried int
+	for id, ts := range lastQueried() {
+		if s.store.blocks[id].meta.MinTime > s.minTime {
+			testutil.Equals(t, int64(0), ts)
+			continue
+		}
+		testutil.Assert(t, ts >= before && ts <= after, "block %s last queried at %d, not within [%d, %d]", id, ts, before, after)
+		queried++
+	}
+	testutil.Equals(t, 2, queried)
+
+	// Label requests query blocks too.
+	_, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{Start: s.minTime, End: s.maxTime})
+	testutil.Ok(t, err)
+	for id, ts := range lastQueried() {
+		testutil.Assert(t, ts >= before, "block %s not marked as queried", id)
+	}
+}
+
 func TestBucketStore_LabelNames_e2e(t *testing.T) {
 	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -757,6 +1110,20 @@ func TestBucketStore_LabelNames_e2e(t *testing.T) {
 				},
 				expected: []string{"a", "c", "ext2"},
 			},
+			"ext2=value2 matcher": {
+				req: &storepb.LabelNamesRequest{
+					Start: timestamp.FromTime(minTime),
+					End:   timestamp.FromTime(maxTime),
+					Matchers: []storepb.LabelMatcher{
+						{
+							Type:  storepb.LabelMatcher_EQ,
+							Name:  "ext2",
+							Value: "value2",
+						},
+					},
+				},
+				expected: []string{"a", "c", "ext2"},
+			},
 			"outside the time range, with matcher": {
 				req: &storepb.LabelNamesRequest{
 					Start: timestamp.FromTime(time.Now().Add(-24 * time.Hour)),
@@ -876,6 +1243,57 @@ func TestBucketStore_LabelValues_e2e(t *testing.T) {
 				},
 				expected: nil, // ext1 is replaced with ext2 for series with c
 			},
+			// External labels aren't part of the block index, so they need to be resolved from block metadata.
+			"label ext1, a=1": {
+				req: &storepb.LabelValuesRequest{
+					Label: "ext1",
+					Start: timestamp.FromTime(minTime),
+					End:   timestamp.FromTime(maxTime),
+					Matchers: []storepb.LabelMatcher{
+						{
+							Type:  storepb.LabelMatcher_EQ,
+							Name:  "a",
+							Value: "1",
+						},
+					},
+				},
+				expected: []string{"value1"},
+			},
+			"label ext2, c=1": {
+				req: &storepb.LabelValuesRequest{
+					Label: "ext2",
+					Start: timestamp.FromTime(minTime),
+					End:   timestamp.FromTime(maxTime),
+					Matchers: []storepb.LabelMatcher{
+						{
+							Type:  storepb.LabelMatcher_EQ,
+							Name:  "c",
+							Value: "1",
+						},
+					},
+				},
+				expected: []string{"value2"},
+			},
+			"label a, ext2=value2": {
+				req: &storepb.LabelValuesRequest{
+					Label: "a",
+					Start: timestamp.FromTime(minTime),
+					End:   timestamp.FromTime(maxTime),
+					Matchers: []storepb.LabelMatcher{
+						{
+							Type:  storepb.LabelMatcher_EQ,
+							Name:  "ext2",
+							Value: "value2",
+						},
+						{
+							Type:  storepb.LabelMatcher_EQ,
+							Name:  "c",
+							Value: "2",
+						},
+					},
+				},
+				expected: []string{"1", "2"},
+			},
 		} {
 			t.Run(name, func(t *testing.T) {
 				vals, err := s.store.LabelValues(ctx, tc.req)
@@ -887,6 +1305,131 @@ func TestBucketStore_LabelValues_e2e(t *testing.T) {
 	})
 }
 
+func TestBucketStore_LabelsCache_e2e(t *testing.T) {
+	objtesting.ForeachStore(t, func(t *testing.T, bkt objstore.Bucket) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dir, err := ioutil.TempDir("", "test_bucketstore_labels_cache_e2e")
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+		s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+		s.cache.SwapWith(noopCache{})
+
+		now := time.Now()
+		s.store.labelsCache, err = newLabelsCache(nil, time.Minute, 100)
+		testutil.Ok(t, err)
+		s.store.labelsCache.now = func() time.Time { return now }
+
+		hits := func(typ string) float64 { return promtest.ToFloat64(s.store.labelsCache.hits.WithLabelValues(typ)) }
+		requests := func(typ string) float64 { return promtest.ToFloat64(s.store.labelsCache.requests.WithLabelValues(typ)) }
+
+		a1 := []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}}
+		for _, tc := range []struct {
+			name     string
+			req      *storepb.LabelValuesRequest
+			expected []string
+		}{
+			{
+				name:     "existing label",
+				req:      &storepb.LabelValuesRequest{Label: "b", Start: timestamp.FromTime(minTime), End: timestamp.FromTime(maxTime), Matchers: a1},
+				expected: []string{"1", "2"},
+			},
+			{
+				name:     "missing label",
+				req:      &storepb.LabelValuesRequest{Label: "missing", Start: timestamp.FromTime(minTime), End: timestamp.FromTime(maxTime), Matchers: a1},
+				expected: nil,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				hitsBefore, requestsBefore := hits(labelsCacheTypeValues), requests(labelsCacheTypeValues)
+
+				vals, err := s.store.LabelValues(ctx, tc.req)
+				testutil.Ok(t, err)
+				testutil.Equals(t, tc.expected, emptyToNil(vals.Values))
+				testutil.Equals(t, hitsBefore, hits(labelsCacheTypeValues))
+				blockRequests := requests(labelsCacheTypeValues) - requestsBefore
+				testutil.Assert(t, blockRequests > 0)
+
+				// Served from the cache, including the empty results of the missing label.
+				vals, err = s.store.LabelValues(ctx, tc.req)
+				testutil.Ok(t, err)
+				testutil.Equals(t, tc.expected, emptyToNil(vals.Values))
+				testutil.Equals(t, hitsBefore+blockRequests, hits(labelsCacheTypeValues))
+			})
+		}
+
+		namesReq := &storepb.LabelNamesRequest{Start: timestamp.FromTime(minTime), End: timestamp.FromTime(maxTime), Matchers: a1}
+		names, err := s.store.LabelNames(ctx, namesReq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "b", "c", "ext1", "ext2"}, names.Names)
+		testutil.Equals(t, float64(0), hits(labelsCacheTypeNames))
+
+		names, err = s.store.LabelNames(ctx, namesReq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "b", "c", "ext1", "ext2"}, names.Names)
+		testutil.Equals(t, requests(labelsCacheTypeNames)/2, hits(labelsCacheTypeNames))
+
+		// Results of removed blocks are dropped.
+		cached := s.store.labelsCache.lru.Len()
+		for id := range s.store.blocks {
+			testutil.Ok(t, s.store.removeBlock(id))
+			break
+		}
+		testutil.Assert(t, s.store.labelsCache.lru.Len() < cached, "expected results of the removed block to be dropped")
+
+		// Results expire after the TTL.
+		now = now.Add(time.Minute)
+		hitsBefore := hits(labelsCacheTypeNames)
+		names, err = s.store.LabelNames(ctx, namesReq)
+		testutil.Ok(t, err)
+		testutil.Equals(t, []string{"a", "b", "c", "ext1", "ext2"}, names.Names)
+		testutil.Equals(t, hitsBefore, hits(labelsCacheTypeNames))
+	})
+}
+
+func TestBucketStore_SeriesLabelsCache_e2e(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bkt := objstore.NewInMemBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucketstore_series_labels_cache_e2e")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	s := prepareStoreWithTestBlocks(t, dir, bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0), emptyRelabelConfig, allowAllFilterConf)
+	s.cache.SwapWith(noopCache{})
+
+	metrics := newSeriesLabelsCacheMetrics(nil)
+	for _, b := range s.store.blocks {
+		b.seriesLabels, err = newSeriesLabelsCache(100, metrics)
+		testutil.Ok(t, err)
+	}
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime: minTimeDuration.PrometheusTimestamp(),
+		MaxTime: maxTimeDuration.PrometheusTimestamp(),
+	}
+
+	srv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.store.Series(req, srv))
+	testutil.Equals(t, 4, len(srv.SeriesSet))
+	testutil.Equals(t, float64(0), promtest.ToFloat64(metrics.hits))
+	misses := promtest.ToFloat64(metrics.misses)
+	testutil.Assert(t, misses > 0)
+
+	// The repeated query reuses the decoded label sets of all series.
+	cachedSrv := newStoreSeriesServer(ctx)
+	testutil.Ok(t, s.store.Series(req, cachedSrv))
+	testutil.Equals(t, srv.SeriesSet, cachedSrv.SeriesSet)
+	testutil.Equals(t, misses, promtest.ToFloat64(metrics.hits))
+	testutil.Equals(t, misses, promtest.ToFloat64(metrics.misses))
+}
+
 func emptyToNil(values []string) []string {
 	if len(values) == 0 {
 		return nil
@@ -32,9 +32,13 @@ import (
 	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
 	"go.uber.org/atomic"
 
@@ -43,6 +47,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/dedup"
 	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/filesystem"
@@ -969,6 +974,7 @@ func TestReadIndexCache_LoadSeries(t *testing.T) {
 	r := bucketIndexReader{
 		block:        b,
 		stats:        &queryStats{},
+		indexCache:   b.indexCache,
 		loadedSeries: map[storage.SeriesRef][]byte{},
 	}
 
@@ -1048,6 +1054,10 @@ func BenchmarkBucketIndexReader_ExpandedPostings(b *testing.B) {
 }
 
 func uploadTestBlock(t testing.TB, tmpDir string, bkt objstore.Bucket, series int) ulid.ULID {
+	return uploadTestBlockWithData(t, tmpDir, bkt, func(app storage.Appender) { appendTestData(t, app, series) })
+}
+
+func uploadTestBlockWithData(t testing.TB, tmpDir string, bkt objstore.Bucket, appendData func(app storage.Appender)) ulid.ULID {
 	headOpts := tsdb.DefaultHeadOptions()
 	headOpts.ChunkDirRoot = tmpDir
 	headOpts.ChunkRange = 1000
@@ -1059,7 +1069,7 @@ func uploadTestBlock(t testing.TB, tmpDir string, bkt objstore.Bucket, series in
 
 	logger := log.NewNopLogger()
 
-	appendTestData(t, h.Appender(context.Background()), series)
+	appendData(h.Appender(context.Background()))
 
 	testutil.Ok(t, os.MkdirAll(filepath.Join(tmpDir, "tmp"), os.ModePerm))
 	id := createBlockFromHead(t, filepath.Join(tmpDir, "tmp"), h)
@@ -1182,6 +1192,308 @@ func benchmarkExpandedPostings(
 	}
 }
 
+// appendMetricNameTestData appends series of a "common" metric and of a "rare" one, with 1% as many series,
+// all with a high cardinality "pod" label.
+func appendMetricNameTestData(t testing.TB, app storage.Appender, series int) {
+	for i := 0; i < series; i++ {
+		pod, j := strconv.Itoa(i)+storetestutil.LabelLongSuffix, "foo"
+		if i%2 == 1 {
+			j = "bar"
+		}
+		_, err := app.Append(0, labels.FromStrings(labels.MetricName, "common", "pod", pod, "j", j), 0, 0)
+		testutil.Ok(t, err)
+		if i%100 == 0 {
+			_, err = app.Append(0, labels.FromStrings(labels.MetricName, "rare", "pod", pod, "j", j), 0, 0)
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+}
+
+// selectSeriesLabels returns the labels of the series of the block matching the matchers, the way blockSeries
+// selects them, with the postings of the metric name looked up first or not.
+func selectSeriesLabels(t testutil.TB, b *bucketBlock, ms []*labels.Matcher, nameFirst bool) ([]labels.Labels, *queryStats) {
+	ctx := context.Background()
+	indexr := newBucketIndexReader(b)
+
+	ps, deferred, err := indexr.expandedPostings(ctx, ms, nameFirst)
+	testutil.Ok(t, err)
+	testutil.Ok(t, indexr.PreloadSeries(ctx, ps))
+
+	var (
+		res            []labels.Labels
+		symbolizedLset []symbolizedLabel
+		chks           []chunks.Meta
+	)
+	for _, id := range ps {
+		ok, err := indexr.LoadSeriesForTime(id, &symbolizedLset, &chks, true, math.MinInt64, math.MaxInt64)
+		testutil.Ok(t, err)
+		testutil.Assert(t, ok)
+
+		var lset labels.Labels
+		testutil.Ok(t, indexr.LookupLabelsSymbols(symbolizedLset, &lset))
+		if matchesLabels(deferred, lset) {
+			res = append(res, lset)
+		}
+	}
+	return res, indexr.stats
+}
+
+func prepareMetricNameTestBlock(t testutil.TB, series int) (*bucketBlock, func()) {
+	tmpDir, err := ioutil.TempDir("", "test-metric-name-postings")
+	testutil.Ok(t, err)
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	testutil.Ok(t, err)
+
+	id := uploadTestBlockWithData(t, tmpDir, bkt, func(app storage.Appender) { appendMetricNameTestData(t, app, series) })
+	r, err := indexheader.NewBinaryReader(context.Background(), log.NewNopLogger(), bkt, tmpDir, id, DefaultPostingOffsetInMemorySampling)
+	testutil.Ok(t, err)
+
+	b := &bucketBlock{
+		logger:            log.NewNopLogger(),
+		metrics:           newBucketStoreMetrics(nil),
+		indexHeaderReader: r,
+		indexCache:        noopCache{},
+		bkt:               bkt,
+		meta:              &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id}},
+		partitioner:       NewGapBasedPartitioner(PartitionerMaxGapSize),
+	}
+	return b, func() {
+		testutil.Ok(t, r.Close())
+		testutil.Ok(t, bkt.Close())
+		testutil.Ok(t, os.RemoveAll(tmpDir))
+	}
+}
+
+var metricNamePostingsCases = []struct {
+	name     string
+	matchers []*labels.Matcher
+
+	// Number of selected series for 1000 series of the common metric.
+	expectedLen int
+	// Whether postings of matchers other than the metric name are deferred.
+	deferred bool
+}{
+	{`{__name__="rare"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+	}, 10, false},
+	{`{pod=~".+",__name__="rare"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", ".+"),
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+	}, 10, true},
+	{`{__name__="rare",pod=~"1.+",j="foo"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+		labels.MustNewMatcher(labels.MatchEqual, "j", "foo"),
+	}, 1, true},
+	{`{__name__="rare",pod!="0` + storetestutil.LabelLongSuffix + `"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchNotEqual, "pod", "0"+storetestutil.LabelLongSuffix),
+	}, 9, false},
+	{`{__name__="common",j="foo"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "common"),
+		labels.MustNewMatcher(labels.MatchEqual, "j", "foo"),
+	}, 500, false},
+	{`{__name__="rare",pod="missing"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchEqual, "pod", "missing"),
+	}, 0, false},
+	{`{__name__="missing",pod=~".+"}`, []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "missing"),
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", ".+"),
+	}, 0, false},
+}
+
+func TestBucketIndexReader_ExpandedPostings_MetricNameFirst(t *testing.T) {
+	tb := testutil.NewTB(t)
+	b, cleanup := prepareMetricNameTestBlock(tb, 1000)
+	defer cleanup()
+
+	for _, c := range metricNamePostingsCases {
+		t.Run(c.name, func(t *testing.T) {
+			tb := testutil.NewTB(t)
+
+			expected, allStats := selectSeriesLabels(tb, b, c.matchers, false)
+			testutil.Equals(t, c.expectedLen, len(expected))
+
+			got, nameFirstStats := selectSeriesLabels(tb, b, c.matchers, true)
+			testutil.Equals(t, expected, got)
+
+			_, deferred, err := newBucketIndexReader(b).expandedPostings(context.Background(), c.matchers, true)
+			testutil.Ok(t, err)
+			testutil.Equals(t, c.deferred, len(deferred) > 0)
+			if c.deferred {
+				testutil.Assert(t, nameFirstStats.PostingsFetchedSizeSum < allStats.PostingsFetchedSizeSum,
+					"expected fewer postings bytes fetched, got %v, without deferring %v", nameFirstStats.PostingsFetchedSizeSum, allStats.PostingsFetchedSizeSum)
+			}
+		})
+	}
+}
+
+func TestBucketIndexReader_ExpandedPostings_LazyRegex(t *testing.T) {
+	tb := testutil.NewTB(t)
+	b, cleanup := prepareMetricNameTestBlock(tb, 1000)
+	defer cleanup()
+
+	expand := func(t *testing.T, ms []*labels.Matcher, strategy PostingsStrategy) ([]storage.SeriesRef, *queryStats) {
+		b.postingsStrategy = strategy
+		indexr := newBucketIndexReader(b)
+		ps, err := indexr.ExpandedPostings(context.Background(), ms)
+		testutil.Ok(t, err)
+		return ps, indexr.stats
+	}
+
+	cases := append(metricNamePostingsCases[:len(metricNamePostingsCases):len(metricNamePostingsCases)], []struct {
+		name        string
+		matchers    []*labels.Matcher
+		expectedLen int
+		deferred    bool
+	}{
+		{`{pod=~"1.+"}`, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+		}, 112, false},
+		{`{__name__="common",pod=~"1.+",pod=~".*0.+"}`, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "common"),
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", ".*0.+"),
+		}, 20, false},
+	}...)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected, _ := expand(t, c.matchers, EagerPostings)
+			testutil.Equals(t, c.expectedLen, len(expected))
+
+			got, _ := expand(t, c.matchers, LazyPostings)
+			testutil.Equals(t, expected, got)
+
+			// Some of the regex matchers are expanded lazily, and some at once.
+			b.lazyPostingsMaxSeries = 15
+			got, _ = expand(t, c.matchers, AutoPostings)
+			testutil.Equals(t, expected, got)
+		})
+	}
+
+	// Postings of regex matchers are not fetched when the other matchers select no series.
+	ms := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchEqual, "j", "bar"),
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", ".+"),
+	}
+	_, eagerStats := expand(t, ms, EagerPostings)
+	lazyExpanded := promtest.ToFloat64(b.metrics.postingsLazyExpanded)
+	got, lazyStats := expand(t, ms, LazyPostings)
+	testutil.Equals(t, 0, len(got))
+	testutil.Equals(t, 2, lazyStats.postingsFetched)
+	testutil.Assert(t, lazyStats.postingsFetched < eagerStats.postingsFetched, "expected fewer postings fetched, got %v, eagerly %v", lazyStats.postingsFetched, eagerStats.postingsFetched)
+	testutil.Equals(t, lazyExpanded, promtest.ToFloat64(b.metrics.postingsLazyExpanded))
+
+	// Postings fetched lazily are cached.
+	indexCache, err := storecache.NewInMemoryIndexCacheWithConfig(log.NewNopLogger(), nil, storecache.InMemoryIndexCacheConfig{
+		MaxItemSize: storecache.DefaultInMemoryIndexCacheConfig.MaxItemSize,
+		MaxSize:     storecache.DefaultInMemoryIndexCacheConfig.MaxSize,
+	})
+	testutil.Ok(t, err)
+	b.indexCache = indexCache
+	defer func() { b.indexCache = noopCache{} }()
+
+	ms = []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+	}
+	got, lazyStats = expand(t, ms, LazyPostings)
+	testutil.Equals(t, 1, len(got))
+	testutil.Assert(t, lazyStats.postingsFetched > 0, "expected postings fetched")
+	testutil.Equals(t, lazyExpanded+1, promtest.ToFloat64(b.metrics.postingsLazyExpanded))
+
+	got, lazyStats = expand(t, ms, LazyPostings)
+	testutil.Equals(t, 1, len(got))
+	testutil.Equals(t, 0, lazyStats.postingsFetched)
+}
+
+func TestBucketIndexReader_ExpandedPostings_AutoStrategy(t *testing.T) {
+	tb := testutil.NewTB(t)
+	b, cleanup := prepareMetricNameTestBlock(tb, 1000)
+	defer cleanup()
+
+	// The metric name matches 10 series, and the regex 112 label values.
+	ms := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+		labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+	}
+	expand := func(strategy PostingsStrategy, lazyMaxSeries int) []storage.SeriesRef {
+		b.postingsStrategy, b.lazyPostingsMaxSeries = strategy, lazyMaxSeries
+		ps, err := newBucketIndexReader(b).ExpandedPostings(context.Background(), ms)
+		testutil.Ok(t, err)
+		return ps
+	}
+	expected := expand(EagerPostings, 0)
+	testutil.Equals(t, 1, len(expected))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(b.metrics.postingsLazyExpanded))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(b.metrics.postingsEagerExpanded))
+
+	// Few series are matched by the metric name, so the regex is expanded lazily.
+	testutil.Equals(t, expected, expand(AutoPostings, 10))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(b.metrics.postingsLazyExpanded))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(b.metrics.postingsEagerExpanded))
+
+	// Too many series are matched by the metric name, so the regex is expanded at once.
+	testutil.Equals(t, expected, expand(AutoPostings, 9))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(b.metrics.postingsLazyExpanded))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(b.metrics.postingsEagerExpanded))
+}
+
+func BenchmarkBucketIndexReader_ExpandedPostings_PostingsStrategy(b *testing.B) {
+	tb := testutil.NewTB(b)
+	blk, cleanup := prepareMetricNameTestBlock(tb, 1e5)
+	defer cleanup()
+
+	for _, c := range []struct {
+		name     string
+		matchers []*labels.Matcher
+	}{
+		// The metric name matches 1000 series.
+		{`small/{__name__="rare",pod=~"1.+"}`, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "rare"),
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+		}},
+		// The metric name matches all series.
+		{`large/{__name__="common",pod=~"1.+"}`, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "common"),
+			labels.MustNewMatcher(labels.MatchRegexp, "pod", "1.+"),
+		}},
+	} {
+		for _, strategy := range []PostingsStrategy{EagerPostings, LazyPostings, AutoPostings} {
+			b.Run(fmt.Sprintf("%s/strategy=%s", c.name, strategy), func(b *testing.B) {
+				blk.postingsStrategy, blk.lazyPostingsMaxSeries = strategy, 10000
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, err := newBucketIndexReader(blk).ExpandedPostings(context.Background(), c.matchers)
+					testutil.Ok(b, err)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBucketIndexReader_ExpandedPostings_MetricNameFirst(b *testing.B) {
+	tb := testutil.NewTB(b)
+	blk, cleanup := prepareMetricNameTestBlock(tb, 1e6)
+	defer cleanup()
+
+	for _, c := range metricNamePostingsCases {
+		for _, nameFirst := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/nameFirst=%v", c.name, nameFirst), func(b *testing.B) {
+				tb := testutil.NewTB(b)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					selectSeriesLabels(tb, blk, c.matchers, nameFirst)
+				}
+			})
+		}
+	}
+}
+
 func TestBucketSeries(t *testing.T) {
 	tb := testutil.NewTB(t)
 	storetestutil.RunSeriesInterestingCases(tb, 200e3, 200e3, func(t testutil.TB, samplesPerSeries, series int) {
@@ -1401,7 +1713,8 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		MaxItemSize: 3000,
 		// This is the exact size of cache needed for our *single request*.
 		// This is limited in order to make sure we test evictions.
-		MaxSize: 8889,
+		MaxSize:            8889,
+		EvictDeletedBlocks: true,
 	})
 	testutil.Ok(t, err)
 
@@ -1496,7 +1809,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		bkt:             objstore.WithNoopInstr(bkt),
 		logger:          logger,
 		indexCache:      indexCache,
-		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, indexheader.NewReaderPoolMetrics(nil)),
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, 0, indexheader.NewReaderPoolMetrics(nil)),
 		metrics:         newBucketStoreMetrics(nil),
 		blockSets: map[uint64]*bucketBlockSet{
 			labels.Labels{{Name: "ext1", Value: "1"}}.Hash(): {blocks: [][]*bucketBlock{{b1, b2}}},
@@ -1541,7 +1854,13 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		testutil.Equals(t, numSeries, len(srv.SeriesSet))
 	})
 	t.Run("remove second block. Cache stays. Ask for first again.", func(t *testing.T) {
+		hits, _ := indexCache.FetchMultiPostings(context.Background(), b2.meta.ULID, []labels.Label{{Name: "b", Value: "2"}})
+		testutil.Equals(t, 1, len(hits))
+
 		testutil.Ok(t, store.removeBlock(b2.meta.ULID))
+		// Entries of the removed block are evicted right away.
+		hits, _ = indexCache.FetchMultiPostings(context.Background(), b2.meta.ULID, []labels.Label{{Name: "b", Value: "2"}})
+		testutil.Equals(t, 0, len(hits))
 
 		srv := newStoreSeriesServer(context.Background())
 		testutil.Ok(t, store.Series(&storepb.SeriesRequest{
@@ -1818,6 +2137,233 @@ func TestSeries_BlockWithMultipleChunks(t *testing.T) {
 	}
 }
 
+func TestSeries_Pushdown(t *testing.T) {
+	tb := testutil.NewTB(t)
+	tmpDir := t.TempDir()
+
+	headOpts := tsdb.DefaultHeadOptions()
+	headOpts.ChunkDirRoot = filepath.Join(tmpDir, "block")
+	headOpts.ChunkRange = 10000000000
+
+	h, err := tsdb.NewHead(nil, nil, nil, headOpts, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, h.Close()) }()
+
+	// A counter with resets, irregular scrapes and staleness markers.
+	series := labels.FromStrings("__name__", "test")
+	app := h.Appender(context.Background())
+	for i := int64(0); i < 1000; i++ {
+		v := float64(i % 250)
+		if i%97 == 0 {
+			v = math.Float64frombits(value.StaleNaN)
+		}
+		_, err := app.Append(0, series, i*10000+(i%3)*1000, v)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	blk := createBlockFromHead(t, headOpts.ChunkDirRoot, h)
+	_, err = metadata.InjectThanos(log.NewNopLogger(), filepath.Join(headOpts.ChunkDirRoot, blk.String()), metadata.Thanos{
+		Labels:     labels.Labels{{Name: "ext1", Value: "1"}}.Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.TestSource,
+	}, nil)
+	testutil.Ok(t, err)
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bucket"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+
+	instrBkt := objstore.WithNoopInstr(bkt)
+	logger := log.NewNopLogger()
+	testutil.Ok(t, block.Upload(context.Background(), logger, bkt, filepath.Join(headOpts.ChunkDirRoot, blk.String()), metadata.NoneFunc))
+
+	fetcher, err := block.NewMetaFetcher(logger, 10, instrBkt, tmpDir, nil, nil)
+	testutil.Ok(tb, err)
+
+	store, err := NewBucketStore(
+		instrBkt,
+		fetcher,
+		tmpDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		10,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		true,
+		false,
+		0,
+		WithLogger(logger),
+	)
+	testutil.Ok(tb, err)
+	testutil.Ok(tb, store.SyncBlocks(context.Background()))
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: math.MaxInt32, Timeout: time.Minute})
+	queryable := storage.QueryableFunc(func(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+		return tsdb.NewBlockQuerier(h, mint, maxt)
+	})
+
+	for f := range pushdownFuncs {
+		t.Run(f, func(t *testing.T) {
+			for _, step := range []time.Duration{0, time.Minute, 7 * time.Second} {
+				start, end := time.Unix(300, 0), time.Unix(9000, 0)
+				var qry promql.Query
+				if step == 0 {
+					qry, err = engine.NewInstantQuery(queryable, f+"(test[5m])", end)
+					start = end
+				} else {
+					qry, err = engine.NewRangeQuery(queryable, f+"(test[5m])", start, end, step)
+				}
+				testutil.Ok(t, err)
+				res := qry.Exec(context.Background())
+				testutil.Ok(t, res.Err)
+
+				var exp []promql.Point
+				switch v := res.Value.(type) {
+				case promql.Matrix:
+					exp = v[0].Points
+				case promql.Vector:
+					exp = []promql.Point{v[0].Point}
+				}
+
+				pushdown := &storepb.Pushdown{
+					Func:        f,
+					RangeMillis: 300000,
+					Start:       timestamp.FromTime(start),
+					End:         timestamp.FromTime(end),
+					StepMillis:  step.Milliseconds(),
+				}
+				srv := newStoreSeriesServer(context.Background())
+				testutil.Ok(t, store.Series(&storepb.SeriesRequest{
+					MinTime:  pushdown.Start - pushdown.RangeMillis,
+					MaxTime:  pushdown.End,
+					Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "test"}},
+					Pushdown: pushdown,
+				}, srv))
+				testutil.Equals(t, 1, len(srv.SeriesSet))
+				testutil.Equals(t, labels.FromStrings("__name__", "test", dedup.PushdownMarker.Name, dedup.PushdownMarker.Value, "ext1", "1"), srv.SeriesSet[0].PromLabels())
+
+				var got []promql.Point
+				for _, c := range srv.SeriesSet[0].Chunks {
+					chk, err := chunkenc.FromData(chunkenc.EncXOR, c.Raw.Data)
+					testutil.Ok(t, err)
+					it := chk.Iterator(nil)
+					for it.Next() {
+						t, v := it.At()
+						got = append(got, promql.Point{T: t, V: v})
+					}
+					testutil.Ok(t, it.Err())
+				}
+				testutil.Equals(t, exp, got)
+			}
+		})
+	}
+}
+
+func TestSeries_CompressedChunks(t *testing.T) {
+	tb := testutil.NewTB(t)
+	tmpDir := t.TempDir()
+
+	// Series with the same samples make chunk files of several frames which compress well.
+	headOpts := tsdb.DefaultHeadOptions()
+	headOpts.ChunkDirRoot = filepath.Join(tmpDir, "block")
+	headOpts.ChunkRange = 10000000000
+	h, err := tsdb.NewHead(nil, nil, nil, headOpts, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, h.Close()) }()
+
+	app := h.Appender(context.Background())
+	for i := 0; i < 5000; i++ {
+		lset := labels.FromStrings("__name__", "test", "i", fmt.Sprintf("%04d", i))
+		for ts := int64(0); ts < 120; ts++ {
+			_, err := app.Append(0, lset, ts*15000, float64(ts%7))
+			testutil.Ok(t, err)
+		}
+	}
+	testutil.Ok(t, app.Commit())
+
+	blk := createBlockFromHead(t, headOpts.ChunkDirRoot, h)
+	bdir := filepath.Join(headOpts.ChunkDirRoot, blk.String())
+	_, err = metadata.InjectThanos(log.NewNopLogger(), bdir, metadata.Thanos{
+		Labels:     labels.Labels{{Name: "ext1", Value: "1"}}.Map(),
+		Downsample: metadata.ThanosDownsample{Resolution: 0},
+		Source:     metadata.TestSource,
+	}, nil)
+	testutil.Ok(t, err)
+
+	logger := log.NewNopLogger()
+	saved, err := block.CompressChunks(logger, bdir)
+	testutil.Ok(t, err)
+	testutil.Assert(t, saved > 0, "expected chunk files to be compressed")
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bucket"))
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bkt.Close()) }()
+	instrBkt := objstore.WithNoopInstr(bkt)
+	testutil.Ok(t, block.Upload(context.Background(), logger, bkt, bdir, metadata.NoneFunc))
+
+	fetcher, err := block.NewMetaFetcher(logger, 10, instrBkt, tmpDir, nil, nil)
+	testutil.Ok(tb, err)
+	store, err := NewBucketStore(
+		instrBkt,
+		fetcher,
+		tmpDir,
+		NewChunksLimiterFactory(0),
+		NewSeriesLimiterFactory(0),
+		NewGapBasedPartitioner(PartitionerMaxGapSize),
+		10,
+		false,
+		DefaultPostingOffsetInMemorySampling,
+		true,
+		false,
+		0,
+		WithLogger(logger),
+	)
+	testutil.Ok(tb, err)
+	testutil.Ok(tb, store.SyncBlocks(context.Background()))
+
+	for _, matcher := range []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_RE, Name: "i", Value: ".+"},
+		// Chunks at the end of the chunk file, in its last frame.
+		{Type: storepb.LabelMatcher_EQ, Name: "i", Value: "4999"},
+	} {
+		srv := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, store.Series(&storepb.SeriesRequest{
+			MinTime:  math.MinInt64,
+			MaxTime:  math.MaxInt64,
+			Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "test"}, matcher},
+		}, srv))
+
+		for _, s := range srv.SeriesSet {
+			ts := int64(0)
+			for _, chk := range s.Chunks {
+				c, err := chunkenc.FromData(chunkenc.EncXOR, chk.Raw.Data)
+				testutil.Ok(t, err)
+				for it := c.Iterator(nil); it.Next(); ts++ {
+					st, v := it.At()
+					testutil.Equals(t, ts*15000, st)
+					testutil.Equals(t, float64(ts%7), v)
+				}
+			}
+			testutil.Equals(t, int64(120), ts)
+		}
+		if matcher.Type == storepb.LabelMatcher_RE {
+			testutil.Equals(t, 5000, len(srv.SeriesSet))
+		} else {
+			testutil.Equals(t, 1, len(srv.SeriesSet))
+		}
+	}
+}
+
+func TestBucketBlock_ZstdChunkFile_UncompressedMeta(t *testing.T) {
+	// Chunk files of blocks without chunk compression in their meta are not read to check whether they are compressed.
+	b := &bucketBlock{meta: &metadata.Meta{}, chunkObjs: []string{"01FXXXXXXXXXXXXXXXXXXXXXXX/chunks/000001"}}
+	cf, err := b.zstdChunkFile(context.Background(), 0)
+	testutil.Ok(t, err)
+	testutil.Assert(t, cf == nil, "expected an uncompressed chunk file")
+}
+
 func mustMarshalAny(pb proto.Message) *types.Any {
 	out, err := types.MarshalAny(pb)
 	if err != nil {
@@ -2288,9 +2834,9 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 				testutil.Ok(b, err)
 
 				indexReader := blk.indexReader()
-				chunkReader := blk.chunkReader()
+				chunkReader := blk.chunkReader(nil, nil)
 
-				seriesSet, _, err := blockSeries(context.Background(), nil, indexReader, chunkReader, matchers, chunksLimiter, seriesLimiter, req.SkipChunks, req.MinTime, req.MaxTime, req.Aggregates)
+				seriesSet, _, err := blockSeries(context.Background(), nil, indexReader, chunkReader, matchers, chunksLimiter, seriesLimiter, nil, req.SkipChunks, req.MinTime, req.MaxTime, req.Aggregates)
 				testutil.Ok(b, err)
 
 				// Ensure at least 1 series has been returned (as expected).
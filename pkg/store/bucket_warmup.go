@@ -0,0 +1,70 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// WithIndexCacheWarmupMatchers sets series selectors whose postings and series are loaded into the index cache
+// of every block during the initial sync, so the first queries for them are served from the cache.
+func WithIndexCacheWarmupMatchers(matchers [][]*labels.Matcher) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.indexCacheWarmupMatchers = matchers
+	}
+}
+
+// warmIndexCache loads the postings and series matching the warm-up matchers of all loaded blocks into the index cache.
+// Failures are only logged, as a cold cache is not a reason to stop serving.
+func (s *BucketStore) warmIndexCache(ctx context.Context) {
+	if len(s.indexCacheWarmupMatchers) == 0 {
+		return
+	}
+
+	s.mtx.RLock()
+	blocks := make([]*bucketBlock, 0, len(s.blocks))
+	for _, b := range s.blocks {
+		blocks = append(blocks, b)
+	}
+	s.mtx.RUnlock()
+
+	start := time.Now()
+	for _, b := range blocks {
+		if err := s.warmBlockIndexCache(ctx, b); err != nil {
+			level.Warn(s.logger).Log("msg", "failed to warm index cache of block", "id", b.meta.ULID, "err", err)
+		}
+	}
+	level.Info(s.logger).Log("msg", "warmed index cache", "blocks", len(blocks), "elapsed", time.Since(start))
+}
+
+func (s *BucketStore) warmBlockIndexCache(ctx context.Context, b *bucketBlock) error {
+	indexr := b.indexReader()
+	defer runutil.CloseWithLogOnErr(s.logger, indexr, "warm index cache index reader")
+
+	for _, ms := range s.indexCacheWarmupMatchers {
+		blockMatchers, ok := extLabelMatchers(b.extLset, ms...)
+		if !ok || len(blockMatchers) == 0 {
+			continue
+		}
+
+		ps, err := indexr.ExpandedPostings(ctx, blockMatchers)
+		if err != nil {
+			return errors.Wrap(err, "expand postings")
+		}
+		if err := indexr.PreloadSeries(ctx, ps); err != nil {
+			return errors.Wrap(err, "preload series")
+		}
+		// Drop the series loaded by the reader, they are in the cache now.
+		indexr.loadedSeries = map[storage.SeriesRef][]byte{}
+	}
+	return nil
+}
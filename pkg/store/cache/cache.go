@@ -42,6 +42,15 @@ type IndexCache interface {
 	FetchMultiSeries(ctx context.Context, blockID ulid.ULID, ids []storage.SeriesRef) (hits map[storage.SeriesRef][]byte, misses []storage.SeriesRef)
 }
 
+// BlockEvictingIndexCache is an IndexCache which can evict all entries of a block at once, e.g. when the block
+// is deleted and its entries would be never requested again.
+type BlockEvictingIndexCache interface {
+	IndexCache
+
+	// EvictBlock removes all entries of the given block from the cache.
+	EvictBlock(blockID ulid.ULID)
+}
+
 type cacheKey struct {
 	block ulid.ULID
 	key   interface{}
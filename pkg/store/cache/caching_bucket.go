@@ -35,6 +35,22 @@ var (
 	errObjNotFound = errors.Errorf("object not found")
 )
 
+type ctxKey int
+
+// cachingDisabledKey is the context key marking requests which bypass the caches of the CachingBucket.
+const cachingDisabledKey = ctxKey(0)
+
+// WithCachingDisabled returns a context for which the CachingBucket reads directly from the underlying bucket,
+// without looking up or populating its caches.
+func WithCachingDisabled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachingDisabledKey, true)
+}
+
+func cachingDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(cachingDisabledKey).(bool)
+	return disabled
+}
+
 // CachingBucket implementation that provides some caching features, based on passed configuration.
 type CachingBucket struct {
 	objstore.Bucket
@@ -127,7 +143,7 @@ func (cb *CachingBucket) ReaderWithExpectedErrs(expectedFunc objstore.IsOpFailur
 
 func (cb *CachingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
 	cfgName, cfg := cb.cfg.FindIterConfig(dir)
-	if cfg == nil {
+	if cfg == nil || cachingDisabled(ctx) {
 		return cb.Bucket.Iter(ctx, dir, f, options...)
 	}
 
@@ -172,7 +188,7 @@ func (cb *CachingBucket) Iter(ctx context.Context, dir string, f func(string) er
 
 func (cb *CachingBucket) Exists(ctx context.Context, name string) (bool, error) {
 	cfgName, cfg := cb.cfg.FindExistConfig(name)
-	if cfg == nil {
+	if cfg == nil || cachingDisabled(ctx) {
 		return cb.Bucket.Exists(ctx, name)
 	}
 
@@ -215,7 +231,7 @@ func storeExistsCacheEntry(ctx context.Context, cachingKey string, exists bool,
 
 func (cb *CachingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	cfgName, cfg := cb.cfg.FindGetConfig(name)
-	if cfg == nil {
+	if cfg == nil || cachingDisabled(ctx) {
 		return cb.Bucket.Get(ctx, name)
 	}
 
@@ -274,7 +290,7 @@ func (cb *CachingBucket) GetRange(ctx context.Context, name string, off, length
 	}
 
 	cfgName, cfg := cb.cfg.FindGetRangeConfig(name)
-	if cfg == nil {
+	if cfg == nil || cachingDisabled(ctx) {
 		return cb.Bucket.GetRange(ctx, name, off, length)
 	}
 
@@ -283,7 +299,7 @@ func (cb *CachingBucket) GetRange(ctx context.Context, name string, off, length
 
 func (cb *CachingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
 	cfgName, cfg := cb.cfg.FindAttributesConfig(name)
-	if cfg == nil {
+	if cfg == nil || cachingDisabled(ctx) {
 		return cb.Bucket.Attributes(ctx, name)
 	}
 
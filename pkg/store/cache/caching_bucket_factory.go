@@ -56,6 +56,10 @@ type CachingWithBackendConfig struct {
 	MetafileExistsTTL      time.Duration `yaml:"metafile_exists_ttl"`
 	MetafileDoesntExistTTL time.Duration `yaml:"metafile_doesnt_exist_ttl"`
 	MetafileContentTTL     time.Duration `yaml:"metafile_content_ttl"`
+
+	// External label identifying the tenant of blocks, whose value partitions the capacity of the in-memory cache
+	// between tenants. Empty disables partitioning.
+	TenantPartitionLabel string `yaml:"tenant_partition_label"`
 }
 
 func (cfg *CachingWithBackendConfig) Defaults() {
@@ -70,23 +74,30 @@ func (cfg *CachingWithBackendConfig) Defaults() {
 	cfg.MetafileMaxSize = 1024 * 1024 // Equal to default MaxItemSize in memcached client.
 }
 
-// NewCachingBucketFromYaml uses YAML configuration to create new caching bucket.
-func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger log.Logger, reg prometheus.Registerer, r *route.Router) (objstore.InstrumentedBucket, error) {
+// NewCachingBucketFromYaml uses YAML configuration to create new caching bucket. If the in-memory cache is partitioned
+// by tenant, the partitioned cache is returned too and has to be used as a metadata filter of the blocks.
+func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger log.Logger, reg prometheus.Registerer, r *route.Router) (objstore.InstrumentedBucket, *TenantPartitionedCache, error) {
 	level.Info(logger).Log("msg", "loading caching bucket configuration")
 
 	config := &CachingWithBackendConfig{}
 	config.Defaults()
 
 	if err := yaml.UnmarshalStrict(yamlContent, config); err != nil {
-		return nil, errors.Wrap(err, "parsing config YAML file")
+		return nil, nil, errors.Wrap(err, "parsing config YAML file")
 	}
 
 	backendConfig, err := yaml.Marshal(config.BackendConfig)
 	if err != nil {
-		return nil, errors.Wrap(err, "marshal content of cache backend configuration")
+		return nil, nil, errors.Wrap(err, "marshal content of cache backend configuration")
+	}
+	if config.TenantPartitionLabel != "" && strings.ToUpper(string(config.Type)) != string(InMemoryBucketCacheProvider) {
+		return nil, nil, errors.Errorf("tenant partitioning is only supported by the %s cache type", InMemoryBucketCacheProvider)
 	}
 
-	var c cache.Cache
+	var (
+		c                cache.Cache
+		partitionedCache *TenantPartitionedCache
+	)
 	cfg := cache.NewCachingBucketConfig()
 
 	// Configure cache paths.
@@ -103,30 +114,42 @@ func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger
 		var memcached cacheutil.RemoteCacheClient
 		memcached, err := cacheutil.NewMemcachedClient(logger, "caching-bucket", backendConfig, reg)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create memcached client")
+			return nil, nil, errors.Wrapf(err, "failed to create memcached client")
 		}
 		c = cache.NewMemcachedCache("caching-bucket", logger, memcached, reg)
 	case string(InMemoryBucketCacheProvider):
+		if config.TenantPartitionLabel != "" {
+			inMemoryConfig := cache.DefaultInMemoryCacheConfig
+			if err := yaml.Unmarshal(backendConfig, &inMemoryConfig); err != nil {
+				return nil, nil, errors.Wrap(err, "parsing inmemory cache config")
+			}
+			partitionedCache, err = NewTenantPartitionedCache("caching-bucket", logger, reg, config.TenantPartitionLabel, inMemoryConfig)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "failed to create tenant partitioned inmemory cache")
+			}
+			c = partitionedCache
+			break
+		}
 		c, err = cache.NewInMemoryCache("caching-bucket", logger, reg, backendConfig)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create inmemory cache")
+			return nil, nil, errors.Wrapf(err, "failed to create inmemory cache")
 		}
 	case string(GroupcacheBucketCacheProvider):
 		const basePath = "/_galaxycache/"
 
 		c, err = cache.NewGroupcache(logger, reg, backendConfig, basePath, r, bucket, cfg)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create groupcache")
+			return nil, nil, errors.Wrap(err, "failed to create groupcache")
 		}
 
 	case string(RedisBucketCacheProvider):
 		redisCache, err := cacheutil.NewRedisClient(logger, "caching-bucket", backendConfig, reg)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create redis client")
+			return nil, nil, errors.Wrapf(err, "failed to create redis client")
 		}
 		c = cache.NewRedisCache("caching-bucket", logger, redisCache, reg)
 	default:
-		return nil, errors.Errorf("unsupported cache type: %s", config.Type)
+		return nil, nil, errors.Errorf("unsupported cache type: %s", config.Type)
 	}
 
 	// Include interactions with cache in the traces.
@@ -135,10 +158,10 @@ func NewCachingBucketFromYaml(yamlContent []byte, bucket objstore.Bucket, logger
 
 	cb, err := NewCachingBucket(bucket, cfg, logger, reg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return cb, nil
+	return cb, partitionedCache, nil
 }
 
 var chunksMatcher = regexp.MustCompile(`^.*/chunks/\d+$`)
@@ -549,6 +549,37 @@ func TestGet(t *testing.T) {
 	verifyExists(t, cb, testFilename, true, true, cfgName)
 }
 
+func TestGetWithCachingDisabled(t *testing.T) {
+	inmem := objstore.NewInMemBucket()
+	cache := newMockCache()
+
+	cfg := thanoscache.NewCachingBucketConfig()
+	const cfgName = "metafile"
+	cfg.CacheGet(cfgName, cache, matchAll, 1024, 10*time.Minute, 10*time.Minute, 2*time.Minute)
+	cfg.CacheExists(cfgName, cache, matchAll, 10*time.Minute, 2*time.Minute)
+
+	cb, err := NewCachingBucket(inmem, cfg, nil, nil)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, inmem.Upload(context.Background(), testFilename, strings.NewReader("old")))
+	verifyGet(t, cb, testFilename, []byte("old"), false, cfgName)
+	verifyGet(t, cb, testFilename, []byte("old"), true, cfgName)
+
+	// The cached content is served until it expires, unless the caches are bypassed.
+	testutil.Ok(t, inmem.Upload(context.Background(), testFilename, strings.NewReader("new")))
+	requestsBefore := promtest.ToFloat64(cb.operationRequests.WithLabelValues(objstore.OpGet, cfgName))
+
+	r, err := cb.Get(WithCachingDisabled(context.Background()), testFilename)
+	testutil.Ok(t, err)
+	data, err := ioutil.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Ok(t, r.Close())
+	testutil.Equals(t, []byte("new"), data)
+	testutil.Equals(t, requestsBefore, promtest.ToFloat64(cb.operationRequests.WithLabelValues(objstore.OpGet, cfgName)))
+
+	verifyGet(t, cb, testFilename, []byte("old"), true, cfgName)
+}
+
 func TestGetTooBigObject(t *testing.T) {
 	inmem := objstore.NewInMemBucket()
 
@@ -42,6 +42,9 @@ type InMemoryIndexCache struct {
 
 	curSize uint64
 
+	// blockKeys holds the keys of the entries of every block, if evicting deleted blocks is enabled.
+	blockKeys map[ulid.ULID]map[cacheKey]struct{}
+
 	evicted          *prometheus.CounterVec
 	requests         *prometheus.CounterVec
 	hits             *prometheus.CounterVec
@@ -50,6 +53,7 @@ type InMemoryIndexCache struct {
 	currentSize      *prometheus.GaugeVec
 	totalCurrentSize *prometheus.GaugeVec
 	overflow         *prometheus.CounterVec
+	blockEvicted     *prometheus.CounterVec
 }
 
 // InMemoryIndexCacheConfig holds the in-memory index cache config.
@@ -58,6 +62,8 @@ type InMemoryIndexCacheConfig struct {
 	MaxSize model.Bytes `yaml:"max_size"`
 	// MaxItemSize represents maximum size of single item.
 	MaxItemSize model.Bytes `yaml:"max_item_size"`
+	// EvictDeletedBlocks enables evicting all entries of a block as soon as it is removed from the store.
+	EvictDeletedBlocks bool `yaml:"evict_deleted_blocks"`
 }
 
 // parseInMemoryIndexCacheConfig unmarshals a buffer into a InMemoryIndexCacheConfig with default values.
@@ -93,6 +99,9 @@ func NewInMemoryIndexCacheWithConfig(logger log.Logger, reg prometheus.Registere
 		maxSizeBytes:     uint64(config.MaxSize),
 		maxItemSizeBytes: uint64(config.MaxItemSize),
 	}
+	if config.EvictDeletedBlocks {
+		c.blockKeys = map[ulid.ULID]map[cacheKey]struct{}{}
+	}
 
 	c.evicted = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 		Name: "thanos_store_index_cache_items_evicted_total",
@@ -101,6 +110,13 @@ func NewInMemoryIndexCacheWithConfig(logger log.Logger, reg prometheus.Registere
 	c.evicted.WithLabelValues(cacheTypePostings)
 	c.evicted.WithLabelValues(cacheTypeSeries)
 
+	c.blockEvicted = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_block_evicted_items_total",
+		Help: "Total number of items that were evicted from the index cache because their block was deleted.",
+	}, []string{"item_type"})
+	c.blockEvicted.WithLabelValues(cacheTypePostings)
+	c.blockEvicted.WithLabelValues(cacheTypeSeries)
+
 	c.added = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 		Name: "thanos_store_index_cache_items_added_total",
 		Help: "Total number of items that were added to the index cache.",
@@ -176,12 +192,16 @@ func NewInMemoryIndexCacheWithConfig(logger log.Logger, reg prometheus.Registere
 		"maxItemSizeBytes", c.maxItemSizeBytes,
 		"maxSizeBytes", c.maxSizeBytes,
 		"maxItems", "maxInt",
+		"evictDeletedBlocks", config.EvictDeletedBlocks,
 	)
 	return c, nil
 }
 
 func (c *InMemoryIndexCache) onEvict(key, val interface{}) {
 	k := key.(cacheKey).keyType()
+	if c.blockKeys != nil {
+		c.untrackBlockKey(key.(cacheKey))
+	}
 	entrySize := sliceHeaderSize + uint64(len(val.([]byte)))
 
 	c.evicted.WithLabelValues(string(k)).Inc()
@@ -192,6 +212,22 @@ func (c *InMemoryIndexCache) onEvict(key, val interface{}) {
 	c.curSize -= entrySize
 }
 
+func (c *InMemoryIndexCache) trackBlockKey(key cacheKey) {
+	keys, ok := c.blockKeys[key.block]
+	if !ok {
+		keys = map[cacheKey]struct{}{}
+		c.blockKeys[key.block] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (c *InMemoryIndexCache) untrackBlockKey(key cacheKey) {
+	delete(c.blockKeys[key.block], key)
+	if len(c.blockKeys[key.block]) == 0 {
+		delete(c.blockKeys, key.block)
+	}
+}
+
 func (c *InMemoryIndexCache) get(typ string, key cacheKey) ([]byte, bool) {
 	c.requests.WithLabelValues(typ).Inc()
 
@@ -226,6 +262,9 @@ func (c *InMemoryIndexCache) set(typ string, key cacheKey, val []byte) {
 	v := make([]byte, len(val))
 	copy(v, val)
 	c.lru.Add(key, v)
+	if c.blockKeys != nil {
+		c.trackBlockKey(key)
+	}
 
 	c.added.WithLabelValues(typ).Inc()
 	c.currentSize.WithLabelValues(typ).Add(float64(size))
@@ -273,6 +312,19 @@ func (c *InMemoryIndexCache) reset() {
 	c.curSize = 0
 }
 
+// EvictBlock removes all entries of the given block from the cache. It is a noop unless evicting deleted blocks
+// is enabled, as the keys of the entries of blocks are not tracked otherwise.
+func (c *InMemoryIndexCache) EvictBlock(blockID ulid.ULID) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key := range c.blockKeys[blockID] {
+		if c.lru.Remove(key) {
+			c.blockEvicted.WithLabelValues(key.keyType()).Inc()
+		}
+	}
+}
+
 func copyString(s string) string {
 	var b []byte
 	h := (*reflect.SliceHeader)(unsafe.Pointer(&b))
@@ -426,3 +426,51 @@ func TestInMemoryIndexCache_Eviction_WithMetrics(t *testing.T) {
 	testutil.Equals(t, float64(5), promtest.ToFloat64(cache.hits.WithLabelValues(cacheTypePostings)))
 	testutil.Equals(t, float64(1), promtest.ToFloat64(cache.hits.WithLabelValues(cacheTypeSeries)))
 }
+
+func TestInMemoryIndexCache_EvictBlock(t *testing.T) {
+	ctx := context.Background()
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("evict_deleted_blocks=%v", enabled), func(t *testing.T) {
+			cache, err := NewInMemoryIndexCacheWithConfig(log.NewNopLogger(), nil, InMemoryIndexCacheConfig{
+				MaxItemSize:        1024,
+				MaxSize:            1024,
+				EvictDeletedBlocks: enabled,
+			})
+			testutil.Ok(t, err)
+
+			deleted, kept := ulid.MustNew(0, nil), ulid.MustNew(1, nil)
+			lbls := []labels.Label{{Name: "a", Value: "1"}, {Name: "a", Value: "2"}}
+			for _, id := range []ulid.ULID{deleted, kept} {
+				for _, l := range lbls {
+					cache.StorePostings(ctx, id, l, []byte{1})
+				}
+				cache.StoreSeries(ctx, id, 1, []byte{2})
+			}
+
+			cache.EvictBlock(deleted)
+			pHits, _ := cache.FetchMultiPostings(ctx, deleted, lbls)
+			sHits, _ := cache.FetchMultiSeries(ctx, deleted, []storage.SeriesRef{1})
+			if !enabled {
+				testutil.Equals(t, 2, len(pHits))
+				testutil.Equals(t, 1, len(sHits))
+				testutil.Equals(t, float64(0), promtest.ToFloat64(cache.blockEvicted.WithLabelValues(cacheTypePostings)))
+				return
+			}
+			testutil.Equals(t, 0, len(pHits))
+			testutil.Equals(t, 0, len(sHits))
+			testutil.Equals(t, float64(2), promtest.ToFloat64(cache.blockEvicted.WithLabelValues(cacheTypePostings)))
+			testutil.Equals(t, float64(1), promtest.ToFloat64(cache.blockEvicted.WithLabelValues(cacheTypeSeries)))
+			testutil.Equals(t, float64(3), promtest.ToFloat64(cache.current.WithLabelValues(cacheTypePostings))+promtest.ToFloat64(cache.current.WithLabelValues(cacheTypeSeries)))
+			testutil.Equals(t, 1, len(cache.blockKeys))
+
+			pHits, _ = cache.FetchMultiPostings(ctx, kept, lbls)
+			sHits, _ = cache.FetchMultiSeries(ctx, kept, []storage.SeriesRef{1})
+			testutil.Equals(t, 2, len(pHits))
+			testutil.Equals(t, 1, len(sHits))
+
+			// Entries evicted by the LRU are not tracked anymore.
+			cache.reset()
+			testutil.Equals(t, 0, len(cache.blockKeys))
+		})
+	}
+}
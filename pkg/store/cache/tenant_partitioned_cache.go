@@ -0,0 +1,321 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/cache"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/store/cache/cachekey"
+)
+
+// TenantPartitionedCache is an in-memory cache for the caching bucket which splits its capacity equally between the
+// tenants of the blocks, so that the chunks of the blocks of one tenant can't evict the ones of another tenant. The
+// tenant of a block is the value of its tenant external label, which is learnt by filtering the block metas with it.
+// Items of blocks without the label, of unknown blocks and not belonging to a block share the partition of the
+// empty tenant.
+type TenantPartitionedCache struct {
+	logger           log.Logger
+	name             string
+	tenantLabel      string
+	maxSizeBytes     uint64
+	maxItemSizeBytes uint64
+
+	mtx          sync.Mutex
+	blockTenants map[ulid.ULID]string
+	partitions   map[string]*tenantPartition
+
+	requests   *prometheus.CounterVec
+	hits       *prometheus.CounterVec
+	added      *prometheus.CounterVec
+	evicted    *prometheus.CounterVec
+	overflow   *prometheus.CounterVec
+	items      *prometheus.GaugeVec
+	sizeBytes  *prometheus.GaugeVec
+	maxSizeVec *prometheus.GaugeVec
+}
+
+type tenantPartition struct {
+	lru     *lru.LRU
+	curSize uint64
+}
+
+type tenantCacheEntry struct {
+	data       []byte
+	expiryTime time.Time
+}
+
+// NewTenantPartitionedCache creates a new in-memory cache whose max size is partitioned between the tenants of the
+// blocks identified by the tenantLabel external label.
+func NewTenantPartitionedCache(name string, logger log.Logger, reg prometheus.Registerer, tenantLabel string, config cache.InMemoryCacheConfig) (*TenantPartitionedCache, error) {
+	if tenantLabel == "" {
+		return nil, errors.New("tenant label of the partitioned cache cannot be empty")
+	}
+	if config.MaxItemSize > config.MaxSize {
+		return nil, errors.Errorf("max item size (%v) cannot be bigger than overall cache size (%v)", config.MaxItemSize, config.MaxSize)
+	}
+
+	c := &TenantPartitionedCache{
+		logger:           logger,
+		name:             name,
+		tenantLabel:      tenantLabel,
+		maxSizeBytes:     uint64(config.MaxSize),
+		maxItemSizeBytes: uint64(config.MaxItemSize),
+		blockTenants:     map[ulid.ULID]string{},
+		partitions:       map[string]*tenantPartition{},
+	}
+
+	c.requests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_cache_tenant_partition_requests_total",
+		Help:        "Total number of requests to a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.hits = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_cache_tenant_partition_hits_total",
+		Help:        "Total number of requests to a tenant partition of the inmemory cache that were a hit.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.added = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_cache_tenant_partition_items_added_total",
+		Help:        "Total number of items that were added to a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.evicted = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_cache_tenant_partition_items_evicted_total",
+		Help:        "Total number of items that were evicted from a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.overflow = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name:        "thanos_cache_tenant_partition_items_overflowed_total",
+		Help:        "Total number of items that could not be added to a tenant partition of the inmemory cache due to being too big.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.items = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "thanos_cache_tenant_partition_items",
+		Help:        "Current number of items in a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.sizeBytes = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "thanos_cache_tenant_partition_items_size_bytes",
+		Help:        "Current byte size of items in a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	c.maxSizeVec = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "thanos_cache_tenant_partition_max_size_bytes",
+		Help:        "Maximum number of bytes to be held in a tenant partition of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, []string{"tenant"})
+	_ = promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "thanos_cache_tenant_partitions",
+		Help:        "Current number of tenant partitions of the inmemory cache.",
+		ConstLabels: prometheus.Labels{"name": name},
+	}, func() float64 {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return float64(len(c.partitions))
+	})
+
+	level.Info(logger).Log(
+		"msg", "created tenant partitioned in-memory cache",
+		"tenantLabel", tenantLabel,
+		"maxItemSizeBytes", c.maxItemSizeBytes,
+		"maxSizeBytes", c.maxSizeBytes,
+	)
+	return c, nil
+}
+
+// Filter records the tenant of the blocks without filtering any of them. It implements block.MetadataFilter. The
+// partitions of tenants without blocks anymore are removed, giving their share back to the other tenants.
+func (c *TenantPartitionedCache) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ *extprom.TxGaugeVec, _ *extprom.TxGaugeVec) error {
+	blockTenants := make(map[ulid.ULID]string, len(metas))
+	tenants := map[string]struct{}{"": {}}
+	for id, m := range metas {
+		tenant := m.Thanos.Labels[c.tenantLabel]
+		blockTenants[id] = tenant
+		tenants[tenant] = struct{}{}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.blockTenants = blockTenants
+	for tenant := range c.partitions {
+		if _, ok := tenants[tenant]; ok {
+			continue
+		}
+		c.removePartition(tenant)
+	}
+	c.resizePartitions()
+	return nil
+}
+
+// tenantOf returns the tenant of the block of the given caching bucket key, or an empty tenant if it is unknown.
+func (c *TenantPartitionedCache) tenantOf(key string) string {
+	ck, err := cachekey.ParseBucketCacheKey(key)
+	if err != nil {
+		return ""
+	}
+	dir := ck.Name
+	if i := strings.Index(dir, "/"); i >= 0 {
+		dir = dir[:i]
+	}
+	id, err := ulid.Parse(dir)
+	if err != nil {
+		return ""
+	}
+	return c.blockTenants[id]
+}
+
+// partition returns the partition of the tenant, creating it if it doesn't exist. It has to be called with the lock.
+func (c *TenantPartitionedCache) partition(tenant string) *tenantPartition {
+	if p, ok := c.partitions[tenant]; ok {
+		return p
+	}
+
+	p := &tenantPartition{}
+	// The LRU is initialized with a high size limit since we will manage evictions ourselves based on stored size.
+	p.lru, _ = lru.NewLRU(maxInt, func(_, val interface{}) {
+		size := uint64(len(val.(tenantCacheEntry).data))
+		p.curSize -= size
+		c.evicted.WithLabelValues(tenant).Inc()
+		c.items.WithLabelValues(tenant).Dec()
+		c.sizeBytes.WithLabelValues(tenant).Sub(float64(size))
+	})
+	c.partitions[tenant] = p
+	c.items.WithLabelValues(tenant).Set(0)
+	c.sizeBytes.WithLabelValues(tenant).Set(0)
+	c.resizePartitions()
+	return p
+}
+
+// removePartition drops the partition of the tenant and its items. It has to be called with the lock.
+func (c *TenantPartitionedCache) removePartition(tenant string) {
+	delete(c.partitions, tenant)
+	c.requests.DeleteLabelValues(tenant)
+	c.hits.DeleteLabelValues(tenant)
+	c.added.DeleteLabelValues(tenant)
+	c.evicted.DeleteLabelValues(tenant)
+	c.overflow.DeleteLabelValues(tenant)
+	c.items.DeleteLabelValues(tenant)
+	c.sizeBytes.DeleteLabelValues(tenant)
+	c.maxSizeVec.DeleteLabelValues(tenant)
+}
+
+// partitionMaxSize returns the share of every tenant partition. It has to be called with the lock.
+func (c *TenantPartitionedCache) partitionMaxSize() uint64 {
+	if len(c.partitions) == 0 {
+		return c.maxSizeBytes
+	}
+	return c.maxSizeBytes / uint64(len(c.partitions))
+}
+
+// resizePartitions evicts the oldest items of the partitions exceeding their share, which shrinks when a tenant is
+// added. It has to be called with the lock.
+func (c *TenantPartitionedCache) resizePartitions() {
+	maxSize := c.partitionMaxSize()
+	for tenant, p := range c.partitions {
+		c.maxSizeVec.WithLabelValues(tenant).Set(float64(maxSize))
+		for p.curSize > maxSize {
+			if _, _, ok := p.lru.RemoveOldest(); !ok {
+				break
+			}
+		}
+	}
+}
+
+func (c *TenantPartitionedCache) set(key string, val []byte, ttl time.Duration) {
+	size := uint64(len(val))
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tenant := c.tenantOf(key)
+	p := c.partition(tenant)
+	if _, ok := p.lru.Get(key); ok {
+		return
+	}
+
+	maxSize := c.partitionMaxSize()
+	if size > c.maxItemSizeBytes || size > maxSize {
+		level.Debug(c.logger).Log("msg", "item bigger than the max item size or tenant partition size. Ignoring..", "tenant", tenant, "itemSize", size, "partitionMaxSize", maxSize)
+		c.overflow.WithLabelValues(tenant).Inc()
+		return
+	}
+	// Only the items of the same tenant are evicted to make room for the new one.
+	for p.curSize+size > maxSize {
+		if _, _, ok := p.lru.RemoveOldest(); !ok {
+			break
+		}
+	}
+
+	// The caller may be passing in a sub-slice of a huge array. Copy the data
+	// to ensure we don't waste huge amounts of space for something small.
+	v := make([]byte, len(val))
+	copy(v, val)
+	p.lru.Add(key, tenantCacheEntry{data: v, expiryTime: time.Now().Add(ttl)})
+	p.curSize += size
+
+	c.added.WithLabelValues(tenant).Inc()
+	c.items.WithLabelValues(tenant).Inc()
+	c.sizeBytes.WithLabelValues(tenant).Add(float64(size))
+}
+
+func (c *TenantPartitionedCache) get(key string) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tenant := c.tenantOf(key)
+	c.requests.WithLabelValues(tenant).Inc()
+	p, ok := c.partitions[tenant]
+	if !ok {
+		return nil, false
+	}
+	v, ok := p.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	// Expired items are removed on access, like in the in-memory cache.
+	if time.Now().After(v.(tenantCacheEntry).expiryTime) {
+		p.lru.Remove(key)
+		return nil, false
+	}
+	c.hits.WithLabelValues(tenant).Inc()
+	return v.(tenantCacheEntry).data, true
+}
+
+// Store implements cache.Cache.
+func (c *TenantPartitionedCache) Store(_ context.Context, data map[string][]byte, ttl time.Duration) {
+	for key, val := range data {
+		c.set(key, val, ttl)
+	}
+}
+
+// Fetch implements cache.Cache.
+func (c *TenantPartitionedCache) Fetch(_ context.Context, keys []string) map[string][]byte {
+	results := make(map[string][]byte)
+	for _, key := range keys {
+		if b, ok := c.get(key); ok {
+			results[key] = b
+		}
+	}
+	return results
+}
+
+// Name implements cache.Cache.
+func (c *TenantPartitionedCache) Name() string {
+	return c.name
+}
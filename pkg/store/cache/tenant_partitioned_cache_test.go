@@ -0,0 +1,106 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package storecache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/cache"
+	"github.com/thanos-io/thanos/pkg/store/cache/cachekey"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestTenantPartitionedCache_NoCrossTenantEviction(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewTenantPartitionedCache("test", log.NewNopLogger(), prometheus.NewRegistry(), "tenant_id", cache.InMemoryCacheConfig{
+		MaxSize:     1000,
+		MaxItemSize: 100,
+	})
+	testutil.Ok(t, err)
+
+	blockA := ulid.MustNew(1, nil)
+	blockB := ulid.MustNew(2, nil)
+	testutil.Ok(t, c.Filter(ctx, map[ulid.ULID]*metadata.Meta{
+		blockA: {Thanos: metadata.Thanos{Labels: map[string]string{"tenant_id": "a"}}},
+		blockB: {Thanos: metadata.Thanos{Labels: map[string]string{"tenant_id": "b"}}},
+	}, nil, nil))
+
+	subrangeKey := func(id ulid.ULID, i int) string {
+		return cachekey.BucketCacheKey{Verb: cachekey.SubrangeVerb, Name: id.String() + "/chunks/000001", Start: int64(i * 100), End: int64((i + 1) * 100)}.String()
+	}
+
+	// Tenant b's hot items.
+	hot := map[string][]byte{}
+	for i := 0; i < 3; i++ {
+		hot[subrangeKey(blockB, i)] = make([]byte, 100)
+	}
+	c.Store(ctx, hot, time.Hour)
+	testutil.Equals(t, 3, len(c.Fetch(ctx, mapKeys(hot))))
+
+	// Tenant a churns through many more items than the whole cache can hold.
+	for i := 0; i < 50; i++ {
+		c.Store(ctx, map[string][]byte{subrangeKey(blockA, i): make([]byte, 100)}, time.Hour)
+	}
+	testutil.Equals(t, 3, len(c.Fetch(ctx, mapKeys(hot))))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(c.evicted.WithLabelValues("b")))
+	testutil.Assert(t, promtest.ToFloat64(c.evicted.WithLabelValues("a")) > 0, "tenant a should evict its own items")
+
+	// Both tenants get a half of the capacity.
+	testutil.Equals(t, 500.0, promtest.ToFloat64(c.maxSizeVec.WithLabelValues("a")))
+	testutil.Equals(t, 500.0, promtest.ToFloat64(c.sizeBytes.WithLabelValues("a")))
+	testutil.Equals(t, 300.0, promtest.ToFloat64(c.sizeBytes.WithLabelValues("b")))
+	testutil.Equals(t, 1, len(c.Fetch(ctx, []string{subrangeKey(blockA, 49)})))
+	testutil.Equals(t, 0, len(c.Fetch(ctx, []string{subrangeKey(blockA, 0)})))
+
+	// Keys of unknown blocks go to the partition of the empty tenant, which shrinks the share of the others.
+	unknown := cachekey.BucketCacheKey{Verb: cachekey.IterVerb, Name: ""}.String()
+	c.Store(ctx, map[string][]byte{unknown: []byte("iter")}, time.Hour)
+	testutil.Equals(t, 1, len(c.Fetch(ctx, []string{unknown})))
+	testutil.Equals(t, 333.0, promtest.ToFloat64(c.maxSizeVec.WithLabelValues("b")))
+	testutil.Equals(t, 300.0, promtest.ToFloat64(c.sizeBytes.WithLabelValues("b")))
+	testutil.Equals(t, 300.0, promtest.ToFloat64(c.sizeBytes.WithLabelValues("a")))
+
+	// Tenants without blocks anymore give their share back.
+	testutil.Ok(t, c.Filter(ctx, map[ulid.ULID]*metadata.Meta{
+		blockB: {Thanos: metadata.Thanos{Labels: map[string]string{"tenant_id": "b"}}},
+	}, nil, nil))
+	testutil.Equals(t, 2, len(c.partitions))
+	testutil.Equals(t, 500.0, promtest.ToFloat64(c.maxSizeVec.WithLabelValues("b")))
+	testutil.Equals(t, 3, len(c.Fetch(ctx, mapKeys(hot))))
+}
+
+func TestTenantPartitionedCache_TTLAndOverflow(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewTenantPartitionedCache("test", log.NewNopLogger(), nil, "tenant_id", cache.InMemoryCacheConfig{
+		MaxSize:     1000,
+		MaxItemSize: 100,
+	})
+	testutil.Ok(t, err)
+
+	c.Store(ctx, map[string][]byte{"expired": []byte("value")}, -time.Second)
+	testutil.Equals(t, 0, len(c.Fetch(ctx, []string{"expired"})))
+
+	c.Store(ctx, map[string][]byte{"big": make([]byte, 101)}, time.Hour)
+	testutil.Equals(t, 0, len(c.Fetch(ctx, []string{"big"})))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(c.overflow.WithLabelValues("")))
+
+	_, err = NewTenantPartitionedCache("test", log.NewNopLogger(), nil, "", cache.DefaultInMemoryCacheConfig)
+	testutil.NotOk(t, err)
+}
+
+func mapKeys(m map[string][]byte) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
@@ -0,0 +1,166 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const (
+	labelsCacheTypeNames  = "names"
+	labelsCacheTypeValues = "values"
+)
+
+// labelsCache caches the label names and label values of blocks, for a TTL. Empty results are cached as well,
+// since looking up labels missing from a block costs as many index reads as looking up existing ones.
+// Blocks never change once loaded, so entries only need to be dropped when their block is removed.
+type labelsCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mtx sync.Mutex
+	lru *lru.LRU
+
+	requests *prometheus.CounterVec
+	hits     *prometheus.CounterVec
+}
+
+type labelsCacheKey struct {
+	block ulid.ULID
+	typ   string
+	// label is the label name of label values, empty for label names.
+	label    string
+	matchers string
+	mint     int64
+	maxt     int64
+}
+
+type labelsCacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// newLabelsCache returns a cache of up to maxItems label names and values results, or nil if ttl is not positive.
+func newLabelsCache(reg prometheus.Registerer, ttl time.Duration, maxItems int) (*labelsCache, error) {
+	if ttl <= 0 {
+		return nil, nil
+	}
+
+	l, err := lru.NewLRU(maxItems, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &labelsCache{
+		ttl: ttl,
+		now: time.Now,
+		lru: l,
+		requests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_bucket_store_labels_cache_requests_total",
+			Help: "Total number of label names and values requests of blocks to the labels cache.",
+		}, []string{"item_type"}),
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_bucket_store_labels_cache_hits_total",
+			Help: "Total number of label names and values requests of blocks to the labels cache that were a hit.",
+		}, []string{"item_type"}),
+	}
+	for _, typ := range []string{labelsCacheTypeNames, labelsCacheTypeValues} {
+		c.requests.WithLabelValues(typ)
+		c.hits.WithLabelValues(typ)
+	}
+	return c, nil
+}
+
+// newLabelsCacheKey returns the key of the label names, or of the values of the label if not empty, of the block
+// for the series matchers and time range.
+func newLabelsCacheKey(b *bucketBlock, typ, label string, ms []*labels.Matcher, mint, maxt int64) labelsCacheKey {
+	// The part of the time range outside of the block doesn't change the result.
+	if mint < b.meta.MinTime {
+		mint = b.meta.MinTime
+	}
+	if maxt > b.meta.MaxTime {
+		maxt = b.meta.MaxTime
+	}
+
+	matchers := make([]string, 0, len(ms))
+	for _, m := range ms {
+		matchers = append(matchers, m.String())
+	}
+	return labelsCacheKey{
+		block:    b.meta.ULID,
+		typ:      typ,
+		label:    label,
+		matchers: strings.Join(matchers, ","),
+		mint:     mint,
+		maxt:     maxt,
+	}
+}
+
+// get returns the cached result, which can be empty, and true, or false if the result is not cached.
+func (c *labelsCache) get(key labelsCacheKey) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.requests.WithLabelValues(key.typ).Inc()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(labelsCacheEntry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(key)
+		return nil, false
+	}
+	c.hits.WithLabelValues(key.typ).Inc()
+	return e.values, true
+}
+
+func (c *labelsCache) set(key labelsCacheKey, values []string) {
+	if c == nil {
+		return
+	}
+
+	copied := make([]string, 0, len(values))
+	for _, v := range values {
+		copied = append(copied, detachString(v))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lru.Add(key, labelsCacheEntry{values: copied, expires: c.now().Add(c.ttl)})
+}
+
+// detachString returns a copy of the string which doesn't share its memory. Strings read from a block might
+// reference the memory mapped index header, which can be unloaded while they are cached.
+func detachString(s string) string {
+	return string([]byte(s))
+}
+
+// dropBlock removes the cached results of the block.
+func (c *labelsCache) dropBlock(id ulid.ULID) {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, k := range c.lru.Keys() {
+		if k.(labelsCacheKey).block == id {
+			c.lru.Remove(k)
+		}
+	}
+}
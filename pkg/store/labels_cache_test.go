@@ -0,0 +1,51 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestLabelsCache(t *testing.T) {
+	// A zero TTL disables the cache.
+	c, err := newLabelsCache(nil, 0, 10)
+	testutil.Ok(t, err)
+	testutil.Assert(t, c == nil)
+	c.set(labelsCacheKey{}, []string{"a"})
+	_, ok := c.get(labelsCacheKey{})
+	testutil.Assert(t, !ok)
+
+	b := &bucketBlock{meta: &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: 100, MaxTime: 200}}}
+	ms := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "a", "1")}
+
+	// Time ranges covering the whole block share the same key.
+	testutil.Equals(t,
+		newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 100, 200),
+		newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 0, 1000),
+	)
+	testutil.Assert(t, newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 150, 200) != newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 0, 1000))
+	testutil.Assert(t, newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 0, 1000) != newLabelsCacheKey(b, labelsCacheTypeValues, "b", nil, 0, 1000))
+	testutil.Assert(t, newLabelsCacheKey(b, labelsCacheTypeValues, "b", nil, 0, 1000) != newLabelsCacheKey(b, labelsCacheTypeNames, "", nil, 0, 1000))
+
+	c, err = newLabelsCache(nil, time.Minute, 1)
+	testutil.Ok(t, err)
+	key := newLabelsCacheKey(b, labelsCacheTypeValues, "b", ms, 0, 1000)
+	c.set(key, nil)
+	vals, ok := c.get(key)
+	testutil.Assert(t, ok)
+	testutil.Equals(t, 0, len(vals))
+
+	// The least recently used result is evicted beyond the max items.
+	c.set(newLabelsCacheKey(b, labelsCacheTypeValues, "c", ms, 0, 1000), []string{"1"})
+	_, ok = c.get(key)
+	testutil.Assert(t, !ok)
+}
@@ -4,11 +4,16 @@
 package store
 
 import (
+	"context"
 	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
 )
 
 type ChunksLimiter interface {
@@ -74,3 +79,168 @@ func NewSeriesLimiterFactory(limit uint64) SeriesLimiterFactory {
 		return NewLimiter(limit, failedCounter)
 	}
 }
+
+// memoryTracker tracks the bytes of chunk data held in memory by a single Series call, so that the call can be
+// aborted before it exhausts the memory of the store. A nil memoryTracker tracks nothing.
+type memoryTracker struct {
+	budget uint64
+	inUse  atomic.Uint64
+
+	// Counter metric which we will increase if the budget is exceeded.
+	failedCounter prometheus.Counter
+	failedOnce    sync.Once
+}
+
+// newMemoryTracker returns a memoryTracker with the given budget in bytes, or nil if the budget is 0.
+func newMemoryTracker(budget uint64, ctr prometheus.Counter) *memoryTracker {
+	if budget == 0 {
+		return nil
+	}
+	return &memoryTracker{budget: budget, failedCounter: ctr}
+}
+
+// Reserve tracks bytes about to be allocated. It returns a ResourceExhausted error, without tracking them,
+// if they would exceed the budget. This function is goroutine safe.
+func (t *memoryTracker) Reserve(bytes uint64) error {
+	if t == nil {
+		return nil
+	}
+	if inUse := t.inUse.Add(bytes); inUse > t.budget {
+		t.inUse.Sub(bytes)
+		t.failedOnce.Do(t.failedCounter.Inc)
+		return status.Errorf(codes.ResourceExhausted, "memory budget of %d bytes violated (got %d)", t.budget, inUse)
+	}
+	return nil
+}
+
+// Release stops tracking bytes previously reserved.
+func (t *memoryTracker) Release(bytes uint64) {
+	if t == nil {
+		return
+	}
+	t.inUse.Sub(bytes)
+}
+
+// TenantGRPCMetadataKey is the gRPC metadata key of the tenant of Series requests, whose request limits apply to them.
+// ProxyStore forwards the tenant of its requests to stores with it.
+const TenantGRPCMetadataKey = "thanos-tenant"
+
+// RequestLimits are the limits of a single Series request. 0 means no limit.
+type RequestLimits struct {
+	// Series is the maximum number of series touched, checked once the postings of each block are expanded.
+	Series uint64
+	// Samples is the maximum number of samples returned, checked as chunks are read.
+	Samples uint64
+}
+
+// TenantRequestLimits are the request limits of the tenants: the default limits, overridden for some tenants.
+type TenantRequestLimits struct {
+	defaults RequestLimits
+	tenants  map[string]RequestLimits
+}
+
+type requestLimitsOverrides struct {
+	Series  *uint64 `yaml:"request_series"`
+	Samples *uint64 `yaml:"request_samples"`
+}
+
+type requestLimitsConfig struct {
+	Tenants map[string]requestLimitsOverrides `yaml:"tenants"`
+}
+
+// ParseTenantRequestLimits returns the default request limits, overridden for the tenants of the YAML content. The
+// limits a tenant doesn't override are the default ones.
+func ParseTenantRequestLimits(defaults RequestLimits, content []byte) (*TenantRequestLimits, error) {
+	var conf requestLimitsConfig
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return nil, errors.Wrap(err, "parse request limits config")
+	}
+
+	l := &TenantRequestLimits{defaults: defaults, tenants: make(map[string]RequestLimits, len(conf.Tenants))}
+	for tenant, o := range conf.Tenants {
+		limits := defaults
+		if o.Series != nil {
+			limits.Series = *o.Series
+		}
+		if o.Samples != nil {
+			limits.Samples = *o.Samples
+		}
+		l.tenants[tenant] = limits
+	}
+	return l, nil
+}
+
+// ForTenant returns the request limits of the tenant. A nil TenantRequestLimits has no limits.
+func (l *TenantRequestLimits) ForTenant(tenant string) RequestLimits {
+	if l == nil {
+		return RequestLimits{}
+	}
+	if limits, ok := l.tenants[tenant]; ok {
+		return limits
+	}
+	return l.defaults
+}
+
+// TenantFromContext returns the tenant of the request: the one set with TenantKey or else the one of the incoming
+// gRPC request, or an empty string if it has none.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(TenantKey).(string); ok {
+		return tenant
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(TenantGRPCMetadataKey); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// requestLimiter enforces the RequestLimits of a single Series call. A nil requestLimiter enforces nothing.
+type requestLimiter struct {
+	limits  RequestLimits
+	series  atomic.Uint64
+	samples atomic.Uint64
+
+	// Counter metric which we will increase, by reason, if a limit is exceeded.
+	limitedCounter *prometheus.CounterVec
+	limitedOnce    sync.Once
+}
+
+// newRequestLimiter returns a requestLimiter enforcing the limits, or nil if there are none.
+func newRequestLimiter(limits RequestLimits, limitedCounter *prometheus.CounterVec) *requestLimiter {
+	if limits.Series == 0 && limits.Samples == 0 {
+		return nil
+	}
+	return &requestLimiter{limits: limits, limitedCounter: limitedCounter}
+}
+
+// ReserveSeries reserves num series out of the series limit. It returns a ResourceExhausted error if the limit is
+// exceeded. This function is goroutine safe.
+func (l *requestLimiter) ReserveSeries(num uint64) error {
+	if l == nil {
+		return nil
+	}
+	return l.reserve(&l.series, num, l.limits.Series, "series")
+}
+
+// ReserveSamples reserves num samples out of the samples limit. It returns a ResourceExhausted error if the limit is
+// exceeded. This function is goroutine safe.
+func (l *requestLimiter) ReserveSamples(num uint64) error {
+	if l == nil {
+		return nil
+	}
+	return l.reserve(&l.samples, num, l.limits.Samples, "samples")
+}
+
+func (l *requestLimiter) reserve(reserved *atomic.Uint64, num, limit uint64, reason string) error {
+	if limit == 0 {
+		return nil
+	}
+	if got := reserved.Add(num); got > limit {
+		l.limitedOnce.Do(l.limitedCounter.WithLabelValues(reason).Inc)
+		return status.Errorf(codes.ResourceExhausted, "request %s limit of %d exceeded (got %d)", reason, limit, got)
+	}
+	return nil
+}
@@ -28,3 +28,69 @@ func TestLimiter(t *testing.T) {
 	testutil.NotOk(t, l.Reserve(2))
 	testutil.Equals(t, float64(1), prom_testutil.ToFloat64(c))
 }
+
+func TestMemoryTracker(t *testing.T) {
+	c := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	m := newMemoryTracker(10, c)
+
+	testutil.Ok(t, m.Reserve(8))
+	testutil.NotOk(t, m.Reserve(3))
+	testutil.Equals(t, float64(1), prom_testutil.ToFloat64(c))
+
+	// Bytes over the budget are not tracked, and released bytes can be reserved again.
+	testutil.Ok(t, m.Reserve(2))
+	m.Release(5)
+	testutil.Ok(t, m.Reserve(5))
+	testutil.NotOk(t, m.Reserve(1))
+	testutil.Equals(t, float64(1), prom_testutil.ToFloat64(c))
+
+	// No budget tracks nothing.
+	m = newMemoryTracker(0, c)
+	testutil.Ok(t, m.Reserve(1<<40))
+	m.Release(1 << 40)
+}
+
+func TestParseTenantRequestLimits(t *testing.T) {
+	l, err := ParseTenantRequestLimits(RequestLimits{Series: 10, Samples: 100}, []byte(`
+tenants:
+  a:
+    request_series: 20
+  b:
+    request_series: 0
+    request_samples: 200
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, RequestLimits{Series: 20, Samples: 100}, l.ForTenant("a"))
+	testutil.Equals(t, RequestLimits{Series: 0, Samples: 200}, l.ForTenant("b"))
+	testutil.Equals(t, RequestLimits{Series: 10, Samples: 100}, l.ForTenant("c"))
+	testutil.Equals(t, RequestLimits{Series: 10, Samples: 100}, l.ForTenant(""))
+
+	_, err = ParseTenantRequestLimits(RequestLimits{}, []byte(`
+tenants:
+  a:
+    request_chunks: 20
+`))
+	testutil.NotOk(t, err)
+
+	// No limits config keeps the defaults.
+	l, err = ParseTenantRequestLimits(RequestLimits{Series: 10}, nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, RequestLimits{Series: 10}, l.ForTenant("a"))
+}
+
+func TestRequestLimiter(t *testing.T) {
+	c := promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
+	l := newRequestLimiter(RequestLimits{Samples: 10}, c)
+
+	testutil.Ok(t, l.ReserveSeries(1000))
+	testutil.Ok(t, l.ReserveSamples(10))
+	testutil.NotOk(t, l.ReserveSamples(1))
+	testutil.NotOk(t, l.ReserveSamples(1))
+	testutil.Equals(t, float64(1), prom_testutil.ToFloat64(c.WithLabelValues("samples")))
+	testutil.Equals(t, float64(0), prom_testutil.ToFloat64(c.WithLabelValues("series")))
+
+	// No limits enforce nothing.
+	l = newRequestLimiter(RequestLimits{}, c)
+	testutil.Ok(t, l.ReserveSeries(1<<40))
+	testutil.Ok(t, l.ReserveSamples(1<<40))
+}
@@ -246,6 +246,15 @@ func (s *LocalStore) LabelValues(_ context.Context, r *storepb.LabelValuesReques
 	return resp, nil
 }
 
+// LabelValuesStream returns all known label values for a given label name, split into chunks of bounded size.
+func (s *LocalStore) LabelValuesStream(r *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), r)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
+
 func (s *LocalStore) Close() (err error) {
 	return s.c.Close()
 }
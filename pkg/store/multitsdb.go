@@ -62,7 +62,8 @@ func (s *MultiTSDBStore) Info(ctx context.Context, req *storepb.InfoRequest) (*s
 	stores := s.tsdbStores()
 
 	resp := &storepb.InfoResponse{
-		StoreType: s.component.ToProto(),
+		StoreType:                 s.component.ToProto(),
+		SupportsLabelValuesStream: true,
 	}
 	if len(stores) == 0 {
 		return resp, nil
@@ -386,3 +387,12 @@ func (s *MultiTSDBStore) LabelValues(ctx context.Context, req *storepb.LabelValu
 		Warnings: keys(warnings),
 	}, nil
 }
+
+// LabelValuesStream returns all known label values for a given label name, split into chunks of bounded size.
+func (s *MultiTSDBStore) LabelValuesStream(req *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), req)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
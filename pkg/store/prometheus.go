@@ -693,6 +693,15 @@ func (p *PrometheusStore) LabelValues(ctx context.Context, r *storepb.LabelValue
 	return &storepb.LabelValuesResponse{Values: vals}, nil
 }
 
+// LabelValuesStream returns all known label values for a given label name, split into chunks of bounded size.
+func (p *PrometheusStore) LabelValuesStream(r *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := p.LabelValues(srv.Context(), r)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
+
 func (p *PrometheusStore) LabelSet() []labelpb.ZLabelSet {
 	lset := p.externalLabelsFn()
 
@@ -20,12 +20,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/labels"
+	promgate "github.com/prometheus/prometheus/util/gate"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/gate"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/strutil"
@@ -34,8 +37,125 @@ import (
 
 type ctxKey int
 
-// StoreMatcherKey is the context key for the store's allow list.
-const StoreMatcherKey = ctxKey(0)
+const (
+	// StoreMatcherKey is the context key for the store's allow list.
+	StoreMatcherKey = ctxKey(0)
+	// PartialResponseTrackerKey is the context key for the PartialResponseTracker collecting
+	// stores which failed while the request was served with partial response.
+	PartialResponseTrackerKey = ctxKey(1)
+	// StoreTypeFilterKey is the context key for the StoreTypeFilter restricting the queried stores by their component type.
+	StoreTypeFilterKey = ctxKey(2)
+	// NoCacheKey is the context key marking requests for which stores should bypass their caches.
+	NoCacheKey = ctxKey(3)
+	// TenantKey is the context key of the tenant of the request, which ProxyStore forwards to stores as
+	// TenantGRPCMetadataKey gRPC metadata.
+	TenantKey = ctxKey(4)
+)
+
+// StoreTypeFilter restricts the stores a request is proxied to by their component type.
+type StoreTypeFilter struct {
+	// Types are the component types of the stores to query.
+	Types []component.StoreAPI
+	// Exclude inverts the filter, so only stores of other types are queried. Stores which
+	// don't report their type are queried only with this set.
+	Exclude bool
+}
+
+// componentTyper is implemented by clients which know the component type of the store behind them.
+type componentTyper interface {
+	ComponentType() component.Component
+}
+
+// labelValuesStreamer is implemented by clients which know whether the store behind them supports the
+// streaming LabelValues method.
+type labelValuesStreamer interface {
+	SupportsLabelValuesStream() bool
+}
+
+// queryPushdowner is implemented by clients which know whether the store behind them evaluates pushed down range
+// functions.
+type queryPushdowner interface {
+	SupportsQueryPushdown() bool
+}
+
+func supportsQueryPushdown(st Client) bool {
+	qp, ok := st.(queryPushdowner)
+	return ok && qp.SupportsQueryPushdown()
+}
+
+func (f StoreTypeFilter) matches(s Client) bool {
+	ct, ok := s.(componentTyper)
+	if !ok || ct.ComponentType() == nil {
+		return f.Exclude
+	}
+	for _, t := range f.Types {
+		if ct.ComponentType().String() == t.String() {
+			return !f.Exclude
+		}
+	}
+	return f.Exclude
+}
+
+// FailedStore describes a store which failed to return data for a request served with partial response.
+type FailedStore struct {
+	Name      string          `json:"name"`
+	Addr      string          `json:"address"`
+	LabelSets []labels.Labels `json:"labelSets"`
+	MinTime   int64           `json:"minTime"`
+	MaxTime   int64           `json:"maxTime"`
+	Error     string          `json:"error"`
+}
+
+// PartialResponseTracker collects stores which failed during a request served with partial response.
+// It is safe for concurrent use.
+type PartialResponseTracker struct {
+	mtx    sync.Mutex
+	failed []FailedStore
+	seen   map[string]struct{}
+}
+
+// NewPartialResponseTracker returns new, empty PartialResponseTracker.
+func NewPartialResponseTracker() *PartialResponseTracker {
+	return &PartialResponseTracker{seen: map[string]struct{}{}}
+}
+
+// add records a failure of the given store. Only the first failure of each store is kept.
+func (t *PartialResponseTracker) add(st Client, err error) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if _, ok := t.seen[st.String()]; ok {
+		return
+	}
+	t.seen[st.String()] = struct{}{}
+
+	mint, maxt := st.TimeRange()
+	t.failed = append(t.failed, FailedStore{
+		Name:      st.String(),
+		Addr:      st.Addr(),
+		LabelSets: st.LabelSets(),
+		MinTime:   mint,
+		MaxTime:   maxt,
+		Error:     err.Error(),
+	})
+}
+
+// FailedStores returns stores which failed so far, in order of their first failure.
+func (t *PartialResponseTracker) FailedStores() []FailedStore {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return append([]FailedStore(nil), t.failed...)
+}
+
+// partialResponseTrackerFromContext returns the PartialResponseTracker attached to the context, if any.
+func partialResponseTrackerFromContext(ctx context.Context) *PartialResponseTracker {
+	t, _ := ctx.Value(PartialResponseTrackerKey).(*PartialResponseTracker)
+	return t
+}
 
 // Client holds meta information about a store.
 type Client interface {
@@ -60,12 +180,18 @@ type ProxyStore struct {
 	component      component.StoreAPI
 	selectorLabels labels.Labels
 
-	responseTimeout time.Duration
-	metrics         *proxyStoreMetrics
+	responseTimeout      time.Duration
+	maxConcurrentSelects int
+	hedgingDelay         time.Duration
+	metrics              *proxyStoreMetrics
 }
 
 type proxyStoreMetrics struct {
 	emptyStreamResponses prometheus.Counter
+	inflightSelects      prometheus.Gauge
+	selectWaitDuration   prometheus.Histogram
+	hedgedRequests       prometheus.Counter
+	hedgedRequestsWon    prometheus.Counter
 }
 
 func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
@@ -75,10 +201,49 @@ func newProxyStoreMetrics(reg prometheus.Registerer) *proxyStoreMetrics {
 		Name: "thanos_proxy_store_empty_stream_responses_total",
 		Help: "Total number of empty responses received.",
 	})
+	m.inflightSelects = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_proxy_store_inflight_selects",
+		Help: "Number of Series calls to stores currently in flight, when they are limited per select.",
+	})
+	m.selectWaitDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_proxy_store_select_wait_duration_seconds",
+		Help:    "How many seconds Series calls to stores waited for a free slot, when they are limited per select.",
+		Buckets: gate.DurationHistogramOpts.Buckets,
+	})
+	m.hedgedRequests = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_hedged_requests_total",
+		Help: "Total number of Series calls hedged to a replica of the store, because the store didn't respond within the hedging delay.",
+	})
+	m.hedgedRequestsWon = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "thanos_proxy_store_hedged_requests_won_total",
+		Help: "Total number of hedged Series calls to which the replica responded first.",
+	})
 
 	return &m
 }
 
+// ProxyStoreOption overrides options of the ProxyStore.
+type ProxyStoreOption func(s *ProxyStore)
+
+// WithMaxConcurrentSelects limits the number of Series calls made concurrently to stores for a single Series request
+// of the proxy. Calls over the limit wait for a free slot, until the request context is done. A call holds its slot
+// until its store finished streaming, the series being buffered in memory meanwhile. 0 means no limit.
+func WithMaxConcurrentSelects(n int) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.maxConcurrentSelects = n
+	}
+}
+
+// WithHedgingDelay enables hedging of Series calls. Stores of the same component type with the same external labels and
+// time range are considered replicas of each other, and only one of them is called. If it didn't respond after the given
+// delay, or failed before, the call is hedged to another replica, and the stream of the replica responding first is used
+// while the other one is canceled. 0 disables hedging.
+func WithHedgingDelay(d time.Duration) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.hedgingDelay = d
+	}
+}
+
 func RegisterStoreServer(storeSrv storepb.StoreServer) func(*grpc.Server) {
 	return func(s *grpc.Server) {
 		storepb.RegisterStoreServer(s, storeSrv)
@@ -94,6 +259,7 @@ func NewProxyStore(
 	component component.StoreAPI,
 	selectorLabels labels.Labels,
 	responseTimeout time.Duration,
+	options ...ProxyStoreOption,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -108,6 +274,9 @@ func NewProxyStore(
 		responseTimeout: responseTimeout,
 		metrics:         metrics,
 	}
+	for _, option := range options {
+		option(s)
+	}
 	return s
 }
 
@@ -255,7 +424,12 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	}
 	storeMatchers, _ := storepb.PromMatchersToMatchers(matchers...) // Error would be returned by matchesExternalLabels, so skip check.
 
-	g, gctx := errgroup.WithContext(srv.Context())
+	ctx := srv.Context()
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, TenantGRPCMetadataKey, tenant)
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	tracker := partialResponseTrackerFromContext(srv.Context())
 
 	// Allow to buffer max 10 series response.
 	// Each might be quite large (multi chunk long series given by sidecar).
@@ -268,6 +442,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		var (
 			seriesSet      []storepb.SeriesSet
 			storeDebugMsgs []string
+			pushdown       = r.Pushdown
 			r              = &storepb.SeriesRequest{
 				MinTime:                 r.MinTime,
 				MaxTime:                 r.MaxTime,
@@ -279,19 +454,50 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				PartialResponseDisabled: r.PartialResponseDisabled,
 			}
 			wg = &sync.WaitGroup{}
+			// selectGate limits the number of concurrent Series calls, nil if unlimited.
+			selectGate gate.Gate
 		)
+		if s.maxConcurrentSelects > 0 {
+			selectGate = gate.InstrumentGateDuration(s.metrics.selectWaitDuration,
+				gate.InstrumentGateInFlight(s.metrics.inflightSelects, promgate.New(s.maxConcurrentSelects)))
+		}
 
 		defer func() {
 			wg.Wait()
 			close(respCh)
 		}()
 
+		var stores []Client
 		for _, st := range s.stores() {
 			// We might be able to skip the store if its meta information indicates it cannot have series matching our query.
 			if ok, reason := storeMatches(gctx, st, r.MinTime, r.MaxTime, matchers...); !ok {
 				storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("store %s filtered out: %v", st, reason))
 				continue
 			}
+			stores = append(stores, st)
+		}
+		// hedges are the replicas Series calls to stores are hedged to, nil for stores without replicas.
+		hedges := make([]Client, len(stores))
+		if s.hedgingDelay > 0 {
+			stores, hedges = groupReplicas(stores)
+		}
+		// Range functions are only pushed down to a single store, as the series of several stores would be merged
+		// after evaluation instead of before.
+		if pushdown != nil && len(stores) == 1 && supportsQueryPushdown(stores[0]) && (hedges[0] == nil || supportsQueryPushdown(hedges[0])) {
+			r.Pushdown = pushdown
+		}
+
+		for i, st := range stores {
+
+			// Wait for a free slot. Streams started before release it once they are fully buffered, so it can't deadlock
+			// even though the merge below needs all of them.
+			var release func()
+			if selectGate != nil {
+				if err := selectGate.Start(gctx); err != nil {
+					return errors.Wrapf(err, "wait to fetch series from %s", st)
+				}
+				release = selectGate.Done
+			}
 
 			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
 
@@ -311,15 +517,27 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				"store.addr": st.Addr(),
 			})
 
-			sc, err := st.Series(seriesCtx, r)
+			var (
+				sc  storepb.Store_SeriesClient
+				err error
+			)
+			if hedges[i] != nil {
+				sc, err = s.hedgedSeries(seriesCtx, st, hedges[i], r)
+			} else {
+				sc, err = st.Series(seriesCtx, r)
+			}
 			if err != nil {
 				err = errors.Wrapf(err, "fetch series for %s %s", storeID, st)
 				span.SetTag("err", err.Error())
 				span.Finish()
+				if release != nil {
+					release()
+				}
 				if r.PartialResponseDisabled {
 					level.Error(reqLogger).Log("err", err, "msg", "partial response disabled; aborting request")
 					return err
 				}
+				tracker.add(st, err)
 				respSender.send(storepb.NewWarnSeriesResponse(err))
 				continue
 			}
@@ -327,7 +545,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 			// Schedule streamSeriesSet that translates gRPC streamed response
 			// into seriesSet (if series) or respCh if warnings.
 			seriesSet = append(seriesSet, startStreamSeriesSet(seriesCtx, reqLogger, span, closeSeries,
-				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses))
+				wg, sc, respSender, st, tracker, !r.PartialResponseDisabled, s.responseTimeout, s.metrics.emptyStreamResponses, release))
 		}
 
 		level.Debug(reqLogger).Log("msg", "Series: started fanout streams", "status", strings.Join(storeDebugMsgs, ";"))
@@ -389,6 +607,8 @@ type streamSeriesSet struct {
 	err    error
 
 	name            string
+	store           Client
+	tracker         *PartialResponseTracker
 	partialResponse bool
 
 	responseTimeout time.Duration
@@ -418,10 +638,12 @@ func startStreamSeriesSet(
 	wg *sync.WaitGroup,
 	stream storepb.Store_SeriesClient,
 	warnCh directSender,
-	name string,
+	st Client,
+	tracker *PartialResponseTracker,
 	partialResponse bool,
 	responseTimeout time.Duration,
 	emptyStreamResponses prometheus.Counter,
+	release func(),
 ) *streamSeriesSet {
 	s := &streamSeriesSet{
 		ctx:             ctx,
@@ -430,7 +652,9 @@ func startStreamSeriesSet(
 		stream:          stream,
 		warnCh:          warnCh,
 		recvCh:          make(chan *storepb.Series, 10),
-		name:            name,
+		name:            st.String(),
+		store:           st,
+		tracker:         tracker,
 		partialResponse: partialResponse,
 		responseTimeout: responseTimeout,
 	}
@@ -457,6 +681,13 @@ func startStreamSeriesSet(
 			}
 		}()
 
+		// With a release function, series are buffered until the stream ends, so that the slot of the stream is released
+		// before they are consumed.
+		var (
+			buffered  []*storepb.Series
+			completed bool
+		)
+
 		rCh := make(chan *recvResponse)
 		done := make(chan struct{})
 		go func() {
@@ -487,6 +718,7 @@ func startStreamSeriesSet(
 			}
 
 			if rr.err == io.EOF {
+				completed = true
 				close(done)
 				return false
 			}
@@ -505,6 +737,10 @@ func startStreamSeriesSet(
 			if series := rr.r.GetSeries(); series != nil {
 				seriesStats.Count(series)
 
+				if release != nil {
+					buffered = append(buffered, series)
+					return true
+				}
 				select {
 				case s.recvCh <- series:
 				case <-ctx.Done():
@@ -514,8 +750,20 @@ func startStreamSeriesSet(
 			}
 			return true
 		}
-		for {
-			if !handleRecvResponse() {
+		for handleRecvResponse() {
+		}
+		if release == nil {
+			return
+		}
+		release()
+		// Series of failed streams are dropped, the error being handled already.
+		if !completed {
+			return
+		}
+		for _, series := range buffered {
+			select {
+			case s.recvCh <- series:
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -529,6 +777,7 @@ func (s *streamSeriesSet) handleErr(err error, done chan struct{}) {
 
 	if s.partialResponse {
 		level.Warn(s.logger).Log("err", err, "msg", "returning partial response")
+		s.tracker.add(s.store, err)
 		s.warnCh.send(storepb.NewWarnSeriesResponse(err))
 		return
 	}
@@ -578,6 +827,10 @@ func storeMatches(ctx context.Context, s Client, mint, maxt int64, matchers ...*
 		return false, reason
 	}
 
+	if f, ok := ctx.Value(StoreTypeFilterKey).(StoreTypeFilter); ok && !f.matches(s) {
+		return false, "store type does not match the requested store types"
+	}
+
 	extLset := s.LabelSets()
 	if !labelSetsMatch(matchers, extLset...) {
 		return false, fmt.Sprintf("external labels %v does not match request label matchers: %v", extLset, matchers)
@@ -706,7 +959,7 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("Store %s queried", st))
 
 		g.Go(func() error {
-			resp, err := st.LabelValues(gctx, &storepb.LabelValuesRequest{
+			resp, err := labelValues(gctx, st, &storepb.LabelValuesRequest{
 				Label:                   r.Label,
 				PartialResponseDisabled: r.PartialResponseDisabled,
 				Start:                   r.Start,
@@ -744,3 +997,43 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		Warnings: warnings,
 	}, nil
 }
+
+// labelValues fetches the label values from the given store. Stores supporting it are queried with the streaming
+// method and their chunks are merged back together, so large responses don't exceed the max message size.
+func labelValues(ctx context.Context, st Client, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	if ls, ok := st.(labelValuesStreamer); !ok || !ls.SupportsLabelValuesStream() {
+		return st.LabelValues(ctx, r)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := st.LabelValuesStream(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	resp := &storepb.LabelValuesResponse{}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return resp, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Values = append(resp.Values, chunk.Values...)
+		resp.Warnings = append(resp.Warnings, chunk.Warnings...)
+		if chunk.Hints != nil {
+			resp.Hints = chunk.Hints
+		}
+	}
+}
+
+// LabelValuesStream returns all known label values for a given label name, split into chunks of bounded size.
+func (s *ProxyStore) LabelValuesStream(r *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), r)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
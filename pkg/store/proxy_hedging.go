@@ -0,0 +1,156 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/store/labelpb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// replicaGroupKey returns the key of the group of replicas the store belongs to, or "" if it's never considered a
+// replica. Stores sharing external labels can still hold different data, e.g. a sidecar and a store gateway for the same
+// Prometheus, or store gateways sharded by time. So replicas have to be of the same component type and cover the same
+// time range too. Stores without external labels or without a known component type are never considered replicas.
+func replicaGroupKey(st Client) string {
+	lsets := labelpb.PromLabelSetsToString(st.LabelSets())
+	ct, ok := st.(componentTyper)
+	if lsets == "" || !ok || ct.ComponentType() == nil {
+		return ""
+	}
+	mint, maxt := st.TimeRange()
+	return fmt.Sprintf("%s/%d/%d/%s", ct.ComponentType(), mint, maxt, lsets)
+}
+
+// groupReplicas keeps a single store out of every group of replicas, in the original order, and returns for each of
+// them another store of its group to hedge Series calls to, or nil if it has no replica.
+func groupReplicas(stores []Client) (primaries, hedges []Client) {
+	groups := map[string]int{}
+	for _, st := range stores {
+		key := replicaGroupKey(st)
+		if key == "" {
+			primaries = append(primaries, st)
+			hedges = append(hedges, nil)
+			continue
+		}
+		i, ok := groups[key]
+		if !ok {
+			groups[key] = len(primaries)
+			primaries = append(primaries, st)
+			hedges = append(hedges, nil)
+			continue
+		}
+		if hedges[i] == nil {
+			hedges[i] = st
+		}
+	}
+	return primaries, hedges
+}
+
+// seriesAttempt is the outcome of a Series call up to its first response.
+type seriesAttempt struct {
+	sc     storepb.Store_SeriesClient
+	first  *storepb.SeriesResponse
+	err    error
+	hedged bool
+}
+
+func (a seriesAttempt) failed() bool {
+	return a.err != nil && a.err != io.EOF
+}
+
+// client returns the stream of the attempt, starting from the first response already received.
+func (a seriesAttempt) client() storepb.Store_SeriesClient {
+	return &hedgedSeriesClient{Store_SeriesClient: a.sc, first: a.first, firstErr: a.err}
+}
+
+// hedgedSeriesClient is the Series stream of the replica which responded first.
+type hedgedSeriesClient struct {
+	storepb.Store_SeriesClient
+
+	received bool
+	first    *storepb.SeriesResponse
+	firstErr error
+}
+
+func (c *hedgedSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	if !c.received {
+		c.received = true
+		return c.first, c.firstErr
+	}
+	return c.Store_SeriesClient.Recv()
+}
+
+// hedgedSeries calls Series on the store, and on its replica too if the store didn't respond within the hedging
+// delay or failed before it. The stream of the first one to respond is returned and the other call is canceled. If one
+// of them fails, the other one is waited for, and the outcome of the store is returned if both fail.
+func (s *ProxyStore) hedgedSeries(ctx context.Context, st, replica Client, r *storepb.SeriesRequest) (storepb.Store_SeriesClient, error) {
+	var (
+		// Buffered, so that the goroutine of the canceled call doesn't block.
+		attempts = make(chan seriesAttempt, 2)
+		cancels  = map[bool]context.CancelFunc{}
+		pending  int
+	)
+	start := func(st Client, hedged bool) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[hedged] = cancel
+		pending++
+		go func() {
+			a := seriesAttempt{hedged: hedged}
+			a.sc, a.err = st.Series(attemptCtx, r)
+			if a.err == nil {
+				a.first, a.err = a.sc.Recv()
+			}
+			attempts <- a
+		}()
+	}
+
+	hedge := func() {
+		if _, ok := cancels[true]; !ok {
+			s.metrics.hedgedRequests.Inc()
+			start(replica, true)
+		}
+	}
+
+	timer := time.NewTimer(s.hedgingDelay)
+	defer timer.Stop()
+
+	start(st, false)
+	var failed *seriesAttempt
+	for {
+		select {
+		case <-timer.C:
+			hedge()
+		case a := <-attempts:
+			pending--
+			if a.failed() {
+				// The replica is called right away if the store failed before the hedging delay.
+				hedge()
+				if pending > 0 {
+					failed = &a
+					continue
+				}
+				if failed != nil && !failed.hedged {
+					a = *failed
+				}
+				if a.sc == nil {
+					return nil, a.err
+				}
+				return a.client(), nil
+			}
+
+			if cancel, ok := cancels[!a.hedged]; ok {
+				cancel()
+			}
+			if a.hedged {
+				s.metrics.hedgedRequestsWon.Inc()
+			}
+			return a.client(), nil
+		}
+	}
+}
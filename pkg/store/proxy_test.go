@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"math"
 	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,6 +20,8 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
 	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
@@ -37,9 +40,12 @@ type testClient struct {
 	// Just to pass interface check.
 	storepb.StoreClient
 
-	labelSets []labels.Labels
-	minTime   int64
-	maxTime   int64
+	labelSets                 []labels.Labels
+	minTime                   int64
+	maxTime                   int64
+	supportsLabelValuesStream bool
+	supportsQueryPushdown     bool
+	storeType                 component.Component
 }
 
 func (c testClient) LabelSets() []labels.Labels {
@@ -50,6 +56,18 @@ func (c testClient) TimeRange() (int64, int64) {
 	return c.minTime, c.maxTime
 }
 
+func (c testClient) SupportsLabelValuesStream() bool {
+	return c.supportsLabelValuesStream
+}
+
+func (c testClient) SupportsQueryPushdown() bool {
+	return c.supportsQueryPushdown
+}
+
+func (c testClient) ComponentType() component.Component {
+	return c.storeType
+}
+
 func (c testClient) String() string {
 	return "test"
 }
@@ -501,6 +519,79 @@ func TestProxyStore_Series(t *testing.T) {
 	}
 }
 
+func TestProxyStore_Series_PartialResponseTracker(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	for _, tc := range []struct {
+		title       string
+		failingAPI  *mockedStoreAPI
+		expectedErr string
+	}{
+		{
+			title:       "store fails to start series stream",
+			failingAPI:  &mockedStoreAPI{RespError: errors.New("error!")},
+			expectedErr: "fetch series for {ext=\"2\"} test: error!",
+		},
+		{
+			title: "store fails while streaming series",
+			failingAPI: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{0, 0}}),
+				},
+				injectedError: errors.New("error!"),
+			},
+			expectedErr: "receive series from test: error!",
+		},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			q := NewProxyStore(nil,
+				nil,
+				func() []Client {
+					return []Client{
+						&testClient{
+							StoreClient: &mockedStoreAPI{
+								RespSeries: []*storepb.SeriesResponse{
+									storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}, {2, 1}}),
+								},
+							},
+							minTime:   1,
+							maxTime:   300,
+							labelSets: []labels.Labels{labels.FromStrings("ext", "1")},
+						},
+						&testClient{
+							StoreClient: tc.failingAPI,
+							minTime:     100,
+							maxTime:     200,
+							labelSets:   []labels.Labels{labels.FromStrings("ext", "2")},
+						},
+					}
+				},
+				component.Query,
+				nil,
+				0*time.Second,
+			)
+
+			tracker := NewPartialResponseTracker()
+			s := newStoreSeriesServer(context.WithValue(context.Background(), PartialResponseTrackerKey, tracker))
+			testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+				MinTime:  1,
+				MaxTime:  300,
+				Matchers: []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+			}, s))
+
+			testutil.Equals(t, 1, len(s.Warnings), "got %v", s.Warnings)
+			testutil.Equals(t, []FailedStore{{
+				Name:      "test",
+				Addr:      "testaddr",
+				LabelSets: []labels.Labels{labels.FromStrings("ext", "2")},
+				MinTime:   100,
+				MaxTime:   200,
+				Error:     tc.expectedErr,
+			}}, tracker.FailedStores())
+		})
+	}
+}
+
 func TestProxyStore_SeriesSlowStores(t *testing.T) {
 	enable := os.Getenv("THANOS_ENABLE_STORE_READ_TIMEOUT_TESTS")
 	if enable == "" {
@@ -1070,6 +1161,51 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 	testutil.Assert(t, proto.Equal(req, m.LastSeriesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", req, m.LastSeriesReq)
 }
 
+func TestProxyStore_Series_Pushdown(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	req := &storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+		Pushdown: &storepb.Pushdown{Func: "sum_over_time", RangeMillis: 100, Start: 101, End: 300, StepMillis: 10},
+	}
+	for _, tc := range []struct {
+		name             string
+		supportPushdown  []bool
+		expectedPushdown bool
+	}{
+		{name: "single store supporting pushdown", supportPushdown: []bool{true}, expectedPushdown: true},
+		{name: "single store not supporting pushdown", supportPushdown: []bool{false}},
+		{name: "several stores supporting pushdown", supportPushdown: []bool{true, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				cls    []Client
+				stores []*mockedStoreAPI
+			)
+			for i, supported := range tc.supportPushdown {
+				m := &mockedStoreAPI{}
+				stores = append(stores, m)
+				cls = append(cls, &testClient{
+					StoreClient:           m,
+					labelSets:             []labels.Labels{labels.FromStrings("ext", fmt.Sprintf("%d", i))},
+					minTime:               1,
+					maxTime:               300,
+					supportsQueryPushdown: supported,
+				})
+			}
+			q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second)
+
+			testutil.Ok(t, q.Series(req, newStoreSeriesServer(context.Background())))
+			for _, m := range stores {
+				testutil.Equals(t, tc.expectedPushdown, m.LastSeriesReq.Pushdown != nil)
+			}
+			testutil.Assert(t, req.Pushdown != nil, "pushdown removed from the request")
+		})
+	}
+}
+
 func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1125,6 +1261,182 @@ func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	testutil.Equals(t, 110, len(s.Warnings))
 }
 
+func TestProxyStore_Series_MaxConcurrentSelects(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	// More series per store than the stream buffers, so that streams holding a slot have to buffer them.
+	var cls []Client
+	for i := 0; i < 5; i++ {
+		var resps []*storepb.SeriesResponse
+		for j := 0; j < 20; j++ {
+			resps = append(resps, storeSeriesResponse(t, labels.FromStrings("store", fmt.Sprint(i), "series", fmt.Sprintf("%02d", j)), []sample{{1, 1}}))
+		}
+		cls = append(cls, &testClient{
+			StoreClient: &mockedStoreAPI{RespSeries: resps},
+			minTime:     1,
+			maxTime:     300,
+		})
+	}
+	cls = append(cls, &testClient{
+		StoreClient: &mockedStoreAPI{RespError: errors.New("test error")},
+		minTime:     1,
+		maxTime:     300,
+	})
+
+	q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithMaxConcurrentSelects(2))
+	req := &storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "series", Value: ".*", Type: storepb.LabelMatcher_RE}},
+	}
+
+	s := newStoreSeriesServer(context.Background())
+	testutil.Ok(t, q.Series(req, s))
+	testutil.Equals(t, 100, len(s.SeriesSet))
+	testutil.Equals(t, 1, len(s.Warnings))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(q.metrics.inflightSelects))
+	m := &dto.Metric{}
+	testutil.Ok(t, q.metrics.selectWaitDuration.Write(m))
+	testutil.Equals(t, uint64(6), m.GetHistogram().GetSampleCount())
+
+	// Calls waiting for a slot give up when the request is done.
+	slow := &testClient{
+		StoreClient: &mockedStoreAPI{RespSeries: cls[0].(*testClient).StoreClient.(*mockedStoreAPI).RespSeries, RespDuration: 200 * time.Millisecond, SlowSeriesIndex: 1},
+		minTime:     1,
+		maxTime:     300,
+	}
+	q = NewProxyStore(nil, nil, func() []Client { return []Client{slow, cls[1]} }, component.Query, nil, 0, WithMaxConcurrentSelects(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := q.Series(req, newStoreSeriesServer(ctx))
+	testutil.NotOk(t, err)
+	testutil.Assert(t, errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded, got %v", err)
+}
+
+func TestProxyStore_Series_Hedging(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	replicaLabels := []labels.Labels{labels.FromStrings("ext", "1")}
+	resps := []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{1, 1}})}
+	req := &storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "b", Type: storepb.LabelMatcher_EQ}},
+	}
+	newStores := func(primaryDuration time.Duration) (primary, replica, other *mockedStoreAPI, cls []Client) {
+		primary = &mockedStoreAPI{RespSeries: resps, RespDuration: primaryDuration}
+		replica = &mockedStoreAPI{RespSeries: resps}
+		other = &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "b", "ext", "2"), []sample{{1, 1}})}}
+		return primary, replica, other, []Client{
+			&testClient{StoreClient: primary, labelSets: replicaLabels, minTime: 1, maxTime: 300, storeType: component.Store},
+			&testClient{StoreClient: replica, labelSets: replicaLabels, minTime: 1, maxTime: 300, storeType: component.Store},
+			&testClient{StoreClient: other, labelSets: []labels.Labels{labels.FromStrings("ext", "2")}, minTime: 1, maxTime: 300, storeType: component.Store},
+		}
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		primary, replica, other, cls := newStores(0)
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0)
+
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Assert(t, primary.LastSeriesReq != nil, "primary not called")
+		testutil.Assert(t, replica.LastSeriesReq != nil, "replica not called")
+		testutil.Assert(t, other.LastSeriesReq != nil, "other store not called")
+		testutil.Equals(t, 0.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+	})
+	t.Run("fast store is not hedged", func(t *testing.T) {
+		primary, replica, other, cls := newStores(0)
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithHedgingDelay(time.Second))
+
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Equals(t, 2, len(s.SeriesSet))
+		testutil.Assert(t, primary.LastSeriesReq != nil, "primary not called")
+		testutil.Assert(t, replica.LastSeriesReq == nil, "replica called")
+		testutil.Assert(t, other.LastSeriesReq != nil, "other store not called")
+		testutil.Equals(t, 0.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+	})
+	t.Run("slow store is hedged to its replica", func(t *testing.T) {
+		_, replica, _, cls := newStores(2 * time.Second)
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithHedgingDelay(50*time.Millisecond))
+
+		s := newStoreSeriesServer(context.Background())
+		start := time.Now()
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Assert(t, time.Since(start) < time.Second, "slow store waited for, took %v", time.Since(start))
+		testutil.Equals(t, 2, len(s.SeriesSet))
+		testutil.Equals(t, 0, len(s.Warnings))
+		testutil.Assert(t, replica.LastSeriesReq != nil, "replica not called")
+		testutil.Equals(t, 1.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(q.metrics.hedgedRequestsWon))
+	})
+	t.Run("failed hedge falls back to the store", func(t *testing.T) {
+		primary, replica, _, cls := newStores(200 * time.Millisecond)
+		replica.RespError = errors.New("replica down")
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithHedgingDelay(50*time.Millisecond))
+
+		s := newStoreSeriesServer(context.Background())
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Equals(t, 2, len(s.SeriesSet))
+		testutil.Equals(t, 0, len(s.Warnings))
+		testutil.Assert(t, primary.LastSeriesReq != nil, "primary not called")
+		testutil.Equals(t, 1.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(q.metrics.hedgedRequestsWon))
+	})
+	t.Run("failed store falls back to its replica right away", func(t *testing.T) {
+		primary, replica, _, cls := newStores(0)
+		primary.RespError = errors.New("store down")
+		q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithHedgingDelay(time.Minute))
+
+		s := newStoreSeriesServer(context.Background())
+		start := time.Now()
+		testutil.Ok(t, q.Series(req, s))
+		testutil.Assert(t, time.Since(start) < time.Second, "hedging delay waited for, took %v", time.Since(start))
+		testutil.Equals(t, 2, len(s.SeriesSet))
+		testutil.Equals(t, 0, len(s.Warnings))
+		testutil.Assert(t, replica.LastSeriesReq != nil, "replica not called")
+		testutil.Equals(t, 1.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+		testutil.Equals(t, 1.0, promtest.ToFloat64(q.metrics.hedgedRequestsWon))
+	})
+	t.Run("stores with the same labels holding different data are not replicas", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			second *testClient
+		}{
+			{
+				name:   "sidecar and store gateway",
+				second: &testClient{labelSets: replicaLabels, minTime: 1, maxTime: 300, storeType: component.Store},
+			},
+			{
+				name:   "different time ranges",
+				second: &testClient{labelSets: replicaLabels, minTime: 1, maxTime: 200, storeType: component.Sidecar},
+			},
+			{
+				name:   "unknown component type",
+				second: &testClient{labelSets: replicaLabels, minTime: 1, maxTime: 300},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				first := &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{1, 1}})}}
+				second := &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{2, 2}})}}
+				tc.second.StoreClient = second
+				cls := []Client{
+					&testClient{StoreClient: first, labelSets: replicaLabels, minTime: 1, maxTime: 300, storeType: component.Sidecar},
+					tc.second,
+				}
+				q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0, WithHedgingDelay(time.Second))
+
+				s := newStoreSeriesServer(context.Background())
+				testutil.Ok(t, q.Series(req, s))
+				testutil.Assert(t, first.LastSeriesReq != nil, "first store not called")
+				testutil.Assert(t, second.LastSeriesReq != nil, "second store not called")
+				testutil.Equals(t, 0.0, promtest.ToFloat64(q.metrics.hedgedRequests))
+			})
+		}
+	})
+}
+
 func TestProxyStore_LabelValues(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1186,6 +1498,110 @@ func TestProxyStore_LabelValues(t *testing.T) {
 	testutil.Equals(t, 1, len(resp.Warnings))
 }
 
+// largeLabelValuesStoreServer returns the configured number of values for every label.
+type largeLabelValuesStoreServer struct {
+	storepb.StoreServer
+
+	values int
+}
+
+func (s *largeLabelValuesStoreServer) LabelValues(_ context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	resp := &storepb.LabelValuesResponse{Values: make([]string, 0, s.values)}
+	for i := 0; i < s.values; i++ {
+		resp.Values = append(resp.Values, fmt.Sprintf("%s-%020d", req.Label, i))
+	}
+	return resp, nil
+}
+
+func (s *largeLabelValuesStoreServer) LabelValuesStream(req *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), req)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
+
+func TestProxyStore_LabelValues_StreamsLargeResponses(t *testing.T) {
+	defer testutil.TolerantVerifyLeak(t)
+
+	// Every value takes 26 bytes when encoded, so all of them together exceed the default max gRPC message size of 4MiB.
+	const numValues = 300000
+
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, &largeLabelValuesStoreServer{values: numValues})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, cc.Close()) }()
+
+	ctx := context.Background()
+	req := &storepb.LabelValuesRequest{
+		Label:                   "pod",
+		PartialResponseDisabled: true,
+		Start:                   timestamp.FromTime(minTime),
+		End:                     timestamp.FromTime(maxTime),
+	}
+
+	t.Run("unary response exceeds the max message size", func(t *testing.T) {
+		_, err := storepb.NewStoreClient(cc).LabelValues(ctx, req)
+		testutil.NotOk(t, err)
+		testutil.Equals(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("streamed chunks stay under the max message size", func(t *testing.T) {
+		stream, err := storepb.NewStoreClient(cc).LabelValuesStream(ctx, req)
+		testutil.Ok(t, err)
+
+		var chunks, values int
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			testutil.Ok(t, err)
+			testutil.Assert(t, resp.Size() <= storepb.LabelValuesStreamChunkSize, "chunk of %d bytes exceeds the chunk size", resp.Size())
+			chunks++
+			values += len(resp.Values)
+		}
+		testutil.Assert(t, chunks > 1, "expected several chunks, got %d", chunks)
+		testutil.Equals(t, numValues, values)
+	})
+
+	for _, tc := range []struct {
+		name                      string
+		supportsLabelValuesStream bool
+		expectErr                 bool
+	}{
+		{name: "store without streaming support", expectErr: true},
+		{name: "store with streaming support", supportsLabelValuesStream: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cls := []Client{&testClient{
+				StoreClient:               storepb.NewStoreClient(cc),
+				minTime:                   math.MinInt64,
+				maxTime:                   math.MaxInt64,
+				supportsLabelValuesStream: tc.supportsLabelValuesStream,
+			}}
+			q := NewProxyStore(nil, nil, func() []Client { return cls }, component.Query, nil, 0*time.Second)
+
+			resp, err := q.LabelValues(ctx, req)
+			if tc.expectErr {
+				testutil.NotOk(t, err)
+				testutil.Equals(t, codes.ResourceExhausted, status.Code(errors.Cause(err)))
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, numValues, len(resp.Values))
+			testutil.Equals(t, fmt.Sprintf("pod-%020d", 0), resp.Values[0])
+			testutil.Equals(t, fmt.Sprintf("pod-%020d", numValues-1), resp.Values[numValues-1])
+		})
+	}
+}
+
 func TestProxyStore_LabelNames(t *testing.T) {
 	defer testutil.TolerantVerifyLeak(t)
 
@@ -1622,6 +2038,12 @@ func (s *mockedStoreAPI) LabelValues(_ context.Context, req *storepb.LabelValues
 	return s.RespLabelValues, s.RespError
 }
 
+func (s *mockedStoreAPI) LabelValuesStream(_ context.Context, req *storepb.LabelValuesRequest, _ ...grpc.CallOption) (storepb.Store_LabelValuesStreamClient, error) {
+	s.LastLabelValuesReq = req
+
+	return nil, status.Error(codes.Unimplemented, "LabelValuesStream is not implemented")
+}
+
 // StoreSeriesClient is test gRPC storeAPI series client.
 type StoreSeriesClient struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
@@ -1638,7 +2060,11 @@ type StoreSeriesClient struct {
 
 func (c *StoreSeriesClient) Recv() (*storepb.SeriesResponse, error) {
 	if c.respDur != 0 && (c.slowSeriesIndex == c.i || c.slowSeriesIndex == 0) {
-		time.Sleep(c.respDur)
+		select {
+		case <-time.After(c.respDur):
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		}
 	}
 	if c.injectedError != nil && (c.injectedErrorIndex == c.i || c.injectedErrorIndex == 0) {
 		return nil, c.injectedError
@@ -0,0 +1,232 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// pushdownFuncs are the range functions evaluated by stores on query pushdown. They replicate the implementation
+// of the PromQL engine, so that pushed down results are identical to the ones the querier would compute.
+var pushdownFuncs = map[string]func(vs []float64) float64{
+	"count_over_time": func(vs []float64) float64 {
+		return float64(len(vs))
+	},
+	"sum_over_time": func(vs []float64) float64 {
+		var sum, c float64
+		for _, v := range vs {
+			sum, c = kahanSumInc(v, sum, c)
+		}
+		if math.IsInf(sum, 0) {
+			return sum
+		}
+		return sum + c
+	},
+	"avg_over_time": func(vs []float64) float64 {
+		var mean, count, c float64
+		for _, v := range vs {
+			count++
+			if math.IsInf(mean, 0) {
+				if math.IsInf(v, 0) && (mean > 0) == (v > 0) {
+					continue
+				}
+				if !math.IsInf(v, 0) && !math.IsNaN(v) {
+					continue
+				}
+			}
+			mean, c = kahanSumInc(v/count-mean/count, mean, c)
+		}
+		if math.IsInf(mean, 0) {
+			return mean
+		}
+		return mean + c
+	},
+	"min_over_time": func(vs []float64) float64 {
+		min := vs[0]
+		for _, v := range vs {
+			if v < min || math.IsNaN(min) {
+				min = v
+			}
+		}
+		return min
+	},
+	"max_over_time": func(vs []float64) float64 {
+		max := vs[0]
+		for _, v := range vs {
+			if v > max || math.IsNaN(max) {
+				max = v
+			}
+		}
+		return max
+	},
+}
+
+// kahanSumInc is the Kahan-Neumaier summation step of the PromQL engine.
+func kahanSumInc(inc, sum, c float64) (newSum, newC float64) {
+	t := sum + inc
+	if math.Abs(sum) >= math.Abs(inc) {
+		c += (sum - t) + inc
+	} else {
+		c += (inc - t) + sum
+	}
+	return t, c
+}
+
+// IsPushdownFunc returns true if the range function with the given name can be pushed down to stores.
+func IsPushdownFunc(name string) bool {
+	_, ok := pushdownFuncs[name]
+	return ok
+}
+
+// EvalPushdown evaluates the range function of the pushdown over the samples of the iterator at every step, the way
+// the PromQL engine evaluates it over a range vector selector: over the samples from the range before the step up
+// to the step included, skipping staleness markers. Steps without samples have no result. The results are returned
+// as raw chunks, empty if no step has a result.
+func EvalPushdown(p *storepb.Pushdown, it chunkenc.Iterator) ([]storepb.AggrChunk, error) {
+	fn, ok := pushdownFuncs[p.Func]
+	if !ok {
+		return nil, errors.Errorf("unsupported pushdown function %q", p.Func)
+	}
+	if p.StepMillis < 0 || p.RangeMillis <= 0 {
+		return nil, errors.Errorf("invalid pushdown step %dms or range %dms", p.StepMillis, p.RangeMillis)
+	}
+
+	var (
+		ts []int64
+		vs []float64
+	)
+	for it.Next() {
+		t, v := it.At()
+		if t > p.End {
+			break
+		}
+		if t < p.Start-p.RangeMillis || value.IsStaleNaN(v) {
+			continue
+		}
+		ts = append(ts, t)
+		vs = append(vs, v)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		chks   []storepb.AggrChunk
+		chk    *chunkenc.XORChunk
+		app    chunkenc.Appender
+		lo, hi int
+	)
+	for t := p.Start; t <= p.End; t += p.StepMillis {
+		for hi < len(ts) && ts[hi] <= t {
+			hi++
+		}
+		for lo < hi && ts[lo] < t-p.RangeMillis {
+			lo++
+		}
+		if lo < hi {
+			if chk == nil || chk.NumSamples() >= MaxSamplesPerChunk {
+				if chk != nil {
+					chks[len(chks)-1].Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()}
+				}
+				chk = chunkenc.NewXORChunk()
+				var err error
+				if app, err = chk.Appender(); err != nil {
+					return nil, err
+				}
+				chks = append(chks, storepb.AggrChunk{MinTime: t})
+			}
+			app.Append(t, fn(vs[lo:hi]))
+			chks[len(chks)-1].MaxTime = t
+		}
+		if p.StepMillis == 0 {
+			break
+		}
+	}
+	if chk != nil {
+		chks[len(chks)-1].Raw = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: chk.Bytes()}
+	}
+	return chks, nil
+}
+
+// rawChunksIterator iterates over the samples of the raw chunks of a series, sorted by min time. Samples of a chunk
+// overlapping the previous one are skipped, as the querier does.
+type rawChunksIterator struct {
+	chks []storepb.AggrChunk
+	i    int
+	cur  chunkenc.Iterator
+	err  error
+}
+
+func newRawChunksIterator(chks []storepb.AggrChunk) *rawChunksIterator {
+	return &rawChunksIterator{chks: chks, i: -1}
+}
+
+func (it *rawChunksIterator) nextChunk() bool {
+	it.i++
+	if it.i >= len(it.chks) {
+		return false
+	}
+	raw := it.chks[it.i].Raw
+	if raw == nil {
+		it.err = errors.New("pushdown over a chunk without raw samples")
+		return false
+	}
+	c, err := chunkenc.FromData(chunkenc.EncXOR, raw.Data)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.cur = c.Iterator(nil)
+	return true
+}
+
+func (it *rawChunksIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	lastT := int64(math.MinInt64)
+	if it.cur != nil {
+		lastT, _ = it.cur.At()
+		if it.cur.Next() {
+			return true
+		}
+		if it.err = it.cur.Err(); it.err != nil {
+			return false
+		}
+	}
+	for it.nextChunk() {
+		for it.cur.Next() {
+			if t, _ := it.cur.At(); t > lastT {
+				return true
+			}
+		}
+		if it.err = it.cur.Err(); it.err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+func (it *rawChunksIterator) Seek(t int64) bool {
+	for {
+		if it.cur != nil {
+			if ct, _ := it.cur.At(); ct >= t {
+				return true
+			}
+		}
+		if !it.Next() {
+			return false
+		}
+	}
+}
+
+func (it *rawChunksIterator) At() (int64, float64) { return it.cur.At() }
+
+func (it *rawChunksIterator) Err() error { return it.err }
@@ -0,0 +1,89 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package store
+
+import (
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/simplelru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+type seriesLabelsCacheMetrics struct {
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+func newSeriesLabelsCacheMetrics(reg prometheus.Registerer) *seriesLabelsCacheMetrics {
+	return &seriesLabelsCacheMetrics{
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_store_series_labels_cache_hits_total",
+			Help: "Total number of series label sets served from the series labels cache of blocks.",
+		}),
+		misses: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanos_bucket_store_series_labels_cache_misses_total",
+			Help: "Total number of series label sets missing from the series labels cache of blocks, which had to be decoded.",
+		}),
+	}
+}
+
+// seriesLabelsCache caches the decoded label sets of up to a maximum number of series of a block, by series reference,
+// so repeated queries selecting the same series don't have to look up their symbols again.
+type seriesLabelsCache struct {
+	mtx sync.Mutex
+	lru *lru.LRU
+
+	metrics *seriesLabelsCacheMetrics
+}
+
+// newSeriesLabelsCache returns a cache of up to maxSeries label sets, or nil if maxSeries is not positive.
+func newSeriesLabelsCache(maxSeries int, metrics *seriesLabelsCacheMetrics) (*seriesLabelsCache, error) {
+	if maxSeries <= 0 {
+		return nil, nil
+	}
+
+	l, err := lru.NewLRU(maxSeries, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &seriesLabelsCache{lru: l, metrics: metrics}, nil
+}
+
+// get returns the cached label set of the series and true, or false if it is not cached.
+// The returned label set is shared and must not be modified.
+func (c *seriesLabelsCache) get(ref storage.SeriesRef) (labels.Labels, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mtx.Lock()
+	v, ok := c.lru.Get(ref)
+	c.mtx.Unlock()
+
+	if !ok {
+		c.metrics.misses.Inc()
+		return nil, false
+	}
+	c.metrics.hits.Inc()
+	return v.(labels.Labels), true
+}
+
+func (c *seriesLabelsCache) set(ref storage.SeriesRef, lset labels.Labels) {
+	if c == nil {
+		return
+	}
+
+	copied := make(labels.Labels, 0, len(lset))
+	for _, l := range lset {
+		copied = append(copied, labels.Label{Name: detachString(l.Name), Value: detachString(l.Value)})
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.lru.Add(ref, copied)
+}
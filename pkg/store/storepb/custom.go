@@ -51,6 +51,40 @@ func NewHintsSeriesResponse(hints *types.Any) *SeriesResponse {
 	}
 }
 
+// LabelValuesStreamChunkSize is the maximum size in bytes of the values sent in a single LabelValuesStream response.
+// It is kept well below the default gRPC max message size of 4MiB.
+const LabelValuesStreamChunkSize = 1024 * 1024
+
+// SendLabelValuesStream sends the values of the given response in chunks holding at most maxChunkSize bytes of
+// encoded values, so that a large response never exceeds the max message size. Warnings and hints are sent with
+// the last chunk. At least one chunk is always sent.
+func SendLabelValuesStream(srv Store_LabelValuesStreamServer, resp *LabelValuesResponse, maxChunkSize int) error {
+	values := resp.Values
+	for {
+		var n, size int
+		for ; n < len(values); n++ {
+			l := len(values[n])
+			vsize := 1 + l + sovRpc(uint64(l))
+			if n > 0 && size+vsize > maxChunkSize {
+				break
+			}
+			size += vsize
+		}
+		chunk := &LabelValuesStreamResponse{Values: values[:n]}
+		values = values[n:]
+		if len(values) == 0 {
+			chunk.Warnings = resp.Warnings
+			chunk.Hints = resp.Hints
+		}
+		if err := srv.Send(chunk); err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+	}
+}
+
 type emptySeriesSet struct{}
 
 func (emptySeriesSet) Next() bool                       { return false }
@@ -33,6 +33,17 @@ func (s serverAsClient) LabelValues(ctx context.Context, in *LabelValuesRequest,
 	return s.srv.LabelValues(ctx, in)
 }
 
+func (s serverAsClient) LabelValuesStream(ctx context.Context, in *LabelValuesRequest, _ ...grpc.CallOption) (Store_LabelValuesStreamClient, error) {
+	inSrv := &inProcessLabelValuesStream{recv: make(chan *LabelValuesStreamResponse, s.clientReceiveBufferSize), err: make(chan error)}
+	inSrv.ctx, inSrv.cancel = context.WithCancel(ctx)
+	go func() {
+		inSrv.err <- s.srv.LabelValuesStream(in, inSrv)
+		close(inSrv.err)
+		close(inSrv.recv)
+	}()
+	return &inProcessLabelValuesClientStream{srv: inSrv}, nil
+}
+
 func (s serverAsClient) Series(ctx context.Context, in *SeriesRequest, _ ...grpc.CallOption) (Store_SeriesClient, error) {
 	inSrv := &inProcessStream{recv: make(chan *SeriesResponse, s.clientReceiveBufferSize), err: make(chan error)}
 	inSrv.ctx, inSrv.cancel = context.WithCancel(ctx)
@@ -95,3 +106,58 @@ func (s *inProcessClientStream) Recv() (*SeriesResponse, error) {
 		return nil, err
 	}
 }
+
+type inProcessLabelValuesStream struct {
+	grpc.ServerStream
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	recv   chan *LabelValuesStreamResponse
+	err    chan error
+}
+
+func (s *inProcessLabelValuesStream) Context() context.Context { return s.ctx }
+
+func (s *inProcessLabelValuesStream) Send(r *LabelValuesStreamResponse) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.recv <- r:
+		return nil
+	}
+}
+
+type inProcessLabelValuesClientStream struct {
+	grpc.ClientStream
+
+	srv *inProcessLabelValuesStream
+}
+
+func (s *inProcessLabelValuesClientStream) Context() context.Context { return s.srv.ctx }
+
+func (s *inProcessLabelValuesClientStream) CloseSend() error {
+	s.srv.cancel()
+	return nil
+}
+
+func (s *inProcessLabelValuesClientStream) Recv() (*LabelValuesStreamResponse, error) {
+	select {
+	case <-s.srv.ctx.Done():
+		return nil, s.srv.ctx.Err()
+	case r, ok := <-s.srv.recv:
+		if !ok {
+			return nil, io.EOF
+		}
+		return r, nil
+	case err := <-s.srv.err:
+		if err != nil {
+			return nil, err
+		}
+		// The server is done, but buffered chunks still have to be received.
+		r, ok := <-s.srv.recv
+		if !ok {
+			return nil, io.EOF
+		}
+		return r, nil
+	}
+}
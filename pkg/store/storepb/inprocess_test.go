@@ -58,6 +58,15 @@ func (t *testStoreServer) LabelValues(_ context.Context, r *LabelValuesRequest)
 	return t.labelValues, t.err
 }
 
+func (t *testStoreServer) LabelValuesStream(r *LabelValuesRequest, server Store_LabelValuesStreamServer) error {
+	t.labelValuesLastReq = r
+	if t.err != nil {
+		return t.err
+	}
+	// Small chunks, so that every chunk holds two values.
+	return SendLabelValuesStream(server, t.labelValues, 32)
+}
+
 func TestServerAsClient(t *testing.T) {
 	for _, bufferSize := range []int{0, 1, 20, 100} {
 		t.Run(fmt.Sprintf("buffer=%v", bufferSize), func(t *testing.T) {
@@ -260,6 +269,67 @@ func TestServerAsClient(t *testing.T) {
 					}
 				})
 			})
+			t.Run("LabelValuesStream", func(t *testing.T) {
+				s := &testStoreServer{
+					labelValues: &LabelValuesResponse{
+						Warnings: []string{"1", "a"},
+					},
+				}
+				for i := 0; i < 100; i++ {
+					s.labelValues.Values = append(s.labelValues.Values, fmt.Sprintf("value-%03d", i))
+				}
+				t.Run("ok", func(t *testing.T) {
+					for i := 0; i < 20; i++ {
+						r := &LabelValuesRequest{
+							Label:                   "__name__",
+							Start:                   -1,
+							End:                     234,
+							PartialResponseStrategy: PartialResponseStrategy_ABORT,
+						}
+						client, err := ServerAsClient(s, bufferSize).LabelValuesStream(context.TODO(), r)
+						testutil.Ok(t, err)
+						var chunks []*LabelValuesStreamResponse
+						for {
+							resp, err := client.Recv()
+							if err == io.EOF {
+								break
+							}
+							testutil.Ok(t, err)
+							chunks = append(chunks, resp)
+						}
+						testutil.Equals(t, 50, len(chunks))
+
+						var values []string
+						for i, c := range chunks {
+							testutil.Equals(t, 2, len(c.Values))
+							if i < len(chunks)-1 {
+								testutil.Equals(t, 0, len(c.Warnings))
+							}
+							values = append(values, c.Values...)
+						}
+						testutil.Equals(t, s.labelValues.Values, values)
+						testutil.Equals(t, s.labelValues.Warnings, chunks[len(chunks)-1].Warnings)
+						testutil.Equals(t, r, s.labelValuesLastReq)
+						s.labelValuesLastReq = nil
+					}
+				})
+				t.Run("error", func(t *testing.T) {
+					s.err = errors.New("some error")
+					for i := 0; i < 20; i++ {
+						r := &LabelValuesRequest{
+							Label:                   "__name__",
+							Start:                   -1,
+							End:                     234,
+							PartialResponseStrategy: PartialResponseStrategy_ABORT,
+						}
+						client, err := ServerAsClient(s, bufferSize).LabelValuesStream(context.TODO(), r)
+						testutil.Ok(t, err)
+						_, err = client.Recv()
+						testutil.NotOk(t, err)
+						testutil.Equals(t, s.err, err)
+					}
+				})
+			})
 		})
 	}
 }
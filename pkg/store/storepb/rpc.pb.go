@@ -229,6 +229,10 @@ type InfoResponse struct {
 	StoreType StoreType                                              `protobuf:"varint,4,opt,name=storeType,proto3,enum=thanos.StoreType" json:"storeType,omitempty"`
 	// label_sets is an unsorted list of `ZLabelSet`s.
 	LabelSets []labelpb.ZLabelSet `protobuf:"bytes,5,rep,name=label_sets,json=labelSets,proto3" json:"label_sets"`
+	// supports_label_values_stream is true if the store implements the LabelValuesStream method.
+	SupportsLabelValuesStream bool `protobuf:"varint,6,opt,name=supports_label_values_stream,json=supportsLabelValuesStream,proto3" json:"supports_label_values_stream,omitempty"`
+	// supports_query_pushdown is true if the store evaluates the range functions of the pushdown field of series requests.
+	SupportsQueryPushdown bool `protobuf:"varint,7,opt,name=supports_query_pushdown,json=supportsQueryPushdown,proto3" json:"supports_query_pushdown,omitempty"`
 }
 
 func (m *InfoResponse) Reset()         { *m = InfoResponse{} }
@@ -289,6 +293,12 @@ type SeriesRequest struct {
 	// query_hints are the hints coming from the PromQL engine when
 	// requesting a storage.SeriesSet for a given expression.
 	QueryHints *QueryHints `protobuf:"bytes,12,opt,name=query_hints,json=queryHints,proto3" json:"query_hints,omitempty"`
+	// no_cache asks the store to bypass its caches and read the data from the object storage.
+	// Stores are free to ignore it.
+	NoCache bool `protobuf:"varint,13,opt,name=no_cache,json=noCache,proto3" json:"no_cache,omitempty"`
+	// pushdown asks the store to return the given range function evaluated over the series instead of their samples.
+	// It's only sent to stores advertising support for it.
+	Pushdown *Pushdown `protobuf:"bytes,14,opt,name=pushdown,proto3" json:"pushdown,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
@@ -759,6 +769,97 @@ func (m *LabelValuesResponse) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_LabelValuesResponse proto.InternalMessageInfo
 
+type LabelValuesStreamResponse struct {
+	/// values holds a chunk of the label values, sorted within and across the chunks of a single stream.
+	Values   []string `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	Warnings []string `protobuf:"bytes,2,rep,name=warnings,proto3" json:"warnings,omitempty"`
+	/// hints is an opaque data structure that can be used to carry additional information from
+	/// the store. The content of this field and whether it's supported depends on the
+	/// implementation of a specific store. It is only set on the last chunk of the stream.
+	Hints *types.Any `protobuf:"bytes,3,opt,name=hints,proto3" json:"hints,omitempty"`
+}
+
+func (m *LabelValuesStreamResponse) Reset()         { *m = LabelValuesStreamResponse{} }
+func (m *LabelValuesStreamResponse) String() string { return proto.CompactTextString(m) }
+func (*LabelValuesStreamResponse) ProtoMessage()    {}
+func (*LabelValuesStreamResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{14}
+}
+func (m *LabelValuesStreamResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *LabelValuesStreamResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_LabelValuesStreamResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *LabelValuesStreamResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LabelValuesStreamResponse.Merge(m, src)
+}
+func (m *LabelValuesStreamResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *LabelValuesStreamResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_LabelValuesStreamResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LabelValuesStreamResponse proto.InternalMessageInfo
+
+// Pushdown is a range function, e.g. count_over_time, evaluated by the store at every step from start to end.
+// Evaluated series are returned with the __thanos_pushed_down="true" label, and a sample at every step the
+// function has a result for.
+type Pushdown struct {
+	// The name of the range function.
+	Func string `protobuf:"bytes,1,opt,name=func,proto3" json:"func,omitempty"`
+	// The range of the range vector selector in milliseconds.
+	RangeMillis int64 `protobuf:"varint,2,opt,name=range_millis,json=rangeMillis,proto3" json:"range_millis,omitempty"`
+	// The first and last evaluation timestamps in milliseconds.
+	Start int64 `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
+	End   int64 `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	// The evaluation step in milliseconds, 0 for a single evaluation at start.
+	StepMillis int64 `protobuf:"varint,5,opt,name=step_millis,json=stepMillis,proto3" json:"step_millis,omitempty"`
+}
+
+func (m *Pushdown) Reset()         { *m = Pushdown{} }
+func (m *Pushdown) String() string { return proto.CompactTextString(m) }
+func (*Pushdown) ProtoMessage()    {}
+func (*Pushdown) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a938d55a388af629, []int{15}
+}
+func (m *Pushdown) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Pushdown) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Pushdown.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Pushdown) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Pushdown.Merge(m, src)
+}
+func (m *Pushdown) XXX_Size() int {
+	return m.Size()
+}
+func (m *Pushdown) XXX_DiscardUnknown() {
+	xxx_messageInfo_Pushdown.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Pushdown proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterEnum("thanos.StoreType", StoreType_name, StoreType_value)
 	proto.RegisterEnum("thanos.Aggr", Aggr_name, Aggr_value)
@@ -776,89 +877,101 @@ func init() {
 	proto.RegisterType((*LabelNamesResponse)(nil), "thanos.LabelNamesResponse")
 	proto.RegisterType((*LabelValuesRequest)(nil), "thanos.LabelValuesRequest")
 	proto.RegisterType((*LabelValuesResponse)(nil), "thanos.LabelValuesResponse")
+	proto.RegisterType((*LabelValuesStreamResponse)(nil), "thanos.LabelValuesStreamResponse")
+	proto.RegisterType((*Pushdown)(nil), "thanos.Pushdown")
 }
 
 func init() { proto.RegisterFile("store/storepb/rpc.proto", fileDescriptor_a938d55a388af629) }
 
 var fileDescriptor_a938d55a388af629 = []byte{
-	// 1230 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x5f, 0x6f, 0x13, 0x47,
-	0x10, 0xf7, 0xdd, 0xf9, 0xfc, 0x67, 0x9c, 0xa4, 0xc7, 0x62, 0xe0, 0x62, 0x24, 0xc7, 0xba, 0xaa,
-	0x52, 0x84, 0xa8, 0xdd, 0x9a, 0x0a, 0xa9, 0x15, 0x2f, 0x49, 0x30, 0x24, 0x2a, 0x31, 0x65, 0x9d,
-	0x90, 0x96, 0xaa, 0xb2, 0xce, 0xce, 0x72, 0x3e, 0xe1, 0xfb, 0xc3, 0xed, 0x5e, 0xc1, 0xaf, 0xed,
-	0x7b, 0x55, 0xf5, 0x23, 0x54, 0xfd, 0x10, 0xfd, 0x08, 0xbc, 0x95, 0xc7, 0xaa, 0x0f, 0xa8, 0x85,
-	0x2f, 0x52, 0xed, 0x9f, 0xb3, 0x7d, 0x69, 0x80, 0xa2, 0xf0, 0x72, 0xda, 0x99, 0xdf, 0xec, 0xec,
-	0xcc, 0xfc, 0x76, 0xe6, 0x16, 0x2e, 0x51, 0x16, 0x25, 0xa4, 0x23, 0xbe, 0xf1, 0xa8, 0x93, 0xc4,
-	0xe3, 0x76, 0x9c, 0x44, 0x2c, 0x42, 0x25, 0x36, 0x71, 0xc3, 0x88, 0x36, 0xd6, 0xf3, 0x06, 0x6c,
-	0x16, 0x13, 0x2a, 0x4d, 0x1a, 0x75, 0x2f, 0xf2, 0x22, 0xb1, 0xec, 0xf0, 0x95, 0xd2, 0xb6, 0xf2,
-	0x1b, 0xe2, 0x24, 0x0a, 0x4e, 0xec, 0x53, 0x2e, 0xa7, 0xee, 0x88, 0x4c, 0x4f, 0x42, 0x5e, 0x14,
-	0x79, 0x53, 0xd2, 0x11, 0xd2, 0x28, 0x7d, 0xd8, 0x71, 0xc3, 0x99, 0x84, 0x9c, 0x0f, 0x60, 0xf5,
-	0x28, 0xf1, 0x19, 0xc1, 0x84, 0xc6, 0x51, 0x48, 0x89, 0xf3, 0xa3, 0x06, 0x2b, 0x4a, 0xf3, 0x38,
-	0x25, 0x94, 0xa1, 0x2d, 0x00, 0xe6, 0x07, 0x84, 0x92, 0xc4, 0x27, 0xd4, 0xd6, 0x5a, 0xc6, 0x66,
-	0xad, 0x7b, 0x99, 0xef, 0x0e, 0x08, 0x9b, 0x90, 0x94, 0x0e, 0xc7, 0x51, 0x3c, 0x6b, 0x1f, 0xf8,
-	0x01, 0x19, 0x08, 0x93, 0xed, 0xe2, 0xb3, 0x17, 0x1b, 0x05, 0xbc, 0xb4, 0x09, 0x5d, 0x84, 0x12,
-	0x23, 0xa1, 0x1b, 0x32, 0x5b, 0x6f, 0x69, 0x9b, 0x55, 0xac, 0x24, 0x64, 0x43, 0x39, 0x21, 0xf1,
-	0xd4, 0x1f, 0xbb, 0xb6, 0xd1, 0xd2, 0x36, 0x0d, 0x9c, 0x89, 0xce, 0x2a, 0xd4, 0xf6, 0xc2, 0x87,
-	0x91, 0x8a, 0xc1, 0xf9, 0x45, 0x87, 0x15, 0x29, 0xcb, 0x28, 0xd1, 0x18, 0x4a, 0x22, 0xd1, 0x2c,
-	0xa0, 0xd5, 0xb6, 0x2c, 0x6c, 0xfb, 0x0e, 0xd7, 0x6e, 0xdf, 0xe0, 0x21, 0xfc, 0xf5, 0x62, 0xe3,
-	0x33, 0xcf, 0x67, 0x93, 0x74, 0xd4, 0x1e, 0x47, 0x41, 0x47, 0x1a, 0x7c, 0xec, 0x47, 0x6a, 0xd5,
-	0x89, 0x1f, 0x79, 0x9d, 0x5c, 0xcd, 0xda, 0x0f, 0xc4, 0x6e, 0xac, 0x5c, 0xa3, 0x75, 0xa8, 0x04,
-	0x7e, 0x38, 0xe4, 0x89, 0x88, 0xc0, 0x0d, 0x5c, 0x0e, 0xfc, 0x90, 0x67, 0x2a, 0x20, 0xf7, 0xa9,
-	0x84, 0x54, 0xe8, 0x81, 0xfb, 0x54, 0x40, 0x1d, 0xa8, 0x0a, 0xaf, 0x07, 0xb3, 0x98, 0xd8, 0xc5,
-	0x96, 0xb6, 0xb9, 0xd6, 0x3d, 0x97, 0x45, 0x37, 0xc8, 0x00, 0xbc, 0xb0, 0x41, 0xd7, 0x01, 0xc4,
-	0x81, 0x43, 0x4a, 0x18, 0xb5, 0x4d, 0x91, 0xcf, 0x7c, 0x87, 0x0c, 0x69, 0x40, 0x98, 0x2a, 0x6b,
-	0x75, 0xaa, 0x64, 0xea, 0xfc, 0x56, 0x84, 0x55, 0x59, 0xf2, 0x8c, 0xaa, 0xe5, 0x80, 0xb5, 0xd7,
-	0x07, 0xac, 0xe7, 0x03, 0xbe, 0xce, 0x21, 0x36, 0x9e, 0x90, 0x84, 0xda, 0x86, 0x38, 0xbd, 0x9e,
-	0xab, 0xe6, 0xbe, 0x04, 0x55, 0x00, 0x73, 0x5b, 0xd4, 0x85, 0x0b, 0xdc, 0x65, 0x42, 0x68, 0x34,
-	0x4d, 0x99, 0x1f, 0x85, 0xc3, 0x27, 0x7e, 0x78, 0x1c, 0x3d, 0x11, 0x49, 0x1b, 0xf8, 0x7c, 0xe0,
-	0x3e, 0xc5, 0x73, 0xec, 0x48, 0x40, 0xe8, 0x2a, 0x80, 0xeb, 0x79, 0x09, 0xf1, 0x5c, 0x46, 0x64,
-	0xae, 0x6b, 0xdd, 0x95, 0xec, 0xb4, 0x2d, 0xcf, 0x4b, 0xf0, 0x12, 0x8e, 0xbe, 0x80, 0xf5, 0xd8,
-	0x4d, 0x98, 0xef, 0x4e, 0xf9, 0x29, 0x82, 0xf9, 0xe1, 0xb1, 0x4f, 0xdd, 0xd1, 0x94, 0x1c, 0xdb,
-	0xa5, 0x96, 0xb6, 0x59, 0xc1, 0x97, 0x94, 0x41, 0x76, 0x33, 0x6e, 0x2a, 0x18, 0x7d, 0x7b, 0xca,
-	0x5e, 0xca, 0x12, 0x97, 0x11, 0x6f, 0x66, 0x97, 0x05, 0x2d, 0x1b, 0xd9, 0xc1, 0x5f, 0xe5, 0x7d,
-	0x0c, 0x94, 0xd9, 0x7f, 0x9c, 0x67, 0x00, 0xda, 0x80, 0x1a, 0x7d, 0xe4, 0xc7, 0xc3, 0xf1, 0x24,
-	0x0d, 0x1f, 0x51, 0xbb, 0x22, 0x42, 0x01, 0xae, 0xda, 0x11, 0x1a, 0x74, 0x05, 0xcc, 0x89, 0x1f,
-	0x32, 0x6a, 0x57, 0x5b, 0x9a, 0x28, 0xa8, 0xec, 0xc0, 0x76, 0xd6, 0x81, 0xed, 0xad, 0x70, 0x86,
-	0xa5, 0x09, 0x42, 0x50, 0xa4, 0x8c, 0xc4, 0x36, 0x88, 0xb2, 0x89, 0x35, 0xaa, 0x83, 0x99, 0xb8,
-	0xa1, 0x47, 0xec, 0x9a, 0x50, 0x4a, 0x01, 0x5d, 0x83, 0xda, 0xe3, 0x94, 0x24, 0xb3, 0xa1, 0xf4,
-	0xbd, 0x22, 0x7c, 0xa3, 0x2c, 0x8b, 0x7b, 0x1c, 0xda, 0xe5, 0x08, 0x86, 0xc7, 0xf3, 0xb5, 0xf3,
-	0xab, 0x06, 0xb0, 0x80, 0x44, 0xe8, 0x8c, 0xc4, 0xc3, 0xc0, 0x9f, 0x4e, 0x7d, 0xaa, 0xae, 0x09,
-	0x70, 0xd5, 0xbe, 0xd0, 0xa0, 0x16, 0x14, 0x1f, 0xa6, 0xe1, 0x58, 0xdc, 0x92, 0xda, 0x82, 0x9c,
-	0x5b, 0x69, 0x38, 0xc6, 0x02, 0x41, 0x57, 0xa1, 0xe2, 0x25, 0x51, 0x1a, 0xfb, 0xa1, 0x27, 0xb8,
-	0xae, 0x75, 0xad, 0xcc, 0xea, 0xb6, 0xd2, 0xe3, 0xb9, 0x05, 0xfa, 0x30, 0x4b, 0xc5, 0x14, 0xa6,
-	0xf3, 0x4e, 0xc5, 0x5c, 0xa9, 0x32, 0x73, 0x1a, 0x50, 0xe4, 0x07, 0xf0, 0x5a, 0x84, 0xae, 0xba,
-	0xbd, 0x55, 0x2c, 0xd6, 0x4e, 0x17, 0x2a, 0x99, 0x5b, 0xb4, 0x06, 0xfa, 0x68, 0x26, 0xd0, 0x0a,
-	0xd6, 0x47, 0x33, 0x3e, 0x59, 0xd4, 0x1c, 0xe0, 0x37, 0xb7, 0x9a, 0xb5, 0xae, 0xb3, 0x01, 0xa6,
-	0xf0, 0xcf, 0x0d, 0x72, 0x99, 0x2a, 0xc9, 0xf9, 0x49, 0x83, 0xb5, 0xac, 0x79, 0xd4, 0x4c, 0xd9,
-	0x84, 0xd2, 0x7c, 0xc8, 0xf1, 0x48, 0xd7, 0xe6, 0x5d, 0x2b, 0xb4, 0xbb, 0x05, 0xac, 0x70, 0xd4,
-	0x80, 0xf2, 0x13, 0x37, 0x09, 0x79, 0xfe, 0x62, 0xa0, 0xed, 0x16, 0x70, 0xa6, 0x40, 0x57, 0x33,
-	0xe6, 0x8d, 0xd7, 0x33, 0xbf, 0x5b, 0x50, 0xdc, 0x6f, 0x57, 0xa0, 0x94, 0x10, 0x9a, 0x4e, 0x99,
-	0xf3, 0xbb, 0x0e, 0xe7, 0x44, 0xbb, 0xf5, 0xdd, 0x60, 0xd1, 0xd1, 0x6f, 0xec, 0x00, 0xed, 0x0c,
-	0x1d, 0xa0, 0x9f, 0xb1, 0x03, 0xea, 0x60, 0x52, 0xe6, 0x26, 0x4c, 0x4d, 0x3f, 0x29, 0x20, 0x0b,
-	0x0c, 0x12, 0x1e, 0xab, 0x01, 0xc0, 0x97, 0x8b, 0x46, 0x30, 0xdf, 0xde, 0x08, 0xcb, 0x83, 0xa8,
-	0xf4, 0xff, 0x07, 0x91, 0x93, 0x00, 0x5a, 0xae, 0x9c, 0xa2, 0xb3, 0x0e, 0x26, 0xbf, 0x3e, 0xf2,
-	0x0f, 0x51, 0xc5, 0x52, 0x40, 0x0d, 0xa8, 0x28, 0xa6, 0xa8, 0xad, 0x0b, 0x60, 0x2e, 0x2f, 0x62,
-	0x35, 0xde, 0x1a, 0xab, 0xf3, 0x87, 0xae, 0x0e, 0xbd, 0xef, 0x4e, 0xd3, 0x05, 0x5f, 0x75, 0x30,
-	0xc5, 0x0d, 0x54, 0x17, 0x58, 0x0a, 0x6f, 0x66, 0x51, 0x3f, 0x03, 0x8b, 0xc6, 0xfb, 0x62, 0xb1,
-	0x78, 0x0a, 0x8b, 0xe6, 0x29, 0x2c, 0x96, 0xde, 0x8d, 0xc5, 0xf2, 0x3b, 0xb0, 0x98, 0xc2, 0xf9,
-	0x5c, 0x41, 0x15, 0x8d, 0x17, 0xa1, 0xf4, 0xbd, 0xd0, 0x28, 0x1e, 0x95, 0xf4, 0xbe, 0x88, 0xbc,
-	0xf2, 0x1d, 0x54, 0xe7, 0x7f, 0x65, 0x54, 0x83, 0xf2, 0x61, 0xff, 0xcb, 0xfe, 0xdd, 0xa3, 0xbe,
-	0x55, 0x40, 0x55, 0x30, 0xef, 0x1d, 0xf6, 0xf0, 0x37, 0x96, 0x86, 0x2a, 0x50, 0xc4, 0x87, 0x77,
-	0x7a, 0x96, 0xce, 0x2d, 0x06, 0x7b, 0x37, 0x7b, 0x3b, 0x5b, 0xd8, 0x32, 0xb8, 0xc5, 0xe0, 0xe0,
-	0x2e, 0xee, 0x59, 0x45, 0xae, 0xc7, 0xbd, 0x9d, 0xde, 0xde, 0xfd, 0x9e, 0x65, 0x72, 0xfd, 0xcd,
-	0xde, 0xf6, 0xe1, 0x6d, 0xab, 0x74, 0x65, 0x1b, 0x8a, 0xfc, 0xb7, 0x86, 0xca, 0x60, 0xe0, 0xad,
-	0x23, 0xe9, 0x75, 0xe7, 0xee, 0x61, 0xff, 0xc0, 0xd2, 0xb8, 0x6e, 0x70, 0xb8, 0x6f, 0xe9, 0x7c,
-	0xb1, 0xbf, 0xd7, 0xb7, 0x0c, 0xb1, 0xd8, 0xfa, 0x5a, 0xba, 0x13, 0x56, 0x3d, 0x6c, 0x99, 0xdd,
-	0x1f, 0x74, 0x30, 0x45, 0x8c, 0xe8, 0x53, 0x28, 0xf2, 0x67, 0x10, 0x3a, 0x9f, 0x55, 0x74, 0xe9,
-	0x91, 0xd4, 0xa8, 0xe7, 0x95, 0xaa, 0x7e, 0x9f, 0x43, 0x49, 0xce, 0x2f, 0x74, 0x21, 0x3f, 0xcf,
-	0xb2, 0x6d, 0x17, 0x4f, 0xaa, 0xe5, 0xc6, 0x4f, 0x34, 0xb4, 0x03, 0xb0, 0xe8, 0x2b, 0xb4, 0x9e,
-	0x63, 0x71, 0x79, 0x4a, 0x35, 0x1a, 0xa7, 0x41, 0xea, 0xfc, 0x5b, 0x50, 0x5b, 0xa2, 0x15, 0xe5,
-	0x4d, 0x73, 0xcd, 0xd3, 0xb8, 0x7c, 0x2a, 0x26, 0xfd, 0x74, 0xfb, 0xb0, 0x26, 0x9e, 0xa5, 0xbc,
-	0x2b, 0x64, 0x31, 0x6e, 0x40, 0x0d, 0x93, 0x20, 0x62, 0x44, 0xe8, 0xd1, 0x3c, 0xfd, 0xe5, 0xd7,
-	0x6b, 0xe3, 0xc2, 0x09, 0xad, 0x7a, 0xe5, 0x16, 0xb6, 0x3f, 0x7a, 0xf6, 0x4f, 0xb3, 0xf0, 0xec,
-	0x65, 0x53, 0x7b, 0xfe, 0xb2, 0xa9, 0xfd, 0xfd, 0xb2, 0xa9, 0xfd, 0xfc, 0xaa, 0x59, 0x78, 0xfe,
-	0xaa, 0x59, 0xf8, 0xf3, 0x55, 0xb3, 0xf0, 0xa0, 0xac, 0x1e, 0xda, 0xa3, 0x92, 0xb8, 0x33, 0xd7,
-	0xfe, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x5a, 0xb7, 0x5e, 0x64, 0xd2, 0x0b, 0x00, 0x00,
+	// 1384 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x57, 0x5b, 0x6f, 0x13, 0xc7,
+	0x17, 0xf7, 0x7a, 0xbd, 0xbe, 0x1c, 0x27, 0xfe, 0x9b, 0xc1, 0x81, 0x8d, 0xf9, 0xcb, 0x31, 0xae,
+	0x2a, 0x45, 0x88, 0xda, 0xd4, 0x54, 0x48, 0xad, 0x90, 0xaa, 0x24, 0x18, 0x12, 0x95, 0x18, 0x18,
+	0x27, 0xa4, 0xa5, 0xaa, 0xac, 0xb5, 0x33, 0xac, 0x57, 0x78, 0x2f, 0xec, 0xcc, 0x36, 0x58, 0x7d,
+	0xec, 0x5b, 0x2b, 0x55, 0xfd, 0x0c, 0xfd, 0x14, 0xfd, 0x08, 0xbc, 0x95, 0x47, 0xd4, 0x07, 0xd4,
+	0xc2, 0x73, 0xbf, 0x43, 0x35, 0x97, 0x5d, 0x7b, 0x43, 0xb8, 0x09, 0xd4, 0x17, 0x6b, 0xce, 0xf9,
+	0x9d, 0x39, 0x73, 0xe6, 0x5c, 0x7e, 0x9e, 0x85, 0xb3, 0x94, 0xf9, 0x21, 0xe9, 0x88, 0xdf, 0x60,
+	0xd4, 0x09, 0x83, 0x71, 0x3b, 0x08, 0x7d, 0xe6, 0xa3, 0x3c, 0x9b, 0x58, 0x9e, 0x4f, 0xeb, 0xab,
+	0x69, 0x03, 0x36, 0x0b, 0x08, 0x95, 0x26, 0xf5, 0x9a, 0xed, 0xdb, 0xbe, 0x58, 0x76, 0xf8, 0x4a,
+	0x69, 0x9b, 0xe9, 0x0d, 0x41, 0xe8, 0xbb, 0xc7, 0xf6, 0x29, 0x97, 0x53, 0x6b, 0x44, 0xa6, 0xc7,
+	0x21, 0xdb, 0xf7, 0xed, 0x29, 0xe9, 0x08, 0x69, 0x14, 0xdd, 0xef, 0x58, 0xde, 0x4c, 0x42, 0xad,
+	0xff, 0xc1, 0xf2, 0x41, 0xe8, 0x30, 0x82, 0x09, 0x0d, 0x7c, 0x8f, 0x92, 0xd6, 0x8f, 0x1a, 0x2c,
+	0x29, 0xcd, 0xc3, 0x88, 0x50, 0x86, 0x36, 0x00, 0x98, 0xe3, 0x12, 0x4a, 0x42, 0x87, 0x50, 0x53,
+	0x6b, 0xea, 0xeb, 0xe5, 0xee, 0x39, 0xbe, 0xdb, 0x25, 0x6c, 0x42, 0x22, 0x3a, 0x1c, 0xfb, 0xc1,
+	0xac, 0xbd, 0xe7, 0xb8, 0x64, 0x20, 0x4c, 0x36, 0x73, 0x8f, 0x9f, 0xad, 0x65, 0xf0, 0xc2, 0x26,
+	0x74, 0x06, 0xf2, 0x8c, 0x78, 0x96, 0xc7, 0xcc, 0x6c, 0x53, 0x5b, 0x2f, 0x61, 0x25, 0x21, 0x13,
+	0x0a, 0x21, 0x09, 0xa6, 0xce, 0xd8, 0x32, 0xf5, 0xa6, 0xb6, 0xae, 0xe3, 0x58, 0x6c, 0x2d, 0x43,
+	0x79, 0xc7, 0xbb, 0xef, 0xab, 0x18, 0x5a, 0x3f, 0xeb, 0xb0, 0x24, 0x65, 0x19, 0x25, 0x1a, 0x43,
+	0x5e, 0x5c, 0x34, 0x0e, 0x68, 0xb9, 0x2d, 0x13, 0xdb, 0xbe, 0xc9, 0xb5, 0x9b, 0x57, 0x79, 0x08,
+	0x7f, 0x3e, 0x5b, 0xfb, 0xcc, 0x76, 0xd8, 0x24, 0x1a, 0xb5, 0xc7, 0xbe, 0xdb, 0x91, 0x06, 0x9f,
+	0x38, 0xbe, 0x5a, 0x75, 0x82, 0x07, 0x76, 0x27, 0x95, 0xb3, 0xf6, 0x3d, 0xb1, 0x1b, 0x2b, 0xd7,
+	0x68, 0x15, 0x8a, 0xae, 0xe3, 0x0d, 0xf9, 0x45, 0x44, 0xe0, 0x3a, 0x2e, 0xb8, 0x8e, 0xc7, 0x6f,
+	0x2a, 0x20, 0xeb, 0x91, 0x84, 0x54, 0xe8, 0xae, 0xf5, 0x48, 0x40, 0x1d, 0x28, 0x09, 0xaf, 0x7b,
+	0xb3, 0x80, 0x98, 0xb9, 0xa6, 0xb6, 0x5e, 0xe9, 0x9e, 0x8a, 0xa3, 0x1b, 0xc4, 0x00, 0x9e, 0xdb,
+	0xa0, 0x2b, 0x00, 0xe2, 0xc0, 0x21, 0x25, 0x8c, 0x9a, 0x86, 0xb8, 0x4f, 0xb2, 0x43, 0x86, 0x34,
+	0x20, 0x4c, 0xa5, 0xb5, 0x34, 0x55, 0x32, 0x45, 0x5f, 0xc2, 0xff, 0x69, 0x14, 0x04, 0x7e, 0xc8,
+	0xe8, 0x50, 0x3a, 0xf8, 0xde, 0x9a, 0x46, 0x84, 0x0e, 0x29, 0x0b, 0x89, 0xe5, 0x9a, 0xf9, 0xa6,
+	0xb6, 0x5e, 0xc4, 0xab, 0xb1, 0x8d, 0x70, 0x74, 0x57, 0x58, 0x0c, 0x84, 0x01, 0xba, 0x02, 0x67,
+	0x13, 0x07, 0x0f, 0x23, 0x12, 0xce, 0x86, 0x41, 0x44, 0x27, 0x87, 0xfe, 0x91, 0x67, 0x16, 0xc4,
+	0xde, 0x95, 0x18, 0xbe, 0xc3, 0xd1, 0xdb, 0x0a, 0x6c, 0xfd, 0x93, 0x83, 0x65, 0x59, 0xeb, 0xb8,
+	0x47, 0x16, 0x33, 0xa5, 0xbd, 0x3a, 0x53, 0xd9, 0x74, 0xa6, 0xae, 0x70, 0x88, 0x8d, 0x27, 0x24,
+	0xa4, 0xa6, 0x2e, 0xae, 0x5d, 0x4b, 0x95, 0x71, 0x57, 0x82, 0xea, 0xe6, 0x89, 0x2d, 0xea, 0xc2,
+	0x0a, 0x77, 0x19, 0x12, 0xea, 0x4f, 0x23, 0xe6, 0xf8, 0xde, 0xf0, 0xc8, 0xf1, 0x0e, 0xfd, 0x23,
+	0x91, 0x6d, 0x1d, 0x9f, 0x76, 0xad, 0x47, 0x38, 0xc1, 0x0e, 0x04, 0x84, 0x2e, 0x02, 0x58, 0xb6,
+	0x1d, 0x12, 0xdb, 0x62, 0x44, 0x26, 0xb9, 0xd2, 0x5d, 0x8a, 0x4f, 0xdb, 0xb0, 0xed, 0x10, 0x2f,
+	0xe0, 0xe8, 0x0b, 0x58, 0x0d, 0xac, 0x90, 0x39, 0xd6, 0x74, 0x18, 0xaa, 0x96, 0x1b, 0x1e, 0x3a,
+	0xd4, 0x1a, 0x4d, 0xc9, 0xa1, 0xca, 0xeb, 0x59, 0x65, 0x10, 0xb7, 0xe4, 0x35, 0x05, 0xa3, 0x6f,
+	0x4f, 0xd8, 0x4b, 0x59, 0x68, 0x31, 0x62, 0xcf, 0x44, 0x5e, 0x2b, 0xdd, 0xb5, 0xf8, 0xe0, 0xdb,
+	0x69, 0x1f, 0x03, 0x65, 0xf6, 0x92, 0xf3, 0x18, 0x40, 0x6b, 0x50, 0xa6, 0x0f, 0x9c, 0x60, 0x38,
+	0x9e, 0x44, 0xde, 0x03, 0x6a, 0x16, 0x45, 0x28, 0xc0, 0x55, 0x5b, 0x42, 0x83, 0x2e, 0x80, 0x31,
+	0x71, 0x3c, 0x46, 0xcd, 0x52, 0x53, 0x13, 0x09, 0x95, 0xa3, 0xdf, 0x8e, 0x47, 0xbf, 0xbd, 0xe1,
+	0xcd, 0xb0, 0x34, 0x41, 0x08, 0x72, 0x94, 0x91, 0xc0, 0x04, 0x91, 0x36, 0xb1, 0x46, 0x35, 0x30,
+	0x42, 0xcb, 0xb3, 0x89, 0x59, 0x16, 0x4a, 0x29, 0xa0, 0xcb, 0x50, 0x96, 0x0d, 0x22, 0x7d, 0x2f,
+	0x09, 0xdf, 0x28, 0xbe, 0x85, 0xe8, 0x8e, 0x6d, 0x8e, 0x60, 0x78, 0x98, 0xac, 0x79, 0xe5, 0x3d,
+	0x7f, 0x38, 0xb6, 0xc6, 0x13, 0x62, 0x2e, 0x8b, 0x40, 0x0b, 0x9e, 0xbf, 0xc5, 0x45, 0x74, 0x11,
+	0x8a, 0x49, 0xab, 0x55, 0x84, 0xb3, 0x6a, 0x92, 0x12, 0xa5, 0xc7, 0x89, 0x45, 0xeb, 0x37, 0x0d,
+	0x60, 0x7e, 0x86, 0xc8, 0x01, 0x23, 0xc1, 0xd0, 0x75, 0xa6, 0x53, 0x87, 0xaa, 0x7e, 0x03, 0xae,
+	0xda, 0x15, 0x1a, 0xd4, 0x84, 0xdc, 0xfd, 0xc8, 0x1b, 0x8b, 0x76, 0x2b, 0xcf, 0xab, 0x7c, 0x3d,
+	0xf2, 0xc6, 0x58, 0x20, 0xfc, 0x7c, 0x3b, 0xf4, 0xa3, 0xc0, 0xf1, 0x6c, 0x33, 0x97, 0x3e, 0xff,
+	0x86, 0xd2, 0xe3, 0xc4, 0x02, 0x7d, 0x14, 0xe7, 0xc4, 0x68, 0x6a, 0x8b, 0x5c, 0x83, 0xb9, 0x52,
+	0xa5, 0xa8, 0x55, 0x87, 0x1c, 0x3f, 0x80, 0x27, 0xd5, 0xb3, 0xd4, 0x18, 0x94, 0xb0, 0x58, 0xb7,
+	0xba, 0x50, 0x8c, 0xdd, 0xa2, 0x0a, 0x64, 0x47, 0x33, 0x81, 0x16, 0x71, 0x76, 0x34, 0xe3, 0xdc,
+	0xa8, 0x98, 0x8c, 0x8f, 0x40, 0x29, 0x26, 0x9f, 0xd6, 0x1a, 0x18, 0xc2, 0x3f, 0x37, 0x48, 0xdd,
+	0x54, 0x49, 0xad, 0x5f, 0x34, 0xa8, 0xc4, 0x53, 0xa8, 0x58, 0x71, 0x1d, 0xf2, 0x09, 0x4d, 0xf3,
+	0x48, 0x2b, 0x09, 0xef, 0x08, 0xed, 0x76, 0x06, 0x2b, 0x1c, 0xd5, 0xa1, 0x70, 0x64, 0x85, 0x1e,
+	0xbf, 0xbf, 0xa0, 0xe4, 0xed, 0x0c, 0x8e, 0x15, 0xe8, 0x62, 0xdc, 0x42, 0xfa, 0xab, 0x5b, 0x68,
+	0x3b, 0xa3, 0x9a, 0x68, 0xb3, 0x08, 0xf9, 0x90, 0xd0, 0x68, 0xca, 0x5a, 0xbf, 0x67, 0xe1, 0x94,
+	0x98, 0xdb, 0xbe, 0xe5, 0xce, 0xa9, 0xe1, 0xb5, 0xa3, 0xa4, 0xbd, 0xc7, 0x28, 0x65, 0xdf, 0x73,
+	0x94, 0x6a, 0x60, 0x50, 0x66, 0x85, 0x4c, 0xf1, 0xb7, 0x14, 0x50, 0x15, 0x74, 0xe2, 0x1d, 0x2a,
+	0x26, 0xe1, 0xcb, 0xf9, 0x44, 0x19, 0x6f, 0x9e, 0xa8, 0x45, 0x46, 0xcb, 0xbf, 0x3d, 0xa3, 0xb5,
+	0x42, 0x40, 0x8b, 0x99, 0x53, 0xe5, 0xac, 0x81, 0xc1, 0xdb, 0x47, 0xfe, 0xc7, 0x95, 0xb0, 0x14,
+	0x50, 0x1d, 0x8a, 0xaa, 0x52, 0xd4, 0xcc, 0x0a, 0x20, 0x91, 0xe7, 0xb1, 0xea, 0x6f, 0x8c, 0xb5,
+	0xf5, 0x47, 0x16, 0xd0, 0xc2, 0x7f, 0x42, 0x5c, 0xaf, 0x1a, 0x18, 0xa2, 0x03, 0x55, 0x03, 0x4b,
+	0xe1, 0xf5, 0x55, 0xcc, 0xbe, 0x47, 0x15, 0xf5, 0x0f, 0x55, 0xc5, 0xdc, 0x09, 0x55, 0x34, 0x4e,
+	0xa8, 0x62, 0xfe, 0xdd, 0xaa, 0x58, 0x78, 0x87, 0x2a, 0x46, 0x70, 0x3a, 0x95, 0x50, 0x55, 0xc6,
+	0x33, 0x90, 0x97, 0x7f, 0xcc, 0xaa, 0x8e, 0x4a, 0xfa, 0x60, 0x85, 0xfc, 0x01, 0x56, 0x5f, 0xfa,
+	0x6f, 0xff, 0xcf, 0x0e, 0xff, 0x49, 0x83, 0x62, 0x4c, 0xd9, 0x9c, 0xfb, 0x04, 0xf1, 0x2a, 0xee,
+	0xe3, 0x6b, 0x74, 0x1e, 0x96, 0x04, 0x41, 0xc6, 0x74, 0x2d, 0xdf, 0x00, 0x65, 0xa1, 0x53, 0x7c,
+	0xfd, 0xb6, 0x93, 0x78, 0x8c, 0xf8, 0x8d, 0xe3, 0xc4, 0x7f, 0xe1, 0x3b, 0x28, 0x25, 0x2f, 0x2c,
+	0x54, 0x86, 0xc2, 0x7e, 0xff, 0xab, 0xfe, 0xad, 0x83, 0x7e, 0x35, 0x83, 0x4a, 0x60, 0xdc, 0xd9,
+	0xef, 0xe1, 0x6f, 0xaa, 0x1a, 0x2a, 0x42, 0x0e, 0xef, 0xdf, 0xec, 0x55, 0xb3, 0xdc, 0x62, 0xb0,
+	0x73, 0xad, 0xb7, 0xb5, 0x81, 0xab, 0x3a, 0xb7, 0x18, 0xec, 0xdd, 0xc2, 0xbd, 0x6a, 0x8e, 0xeb,
+	0x71, 0x6f, 0xab, 0xb7, 0x73, 0xb7, 0x57, 0x35, 0xb8, 0xfe, 0x5a, 0x6f, 0x73, 0xff, 0x46, 0x35,
+	0x7f, 0x61, 0x13, 0x72, 0xfc, 0xa5, 0x80, 0x0a, 0xa0, 0xe3, 0x8d, 0x03, 0xe9, 0x75, 0xeb, 0xd6,
+	0x7e, 0x7f, 0xaf, 0xaa, 0x71, 0xdd, 0x60, 0x7f, 0xb7, 0x9a, 0xe5, 0x8b, 0xdd, 0x9d, 0x7e, 0x55,
+	0x17, 0x8b, 0x8d, 0xaf, 0xa5, 0x3b, 0x61, 0xd5, 0xc3, 0x55, 0xa3, 0xfb, 0x34, 0x0b, 0x86, 0x88,
+	0x11, 0x7d, 0x0a, 0x39, 0xfe, 0xa4, 0x45, 0xa7, 0xe3, 0xde, 0x5a, 0x78, 0xf0, 0xd6, 0x6b, 0x69,
+	0xa5, 0x2a, 0xe6, 0xe7, 0x90, 0x97, 0x4c, 0x8e, 0x56, 0xd2, 0xcc, 0x1e, 0x6f, 0x3b, 0x73, 0x5c,
+	0x2d, 0x37, 0x5e, 0xd2, 0xd0, 0x16, 0xc0, 0x9c, 0x61, 0xd0, 0x6a, 0xaa, 0x9f, 0x17, 0xf9, 0xba,
+	0x5e, 0x3f, 0x09, 0x52, 0xe7, 0x5f, 0x87, 0xf2, 0x42, 0xa7, 0xa1, 0xb4, 0x69, 0x8a, 0x46, 0xea,
+	0xe7, 0x4e, 0xc4, 0x94, 0x9f, 0x3d, 0x38, 0xb5, 0xa0, 0x56, 0xaf, 0xd1, 0xd7, 0x79, 0x3b, 0x7f,
+	0x02, 0x96, 0x6e, 0xf4, 0x4b, 0x5a, 0xb7, 0x0f, 0x15, 0xf1, 0xe1, 0xc2, 0x59, 0x47, 0xa6, 0xf8,
+	0x2a, 0x94, 0x31, 0x71, 0x7d, 0x46, 0x84, 0x1e, 0x25, 0x49, 0x5d, 0xfc, 0xbe, 0xa9, 0xaf, 0x1c,
+	0xd3, 0xaa, 0xef, 0xa0, 0xcc, 0xe6, 0xc7, 0x8f, 0xff, 0x6e, 0x64, 0x1e, 0x3f, 0x6f, 0x68, 0x4f,
+	0x9e, 0x37, 0xb4, 0xbf, 0x9e, 0x37, 0xb4, 0x5f, 0x5f, 0x34, 0x32, 0x4f, 0x5e, 0x34, 0x32, 0x4f,
+	0x5f, 0x34, 0x32, 0xf7, 0x0a, 0xea, 0x53, 0x6c, 0x94, 0x17, 0x63, 0x71, 0xf9, 0xdf, 0x01, 0x00,
+	0xba, 0x5a, 0x53, 0x52, 0xf4, 0x0d, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -890,6 +1003,9 @@ type StoreClient interface {
 	LabelNames(ctx context.Context, in *LabelNamesRequest, opts ...grpc.CallOption) (*LabelNamesResponse, error)
 	/// LabelValues returns all label values for given label name.
 	LabelValues(ctx context.Context, in *LabelValuesRequest, opts ...grpc.CallOption) (*LabelValuesResponse, error)
+	/// LabelValuesStream returns all label values for given label name, split into chunks of bounded size.
+	/// It is only supported by stores that advertise it in their Info response.
+	LabelValuesStream(ctx context.Context, in *LabelValuesRequest, opts ...grpc.CallOption) (Store_LabelValuesStreamClient, error)
 }
 
 type storeClient struct {
@@ -959,6 +1075,38 @@ func (c *storeClient) LabelValues(ctx context.Context, in *LabelValuesRequest, o
 	return out, nil
 }
 
+func (c *storeClient) LabelValuesStream(ctx context.Context, in *LabelValuesRequest, opts ...grpc.CallOption) (Store_LabelValuesStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Store_serviceDesc.Streams[1], "/thanos.Store/LabelValuesStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storeLabelValuesStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Store_LabelValuesStreamClient interface {
+	Recv() (*LabelValuesStreamResponse, error)
+	grpc.ClientStream
+}
+
+type storeLabelValuesStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *storeLabelValuesStreamClient) Recv() (*LabelValuesStreamResponse, error) {
+	m := new(LabelValuesStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // StoreServer is the server API for Store service.
 type StoreServer interface {
 	/// Info returns meta information about a store e.g labels that makes that store unique as well as time range that is
@@ -978,6 +1126,9 @@ type StoreServer interface {
 	LabelNames(context.Context, *LabelNamesRequest) (*LabelNamesResponse, error)
 	/// LabelValues returns all label values for given label name.
 	LabelValues(context.Context, *LabelValuesRequest) (*LabelValuesResponse, error)
+	/// LabelValuesStream returns all label values for given label name, split into chunks of bounded size.
+	/// It is only supported by stores that advertise it in their Info response.
+	LabelValuesStream(*LabelValuesRequest, Store_LabelValuesStreamServer) error
 }
 
 // UnimplementedStoreServer can be embedded to have forward compatible implementations.
@@ -996,6 +1147,9 @@ func (*UnimplementedStoreServer) LabelNames(ctx context.Context, req *LabelNames
 func (*UnimplementedStoreServer) LabelValues(ctx context.Context, req *LabelValuesRequest) (*LabelValuesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method LabelValues not implemented")
 }
+func (*UnimplementedStoreServer) LabelValuesStream(req *LabelValuesRequest, srv Store_LabelValuesStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method LabelValuesStream not implemented")
+}
 
 func RegisterStoreServer(s *grpc.Server, srv StoreServer) {
 	s.RegisterService(&_Store_serviceDesc, srv)
@@ -1076,6 +1230,27 @@ func _Store_LabelValues_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Store_LabelValuesStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LabelValuesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StoreServer).LabelValuesStream(m, &storeLabelValuesStreamServer{stream})
+}
+
+type Store_LabelValuesStreamServer interface {
+	Send(*LabelValuesStreamResponse) error
+	grpc.ServerStream
+}
+
+type storeLabelValuesStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *storeLabelValuesStreamServer) Send(m *LabelValuesStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Store_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "thanos.Store",
 	HandlerType: (*StoreServer)(nil),
@@ -1099,6 +1274,11 @@ var _Store_serviceDesc = grpc.ServiceDesc{
 			Handler:       _Store_Series_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "LabelValuesStream",
+			Handler:       _Store_LabelValuesStream_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "store/storepb/rpc.proto",
 }
@@ -1292,6 +1472,26 @@ func (m *InfoResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.SupportsQueryPushdown {
+		i--
+		if m.SupportsQueryPushdown {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x38
+	}
+	if m.SupportsLabelValuesStream {
+		i--
+		if m.SupportsLabelValuesStream {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x30
+	}
 	if len(m.LabelSets) > 0 {
 		for iNdEx := len(m.LabelSets) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1358,6 +1558,28 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Pushdown != nil {
+		{
+			size, err := m.Pushdown.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x72
+	}
+	if m.NoCache {
+		i--
+		if m.NoCache {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x68
+	}
 	if m.QueryHints != nil {
 		{
 			size, err := m.QueryHints.MarshalToSizedBuffer(dAtA[:i])
@@ -1418,20 +1640,20 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		dAtA[i] = 0x30
 	}
 	if len(m.Aggregates) > 0 {
-		dAtA4 := make([]byte, len(m.Aggregates)*10)
-		var j3 int
+		dAtA5 := make([]byte, len(m.Aggregates)*10)
+		var j4 int
 		for _, num := range m.Aggregates {
 			for num >= 1<<7 {
-				dAtA4[j3] = uint8(uint64(num)&0x7f | 0x80)
+				dAtA5[j4] = uint8(uint64(num)&0x7f | 0x80)
 				num >>= 7
-				j3++
+				j4++
 			}
-			dAtA4[j3] = uint8(num)
-			j3++
+			dAtA5[j4] = uint8(num)
+			j4++
 		}
-		i -= j3
-		copy(dAtA[i:], dAtA4[:j3])
-		i = encodeVarintRpc(dAtA, i, uint64(j3))
+		i -= j4
+		copy(dAtA[i:], dAtA5[:j4])
+		i = encodeVarintRpc(dAtA, i, uint64(j4))
 		i--
 		dAtA[i] = 0x2a
 	}
@@ -1980,6 +2202,109 @@ func (m *LabelValuesResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *LabelValuesStreamResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *LabelValuesStreamResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *LabelValuesStreamResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Hints != nil {
+		{
+			size, err := m.Hints.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Values) > 0 {
+		for iNdEx := len(m.Values) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Values[iNdEx])
+			copy(dAtA[i:], m.Values[iNdEx])
+			i = encodeVarintRpc(dAtA, i, uint64(len(m.Values[iNdEx])))
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Pushdown) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Pushdown) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Pushdown) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.StepMillis != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.StepMillis))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.End != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.End))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Start != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Start))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.RangeMillis != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.RangeMillis))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Func) > 0 {
+		i -= len(m.Func)
+		copy(dAtA[i:], m.Func)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Func)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintRpc(dAtA []byte, offset int, v uint64) int {
 	offset -= sovRpc(v)
 	base := offset
@@ -2058,6 +2383,12 @@ func (m *InfoResponse) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.SupportsLabelValuesStream {
+		n += 2
+	}
+	if m.SupportsQueryPushdown {
+		n += 2
+	}
 	return n
 }
 
@@ -2112,6 +2443,13 @@ func (m *SeriesRequest) Size() (n int) {
 		l = m.QueryHints.Size()
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if m.NoCache {
+		n += 2
+	}
+	if m.Pushdown != nil {
+		l = m.Pushdown.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	return n
 }
 
@@ -2344,34 +2682,84 @@ func (m *LabelValuesResponse) Size() (n int) {
 	return n
 }
 
-func sovRpc(x uint64) (n int) {
-	return (math_bits.Len64(x|1) + 6) / 7
-}
-func sozRpc(x uint64) (n int) {
-	return sovRpc(uint64((x << 1) ^ uint64((int64(x) >> 63))))
-}
-func (m *WriteResponse) Unmarshal(dAtA []byte) error {
-	l := len(dAtA)
-	iNdEx := 0
-	for iNdEx < l {
-		preIndex := iNdEx
-		var wire uint64
-		for shift := uint(0); ; shift += 7 {
-			if shift >= 64 {
-				return ErrIntOverflowRpc
-			}
-			if iNdEx >= l {
-				return io.ErrUnexpectedEOF
-			}
-			b := dAtA[iNdEx]
-			iNdEx++
-			wire |= uint64(b&0x7F) << shift
-			if b < 0x80 {
-				break
-			}
+func (m *LabelValuesStreamResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Values) > 0 {
+		for _, s := range m.Values {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
 		}
-		fieldNum := int32(wire >> 3)
-		wireType := int(wire & 0x7)
+	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.Hints != nil {
+		l = m.Hints.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	return n
+}
+
+func (m *Pushdown) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Func)
+	if l > 0 {
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.RangeMillis != 0 {
+		n += 1 + sovRpc(uint64(m.RangeMillis))
+	}
+	if m.Start != 0 {
+		n += 1 + sovRpc(uint64(m.Start))
+	}
+	if m.End != 0 {
+		n += 1 + sovRpc(uint64(m.End))
+	}
+	if m.StepMillis != 0 {
+		n += 1 + sovRpc(uint64(m.StepMillis))
+	}
+	return n
+}
+
+func sovRpc(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozRpc(x uint64) (n int) {
+	return sovRpc(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *WriteResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
 		if wireType == 4 {
 			return fmt.Errorf("proto: WriteResponse: wiretype end group for non-group")
 		}
@@ -2739,6 +3127,46 @@ func (m *InfoResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsLabelValuesStream", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsLabelValuesStream = bool(v != 0)
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SupportsQueryPushdown", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.SupportsQueryPushdown = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -3118,6 +3546,62 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NoCache", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.NoCache = bool(v != 0)
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Pushdown", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Pushdown == nil {
+				m.Pushdown = &Pushdown{}
+			}
+			if err := m.Pushdown.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -4447,6 +4931,314 @@ func (m *LabelValuesResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *LabelValuesStreamResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LabelValuesStreamResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LabelValuesStreamResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Values", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Values = append(m.Values, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hints", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Hints == nil {
+				m.Hints = &types.Any{}
+			}
+			if err := m.Hints.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Pushdown) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Pushdown: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Pushdown: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Func", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Func = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RangeMillis", wireType)
+			}
+			m.RangeMillis = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RangeMillis |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			m.Start = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Start |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field End", wireType)
+			}
+			m.End = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.End |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StepMillis", wireType)
+			}
+			m.StepMillis = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StepMillis |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipRpc(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
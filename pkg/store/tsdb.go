@@ -287,3 +287,12 @@ func (s *TSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesReque
 
 	return &storepb.LabelValuesResponse{Values: res}, nil
 }
+
+// LabelValuesStream returns all known label values for a given label name, split into chunks of bounded size.
+func (s *TSDBStore) LabelValuesStream(r *storepb.LabelValuesRequest, srv storepb.Store_LabelValuesStreamServer) error {
+	resp, err := s.LabelValues(srv.Context(), r)
+	if err != nil {
+		return err
+	}
+	return storepb.SendLabelValuesStream(srv, resp, storepb.LabelValuesStreamChunkSize)
+}
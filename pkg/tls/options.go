@@ -15,10 +15,18 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// certSettleDelay is how long certificate files must be left unchanged before they are reloaded, so that files being
+// written aren't loaded half-written.
+const certSettleDelay = time.Second
+
 // NewServerConfig provides new server TLS configuration.
-func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config, error) {
+// The server certificate and the client CA are reloaded on handshakes after their files changed, without restart.
+// The expiry of the server certificate is exposed as tls_cert_expiry_timestamp_seconds, registered with reg.
+func NewServerConfig(logger log.Logger, reg prometheus.Registerer, cert, key, clientCA string) (*tls.Config, error) {
 	if key == "" && cert == "" {
 		if clientCA != "" {
 			return nil, errors.New("when a client CA is used a server key and certificate must also be provided")
@@ -39,24 +47,31 @@ func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config
 	}
 
 	mngr := &serverTLSManager{
-		srvCertPath: cert,
-		srvKeyPath:  key,
+		logger:       logger,
+		srvCertPath:  cert,
+		srvKeyPath:   key,
+		clientCAPath: clientCA,
+		settleDelay:  certSettleDelay,
+		certExpiry: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "tls_cert_expiry_timestamp_seconds",
+			Help: "Expiry time of the loaded server certificate in Unix seconds.",
+		}),
+	}
+	if _, err := mngr.getCertificate(nil); err != nil {
+		return nil, err
 	}
 
 	tlsCfg.GetCertificate = mngr.getCertificate
 
 	if clientCA != "" {
-		caPEM, err := ioutil.ReadFile(filepath.Clean(clientCA))
+		certPool, err := mngr.getClientCAs()
 		if err != nil {
-			return nil, errors.Wrap(err, "reading client CA")
-		}
-
-		certPool := x509.NewCertPool()
-		if !certPool.AppendCertsFromPEM(caPEM) {
-			return nil, errors.Wrap(err, "building client CA")
+			return nil, err
 		}
 		tlsCfg.ClientCAs = certPool
 		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		mngr.baseCfg = tlsCfg.Clone()
+		tlsCfg.GetConfigForClient = mngr.getConfigForClient
 
 		level.Info(logger).Log("msg", "server TLS client verification enabled")
 	}
@@ -65,16 +80,37 @@ func NewServerConfig(logger log.Logger, cert, key, clientCA string) (*tls.Config
 }
 
 type serverTLSManager struct {
-	srvCertPath string
-	srvKeyPath  string
+	logger       log.Logger
+	srvCertPath  string
+	srvKeyPath   string
+	clientCAPath string
+	settleDelay  time.Duration
+	certExpiry   prometheus.Gauge
+	baseCfg      *tls.Config
+
+	mtx              sync.Mutex
+	srvCert          *tls.Certificate
+	srvCertModTime   time.Time
+	srvKeyModTime    time.Time
+	clientCAs        *x509.CertPool
+	clientCAsModTime time.Time
+}
 
-	mtx            sync.Mutex
-	srvCert        *tls.Certificate
-	srvCertModTime time.Time
-	srvKeyModTime  time.Time
+// settled returns true if files last modified at the given times can be loaded, i.e. if nothing was loaded yet or
+// they weren't modified during the settle delay.
+func (m *serverTLSManager) settled(loaded bool, modTimes ...time.Time) bool {
+	if !loaded {
+		return true
+	}
+	for _, t := range modTimes {
+		if time.Since(t) < m.settleDelay {
+			return false
+		}
+	}
+	return true
 }
 
-func (m *serverTLSManager) getCertificate(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+func (m *serverTLSManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -87,18 +123,85 @@ func (m *serverTLSManager) getCertificate(clientHello *tls.ClientHelloInfo) (*tl
 		return nil, err
 	}
 
-	if m.srvCert == nil || !statCert.ModTime().Equal(m.srvCertModTime) || !statKey.ModTime().Equal(m.srvKeyModTime) {
-		cert, err := tls.LoadX509KeyPair(m.srvCertPath, m.srvKeyPath)
-		if err != nil {
+	if m.srvCert != nil && statCert.ModTime().Equal(m.srvCertModTime) && statKey.ModTime().Equal(m.srvKeyModTime) {
+		return m.srvCert, nil
+	}
+	// Keep the current certificate until the files are fully written.
+	if !m.settled(m.srvCert != nil, statCert.ModTime(), statKey.ModTime()) {
+		return m.srvCert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(m.srvCertPath, m.srvKeyPath)
+	if err == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if err != nil {
+		if m.srvCert == nil {
 			return nil, errors.Wrap(err, "server credentials")
 		}
-		m.srvCertModTime = statCert.ModTime()
-		m.srvKeyModTime = statKey.ModTime()
-		m.srvCert = &cert
+		// The certificate and the key may be rotated one after the other, retry on the next handshake.
+		level.Error(m.logger).Log("msg", "failed to reload server certificate, keeping the current one", "err", err)
+		return m.srvCert, nil
+	}
+	if m.srvCert != nil {
+		level.Info(m.logger).Log("msg", "reloaded server certificate", "expiry", cert.Leaf.NotAfter)
 	}
+	m.srvCertModTime = statCert.ModTime()
+	m.srvKeyModTime = statKey.ModTime()
+	m.srvCert = &cert
+	m.certExpiry.Set(float64(cert.Leaf.NotAfter.Unix()))
 	return m.srvCert, nil
 }
 
+// getClientCAs returns the pool of the client CA, reloaded if its file changed.
+func (m *serverTLSManager) getClientCAs() (*x509.CertPool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	statCA, err := os.Stat(m.clientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	if m.clientCAs != nil && statCA.ModTime().Equal(m.clientCAsModTime) {
+		return m.clientCAs, nil
+	}
+	if !m.settled(m.clientCAs != nil, statCA.ModTime()) {
+		return m.clientCAs, nil
+	}
+
+	caPEM, err := ioutil.ReadFile(filepath.Clean(m.clientCAPath))
+	if err != nil {
+		err = errors.Wrap(err, "reading client CA")
+	} else {
+		certPool := x509.NewCertPool()
+		if certPool.AppendCertsFromPEM(caPEM) {
+			if m.clientCAs != nil {
+				level.Info(m.logger).Log("msg", "reloaded client CA")
+			}
+			m.clientCAsModTime = statCA.ModTime()
+			m.clientCAs = certPool
+			return m.clientCAs, nil
+		}
+		err = errors.New("building client CA")
+	}
+	if m.clientCAs == nil {
+		return nil, err
+	}
+	level.Error(m.logger).Log("msg", "failed to reload client CA, keeping the current one", "err", err)
+	return m.clientCAs, nil
+}
+
+// getConfigForClient returns the server configuration with the current client CA.
+func (m *serverTLSManager) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	certPool, err := m.getClientCAs()
+	if err != nil {
+		return nil, err
+	}
+	cfg := m.baseCfg.Clone()
+	cfg.ClientCAs = certPool
+	return cfg, nil
+}
+
 // NewClientConfig provides new client TLS configuration.
 func NewClientConfig(logger log.Logger, cert, key, caCert, serverName string, skipVerify bool) (*tls.Config, error) {
 	var certPool *x509.CertPool
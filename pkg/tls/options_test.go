@@ -0,0 +1,99 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+// writeCert writes a self-signed certificate expiring at the given time and its key, modified at the given time.
+func writeCert(t *testing.T, certPath, keyPath string, notAfter, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	testutil.Ok(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	testutil.Ok(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	testutil.Ok(t, os.Chtimes(certPath, modTime, modTime))
+	testutil.Ok(t, os.Chtimes(keyPath, modTime, modTime))
+}
+
+func TestServerConfig_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert"), filepath.Join(dir, "key")
+	caPath, caKeyPath := filepath.Join(dir, "ca"), filepath.Join(dir, "ca-key")
+
+	first := time.Unix(time.Now().Add(24*time.Hour).Unix(), 0).UTC()
+	writeCert(t, certPath, keyPath, first, time.Now().Add(-time.Hour))
+	writeCert(t, caPath, caKeyPath, first, time.Now().Add(-time.Hour))
+
+	reg := prometheus.NewRegistry()
+	cfg, err := NewServerConfig(log.NewNopLogger(), reg, certPath, keyPath, caPath)
+	testutil.Ok(t, err)
+
+	expectExpiry := func(exp time.Time) {
+		t.Helper()
+		cert, err := cfg.GetCertificate(nil)
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp, cert.Leaf.NotAfter)
+
+		mfs, err := reg.Gather()
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(mfs))
+		testutil.Equals(t, "tls_cert_expiry_timestamp_seconds", mfs[0].GetName())
+		testutil.Equals(t, float64(exp.Unix()), mfs[0].GetMetric()[0].GetGauge().GetValue())
+	}
+	expectExpiry(first)
+
+	// Files which were just written are only loaded once they settled.
+	second := first.Add(time.Hour)
+	writeCert(t, certPath, keyPath, second, time.Now())
+	expectExpiry(first)
+	testutil.Ok(t, os.Chtimes(certPath, time.Now().Add(-time.Minute), time.Now().Add(-time.Minute)))
+	testutil.Ok(t, os.Chtimes(keyPath, time.Now().Add(-time.Minute), time.Now().Add(-time.Minute)))
+	expectExpiry(second)
+
+	// Invalid files don't replace the current certificate.
+	testutil.Ok(t, ioutil.WriteFile(certPath, []byte("half-written"), 0600))
+	testutil.Ok(t, os.Chtimes(certPath, time.Now().Add(-time.Minute), time.Now().Add(-time.Minute)))
+	expectExpiry(second)
+
+	// The client CA is reloaded too.
+	clientCfg, err := cfg.GetConfigForClient(nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, tls.RequireAndVerifyClientCert, clientCfg.ClientAuth)
+	testutil.Equals(t, cfg.ClientCAs, clientCfg.ClientCAs)
+
+	writeCert(t, caPath, caKeyPath, second, time.Now().Add(-time.Minute))
+	clientCfg, err = cfg.GetConfigForClient(nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, cfg.ClientCAs != clientCfg.ClientCAs, "client CA not reloaded")
+	expectExpiry(second)
+}
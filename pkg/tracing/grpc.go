@@ -5,11 +5,15 @@ package tracing
 
 import (
 	"context"
+	"strings"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
 	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tracing"
 	opentracing "github.com/opentracing/opentracing-go"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
 )
 
 // UnaryClientInterceptor returns a new unary client interceptor for OpenTracing.
@@ -23,22 +27,59 @@ func StreamClientInterceptor(tracer opentracing.Tracer) grpc.StreamClientInterce
 }
 
 // UnaryServerInterceptor returns a new unary server interceptor for OpenTracing and injects given tracer.
+// Requests with the ForceTracingBaggageKey metadata are traced regardless of the sampling decision.
 func UnaryServerInterceptor(tracer opentracing.Tracer) grpc.UnaryServerInterceptor {
 	interceptor := grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(tracer))
+	forcedInterceptor := grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(forceTracingTracer{Tracer: tracer}))
 	return func(parentCtx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if forceTracing(parentCtx) {
+			return forcedInterceptor(ContextWithTracer(parentCtx, tracer), req, info, handler)
+		}
 		// Add our own tracer.
 		return interceptor(ContextWithTracer(parentCtx, tracer), req, info, handler)
 	}
 }
 
 // StreamServerInterceptor returns a new streaming server interceptor for OpenTracing and injects given tracer.
+// Requests with the ForceTracingBaggageKey metadata are traced regardless of the sampling decision.
 func StreamServerInterceptor(tracer opentracing.Tracer) grpc.StreamServerInterceptor {
 	interceptor := grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(tracer))
+	forcedInterceptor := grpc_opentracing.StreamServerInterceptor(grpc_opentracing.WithTracer(forceTracingTracer{Tracer: tracer}))
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		// Add our own tracer.
 		wrappedStream := grpc_middleware.WrapServerStream(stream)
 		wrappedStream.WrappedContext = ContextWithTracer(stream.Context(), tracer)
 
+		if forceTracing(stream.Context()) {
+			return forcedInterceptor(srv, wrappedStream, info, handler)
+		}
 		return interceptor(srv, wrappedStream, info, handler)
 	}
 }
+
+// forceTracing returns true if the incoming request asks to be traced with the ForceTracingBaggageKey metadata.
+func forceTracing(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, v := range md.Get(ForceTracingBaggageKey) {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// forceTracingTracer starts spans forcing their trace to be sampled, the same way the HTTP middleware does for
+// requests with the ForceTracingBaggageKey header.
+type forceTracingTracer struct {
+	opentracing.Tracer
+}
+
+func (t forceTracingTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	// The tag is required for the OpenTelemetry sampler to force tracing.
+	span := t.Tracer.StartSpan(operationName, append(opts, opentracing.Tag{Key: migration.ForceTracingAttributeKey, Value: "true"})...)
+	span.SetBaggageItem(strings.ToLower(ForceTracingBaggageKey), "true")
+	return span
+}
@@ -0,0 +1,57 @@
+// Copyright (c) The Thanos Authors.
+// Licensed under the Apache License 2.0.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/thanos-io/thanos/pkg/tracing/migration"
+)
+
+func TestMain(m *testing.M) {
+	testutil.TolerantVerifyLeakMain(m)
+}
+
+func TestUnaryServerInterceptor_ForceTracing(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := tracesdk.NewTracerProvider(
+		tracesdk.WithSpanProcessor(tracesdk.NewSimpleSpanProcessor(exp)),
+		// Never sample, unless forced.
+		tracesdk.WithSampler(migration.SamplerWithOverride(tracesdk.ParentBased(tracesdk.NeverSample()), attribute.Key(migration.ForceTracingAttributeKey))),
+	)
+	tracer, closer := migration.Bridge(tp, log.NewNopLogger())
+	defer func() { testutil.Ok(t, closer.Close()) }()
+
+	interceptor := UnaryServerInterceptor(tracer)
+	info := &grpc.UnaryServerInfo{FullMethod: "/thanos.Query/Query"}
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		span, _ := StartSpan(ctx, "query")
+		span.Finish()
+		return nil, nil
+	}
+
+	_, err := interceptor(context.Background(), nil, info, handler)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(exp.GetSpans()))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ForceTracingBaggageKey, "true"))
+	_, err = interceptor(ctx, nil, info, handler)
+	testutil.Ok(t, err)
+
+	spans := exp.GetSpans()
+	testutil.Equals(t, 2, len(spans))
+	for _, s := range spans {
+		testutil.Assert(t, s.SpanContext.IsSampled(), "span %s is not sampled", s.Name)
+	}
+	testutil.Equals(t, spans[0].SpanContext.TraceID(), spans[1].SpanContext.TraceID())
+}